@@ -0,0 +1,230 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package agent serves a management API for GooGet over HTTP, so that
+// orchestration tools can manage packages on a machine without a remote
+// shell. Requests must carry the agent token as "Authorization: Bearer
+// <token>". Responses are JSON:
+//
+//	GET  /v1/installed  the installed packages
+//	GET  /v1/available  the packages available from the repos
+//	GET  /v1/status     whether an operation is running, and which
+//	POST /v1/install    install {"Packages": [...]}
+//	POST /v1/remove     remove {"Packages": [...], "ForceProtected": false}
+//	POST /v1/update     update all installed packages
+//
+// Operations stream JSON lines of Events while they run, ending with a
+// result event. Only one operation runs at a time, others get 409 Conflict.
+package agent
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/googet/googetclient"
+	"github.com/google/googet/msg"
+	"github.com/google/logger"
+)
+
+// Event is a line streamed by an operation.
+type Event struct {
+	// Type is message, progress or result.
+	Type string
+	// ID, Message and Args are set for messages.
+	ID      msg.ID   `json:",omitempty"`
+	Message string   `json:",omitempty"`
+	Args    []string `json:",omitempty"`
+	// Name, Done and Total are set for download progress.
+	Name        string `json:",omitempty"`
+	Done, Total int64  `json:",omitempty"`
+	// Result and Error are set for the result.
+	Result *googetclient.Result `json:",omitempty"`
+	Error  string               `json:",omitempty"`
+}
+
+// Status describes the operation the agent is running, if any.
+type Status struct {
+	Busy      bool
+	Operation string    `json:",omitempty"`
+	Packages  []string  `json:",omitempty"`
+	Start     time.Time `json:",omitempty"`
+}
+
+// Request is the body of install and remove requests.
+type Request struct {
+	Packages []string
+	// ForceProtected allows a remove request to remove protected packages.
+	ForceProtected bool `json:",omitempty"`
+}
+
+// Server is the agent API handler.
+type Server struct {
+	c     *googetclient.Client
+	token string
+
+	mu     sync.Mutex
+	status Status
+}
+
+// New returns a Server performing operations with c, requests must carry
+// token.
+func New(c *googetclient.Client, token string) *Server {
+	return &Server{c: c, token: token}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if s.token == "" || subtle.ConstantTimeCompare([]byte(auth), []byte(s.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	op := strings.TrimPrefix(r.URL.Path, "/v1/")
+	switch op {
+	case "installed", "available", "status":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.query(w, op)
+	case "install", "remove", "update":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.operation(w, r, op)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) query(w http.ResponseWriter, op string) {
+	var v interface{}
+	var err error
+	switch op {
+	case "installed":
+		v, err = s.c.Installed()
+	case "available":
+		v, err = s.c.Available()
+	case "status":
+		s.mu.Lock()
+		v = s.status
+		s.mu.Unlock()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Errorf("Error writing %s response: %v", op, err)
+	}
+}
+
+func (s *Server) operation(w http.ResponseWriter, r *http.Request, op string) {
+	var req Request
+	if op != "update" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("error decoding request: %v", err), http.StatusBadRequest)
+			return
+		}
+		if len(req.Packages) == 0 {
+			http.Error(w, "no packages given", http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	if s.status.Busy {
+		s.mu.Unlock()
+		http.Error(w, fmt.Sprintf("%s already running", s.status.Operation), http.StatusConflict)
+		return
+	}
+	s.status = Status{Busy: true, Operation: op, Packages: req.Packages, Start: time.Now()}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.status = Status{}
+		s.mu.Unlock()
+	}()
+
+	logger.Infof("Agent running %s %v", op, req.Packages)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	st := &stream{enc: json.NewEncoder(w)}
+	st.flusher, _ = w.(http.Flusher)
+	s.c.Reporter = st
+	defer func() { s.c.Reporter = msg.Discard }()
+
+	var res *googetclient.Result
+	var err error
+	switch op {
+	case "install":
+		res, err = s.c.Install(req.Packages...)
+	case "remove":
+		s.c.ForceProtected = req.ForceProtected
+		res, err = s.c.Remove(req.Packages...)
+		s.c.ForceProtected = false
+	case "update":
+		res, err = s.c.Update()
+	}
+	e := Event{Type: "result", Result: res}
+	if err != nil {
+		logger.Errorf("Agent %s %v failed: %v", op, req.Packages, err)
+		e.Error = err.Error()
+	}
+	st.send(e)
+}
+
+// stream is a Reporter streaming Events to a response.
+type stream struct {
+	enc          *json.Encoder
+	flusher      http.Flusher
+	lastProgress time.Time
+}
+
+func (st *stream) send(e Event) {
+	if err := st.enc.Encode(e); err != nil {
+		logger.Errorf("Error streaming agent event: %v", err)
+		return
+	}
+	if st.flusher != nil {
+		st.flusher.Flush()
+	}
+}
+
+func (st *stream) Info(id msg.ID, a ...interface{}) {
+	e := Event{Type: "message", ID: id, Message: strings.TrimSpace(msg.Sprintf(id, a...))}
+	for _, v := range a {
+		e.Args = append(e.Args, fmt.Sprint(v))
+	}
+	st.send(e)
+}
+
+// Progress sends a progress event at most once a second, and once done
+// reaches total.
+func (st *stream) Progress(name string, done, total int64) {
+	if (total <= 0 || done < total) && time.Since(st.lastProgress) < time.Second {
+		return
+	}
+	st.lastProgress = time.Now()
+	st.send(Event{Type: "progress", Name: name, Done: done, Total: total})
+}
+
+// Confirm answers no, operations are confirmed by being requested.
+func (st *stream) Confirm(msg.ID, ...interface{}) bool {
+	return false
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/googet/googetclient"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+	"github.com/google/googet/remove"
+	"github.com/google/googet/testutil"
+	"github.com/google/logger"
+)
+
+func init() {
+	logger.Init("test", true, false, ioutil.Discard)
+}
+
+func TestServer(t *testing.T) {
+	root, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(root)
+
+	r := testutil.NewRepo(t, "repo")
+	defer r.Close()
+	r.Add(t, &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "1.0.0@1"}, nil)
+
+	c, err := googetclient.New(root)
+	if err != nil {
+		t.Fatalf("googetclient.New: %v", err)
+	}
+	c.Sources = []string{r.URL()}
+	c.CacheLife = 0
+	ts := httptest.NewServer(New(c, "secret"))
+	defer ts.Close()
+
+	do := func(method, path, token, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		return res
+	}
+
+	for _, tok := range []string{"", "wrong"} {
+		res := do("GET", "/v1/installed", tok, "")
+		res.Body.Close()
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("GET /v1/installed with token %q returned %s, want 401", tok, res.Status)
+		}
+	}
+	res := do("GET", "/v1/install", "secret", "")
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /v1/install returned %s, want 405", res.Status)
+	}
+	res = do("POST", "/v1/remove", "secret", `{"Packages": []}`)
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST /v1/remove with no packages returned %s, want 400", res.Status)
+	}
+
+	res = do("POST", "/v1/install", "secret", `{"Packages": ["foo"]}`)
+	var events []Event
+	s := bufio.NewScanner(res.Body)
+	for s.Scan() {
+		var e Event
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			t.Fatalf("error decoding event %q: %v", s.Text(), err)
+		}
+		events = append(events, e)
+	}
+	res.Body.Close()
+	if len(events) < 2 {
+		t.Fatalf("install streamed %d events, want messages and a result: %+v", len(events), events)
+	}
+	if events[0].Type != "message" {
+		t.Errorf("first install event = %+v, want a message", events[0])
+	}
+	foo := googetclient.Package{Name: "foo", Arch: "noarch", Version: "1.0.0@1"}
+	last := events[len(events)-1]
+	if want := (Event{Type: "result", Result: &googetclient.Result{Installed: []googetclient.Package{foo}}}); !reflect.DeepEqual(last, want) {
+		t.Errorf("last install event = %+v, want %+v", last, want)
+	}
+
+	res = do("GET", "/v1/installed", "secret", "")
+	var got []googetclient.Package
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("error decoding installed packages: %v", err)
+	}
+	res.Body.Close()
+	if !reflect.DeepEqual(got, []googetclient.Package{foo}) {
+		t.Errorf("GET /v1/installed = %+v, want %+v", got, []googetclient.Package{foo})
+	}
+
+	// Protected packages are only removed when the request forces it.
+	defer remove.SetProtected(nil)
+	remove.SetProtected([]string{"foo"})
+	for _, tt := range []struct {
+		body string
+		want Event
+	}{
+		{`{"Packages": ["foo"]}`, Event{Type: "result", Result: &googetclient.Result{}, Error: "refusing to remove protected packages [foo.noarch]"}},
+		{`{"Packages": ["foo"], "ForceProtected": true}`, Event{Type: "result", Result: &googetclient.Result{Removed: []googetclient.Package{foo}}}},
+	} {
+		res = do("POST", "/v1/remove", "secret", tt.body)
+		var last Event
+		s := bufio.NewScanner(res.Body)
+		for s.Scan() {
+			last = Event{}
+			if err := json.Unmarshal(s.Bytes(), &last); err != nil {
+				t.Fatalf("error decoding event %q: %v", s.Text(), err)
+			}
+		}
+		res.Body.Close()
+		if !reflect.DeepEqual(last, tt.want) {
+			t.Errorf("last event of remove %s = %+v, want %+v", tt.body, last, tt.want)
+		}
+	}
+
+	res = do("GET", "/v1/status", "secret", "")
+	var st Status
+	if err := json.NewDecoder(res.Body).Decode(&st); err != nil {
+		t.Fatalf("error decoding status: %v", err)
+	}
+	res.Body.Close()
+	if st.Busy {
+		t.Errorf("GET /v1/status = %+v with no operation running", st)
+	}
+}
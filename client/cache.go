@@ -0,0 +1,181 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+	"github.com/google/logger"
+)
+
+// NoCache as a cache life makes AvailableVersions and AvailablePackages
+// download every index again, rather than use or revalidate cached copies.
+// The downloaded indexes are still cached.
+const NoCache time.Duration = -1
+
+// maxSkew is how far the clock of a repo may be from ours before it is
+// logged.
+const maxSkew = 5 * time.Minute
+
+// indexCache is a cached repo index. Its age is taken from Fetched rather
+// than the file mtime, which clock skew, restored VM snapshots and copied
+// caches make meaningless.
+type indexCache struct {
+	// Fetched is the local time the index was fetched or revalidated.
+	Fetched time.Time
+	// Date and LastModified are the headers the repo sent with the index,
+	// LastModified revalidates the cache once it is stale.
+	Date         string `json:",omitempty"`
+	LastModified string `json:",omitempty"`
+	// Chunks are the chunks of a chunked index, whose Packages are cached
+	// in their own files rather than with the index.
+	Chunks   []goolib.IndexChunk `json:",omitempty"`
+	Packages []goolib.RepoSpec
+	// chunkBytes is the size of the cached chunks.
+	chunkBytes int64
+}
+
+// RepoStats describe the last successful fetch of a repo index. They are
+// kept next to the cached index so they can be read without it.
+type RepoStats struct {
+	Packages  int
+	Fetched   time.Time
+	CacheSize int64
+}
+
+func indexCacheFile(repo, cacheDir string) string {
+	return filepath.Join(cacheDir, filepath.Base(repo)+".rs")
+}
+
+func statsFile(cf string) string {
+	return strings.TrimSuffix(cf, ".rs") + ".meta"
+}
+
+// ReadRepoStats returns the stats of repo cached in cacheDir, or nil if its
+// index has not been fetched.
+func ReadRepoStats(repo, cacheDir string) (*RepoStats, error) {
+	b, err := ioutil.ReadFile(statsFile(indexCacheFile(repo, cacheDir)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var st RepoStats
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+var (
+	fetchedMu sync.Mutex
+	// fetched holds when this process fetched each repo index. Unlike
+	// Fetched it has a monotonic clock reading, so long running processes
+	// are not fooled by the wall clock being changed.
+	fetched = make(map[string]time.Time)
+)
+
+// fresh reports whether c, the cached index of repo, is younger than
+// cacheLife. A cache from the future was written by a clock that was ahead
+// of ours, so its age is unknown and it is never fresh.
+func (c *indexCache) fresh(repo string, cacheLife time.Duration) bool {
+	fetchedMu.Lock()
+	t, ok := fetched[repo]
+	fetchedMu.Unlock()
+	if !ok || !t.Equal(c.Fetched) {
+		t = c.Fetched
+	}
+	age := now().Sub(t)
+	return age >= 0 && age < cacheLife
+}
+
+// readIndexCache reads the cached index in cf. Caches written before
+// fetch times were recorded are plain lists of specs, their mtime is used.
+func readIndexCache(cf string) (*indexCache, error) {
+	b, err := ioutil.ReadFile(cf)
+	if err != nil {
+		return nil, err
+	}
+	var c indexCache
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '[' {
+		fi, err := oswrap.Stat(cf)
+		if err != nil {
+			return nil, err
+		}
+		c.Fetched = fi.ModTime()
+		return &c, json.Unmarshal(b, &c.Packages)
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// writeIndexCache records c as fetched now for repo and writes it, and its
+// stats, to cf. The packages of a chunked index are left out, they are
+// cached with its chunks.
+func writeIndexCache(repo, cf string, c *indexCache, res *http.Response) error {
+	t := now()
+	c.Fetched = t
+	c.Date = res.Header.Get("Date")
+	if lm := res.Header.Get("Last-Modified"); lm != "" {
+		c.LastModified = lm
+	}
+	if d, err := http.ParseTime(c.Date); err == nil {
+		if skew := d.Sub(t); skew > maxSkew || skew < -maxSkew {
+			logger.Warningf("The clock of %s is %v off the local clock.", repo, skew.Round(time.Second))
+		}
+	}
+	fetchedMu.Lock()
+	fetched[repo] = t
+	fetchedMu.Unlock()
+
+	wc := *c
+	if c.Chunks != nil {
+		wc.Packages = nil
+	} else if err := oswrap.RemoveAll(chunkCacheDir(cf)); err != nil {
+		logger.Error(err)
+	}
+	b, err := json.Marshal(wc)
+	if err != nil {
+		return err
+	}
+	f, err := oswrap.Create(cf)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	sb, err := json.Marshal(RepoStats{Packages: len(c.Packages), Fetched: t, CacheSize: int64(len(b)) + c.chunkBytes})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(statsFile(cf), sb, 0664)
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+)
+
+func TestIndexCacheFresh(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer func() { now = time.Now }()
+	now = func() time.Time { return t0 }
+
+	for _, tc := range []struct {
+		desc    string
+		fetched time.Time
+		want    bool
+	}{
+		{"recent", t0.Add(-time.Minute), true},
+		{"old", t0.Add(-time.Hour), false},
+		{"future", t0.Add(time.Hour), false},
+	} {
+		c := &indexCache{Fetched: tc.fetched}
+		if got := c.fresh("repo", 3*time.Minute); got != tc.want {
+			t.Errorf("%s: fresh() = %v, want %v", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestReadIndexCache(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+
+	want := []goolib.RepoSpec{{Source: "foo"}}
+	legacy := filepath.Join(tempDir, "legacy.rs")
+	b, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(legacy, b, 0664); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(legacy, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	c, err := readIndexCache(legacy)
+	if err != nil {
+		t.Fatalf("readIndexCache: %v", err)
+	}
+	if !c.Fetched.Equal(mtime) || !reflect.DeepEqual(c.Packages, want) {
+		t.Errorf("readIndexCache() of a legacy cache = %+v, want the specs fetched at %v", c, mtime)
+	}
+
+	cf := filepath.Join(tempDir, "repo.rs")
+	res := &http.Response{Header: http.Header{"Last-Modified": {"Wed, 01 Jan 2020 00:00:00 GMT"}}}
+	if err := writeIndexCache("repo", cf, &indexCache{Packages: want}, res); err != nil {
+		t.Fatalf("writeIndexCache: %v", err)
+	}
+	defer delete(fetched, "repo")
+	c, err = readIndexCache(cf)
+	if err != nil {
+		t.Fatalf("readIndexCache: %v", err)
+	}
+	if c.LastModified != "Wed, 01 Jan 2020 00:00:00 GMT" || !reflect.DeepEqual(c.Packages, want) {
+		t.Errorf("readIndexCache() = %+v, want the written cache", c)
+	}
+	if !c.fresh("repo", time.Minute) {
+		t.Error("just written cache is not fresh")
+	}
+	st, err := ReadRepoStats("https://example.com/repo", tempDir)
+	if err != nil {
+		t.Fatalf("ReadRepoStats: %v", err)
+	}
+	if st == nil || st.Packages != 1 || !st.Fetched.Equal(c.Fetched) || st.CacheSize == 0 {
+		t.Errorf("ReadRepoStats() = %+v, want 1 package fetched at %v", st, c.Fetched)
+	}
+	if st, err := ReadRepoStats("https://example.com/other", tempDir); err != nil || st != nil {
+		t.Errorf("ReadRepoStats() of a repo never fetched = %+v, %v, want nil, nil", st, err)
+	}
+}
+
+func TestUnmarshalRepoPackagesNotModified(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+
+	const lastModified = "Wed, 01 Jan 2020 00:00:00 GMT"
+	want := []goolib.RepoSpec{{Source: "foo"}}
+	var served int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repo/index.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		served++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Last-Modified", lastModified)
+		json.NewEncoder(w).Encode(want)
+	}))
+	defer ts.Close()
+	repo := ts.URL + "/repo"
+	defer delete(fetched, repo)
+
+	for i := 0; i < 2; i++ {
+		got, err := unmarshalRepoPackages(repo, tempDir, 0, "")
+		if err != nil {
+			t.Fatalf("unmarshalRepoPackages: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("unmarshalRepoPackages() = %+v, want %+v", got, want)
+		}
+	}
+	if served != 1 {
+		t.Errorf("repo served the index %d times, want 1", served)
+	}
+	if _, err := unmarshalRepoPackages(repo, tempDir, NoCache, ""); err != nil {
+		t.Fatalf("unmarshalRepoPackages: %v", err)
+	}
+	if served != 2 {
+		t.Errorf("repo served the index %d times with NoCache, want 2", served)
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+// Large repos split their index into chunks listed in index.manifest, see
+// goolib.IndexManifest. Each chunk is cached in its own file named after its
+// checksum, so an index update only downloads the chunks that changed.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+	"github.com/google/logger"
+)
+
+// chunkFetchers is how many chunks of an index are downloaded at once.
+const chunkFetchers = 4
+
+// errNoManifest is returned by fetchChunked for repos without a valid
+// index.manifest, whose index is fetched whole.
+var errNoManifest = errors.New("repo has no index manifest")
+
+// chunkCacheDir returns the directory the chunks of the index cached in cf
+// are kept in.
+func chunkCacheDir(cf string) string {
+	return strings.TrimSuffix(cf, ".rs") + ".chunks"
+}
+
+// fetchChunked gets the manifest of the repo at base p and the chunks it
+// lists that are not cached in dir yet, and returns the index they make up.
+// If c, the cached index, is chunked and the repo reports the manifest has
+// not changed since, c is returned.
+func fetchChunked(p, dir string, c *indexCache, httpClient *http.Client) (*indexCache, *http.Response, error) {
+	url := p + "/index.manifest"
+	logger.Infof("Fetching %q", url)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c != nil && c.Chunks != nil && c.LastModified != "" {
+		req.Header.Set("If-Modified-Since", c.LastModified)
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		if c != nil && c.Chunks != nil {
+			logger.Infof("Repo content for %s has not changed.", p)
+			return c, res, nil
+		}
+		return nil, nil, errNoManifest
+	default:
+		return nil, nil, errNoManifest
+	}
+	var m goolib.IndexManifest
+	if err := json.NewDecoder(res.Body).Decode(&m); err != nil || m.Chunks == nil {
+		logger.Infof("Ignoring invalid index manifest of %s: %v", p, err)
+		return nil, nil, errNoManifest
+	}
+
+	nc := &indexCache{Chunks: m.Chunks}
+	if nc.Packages, nc.chunkBytes, err = loadChunks(p, dir, m.Chunks, httpClient); err != nil {
+		return nil, nil, err
+	}
+	pruneChunks(dir, m.Chunks)
+	return nc, res, nil
+}
+
+// loadChunks returns the specs in chunks, in order, and the size of their
+// cached copies in dir. Chunks that are not cached are downloaded from the
+// repo at base p, unless httpClient is nil.
+func loadChunks(p, dir string, chunks []goolib.IndexChunk, httpClient *http.Client) ([]goolib.RepoSpec, int64, error) {
+	specs := make([][]goolib.RepoSpec, len(chunks))
+	sizes := make([]int64, len(chunks))
+	errs := make([]error, len(chunks))
+	sem := make(chan struct{}, chunkFetchers)
+	var wg sync.WaitGroup
+	for i, ch := range chunks {
+		wg.Add(1)
+		go func(i int, ch goolib.IndexChunk) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			b, err := readChunk(p, dir, ch, httpClient)
+			if err != nil {
+				errs[i] = fmt.Errorf("chunk %s: %v", ch.Path, err)
+				return
+			}
+			sizes[i] = int64(len(b))
+			errs[i] = json.Unmarshal(b, &specs[i])
+		}(i, ch)
+	}
+	wg.Wait()
+
+	var rs []goolib.RepoSpec
+	var size int64
+	for i := range chunks {
+		if errs[i] != nil {
+			return nil, 0, errs[i]
+		}
+		rs = append(rs, specs[i]...)
+		size += sizes[i]
+	}
+	return rs, size, nil
+}
+
+// readChunk returns the contents of the chunk ch, from its cached copy in
+// dir or, if there is none and httpClient is set, downloaded from the repo
+// at base p and then cached.
+func readChunk(p, dir string, ch goolib.IndexChunk, httpClient *http.Client) ([]byte, error) {
+	if filepath.Base(ch.Checksum) != ch.Checksum || ch.Checksum == "" {
+		return nil, fmt.Errorf("invalid checksum %q", ch.Checksum)
+	}
+	cf := filepath.Join(dir, ch.Checksum+".json")
+	b, err := ioutil.ReadFile(cf)
+	if err == nil || !os.IsNotExist(err) || httpClient == nil {
+		return b, err
+	}
+
+	url := p + "/" + ch.Path
+	logger.Infof("Fetching %q", url)
+	res, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET request returned status: %q", res.Status)
+	}
+	if b, err = ioutil.ReadAll(res.Body); err != nil {
+		return nil, err
+	}
+	// Static hosts may serve the gzipped chunk as is or decompress it.
+	if bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+		gr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		if b, err = ioutil.ReadAll(gr); err != nil {
+			return nil, err
+		}
+	}
+	if sum := goolib.Checksum(bytes.NewReader(b)); sum != ch.Checksum {
+		return nil, fmt.Errorf("checksum %s does not match the manifest", sum)
+	}
+	if err := oswrap.MkdirAll(dir, 0774); err != nil {
+		return nil, err
+	}
+	return b, ioutil.WriteFile(cf, b, 0664)
+}
+
+// pruneChunks removes the cached chunks in dir that chunks does not list.
+func pruneChunks(dir string, chunks []goolib.IndexChunk) {
+	keep := make(map[string]bool)
+	for _, ch := range chunks {
+		keep[ch.Checksum+".json"] = true
+	}
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, fi := range fis {
+		if keep[fi.Name()] {
+			continue
+		}
+		if err := oswrap.Remove(filepath.Join(dir, fi.Name())); err != nil {
+			logger.Error(err)
+		}
+	}
+}
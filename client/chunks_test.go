@@ -0,0 +1,119 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/index"
+	"github.com/google/googet/oswrap"
+)
+
+func TestUnmarshalRepoPackagesChunked(t *testing.T) {
+	site, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(site)
+	cacheDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(cacheDir)
+
+	var rs []goolib.RepoSpec
+	for i := 0; i < 40; i++ {
+		n := fmt.Sprintf("pkg%02d", i)
+		rs = append(rs, goolib.RepoSpec{Source: n, Checksum: "v1", PackageSpec: &goolib.PkgSpec{Name: n, Arch: "noarch", Version: "1.0.0@1"}})
+	}
+	dir := filepath.Join(site, "repo")
+	publish := func(mtime time.Time) {
+		if err := index.WriteChunked(dir, rs, 4); err != nil {
+			t.Fatalf("error writing index: %v", err)
+		}
+		if err := os.Chtimes(filepath.Join(dir, "index.manifest"), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	publish(time.Now().Add(-time.Hour))
+
+	var mu sync.Mutex
+	var chunks, indexes int
+	fs := http.FileServer(http.Dir(site))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if strings.Contains(r.URL.Path, "/chunks/") {
+			chunks++
+		}
+		if strings.HasSuffix(r.URL.Path, "/index.gz") {
+			indexes++
+		}
+		mu.Unlock()
+		fs.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	repo := ts.URL + "/repo"
+	defer delete(fetched, repo)
+
+	got, err := unmarshalRepoPackages(repo, cacheDir, 0, "")
+	if err != nil {
+		t.Fatalf("unmarshalRepoPackages: %v", err)
+	}
+	if !reflect.DeepEqual(got, rs) {
+		t.Errorf("unmarshalRepoPackages() = %+v, want %+v", got, rs)
+	}
+	first := chunks
+	if first < 2 || indexes != 0 {
+		t.Errorf("first fetch got %d chunks and %d whole indexes, want several chunks and no index", first, indexes)
+	}
+
+	got, err = unmarshalRepoPackages(repo, cacheDir, time.Hour, "")
+	if err != nil {
+		t.Fatalf("unmarshalRepoPackages: %v", err)
+	}
+	if !reflect.DeepEqual(got, rs) || chunks != first {
+		t.Errorf("cached fetch returned %d packages and got %d more chunks, want %d and none", len(got), chunks-first, len(rs))
+	}
+
+	rs[17].Checksum = "v2"
+	publish(time.Now())
+	got, err = unmarshalRepoPackages(repo, cacheDir, 0, "")
+	if err != nil {
+		t.Fatalf("unmarshalRepoPackages: %v", err)
+	}
+	if !reflect.DeepEqual(got, rs) {
+		t.Errorf("unmarshalRepoPackages() after an update = %+v, want %+v", got, rs)
+	}
+	if chunks != first+1 {
+		t.Errorf("update of one package got %d chunks, want 1", chunks-first)
+	}
+	fis, err := ioutil.ReadDir(chunkCacheDir(indexCacheFile(repo, cacheDir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != first {
+		t.Errorf("chunk cache holds %d chunks, want %d", len(fis), first)
+	}
+}
@@ -17,12 +17,14 @@ package client
 import (
 	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/googet/goolib"
@@ -35,6 +37,96 @@ type PackageState struct {
 	SourceRepo, DownloadURL, Checksum, UnpackDir string
 	PackageSpec                                  *goolib.PkgSpec
 	InstalledFiles                               map[string]string
+	// ConfigFiles are the installed configuration files, they are kept when
+	// the package is removed unless it is purged.
+	ConfigFiles map[string]string `json:",omitempty"`
+	// KB is the knowledge base article installed by a Windows update package,
+	// empty if the update does not apply to the system.
+	KB string `json:",omitempty"`
+	// InstallRoot is the directory relative file destinations were installed
+	// under, empty for the root of the filesystem.
+	InstallRoot string `json:",omitempty"`
+	// Dirs are the directories the package installed files into, true for
+	// those the install created. Only created directories are removed with
+	// the package, and only once they are empty. Packages installed before
+	// Dirs was recorded list their directories in InstalledFiles with an
+	// empty checksum.
+	Dirs map[string]bool `json:",omitempty"`
+	// ScriptContext is the context the scripts of the package ran in when
+	// it was installed, see system.SetScriptContext. Empty means GooGet's
+	// own.
+	ScriptContext string `json:",omitempty"`
+	// Signature is the result of checking the signature of the installer
+	// of the package, if signatures were checked.
+	Signature *Signature `json:",omitempty"`
+	// Decision is the update decision the package was installed by, see
+	// ShouldUpdate. Packages not installed by an update have none.
+	Decision *Decision `json:",omitempty"`
+	// Script is what the install script of the package reported when it
+	// was installed, see system.Install.
+	Script *ScriptResult `json:",omitempty"`
+	// Enabled are the Windows features and capabilities the package
+	// enabled, they are disabled again when it is removed.
+	Enabled *goolib.WindowsFeatures `json:",omitempty"`
+	// Certificates are the certificates the package added to certificate
+	// stores.
+	Certificates []Certificate `json:",omitempty"`
+	// Exclusions are the Windows Defender exclusions applied for the
+	// package, they are removed again when it is removed.
+	Exclusions *goolib.Exclusions `json:",omitempty"`
+	// PostReboot tracks the post-reboot action of the package until it
+	// succeeds.
+	PostReboot *Deferred `json:",omitempty"`
+}
+
+// Deferred is an action of a package that runs after the next reboot.
+type Deferred struct {
+	// Since is when the package was installed, the action runs after the
+	// first reboot after it.
+	Since time.Time
+	// Attempts counts the runs of the action that failed, Error is why the
+	// last one did.
+	Attempts int    `json:",omitempty"`
+	Error    string `json:",omitempty"`
+}
+
+// Certificate is a certificate a package added to a certificate store.
+type Certificate struct {
+	Store string
+	// Thumbprint is the hex SHA-1 hash of the certificate.
+	Thumbprint string
+	// Kept is set for certificates that were in the store before the
+	// package added them, they are left there when it is removed.
+	Kept bool `json:",omitempty"`
+}
+
+// Signature is the result of checking the Authenticode signature of the
+// installer of a package.
+type Signature struct {
+	// Path is the installer, relative to the package.
+	Path      string
+	Valid     bool
+	Publisher string `json:",omitempty"`
+	// Error is why the check failed.
+	Error string `json:",omitempty"`
+}
+
+// ScriptResult is the outcome of running the install script of a package.
+type ScriptResult struct {
+	// Log is the file the output of the script was written to.
+	Log string `json:",omitempty"`
+	// RebootRequired is set if the install is only finished by a reboot.
+	RebootRequired bool `json:",omitempty"`
+	// Services are the services the script restarted.
+	Services []string `json:",omitempty"`
+	// Warnings are what the script asked the user to look at.
+	Warnings []string `json:",omitempty"`
+	// Driver is the published name, like oem12.inf, of the driver an .inf
+	// installer added to the driver store.
+	Driver string `json:",omitempty"`
+	// KB is the Windows update a .msu installer installed, or found already
+	// installed. Updates that do not apply to the system leave it empty.
+	KB string `json:",omitempty"`
 }
 
 // GooGetState describes the overall package state on a client.
@@ -84,6 +176,75 @@ func (ps *PackageState) Match(pi goolib.PackageInfo) bool {
 	return ps.PackageSpec.Name == pi.Name && (ps.PackageSpec.Arch == pi.Arch || pi.Arch == "") && (ps.PackageSpec.Version == pi.Ver || pi.Ver == "")
 }
 
+// CreatedDirs returns the directories the package is responsible for
+// removing: those it created and those recorded in InstalledFiles or
+// ConfigFiles by older versions of GooGet.
+func (ps *PackageState) CreatedDirs() []string {
+	var dirs []string
+	for d, created := range ps.Dirs {
+		if created {
+			dirs = append(dirs, d)
+		}
+	}
+	for _, fm := range []map[string]string{ps.InstalledFiles, ps.ConfigFiles} {
+		for f, chksum := range fm {
+			if chksum == "" {
+				dirs = append(dirs, f)
+			}
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// RemoveDirs removes dirs, deepest first, if they are empty. A directory
+// that is not empty and is used by another package in s than owner is handed
+// over to that package, so it is removed along with it.
+func (s GooGetState) RemoveDirs(dirs []string, owner goolib.PackageInfo) {
+	dirs = append([]string(nil), dirs...)
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, d := range dirs {
+		err := oswrap.Remove(d)
+		if err == nil {
+			logger.Infof("Removed directory %q", d)
+			continue
+		}
+		if os.IsNotExist(err) {
+			continue
+		}
+		if p := s.dirUser(d, owner); p != nil {
+			logger.Infof("Directory %q is still used by %s.%s, it will be removed with it", d, p.PackageSpec.Name, p.PackageSpec.Arch)
+			p.Dirs[d] = true
+			continue
+		}
+		logger.Infof("Keeping directory %q: %v", d, err)
+	}
+}
+
+// HandOverDirs hands each of dirs used by another package in s than owner
+// over to that package without touching the filesystem, for packages that
+// are removed from the state only.
+func (s GooGetState) HandOverDirs(dirs []string, owner goolib.PackageInfo) {
+	for _, d := range dirs {
+		if p := s.dirUser(d, owner); p != nil {
+			p.Dirs[d] = true
+		}
+	}
+}
+
+// dirUser returns a package other than owner that installed files into dir.
+func (s GooGetState) dirUser(dir string, owner goolib.PackageInfo) *PackageState {
+	for i, ps := range s {
+		if ps.PackageSpec.Name == owner.Name && ps.PackageSpec.Arch == owner.Arch {
+			continue
+		}
+		if _, ok := ps.Dirs[dir]; ok {
+			return &s[i]
+		}
+	}
+	return nil
+}
+
 // RepoMap describes each repo's packages as seen from a client.
 type RepoMap map[string][]goolib.RepoSpec
 
@@ -101,7 +262,156 @@ func AvailableVersions(srcs []string, cacheDir string, cacheLife time.Duration,
 	return rm
 }
 
-func decode(res *http.Response, cf string) ([]goolib.RepoSpec, error) {
+// errNoQuery is returned by queryRepoPackages when a repo has no query
+// endpoint.
+var errNoQuery = errors.New("repo does not support package queries")
+
+// AvailablePackages builds a RepoMap from a list of sources that only holds
+// the packages in names and their dependency closure, so constrained clients
+// don't have to fetch and store whole indexes. Sources are asked for just
+// those packages through their query endpoint, sources without one fall back
+// to their full index.
+func AvailablePackages(srcs, names []string, cacheDir string, cacheLife time.Duration, proxyServer string) RepoMap {
+	rm := make(RepoMap)
+	full := make(map[string]bool)
+	seen := make(map[string]bool)
+	// Queries don't fetch deprecation notices, use those cached with the
+	// last full index.
+	for _, r := range srcs {
+		loadDeprecation(r, cacheDir)
+	}
+	for len(names) > 0 {
+		var want []string
+		for _, n := range names {
+			if !seen[n] {
+				seen[n] = true
+				want = append(want, n)
+			}
+		}
+		names = nil
+		if len(want) == 0 {
+			break
+		}
+		sort.Strings(want)
+		for _, r := range srcs {
+			if full[r] {
+				continue
+			}
+			rf, err := queryRepoPackages(r, want, proxyServer)
+			if err == errNoQuery {
+				logger.Infof("%s does not support package queries, using its full index", r)
+				full[r] = true
+				rf, err = unmarshalRepoPackages(r, cacheDir, cacheLife, proxyServer)
+			}
+			if err != nil {
+				logger.Errorf("error reading repo %q: %v", r, err)
+				continue
+			}
+			rm[r] = append(rm[r], rf...)
+			for _, p := range rf {
+				for d := range p.PackageSpec.PkgDependencies {
+					names = append(names, goolib.PkgNameSplit(d).Name)
+				}
+			}
+		}
+	}
+	return rm
+}
+
+// queryRepoPackages asks the repo at p, or failing that its mirrors, for
+// every version of the packages in names.
+func queryRepoPackages(p string, names []string, proxyServer string) ([]goolib.RepoSpec, error) {
+	var err error
+	for _, u := range Candidates(p) {
+		var m []goolib.RepoSpec
+		m, err = queryRepo(u, names, proxyServer)
+		if err == errNoQuery {
+			Report(u, nil)
+			return nil, err
+		}
+		Report(u, err)
+		if err == nil {
+			return m, nil
+		}
+		logger.Infof("Error querying %s: %v", u, err)
+	}
+	return nil, err
+}
+
+// queryRepo asks the repo at base p for every version of the packages in
+// names.
+func queryRepo(p string, names []string, proxyServer string) ([]goolib.RepoSpec, error) {
+	v := url.Values{"name": names}
+	u := p + "/query?" + v.Encode()
+	logger.Infof("Fetching %q", u)
+	res, err := newHTTPClient(proxyServer).Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, errNoQuery
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("query GET request returned status: %q", res.Status)
+	}
+	var m []goolib.RepoSpec
+	if err := json.NewDecoder(res.Body).Decode(&m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Headers identifying the client that SetRequestHeaders may set.
+const (
+	HeaderHostname  = "X-GooGet-Hostname"
+	HeaderMachineID = "X-GooGet-Machine-ID"
+	HeaderVersion   = "X-GooGet-Version"
+	// HeaderCohorts is a comma separated list of cohort labels.
+	HeaderCohorts = "X-GooGet-Cohorts"
+)
+
+// requestHeaders are added to index and query requests to repos.
+var requestHeaders http.Header
+
+// SetRequestHeaders sets headers to add to index and query requests to
+// repos, so servers can attribute traffic or serve different indexes to
+// different clients.
+func SetRequestHeaders(h http.Header) {
+	requestHeaders = h
+}
+
+// headerTransport adds requestHeaders to requests and signs those to repos
+// that require registration.
+type headerTransport struct {
+	base http.RoundTripper
+}
+
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range requestHeaders {
+		req.Header[k] = v
+	}
+	if err := SignRequest(req); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+func newHTTPClient(proxyServer string) *http.Client {
+	var tr http.RoundTripper = http.DefaultTransport
+	if proxyServer != "" {
+		proxyURL, err := url.Parse(proxyServer)
+		if err != nil {
+			logger.Fatalf("%q", err)
+		}
+		tr = &http.Transport{Proxy: http.ProxyURL(proxyURL)}
+	}
+	tr = headerTransport{base: tr}
+	return &http.Client{Transport: tr}
+}
+
+func decode(res *http.Response) ([]goolib.RepoSpec, error) {
 	ct := res.Header.Get("content-type")
 	var dec *json.Decoder
 	switch ct {
@@ -122,81 +432,112 @@ func decode(res *http.Response, cf string) ([]goolib.RepoSpec, error) {
 			return nil, err
 		}
 	}
-
-	f, err := oswrap.Create(cf)
-	if err != nil {
-		return nil, err
-	}
-	j, err := json.Marshal(m)
-	if err != nil {
-		return nil, err
-	}
-	if _, err := f.Write(j); err != nil {
-		return nil, err
-	}
-
-	return m, f.Close()
+	return m, nil
 }
 
 // unmarshalRepoPackages gets and unmarshals a repository URL or uses the cached contents
-// if mtime is less than cacheLife.
+// if they were fetched less than cacheLife ago.
 // Sucessfully unmarshalled contents will be written to a cache.
+// Repos that list chunks of their index in index.manifest are fetched chunk
+// by chunk, see fetchChunked.
 func unmarshalRepoPackages(p, cacheDir string, cacheLife time.Duration, proxyServer string) ([]goolib.RepoSpec, error) {
-	cf := filepath.Join(cacheDir, filepath.Base(p)+".rs")
-	httpClient := &http.Client{}
-	if proxyServer != "" {
-		proxyURL, err := url.Parse(proxyServer)
-		if err != nil {
-			logger.Fatalf("%q", err)
+	cf := indexCacheFile(p, cacheDir)
+	httpClient := newHTTPClient(proxyServer)
+
+	c, err := readIndexCache(cf)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Errorf("Error reading cached repo content for %s: %v", p, err)
+	}
+	if err == nil && c.Chunks != nil {
+		if c.Packages, c.chunkBytes, err = loadChunks(p, chunkCacheDir(cf), c.Chunks, nil); err != nil {
+			logger.Errorf("Error reading cached index chunks for %s: %v", p, err)
 		}
-		httpClient.Transport = &http.Transport{Proxy: http.ProxyURL(proxyURL)}
 	}
-
-	fi, err := oswrap.Stat(cf)
-	if err == nil && time.Since(fi.ModTime()) < cacheLife {
+	if err == nil && c.fresh(p, cacheLife) {
 		logger.Infof("Using cached repo content for %s.", p)
-		f, err := oswrap.Open(cf)
+		loadDeprecation(p, cacheDir)
+		return c.Packages, nil
+	}
+	if err != nil || cacheLife == NoCache {
+		c = nil
+	}
+	logger.Infof("Fetching repo content for %s, cache either doesn't exist or is older than %v", p, cacheLife)
+
+	for _, u := range Candidates(p) {
+		var nc *indexCache
+		var res *http.Response
+		nc, res, err = fetchChunked(u, chunkCacheDir(cf), c, httpClient)
 		if err != nil {
-			return nil, err
+			if err != errNoManifest {
+				logger.Infof("Error fetching index chunks of %s, fetching the whole index: %v", u, err)
+			}
+			ic := c
+			if c != nil && c.Chunks != nil {
+				ic = nil
+			}
+			nc, res, err = fetchIndex(u, ic, httpClient)
 		}
-		var m []goolib.RepoSpec
-		dec := json.NewDecoder(f)
-		for dec.More() {
-			if err := dec.Decode(&m); err != nil {
+		Report(u, err)
+		if err == nil {
+			if err := writeIndexCache(p, cf, nc, res); err != nil {
 				return nil, err
 			}
+			if err := fetchDeprecation(p, u, cacheDir, httpClient); err != nil {
+				logger.Errorf("Error fetching deprecation notice of %s: %v", p, err)
+			}
+			return nc.Packages, nil
 		}
-		return m, nil
-	}
-	if err != nil && !os.IsNotExist(err) {
-		return nil, err
+		logger.Infof("Error fetching index of %s: %v", u, err)
 	}
-	logger.Infof("Fetching repo content for %s, cache either doesn't exist or is older than %v", p, cacheLife)
+	return nil, err
+}
 
-	url := p + "/index.gz"
-	logger.Infof("Fetching %q", url)
-	res, err := httpClient.Get(url)
+// fetchIndex gets and unmarshals the index of the repo at base p. If c, the
+// cached index, is given and the repo reports the index has not changed
+// since, c is returned.
+func fetchIndex(p string, c *indexCache, httpClient *http.Client) (*indexCache, *http.Response, error) {
+	get := func(url string) (*http.Response, error) {
+		logger.Infof("Fetching %q", url)
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if c != nil && c.LastModified != "" {
+			req.Header.Set("If-Modified-Since", c.LastModified)
+		}
+		return httpClient.Do(req)
+	}
+	res, err := get(p + "/index.gz")
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	defer res.Body.Close()
 
-	if res.StatusCode == 200 {
-		return decode(res, cf)
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotModified {
+		logger.Infof("Gzipped index returned status: %q, trying plain JSON.", res.Status)
+		res, err = get(p + "/index")
+		if err != nil {
+			return nil, nil, err
+		}
+		defer res.Body.Close()
 	}
 
-	logger.Infof("Gzipped index returned status: %q, trying plain JSON.", res.Status)
-	url = p + "/index"
-	logger.Infof("Fetching %q", url)
-	res, err = httpClient.Get(url)
-	if err != nil {
-		return nil, err
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		if c != nil {
+			logger.Infof("Repo content for %s has not changed.", p)
+			return c, res, nil
+		}
+		fallthrough
+	default:
+		return nil, nil, fmt.Errorf("index GET request returned status: %q", res.Status)
 	}
-
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("index GET request returned status: %q", res.Status)
+	m, err := decode(res)
+	if err != nil {
+		return nil, nil, err
 	}
-
-	return decode(res, cf)
+	return &indexCache{Packages: m}, res, nil
 }
 
 // FindRepoSpec returns the element of pl whose PackageSpec matches pi.
@@ -210,6 +551,17 @@ func FindRepoSpec(pi goolib.PackageInfo, pl []goolib.RepoSpec) (goolib.RepoSpec,
 	return goolib.RepoSpec{}, fmt.Errorf("no match found for package %s.%s.%s in repo", pi.Name, pi.Arch, pi.Ver)
 }
 
+// StageRank returns the StageRank of the spec of pi in rm, that of a package
+// without a stage if it is not found.
+func StageRank(pi goolib.PackageInfo, rm RepoMap) int {
+	for _, pl := range rm {
+		if rs, err := FindRepoSpec(pi, pl); err == nil {
+			return rs.PackageSpec.StageRank()
+		}
+	}
+	return 0
+}
+
 func latest(psm map[string][]*goolib.PkgSpec) (ver, repo string) {
 	for r, pl := range psm {
 		for _, p := range pl {
@@ -232,12 +584,46 @@ func latest(psm map[string][]*goolib.PkgSpec) (ver, repo string) {
 }
 
 // FindRepoLatest returns the latest version of a package along with its repo and arch.
+// Yanked versions are skipped.
 func FindRepoLatest(pi goolib.PackageInfo, rm RepoMap, archs []string) (ver, repo, arch string, err error) {
+	return findRepoLatest(pi, rm, archs, nil)
+}
+
+// FindRepoMatch returns the latest version of a package that meets the
+// constraints cs along with its repo and arch. Yanked versions are skipped.
+// If no version matches the error lists the versions that are available.
+func FindRepoMatch(pi goolib.PackageInfo, cs goolib.Constraints, rm RepoMap, archs []string) (ver, repo, arch string, err error) {
+	ver, repo, arch, err = findRepoLatest(pi, rm, archs, cs.Match)
+	if err == nil || len(cs) == 0 {
+		return ver, repo, arch, err
+	}
+	var vers []string
+	for _, pl := range rm {
+		for _, p := range pl {
+			ps := p.PackageSpec
+			if ps.Name == pi.Name && (pi.Arch == "" || ps.Arch == pi.Arch) && !p.Yanked && !goolib.ContainsString(ps.Version, vers) {
+				vers = append(vers, ps.Version)
+			}
+		}
+	}
+	if len(vers) == 0 {
+		return "", "", "", err
+	}
+	return "", "", "", fmt.Errorf("no version of package %s matches %s, available versions: %s", pi.Name, cs, strings.Join(goolib.SortVersions(vers), ", "))
+}
+
+// findRepoLatest returns the latest version of a package that match, if it
+// is not nil, accepts.
+func findRepoLatest(pi goolib.PackageInfo, rm RepoMap, archs []string, match func(string) bool) (ver, repo, arch string, err error) {
+	ok := func(p goolib.RepoSpec, arch string) bool {
+		ps := p.PackageSpec
+		return ps.Name == pi.Name && ps.Arch == arch && !p.Yanked && (match == nil || match(ps.Version))
+	}
 	psm := make(map[string][]*goolib.PkgSpec)
 	if pi.Arch != "" {
 		for r, pl := range rm {
 			for _, p := range pl {
-				if p.PackageSpec.Name == pi.Name && p.PackageSpec.Arch == pi.Arch {
+				if ok(p, pi.Arch) {
 					psm[r] = append(psm[r], p.PackageSpec)
 				}
 			}
@@ -252,7 +638,7 @@ func FindRepoLatest(pi goolib.PackageInfo, rm RepoMap, archs []string) (ver, rep
 	for _, a := range archs {
 		for r, pl := range rm {
 			for _, p := range pl {
-				if p.PackageSpec.Name == pi.Name && p.PackageSpec.Arch == a {
+				if ok(p, a) {
 					psm[r] = append(psm[r], p.PackageSpec)
 				}
 			}
@@ -265,6 +651,78 @@ func FindRepoLatest(pi goolib.PackageInfo, rm RepoMap, archs []string) (ver, rep
 	return "", "", "", fmt.Errorf("no versions of package %s found in any repo", pi.Name)
 }
 
+// FindObsoleting returns the name of a package in rm that obsoletes the
+// package name, or "" if there is none. If several packages obsolete name the
+// first in sort order is returned.
+func FindObsoleting(name string, rm RepoMap) string {
+	var obs []string
+	for _, pl := range rm {
+		for _, p := range pl {
+			if goolib.ContainsString(name, p.PackageSpec.Obsoletes) {
+				obs = append(obs, p.PackageSpec.Name)
+			}
+		}
+	}
+	if len(obs) == 0 {
+		return ""
+	}
+	sort.Strings(obs)
+	return obs[0]
+}
+
+// Index holds the latest version of every package in a RepoMap keyed by
+// name.arch, so repeated lookups, such as during dependency resolution, don't
+// have to scan every repo.
+type Index map[string]IndexEntry
+
+// IndexEntry is the latest version of a package and the repo it is in.
+type IndexEntry struct {
+	Repo string
+	Spec goolib.RepoSpec
+}
+
+// NewIndex builds an Index of rm, leaving out yanked versions.
+func NewIndex(rm RepoMap) Index {
+	idx := make(Index)
+	for r, pl := range rm {
+		for _, p := range pl {
+			if p.Yanked {
+				continue
+			}
+			k := p.PackageSpec.Name + "." + p.PackageSpec.Arch
+			e, ok := idx[k]
+			if ok {
+				c, err := goolib.Compare(p.PackageSpec.Version, e.Spec.PackageSpec.Version)
+				if err != nil {
+					logger.Errorf("compare of %s to %s failed with error: %v", p.PackageSpec.Version, e.Spec.PackageSpec.Version, err)
+				}
+				if c != 1 {
+					continue
+				}
+			}
+			idx[k] = IndexEntry{Repo: r, Spec: p}
+		}
+	}
+	return idx
+}
+
+// Latest returns the latest version of a package in the index, it behaves
+// like FindRepoLatest.
+func (idx Index) Latest(pi goolib.PackageInfo, archs []string) (IndexEntry, error) {
+	if pi.Arch != "" {
+		if e, ok := idx[pi.Name+"."+pi.Arch]; ok {
+			return e, nil
+		}
+		return IndexEntry{}, fmt.Errorf("no versions of package %s.%s found in any repo", pi.Name, pi.Arch)
+	}
+	for _, a := range archs {
+		if e, ok := idx[pi.Name+"."+a]; ok {
+			return e, nil
+		}
+	}
+	return IndexEntry{}, fmt.Errorf("no versions of package %s found in any repo", pi.Name)
+}
+
 // WhatRepo returns what repo a package is in.
 // Name, Arch, and Ver fields of PackageInfo must be provided.
 func WhatRepo(pi goolib.PackageInfo, rm RepoMap) (string, error) {
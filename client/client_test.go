@@ -21,6 +21,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"path/filepath"
 	"reflect"
 	"testing"
@@ -59,7 +60,7 @@ func TestRemove(t *testing.T) {
 		t.Errorf("error running Remove: %v", err)
 	}
 	if len(*s) != 1 {
-		t.Errorf("Remove did not remove anything, want: len of 1, got: len of %s", len(*s))
+		t.Errorf("Remove did not remove anything, want: len of 1, got: len of %d", len(*s))
 	}
 }
 
@@ -92,6 +93,64 @@ func TestGetPackageStateNoMatch(t *testing.T) {
 	}
 }
 
+func TestRemoveDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dir)
+
+	empty := filepath.Join(dir, "empty")
+	nested := filepath.Join(empty, "nested")
+	shared := filepath.Join(dir, "shared")
+	foreign := filepath.Join(dir, "foreign")
+	for _, d := range []string{nested, shared, foreign} {
+		if err := oswrap.MkdirAll(d, 0755); err != nil {
+			t.Fatalf("error creating test directory: %v", err)
+		}
+	}
+	for _, f := range []string{filepath.Join(shared, "bar"), filepath.Join(foreign, "user")} {
+		if err := ioutil.WriteFile(f, []byte{}, 0666); err != nil {
+			t.Fatalf("error creating test file: %v", err)
+		}
+	}
+
+	s := GooGetState{
+		{PackageSpec: &goolib.PkgSpec{Name: "foo", Arch: "noarch"}, Dirs: map[string]bool{empty: true, nested: true, shared: true, foreign: true}},
+		{PackageSpec: &goolib.PkgSpec{Name: "bar", Arch: "noarch"}, Dirs: map[string]bool{shared: false}},
+	}
+	s.RemoveDirs(s[0].CreatedDirs(), goolib.PackageInfo{Name: "foo", Arch: "noarch"})
+
+	for _, d := range []string{empty, nested} {
+		if _, err := oswrap.Stat(d); err == nil {
+			t.Errorf("empty directory %s was not removed", d)
+		}
+	}
+	for _, d := range []string{shared, foreign} {
+		if _, err := oswrap.Stat(d); err != nil {
+			t.Errorf("directory %s with files in it was removed", d)
+		}
+	}
+	if !s[1].Dirs[shared] {
+		t.Errorf("shared directory %s was not handed over to bar, dirs: %v", shared, s[1].Dirs)
+	}
+	if _, ok := s[1].Dirs[foreign]; ok {
+		t.Errorf("directory %s not used by bar was handed over to it", foreign)
+	}
+}
+
+func TestCreatedDirs(t *testing.T) {
+	ps := PackageState{
+		InstalledFiles: map[string]string{"/a/file": "chksum", "/legacy": ""},
+		ConfigFiles:    map[string]string{"/etc/legacy": ""},
+		Dirs:           map[string]bool{"/a": true, "/existing": false},
+	}
+	want := []string{"/a", "/etc/legacy", "/legacy"}
+	if got := ps.CreatedDirs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("CreatedDirs() = %v, want %v", got, want)
+	}
+}
+
 func TestWhatRepo(t *testing.T) {
 	rm := RepoMap{
 		"foo_repo": []goolib.RepoSpec{
@@ -114,6 +173,77 @@ func TestWhatRepo(t *testing.T) {
 	}
 }
 
+func TestFindObsoleting(t *testing.T) {
+	rm := RepoMap{
+		"foo_repo": []goolib.RepoSpec{
+			{PackageSpec: &goolib.PkgSpec{Name: "new_pkg", Version: "1.0.0@1", Arch: "noarch", Obsoletes: []string{"old_pkg"}}},
+			{PackageSpec: &goolib.PkgSpec{Name: "other_pkg", Version: "1.0.0@1", Arch: "noarch"}},
+		},
+		"bar_repo": []goolib.RepoSpec{
+			{PackageSpec: &goolib.PkgSpec{Name: "another_pkg", Version: "1.0.0@1", Arch: "noarch", Obsoletes: []string{"old_pkg", "older_pkg"}}},
+		},
+	}
+
+	table := []struct {
+		name string
+		want string
+	}{
+		{"old_pkg", "another_pkg"},
+		{"older_pkg", "another_pkg"},
+		{"other_pkg", ""},
+	}
+	for _, tt := range table {
+		if got := FindObsoleting(tt.name, rm); got != tt.want {
+			t.Errorf("FindObsoleting(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIndexLatest(t *testing.T) {
+	archs := []string{"noarch", "x86_64"}
+	rm := RepoMap{
+		"foo_repo": []goolib.RepoSpec{
+			{PackageSpec: &goolib.PkgSpec{Name: "foo_pkg", Version: "1.2.3@4", Arch: "noarch"}},
+			{PackageSpec: &goolib.PkgSpec{Name: "foo_pkg", Version: "1.0.0@1", Arch: "noarch"}},
+			{PackageSpec: &goolib.PkgSpec{Name: "bar_pkg", Version: "1.0.0@1", Arch: "x86_64"}},
+		},
+		"bar_repo": []goolib.RepoSpec{
+			{PackageSpec: &goolib.PkgSpec{Name: "foo_pkg", Version: "1.3.0@1", Arch: "x86_64"}},
+			{PackageSpec: &goolib.PkgSpec{Name: "bar_pkg", Version: "2.0.0@1", Arch: "x86_64"}},
+		},
+	}
+	idx := NewIndex(rm)
+
+	table := []struct {
+		pi    goolib.PackageInfo
+		wVer  string
+		wArch string
+		wRepo string
+	}{
+		{goolib.PackageInfo{Name: "foo_pkg", Arch: "noarch"}, "1.2.3@4", "noarch", "foo_repo"},
+		{goolib.PackageInfo{Name: "foo_pkg", Arch: "x86_64"}, "1.3.0@1", "x86_64", "bar_repo"},
+		{goolib.PackageInfo{Name: "foo_pkg"}, "1.2.3@4", "noarch", "foo_repo"},
+		{goolib.PackageInfo{Name: "bar_pkg"}, "2.0.0@1", "x86_64", "bar_repo"},
+	}
+	for _, tt := range table {
+		e, err := idx.Latest(tt.pi, archs)
+		if err != nil {
+			t.Errorf("Latest(%v) failed: %v", tt.pi, err)
+			continue
+		}
+		if e.Spec.PackageSpec.Version != tt.wVer || e.Spec.PackageSpec.Arch != tt.wArch || e.Repo != tt.wRepo {
+			t.Errorf("Latest(%v) = %s.%s from %s, want %s.%s from %s", tt.pi, e.Spec.PackageSpec.Version, e.Spec.PackageSpec.Arch, e.Repo, tt.wVer, tt.wArch, tt.wRepo)
+		}
+		v, r, a, err := FindRepoLatest(tt.pi, rm, archs)
+		if err != nil || v != tt.wVer || a != tt.wArch || r != tt.wRepo {
+			t.Errorf("FindRepoLatest(%v) = %s, %s, %s, %v, disagrees with the index", tt.pi, v, r, a, err)
+		}
+	}
+	if _, err := idx.Latest(goolib.PackageInfo{Name: "baz_pkg"}, archs); err == nil {
+		t.Error("Latest did not return an error for a missing package")
+	}
+}
+
 func TestFindRepoLatest(t *testing.T) {
 	archs := []string{"noarch", "x86_64"}
 	rm := RepoMap{
@@ -132,6 +262,14 @@ func TestFindRepoLatest(t *testing.T) {
 					Arch:    "noarch",
 				},
 			},
+			{
+				Yanked: true,
+				PackageSpec: &goolib.PkgSpec{
+					Name:    "foo_pkg",
+					Version: "2.0.0@1",
+					Arch:    "noarch",
+				},
+			},
 			{
 				PackageSpec: &goolib.PkgSpec{
 					Name:    "bar_pkg",
@@ -174,6 +312,32 @@ func TestFindRepoLatest(t *testing.T) {
 	}
 }
 
+func TestFindRepoMatch(t *testing.T) {
+	archs := []string{"noarch"}
+	rm := RepoMap{
+		"foo_repo": []goolib.RepoSpec{
+			{PackageSpec: &goolib.PkgSpec{Name: "foo_pkg", Version: "1.2.3@4", Arch: "noarch"}},
+			{PackageSpec: &goolib.PkgSpec{Name: "foo_pkg", Version: "1.4.0@1", Arch: "noarch"}},
+			{PackageSpec: &goolib.PkgSpec{Name: "foo_pkg", Version: "2.0.0@1", Arch: "noarch"}},
+			{Yanked: true, PackageSpec: &goolib.PkgSpec{Name: "foo_pkg", Version: "1.5.0@1", Arch: "noarch"}},
+		},
+	}
+	cs := goolib.Constraints{{Op: ">=", Ver: "1.2"}, {Op: "<", Ver: "2.0"}}
+	ver, repo, arch, err := FindRepoMatch(goolib.PackageInfo{Name: "foo_pkg"}, cs, rm, archs)
+	if err != nil {
+		t.Fatalf("FindRepoMatch: %v", err)
+	}
+	if ver != "1.4.0@1" || repo != "foo_repo" || arch != "noarch" {
+		t.Errorf("FindRepoMatch() = %q, %q, %q, want %q, %q, %q", ver, repo, arch, "1.4.0@1", "foo_repo", "noarch")
+	}
+
+	cs = goolib.Constraints{{Op: "=", Ver: "3.*"}}
+	werr := "no version of package foo_pkg matches =3.*, available versions: 1.2.3@4, 1.4.0@1, 2.0.0@1"
+	if _, _, _, err := FindRepoMatch(goolib.PackageInfo{Name: "foo_pkg"}, cs, rm, archs); err == nil || err.Error() != werr {
+		t.Errorf("did not get expected error: got %v, want %q", err, werr)
+	}
+}
+
 func TestUnmarshalRepoPackagesJSON(t *testing.T) {
 	tempDir, err := ioutil.TempDir("", "")
 	if err != nil {
@@ -310,3 +474,88 @@ func TestFindRepoSpecNoMatch(t *testing.T) {
 		t.Error("did not get expected error when running FindRepoSpec")
 	}
 }
+
+func TestAvailablePackages(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+
+	queried := []goolib.RepoSpec{
+		{PackageSpec: &goolib.PkgSpec{Name: "a_pkg", Version: "1.0.0@1", Arch: "noarch", PkgDependencies: map[string]string{"b_pkg.noarch": "1.0.0@1"}}},
+		{PackageSpec: &goolib.PkgSpec{Name: "b_pkg", Version: "1.0.0@1", Arch: "noarch", PkgDependencies: map[string]string{"c_pkg": "1.0.0@1"}}},
+		{PackageSpec: &goolib.PkgSpec{Name: "unrelated_pkg", Version: "1.0.0@1", Arch: "noarch"}},
+	}
+	indexed := []goolib.RepoSpec{
+		{PackageSpec: &goolib.PkgSpec{Name: "c_pkg", Version: "1.0.0@1", Arch: "noarch"}},
+		{PackageSpec: &goolib.PkgSpec{Name: "other_pkg", Version: "1.0.0@1", Arch: "noarch"}},
+	}
+	var queries []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/query_repo/query", func(w http.ResponseWriter, r *http.Request) {
+		names := r.URL.Query()["name"]
+		queries = append(queries, fmt.Sprint(names))
+		rs := []goolib.RepoSpec{}
+		for _, s := range queried {
+			if goolib.ContainsString(s.PackageSpec.Name, names) {
+				rs = append(rs, s)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rs)
+	})
+	mux.HandleFunc("/index_repo/index", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(indexed)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	qr, ir := ts.URL+"/query_repo", ts.URL+"/index_repo"
+	rm := AvailablePackages([]string{qr, ir}, []string{"a_pkg"}, tempDir, cacheLife, proxyServer)
+
+	if !reflect.DeepEqual(rm[qr], queried[:2]) {
+		t.Errorf("unexpected packages from query repo: %v", rm[qr])
+	}
+	if !reflect.DeepEqual(rm[ir], indexed) {
+		t.Errorf("unexpected packages from index repo: %v", rm[ir])
+	}
+	wq := []string{"[a_pkg]", "[b_pkg]", "[c_pkg]"}
+	if !reflect.DeepEqual(queries, wq) {
+		t.Errorf("unexpected queries: got %v, want %v", queries, wq)
+	}
+}
+
+func TestRequestHeaders(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+
+	var got http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[]"))
+	}))
+	defer ts.Close()
+
+	defer SetRequestHeaders(nil)
+	SetRequestHeaders(http.Header{HeaderHostname: {"host"}, HeaderCohorts: {"canary,eu"}})
+	if _, err := unmarshalRepoPackages(ts.URL+"/repo", tempDir, 0, proxyServer); err != nil {
+		t.Fatalf("Error running unmarshalRepoPackages: %v", err)
+	}
+	if got.Get(HeaderHostname) != "host" || got.Get(HeaderCohorts) != "canary,eu" {
+		t.Errorf("index request had headers %v, want %s and %s set", got, HeaderHostname, HeaderCohorts)
+	}
+
+	SetRequestHeaders(nil)
+	if _, err := unmarshalRepoPackages(ts.URL+"/repo", tempDir, 0, proxyServer); err != nil {
+		t.Fatalf("Error running unmarshalRepoPackages: %v", err)
+	}
+	if got.Get(HeaderHostname) != "" {
+		t.Errorf("index request had headers %v with none set", got)
+	}
+}
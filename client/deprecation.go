@@ -0,0 +1,127 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/google/logger"
+)
+
+// Deprecation is the notice a repo that is going away serves at
+// <repo>/deprecation.
+type Deprecation struct {
+	Message string
+	// Sunset is the date, as YYYY-MM-DD, the repo may stop being served.
+	Sunset string `json:",omitempty"`
+	// Replacement is the URL of the repo replacing it.
+	Replacement string `json:",omitempty"`
+}
+
+func (d Deprecation) String() string {
+	s := d.Message
+	if d.Sunset != "" {
+		s += fmt.Sprintf(", it will be shut down on %s", d.Sunset)
+	}
+	if d.Replacement != "" {
+		s += fmt.Sprintf(", use %s instead", d.Replacement)
+	}
+	return s
+}
+
+// deprecations holds the notices of the repos read by AvailableVersions
+// and AvailablePackages.
+var deprecations = make(map[string]Deprecation)
+
+// Deprecated returns the deprecation notice of repo, as of the last time
+// its index was read.
+func Deprecated(repo string) (Deprecation, bool) {
+	d, ok := deprecations[repo]
+	return d, ok
+}
+
+func deprecationFile(repo, cacheDir string) string {
+	return filepath.Join(cacheDir, filepath.Base(repo)+".dep")
+}
+
+// ReadDeprecation returns the deprecation notice of repo cached in
+// cacheDir, or nil if there is none.
+func ReadDeprecation(repo, cacheDir string) (*Deprecation, error) {
+	b, err := ioutil.ReadFile(deprecationFile(repo, cacheDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var d Deprecation
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// loadDeprecation records the cached deprecation notice of repo.
+func loadDeprecation(repo, cacheDir string) {
+	d, err := ReadDeprecation(repo, cacheDir)
+	if err != nil {
+		logger.Errorf("Error reading deprecation notice of %s: %v", repo, err)
+		return
+	}
+	if d == nil {
+		delete(deprecations, repo)
+		return
+	}
+	deprecations[repo] = *d
+}
+
+// fetchDeprecation gets the deprecation notice of repo from the base URL u
+// and caches it in cacheDir, repos without one serve 404.
+func fetchDeprecation(repo, u, cacheDir string, httpClient *http.Client) error {
+	res, err := httpClient.Get(u + "/deprecation")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	cf := deprecationFile(repo, cacheDir)
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		delete(deprecations, repo)
+		if err := os.Remove(cf); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	default:
+		return fmt.Errorf("deprecation GET request returned status: %q", res.Status)
+	}
+	var d Deprecation
+	if err := json.NewDecoder(res.Body).Decode(&d); err != nil {
+		return fmt.Errorf("error decoding deprecation notice: %v", err)
+	}
+	if d.Message == "" {
+		return fmt.Errorf("deprecation notice has no message")
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	deprecations[repo] = d
+	return ioutil.WriteFile(cf, b, 0664)
+}
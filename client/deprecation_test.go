@@ -0,0 +1,84 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/googet/oswrap"
+)
+
+func TestFetchDeprecation(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+
+	notice := `{"Message": "moving", "Sunset": "2027-06-30", "Replacement": "https://new.example.com/repo"}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if notice == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(notice))
+	}))
+	defer ts.Close()
+	repo := ts.URL + "/repo"
+	defer delete(deprecations, repo)
+
+	if err := fetchDeprecation(repo, repo, tempDir, http.DefaultClient); err != nil {
+		t.Fatalf("fetchDeprecation: %v", err)
+	}
+	want := Deprecation{Message: "moving", Sunset: "2027-06-30", Replacement: "https://new.example.com/repo"}
+	if got, ok := Deprecated(repo); !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("Deprecated() = %+v, %v, want %+v, true", got, ok, want)
+	}
+	got, err := ReadDeprecation(repo, tempDir)
+	if err != nil {
+		t.Fatalf("ReadDeprecation: %v", err)
+	}
+	if got == nil || !reflect.DeepEqual(*got, want) {
+		t.Errorf("ReadDeprecation() = %+v, want %+v", got, want)
+	}
+	if s, want := want.String(), "moving, it will be shut down on 2027-06-30, use https://new.example.com/repo instead"; s != want {
+		t.Errorf("String() = %q, want %q", s, want)
+	}
+
+	delete(deprecations, repo)
+	loadDeprecation(repo, tempDir)
+	if _, ok := Deprecated(repo); !ok {
+		t.Error("loadDeprecation did not load the cached notice")
+	}
+
+	notice = `{"Sunset": "2027-06-30"}`
+	if err := fetchDeprecation(repo, repo, tempDir, http.DefaultClient); err == nil {
+		t.Error("fetchDeprecation of a notice without a message did not return an error")
+	}
+
+	notice = ""
+	if err := fetchDeprecation(repo, repo, tempDir, http.DefaultClient); err != nil {
+		t.Fatalf("fetchDeprecation: %v", err)
+	}
+	if _, ok := Deprecated(repo); ok {
+		t.Error("repo is still deprecated after its notice was removed")
+	}
+	if got, err := ReadDeprecation(repo, tempDir); err != nil || got != nil {
+		t.Errorf("ReadDeprecation() = %+v, %v, want nil, nil", got, err)
+	}
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/google/googet/goolib"
+)
+
+// Graph is a package dependency graph. Nodes are packages, identified as
+// name.arch, and edges go from a package to the packages it depends on.
+type Graph struct {
+	Nodes []GraphNode
+	Edges []GraphEdge
+}
+
+// GraphNode is a package in a Graph. A missing node is a dependency that is
+// neither installed nor, for repo graphs, available.
+type GraphNode struct {
+	ID      string
+	Version string `json:",omitempty"`
+	Repo    string `json:",omitempty"`
+	Missing bool   `json:",omitempty"`
+}
+
+// GraphEdge is a dependency of From on To at MinVersion or greater.
+type GraphEdge struct {
+	From, To, MinVersion string
+}
+
+// graphBuilder collects nodes and edges, keeping each node once.
+type graphBuilder struct {
+	nodes map[string]GraphNode
+	edges []GraphEdge
+}
+
+func (b *graphBuilder) addNode(n GraphNode) {
+	if _, ok := b.nodes[n.ID]; !ok || b.nodes[n.ID].Missing {
+		b.nodes[n.ID] = n
+	}
+}
+
+func (b *graphBuilder) graph() Graph {
+	var g Graph
+	for _, n := range b.nodes {
+		g.Nodes = append(g.Nodes, n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].ID < g.Nodes[j].ID })
+	g.Edges = b.edges
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+	return g
+}
+
+// StateGraph returns the dependency graph of the packages in s. A
+// dependency without an arch resolves to the installed package of that name.
+func StateGraph(s GooGetState) Graph {
+	b := graphBuilder{nodes: make(map[string]GraphNode)}
+	for _, p := range s {
+		ps := p.PackageSpec
+		from := ps.Name + "." + ps.Arch
+		b.addNode(GraphNode{ID: from, Version: ps.Version})
+		for d, v := range ps.PkgDependencies {
+			di := goolib.PkgNameSplit(d)
+			to := d
+			missing := true
+			for _, q := range s {
+				if q.PackageSpec.Name == di.Name && (di.Arch == "" || q.PackageSpec.Arch == di.Arch) {
+					to = q.PackageSpec.Name + "." + q.PackageSpec.Arch
+					missing = false
+					break
+				}
+			}
+			if missing {
+				b.addNode(GraphNode{ID: to, Missing: true})
+			}
+			b.edges = append(b.edges, GraphEdge{From: from, To: to, MinVersion: v})
+		}
+	}
+	return b.graph()
+}
+
+// RepoGraph returns the dependency graph of the latest version of every
+// package in rm. Dependencies without an arch resolve as they would on
+// install, using archs.
+func RepoGraph(rm RepoMap, archs []string) Graph {
+	idx := NewIndex(rm)
+	b := graphBuilder{nodes: make(map[string]GraphNode)}
+	for id, e := range idx {
+		b.addNode(GraphNode{ID: id, Version: e.Spec.PackageSpec.Version, Repo: e.Repo})
+		for d, v := range e.Spec.PackageSpec.PkgDependencies {
+			to := d
+			if de, err := idx.Latest(goolib.PkgNameSplit(d), archs); err == nil {
+				to = de.Spec.PackageSpec.Name + "." + de.Spec.PackageSpec.Arch
+			} else {
+				b.addNode(GraphNode{ID: to, Missing: true})
+			}
+			b.edges = append(b.edges, GraphEdge{From: id, To: to, MinVersion: v})
+		}
+	}
+	return b.graph()
+}
+
+// Cycles returns the dependency cycles in g, as the sorted IDs of the
+// packages that depend on each other.
+func (g Graph) Cycles() [][]string {
+	adj := make(map[string][]string)
+	self := make(map[string]bool)
+	for _, e := range g.Edges {
+		adj[e.From] = append(adj[e.From], e.To)
+		if e.From == e.To {
+			self[e.From] = true
+		}
+	}
+
+	// Tarjan's strongly connected components, a component of more than one
+	// node, or a node depending on itself, is a cycle.
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var cycles [][]string
+	var visit func(n string)
+	visit = func(n string) {
+		index[n] = len(index)
+		low[n] = index[n]
+		stack = append(stack, n)
+		onStack[n] = true
+		for _, m := range adj[n] {
+			if _, ok := index[m]; !ok {
+				visit(m)
+				if low[m] < low[n] {
+					low[n] = low[m]
+				}
+			} else if onStack[m] && index[m] < low[n] {
+				low[n] = index[m]
+			}
+		}
+		if low[n] != index[n] {
+			return
+		}
+		var scc []string
+		for {
+			m := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[m] = false
+			scc = append(scc, m)
+			if m == n {
+				break
+			}
+		}
+		if len(scc) > 1 || self[n] {
+			sort.Strings(scc)
+			cycles = append(cycles, scc)
+		}
+	}
+	for _, n := range g.Nodes {
+		if _, ok := index[n.ID]; !ok {
+			visit(n.ID)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return cycles
+}
+
+// WriteDOT writes g to w in the Graphviz DOT language. Missing packages are
+// drawn dashed and edges that are part of a cycle red.
+func (g Graph) WriteDOT(w io.Writer) error {
+	inCycle := make(map[string]int)
+	for i, c := range g.Cycles() {
+		for _, n := range c {
+			inCycle[n] = i + 1
+		}
+	}
+	if _, err := fmt.Fprintln(w, "digraph googet {"); err != nil {
+		return err
+	}
+	for _, n := range g.Nodes {
+		label := n.ID
+		if n.Version != "" {
+			label += `\n` + n.Version
+		}
+		// Package names and versions need no escaping, so the label is
+		// written as is to keep its \n line break.
+		attrs := fmt.Sprintf(`label="%s"`, label)
+		if n.Missing {
+			attrs += ", style=dashed"
+		}
+		if _, err := fmt.Fprintf(w, "  %q [%s];\n", n.ID, attrs); err != nil {
+			return err
+		}
+	}
+	for _, e := range g.Edges {
+		attrs := fmt.Sprintf("label=%q", ">= "+e.MinVersion)
+		if c := inCycle[e.From]; c != 0 && c == inCycle[e.To] {
+			attrs += ", color=red"
+		}
+		if _, err := fmt.Fprintf(w, "  %q -> %q [%s];\n", e.From, e.To, attrs); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
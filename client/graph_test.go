@@ -0,0 +1,91 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/googet/goolib"
+)
+
+func TestStateGraph(t *testing.T) {
+	s := GooGetState{
+		{PackageSpec: &goolib.PkgSpec{Name: "a", Arch: "noarch", Version: "1.0.0@1", PkgDependencies: map[string]string{"b": "1.0.0@1", "gone": "2.0.0@1"}}},
+		{PackageSpec: &goolib.PkgSpec{Name: "b", Arch: "x86_64", Version: "1.0.0@1", PkgDependencies: map[string]string{"c.noarch": "1.0.0@1"}}},
+		{PackageSpec: &goolib.PkgSpec{Name: "c", Arch: "noarch", Version: "1.0.0@1", PkgDependencies: map[string]string{"b.x86_64": "1.0.0@1"}}},
+	}
+	g := StateGraph(s)
+	want := Graph{
+		Nodes: []GraphNode{
+			{ID: "a.noarch", Version: "1.0.0@1"},
+			{ID: "b.x86_64", Version: "1.0.0@1"},
+			{ID: "c.noarch", Version: "1.0.0@1"},
+			{ID: "gone", Missing: true},
+		},
+		Edges: []GraphEdge{
+			{From: "a.noarch", To: "b.x86_64", MinVersion: "1.0.0@1"},
+			{From: "a.noarch", To: "gone", MinVersion: "2.0.0@1"},
+			{From: "b.x86_64", To: "c.noarch", MinVersion: "1.0.0@1"},
+			{From: "c.noarch", To: "b.x86_64", MinVersion: "1.0.0@1"},
+		},
+	}
+	if !reflect.DeepEqual(g, want) {
+		t.Errorf("StateGraph() = %+v, want %+v", g, want)
+	}
+
+	if got, want := g.Cycles(), [][]string{{"b.x86_64", "c.noarch"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Cycles() = %v, want %v", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteDOT(&buf); err != nil {
+		t.Fatalf("WriteDOT: %v", err)
+	}
+	for _, l := range []string{
+		`"gone" [label="gone", style=dashed];`,
+		`"b.x86_64" -> "c.noarch" [label=">= 1.0.0@1", color=red];`,
+		`"a.noarch" -> "b.x86_64" [label=">= 1.0.0@1"];`,
+	} {
+		if !strings.Contains(buf.String(), l) {
+			t.Errorf("DOT output does not contain %q:\n%s", l, buf.String())
+		}
+	}
+}
+
+func TestRepoGraph(t *testing.T) {
+	rm := RepoMap{
+		"repo": []goolib.RepoSpec{
+			{PackageSpec: &goolib.PkgSpec{Name: "a", Arch: "noarch", Version: "1.0.0@1", PkgDependencies: map[string]string{"b": "1.0.0@1"}}},
+			{PackageSpec: &goolib.PkgSpec{Name: "a", Arch: "noarch", Version: "2.0.0@1", PkgDependencies: map[string]string{"a": "1.0.0@1"}}},
+			{PackageSpec: &goolib.PkgSpec{Name: "b", Arch: "x86_64", Version: "1.0.0@1"}},
+		},
+	}
+	g := RepoGraph(rm, []string{"noarch", "x86_64"})
+	want := Graph{
+		Nodes: []GraphNode{
+			{ID: "a.noarch", Version: "2.0.0@1", Repo: "repo"},
+			{ID: "b.x86_64", Version: "1.0.0@1", Repo: "repo"},
+		},
+		Edges: []GraphEdge{{From: "a.noarch", To: "a.noarch", MinVersion: "1.0.0@1"}},
+	}
+	if !reflect.DeepEqual(g, want) {
+		t.Errorf("RepoGraph() = %+v, want %+v", g, want)
+	}
+	if got, want := g.Cycles(), [][]string{{"a.noarch"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Cycles() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/google/googet/oswrap"
+)
+
+// JournalStage is the stage a package state transition has reached.
+type JournalStage string
+
+// Stages of a package state transition, in the order they are reached.
+const (
+	StagePrepared       JournalStage = "prepared"
+	StageFilesCommitted JournalStage = "files_committed"
+	StageOldRemoved     JournalStage = "old_removed"
+)
+
+// JournalEntry records a package state transition from Old, which is nil for
+// a new install, to New.
+type JournalEntry struct {
+	Stage  JournalStage
+	DBOnly bool          `json:",omitempty"`
+	Old    *PackageState `json:",omitempty"`
+	New    PackageState
+}
+
+// Journal is a write-ahead journal of package state transitions that have
+// not yet been written to the state file. Entries are recorded before each
+// step of a transition so that a transition interrupted part way through can
+// be detected and finished on the next run. A nil Journal records nothing.
+type Journal struct {
+	Path string
+}
+
+// Entries returns the entries in the journal.
+func (j *Journal) Entries() ([]JournalEntry, error) {
+	if j == nil {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(j.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var el []JournalEntry
+	return el, json.Unmarshal(b, &el)
+}
+
+// Record writes e to the journal, replacing any previous entry for the same
+// package name and arch.
+func (j *Journal) Record(e JournalEntry) error {
+	if j == nil {
+		return nil
+	}
+	el, err := j.Entries()
+	if err != nil {
+		return err
+	}
+	var found bool
+	for i, o := range el {
+		if o.New.PackageSpec.Name == e.New.PackageSpec.Name && o.New.PackageSpec.Arch == e.New.PackageSpec.Arch {
+			el[i] = e
+			found = true
+		}
+	}
+	if !found {
+		el = append(el, e)
+	}
+	b, err := json.Marshal(el)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(j.Path, b, 0664)
+}
+
+// Clear removes all entries from the journal, it should be called once the
+// state containing the recorded transitions has been written.
+func (j *Journal) Clear() error {
+	if j == nil {
+		return nil
+	}
+	if err := oswrap.Remove(j.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+)
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dir)
+
+	j := &Journal{Path: filepath.Join(dir, "googet.journal")}
+	el, err := j.Entries()
+	if err != nil {
+		t.Fatalf("error reading empty journal: %v", err)
+	}
+	if len(el) != 0 {
+		t.Errorf("empty journal returned entries: %+v", el)
+	}
+
+	foo := PackageState{PackageSpec: &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "1.0.0@1"}}
+	bar := PackageState{PackageSpec: &goolib.PkgSpec{Name: "bar", Arch: "noarch", Version: "1.0.0@1"}}
+	records := []JournalEntry{
+		{Stage: StagePrepared, New: foo},
+		{Stage: StagePrepared, New: bar},
+		{Stage: StageFilesCommitted, New: foo},
+	}
+	for _, e := range records {
+		if err := j.Record(e); err != nil {
+			t.Fatalf("error recording journal entry: %v", err)
+		}
+	}
+
+	el, err = j.Entries()
+	if err != nil {
+		t.Fatalf("error reading journal: %v", err)
+	}
+	want := []JournalEntry{records[2], records[1]}
+	if !reflect.DeepEqual(el, want) {
+		t.Errorf("unexpected journal entries, want: %+v, got: %+v", want, el)
+	}
+
+	if err := j.Clear(); err != nil {
+		t.Fatalf("error clearing journal: %v", err)
+	}
+	if err := j.Clear(); err != nil {
+		t.Errorf("error clearing already cleared journal: %v", err)
+	}
+	el, err = j.Entries()
+	if err != nil {
+		t.Fatalf("error reading cleared journal: %v", err)
+	}
+	if len(el) != 0 {
+		t.Errorf("cleared journal returned entries: %+v", el)
+	}
+}
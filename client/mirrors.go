@@ -0,0 +1,142 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/logger"
+)
+
+const (
+	// minBan is how long a URL is avoided after its first failure, each
+	// further failure doubles it up to maxBan.
+	minBan = time.Minute
+	maxBan = 24 * time.Hour
+)
+
+// health is the failure record of a repo URL.
+type health struct {
+	Failures    int
+	BannedUntil time.Time
+}
+
+var (
+	mirrorsMu  sync.Mutex
+	mirrors    = make(map[string][]string)
+	healthFile string
+	now        = time.Now
+)
+
+// SetMirrors sets other base URLs serving the same packages as the repo.
+func SetMirrors(repo string, urls []string) {
+	mirrorsMu.Lock()
+	defer mirrorsMu.Unlock()
+	if len(urls) == 0 {
+		delete(mirrors, repo)
+		return
+	}
+	mirrors[repo] = urls
+}
+
+// SetHealthFile sets the file the failures of repo URLs are tracked in.
+// Without one failures are not tracked.
+func SetHealthFile(p string) {
+	mirrorsMu.Lock()
+	defer mirrorsMu.Unlock()
+	healthFile = p
+}
+
+// Candidates returns the base URLs to try for repo, the repo followed by
+// its mirrors. URLs banned after recent failures are moved last, in the
+// order their bans end.
+func Candidates(repo string) []string {
+	mirrorsMu.Lock()
+	defer mirrorsMu.Unlock()
+	urls := append([]string{repo}, mirrors[repo]...)
+	if len(urls) == 1 {
+		return urls
+	}
+	hm := readHealth()
+	t := now()
+	banned := func(u string) bool { return hm[u].BannedUntil.After(t) }
+	sort.SliceStable(urls, func(i, j int) bool {
+		bi, bj := banned(urls[i]), banned(urls[j])
+		if bi != bj {
+			return bj
+		}
+		return bi && hm[urls[i]].BannedUntil.Before(hm[urls[j]].BannedUntil)
+	})
+	return urls
+}
+
+// Report records the result of a request to the repo URL u, a failure bans
+// u for a time that grows with each failure in a row and a success clears
+// its record.
+func Report(u string, err error) {
+	mirrorsMu.Lock()
+	defer mirrorsMu.Unlock()
+	if healthFile == "" {
+		return
+	}
+	hm := readHealth()
+	if err == nil {
+		if _, ok := hm[u]; !ok {
+			return
+		}
+		delete(hm, u)
+	} else {
+		h := hm[u]
+		h.Failures++
+		ban := minBan << uint(h.Failures-1)
+		if ban > maxBan || ban <= 0 {
+			ban = maxBan
+		}
+		h.BannedUntil = now().Add(ban)
+		hm[u] = h
+		logger.Infof("Avoiding %s for %v after %d failures in a row: %v", u, ban, h.Failures, err)
+	}
+	b, err := json.Marshal(hm)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	if err := ioutil.WriteFile(healthFile, b, 0664); err != nil {
+		logger.Errorf("Error writing repo health: %v", err)
+	}
+}
+
+// readHealth reads the health file, mirrorsMu must be held.
+func readHealth() map[string]health {
+	hm := make(map[string]health)
+	if healthFile == "" {
+		return hm
+	}
+	b, err := ioutil.ReadFile(healthFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Errorf("Error reading repo health: %v", err)
+		}
+		return hm
+	}
+	if err := json.Unmarshal(b, &hm); err != nil {
+		logger.Errorf("Error reading repo health: %v", err)
+	}
+	return hm
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/googet/oswrap"
+)
+
+func TestCandidates(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer func() { now = time.Now }()
+	now = func() time.Time { return t0 }
+	SetHealthFile(filepath.Join(tempDir, "repohealth.json"))
+	defer SetHealthFile("")
+	SetMirrors("a", []string{"b", "c"})
+	defer SetMirrors("a", nil)
+
+	if got, want := Candidates("a"), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Candidates() = %v, want %v", got, want)
+	}
+	fail := errors.New("failed")
+	Report("a", fail)
+	Report("a", fail)
+	Report("b", fail)
+	// a is banned for 2m and b for 1m.
+	if got, want := Candidates("a"), []string{"c", "b", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Candidates() after failures = %v, want %v", got, want)
+	}
+	now = func() time.Time { return t0.Add(90 * time.Second) }
+	if got, want := Candidates("a"), []string{"b", "c", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Candidates() once the ban of b ended = %v, want %v", got, want)
+	}
+	Report("a", nil)
+	if got, want := Candidates("a"), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Candidates() after a succeeded = %v, want %v", got, want)
+	}
+	if got := Candidates("other"); !reflect.DeepEqual(got, []string{"other"}) {
+		t.Errorf("Candidates() of a repo without mirrors = %v, want only the repo", got)
+	}
+}
+
+func TestMirrorFailover(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+	SetHealthFile(filepath.Join(tempDir, "repohealth.json"))
+	defer SetHealthFile("")
+
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"Source": "foo"}]`))
+	}))
+	defer ts.Close()
+
+	repo := dead.URL + "/repo"
+	SetMirrors(repo, []string{ts.URL + "/repo"})
+	defer SetMirrors(repo, nil)
+	got, err := unmarshalRepoPackages(repo, tempDir, 0, proxyServer)
+	if err != nil {
+		t.Fatalf("Error running unmarshalRepoPackages: %v", err)
+	}
+	if len(got) != 1 || got[0].Source != "foo" {
+		t.Errorf("unmarshalRepoPackages() = %+v, want the index of the mirror", got)
+	}
+	if c := Candidates(repo); c[0] != ts.URL+"/repo" {
+		t.Errorf("Candidates() = %v, want the failed repo last", c)
+	}
+}
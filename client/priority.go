@@ -0,0 +1,128 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/googet/goolib"
+	"github.com/google/logger"
+)
+
+// DefaultPriority is the priority of repos that don't set one.
+const DefaultPriority = 500
+
+var (
+	prioritiesMu sync.Mutex
+	priorities   = make(map[string]int)
+)
+
+// SetPriority sets the priority of repo, 0 resets it to DefaultPriority.
+func SetPriority(repo string, p int) {
+	prioritiesMu.Lock()
+	defer prioritiesMu.Unlock()
+	if p == 0 {
+		delete(priorities, repo)
+		return
+	}
+	priorities[repo] = p
+}
+
+// Priority returns the priority of repo.
+func Priority(repo string) int {
+	prioritiesMu.Lock()
+	defer prioritiesMu.Unlock()
+	if p, ok := priorities[repo]; ok {
+		return p
+	}
+	return DefaultPriority
+}
+
+// Decision is the version an update resolved for a package, along with the
+// repo it came from and the priority of that repo.
+type Decision struct {
+	Repo     string
+	Priority int
+	Version  string
+}
+
+// Resolve returns the latest version of the package pi in the repos of
+// highest priority that have it. pi must have a Name and Arch. Yanked
+// versions are skipped.
+func Resolve(pi goolib.PackageInfo, rm RepoMap) (Decision, error) {
+	var d Decision
+	for r, pl := range rm {
+		pr := Priority(r)
+		for _, p := range pl {
+			ps := p.PackageSpec
+			if ps.Name != pi.Name || ps.Arch != pi.Arch || p.Yanked {
+				continue
+			}
+			if d.Version != "" {
+				if pr < d.Priority {
+					continue
+				}
+				if pr == d.Priority {
+					c, err := goolib.Compare(ps.Version, d.Version)
+					if err != nil {
+						logger.Errorf("compare of %s to %s failed with error: %v", ps.Version, d.Version, err)
+					}
+					if c != 1 {
+						continue
+					}
+				}
+			}
+			d = Decision{Repo: r, Priority: pr, Version: ps.Version}
+		}
+	}
+	if d.Version == "" {
+		return Decision{}, fmt.Errorf("no versions of package %s.%s found in any repo", pi.Name, pi.Arch)
+	}
+	return d, nil
+}
+
+// ShouldUpdate reports whether the installed package pi should change to
+// the version d resolved for it. prev is the decision pi was installed by, nil
+// if an update did not install it. repos are the repos in use and rm those of
+// them that could be read.
+//
+// So that canary and rollback repos don't flap a package between versions,
+// nothing changes while the (priority, version) of d matches prev, or while
+// the repo of prev is in use but could not be read. Newer versions are always
+// taken, older ones only from a repo of higher priority than prev, or of the
+// same priority if it is above DefaultPriority.
+func ShouldUpdate(pi goolib.PackageInfo, d Decision, prev *Decision, repos []string, rm RepoMap) (bool, error) {
+	if d.Version == pi.Ver {
+		return false, nil
+	}
+	base := DefaultPriority
+	if prev != nil {
+		if prev.Priority == d.Priority && prev.Version == d.Version {
+			return false, nil
+		}
+		if _, ok := rm[prev.Repo]; !ok && goolib.ContainsString(prev.Repo, repos) {
+			return false, nil
+		}
+		base = prev.Priority
+	}
+	c, err := goolib.Compare(d.Version, pi.Ver)
+	if err != nil {
+		return false, err
+	}
+	if c == 1 {
+		return true, nil
+	}
+	return d.Priority > base || (d.Priority == base && base > DefaultPriority), nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+
+	"github.com/google/googet/goolib"
+)
+
+func TestResolve(t *testing.T) {
+	SetPriority("canary", 1000)
+	SetPriority("rollback", 1500)
+	defer SetPriority("canary", 0)
+	defer SetPriority("rollback", 0)
+
+	spec := func(ver string) goolib.RepoSpec {
+		return goolib.RepoSpec{PackageSpec: &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: ver}}
+	}
+	pi := goolib.PackageInfo{Name: "foo", Arch: "noarch"}
+	for _, tt := range []struct {
+		desc string
+		rm   RepoMap
+		want Decision
+	}{
+		{"stable only", RepoMap{"stable": {spec("1.0.0@1"), spec("2.0.0@1")}}, Decision{"stable", DefaultPriority, "2.0.0@1"}},
+		{"canary wins", RepoMap{"stable": {spec("2.0.0@1")}, "canary": {spec("3.0.0@1")}}, Decision{"canary", 1000, "3.0.0@1"}},
+		{"rollback pins older", RepoMap{"stable": {spec("2.0.0@1")}, "canary": {spec("3.0.0@1")}, "rollback": {spec("1.0.0@1")}}, Decision{"rollback", 1500, "1.0.0@1"}},
+		{"rollback without package", RepoMap{"stable": {spec("2.0.0@1")}, "rollback": {}}, Decision{"stable", DefaultPriority, "2.0.0@1"}},
+	} {
+		got, err := Resolve(pi, tt.rm)
+		if err != nil {
+			t.Errorf("%s: Resolve: %v", tt.desc, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: Resolve() = %+v, want %+v", tt.desc, got, tt.want)
+		}
+	}
+	if _, err := Resolve(goolib.PackageInfo{Name: "bar", Arch: "noarch"}, RepoMap{"stable": {spec("1.0.0@1")}}); err == nil {
+		t.Error("Resolve of a missing package did not return an error")
+	}
+}
+
+func TestShouldUpdate(t *testing.T) {
+	repos := []string{"stable", "canary", "rollback"}
+	all := RepoMap{"stable": nil, "canary": nil, "rollback": nil}
+	noRollback := RepoMap{"stable": nil, "canary": nil}
+	stable := Decision{"stable", DefaultPriority, "2.0.0@1"}
+	canary := Decision{"canary", 1000, "3.0.0@1"}
+	rollback := Decision{"rollback", 1500, "1.0.0@1"}
+
+	for _, tt := range []struct {
+		desc      string
+		installed string
+		d         Decision
+		prev      *Decision
+		rm        RepoMap
+		repos     []string
+		want      bool
+	}{
+		{"upgrade", "1.0.0@1", stable, nil, all, repos, true},
+		{"already installed", "2.0.0@1", stable, &stable, all, repos, false},
+		{"no downgrade at default priority", "3.0.0@1", stable, nil, all, repos, false},
+		{"canary upgrade", "2.0.0@1", canary, &stable, all, repos, true},
+		{"rollback downgrade", "3.0.0@1", rollback, &canary, all, repos, true},
+		{"further rollback", "1.0.0@1", Decision{"rollback", 1500, "0.9.0@1"}, &rollback, all, repos, true},
+		{"canary does not undo rollback", "1.0.0@1", Decision{"canary", 1000, "0.5.0@1"}, &rollback, all, repos, false},
+		{"rollback unreadable", "1.0.0@1", canary, &rollback, noRollback, repos, false},
+		// Without the rollback repo the newer canary version is taken again.
+		{"rollback removed", "1.0.0@1", canary, &rollback, noRollback, []string{"stable", "canary"}, true},
+		{"manual change kept", "2.5.0@1", canary, &canary, all, repos, false},
+	} {
+		got, err := ShouldUpdate(goolib.PackageInfo{Name: "foo", Arch: "noarch", Ver: tt.installed}, tt.d, tt.prev, tt.repos, tt.rm)
+		if err != nil {
+			t.Errorf("%s: ShouldUpdate: %v", tt.desc, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: ShouldUpdate() = %v, want %v", tt.desc, got, tt.want)
+		}
+	}
+}
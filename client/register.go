@@ -0,0 +1,88 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Signer signs requests with the identity of the machine.
+type Signer interface {
+	Sign(req *http.Request) error
+}
+
+var (
+	registerMu sync.Mutex
+	signer     Signer
+	// registered holds the repos that require registration.
+	registered = make(map[string]bool)
+)
+
+// SetSigner sets what signs requests to repos that require registration.
+func SetSigner(s Signer) {
+	registerMu.Lock()
+	defer registerMu.Unlock()
+	signer = s
+}
+
+// SetRegistered sets whether repo requires registration. Requests to the
+// hosts of such repos and their mirrors, including package downloads, are
+// signed, requests to other repos stay anonymous.
+func SetRegistered(repo string, on bool) {
+	registerMu.Lock()
+	defer registerMu.Unlock()
+	if !on {
+		delete(registered, repo)
+		return
+	}
+	registered[repo] = true
+}
+
+// hostOf returns the scheme and host of the URL u.
+func hostOf(u string) string {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return pu.Scheme + "://" + pu.Host
+}
+
+// needsSignature reports whether req goes to the host of a repo that
+// requires registration.
+func needsSignature(req *http.Request) bool {
+	host := req.URL.Scheme + "://" + req.URL.Host
+	for repo := range registered {
+		mirrorsMu.Lock()
+		urls := append([]string{repo}, mirrors[repo]...)
+		mirrorsMu.Unlock()
+		for _, u := range urls {
+			if hostOf(u) == host {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SignRequest signs req if it goes to a repo that requires registration.
+func SignRequest(req *http.Request) error {
+	registerMu.Lock()
+	defer registerMu.Unlock()
+	if signer == nil || !needsSignature(req) {
+		return nil
+	}
+	return signer.Sign(req)
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"net/http"
+	"testing"
+)
+
+type fakeSigner struct{}
+
+func (fakeSigner) Sign(req *http.Request) error {
+	req.Header.Set("Signed", "yes")
+	return nil
+}
+
+func TestSignRequest(t *testing.T) {
+	const repo = "https://private.example.com/repo"
+	defer SetSigner(nil)
+	defer SetRegistered(repo, false)
+	defer SetMirrors(repo, nil)
+	SetSigner(fakeSigner{})
+	SetRegistered(repo, true)
+	SetMirrors(repo, []string{"https://mirror.example.com/repo"})
+
+	for _, tc := range []struct {
+		url  string
+		want bool
+	}{
+		{repo + "/index.gz", true},
+		{"https://private.example.com/packages/foo.noarch.1.0.0@1.goo", true},
+		{"https://mirror.example.com/repo/index.gz", true},
+		{"https://public.example.com/repo/index.gz", false},
+		{"http://private.example.com/repo/index.gz", false},
+	} {
+		req, err := http.NewRequest(http.MethodGet, tc.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := SignRequest(req); err != nil {
+			t.Fatalf("SignRequest(%s): %v", tc.url, err)
+		}
+		if got := req.Header.Get("Signed") != ""; got != tc.want {
+			t.Errorf("SignRequest(%s) signed: %v, want %v", tc.url, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	yaml "github.com/cloudfoundry-incubator/candiedyaml"
+	"github.com/google/logger"
+)
+
+// RepoEntry is a repo listed in a repo file. Mirrors are other base URLs
+// serving the same packages, tried in order when URL fails. Updates take
+// packages from the repos of highest Priority that have them, 0 means
+// DefaultPriority. Group labels repos that are toggled together, and disabled
+// repos are kept in their file but not used.
+type RepoEntry struct {
+	Name, URL string
+	Mirrors   []string `yaml:",omitempty"`
+	Priority  int      `yaml:",omitempty"`
+	Group     string   `yaml:",omitempty"`
+	Disabled  bool     `yaml:",omitempty"`
+	// Register signs requests to the repo with the machine identity, for
+	// repos that only serve registered machines.
+	Register bool `yaml:",omitempty"`
+}
+
+// RepoFile is a .repo file listing repos, Path is empty for files with no
+// YAML content.
+type RepoFile struct {
+	Path    string
+	Entries []RepoEntry
+}
+
+// WriteRepoFile writes rf to rf.Path.
+func WriteRepoFile(rf RepoFile) error {
+	d, err := yaml.Marshal(rf.Entries)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(rf.Path, d, 0664)
+}
+
+// UnmarshalRepoFile reads the repo file p.
+func UnmarshalRepoFile(p string) (RepoFile, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return RepoFile{}, err
+	}
+
+	// Don't try to unmarshal files with no YAML content
+	var yml bool
+	lns := strings.Split(string(b), "\n")
+	for _, ln := range lns {
+		ln = strings.TrimSpace(ln)
+		if !strings.HasPrefix(ln, "#") && ln != "" {
+			yml = true
+			break
+		}
+	}
+	if !yml {
+		return RepoFile{}, nil
+	}
+
+	// Both RepoEntry and []RepoEntry are valid for backwards compatibilty.
+	var re RepoEntry
+	if err := yaml.Unmarshal(b, &re); err == nil && re.URL != "" {
+		return RepoFile{Path: p, Entries: []RepoEntry{re}}, nil
+	}
+
+	var res []RepoEntry
+	if err := yaml.Unmarshal(b, &res); err != nil {
+		return RepoFile{}, err
+	}
+	return RepoFile{Path: p, Entries: res}, nil
+}
+
+// RepoFiles reads the .repo files in dir, files that cannot be read are
+// logged and skipped.
+func RepoFiles(dir string) ([]RepoFile, error) {
+	fl, err := filepath.Glob(filepath.Join(dir, "*.repo"))
+	if err != nil {
+		return nil, err
+	}
+	var rfs []RepoFile
+	for _, f := range fl {
+		rf, err := UnmarshalRepoFile(f)
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+		if rf.Path != "" {
+			rfs = append(rfs, rf)
+		}
+	}
+	return rfs, nil
+}
+
+// RepoList returns the URLs of the enabled repos listed in the .repo files
+// in dir and sets their mirrors, priorities and whether they require
+// registration.
+func RepoList(dir string) ([]string, error) {
+	rfs, err := RepoFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	var rl []string
+	for _, rf := range rfs {
+		for _, re := range rf.Entries {
+			if re.Disabled {
+				continue
+			}
+			rl = append(rl, re.URL)
+			SetMirrors(re.URL, re.Mirrors)
+			SetPriority(re.URL, re.Priority)
+			SetRegistered(re.URL, re.Register)
+		}
+	}
+	return rl, nil
+}
+
+// EnableRepos enables or disables the repos in the .repo files in dir named
+// name or in group name, ignoring case, and returns the entries it changed.
+// It is an error if no repo has that name or group.
+func EnableRepos(dir, name string, enable bool) ([]RepoEntry, error) {
+	rfs, err := RepoFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	var found bool
+	var changed []RepoEntry
+	for _, rf := range rfs {
+		var dirty bool
+		for i, re := range rf.Entries {
+			if !strings.EqualFold(re.Name, name) && !strings.EqualFold(re.Group, name) {
+				continue
+			}
+			found = true
+			if re.Disabled != enable {
+				continue
+			}
+			rf.Entries[i].Disabled = !enable
+			changed = append(changed, rf.Entries[i])
+			dirty = true
+		}
+		if !dirty {
+			continue
+		}
+		if err := WriteRepoFile(rf); err != nil {
+			return changed, err
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no repo or repo group named %q", name)
+	}
+	return changed, nil
+}
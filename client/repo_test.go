@@ -0,0 +1,131 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/googet/oswrap"
+)
+
+func TestRepoList(t *testing.T) {
+	testRepo := "https://foo.com/googet/bar"
+
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+
+	testFile := filepath.Join(tempDir, "test.repo")
+
+	repoTests := []struct {
+		content []byte
+		result  []string
+	}{
+		{[]byte("\n"), nil},
+		{[]byte("# This is just a comment"), nil},
+		{[]byte("url: " + testRepo), []string{testRepo}},
+		{[]byte("\n # Comment\nurl: " + testRepo), []string{testRepo}},
+		{[]byte("- url: " + testRepo), []string{testRepo}},
+		{[]byte("- url: " + testRepo + "\n\n- url: " + testRepo), []string{testRepo, testRepo}},
+		{[]byte("- url: " + testRepo + "\n  disabled: true\n- url: " + testRepo), []string{testRepo}},
+	}
+
+	for _, tt := range repoTests {
+		if err := ioutil.WriteFile(testFile, tt.content, 0660); err != nil {
+			t.Fatalf("error writing repo: %v", err)
+		}
+		got, err := RepoList(tempDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.result) {
+			t.Errorf("returned repo does not match expected repo: got %v, want %v", got, testRepo)
+		}
+	}
+}
+
+func TestWriteRepoFile(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+
+	want := RepoFile{
+		Path:    filepath.Join(tempDir, "test.repo"),
+		Entries: []RepoEntry{{Name: "foo", URL: "https://foo.com/googet/foo", Mirrors: []string{"https://mirror.com/googet/foo"}}, {Name: "bar", URL: "https://foo.com/googet/bar", Group: "canary", Disabled: true}},
+	}
+	if err := WriteRepoFile(want); err != nil {
+		t.Fatalf("WriteRepoFile: %v", err)
+	}
+	got, err := UnmarshalRepoFile(want.Path)
+	if err != nil {
+		t.Fatalf("UnmarshalRepoFile: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("UnmarshalRepoFile() = %+v, want %+v", got, want)
+	}
+}
+
+func TestEnableRepos(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+
+	rf := RepoFile{
+		Path: filepath.Join(tempDir, "test.repo"),
+		Entries: []RepoEntry{
+			{Name: "stable", URL: "https://foo.com/googet/stable"},
+			{Name: "canary", URL: "https://foo.com/googet/canary", Group: "rollout", Disabled: true},
+			{Name: "rollback", URL: "https://foo.com/googet/rollback", Group: "rollout", Disabled: true},
+		},
+	}
+	if err := WriteRepoFile(rf); err != nil {
+		t.Fatalf("WriteRepoFile: %v", err)
+	}
+
+	changed, err := EnableRepos(tempDir, "Rollout", true)
+	if err != nil {
+		t.Fatalf("EnableRepos: %v", err)
+	}
+	if len(changed) != 2 {
+		t.Errorf("EnableRepos(rollout) changed %d repos, want 2", len(changed))
+	}
+	if _, err := EnableRepos(tempDir, "stable", false); err != nil {
+		t.Fatalf("EnableRepos: %v", err)
+	}
+	// Enabling an enabled repo changes nothing.
+	if changed, err := EnableRepos(tempDir, "canary", true); err != nil || len(changed) != 0 {
+		t.Errorf("EnableRepos(canary) = %v, %v, want no changes", changed, err)
+	}
+	if _, err := EnableRepos(tempDir, "missing", true); err == nil {
+		t.Error("EnableRepos of a missing repo did not return an error")
+	}
+
+	got, err := RepoList(tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://foo.com/googet/canary", "https://foo.com/googet/rollback"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RepoList() = %v, want %v", got, want)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -31,14 +32,186 @@ import (
 	humanize "github.com/dustin/go-humanize"
 	"github.com/google/googet/client"
 	"github.com/google/googet/goolib"
+	"github.com/google/googet/msg"
 	"github.com/google/googet/oswrap"
 	"github.com/google/logger"
 )
 
+// SizeError is returned when a download does not have the size recorded in
+// the repo spec. A short download was truncated, while a Content-Length from
+// the server that does not match usually means the wrong file is served.
+type SizeError struct {
+	Want, Got int64
+	// ContentLength is set when the mismatch is in the size reported by the
+	// server rather than in the bytes received.
+	ContentLength bool
+}
+
+func (e *SizeError) Error() string {
+	switch {
+	case e.ContentLength:
+		return fmt.Sprintf("server reported a size of %d bytes but the repo spec says %d, the wrong file may be served", e.Got, e.Want)
+	case e.Got < e.Want:
+		return fmt.Sprintf("download truncated, received %d of %d bytes", e.Got, e.Want)
+	default:
+		return fmt.Sprintf("received %d bytes but the repo spec says %d", e.Got, e.Want)
+	}
+}
+
+// ChecksumError is returned when a downloaded file, of the expected size if
+// it is known, does not have the expected checksum, meaning it is corrupt.
+type ChecksumError struct {
+	Want, Got string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum of downloaded file %s does not match expected checksum %s", e.Got, e.Want)
+}
+
+// StatusError is returned when the server answers a download with a status
+// other than 200 OK.
+type StatusError struct {
+	URL, Status string
+	Code        int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("GET %s returned status: %q", e.URL, e.Status)
+}
+
+// Transient reports whether err, returned by Package or FromRepo, may go
+// away when the download is retried: network errors, server errors and
+// truncated downloads.
+func Transient(err error) bool {
+	switch e := err.(type) {
+	case net.Error:
+		return true
+	case *StatusError:
+		return e.Code >= 500 || e.Code == http.StatusTooManyRequests
+	case *SizeError:
+		return !e.ContentLength && e.Got < e.Want
+	}
+	return false
+}
+
+// Limits caps what extracting a single package may write, so a malicious
+// package cannot fill the disk. A value of 0 means no limit.
+type Limits struct {
+	// MaxBytes is the total size of all extracted files.
+	MaxBytes int64
+	// MaxFiles is the number of extracted files and directories.
+	MaxFiles int64
+	// MaxFileSize is the size of any single extracted file.
+	MaxFileSize int64
+	// MaxDepth is the number of path elements in an entry name.
+	MaxDepth int
+}
+
+// DefaultLimits are the extraction limits used unless SetLimits is called,
+// they are far above what any real package needs.
+var DefaultLimits = Limits{
+	MaxBytes:    64 << 30,
+	MaxFiles:    1000000,
+	MaxFileSize: 16 << 30,
+	MaxDepth:    64,
+}
+
+var limits = DefaultLimits
+
+// SetLimits sets the limits enforced when extracting packages.
+func SetLimits(l Limits) {
+	limits = l
+}
+
+// LimitError is returned when extracting a package would exceed one of the
+// extraction limits.
+type LimitError struct {
+	// Limit is the name of the exceeded limit.
+	Limit string
+	Max   int64
+	// Entry is the package entry being extracted when the limit was hit.
+	Entry string
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("package entry %q exceeds the extraction limit %s of %d", e.Entry, e.Limit, e.Max)
+}
+
+var entitlements map[string]string
+
+// SetEntitlements sets the tokens, by entitlement name, sent with downloads
+// of restricted packages.
+func SetEntitlements(m map[string]string) {
+	entitlements = m
+}
+
+// EntitlementError is returned when a restricted package is downloaded
+// without a token for its entitlement, or the repo refuses the token.
+type EntitlementError struct {
+	Package, Entitlement string
+	// Refused is set when a token was sent but the repo refused it.
+	Refused bool
+}
+
+func (e *EntitlementError) Error() string {
+	if e.Refused {
+		return fmt.Sprintf("not entitled to %s: the repo refused the token for entitlement %q", e.Package, e.Entitlement)
+	}
+	return fmt.Sprintf("not entitled to %s: it requires entitlement %q and no token for it is configured", e.Package, e.Entitlement)
+}
+
 // Package downloads a package from the given url,
-// if a SHA256 checksum is provided it will be checked.
-func Package(pkgURL, dst, chksum string, proxyServer string) error {
-	httpClient := &http.Client{}
+// if a SHA256 checksum is provided it will be checked, as will the size if it
+// is greater than 0. Download progress is reported to rp.
+func Package(pkgURL, dst, chksum string, size int64, proxyServer string, rp msg.Reporter) error {
+	return get(pkgURL, dst, chksum, size, proxyServer, nil, rp)
+}
+
+// PackageOf downloads the package described by ps like Package, sending the
+// token of its entitlement if the package is restricted.
+func PackageOf(ps *goolib.PkgSpec, pkgURL, dst, chksum string, size int64, proxyServer string, rp msg.Reporter) error {
+	ent := ps.EntitlementName()
+	if ent == "" {
+		return Package(pkgURL, dst, chksum, size, proxyServer, rp)
+	}
+	pn := fmt.Sprintf("%s.%s.%s", ps.Name, ps.Arch, ps.Version)
+	tok, ok := entitlements[ent]
+	if !ok {
+		return &EntitlementError{Package: pn, Entitlement: ent}
+	}
+	// The token is a secret, it is only sent over HTTPS.
+	if u, err := url.Parse(pkgURL); err != nil {
+		return err
+	} else if u.Scheme != "https" {
+		return fmt.Errorf("refusing to send the token for entitlement %q to %q, restricted packages must be downloaded over https", ent, pkgURL)
+	}
+	err := get(pkgURL, dst, chksum, size, proxyServer, http.Header{goolib.EntitlementHeader: {tok}}, rp)
+	if se, ok := err.(*StatusError); ok && (se.Code == http.StatusUnauthorized || se.Code == http.StatusForbidden) {
+		return &EntitlementError{Package: pn, Entitlement: ent, Refused: true}
+	}
+	return err
+}
+
+// transport is used for downloads without a proxy, tests replace it to trust
+// their TLS servers.
+var transport = http.DefaultTransport
+
+// get downloads a package like Package, adding header to the request. header
+// is only sent to the host of pkgURL over HTTPS, it is dropped from
+// redirects to another host or to plain HTTP.
+func get(pkgURL, dst, chksum string, size int64, proxyServer string, header http.Header, rp msg.Reporter) error {
+	httpClient := &http.Client{Transport: transport}
+	httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if req.URL.Host != via[0].URL.Host || req.URL.Scheme != "https" {
+			for k := range header {
+				delete(req.Header, k)
+			}
+		}
+		return nil
+	}
 	if proxyServer != "" {
 		proxyURL, err := url.Parse(proxyServer)
 		if err != nil {
@@ -46,31 +219,73 @@ func Package(pkgURL, dst, chksum string, proxyServer string) error {
 		}
 		httpClient.Transport = &http.Transport{Proxy: http.ProxyURL(proxyURL)}
 	}
-	resp, err := httpClient.Get(pkgURL)
+	req, err := http.NewRequest(http.MethodGet, pkgURL, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if err := client.SignRequest(req); err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{URL: pkgURL, Status: resp.Status, Code: resp.StatusCode}
+	}
+	if size > 0 && resp.ContentLength >= 0 && resp.ContentLength != size {
+		return &SizeError{Want: size, Got: resp.ContentLength, ContentLength: true}
+	}
 	logger.Infof("Downloading %q", pkgURL)
 	if err := oswrap.RemoveAll(dst); err != nil {
 		return err
 	}
-	if err := download(resp.Body, dst, chksum, proxyServer); err != nil {
+	total := size
+	if total <= 0 && resp.ContentLength > 0 {
+		total = resp.ContentLength
+	}
+	pr := &progress{name: filepath.Base(dst), total: total, rp: rp}
+	if err := download(io.TeeReader(resp.Body, pr), dst, chksum, size, proxyServer); err != nil {
 		return err
 	}
 	return nil
 }
 
-// FromRepo downloads a package from a repo.
-func FromRepo(rs goolib.RepoSpec, repo, dir string, proxyServer string) (string, error) {
-	pkgURL := strings.TrimSuffix(repo, filepath.Base(repo)) + rs.Source
+// Stream writes the package read from r to dst, checking its SHA256
+// checksum if one is provided.
+func Stream(r io.Reader, dst, chksum string) error {
+	return download(r, dst, chksum, 0, "")
+}
+
+// FromRepo downloads a package from a repo, failing over to the mirrors of
+// the repo on errors.
+func FromRepo(rs goolib.RepoSpec, repo, dir string, proxyServer string, rp msg.Reporter) (string, error) {
 	pn := goolib.PackageInfo{rs.PackageSpec.Name, rs.PackageSpec.Arch, rs.PackageSpec.Version}.PkgName()
 	dst := filepath.Join(dir, filepath.Base(pn))
-	return dst, Package(pkgURL, dst, rs.Checksum, proxyServer)
+	var err error
+	for _, u := range client.Candidates(repo) {
+		pkgURL := strings.TrimSuffix(u, filepath.Base(u)) + rs.Source
+		err = PackageOf(rs.PackageSpec, pkgURL, dst, rs.Checksum, rs.Size, proxyServer, rp)
+		if _, ok := err.(*EntitlementError); ok {
+			// Entitlement is up to the repo, not the mirror that was
+			// asked, so neither blame it nor try the others.
+			return dst, err
+		}
+		client.Report(u, err)
+		if err == nil {
+			return dst, nil
+		}
+		logger.Infof("Error downloading %s from %s: %v", pn, u, err)
+	}
+	return dst, err
 }
 
 // Latest downloads the latest available version of a package.
-func Latest(name, dir string, rm client.RepoMap, archs []string, proxyServer string) (string, error) {
+func Latest(name, dir string, rm client.RepoMap, archs []string, proxyServer string, rp msg.Reporter) (string, error) {
 	ver, repo, arch, err := client.FindRepoLatest(goolib.PackageInfo{name, "", ""}, rm, archs)
 	if err != nil {
 		return "", err
@@ -79,10 +294,24 @@ func Latest(name, dir string, rm client.RepoMap, archs []string, proxyServer str
 	if err != nil {
 		return "", err
 	}
-	return FromRepo(rs, repo, dir, proxyServer)
+	return FromRepo(rs, repo, dir, proxyServer, rp)
+}
+
+// progress is a writer counting the bytes of a download written through it
+// and reporting them.
+type progress struct {
+	name        string
+	done, total int64
+	rp          msg.Reporter
 }
 
-func download(r io.Reader, p, chksum string, proxyServer string) (err error) {
+func (p *progress) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+	p.rp.Progress(p.name, p.done, p.total)
+	return len(b), nil
+}
+
+func download(r io.Reader, p, chksum string, size int64, proxyServer string) (err error) {
 	f, err := oswrap.Create(p)
 	if err != nil {
 		return err
@@ -103,8 +332,11 @@ func download(r io.Reader, p, chksum string, proxyServer string) (err error) {
 
 	logger.Infof("Successfully downloaded %s", humanize.IBytes(uint64(b)))
 
-	if chksum != "" && hex.EncodeToString(hash.Sum(nil)) != chksum {
-		return errors.New("checksum of downloaded file does not match expected checksum")
+	if size > 0 && b != size {
+		return &SizeError{Want: size, Got: b}
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); chksum != "" && got != chksum {
+		return &ChecksumError{Want: chksum, Got: got}
 	}
 	return nil
 }
@@ -117,51 +349,197 @@ func ExtractPkg(src string) (dst string, err error) {
 		return "", err
 	}
 	logger.Infof("Extracting %q to %q", src, dst)
+	if _, err := extract(src, dst, nil); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
 
+// ExtractFile extracts the single file name, a path relative to the package
+// root, from the package src into the directory dst.
+func ExtractFile(src, dst, name string) error {
+	logger.Infof("Extracting %q from %q to %q", name, src, dst)
+	want := filepath.ToSlash(filepath.Clean(name))
+	n, err := extract(src, dst, func(h string) bool {
+		return filepath.ToSlash(filepath.Clean(h)) == want
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%q not found in package %q", name, src)
+	}
+	return nil
+}
+
+// extract writes the entries of the package src for which match returns
+// true, or all entries if match is nil, under dst and returns the number of
+// files written.
+func extract(src, dst string, match func(string) bool) (int, error) {
 	f, err := oswrap.Open(src)
 	if err != nil {
-		return "", fmt.Errorf("error reading zip package: %v", err)
+		return 0, fmt.Errorf("error reading zip package: %v", err)
 	}
 	defer f.Close()
 
 	gr, err := gzip.NewReader(f)
 	if err != nil {
-		if !os.IsExist(err) {
-			return "", err
-		}
+		return 0, fmt.Errorf("error decompressing package: %v", err)
 	}
 	tr := tar.NewReader(gr)
 
+	var n int
+	var entries, total int64
 	for {
 		header, err := tr.Next()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return "", fmt.Errorf("error opening file: %v", err)
+			return n, fmt.Errorf("error opening file: %v", err)
+		}
+		if match != nil && !match(header.Name) {
+			continue
 		}
 
-		path := filepath.Join(dst, header.Name)
+		path, err := entryPath(dst, header.Name)
+		if err != nil {
+			return n, err
+		}
+		entries++
+		if limits.MaxFiles > 0 && entries > limits.MaxFiles {
+			return n, &LimitError{Limit: "MaxFiles", Max: limits.MaxFiles, Entry: header.Name}
+		}
+		if d := strings.Count(filepath.ToSlash(filepath.Clean(header.Name)), "/") + 1; limits.MaxDepth > 0 && d > limits.MaxDepth {
+			return n, &LimitError{Limit: "MaxDepth", Max: int64(limits.MaxDepth), Entry: header.Name}
+		}
+		switch header.Typeflag {
+		case tar.TypeSymlink:
+			// goopack records links with -links=record, they are
+			// recreated as long as they stay inside dst.
+			if err := checkLink(dst, header); err != nil {
+				return n, err
+			}
+			if err := extractLink(dst, path, header); err != nil {
+				return n, err
+			}
+			n++
+			continue
+		case tar.TypeLink:
+			// goopack never writes hard links, so a package holding one
+			// was not built by it.
+			if err := checkLink(dst, header); err != nil {
+				return n, err
+			}
+			logger.Warningf("Not extracting link %q to %q", header.Name, header.Linkname)
+			continue
+		}
+		if !header.FileInfo().IsDir() && !header.FileInfo().Mode().IsRegular() {
+			logger.Warningf("Not extracting %q, it is not a file or directory", header.Name)
+			continue
+		}
+		// A directory in dst may already be a link or junction, for example
+		// one left in the cache, so check where path actually leads.
+		if ok, err := goolib.ResolvesWithin(dst, path); err != nil {
+			return n, err
+		} else if !ok {
+			return n, fmt.Errorf("package entry %q resolves to outside the extraction directory", header.Name)
+		}
 		if header.FileInfo().IsDir() {
 			if err := oswrap.MkdirAll(path, 0755); err != nil {
-				return "", err
+				return n, err
 			}
 			continue
 		}
+		// The tar reader returns exactly header.Size bytes for an entry, so
+		// the limits can be checked before anything is written.
+		if limits.MaxFileSize > 0 && header.Size > limits.MaxFileSize {
+			return n, &LimitError{Limit: "MaxFileSize", Max: limits.MaxFileSize, Entry: header.Name}
+		}
+		total += header.Size
+		if limits.MaxBytes > 0 && total > limits.MaxBytes {
+			return n, &LimitError{Limit: "MaxBytes", Max: limits.MaxBytes, Entry: header.Name}
+		}
 		if err := oswrap.MkdirAll(filepath.Dir(path), 0755); err != nil {
-			return "", err
+			return n, err
 		}
-		f, err := oswrap.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, os.FileMode(header.Mode))
+		f, err := oswrap.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, os.FileMode(header.Mode).Perm())
 		if err != nil {
-			return "", err
+			return n, err
 		}
 		if _, err := io.Copy(f, tr); err != nil {
 			f.Close()
-			return "", err
+			return n, err
 		}
 		if err := f.Close(); err != nil {
-			return "", err
+			return n, err
 		}
+		n++
 	}
-	return dst, nil
+	return n, nil
+}
+
+// checkLink returns an error if the link entry h points outside dst.
+// Symlink targets are relative to the link, hard link targets to the root
+// of the archive.
+func checkLink(dst string, h *tar.Header) error {
+	target := h.Linkname
+	if h.Typeflag == tar.TypeSymlink {
+		if filepath.IsAbs(target) || filepath.VolumeName(target) != "" || strings.HasPrefix(filepath.ToSlash(target), "/") {
+			return fmt.Errorf("package entry %q links to %q, outside the extraction directory", h.Name, h.Linkname)
+		}
+		target = filepath.Join(filepath.Dir(h.Name), target)
+	}
+	if _, err := entryPath(dst, target); err != nil {
+		return fmt.Errorf("package entry %q links to %q, outside the extraction directory", h.Name, h.Linkname)
+	}
+	return nil
+}
+
+// extractLink creates the symlink entry h at path. Its target has to be a
+// clean relative path, and where it leads is checked once the directory
+// holding the link is resolved, since that may itself be reached through a
+// link extracted before.
+func extractLink(dst, path string, h *tar.Header) error {
+	target := filepath.FromSlash(h.Linkname)
+	if filepath.Clean(target) != target {
+		return fmt.Errorf("package entry %q links to %q, which is not a clean path", h.Name, h.Linkname)
+	}
+	dir := filepath.Dir(path)
+	if ok, err := goolib.ResolvesWithin(dst, dir); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("package entry %q resolves to outside the extraction directory", h.Name)
+	}
+	if err := oswrap.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if ok, err := goolib.ResolvesWithin(dst, filepath.Join(real, target)); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("package entry %q links to %q, outside the extraction directory", h.Name, h.Linkname)
+	}
+	if err := oswrap.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return oswrap.Symlink(target, path)
+}
+
+// entryPath returns the path the archive entry name is extracted to under
+// dst. Packages come from repos we do not control, so names that are
+// absolute or climb out of dst are refused.
+func entryPath(dst, name string) (string, error) {
+	if name == "" || filepath.IsAbs(name) || filepath.VolumeName(name) != "" || strings.HasPrefix(filepath.ToSlash(name), "/") {
+		return "", fmt.Errorf("package entry %q is not a relative path", name)
+	}
+	path := filepath.Join(dst, name)
+	rel, err := filepath.Rel(dst, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("package entry %q escapes the extraction directory", name)
+	}
+	return path, nil
 }
@@ -17,13 +17,18 @@ import (
 	"archive/tar"
 	"bytes"
 	"compress/gzip"
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"path"
 	"path/filepath"
 	"testing"
 
 	"github.com/google/googet/goolib"
+	"github.com/google/googet/msg"
 	"github.com/google/googet/oswrap"
+	"github.com/google/googet/testutil"
 	"github.com/google/logger"
 )
 
@@ -44,50 +49,198 @@ func TestDownload(t *testing.T) {
 		t.Errorf("error seeking to front of reader: %v", err)
 	}
 	tempFile := path.Join(tempDir, "test")
-	if err := download(r, tempFile, chksum, ""); err != nil {
+	if err := download(r, tempFile, chksum, 0, ""); err != nil {
 		t.Errorf("error downloading and checking checksum: %v", err)
 	}
-	if err := download(r, tempFile, "notachecksum", ""); err == nil {
+	if err := download(r, tempFile, "notachecksum", 0, ""); err == nil {
 		t.Error("wanted but did not recieve checksum error")
 	}
 }
 
-func TestExtractPkg(t *testing.T) {
+func TestDownloadSize(t *testing.T) {
 	tempDir, err := ioutil.TempDir("", "")
 	if err != nil {
 		t.Fatalf("error creating temp directory: %v", err)
 	}
 	defer oswrap.RemoveAll(tempDir)
-	tempFile := filepath.Join(tempDir, "test.pkg")
-	f, err := oswrap.Create(tempFile)
+	tempFile := path.Join(tempDir, "test")
+
+	content := []byte("some content")
+	chksum := goolib.Checksum(bytes.NewReader(content))
+	for _, tt := range []struct {
+		size   int64
+		chksum string
+		want   error
+	}{
+		{int64(len(content)), chksum, nil},
+		{int64(len(content)) + 1, chksum, &SizeError{Want: int64(len(content)) + 1, Got: int64(len(content))}},
+		{int64(len(content)) - 1, chksum, &SizeError{Want: int64(len(content)) - 1, Got: int64(len(content))}},
+		{int64(len(content)), "notachecksum", &ChecksumError{Want: "notachecksum", Got: chksum}},
+	} {
+		err := download(bytes.NewReader(content), tempFile, tt.chksum, tt.size, "")
+		if fmt.Sprint(err) != fmt.Sprint(tt.want) {
+			t.Errorf("download(size %d, checksum %q) = %v, want %v", tt.size, tt.chksum, err, tt.want)
+		}
+	}
+}
+
+func TestPackageContentLength(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
 	if err != nil {
-		t.Fatalf("error creating temp file: %v", err)
+		t.Fatalf("error creating temp directory: %v", err)
 	}
-	gw := gzip.NewWriter(f)
-	tw := tar.NewWriter(gw)
+	defer oswrap.RemoveAll(tempDir)
+	tempFile := path.Join(tempDir, "test")
 
-	name := "test"
-	body := "this is a test file"
-	if err := tw.WriteHeader(&tar.Header{
-		Name: name,
-		Mode: 0600,
-		Size: int64(len(body)),
-	}); err != nil {
-		t.Fatal(err)
+	content := "some content"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, content)
+	}))
+	defer ts.Close()
+
+	chksum := goolib.Checksum(bytes.NewReader([]byte(content)))
+	if err := Package(ts.URL, tempFile, chksum, int64(len(content)), "", msg.Discard); err != nil {
+		t.Errorf("error downloading package: %v", err)
 	}
-	if _, err := tw.Write([]byte(body)); err != nil {
-		t.Fatalf("error writing file: %v", err)
+	err = Package(ts.URL, tempFile, chksum, 100, "", msg.Discard)
+	se, ok := err.(*SizeError)
+	if !ok || !se.ContentLength {
+		t.Errorf("Package with wrong size returned %v, want Content-Length SizeError", err)
 	}
+}
 
-	if err := tw.Close(); err != nil {
-		t.Fatalf("error closing tar: %v", err)
+func TestTransient(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
 	}
-	if err := gw.Close(); err != nil {
-		t.Fatalf("error closing gzip: %v", err)
+	defer oswrap.RemoveAll(tempDir)
+	tempFile := path.Join(tempDir, "test")
+
+	code := http.StatusServiceUnavailable
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}))
+	defer ts.Close()
+
+	if err := Package(ts.URL, tempFile, "", 0, "", msg.Discard); !Transient(err) {
+		t.Errorf("Package from an unavailable server returned %v, want a transient error", err)
+	}
+	code = http.StatusNotFound
+	if err := Package(ts.URL, tempFile, "", 0, "", msg.Discard); err == nil || Transient(err) {
+		t.Errorf("Package of a missing file returned %v, want a permanent error", err)
+	}
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{&SizeError{Want: 10, Got: 5}, true},
+		{&SizeError{Want: 10, Got: 5, ContentLength: true}, false},
+		{&ChecksumError{Want: "a", Got: "b"}, false},
+		{fmt.Errorf("other"), false},
+	} {
+		if got := Transient(tt.err); got != tt.want {
+			t.Errorf("Transient(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestPackageOfRestricted(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+	tempFile := path.Join(tempDir, "test")
+
+	content := "some content"
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tok := r.Header.Get(goolib.EntitlementHeader); tok != "" && tok != "good" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, content)
+	}))
+	defer ts.Close()
+	defer SetEntitlements(nil)
+	transport = ts.Client().Transport
+	defer func() { transport = http.DefaultTransport }()
+
+	ps := &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "1.0.0@1", Restricted: true, Entitlement: "pro"}
+	for _, tt := range []struct {
+		ents map[string]string
+		want error
+	}{
+		{nil, &EntitlementError{Package: "foo.noarch.1.0.0@1", Entitlement: "pro"}},
+		{map[string]string{"foo": "good"}, &EntitlementError{Package: "foo.noarch.1.0.0@1", Entitlement: "pro"}},
+		{map[string]string{"pro": "bad"}, &EntitlementError{Package: "foo.noarch.1.0.0@1", Entitlement: "pro", Refused: true}},
+		{map[string]string{"pro": "good"}, nil},
+	} {
+		SetEntitlements(tt.ents)
+		err := PackageOf(ps, ts.URL, tempFile, "", 0, "", msg.Discard)
+		if fmt.Sprint(err) != fmt.Sprint(tt.want) {
+			t.Errorf("PackageOf with entitlements %v = %v, want %v", tt.ents, err, tt.want)
+		}
+	}
+
+	// Packages that are not restricted are downloaded without a token.
+	SetEntitlements(map[string]string{"pro": "bad"})
+	ps.Restricted, ps.Entitlement = false, ""
+	if err := PackageOf(ps, ts.URL, tempFile, "", 0, "", msg.Discard); err != nil {
+		t.Errorf("PackageOf of an unrestricted package: %v", err)
+	}
+}
+
+func TestPackageOfTokenExposure(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+	tempFile := path.Join(tempDir, "test")
+
+	var leaked string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = r.Header.Get(goolib.EntitlementHeader)
+		fmt.Fprint(w, "some content")
+	}))
+	defer other.Close()
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, other.URL, http.StatusFound)
+	}))
+	defer ts.Close()
+	transport = ts.Client().Transport
+	defer func() { transport = http.DefaultTransport }()
+	SetEntitlements(map[string]string{"pro": "good"})
+	defer SetEntitlements(nil)
+
+	ps := &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "1.0.0@1", Restricted: true, Entitlement: "pro"}
+	if err := PackageOf(ps, other.URL, tempFile, "", 0, "", msg.Discard); err == nil {
+		t.Error("PackageOf over http did not return an error")
+	}
+	if leaked != "" {
+		t.Errorf("token sent over http: %q", leaked)
+	}
+
+	// A redirect to another host does not carry the token.
+	if err := PackageOf(ps, ts.URL, tempFile, "", 0, "", msg.Discard); err != nil {
+		t.Fatalf("PackageOf redirected: %v", err)
 	}
-	if err := f.Close(); err != nil {
-		t.Fatalf("error closing file: %v", err)
+	if leaked != "" {
+		t.Errorf("token sent to the redirected host: %q", leaked)
 	}
+}
+
+func TestExtractPkg(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+	tempFile := filepath.Join(tempDir, "test.pkg")
+	name := "test"
+	body := "this is a test file"
+	testutil.WriteGoo(t, tempFile, nil, map[string]string{name: body})
 
 	dst, err := ExtractPkg(tempFile)
 	if err != nil {
@@ -102,3 +255,207 @@ func TestExtractPkg(t *testing.T) {
 		t.Errorf("contents of extracted file does not match expected contents: got: %q, want: %q", string(cts), body)
 	}
 }
+
+func TestExtractFile(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+
+	tempFile := filepath.Join(tempDir, "test.pkg")
+	files := map[string]string{
+		"install.ps1":          "install",
+		"scripts/uninstall.sh": "uninstall",
+		"big.bin":              "lots of data",
+	}
+	testutil.WriteGoo(t, tempFile, nil, files)
+
+	dst := filepath.Join(tempDir, "out")
+	if err := ExtractFile(tempFile, dst, filepath.Join("scripts", "uninstall.sh")); err != nil {
+		t.Fatalf("error running ExtractFile: %v", err)
+	}
+	cts, err := ioutil.ReadFile(filepath.Join(dst, "scripts", "uninstall.sh"))
+	if err != nil {
+		t.Fatalf("error opening extracted file: %v", err)
+	}
+	if string(cts) != "uninstall" {
+		t.Errorf("contents of extracted file does not match expected contents: got: %q, want: %q", string(cts), "uninstall")
+	}
+	for _, n := range []string{"install.ps1", "big.bin"} {
+		if _, err := oswrap.Stat(filepath.Join(dst, n)); err == nil {
+			t.Errorf("%s was extracted but should not have been", n)
+		}
+	}
+
+	if err := ExtractFile(tempFile, dst, "missing.ps1"); err == nil {
+		t.Error("ExtractFile did not return an error for a missing file")
+	}
+}
+
+// tarGz returns a gzipped tar archive holding the given files.
+func tarGz(t testing.TB, files map[string]string) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for n, c := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: n, Mode: 0644, Size: int64(len(c))}); err != nil {
+			t.Fatalf("error writing header: %v", err)
+		}
+		if _, err := tw.Write([]byte(c)); err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("error closing tar writer: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("error closing gzip writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractPkgTraversal(t *testing.T) {
+	for _, name := range []string{"../evil", "a/../../evil", "/evil"} {
+		tempDir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatalf("error creating temp directory: %v", err)
+		}
+		defer oswrap.RemoveAll(tempDir)
+		src := filepath.Join(tempDir, "test.goo")
+		if err := ioutil.WriteFile(src, tarGz(t, map[string]string{name: "evil"}), 0644); err != nil {
+			t.Fatalf("error writing package: %v", err)
+		}
+		if _, err := ExtractPkg(src); err == nil {
+			t.Errorf("ExtractPkg with entry %q did not return an error", name)
+		}
+		if _, err := oswrap.Stat(filepath.Join(tempDir, "evil")); err == nil {
+			t.Errorf("entry %q was written outside the extraction directory", name)
+		}
+	}
+}
+
+func TestExtractPkgLinks(t *testing.T) {
+	table := []struct {
+		hs        []tar.Header
+		err       bool
+		extracted bool
+	}{
+		{[]tar.Header{{Name: "a/link", Typeflag: tar.TypeSymlink, Linkname: "../../evil"}}, true, false},
+		{[]tar.Header{{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"}}, true, false},
+		{[]tar.Header{{Name: "link", Typeflag: tar.TypeLink, Linkname: "../evil"}}, true, false},
+		{[]tar.Header{{Name: "a/link", Typeflag: tar.TypeSymlink, Linkname: "b/../../.."}}, true, false},
+		// a/up leads to the root of the package, so a/up/link climbs out
+		// of it even though its name and target look fine on their own.
+		{[]tar.Header{
+			{Name: "a/up", Typeflag: tar.TypeSymlink, Linkname: ".."},
+			{Name: "a/up/link", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		}, true, false},
+		{[]tar.Header{{Name: "a/link", Typeflag: tar.TypeSymlink, Linkname: "../file"}}, false, true},
+		{[]tar.Header{{Name: "link", Typeflag: tar.TypeLink, Linkname: "file"}}, false, false},
+	}
+	for _, tt := range table {
+		tempDir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatalf("error creating temp directory: %v", err)
+		}
+		defer oswrap.RemoveAll(tempDir)
+
+		buf := new(bytes.Buffer)
+		gw := gzip.NewWriter(buf)
+		tw := tar.NewWriter(gw)
+		for i := range tt.hs {
+			if err := tw.WriteHeader(&tt.hs[i]); err != nil {
+				t.Fatalf("error writing header: %v", err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatalf("error closing tar writer: %v", err)
+		}
+		if err := gw.Close(); err != nil {
+			t.Fatalf("error closing gzip writer: %v", err)
+		}
+		src := filepath.Join(tempDir, "test.goo")
+		if err := ioutil.WriteFile(src, buf.Bytes(), 0644); err != nil {
+			t.Fatalf("error writing package: %v", err)
+		}
+
+		h := tt.hs[len(tt.hs)-1]
+		_, err = ExtractPkg(src)
+		if (err != nil) != tt.err {
+			t.Errorf("ExtractPkg with %s to %q returned %v, want error: %v", h.Name, h.Linkname, err, tt.err)
+		}
+		target, err := oswrap.Readlink(filepath.Join(tempDir, "test", filepath.FromSlash(h.Name)))
+		if (err == nil) != tt.extracted {
+			t.Errorf("link %s to %q extracted: %v, want %v", h.Name, h.Linkname, err == nil, tt.extracted)
+		}
+		if err == nil && filepath.ToSlash(target) != h.Linkname {
+			t.Errorf("link %s points to %q, want %q", h.Name, target, h.Linkname)
+		}
+	}
+}
+
+func FuzzExtractPkg(f *testing.F) {
+	f.Add(tarGz(f, map[string]string{"install.ps1": "install", "dir/file": "data"}))
+	f.Add(tarGz(f, map[string]string{"../evil": "evil"}))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		tempDir := t.TempDir()
+		src := filepath.Join(tempDir, "test.goo")
+		if err := ioutil.WriteFile(src, b, 0644); err != nil {
+			t.Fatalf("error writing package: %v", err)
+		}
+		ExtractPkg(src)
+		fis, err := ioutil.ReadDir(tempDir)
+		if err != nil {
+			t.Fatalf("error reading temp directory: %v", err)
+		}
+		for _, fi := range fis {
+			if fi.Name() != "test.goo" && fi.Name() != "test" {
+				t.Errorf("ExtractPkg wrote %q outside the extraction directory", fi.Name())
+			}
+		}
+	})
+}
+
+func TestExtractPkgLimits(t *testing.T) {
+	defer SetLimits(DefaultLimits)
+	files := map[string]string{
+		"a":     "1234",
+		"b":     "5678",
+		"c/d/e": "9",
+	}
+	table := []struct {
+		limits Limits
+		limit  string
+	}{
+		{Limits{}, ""},
+		{Limits{MaxBytes: 8}, "MaxBytes"},
+		{Limits{MaxFiles: 2}, "MaxFiles"},
+		{Limits{MaxFileSize: 3}, "MaxFileSize"},
+		{Limits{MaxDepth: 2}, "MaxDepth"},
+		{Limits{MaxBytes: 9, MaxFiles: 3, MaxFileSize: 4, MaxDepth: 3}, ""},
+	}
+	for _, tt := range table {
+		tempDir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatalf("error creating temp directory: %v", err)
+		}
+		defer oswrap.RemoveAll(tempDir)
+		src := filepath.Join(tempDir, "test.goo")
+		if err := ioutil.WriteFile(src, tarGz(t, files), 0644); err != nil {
+			t.Fatalf("error writing package: %v", err)
+		}
+
+		SetLimits(tt.limits)
+		_, err = ExtractPkg(src)
+		le, ok := err.(*LimitError)
+		switch {
+		case tt.limit == "" && err != nil:
+			t.Errorf("ExtractPkg with limits %+v returned unexpected error: %v", tt.limits, err)
+		case tt.limit != "" && (!ok || le.Limit != tt.limit):
+			t.Errorf("ExtractPkg with limits %+v returned %v, want %s LimitError", tt.limits, err, tt.limit)
+		}
+	}
+}
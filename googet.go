@@ -16,19 +16,31 @@ limitations under the License.
 package main
 
 import (
-	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	yaml "github.com/cloudfoundry-incubator/candiedyaml"
+	humanize "github.com/dustin/go-humanize"
 	"github.com/google/googet/client"
+	"github.com/google/googet/download"
 	"github.com/google/googet/goolib"
+	"github.com/google/googet/gooroot"
+	"github.com/google/googet/identity"
+	"github.com/google/googet/install"
+	"github.com/google/googet/ipc"
+	"github.com/google/googet/metadata"
+	"github.com/google/googet/msg"
+	"github.com/google/googet/remove"
 	"github.com/google/googet/system"
 	"github.com/google/logger"
 	"github.com/google/subcommands"
@@ -37,14 +49,19 @@ import (
 )
 
 const (
-	stateFile = "googet.state"
+	stateFile = gooroot.StateFile
+	journal   = gooroot.JournalFile
 	confFile  = "googet.conf"
-	logFile   = "googet.log"
-	lockFile  = "googet.lock"
+	lockFile  = gooroot.LockFile
+	sockFile  = "googet.sock"
 	cacheDir  = "cache"
 	repoDir   = "repos"
 	envVar    = "GooGetRoot"
-	logSize   = 10 * 1024 * 1024
+	// healthFile in the cache directory tracks failing repo URLs.
+	healthFile = "repohealth.json"
+	// historyFile records the outcome of update runs, a JSON object per
+	// line.
+	historyFile = "googet.history"
 )
 
 var (
@@ -55,8 +72,20 @@ var (
 	showVer     bool
 	version     string
 	cacheLife   = 3 * time.Minute
+	lockTimeout = 70 * time.Second
 	archs       []string
 	proxyServer string
+	userScope   bool
+	minMetadata bool
+	planJSON    bool
+	msgJSON     bool
+	refresh     bool
+	cachePath   string
+	// reporter shows the messages of install, remove, update and verify.
+	reporter msg.Reporter = msg.NewConsole()
+	// flagDefaults are the default flag values of subcommands set in the
+	// conf file.
+	flagDefaults map[string]map[string]interface{}
 )
 
 type packageMap map[string]string
@@ -71,60 +100,208 @@ func installedPackages(state client.GooGetState) packageMap {
 	return pm
 }
 
-type repoFile struct {
-	fileName    string
-	repoEntries []repoEntry
+type conf struct {
+	Archs        []string
+	CacheLife    string
+	LockTimeout  string
+	ProxyServer  string
+	Interpreters map[string]string
+	Protected    []string
+	// MinimalMetadata only fetches the metadata of the packages a command
+	// needs from repos that support queries.
+	MinimalMetadata bool
+	CacheDir        string
+	InstallRoot     string
+	// Locations overrides the cache directory and install root of
+	// individual packages.
+	Locations map[string]install.Location
+	// HardLink hardlinks installed files to the unpacked package instead of
+	// copying them.
+	HardLink bool
+	// ExtractLimits overrides the limits on what extracting a package may
+	// write.
+	ExtractLimits extractLimits
+	// ScriptContext is the context package scripts run in, "restricted" or
+	// an account name. ScriptContexts overrides it for individual packages.
+	ScriptContext  string
+	ScriptContexts map[string]string
+	// Signature sets the Authenticode checks of package installers.
+	Signature system.SignaturePolicy
+	// Entitlements are the tokens, by entitlement name, sent with downloads
+	// of restricted packages.
+	Entitlements map[string]string
+	// Locale overrides the locale of the system for messages.
+	Locale string
+	// Report uploads the package inventory for fleet reporting.
+	Report reportConf
+	// Identify sets what identifies the client to repos, nothing is sent
+	// by default.
+	Identify identifyConf
+	// MigrateRepos are URL prefixes of repos trusted as replacements of
+	// deprecated repos, repo entries are moved to them automatically.
+	MigrateRepos []string
+	// Confirm sets which changes install, remove and update ask to
+	// confirm: "always", the default, "never", "removals" or "above N" for
+	// changes of more than N packages.
+	Confirm string
+	// LogRetention sets which operation logs are kept.
+	LogRetention logRetention
+	// Defaults are default flag values by subcommand, flags given on the
+	// command line override them.
+	Defaults map[string]map[string]interface{}
 }
 
-type repoEntry struct {
-	Name, URL string
+// identifyConf selects the headers identifying the client that are sent
+// with repo index requests.
+type identifyConf struct {
+	Hostname, MachineID, Version bool
+	Cohorts                      []string
 }
 
-func writeRepoFile(rf repoFile) error {
-	d, err := yaml.Marshal(rf.repoEntries)
-	if err != nil {
-		return err
+// headers returns the request headers ic selects.
+func (ic identifyConf) headers() http.Header {
+	h := make(http.Header)
+	if ic.Hostname {
+		if hn, err := os.Hostname(); err != nil {
+			logger.Errorf("Not sending host name: %v", err)
+		} else {
+			h.Set(client.HeaderHostname, hn)
+		}
+	}
+	if ic.MachineID {
+		if id, err := metadata.MachineID(); err != nil {
+			logger.Errorf("Not sending machine ID: %v", err)
+		} else {
+			h.Set(client.HeaderMachineID, id)
+		}
+	}
+	if ic.Version && version != "" {
+		h.Set(client.HeaderVersion, version)
+	}
+	if len(ic.Cohorts) > 0 {
+		h.Set(client.HeaderCohorts, strings.Join(ic.Cohorts, ","))
 	}
-	return ioutil.WriteFile(rf.fileName, d, 0664)
+	return h
 }
 
-func unmarshalRepoFile(p string) (repoFile, error) {
-	b, err := ioutil.ReadFile(p)
+// extractLimits are the conf file form of download.Limits, sizes are human
+// readable strings such as "4GiB". Unset or 0 values keep the default.
+type extractLimits struct {
+	MaxBytes    string
+	MaxFiles    int64
+	MaxFileSize string
+	MaxDepth    int
+}
+
+// withDefaults returns args, a subcommand and its arguments, with the flags
+// defaults sets for the subcommand inserted before its arguments. Defaults
+// for flags given on the command line are left out, so list flags are not
+// added to. A list value sets the flag once for each item. Flags the
+// subcommand does not have, as told by flags, are logged and skipped.
+func withDefaults(args []string, defaults map[string]map[string]interface{}, flags func(cmd string) *flag.FlagSet) []string {
+	if len(args) == 0 || len(defaults[args[0]]) == 0 {
+		return args
+	}
+	fs := flags(args[0])
+	if fs == nil {
+		logger.Errorf("Ignoring conf defaults for unknown command %q", args[0])
+		return args
+	}
+	set, err := setFlags(fs, args[1:])
 	if err != nil {
-		return repoFile{}, err
+		// The subcommand reports the error when it parses args.
+		return args
 	}
+	var names []string
+	for name := range defaults[args[0]] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-	// Don't try to unmarshal files with no YAML content
-	var yml bool
-	lns := strings.Split(string(b), "\n")
-	for _, ln := range lns {
-		ln = strings.TrimSpace(ln)
-		if !strings.HasPrefix(ln, "#") && ln != "" {
-			yml = true
-			break
+	out := []string{args[0]}
+	for _, name := range names {
+		if fs.Lookup(name) == nil {
+			logger.Errorf("Ignoring conf default for unknown flag %q of %s", name, args[0])
+			continue
+		}
+		if set[name] {
+			continue
+		}
+		vs, ok := defaults[args[0]][name].([]interface{})
+		if !ok {
+			vs = []interface{}{defaults[args[0]][name]}
+		}
+		for _, v := range vs {
+			out = append(out, fmt.Sprintf("-%s=%v", name, v))
 		}
 	}
-	if !yml {
-		return repoFile{}, nil
-	}
+	return append(out, args[1:]...)
+}
 
-	// Both repoFile and []repoFile are valid for backwards compatibilty.
-	var re repoEntry
-	if err := yaml.Unmarshal(b, &re); err == nil && re.URL != "" {
-		return repoFile{fileName: p, repoEntries: []repoEntry{re}}, nil
+// probeValue stands in for a flag value when finding which flags are set,
+// so parsing does not change the subcommand or add to its list flags.
+type probeValue bool
+
+func (probeValue) String() string     { return "" }
+func (probeValue) Set(string) error   { return nil }
+func (b probeValue) IsBoolFlag() bool { return bool(b) }
+
+// setFlags returns the names of the flags of fs that args sets.
+func setFlags(fs *flag.FlagSet, args []string) (map[string]bool, error) {
+	probe := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	probe.SetOutput(ioutil.Discard)
+	fs.VisitAll(func(f *flag.Flag) {
+		bf, ok := f.Value.(interface{ IsBoolFlag() bool })
+		probe.Var(probeValue(ok && bf.IsBoolFlag()), f.Name, f.Usage)
+	})
+	if err := probe.Parse(args); err != nil {
+		return nil, err
 	}
+	set := make(map[string]bool)
+	probe.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set, nil
+}
 
-	var res []repoEntry
-	if err := yaml.Unmarshal(b, &res); err != nil {
-		return repoFile{}, err
+// commandFlags returns a function giving the flags of the subcommands
+// registered with cmdr, or nil for unknown subcommands.
+func commandFlags(cmdr *subcommands.Commander) func(string) *flag.FlagSet {
+	return func(name string) *flag.FlagSet {
+		var fs *flag.FlagSet
+		cmdr.VisitCommands(func(_ *subcommands.CommandGroup, c subcommands.Command) {
+			if c.Name() == name {
+				fs = flag.NewFlagSet(name, flag.ContinueOnError)
+				c.SetFlags(fs)
+			}
+		})
+		return fs
 	}
-	return repoFile{fileName: p, repoEntries: res}, nil
 }
 
-type conf struct {
-	Archs       []string
-	CacheLife   string
-	ProxyServer string
+// limits returns the download.Limits el sets.
+func (el extractLimits) limits() (download.Limits, error) {
+	l := download.DefaultLimits
+	for _, s := range []struct {
+		v   string
+		dst *int64
+	}{{el.MaxBytes, &l.MaxBytes}, {el.MaxFileSize, &l.MaxFileSize}} {
+		if s.v == "" {
+			continue
+		}
+		n, err := humanize.ParseBytes(s.v)
+		if err != nil {
+			return download.DefaultLimits, fmt.Errorf("invalid extract limit: %v", err)
+		}
+		if n > 0 {
+			*s.dst = int64(n)
+		}
+	}
+	if el.MaxFiles > 0 {
+		l.MaxFiles = el.MaxFiles
+	}
+	if el.MaxDepth > 0 {
+		l.MaxDepth = el.MaxDepth
+	}
+	return l, nil
 }
 
 func unmarshalConfFile(p string) (*conf, error) {
@@ -136,73 +313,150 @@ func unmarshalConfFile(p string) (*conf, error) {
 	return &cf, yaml.Unmarshal(b, &cf)
 }
 
-func repoList(dir string) ([]string, error) {
-	rfs, err := repos(dir)
-	if err != nil {
-		return nil, err
+// availableVersions returns the RepoMap for repos. If minimal metadata is
+// enabled and names is not nil, only the packages in names and their
+// dependencies are fetched.
+func availableVersions(repos, names []string) client.RepoMap {
+	var rm client.RepoMap
+	if minMetadata && names != nil {
+		rm = client.AvailablePackages(repos, names, cachePath, cacheLife, proxyServer)
+	} else {
+		rm = client.AvailableVersions(repos, cachePath, cacheLife, proxyServer)
 	}
-	var rl []string
-	for _, rf := range rfs {
-		for _, re := range rf.repoEntries {
-			rl = append(rl, re.URL)
-		}
+	deprecatedRepos(repos)
+	return rm
+}
+
+// commitState writes the state file and clears the journal of the
+// transitions it now contains. Post-reboot actions of the packages installed
+// are scheduled.
+func commitState(s *client.GooGetState, sf string, j *client.Journal) error {
+	if err := gooroot.WriteState(s, sf); err != nil {
+		return err
 	}
-	return rl, nil
+	schedulePostReboot(*s)
+	return j.Clear()
 }
 
-func repos(dir string) ([]repoFile, error) {
-	fl, err := filepath.Glob(filepath.Join(dir, "*.repo"))
+func newJournal() *client.Journal {
+	return &client.Journal{Path: filepath.Join(rootDir, journal)}
+}
+
+// recoverJournal finishes any state transitions left in the journal by a
+// previous run that was interrupted.
+func recoverJournal() error {
+	j := newJournal()
+	el, err := j.Entries()
+	if err != nil || len(el) == 0 {
+		return err
+	}
+	sf := filepath.Join(rootDir, stateFile)
+	state, err := gooroot.ReadState(sf)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	var rfs []repoFile
-	for _, f := range fl {
-		rf, err := unmarshalRepoFile(f)
-		if err != nil {
-			logger.Error(err)
+	if err := install.Recover(j, state); err != nil {
+		return err
+	}
+	return commitState(state, sf, j)
+}
+
+// source is a repo given with -sources and the priority it is annotated
+// with, if any.
+type source struct {
+	url, priority string
+}
+
+// parseSources splits the -sources flag s into its repos. A repo URL can be
+// followed by its priority, either as "url^1200" or as a separate
+// "priority=1200" element after it.
+func parseSources(s string) ([]source, error) {
+	var srcs []source
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if p := strings.TrimPrefix(e, "priority="); p != e {
+			if len(srcs) == 0 || srcs[len(srcs)-1].priority != "" {
+				return nil, fmt.Errorf("%q does not follow a source without priority", e)
+			}
+			srcs[len(srcs)-1].priority = p
 			continue
 		}
-		if rf.fileName != "" {
-			rfs = append(rfs, rf)
+		if e == "" {
+			continue
 		}
+		src := source{url: e}
+		if i := strings.LastIndex(e, "^"); i >= 0 {
+			src = source{url: e[:i], priority: e[i+1:]}
+			if src.priority == "" {
+				return nil, fmt.Errorf("source %q has an empty priority", e)
+			}
+		}
+		srcs = append(srcs, src)
 	}
-	return rfs, nil
+	return srcs, nil
 }
 
-func writeState(s *client.GooGetState, sf string) error {
-	b, err := s.Marshal()
+// sourcePriority returns the priority p of a source stands for: a number,
+// or the name of a repo in the .repo files in dir whose priority it takes.
+func sourcePriority(p, dir string) (int, error) {
+	if n, err := strconv.Atoi(p); err == nil {
+		if n <= 0 {
+			return 0, fmt.Errorf("invalid source priority %d, priorities are positive", n)
+		}
+		return n, nil
+	}
+	rfs, err := client.RepoFiles(dir)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	for _, rf := range rfs {
+		for _, re := range rf.Entries {
+			if !strings.EqualFold(re.Name, p) {
+				continue
+			}
+			if re.Priority == 0 {
+				return client.DefaultPriority, nil
+			}
+			return re.Priority, nil
+		}
 	}
-	return ioutil.WriteFile(sf, b, 0664)
+	return 0, fmt.Errorf("source priority %q is neither a number nor the name of a repo", p)
 }
 
-func readState(sf string) (*client.GooGetState, error) {
-	b, err := ioutil.ReadFile(sf)
-	if os.IsNotExist(err) {
-		logger.Info("No state file found, assuming no packages installed.")
-		return &client.GooGetState{}, nil
-	}
+// buildSources returns the repos to use: those in the -sources flag s, or
+// the enabled repos in the .repo files if s is empty. With merge the repos in
+// s are used along with those in the .repo files. Priorities annotated in s
+// override the .repo files, other repos in s have the default priority
+// unless a .repo file sets theirs.
+func buildSources(s string, merge bool) ([]string, error) {
+	dir := filepath.Join(rootDir, repoDir)
+	if s == "" {
+		return client.RepoList(dir)
+	}
+	srcs, err := parseSources(s)
 	if err != nil {
 		return nil, err
 	}
-	return client.UnmarshalState(b)
-}
-
-func buildSources(s string) ([]string, error) {
-	if s != "" {
-		srcs := strings.Split(s, ",")
-		return srcs, nil
+	var repos []string
+	if merge {
+		if repos, err = client.RepoList(dir); err != nil {
+			return nil, err
+		}
 	}
-	return repoList(filepath.Join(rootDir, repoDir))
-}
-
-func confirmation(msg string) bool {
-	var c string
-	fmt.Print(msg + " (y/N): ")
-	fmt.Scanln(&c)
-	c = strings.ToLower(c)
-	return c == "y" || c == "yes"
+	for _, src := range srcs {
+		if !goolib.ContainsString(src.url, repos) {
+			repos = append(repos, src.url)
+		}
+		if src.priority == "" {
+			continue
+		}
+		p, err := sourcePriority(src.priority, dir)
+		if err != nil {
+			return nil, err
+		}
+		client.SetPriority(src.url, p)
+	}
+	return repos, nil
 }
 
 func info(ps *goolib.PkgSpec, r string) {
@@ -216,11 +470,18 @@ func info(ps *goolib.PkgSpec, r string) {
 		{"Version", ps.Version},
 		{"Repo", path.Base(r)},
 		{"Authors", ps.Authors},
-		{"Owners", ps.Owners},
+		{"Owners", ps.Owners.String()},
 		{"Description", ps.Description},
 		{"Dependencies", ""},
 		{"ReleaseNotes", ""},
 	}
+	if pv := ps.Provenance; pv != nil {
+		pkgInfo = append(pkgInfo, struct{ name, value string }{"Built", fmt.Sprintf("%s on %s by goopack %s", pv.BuildTime.Format(time.RFC3339), pv.Builder, pv.Goopack)})
+		if pv.Commit != "" {
+			pkgInfo = append(pkgInfo, struct{ name, value string }{"Commit", pv.Commit})
+		}
+		pkgInfo = append(pkgInfo, struct{ name, value string }{"SpecChecksum", pv.SpecChecksum})
+	}
 	var w int
 	for _, pi := range pkgInfo {
 		if len(pi.name) > w {
@@ -273,44 +534,6 @@ func info(ps *goolib.PkgSpec, r string) {
 	}
 }
 
-func rotateLog(logPath string, ls int64) error {
-	fi, err := os.Stat(logPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return err
-	}
-	if fi.Size() < ls {
-		return nil
-	}
-	oldLog := logPath + ".old"
-	if err := os.Rename(logPath, oldLog); err != nil {
-		return fmt.Errorf("error moving log file: %v", err)
-	}
-	return nil
-}
-
-func lock(lf string) (*os.File, error) {
-	// This locking process only works on Windows, on linux os.Remove will remove an open file.
-	// This is not currently an issue as running googet on linux is only done for testing.
-	// In the future using a semaphore for locking would be nice.
-	// 90% of all GooGet runs happen in < 60s, we wait 70s.
-	for i := 1; i < 15; i++ {
-		// Try to remove any old lock file that may exist, ignore errors as we don't care if
-		// we can't remove it or it does not exist.
-		os.Remove(lf)
-		if lk, err := os.OpenFile(lf, os.O_RDONLY|os.O_CREATE|os.O_EXCL, 0); err == nil {
-			return lk, nil
-		}
-		if i == 1 {
-			fmt.Fprintln(os.Stderr, "GooGet lock already held, waiting...")
-		}
-		time.Sleep(5 * time.Second)
-	}
-	return nil, errors.New("timed out waiting for lock")
-}
-
 func readConf(cf string) {
 	gc, err := unmarshalConfFile(cf)
 	if err != nil {
@@ -337,9 +560,69 @@ func readConf(cf string) {
 		}
 	}
 
+	if gc.LockTimeout != "" {
+		lockTimeout, err = time.ParseDuration(gc.LockTimeout)
+		if err != nil {
+			logger.Error(err)
+		}
+	}
+
 	if gc.ProxyServer != "" {
 		proxyServer = gc.ProxyServer
 	}
+
+	remove.SetProtected(gc.Protected)
+	minMetadata = gc.MinimalMetadata
+	migrateRepos = gc.MigrateRepos
+	if gc.Confirm != "" {
+		if pp, err := parsePromptPolicy(gc.Confirm); err != nil {
+			logger.Error(err)
+		} else {
+			prompts = pp
+		}
+	}
+
+	cachePath = filepath.Join(rootDir, cacheDir)
+	if gc.CacheDir != "" {
+		cachePath = gc.CacheDir
+	}
+	client.SetHealthFile(filepath.Join(cachePath, healthFile))
+	install.SetInstallRoot(gc.InstallRoot)
+	for name, l := range gc.Locations {
+		install.SetLocation(name, l)
+	}
+	install.SetHardLink(gc.HardLink)
+	if gc.Locale != "" {
+		msg.SetLocale(gc.Locale)
+	}
+	fleetReport = gc.Report
+	client.SetRequestHeaders(gc.Identify.headers())
+	client.SetSigner(&identity.File{Path: filepath.Join(rootDir, identityFile)})
+	system.SetSignaturePolicy(gc.Signature)
+	system.SetScriptContext("", gc.ScriptContext)
+	for name, ctx := range gc.ScriptContexts {
+		system.SetScriptContext(name, ctx)
+	}
+	if p, err := gc.LogRetention.policy(); err != nil {
+		logger.Error(err)
+	} else {
+		retention = p
+	}
+	if l, err := gc.ExtractLimits.limits(); err != nil {
+		logger.Error(err)
+	} else {
+		download.SetLimits(l)
+	}
+	download.SetEntitlements(gc.Entitlements)
+	flagDefaults = gc.Defaults
+
+	for ext, ipr := range gc.Interpreters {
+		if _, err := exec.LookPath(ipr); err != nil {
+			logger.Errorf("Not using interpreter %q for %q scripts: %v", ipr, ext, err)
+			continue
+		}
+		goolib.SetInterpreter(ext, ipr)
+	}
 }
 
 func run() int {
@@ -349,6 +632,10 @@ func run() int {
 	ggFlags.BoolVar(&verbose, "verbose", false, "print info level logs to stdout")
 	ggFlags.BoolVar(&systemLog, "system_log", true, "log to Linux Syslog or Windows Event Log")
 	ggFlags.BoolVar(&showVer, "version", false, "display GooGet version and exit")
+	ggFlags.BoolVar(&userScope, "user", false, "use the per-user googet root and install packages for the current user")
+	ggFlags.BoolVar(&planJSON, "plan_json", false, "print the changes install, remove and update will make as JSON")
+	ggFlags.BoolVar(&msgJSON, "messages_json", false, "print install, remove, update and verify messages as JSON lines with their message IDs")
+	ggFlags.BoolVar(&refresh, "refresh", false, "download repo indexes again rather than use cached copies")
 
 	if err := ggFlags.Parse(os.Args[1:]); err != nil && err != flag.ErrHelp {
 		logger.Fatal(err)
@@ -359,6 +646,14 @@ func run() int {
 		os.Exit(0)
 	}
 
+	if userScope {
+		rootDir = filepath.Join(goolib.UserDir(), "GooGet")
+	}
+	msg.SetLocale(msg.SystemLocale())
+	if c, ok := reporter.(*msg.Console); ok {
+		c.JSON = msgJSON
+	}
+
 	cmdr := subcommands.NewCommander(ggFlags, "googet")
 	cmdr.Register(cmdr.FlagsCommand(), "")
 	cmdr.Register(cmdr.CommandsCommand(), "")
@@ -370,15 +665,28 @@ func run() int {
 	cmdr.Register(&installedCmd{}, "package query")
 	cmdr.Register(&latestCmd{}, "package query")
 	cmdr.Register(&availableCmd{}, "package query")
+	cmdr.Register(&ownersCmd{}, "package query")
+	cmdr.Register(&verifyCmd{}, "package query")
+	cmdr.Register(&auditCmd{}, "package query")
+	cmdr.Register(&checkCmd{}, "package query")
+	cmdr.Register(&rdependsCmd{}, "package query")
+	cmdr.Register(&graphCmd{}, "package query")
 	cmdr.Register(&listReposCmd{}, "repository management")
 	cmdr.Register(&addRepoCmd{}, "repository management")
 	cmdr.Register(&rmRepoCmd{}, "repository management")
+	cmdr.Register(&repoSetCmd{}, "repository management")
 	cmdr.Register(&cleanCmd{}, "")
+	cmdr.Register(&locksCmd{}, "")
+	cmdr.Register(&logsCmd{}, "")
+	cmdr.Register(&identityCmd{}, "")
+	cmdr.Register(&resumePostRebootCmd{}, "")
+	cmdr.Register(&reportCmd{}, "")
+	cmdr.Register(&agentCmd{}, "")
 
 	cmdr.ImportantFlag("verbose")
 	cmdr.ImportantFlag("noconfirm")
 
-	nonLockingCommands := []string{"help", "commands", "flags"}
+	nonLockingCommands := []string{"help", "commands", "flags", "locks", "logs", "identity"}
 	if ggFlags.NArg() == 0 || goolib.ContainsString(ggFlags.Args()[0], nonLockingCommands) {
 		return int(cmdr.Execute(context.Background()))
 	}
@@ -386,24 +694,50 @@ func run() int {
 	if rootDir == "" {
 		logger.Fatalf("The environment variable %q not defined and no '-root' flag passed.", envVar)
 	}
+	// Scripts and uninstall entries find the root through the environment.
+	if err := os.Setenv(envVar, rootDir); err != nil {
+		logger.Fatal(err)
+	}
 	if err := os.MkdirAll(rootDir, 0774); err != nil {
 		logger.Fatalln("Error setting up root directory:", err)
 	}
+	// With -user the root is not where googet.exe is, uninstall entries run
+	// the googet that installed the package.
+	if exe, err := os.Executable(); err != nil {
+		logger.Errorf("Error finding the googet executable: %v", err)
+	} else {
+		system.SetGooGetExe(exe)
+	}
 
 	readConf(filepath.Join(rootDir, confFile))
-
-	lkf := filepath.Join(rootDir, lockFile)
-	lk, err := lock(lkf)
-	if err != nil {
+	if refresh {
+		cacheLife = client.NoCache
+	}
+	// The flags of the subcommand are only parsed by cmdr.Execute, the
+	// defaults go in ahead of them.
+	if err := ggFlags.Parse(withDefaults(ggFlags.Args(), flagDefaults, commandFlags(cmdr))); err != nil {
 		logger.Fatal(err)
 	}
-	defer os.Remove(lkf)
-	defer lk.Close()
 
-	logPath := filepath.Join(rootDir, logFile)
-	if err := rotateLog(logPath, logSize); err != nil {
-		logger.Error(err)
+	// The agent takes the lock for each operation it runs rather than for as
+	// long as it serves.
+	agentMode := ggFlags.Arg(0) == "agent"
+	li := gooroot.LockInfo{PID: os.Getpid(), Command: strings.Join(ggFlags.Args(), " "), Start: time.Now()}
+	if !agentMode {
+		lkf := filepath.Join(rootDir, lockFile)
+		lk, err := gooroot.Lock(lkf, li, lockTimeout)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer os.Remove(lkf)
+		defer lk.Close()
+	}
+
+	logDir := filepath.Join(rootDir, logsDir)
+	if err := os.MkdirAll(logDir, 0774); err != nil {
+		logger.Fatalf("Error setting up log directory: %v", err)
 	}
+	logPath = filepath.Join(logDir, opLogName(li.Start, ggFlags.Arg(0)))
 	lf, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0660)
 	if err != nil {
 		logger.Fatalln("Failed to open log file:", err)
@@ -411,14 +745,33 @@ func run() int {
 	defer lf.Close()
 
 	logger.Init("GooGet", verbose, systemLog, lf)
+	if err := pruneLogs(logDir, logPath, retention, time.Now()); err != nil {
+		logger.Errorf("Error removing old logs: %v", err)
+	}
 
-	if err := os.MkdirAll(filepath.Join(rootDir, cacheDir), 0774); err != nil {
+	if err := os.MkdirAll(cachePath, 0774); err != nil {
 		logger.Fatalf("Error setting up cache directory: %v", err)
 	}
 	if err := os.MkdirAll(filepath.Join(rootDir, repoDir), 0774); err != nil {
 		logger.Fatalf("Error setting up repo directory: %v", err)
 	}
 
+	if agentMode {
+		return int(cmdr.Execute(context.Background()))
+	}
+
+	if err := recoverJournal(); err != nil {
+		logger.Errorf("Error recovering from journal: %v", err)
+	}
+
+	op := ipc.Operation{PID: li.PID, Command: ggFlags.Arg(0), Args: ggFlags.Args()[1:], Start: li.Start}
+	srv, err := ipc.Listen(filepath.Join(rootDir, sockFile), filepath.Join(rootDir, stateFile), op)
+	if err != nil {
+		logger.Errorf("Error starting state API: %v", err)
+	} else {
+		defer srv.Close()
+	}
+
 	return int(cmdr.Execute(context.Background()))
 }
 
@@ -20,6 +20,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/google/googet/client"
 	"github.com/google/googet/oswrap"
 	"github.com/google/logger"
 	"github.com/google/subcommands"
@@ -27,13 +28,15 @@ import (
 )
 
 type addRepoCmd struct {
-	file string
+	file     string
+	group    string
+	register bool
 }
 
 func (*addRepoCmd) Name() string     { return "addrepo" }
 func (*addRepoCmd) Synopsis() string { return "add repository" }
 func (*addRepoCmd) Usage() string {
-	return fmt.Sprintf(`%s addrepo [-file] <name> <url>:
+	return fmt.Sprintf(`%s addrepo [-file] [-group] [-register] <name> <url>:
 	Add repository to GooGet's repository list. 
 	If -file is not set 'name.repo' will be used for the file name 
 	overwriting any existing file with than name. 
@@ -44,6 +47,8 @@ func (*addRepoCmd) Usage() string {
 
 func (cmd *addRepoCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&cmd.file, "file", "", "repo file to add this repository to")
+	f.StringVar(&cmd.group, "group", "", "group to add this repository to, for reposet")
+	f.BoolVar(&cmd.register, "register", false, "sign requests to this repository with the machine identity, for repositories that require registration")
 }
 
 func (cmd *addRepoCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
@@ -74,31 +79,31 @@ func (cmd *addRepoCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interfac
 	repoPath := filepath.Join(rootDir, repoDir, cmd.file)
 
 	if _, err := oswrap.Stat(repoPath); err != nil && os.IsNotExist(err) {
-		re := repoEntry{Name: name, URL: url}
-		if err := writeRepoFile(repoFile{repoPath, []repoEntry{re}}); err != nil {
+		re := client.RepoEntry{Name: name, URL: url, Group: cmd.group, Register: cmd.register}
+		if err := client.WriteRepoFile(client.RepoFile{Path: repoPath, Entries: []client.RepoEntry{re}}); err != nil {
 			logger.Fatal(err)
 		}
 		fmt.Printf("Wrote repo file %s with content:\n  Name: %s\n  URL: %s\n", repoPath, re.Name, re.URL)
 		return subcommands.ExitSuccess
 	}
 
-	rf, err := unmarshalRepoFile(repoPath)
+	rf, err := client.UnmarshalRepoFile(repoPath)
 	if err != nil {
 		logger.Fatal(err)
 	}
 
-	var res []repoEntry
-	for _, re := range rf.repoEntries {
+	var res []client.RepoEntry
+	for _, re := range rf.Entries {
 		if re.Name != name && re.URL != url {
 			res = append(res, re)
 		}
 	}
 
-	re := repoEntry{Name: name, URL: url}
+	re := client.RepoEntry{Name: name, URL: url, Group: cmd.group, Register: cmd.register}
 	res = append(res, re)
-	rf = repoFile{rf.fileName, res}
+	rf = client.RepoFile{Path: rf.Path, Entries: res}
 
-	if err := writeRepoFile(rf); err != nil {
+	if err := client.WriteRepoFile(rf); err != nil {
 		logger.Fatal(err)
 	}
 	fmt.Printf("Appended to repo file %s with the following content:\n  Name: %s\n  URL: %s\n", repoPath, re.Name, re.URL)
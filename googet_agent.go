@@ -0,0 +1,111 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// The agent subcommand serves the agent management API on localhost.
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/googet/agent"
+	"github.com/google/googet/googetclient"
+	"github.com/google/googet/system"
+	"github.com/google/logger"
+	"github.com/google/subcommands"
+	"golang.org/x/net/context"
+)
+
+// tokenFile holds the token agent API requests must carry, only
+// administrators should be able to read it.
+const tokenFile = "googet.agent.token"
+
+type agentCmd struct {
+	addr string
+}
+
+func (*agentCmd) Name() string     { return "agent" }
+func (*agentCmd) Synopsis() string { return "serve the management API" }
+func (*agentCmd) Usage() string {
+	return fmt.Sprintf(`%s agent [-addr <host:port>]:
+	Serve the management API until killed, requests must carry the token in %s.
+`, filepath.Base(os.Args[0]), tokenFile)
+}
+
+func (cmd *agentCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.addr, "addr", "127.0.0.1:7860", "loopback address to serve on")
+}
+
+func (cmd *agentCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	host, _, err := net.SplitHostPort(cmd.addr)
+	if err != nil {
+		logger.Errorf("Invalid address %q: %v", cmd.addr, err)
+		return subcommands.ExitUsageError
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		logger.Errorf("Refusing to serve on %q, the agent only serves on loopback addresses", cmd.addr)
+		return subcommands.ExitUsageError
+	}
+	token, err := agentToken(filepath.Join(rootDir, tokenFile))
+	if err != nil {
+		logger.Errorf("Error reading agent token: %v", err)
+		return subcommands.ExitFailure
+	}
+
+	c, err := googetclient.New(rootDir)
+	if err != nil {
+		logger.Error(err)
+		return subcommands.ExitFailure
+	}
+	c.Archs = archs
+	c.ProxyServer = proxyServer
+	c.CacheDir = cachePath
+	c.CacheLife = cacheLife
+	c.LockTimeout = lockTimeout
+	c.UserScope = userScope
+	c.GooGetExe = system.GooGetExe()
+
+	go reportLoop(fleetReport)
+	logger.Infof("Serving agent API on %s", cmd.addr)
+	if err := http.ListenAndServe(cmd.addr, agent.New(c, token)); err != nil {
+		logger.Error(err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+// agentToken reads the token in p, generating it if p does not exist.
+func agentToken(p string) (string, error) {
+	b, err := ioutil.ReadFile(p)
+	if err == nil {
+		return strings.TrimSpace(string(b)), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	r := make([]byte, 32)
+	if _, err := rand.Read(r); err != nil {
+		return "", err
+	}
+	t := hex.EncodeToString(r)
+	return t, ioutil.WriteFile(p, []byte(t+"\n"), 0600)
+}
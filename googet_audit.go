@@ -0,0 +1,113 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// The audit subcommand reports installed packages whose version has been
+// yanked from the repo they were installed from.
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/gooroot"
+	"github.com/google/logger"
+	"github.com/google/subcommands"
+	"golang.org/x/net/context"
+)
+
+type auditCmd struct {
+	sources      string
+	mergeSources bool
+}
+
+func (*auditCmd) Name() string     { return "audit" }
+func (*auditCmd) Synopsis() string { return "report installed packages with yanked versions" }
+func (*auditCmd) Usage() string {
+	return fmt.Sprintf(`%s audit [-sources repo1,repo2...]:
+	Report installed packages whose installed version has been yanked from a repo.
+	Exits with a failure status if any are found.
+`, filepath.Base(os.Args[0]))
+}
+
+func (cmd *auditCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.sources, "sources", "", "comma separated list of sources, each optionally followed by ^priority, setting this overrides local .repo files")
+	f.BoolVar(&cmd.mergeSources, "merge-sources", false, "use -sources along with the local .repo files instead of overriding them")
+}
+
+func (cmd *auditCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	state, err := gooroot.ReadState(filepath.Join(rootDir, stateFile))
+	if err != nil {
+		logger.Fatal(err)
+	}
+	repos, err := buildSources(cmd.sources, cmd.mergeSources)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if repos == nil {
+		logger.Fatal("No repos defined, create a .repo file or pass using the -sources flag.")
+	}
+
+	var names []string
+	for _, p := range *state {
+		names = append(names, p.PackageSpec.Name)
+	}
+	ys := yankedPackages(*state, availableVersions(repos, names))
+	if len(ys) == 0 {
+		fmt.Println("No installed package versions are yanked.")
+		return subcommands.ExitSuccess
+	}
+	for _, y := range ys {
+		fmt.Println(y)
+	}
+	return subcommands.ExitFailure
+}
+
+// yanked is an installed package whose version is yanked in a repo.
+type yanked struct {
+	Name, Arch, Version, Repo, Reason string
+}
+
+func (y yanked) String() string {
+	return fmt.Sprintf("%s.%s %s is yanked in %s: %s", y.Name, y.Arch, y.Version, y.Repo, y.Reason)
+}
+
+// yankedPackages returns the packages in state whose installed version is
+// yanked in a repo in rm, sorted by name and arch.
+func yankedPackages(state client.GooGetState, rm client.RepoMap) []yanked {
+	var repos []string
+	for r := range rm {
+		repos = append(repos, r)
+	}
+	sort.Strings(repos)
+	var ys []yanked
+	for _, p := range state {
+		ps := p.PackageSpec
+		for _, r := range repos {
+			for _, rs := range rm[r] {
+				s := rs.PackageSpec
+				if rs.Yanked && s.Name == ps.Name && s.Arch == ps.Arch && s.Version == ps.Version {
+					ys = append(ys, yanked{Name: s.Name, Arch: s.Arch, Version: s.Version, Repo: r, Reason: rs.YankReason})
+				}
+			}
+		}
+	}
+	sort.SliceStable(ys, func(i, j int) bool {
+		return ys[i].Name+"."+ys[i].Arch < ys[j].Name+"."+ys[j].Arch
+	})
+	return ys
+}
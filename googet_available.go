@@ -19,40 +19,61 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/google/googet/client"
 	"github.com/google/googet/goolib"
+	"github.com/google/googet/output"
 	"github.com/google/logger"
 	"github.com/google/subcommands"
 	"golang.org/x/net/context"
 )
 
 type availableCmd struct {
-	info    bool
-	sources string
+	info         bool
+	long         bool
+	out          output.Options
+	repo         string
+	sources      string
+	mergeSources bool
 }
 
 func (*availableCmd) Name() string     { return "available" }
 func (*availableCmd) Synopsis() string { return "list available packages" }
 func (*availableCmd) Usage() string {
-	return fmt.Sprintf(`%s available [-sources repo1,repo2...] [-info] [<initial>]:
-	List available packages beginning with an initial string,
-	if no initial string is provided all available packages will be listed.
+	return fmt.Sprintf(`%s available [-sources repo1,repo2...] [-repo name1,name2...] [-info] [-long] [-format simple|table|json] [-fields f1,f2...] [<filter>]:
+	List available packages containing a filter string, or matching it if it
+	is a glob pattern such as 'python*'. If no filter is provided all
+	available packages will be listed.
 `, filepath.Base(os.Args[0]))
 }
 
 func (cmd *availableCmd) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&cmd.info, "info", false, "display package info")
-	f.StringVar(&cmd.sources, "sources", "", "comma separated list of sources, setting this overrides local .repo files")
+	f.BoolVar(&cmd.long, "long", false, "add owners and description columns to the simple format")
+	cmd.out.SetFlags(f)
+	f.StringVar(&cmd.repo, "repo", "", "comma separated list of repo names or URLs to list the packages of")
+	f.StringVar(&cmd.sources, "sources", "", "comma separated list of sources, each optionally followed by ^priority, setting this overrides local .repo files")
+	f.BoolVar(&cmd.mergeSources, "merge-sources", false, "use -sources along with the local .repo files instead of overriding them")
 }
 
-func (cmd *availableCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
-	exitCode := subcommands.ExitFailure
+// availableFields are the fields of the packages listed by available.
+var availableFields = []string{"Name", "Arch", "Version", "Repo", "Description", "Owners"}
+
+// availablePackage is a package listed by available.
+type availablePackage struct {
+	Name, Arch, Version, Repo string
+	Description               string
+	Owners                    goolib.Owners
+}
 
+func (cmd *availableCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
 	var filter string
 	switch f.NArg() {
 	case 0:
@@ -64,50 +85,123 @@ func (cmd *availableCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interf
 		f.Usage()
 		return subcommands.ExitUsageError
 	}
+	w, err := cmd.out.NewWriter(os.Stdout, availableFields...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return subcommands.ExitUsageError
+	}
 
-	repos, err := buildSources(cmd.sources)
+	repos, err := buildSources(cmd.sources, cmd.mergeSources)
 	if err != nil {
 		logger.Fatal(err)
 	}
+	if cmd.repo != "" {
+		if repos, err = selectRepos(repos, strings.Split(cmd.repo, ",")); err != nil {
+			logger.Fatal(err)
+		}
+	}
 	if repos == nil {
 		logger.Fatal("No repos defined, create a .repo file or pass using the -sources flag.")
 	}
 
-	m := make(map[string][]string)
-	rm := client.AvailableVersions(repos, filepath.Join(rootDir, cacheDir), cacheLife, proxyServer)
+	match := func(p string) bool { return strings.Contains(p, filter) }
+	if isGlob(filter) {
+		match = func(p string) bool {
+			pi := goolib.PkgNameSplit(p)
+			if m, _ := path.Match(filter, pi.Name); m {
+				return true
+			}
+			m, _ := path.Match(filter, pi.Name+"."+pi.Arch)
+			return m
+		}
+	}
+
+	rm := availableVersions(repos, nil)
+	var aps []availablePackage
 	for r, pl := range rm {
+		logger.Infof("Searching %q for packages matching filter %q.", r, filter)
 		for _, p := range pl {
-			m[r] = append(m[r], p.PackageSpec.Name+"."+p.PackageSpec.Arch+"."+p.PackageSpec.Version)
+			ps := p.PackageSpec
+			if match(ps.Name + "." + ps.Arch + "." + ps.Version) {
+				aps = append(aps, availablePackage{Name: ps.Name, Arch: ps.Arch, Version: ps.Version, Repo: r, Description: ps.Description, Owners: ps.Owners})
+			}
 		}
 	}
+	sort.Slice(aps, func(i, j int) bool {
+		a, b := aps[i], aps[j]
+		if a.Repo != b.Repo {
+			return a.Repo < b.Repo
+		}
+		return a.Name+"."+a.Arch+"."+a.Version < b.Name+"."+b.Arch+"."+b.Version
+	})
 
-	for r, pl := range m {
-		logger.Infof("Searching %q for packages matching filter %q.", r, filter)
-		sort.Strings(pl)
-		i := sort.SearchStrings(pl, filter)
-		if i >= len(pl) || !strings.Contains(pl[i], filter) {
-			continue
+	switch {
+	case cmd.out.Custom():
+		for _, ap := range aps {
+			w.Add(ap.Name, ap.Arch, ap.Version, ap.Repo, ap.Description, ap.Owners)
 		}
-		if !cmd.info {
-			fmt.Println(r)
+		if err := w.Flush(); err != nil {
+			logger.Fatal(err)
 		}
-		for _, p := range pl {
-			if strings.Contains(p, filter) {
-				exitCode = subcommands.ExitSuccess
-				pi := goolib.PkgNameSplit(p)
-				if cmd.info {
-					repo(pi, rm)
-					continue
-				}
-				fmt.Println(" ", pi.Name+"."+pi.Arch+" "+pi.Ver)
-			}
+	case cmd.info:
+		for _, ap := range aps {
+			repo(goolib.PackageInfo{Name: ap.Name, Arch: ap.Arch, Ver: ap.Version}, rm)
 		}
+	default:
+		writeAvailable(os.Stdout, aps, cmd.long)
 	}
 
-	if exitCode != subcommands.ExitSuccess {
+	if len(aps) == 0 {
 		fmt.Fprintf(os.Stderr, "No package matching filter %q available in any repo.\n", filter)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+// writeAvailable writes aps to w grouped by repo, with owners and
+// description columns if long is set.
+func writeAvailable(w io.Writer, aps []availablePackage, long bool) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	var last string
+	for _, ap := range aps {
+		if ap.Repo != last {
+			tw.Flush()
+			fmt.Fprintln(w, ap.Repo)
+			last = ap.Repo
+		}
+		if !long {
+			fmt.Fprintln(w, " ", ap.Name+"."+ap.Arch+" "+ap.Version)
+			continue
+		}
+		desc := strings.SplitN(ap.Description, "\n", 2)[0]
+		fmt.Fprintf(tw, "  %s.%s\t%s\t%s\t%s\n", ap.Name, ap.Arch, ap.Version, ap.Owners, desc)
+	}
+	tw.Flush()
+}
+
+// selectRepos returns the repos in repos named by names, as the name of
+// their .repo entry, their URL or the last element of their URL.
+func selectRepos(repos, names []string) ([]string, error) {
+	rfs, err := client.RepoFiles(filepath.Join(rootDir, repoDir))
+	if err != nil {
+		return nil, err
+	}
+	entry := make(map[string]string)
+	for _, rf := range rfs {
+		for _, re := range rf.Entries {
+			entry[re.URL] = re.Name
+		}
+	}
+	var sel []string
+	for _, r := range repos {
+		if goolib.ContainsString(r, names) || goolib.ContainsString(path.Base(r), names) || (entry[r] != "" && goolib.ContainsString(entry[r], names)) {
+			sel = append(sel, r)
+		}
+	}
+	if sel == nil {
+		return nil, fmt.Errorf("no repo named %s", strings.Join(names, " or "))
 	}
-	return exitCode
+	return sel, nil
 }
 
 func repo(pi goolib.PackageInfo, rm client.RepoMap) {
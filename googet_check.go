@@ -0,0 +1,235 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// The check subcommand cross-checks the package database against the
+// filesystem, the system's uninstall entries and the repos, and reports what
+// needs fixing.
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/gooroot"
+	"github.com/google/googet/oswrap"
+	"github.com/google/googet/system"
+	"github.com/google/logger"
+	"github.com/google/subcommands"
+	"golang.org/x/net/context"
+)
+
+type checkCmd struct {
+	sources      string
+	mergeSources bool
+	offline      bool
+}
+
+func (*checkCmd) Name() string { return "check" }
+func (*checkCmd) Synopsis() string {
+	return "cross-check the package database against the system and repos"
+}
+func (*checkCmd) Usage() string {
+	return fmt.Sprintf(`%s check [-sources repo1,repo2...] [-offline]:
+	Report installed files that are missing, cache entries that belong to no
+	installed package, uninstall entries without a package and packages whose
+	installed version can no longer be downloaded, with how to fix each.
+	Exits with a failure status if any problem is found.
+`, filepath.Base(os.Args[0]))
+}
+
+func (cmd *checkCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.sources, "sources", "", "comma separated list of sources, each optionally followed by ^priority, setting this overrides local .repo files")
+	f.BoolVar(&cmd.mergeSources, "merge-sources", false, "use -sources along with the local .repo files instead of overriding them")
+	f.BoolVar(&cmd.offline, "offline", false, "do not check that installed versions are still in a repo")
+}
+
+func (cmd *checkCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	state, err := gooroot.ReadState(filepath.Join(rootDir, stateFile))
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	ps := checkFiles(*state)
+	cps, err := checkCache(*state, cachePath)
+	if err != nil {
+		logger.Error(err)
+	}
+	ps = append(ps, cps...)
+	if runtime.GOOS == "windows" {
+		entries, err := system.UninstallEntries(userScope)
+		if err != nil {
+			logger.Errorf("Error reading uninstall entries: %v", err)
+		} else {
+			ps = append(ps, checkUninstallEntries(*state, entries)...)
+		}
+	}
+	if !cmd.offline {
+		repos, err := buildSources(cmd.sources, cmd.mergeSources)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if repos == nil {
+			logger.Fatal("No repos defined, create a .repo file or pass using the -sources flag, or use -offline.")
+		}
+		var names []string
+		for _, p := range *state {
+			names = append(names, p.PackageSpec.Name)
+		}
+		ps = append(ps, checkRepos(*state, availableVersions(repos, names))...)
+	}
+
+	if len(ps) == 0 {
+		fmt.Println("No problems found.")
+		return subcommands.ExitSuccess
+	}
+	for _, p := range ps {
+		fmt.Println(p)
+	}
+	return subcommands.ExitFailure
+}
+
+// problem is an inconsistency found by check and the action that fixes it.
+type problem struct {
+	Subject, Issue, Action string
+}
+
+func (p problem) String() string {
+	return fmt.Sprintf("%s: %s\n  fix: %s", p.Subject, p.Issue, p.Action)
+}
+
+func pkgName(ps *goolib.PkgSpec) string {
+	return ps.Name + "." + ps.Arch
+}
+
+// checkFiles reports the files and directories of the packages in state
+// that are missing.
+func checkFiles(state client.GooGetState) []problem {
+	var ps []problem
+	for _, p := range state {
+		var missing []string
+		for _, fm := range []map[string]string{p.InstalledFiles, p.ConfigFiles} {
+			for f := range fm {
+				if _, err := oswrap.Stat(f); os.IsNotExist(err) {
+					missing = append(missing, f)
+				}
+			}
+		}
+		for d := range p.Dirs {
+			if _, err := oswrap.Stat(d); os.IsNotExist(err) {
+				missing = append(missing, d)
+			}
+		}
+		sort.Strings(missing)
+		for _, f := range missing {
+			ps = append(ps, problem{
+				Subject: pkgName(p.PackageSpec),
+				Issue:   fmt.Sprintf("%s is missing", f),
+				Action:  fmt.Sprintf("googet install -reinstall %s", p.PackageSpec.Name),
+			})
+		}
+	}
+	return ps
+}
+
+// checkCache reports the entries in cache that belong to no package in
+// state. Repo index caches are not reported.
+func checkCache(state client.GooGetState, cache string) ([]problem, error) {
+	files, err := filepath.Glob(filepath.Join(cache, "*"))
+	if err != nil {
+		return nil, err
+	}
+	var il []string
+	for _, p := range state {
+		il = append(il, p.UnpackDir)
+	}
+	var ps []problem
+	for _, f := range files {
+		if isRepoCache(f) || goolib.ContainsString(f, il) {
+			continue
+		}
+		ps = append(ps, problem{
+			Subject: f,
+			Issue:   "cache entry does not belong to an installed package",
+			Action:  "googet clean",
+		})
+	}
+	return ps, nil
+}
+
+// isRepoCache reports whether f is one of the files repo indexes and their
+// metadata are cached in.
+func isRepoCache(f string) bool {
+	for _, ext := range []string{".rs", ".chunks", ".meta", ".dep"} {
+		if strings.HasSuffix(f, ext) {
+			return true
+		}
+	}
+	return filepath.Base(f) == healthFile
+}
+
+// checkUninstallEntries reports uninstall entries of packages that are not
+// in state and packages in state with an installer that have no uninstall
+// entry.
+func checkUninstallEntries(state client.GooGetState, entries []string) []problem {
+	var ps []problem
+	names := make(map[string]bool)
+	for _, p := range state {
+		names[p.PackageSpec.Name] = true
+		if p.PackageSpec.Install.Path == "" || goolib.ContainsString(p.PackageSpec.Name, entries) {
+			continue
+		}
+		ps = append(ps, problem{
+			Subject: pkgName(p.PackageSpec),
+			Issue:   "no uninstall entry in Programs and Features",
+			Action:  fmt.Sprintf("googet install -reinstall %s", p.PackageSpec.Name),
+		})
+	}
+	sort.Strings(entries)
+	for _, e := range entries {
+		if names[e] {
+			continue
+		}
+		ps = append(ps, problem{
+			Subject: "GooGet - " + e,
+			Issue:   "uninstall entry for a package that is not installed",
+			Action:  fmt.Sprintf("install %s again and remove it, or delete the registry key", e),
+		})
+	}
+	return ps
+}
+
+// checkRepos reports the packages in state whose installed version is in no
+// repo in rm.
+func checkRepos(state client.GooGetState, rm client.RepoMap) []problem {
+	var ps []problem
+	for _, p := range state {
+		s := p.PackageSpec
+		if _, err := client.WhatRepo(goolib.PackageInfo{Name: s.Name, Arch: s.Arch, Ver: s.Version}, rm); err == nil {
+			continue
+		}
+		ps = append(ps, problem{
+			Subject: pkgName(s),
+			Issue:   fmt.Sprintf("installed version %s is not in any repo, it cannot be redownloaded", s.Version),
+			Action:  fmt.Sprintf("update %s to an available version, until then do not clean its cache entry, reinstalling needs it", s.Name),
+		})
+	}
+	return ps
+}
@@ -21,6 +21,7 @@ import (
 	"strings"
 
 	"github.com/google/googet/goolib"
+	"github.com/google/googet/gooroot"
 	"github.com/google/googet/oswrap"
 	"github.com/google/logger"
 	"github.com/google/subcommands"
@@ -59,7 +60,7 @@ func (cmd *cleanCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{
 }
 
 func cleanPackages(pl []string) {
-	state, err := readState(filepath.Join(rootDir, stateFile))
+	state, err := gooroot.ReadState(filepath.Join(rootDir, stateFile))
 	if err != nil {
 		logger.Fatal(err)
 	}
@@ -74,7 +75,7 @@ func cleanPackages(pl []string) {
 }
 
 func clean(il []string) {
-	files, err := filepath.Glob(filepath.Join(rootDir, cacheDir, "*"))
+	files, err := filepath.Glob(filepath.Join(cachePath, "*"))
 	if err != nil {
 		logger.Fatal(err)
 	}
@@ -88,7 +89,7 @@ func clean(il []string) {
 }
 
 func cleanOld() {
-	state, err := readState(filepath.Join(rootDir, stateFile))
+	state, err := gooroot.ReadState(filepath.Join(rootDir, stateFile))
 	if err != nil {
 		logger.Fatal(err)
 	}
@@ -0,0 +1,93 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// Repos announce they are going away with a deprecation notice, which is
+// shown whenever they are used and can move their repo entries to the
+// replacement repo.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/googet/client"
+	"github.com/google/logger"
+)
+
+// migrateRepos are URL prefixes of trusted replacement repos.
+var migrateRepos []string
+
+// deprecatedRepos warns about each deprecated repo in repos and migrates
+// the repo entries of those with a trusted replacement.
+func deprecatedRepos(repos []string) {
+	for _, r := range repos {
+		d, ok := client.Deprecated(r)
+		if !ok {
+			continue
+		}
+		logger.Warningf("Repo %s is deprecated: %s", r, d)
+		fmt.Fprintf(os.Stderr, "Warning: repo %s is deprecated: %s\n", r, d)
+		if d.Replacement == "" || !trustedReplacement(d.Replacement) {
+			continue
+		}
+		n, err := migrateRepo(filepath.Join(rootDir, repoDir), r, d.Replacement)
+		if err != nil {
+			logger.Errorf("Error migrating repo %s to %s: %v", r, d.Replacement, err)
+			continue
+		}
+		if n > 0 {
+			logger.Infof("Migrated %d repo entries from %s to %s", n, r, d.Replacement)
+			fmt.Fprintf(os.Stderr, "Moved repo %s to its replacement %s.\n", r, d.Replacement)
+		}
+	}
+}
+
+// trustedReplacement reports whether u starts with one of migrateRepos.
+func trustedReplacement(u string) bool {
+	for _, p := range migrateRepos {
+		if p != "" && strings.HasPrefix(u, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateRepo changes the URL of the repo entries for repo in the repo
+// files in dir to replacement and returns how many it changed.
+func migrateRepo(dir, repo, replacement string) (int, error) {
+	rfs, err := client.RepoFiles(dir)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for _, rf := range rfs {
+		var changed bool
+		for i, re := range rf.Entries {
+			if re.URL == repo {
+				rf.Entries[i].URL = replacement
+				changed = true
+				n++
+			}
+		}
+		if !changed {
+			continue
+		}
+		if err := client.WriteRepoFile(rf); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -30,8 +30,9 @@ import (
 )
 
 type downloadCmd struct {
-	downloadDir string
-	sources     string
+	downloadDir  string
+	sources      string
+	mergeSources bool
 }
 
 func (*downloadCmd) Name() string     { return "download" }
@@ -42,7 +43,8 @@ func (*downloadCmd) Usage() string {
 
 func (cmd *downloadCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&cmd.downloadDir, "download_dir", "", "directory to download package")
-	f.StringVar(&cmd.sources, "sources", "", "comma separated list of sources, setting this overrides local .repo files")
+	f.StringVar(&cmd.sources, "sources", "", "comma separated list of sources, each optionally followed by ^priority, setting this overrides local .repo files")
+	f.BoolVar(&cmd.mergeSources, "merge-sources", false, "use -sources along with the local .repo files instead of overriding them")
 }
 
 func (cmd *downloadCmd) Execute(ctx context.Context, flags *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
@@ -50,7 +52,7 @@ func (cmd *downloadCmd) Execute(ctx context.Context, flags *flag.FlagSet, _ ...i
 		fmt.Fprintf(os.Stderr, "%s\nUsage: %s\n", cmd.Synopsis(), cmd.Usage())
 		return subcommands.ExitFailure
 	}
-	repos, err := buildSources(cmd.sources)
+	repos, err := buildSources(cmd.sources, cmd.mergeSources)
 	if err != nil {
 		logger.Fatal(err)
 	}
@@ -58,7 +60,11 @@ func (cmd *downloadCmd) Execute(ctx context.Context, flags *flag.FlagSet, _ ...i
 		logger.Fatal("No repos defined, create a .repo file or pass using the -sources flag.")
 	}
 
-	rm := client.AvailableVersions(repos, filepath.Join(rootDir, cacheDir), cacheLife, proxyServer)
+	var names []string
+	for _, a := range flags.Args() {
+		names = append(names, goolib.PkgNameSplit(a).Name)
+	}
+	rm := availableVersions(repos, names)
 	exitCode := subcommands.ExitSuccess
 
 	dir := cmd.downloadDir
@@ -72,7 +78,7 @@ func (cmd *downloadCmd) Execute(ctx context.Context, flags *flag.FlagSet, _ ...i
 	for _, arg := range flags.Args() {
 		pi := goolib.PkgNameSplit(arg)
 		if pi.Ver == "" {
-			if _, err := download.Latest(pi.Name, dir, rm, archs, proxyServer); err != nil {
+			if _, err := download.Latest(pi.Name, dir, rm, archs, proxyServer, reporter); err != nil {
 				logger.Errorf("error downloading %s, %v", pi.Name, err)
 				exitCode = subcommands.ExitFailure
 			}
@@ -97,7 +103,7 @@ func (cmd *downloadCmd) Execute(ctx context.Context, flags *flag.FlagSet, _ ...i
 			exitCode = subcommands.ExitFailure
 			continue
 		}
-		if _, err := download.FromRepo(rs, repo, dir, proxyServer); err != nil {
+		if _, err := download.FromRepo(rs, repo, dir, proxyServer, reporter); err != nil {
 			logger.Errorf("error downloading %s.%s %s, %v", pi.Name, pi.Arch, pi.Ver, err)
 			exitCode = subcommands.ExitFailure
 			continue
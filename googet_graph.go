@@ -0,0 +1,97 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// The graph subcommand exports the dependency graph of the installed
+// packages, or of the repos, as DOT or JSON.
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/gooroot"
+	"github.com/google/logger"
+	"github.com/google/subcommands"
+	"golang.org/x/net/context"
+)
+
+type graphCmd struct {
+	format       string
+	repo         bool
+	sources      string
+	mergeSources bool
+}
+
+func (*graphCmd) Name() string     { return "graph" }
+func (*graphCmd) Synopsis() string { return "export the package dependency graph" }
+func (*graphCmd) Usage() string {
+	return fmt.Sprintf(`%s graph [-format dot|json] [-repo] [-sources repo1,repo2...]:
+	Write the dependency graph of the installed packages, or with -repo of the
+	latest version of every repo package, to stdout. Dependency cycles are
+	reported on stderr.
+`, filepath.Base(os.Args[0]))
+}
+
+func (cmd *graphCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.format, "format", "dot", "output format, dot or json")
+	f.BoolVar(&cmd.repo, "repo", false, "export the graph of the repos instead of the installed packages")
+	f.StringVar(&cmd.sources, "sources", "", "comma separated list of sources, each optionally followed by ^priority, setting this overrides local .repo files")
+	f.BoolVar(&cmd.mergeSources, "merge-sources", false, "use -sources along with the local .repo files instead of overriding them")
+}
+
+func (cmd *graphCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if cmd.format != "dot" && cmd.format != "json" {
+		fmt.Fprintf(os.Stderr, "Unknown format %q, use dot or json.\n", cmd.format)
+		return subcommands.ExitUsageError
+	}
+
+	var g client.Graph
+	if cmd.repo {
+		repos, err := buildSources(cmd.sources, cmd.mergeSources)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if repos == nil {
+			logger.Fatal("No repos defined, create a .repo file or pass using the -sources flag.")
+		}
+		g = client.RepoGraph(availableVersions(repos, nil), archs)
+	} else {
+		state, err := gooroot.ReadState(filepath.Join(rootDir, stateFile))
+		if err != nil {
+			logger.Fatal(err)
+		}
+		g = client.StateGraph(*state)
+	}
+
+	for _, c := range g.Cycles() {
+		fmt.Fprintf(os.Stderr, "Dependency cycle: %s\n", strings.Join(c, ", "))
+	}
+	if cmd.format == "json" {
+		b, err := json.MarshalIndent(g, "", "  ")
+		if err != nil {
+			logger.Fatal(err)
+		}
+		fmt.Println(string(b))
+		return subcommands.ExitSuccess
+	}
+	if err := g.WriteDOT(os.Stdout); err != nil {
+		logger.Fatal(err)
+	}
+	return subcommands.ExitSuccess
+}
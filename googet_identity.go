@@ -0,0 +1,73 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// The identity subcommand shows the machine identity that requests to repos
+// requiring registration are signed with, so it can be registered.
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/googet/identity"
+	"github.com/google/logger"
+	"github.com/google/subcommands"
+	"golang.org/x/net/context"
+)
+
+// identityFile in the googet root holds the machine identity, it is only
+// created once needed.
+const identityFile = "googet.identity"
+
+type identityCmd struct {
+	renew bool
+}
+
+func (*identityCmd) Name() string     { return "identity" }
+func (*identityCmd) Synopsis() string { return "show the machine identity used with repos that require registration" }
+func (*identityCmd) Usage() string {
+	return fmt.Sprintf(`%s identity [-new]:
+	Print the key ID and public key of the machine identity, creating it if
+	there is none yet. Register them with repos that require registration.
+`, filepath.Base(os.Args[0]))
+}
+
+func (cmd *identityCmd) SetFlags(f *flag.FlagSet) {
+	f.BoolVar(&cmd.renew, "new", false, "replace the identity with a new key pair, repos have to register the new key")
+}
+
+func (cmd *identityCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if rootDir == "" {
+		fmt.Fprintf(os.Stderr, "The environment variable %q not defined and no '-root' flag passed.\n", envVar)
+		return subcommands.ExitFailure
+	}
+	p := filepath.Join(rootDir, identityFile)
+	var id *identity.Identity
+	var err error
+	if cmd.renew {
+		if id, err = identity.New(); err == nil {
+			err = id.Write(p)
+		}
+	} else {
+		id, err = identity.ReadOrCreate(p)
+	}
+	if err != nil {
+		logger.Errorf("Error reading machine identity: %v", err)
+		return subcommands.ExitFailure
+	}
+	fmt.Printf("Key ID:     %s\nPublic key: %s\n", id.ID(), id.PublicKey())
+	return subcommands.ExitSuccess
+}
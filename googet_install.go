@@ -16,38 +16,48 @@ package main
 // The install subcommand handles the downloading and installation of a package.
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/google/googet/client"
 	"github.com/google/googet/goolib"
+	"github.com/google/googet/gooroot"
 	"github.com/google/googet/install"
+	"github.com/google/googet/msg"
 	"github.com/google/logger"
 	"github.com/google/subcommands"
 	"golang.org/x/net/context"
 )
 
 type installCmd struct {
-	reinstall  bool
-	redownload bool
-	dbOnly     bool
-	sources    string
+	reinstall    bool
+	redownload   bool
+	dbOnly       bool
+	sources      string
+	mergeSources bool
+	checksum     string
+	summaryJSON  string
 }
 
 func (*installCmd) Name() string     { return "install" }
 func (*installCmd) Synopsis() string { return "download and install a package and its dependencies" }
 func (*installCmd) Usage() string {
-	return fmt.Sprintf("%s install [-reinstall] [-source repo1,repo2...] <name>\n", filepath.Base(os.Args[0]))
+	return fmt.Sprintf("%s install [-reinstall] [-source repo1,repo2...] <name>[constraints]\n%[1]s install -checksum <sha256> <url>|-\n", filepath.Base(os.Args[0]))
 }
 
 func (cmd *installCmd) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&cmd.reinstall, "reinstall", false, "install even if already installed")
 	f.BoolVar(&cmd.redownload, "redownload", false, "redownload package files")
 	f.BoolVar(&cmd.dbOnly, "db_only", false, "only make changes to DB, don't perform install system actions")
-	f.StringVar(&cmd.sources, "sources", "", "comma separated list of sources, setting this overrides local .repo files")
+	f.StringVar(&cmd.sources, "sources", "", "comma separated list of sources, each optionally followed by ^priority, setting this overrides local .repo files")
+	f.BoolVar(&cmd.mergeSources, "merge-sources", false, "use -sources along with the local .repo files instead of overriding them")
+	f.StringVar(&cmd.checksum, "checksum", "", "SHA256 checksum of the package installed from a URL or stdin")
+	f.StringVar(&cmd.summaryJSON, "summary_json", "", "write a summary of the packages changed, reboots needed, services restarted and script warnings to this file as JSON")
 }
 
 func (cmd *installCmd) Execute(_ context.Context, flags *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
@@ -61,62 +71,168 @@ func (cmd *installCmd) Execute(_ context.Context, flags *flag.FlagSet, _ ...inte
 		return subcommands.ExitFailure
 	}
 
-	args := flags.Args()
+	args := joinConstraints(flags.Args())
 	exitCode := subcommands.ExitSuccess
 
-	cache := filepath.Join(rootDir, cacheDir)
+	var urls, streams int
+	for _, arg := range args {
+		if isURL(arg) {
+			urls++
+		}
+		if arg == stdinArg {
+			streams++
+		}
+	}
+	if streams > 1 {
+		fmt.Fprintln(os.Stderr, "A package can only be read from stdin once")
+		return subcommands.ExitFailure
+	}
+	if urls+streams > 1 && cmd.checksum != "" {
+		fmt.Fprintln(os.Stderr, "-checksum can only be used to install a single URL or package from stdin")
+		return subcommands.ExitFailure
+	}
+
+	cache := cachePath
 	sf := filepath.Join(rootDir, stateFile)
-	state, err := readState(sf)
+	state, err := gooroot.ReadState(sf)
 	if err != nil {
 		logger.Fatal(err)
 	}
+	before := snapshot(*state)
+	j := newJournal()
 
 	if len(args) == 0 {
 		return exitCode
 	}
 
-	repos, err := buildSources(cmd.sources)
+	repos, err := buildSources(cmd.sources, cmd.mergeSources)
 	if err != nil {
 		logger.Fatal(err)
 	}
-	if repos == nil {
-		logger.Fatal("No repos defined, create a .repo file or pass using the -sources flag.")
-	}
 
 	var rm client.RepoMap
+	var expanded []string
 	for _, arg := range args {
+		if !isGlob(arg) || isURL(arg) || filepath.Ext(arg) == ".goo" {
+			expanded = append(expanded, arg)
+			continue
+		}
+		var ms []string
+		if cmd.reinstall {
+			ms = matchInstalled(arg, *state)
+		} else {
+			if repos == nil {
+				logger.Fatal("No repos defined, create a .repo file or pass using the -sources flag.")
+			}
+			if rm == nil {
+				rm = availableVersions(repos, nil)
+			}
+			ms = matchAvailable(arg, rm, archs)
+		}
+		if len(ms) == 0 {
+			logger.Errorf("No package matching %q found.", arg)
+			exitCode = subcommands.ExitFailure
+			continue
+		}
+		if !confirm(len(ms), false, msg.InstallMatchConfirm, arg, strings.Join(ms, ", ")) {
+			reporter.Info(msg.InstallCanceled)
+			continue
+		}
+		expanded = append(expanded, ms...)
+	}
+	args = expanded
+
+	// Packages from repos are installed in the order of their install
+	// stage, so early packages are in place before the others.
+	if len(args) > 1 && !cmd.reinstall && repos != nil {
+		if len(rm) == 0 {
+			rm = availableVersions(repos, argNames(args))
+		}
+		orderByStage(args, rm, archs)
+	}
+
+	for _, arg := range args {
+		if arg == stdinArg {
+			// Confirmations read stdin too, so the package is installed
+			// without one.
+			if err := install.FromReader(os.Stdin, cmd.checksum, cache, state, j, cmd.dbOnly, userScope, cmd.reinstall, reporter); err != nil {
+				logger.Errorf("Error installing package from stdin: %v", err)
+				exitCode = subcommands.ExitFailure
+				continue
+			}
+			if err := commitState(state, sf, j); err != nil {
+				logger.Fatalf("Error writing state file: %v", err)
+			}
+			continue
+		}
+		if isURL(arg) {
+			if base := path.Base(arg); !confirm(1, false, msg.InstallFileConfirm, base) {
+				reporter.Info(msg.NotInstalling, base)
+				continue
+			}
+			if err := install.FromURL(arg, cmd.checksum, cache, state, j, cmd.dbOnly, userScope, cmd.reinstall, proxyServer, reporter); err != nil {
+				logger.Errorf("Error installing %s: %v", arg, err)
+				exitCode = subcommands.ExitFailure
+				continue
+			}
+			if err := commitState(state, sf, j); err != nil {
+				logger.Fatalf("Error writing state file: %v", err)
+			}
+			continue
+		}
 		if ext := filepath.Ext(arg); ext == ".goo" {
-			if !noConfirm {
-				if base := filepath.Base(arg); !confirmation(fmt.Sprintf("Install %s?", base)) {
-					fmt.Printf("Not installing %s...\n", base)
-					continue
-				}
+			if base := filepath.Base(arg); !confirm(1, false, msg.InstallFileConfirm, base) {
+				reporter.Info(msg.NotInstalling, base)
+				continue
 			}
-			if err := install.FromDisk(arg, cache, state, cmd.dbOnly, cmd.reinstall); err != nil {
+			if err := install.FromDisk(arg, cache, state, j, cmd.dbOnly, userScope, cmd.reinstall, reporter); err != nil {
 				logger.Errorf("Error installing %s: %v", arg, err)
 				exitCode = subcommands.ExitFailure
 				continue
 			}
-			if err := writeState(state, sf); err != nil {
+			if err := commitState(state, sf, j); err != nil {
 				logger.Fatalf("Error writing state file: %v", err)
 			}
 			continue
 		}
 
-		pi := goolib.PkgNameSplit(arg)
+		name, cs, err := goolib.SplitConstraints(arg)
+		if err != nil {
+			logger.Errorf("Invalid package %q: %v", arg, err)
+			exitCode = subcommands.ExitFailure
+			continue
+		}
+		pi := goolib.PkgNameSplit(name)
 		if cmd.reinstall {
 			if err := reinstall(pi, *state, cmd.redownload); err != nil {
 				logger.Errorf("Error reinstalling %s: %v", pi.Name, err)
 				exitCode = subcommands.ExitFailure
 				continue
 			}
-			if err := writeState(state, sf); err != nil {
+			if err := gooroot.WriteState(state, sf); err != nil {
 				logger.Fatalf("Error writing state file: %v", err)
 			}
 			continue
 		}
+		if repos == nil {
+			logger.Fatal("No repos defined, create a .repo file or pass using the -sources flag.")
+		}
 		if len(rm) == 0 {
-			rm = client.AvailableVersions(repos, filepath.Join(rootDir, cacheDir), cacheLife, proxyServer)
+			rm = availableVersions(repos, argNames(args))
+		}
+		if len(cs) > 0 {
+			if pi.Ver != "" {
+				logger.Errorf("Package %q has both a version and version constraints", arg)
+				exitCode = subcommands.ExitFailure
+				continue
+			}
+			v, _, a, err := client.FindRepoMatch(pi, cs, rm, archs)
+			if err != nil {
+				logger.Errorf("Can't resolve version for package %q: %v", pi.Name, err)
+				exitCode = subcommands.ExitFailure
+				continue
+			}
+			pi.Ver, pi.Arch = v, a
 		}
 		if pi.Ver == "" {
 			v, _, a, err := client.FindRepoLatest(pi, rm, archs)
@@ -135,6 +251,11 @@ func (cmd *installCmd) Execute(_ context.Context, flags *flag.FlagSet, _ ...inte
 
 		r, err := client.WhatRepo(pi, rm)
 		if err != nil {
+			// List the versions that are available instead.
+			exact := goolib.Constraints{{Op: "=", Ver: pi.Ver}}
+			if _, _, _, merr := client.FindRepoMatch(goolib.PackageInfo{Name: pi.Name, Arch: pi.Arch}, exact, rm, archs); merr != nil {
+				err = merr
+			}
 			logger.Errorf("Error finding %s.%s.%s in repo: %v", pi.Name, pi.Arch, pi.Ver, err)
 			exitCode = subcommands.ExitFailure
 			continue
@@ -146,66 +267,173 @@ func (cmd *installCmd) Execute(_ context.Context, flags *flag.FlagSet, _ ...inte
 			continue
 		}
 		if !ni {
-			fmt.Printf("%s.%s.%s or a newer version is already installed on the system\n", pi.Name, pi.Arch, pi.Ver)
+			reporter.Info(msg.AlreadyInstalled, pi.Name, pi.Arch, pi.Ver)
 			continue
 		}
-		if !noConfirm {
-			b, err := enumerateDeps(pi, rm, r, archs, *state)
+		if prompts.mayAsk() || planJSON {
+			p, err := installPlan(pi, rm, r, archs, *state)
 			if err != nil {
+				showDepError(os.Stdout, err)
 				logger.Error(err)
 				exitCode = subcommands.ExitFailure
 				continue
 			}
-			if !confirmation(b.String()) {
-				fmt.Println("canceling install...")
+			if !p.confirm(msg.InstallConfirm, pi.Name, pi.Arch, pi.Ver) {
+				reporter.Info(msg.InstallCanceled)
 				continue
 			}
 		}
-		if err := install.FromRepo(pi, r, cache, rm, archs, state, cmd.dbOnly, proxyServer); err != nil {
+		if err := install.FromRepo(pi, r, cache, rm, archs, state, j, cmd.dbOnly, userScope, proxyServer, reporter); err != nil {
+			showDepError(os.Stdout, err)
 			logger.Errorf("Error installing %s.%s.%s: %v", pi.Name, pi.Arch, pi.Ver, err)
 			exitCode = subcommands.ExitFailure
 			continue
 		}
-		if err := writeState(state, sf); err != nil {
+		if err := commitState(state, sf, j); err != nil {
 			logger.Fatalf("error writing state file: %v", err)
 		}
 	}
+	finishRun(before, *state, cmd.summaryJSON)
 	return exitCode
 }
 
+// matchAvailable returns the names of the packages in rm, installable on
+// archs, whose name matches the glob pattern arg, or name.arch for those
+// whose name.arch matches it. Yanked packages are left out.
+func matchAvailable(arg string, rm client.RepoMap, archs []string) []string {
+	seen := make(map[string]bool)
+	var ms []string
+	for _, pl := range rm {
+		for _, p := range pl {
+			ps := p.PackageSpec
+			if p.Yanked || !goolib.ContainsString(ps.Arch, archs) {
+				continue
+			}
+			n := ps.Name
+			if m, _ := path.Match(arg, n); !m {
+				n += "." + ps.Arch
+				if m, _ := path.Match(arg, n); !m {
+					continue
+				}
+			}
+			if !seen[n] {
+				seen[n] = true
+				ms = append(ms, n)
+			}
+		}
+	}
+	sort.Strings(ms)
+	return ms
+}
+
+// joinConstraints joins arguments that are only version constraints, as in
+// "foo>=1.2 <2.0" given unquoted, to the package argument before them.
+func joinConstraints(args []string) []string {
+	var out []string
+	for _, a := range args {
+		if len(out) > 0 && strings.IndexAny(a, "<>=!") == 0 {
+			out[len(out)-1] += " " + a
+			continue
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// stdinArg is the install argument reading a package from stdin.
+const stdinArg = "-"
+
+// isURL reports whether arg is the URL of a .goo file rather than a package
+// name or path.
+// argNames returns the package names of the install args.
+func argNames(args []string) []string {
+	var names []string
+	for _, a := range args {
+		n, _, _ := goolib.SplitConstraints(a)
+		names = append(names, goolib.PkgNameSplit(n).Name)
+	}
+	return names
+}
+
+// orderByStage stably sorts the install args by the install stage of the
+// package version each resolves to in rm. URLs, files and args that do not
+// resolve are ordered like packages without a stage.
+func orderByStage(args []string, rm client.RepoMap, archs []string) {
+	rank := make(map[string]int)
+	for _, a := range args {
+		rank[a] = argStageRank(a, rm, archs)
+	}
+	sort.SliceStable(args, func(i, j int) bool { return rank[args[i]] < rank[args[j]] })
+}
+
+func argStageRank(arg string, rm client.RepoMap, archs []string) int {
+	if isURL(arg) || arg == stdinArg || filepath.Ext(arg) == ".goo" {
+		return 0
+	}
+	name, cs, err := goolib.SplitConstraints(arg)
+	if err != nil {
+		return 0
+	}
+	pi := goolib.PkgNameSplit(name)
+	switch {
+	case len(cs) > 0:
+		pi.Ver, _, pi.Arch, err = client.FindRepoMatch(pi, cs, rm, archs)
+	case pi.Ver == "":
+		pi.Ver, _, pi.Arch, err = client.FindRepoLatest(pi, rm, archs)
+	}
+	if err != nil {
+		return 0
+	}
+	return client.StageRank(pi, rm)
+}
+
+func isURL(arg string) bool {
+	return (strings.HasPrefix(arg, "https://") || strings.HasPrefix(arg, "http://")) && path.Ext(arg) == ".goo"
+}
+
 func reinstall(pi goolib.PackageInfo, state client.GooGetState, rd bool) error {
 	ps, err := state.GetPackageState(pi)
 	if err != nil {
 		return fmt.Errorf("cannot reinstall something that is not already installed")
 	}
-	if !noConfirm {
-		if !confirmation(fmt.Sprintf("Reinstall %s?", pi.Name)) {
-			fmt.Printf("Not reinstalling %s...\n", pi.Name)
-			return nil
-		}
+	if !confirm(1, false, msg.ReinstallConfirm, pi.Name) {
+		reporter.Info(msg.NotReinstalling, pi.Name)
+		return nil
 	}
-	if err := install.Reinstall(ps, state, rd, proxyServer); err != nil {
+	if err := install.Reinstall(ps, state, rd, proxyServer, reporter); err != nil {
 		return fmt.Errorf("error reinstalling %s, %v", pi.Name, err)
 	}
 	return nil
 }
 
-func enumerateDeps(pi goolib.PackageInfo, rm client.RepoMap, r string, archs []string, state client.GooGetState) (*bytes.Buffer, error) {
+// installPlan returns the plan for installing pi from repo r and the
+// dependencies that are not yet installed.
+func installPlan(pi goolib.PackageInfo, rm client.RepoMap, r string, archs []string, state client.GooGetState) (*plan, error) {
 	dl, err := install.ListDeps(pi, rm, r, archs)
 	if err != nil {
-		return nil, fmt.Errorf("error listing dependencies for %s.%s.%s: %v", pi.Name, pi.Arch, pi.Ver, err)
+		return nil, fmt.Errorf("error listing dependencies for %s.%s.%s: %w", pi.Name, pi.Arch, pi.Ver, err)
 	}
-	var b bytes.Buffer
-	fmt.Fprintln(&b, "The following packages will be installed:")
+	p := &plan{}
+	seen := make(map[string]bool)
 	for _, di := range dl {
+		if seen[di.PkgName()] {
+			continue
+		}
+		seen[di.PkgName()] = true
 		ni, err := install.NeedsInstallation(di, state)
 		if err != nil {
 			return nil, err
 		}
-		if ni {
-			fmt.Fprintf(&b, "  %s.%s.%s\n", di.Name, di.Arch, di.Ver)
+		if !ni {
+			continue
+		}
+		dr, err := client.WhatRepo(di, rm)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.install(di, dr, rm, state); err != nil {
+			return nil, err
 		}
 	}
-	fmt.Fprintf(&b, "Do you wish to install %s.%s.%s and all dependencies?", pi.Name, pi.Arch, pi.Ver)
-	return &b, nil
+	return p, nil
 }
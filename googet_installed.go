@@ -26,6 +26,8 @@ import (
 
 	"github.com/google/googet/client"
 	"github.com/google/googet/goolib"
+	"github.com/google/googet/gooroot"
+	"github.com/google/googet/output"
 	"github.com/google/logger"
 	"github.com/google/subcommands"
 	"golang.org/x/net/context"
@@ -33,12 +35,13 @@ import (
 
 type installedCmd struct {
 	info bool
+	out  output.Options
 }
 
 func (*installedCmd) Name() string     { return "installed" }
 func (*installedCmd) Synopsis() string { return "list installed packages" }
 func (*installedCmd) Usage() string {
-	return fmt.Sprintf(`%s installed [-info] [<initial>]:
+	return fmt.Sprintf(`%s installed [-info] [-format simple|table|json] [-fields f1,f2...] [<initial>]:
 	List installed packages beginning with an initial string,
 	if no initial string is provided all installed packages will be listed.
 `, filepath.Base(os.Args[0]))
@@ -46,6 +49,7 @@ func (*installedCmd) Usage() string {
 
 func (cmd *installedCmd) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&cmd.info, "info", false, "display package info")
+	cmd.out.SetFlags(f)
 }
 
 func (cmd *installedCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
@@ -61,10 +65,19 @@ func (cmd *installedCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interf
 		return subcommands.ExitUsageError
 	}
 
-	state, err := readState(filepath.Join(rootDir, stateFile))
+	w, err := cmd.out.NewWriter(os.Stdout, "Name", "Arch", "Version", "Repo", "Description", "Owners")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return subcommands.ExitUsageError
+	}
+
+	state, err := gooroot.ReadState(filepath.Join(rootDir, stateFile))
 	if err != nil {
 		logger.Fatal(err)
 	}
+	if cmd.out.Custom() {
+		return writeInstalled(w, *state, filter)
+	}
 
 	pm := installedPackages(*state)
 	if len(pm) == 0 {
@@ -101,6 +114,24 @@ func (cmd *installedCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interf
 	return exitCode
 }
 
+// writeInstalled writes the installed packages containing filter to w.
+func writeInstalled(w *output.Writer, state client.GooGetState, filter string) subcommands.ExitStatus {
+	sort.Slice(state, func(i, j int) bool {
+		a, b := state[i].PackageSpec, state[j].PackageSpec
+		return a.Name+"."+a.Arch < b.Name+"."+b.Arch
+	})
+	for _, p := range state {
+		ps := p.PackageSpec
+		if strings.Contains(ps.Name+"."+ps.Arch+"."+ps.Version, filter) {
+			w.Add(ps.Name, ps.Arch, ps.Version, p.SourceRepo, ps.Description, ps.Owners)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		logger.Fatal(err)
+	}
+	return subcommands.ExitSuccess
+}
+
 func local(pi goolib.PackageInfo, state client.GooGetState) {
 	for _, p := range state {
 		if p.Match(pi) {
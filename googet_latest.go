@@ -23,31 +23,42 @@ import (
 
 	"github.com/google/googet/client"
 	"github.com/google/googet/goolib"
+	"github.com/google/googet/gooroot"
+	"github.com/google/googet/output"
 	"github.com/google/logger"
 	"github.com/google/subcommands"
 	"golang.org/x/net/context"
 )
 
 type latestCmd struct {
-	compare bool
-	sources string
+	compare      bool
+	sources      string
+	mergeSources bool
+	out          output.Options
 }
 
 func (*latestCmd) Name() string     { return "latest" }
 func (*latestCmd) Synopsis() string { return "get the latest available version of a package" }
 func (*latestCmd) Usage() string {
-	return fmt.Sprintf("%s latest [-sources repo1,repo2...] [-compare] <name>\n", filepath.Base(os.Args[0]))
+	return fmt.Sprintf("%s latest [-sources repo1,repo2...] [-compare] [-format simple|table|json] [-fields f1,f2...] <name>\n", filepath.Base(os.Args[0]))
 }
 
 func (cmd *latestCmd) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&cmd.compare, "compare", false, "compare to version locally installed")
-	f.StringVar(&cmd.sources, "sources", "", "comma separated list of sources, setting this overrides local .repo files")
+	f.StringVar(&cmd.sources, "sources", "", "comma separated list of sources, each optionally followed by ^priority, setting this overrides local .repo files")
+	f.BoolVar(&cmd.mergeSources, "merge-sources", false, "use -sources along with the local .repo files instead of overriding them")
+	cmd.out.SetFlags(f)
 }
 
 func (cmd *latestCmd) Execute(_ context.Context, flags *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
 	pi := goolib.PkgNameSplit(flags.Arg(0))
+	w, err := cmd.out.NewWriter(os.Stdout, "Name", "Arch", "Version", "Repo", "Installed")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return subcommands.ExitUsageError
+	}
 
-	repos, err := buildSources(cmd.sources)
+	repos, err := buildSources(cmd.sources, cmd.mergeSources)
 	if err != nil {
 		logger.Fatal(err)
 	}
@@ -55,17 +66,32 @@ func (cmd *latestCmd) Execute(_ context.Context, flags *flag.FlagSet, _ ...inter
 		logger.Fatal("No repos defined, create a .repo file or pass using the -sources flag.")
 	}
 
-	rm := client.AvailableVersions(repos, filepath.Join(rootDir, cacheDir), cacheLife, proxyServer)
-	v, _, a, err := client.FindRepoLatest(pi, rm, archs)
+	rm := availableVersions(repos, []string{pi.Name})
+	v, r, a, err := client.FindRepoLatest(pi, rm, archs)
 	if err != nil {
 		logger.Fatal(err)
 	}
+	if cmd.out.Custom() {
+		state, err := gooroot.ReadState(filepath.Join(rootDir, stateFile))
+		if err != nil {
+			logger.Fatal(err)
+		}
+		var ins string
+		if ps, err := state.GetPackageState(goolib.PackageInfo{Name: pi.Name, Arch: a}); err == nil {
+			ins = ps.PackageSpec.Version
+		}
+		w.Add(pi.Name, a, v, r, ins)
+		if err := w.Flush(); err != nil {
+			logger.Fatal(err)
+		}
+		return subcommands.ExitSuccess
+	}
 	if !cmd.compare {
 		fmt.Println(v)
 		return subcommands.ExitSuccess
 	}
 
-	state, err := readState(filepath.Join(rootDir, stateFile))
+	state, err := gooroot.ReadState(filepath.Join(rootDir, stateFile))
 	if err != nil {
 		logger.Fatal(err)
 	}
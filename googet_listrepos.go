@@ -18,34 +18,108 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
+	humanize "github.com/dustin/go-humanize"
+	"github.com/google/googet/client"
+	"github.com/google/googet/output"
 	"github.com/google/logger"
 	"github.com/google/subcommands"
 	"golang.org/x/net/context"
 )
 
-type listReposCmd struct{}
+type listReposCmd struct {
+	stats bool
+	out   output.Options
+}
 
 func (*listReposCmd) Name() string     { return "listrepos" }
 func (*listReposCmd) Synopsis() string { return "list repositories" }
 func (*listReposCmd) Usage() string {
-	return fmt.Sprintf("%s listrepos\n", filepath.Base(os.Args[0]))
+	return fmt.Sprintf("%s listrepos [-stats] [-format simple|table|json] [-fields f1,f2...]\n", filepath.Base(os.Args[0]))
 }
 
-func (cmd *listReposCmd) SetFlags(f *flag.FlagSet) {}
+func (cmd *listReposCmd) SetFlags(f *flag.FlagSet) {
+	f.BoolVar(&cmd.stats, "stats", false, "show the package count, last fetch time and cache size of each repo")
+	cmd.out.SetFlags(f)
+}
 
 func (cmd *listReposCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
-	rfs, err := repos(filepath.Join(rootDir, repoDir))
+	w, err := cmd.out.NewWriter(os.Stdout, "Name", "URL", "File", "Mirrors", "Deprecated", "Group", "Disabled", "Register", "Packages", "Fetched", "CacheSize")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return subcommands.ExitUsageError
+	}
+	rfs, err := client.RepoFiles(filepath.Join(rootDir, repoDir))
 	if err != nil {
 		logger.Fatal(err)
 	}
 
+	if cmd.out.Custom() {
+		for _, rf := range rfs {
+			for _, re := range rf.Entries {
+				var dep string
+				if d, err := client.ReadDeprecation(re.URL, cachePath); err != nil {
+					logger.Error(err)
+				} else if d != nil {
+					dep = d.String()
+				}
+				var pkgs, fetched, size interface{}
+				if st := repoStats(re.URL); st != nil {
+					pkgs, fetched, size = st.Packages, st.Fetched.Format(time.RFC3339), st.CacheSize
+				}
+				w.Add(re.Name, re.URL, rf.Path, re.Mirrors, dep, re.Group, re.Disabled, re.Register, pkgs, fetched, size)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			logger.Fatal(err)
+		}
+		return subcommands.ExitSuccess
+	}
+
 	for _, rf := range rfs {
-		fmt.Println(rf.fileName + ":")
+		fmt.Println(rf.Path + ":")
 
-		for _, re := range rf.repoEntries {
+		for _, re := range rf.Entries {
 			fmt.Printf("  %s: %s\n", re.Name, re.URL)
+			if re.Group != "" {
+				fmt.Printf("    group: %s\n", re.Group)
+			}
+			if re.Disabled {
+				fmt.Println("    disabled")
+			}
+			if re.Register {
+				fmt.Println("    requires registration")
+			}
+			d, err := client.ReadDeprecation(re.URL, cachePath)
+			if err != nil {
+				logger.Error(err)
+			}
+			if d != nil {
+				fmt.Printf("    deprecated: %s\n", d)
+			}
+			for _, m := range re.Mirrors {
+				fmt.Printf("    mirror: %s\n", m)
+			}
+			if !cmd.stats {
+				continue
+			}
+			if st := repoStats(re.URL); st != nil {
+				fmt.Printf("    packages: %d, fetched: %s, cache: %s\n", st.Packages, st.Fetched.Format(time.RFC3339), humanize.IBytes(uint64(st.CacheSize)))
+			} else {
+				fmt.Println("    not fetched yet")
+			}
 		}
 	}
 	return subcommands.ExitSuccess
 }
+
+// repoStats returns the stats of the last fetch of repo, or nil if it was
+// not fetched.
+func repoStats(repo string) *client.RepoStats {
+	st, err := client.ReadRepoStats(repo, cachePath)
+	if err != nil {
+		logger.Error(err)
+	}
+	return st
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// The locks subcommand shows which process holds the googet lock and which are waiting for it.
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/googet/gooroot"
+	"github.com/google/logger"
+	"github.com/google/subcommands"
+	"golang.org/x/net/context"
+)
+
+type locksCmd struct{}
+
+func (*locksCmd) Name() string     { return "locks" }
+func (*locksCmd) Synopsis() string { return "show the googet lock owner and waiting processes" }
+func (*locksCmd) Usage() string {
+	return fmt.Sprintf("%s locks\n", filepath.Base(os.Args[0]))
+}
+
+func (cmd *locksCmd) SetFlags(f *flag.FlagSet) {}
+
+func (cmd *locksCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if rootDir == "" {
+		fmt.Fprintf(os.Stderr, "The environment variable %q not defined and no '-root' flag passed.\n", envVar)
+		return subcommands.ExitFailure
+	}
+	lf := filepath.Join(rootDir, lockFile)
+
+	owner, err := gooroot.ReadLockInfo(lf)
+	switch {
+	case os.IsNotExist(err):
+		fmt.Println("GooGet lock is not held.")
+	case err != nil:
+		logger.Errorf("Error reading lock file: %v", err)
+		return subcommands.ExitFailure
+	case owner == nil:
+		fmt.Println("GooGet lock held, owner unknown.")
+	default:
+		fmt.Println("GooGet lock held by", owner)
+	}
+
+	ql, err := gooroot.LockQueue(lf)
+	if err != nil {
+		logger.Errorf("Error reading lock queue: %v", err)
+		return subcommands.ExitFailure
+	}
+	var waiting []*gooroot.LockInfo
+	for _, q := range ql {
+		li, err := gooroot.ReadLockInfo(q)
+		if err != nil || li == nil {
+			continue
+		}
+		waiting = append(waiting, li)
+	}
+	if len(waiting) == 0 {
+		return subcommands.ExitSuccess
+	}
+	fmt.Println("Waiting for lock:")
+	for _, li := range waiting {
+		fmt.Println(" ", li)
+	}
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// Each googet operation logs to its own file in the logs directory, the logs
+// subcommand lists and prints them.
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/google/logger"
+	"github.com/google/subcommands"
+	"golang.org/x/net/context"
+)
+
+// logsDir in the googet root holds the operation logs.
+const logsDir = "logs"
+
+// logTimeFormat starts the names of operation logs, so they sort by time.
+const logTimeFormat = "20060102T150405Z"
+
+// logPath is the log of the running operation.
+var logPath string
+
+// opLogName returns the name of the log of the operation command started at
+// start.
+func opLogName(start time.Time, command string) string {
+	return start.UTC().Format(logTimeFormat) + "-" + command + ".log"
+}
+
+// retentionPolicy is which operation logs are kept, newest first: at most
+// Count logs, none older than MaxAge and at most MaxSize bytes in total.
+type retentionPolicy struct {
+	Count   int
+	MaxAge  time.Duration
+	MaxSize int64
+}
+
+// defaultRetention keeps about as much as the single rotated log before it.
+var defaultRetention = retentionPolicy{Count: 100, MaxAge: 30 * 24 * time.Hour, MaxSize: 20 << 20}
+
+// retention is the policy applied when an operation starts.
+var retention = defaultRetention
+
+// logRetention is the conf file form of retentionPolicy, MaxAge is a
+// duration such as "168h" and MaxSize a size such as "50MiB". Unset or 0
+// values keep the default.
+type logRetention struct {
+	Count   int
+	MaxAge  string
+	MaxSize string
+}
+
+// policy returns the retentionPolicy lr sets.
+func (lr logRetention) policy() (retentionPolicy, error) {
+	p := defaultRetention
+	if lr.Count > 0 {
+		p.Count = lr.Count
+	}
+	if lr.MaxAge != "" {
+		d, err := time.ParseDuration(lr.MaxAge)
+		if err != nil {
+			return defaultRetention, fmt.Errorf("invalid log retention: %v", err)
+		}
+		if d > 0 {
+			p.MaxAge = d
+		}
+	}
+	if lr.MaxSize != "" {
+		n, err := humanize.ParseBytes(lr.MaxSize)
+		if err != nil {
+			return defaultRetention, fmt.Errorf("invalid log retention: %v", err)
+		}
+		if n > 0 {
+			p.MaxSize = int64(n)
+		}
+	}
+	return p, nil
+}
+
+// listLogs returns the operation logs in dir, newest first.
+func listLogs(dir string) ([]os.FileInfo, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var logs []os.FileInfo
+	for _, fi := range fis {
+		if fi.Mode().IsRegular() && filepath.Ext(fi.Name()) == ".log" {
+			logs = append(logs, fi)
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].Name() > logs[j].Name() })
+	return logs, nil
+}
+
+// pruneLogs removes the operation logs in dir that p does not keep at time
+// now. The log current is never removed, but counts against the policy.
+func pruneLogs(dir, current string, p retentionPolicy, now time.Time) error {
+	logs, err := listLogs(dir)
+	if err != nil {
+		return err
+	}
+	var size int64
+	for i, fi := range logs {
+		size += fi.Size()
+		lp := filepath.Join(dir, fi.Name())
+		if lp == current {
+			continue
+		}
+		if i < p.Count && now.Sub(fi.ModTime()) <= p.MaxAge && size <= p.MaxSize {
+			continue
+		}
+		if err := os.Remove(lp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type logsCmd struct{}
+
+func (*logsCmd) Name() string     { return "logs" }
+func (*logsCmd) Synopsis() string { return "list the logs of googet operations or print one" }
+func (*logsCmd) Usage() string {
+	return fmt.Sprintf(`%s logs [<log>|last]:
+	Without an argument list the operation logs, newest first. With the name
+	of a log, or last for the newest, print it.
+`, filepath.Base(os.Args[0]))
+}
+
+func (cmd *logsCmd) SetFlags(f *flag.FlagSet) {}
+
+func (cmd *logsCmd) Execute(_ context.Context, flags *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if rootDir == "" {
+		fmt.Fprintf(os.Stderr, "The environment variable %q not defined and no '-root' flag passed.\n", envVar)
+		return subcommands.ExitFailure
+	}
+	if flags.NArg() > 1 {
+		fmt.Fprintf(os.Stderr, "%s\nUsage: %s", cmd.Synopsis(), cmd.Usage())
+		return subcommands.ExitFailure
+	}
+	dir := filepath.Join(rootDir, logsDir)
+	logs, err := listLogs(dir)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Errorf("Error listing logs: %v", err)
+		return subcommands.ExitFailure
+	}
+
+	if flags.NArg() == 0 {
+		for _, fi := range logs {
+			fmt.Printf("%-48s %10s  %s\n", fi.Name(), humanize.IBytes(uint64(fi.Size())), fi.ModTime().Format(time.RFC3339))
+		}
+		return subcommands.ExitSuccess
+	}
+
+	name := flags.Arg(0)
+	if name == "last" {
+		if len(logs) == 0 {
+			fmt.Fprintln(os.Stderr, "No logs.")
+			return subcommands.ExitFailure
+		}
+		name = logs[0].Name()
+	}
+	if name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		fmt.Fprintf(os.Stderr, "Invalid log name %q.\n", name)
+		return subcommands.ExitFailure
+	}
+	if filepath.Ext(name) != ".log" {
+		name += ".log"
+	}
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		logger.Errorf("Error opening log: %v", err)
+		return subcommands.ExitFailure
+	}
+	defer f.Close()
+	if _, err := io.Copy(os.Stdout, f); err != nil {
+		logger.Errorf("Error printing log: %v", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// The owners subcommand reports who owns each installed package that matches the filter.
+// The filter is matched against package names as well as owner names, emails and teams.
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/gooroot"
+	"github.com/google/logger"
+	"github.com/google/subcommands"
+	"golang.org/x/net/context"
+)
+
+type ownersCmd struct{}
+
+func (*ownersCmd) Name() string     { return "owners" }
+func (*ownersCmd) Synopsis() string { return "list owners of installed packages" }
+func (*ownersCmd) Usage() string {
+	return fmt.Sprintf(`%s owners [<filter>]:
+	List the owners of installed packages whose name or owners contain the filter string,
+	if no filter is provided the owners of all installed packages will be listed.
+`, filepath.Base(os.Args[0]))
+}
+
+func (cmd *ownersCmd) SetFlags(f *flag.FlagSet) {}
+
+func (cmd *ownersCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	var filter string
+	switch f.NArg() {
+	case 0:
+		filter = ""
+	case 1:
+		filter = f.Arg(0)
+	default:
+		fmt.Fprintln(os.Stderr, "Excessive arguments")
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	state, err := gooroot.ReadState(filepath.Join(rootDir, stateFile))
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if len(*state) == 0 {
+		fmt.Println("No packages installed.")
+		return subcommands.ExitSuccess
+	}
+
+	pl := ownedPackages(*state, filter)
+	if len(pl) == 0 {
+		fmt.Fprintf(os.Stderr, "No installed package or owner matching filter %q.\n", filter)
+		return subcommands.ExitFailure
+	}
+	for _, ps := range pl {
+		fmt.Printf("%s.%s %s\n", ps.Name, ps.Arch, ps.Version)
+		if len(ps.Owners) == 0 {
+			fmt.Println("  No owners listed")
+			continue
+		}
+		for _, o := range ps.Owners {
+			fmt.Println(" ", o)
+			if o.EscalationURL != "" {
+				fmt.Println("    Escalation:", o.EscalationURL)
+			}
+		}
+	}
+	return subcommands.ExitSuccess
+}
+
+// ownedPackages returns the sorted package specs from state whose name or
+// owners contain filter.
+func ownedPackages(state client.GooGetState, filter string) []*goolib.PkgSpec {
+	filter = strings.ToLower(filter)
+	var pl []*goolib.PkgSpec
+	for _, p := range state {
+		ps := p.PackageSpec
+		if strings.Contains(strings.ToLower(ps.Name+"."+ps.Arch), filter) || ownerMatch(ps.Owners, filter) {
+			pl = append(pl, ps)
+		}
+	}
+	sort.Slice(pl, func(i, j int) bool {
+		return pl[i].Name+"."+pl[i].Arch < pl[j].Name+"."+pl[j].Arch
+	})
+	return pl
+}
+
+func ownerMatch(ol goolib.Owners, filter string) bool {
+	for _, o := range ol {
+		for _, s := range []string{o.Name, o.Email, o.Team} {
+			if strings.Contains(strings.ToLower(s), filter) {
+				return true
+			}
+		}
+	}
+	return false
+}
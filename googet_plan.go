@@ -0,0 +1,192 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// Plans describe the changes install, remove and update are about to make.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/install"
+)
+
+// change is a single package change in a plan. DownloadSize and DiskDelta
+// are 0 when the repo or package does not record the sizes.
+type change struct {
+	Name, Arch   string
+	OldVersion   string `json:",omitempty"`
+	NewVersion   string `json:",omitempty"`
+	Repo         string `json:",omitempty"`
+	DownloadSize int64
+	DiskDelta    int64
+}
+
+// plan is the set of changes an install, remove or update will make.
+type plan struct {
+	Install, Upgrade, Remove []change
+	DownloadSize             int64
+	DiskDelta                int64
+}
+
+// install adds pi, from repo r in rm, to the plan as an install or, if
+// another version is installed, as an upgrade.
+func (p *plan) install(pi goolib.PackageInfo, r string, rm client.RepoMap, state client.GooGetState) error {
+	rs, err := client.FindRepoSpec(pi, rm[r])
+	if err != nil {
+		return err
+	}
+	c := change{
+		Name:         pi.Name,
+		Arch:         pi.Arch,
+		NewVersion:   pi.Ver,
+		Repo:         r,
+		DownloadSize: rs.Size,
+		DiskDelta:    rs.PackageSpec.InstalledSize,
+	}
+	p.DownloadSize += c.DownloadSize
+	p.DiskDelta += c.DiskDelta
+	ps, err := state.GetPackageState(goolib.PackageInfo{Name: pi.Name, Arch: pi.Arch})
+	if err != nil {
+		p.Install = append(p.Install, c)
+		return nil
+	}
+	old := diskUsage(ps)
+	c.OldVersion = ps.PackageSpec.Version
+	c.DiskDelta -= old
+	p.DiskDelta -= old
+	p.Upgrade = append(p.Upgrade, c)
+	return nil
+}
+
+// remove adds the removal of ps to the plan.
+func (p *plan) remove(ps client.PackageState) {
+	c := change{
+		Name:       ps.PackageSpec.Name,
+		Arch:       ps.PackageSpec.Arch,
+		OldVersion: ps.PackageSpec.Version,
+		DiskDelta:  -diskUsage(ps),
+	}
+	p.DiskDelta += c.DiskDelta
+	p.Remove = append(p.Remove, c)
+}
+
+// diskUsage returns the size of the files ps installed that are still on
+// disk, configuration files are not counted as they are kept on removal.
+func diskUsage(ps client.PackageState) int64 {
+	var size int64
+	for f := range ps.InstalledFiles {
+		if fi, err := os.Stat(f); err == nil && fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+	}
+	return size
+}
+
+const (
+	colorReset  = "\x1b[0m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+)
+
+// write writes a human readable form of the plan to w, using ANSI colors if
+// color is set.
+func (p *plan) write(w io.Writer, color bool) {
+	section := func(title, mark, clr string, cs []change) {
+		if len(cs) == 0 {
+			return
+		}
+		fmt.Fprintln(w, title)
+		for _, c := range cs {
+			line := fmt.Sprintf("  %s %s.%s ", mark, c.Name, c.Arch)
+			switch {
+			case c.OldVersion == "":
+				line += c.NewVersion
+			case c.NewVersion == "":
+				line += c.OldVersion
+			default:
+				line += c.OldVersion + " -> " + c.NewVersion
+			}
+			if c.Repo != "" {
+				line += " from " + c.Repo
+			}
+			if color {
+				line = clr + line + colorReset
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+	section("Packages to install:", "+", colorGreen, p.Install)
+	section("Packages to upgrade:", "~", colorYellow, p.Upgrade)
+	section("Packages to remove:", "-", colorRed, p.Remove)
+	if p.DownloadSize > 0 {
+		fmt.Fprintf(w, "Total download size: %s\n", humanize.IBytes(uint64(p.DownloadSize)))
+	}
+	fmt.Fprintf(w, "Disk space change: %s\n", signedBytes(p.DiskDelta))
+}
+
+// signedBytes formats a size change as a human readable, signed string.
+func signedBytes(n int64) string {
+	if n < 0 {
+		return "-" + humanize.IBytes(uint64(-n))
+	}
+	return "+" + humanize.IBytes(uint64(n))
+}
+
+// show prints the plan to stdout, as JSON if -plan_json is set.
+func (p *plan) show() error {
+	if planJSON {
+		b, err := json.MarshalIndent(p, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+	p.write(os.Stdout, useColor())
+	return nil
+}
+
+// showDepError writes the unsatisfiable dependencies of err to w as a JSON
+// line if err is an install.DepError and -plan_json or -messages_json is
+// set, so tools reading that output get them without parsing the log.
+func showDepError(w io.Writer, err error) {
+	var de *install.DepError
+	if !(planJSON || msgJSON) || !errors.As(err, &de) {
+		return
+	}
+	b, err := json.Marshal(de)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(w, string(b))
+}
+
+// useColor reports whether stdout is a terminal that should get colored
+// output. The Windows console does not interpret ANSI escapes by default.
+func useColor() bool {
+	if runtime.GOOS == "windows" || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
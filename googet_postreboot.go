@@ -0,0 +1,147 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// The resume-postreboot subcommand runs the post-reboot actions of packages
+// once the machine has rebooted after they were installed. While actions are
+// pending a scheduled task runs it at startup.
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/gooroot"
+	"github.com/google/googet/msg"
+	"github.com/google/googet/system"
+	"github.com/google/logger"
+	"github.com/google/subcommands"
+	"golang.org/x/net/context"
+)
+
+// maxPostRebootAttempts is how many reboots a failing post-reboot action is
+// run after before it is given up on.
+const maxPostRebootAttempts = 3
+
+// postRebootScheduled is set once this run made sure the post-reboot task
+// exists.
+var postRebootScheduled bool
+
+// schedulePostReboot makes sure resume-postreboot runs at the next startup
+// if a package in state has a post-reboot action pending.
+func schedulePostReboot(state client.GooGetState) {
+	if postRebootScheduled {
+		return
+	}
+	for _, ps := range state {
+		if d := ps.PostReboot; d != nil && d.Attempts < maxPostRebootAttempts {
+			if err := system.SchedulePostReboot([]string{"-root", rootDir, "resume-postreboot"}); err != nil {
+				logger.Errorf("Error scheduling post-reboot actions: %v", err)
+				return
+			}
+			postRebootScheduled = true
+			return
+		}
+	}
+}
+
+// resumePostReboot runs, with run, the pending post-reboot actions in state
+// of packages installed before boot, or all of them if force is set. It
+// returns how many actions are still pending and whether one failed.
+func resumePostReboot(state client.GooGetState, boot time.Time, force bool, run func(client.PackageState) error, rp msg.Reporter) (int, bool) {
+	var pending int
+	var failed, any bool
+	for i := range state {
+		ps := &state[i]
+		d := ps.PostReboot
+		if d == nil || d.Attempts >= maxPostRebootAttempts {
+			continue
+		}
+		any = true
+		spec := ps.PackageSpec
+		if !force && !d.Since.Before(boot) {
+			rp.Info(msg.PostRebootWaiting, spec.Name, spec.Arch, spec.Version)
+			pending++
+			continue
+		}
+		if err := run(*ps); err != nil {
+			d.Attempts++
+			d.Error = err.Error()
+			rp.Info(msg.PostRebootFailed, spec.Name, spec.Arch, spec.Version, d.Attempts, err)
+			if d.Attempts < maxPostRebootAttempts {
+				pending++
+			}
+			failed = true
+			continue
+		}
+		ps.PostReboot = nil
+		rp.Info(msg.PostRebootDone, spec.Name, spec.Arch, spec.Version)
+	}
+	if !any {
+		rp.Info(msg.PostRebootNone)
+	}
+	return pending, failed
+}
+
+type resumePostRebootCmd struct {
+	force bool
+}
+
+func (*resumePostRebootCmd) Name() string { return "resume-postreboot" }
+func (*resumePostRebootCmd) Synopsis() string {
+	return "run the post-reboot actions of packages installed before the last reboot"
+}
+func (*resumePostRebootCmd) Usage() string {
+	return fmt.Sprintf(`%s resume-postreboot [-force]:
+	Run the pending post-reboot actions of packages installed before the last
+	reboot. A scheduled task runs this at startup while actions are pending,
+	failing actions are retried at up to %d startups.
+`, filepath.Base(os.Args[0]), maxPostRebootAttempts)
+}
+
+func (cmd *resumePostRebootCmd) SetFlags(f *flag.FlagSet) {
+	f.BoolVar(&cmd.force, "force", false, "also run the actions of packages installed since the last reboot")
+}
+
+func (cmd *resumePostRebootCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	sf := filepath.Join(rootDir, stateFile)
+	state, err := gooroot.ReadState(sf)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	boot, err := system.BootTime()
+	if err != nil {
+		// Without a boot time every pending action is run, this command
+		// normally only runs at startup.
+		logger.Errorf("Error reading the boot time: %v", err)
+		boot = time.Now()
+	}
+
+	pending, failed := resumePostReboot(*state, boot, cmd.force, system.RunPostReboot, reporter)
+	if err := gooroot.WriteState(state, sf); err != nil {
+		logger.Fatalf("Error writing state file: %v", err)
+	}
+	if pending == 0 {
+		if err := system.UnschedulePostReboot(); err != nil {
+			logger.Infof("Error removing the post-reboot task: %v", err)
+		}
+	}
+	if failed {
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
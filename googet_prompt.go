@@ -0,0 +1,98 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// Prompts ask the user to confirm the changes install, remove and update are
+// about to make, as the confirm setting of the conf file allows.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/googet/msg"
+	"github.com/google/logger"
+)
+
+const (
+	promptAlways   = "always"
+	promptNever    = "never"
+	promptRemovals = "removals"
+	promptAbove    = "above"
+)
+
+// promptPolicy decides which changes are confirmed: all of them, none, only
+// those removing packages or only those changing more than above packages.
+type promptPolicy struct {
+	mode  string
+	above int
+}
+
+// prompts is the policy set in the conf file, -noconfirm overrides it.
+var prompts = promptPolicy{mode: promptAlways}
+
+// parsePromptPolicy parses "always", "never", "removals" or "above N".
+func parsePromptPolicy(s string) (promptPolicy, error) {
+	f := strings.Fields(strings.ToLower(s))
+	switch {
+	case len(f) == 1 && (f[0] == promptAlways || f[0] == promptNever || f[0] == promptRemovals):
+		return promptPolicy{mode: f[0]}, nil
+	case len(f) == 2 && f[0] == promptAbove:
+		n, err := strconv.Atoi(f[1])
+		if err != nil || n < 0 {
+			return promptPolicy{}, fmt.Errorf("invalid confirm setting %q, the package count must be a number of 0 or more", s)
+		}
+		return promptPolicy{mode: promptAbove, above: n}, nil
+	}
+	return promptPolicy{}, fmt.Errorf("invalid confirm setting %q, want always, never, removals or above N", s)
+}
+
+// mayAsk reports whether the policy asks to confirm any change.
+func (pp promptPolicy) mayAsk() bool {
+	return !noConfirm && pp.mode != promptNever
+}
+
+// ask reports whether a change of n packages, removing some if removal is
+// set, has to be confirmed.
+func (pp promptPolicy) ask(n int, removal bool) bool {
+	if !pp.mayAsk() {
+		return false
+	}
+	switch pp.mode {
+	case promptRemovals:
+		return removal
+	case promptAbove:
+		return n > pp.above
+	}
+	return true
+}
+
+// confirm asks the user to confirm a change of n packages with the message
+// id if the policy requires it, and reports whether to go ahead.
+func confirm(n int, removal bool, id msg.ID, args ...interface{}) bool {
+	return !prompts.ask(n, removal) || reporter.Confirm(id, args...)
+}
+
+// confirm shows the plan and asks the user to confirm it with the message id
+// if the policy requires it, and reports whether to go ahead. The plan is
+// always shown with -plan_json.
+func (p *plan) confirm(id msg.ID, args ...interface{}) bool {
+	ask := prompts.ask(len(p.Install)+len(p.Upgrade)+len(p.Remove), len(p.Remove) > 0)
+	if ask || planJSON {
+		if err := p.show(); err != nil {
+			logger.Error(err)
+		}
+	}
+	return !ask || reporter.Confirm(id, args...)
+}
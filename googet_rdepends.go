@@ -0,0 +1,180 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// The rdepends subcommand lists the packages that depend on a package, both
+// installed ones and ones in the repos.
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/gooroot"
+	"github.com/google/logger"
+	"github.com/google/subcommands"
+	"golang.org/x/net/context"
+)
+
+type rdependsCmd struct {
+	sources      string
+	mergeSources bool
+	offline      bool
+}
+
+func (*rdependsCmd) Name() string     { return "rdepends" }
+func (*rdependsCmd) Synopsis() string { return "list the packages that depend on a package" }
+func (*rdependsCmd) Usage() string {
+	return fmt.Sprintf(`%s rdepends [-sources repo1,repo2...] [-offline] <name>:
+	List the installed packages that depend on a package, directly or through
+	other installed packages, and the latest versions of repo packages that
+	depend on it directly.
+`, filepath.Base(os.Args[0]))
+}
+
+func (cmd *rdependsCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.sources, "sources", "", "comma separated list of sources, each optionally followed by ^priority, setting this overrides local .repo files")
+	f.BoolVar(&cmd.mergeSources, "merge-sources", false, "use -sources along with the local .repo files instead of overriding them")
+	f.BoolVar(&cmd.offline, "offline", false, "only list installed packages")
+}
+
+func (cmd *rdependsCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "rdepends takes exactly one package name")
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	pi := goolib.PkgNameSplit(f.Arg(0))
+
+	state, err := gooroot.ReadState(filepath.Join(rootDir, stateFile))
+	if err != nil {
+		logger.Fatal(err)
+	}
+	name := pi.Name
+	if pi.Arch != "" {
+		name += "." + pi.Arch
+	}
+
+	rds := installedRdepends(pi, *state)
+	if len(rds) == 0 {
+		fmt.Printf("No installed packages depend on %s.\n", name)
+	} else {
+		fmt.Printf("Installed packages that depend on %s:\n", name)
+		for _, rd := range rds {
+			fmt.Println(" ", rd)
+		}
+	}
+	if cmd.offline {
+		return subcommands.ExitSuccess
+	}
+
+	repos, err := buildSources(cmd.sources, cmd.mergeSources)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if repos == nil {
+		logger.Fatal("No repos defined, create a .repo file or pass using the -sources flag, or use -offline.")
+	}
+	rds = repoRdepends(pi, availableVersions(repos, nil))
+	if len(rds) == 0 {
+		fmt.Printf("No repo packages depend on %s.\n", name)
+		return subcommands.ExitSuccess
+	}
+	fmt.Printf("Repo packages that depend on %s:\n", name)
+	for _, rd := range rds {
+		fmt.Println(" ", rd)
+	}
+	return subcommands.ExitSuccess
+}
+
+// rdep is a package that depends on another. Via is the installed package
+// the dependency goes through, if it is not direct, and Repo the repo a
+// repo package is in.
+type rdep struct {
+	Name, Arch, Version string
+	Via, Repo           string
+}
+
+func (rd rdep) String() string {
+	s := fmt.Sprintf("%s.%s %s", rd.Name, rd.Arch, rd.Version)
+	if rd.Via != "" {
+		s += " (via " + rd.Via + ")"
+	}
+	if rd.Repo != "" {
+		s += " in " + rd.Repo
+	}
+	return s
+}
+
+// dependsOn reports whether ps depends on pi, any arch of pi matches if its
+// arch is not set.
+func dependsOn(ps *goolib.PkgSpec, pi goolib.PackageInfo) bool {
+	for d := range ps.PkgDependencies {
+		di := goolib.PkgNameSplit(d)
+		if di.Name == pi.Name && (di.Arch == "" || pi.Arch == "" || di.Arch == pi.Arch) {
+			return true
+		}
+	}
+	return false
+}
+
+// installedRdepends returns the packages in state that depend on pi,
+// directly or through other packages in state, sorted by name and arch.
+func installedRdepends(pi goolib.PackageInfo, state client.GooGetState) []rdep {
+	seen := make(map[string]bool)
+	var rds []rdep
+	type target struct {
+		pi  goolib.PackageInfo
+		via string
+	}
+	queue := []target{{pi: pi}}
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+		for _, p := range state {
+			s := p.PackageSpec
+			k := s.Name + "." + s.Arch
+			if seen[k] || (s.Name == pi.Name && (pi.Arch == "" || s.Arch == pi.Arch)) || !dependsOn(s, t.pi) {
+				continue
+			}
+			seen[k] = true
+			rds = append(rds, rdep{Name: s.Name, Arch: s.Arch, Version: s.Version, Via: t.via})
+			queue = append(queue, target{pi: goolib.PackageInfo{Name: s.Name, Arch: s.Arch}, via: k})
+		}
+	}
+	sort.SliceStable(rds, func(i, j int) bool {
+		return rds[i].Name+"."+rds[i].Arch < rds[j].Name+"."+rds[j].Arch
+	})
+	return rds
+}
+
+// repoRdepends returns the latest versions of the packages in rm that
+// depend on pi, sorted by name and arch.
+func repoRdepends(pi goolib.PackageInfo, rm client.RepoMap) []rdep {
+	var rds []rdep
+	for _, e := range client.NewIndex(rm) {
+		s := e.Spec.PackageSpec
+		if dependsOn(s, pi) {
+			rds = append(rds, rdep{Name: s.Name, Arch: s.Arch, Version: s.Version, Repo: e.Repo})
+		}
+	}
+	sort.Slice(rds, func(i, j int) bool {
+		return rds[i].Name+"."+rds[i].Arch < rds[j].Name+"."+rds[j].Arch
+	})
+	return rds
+}
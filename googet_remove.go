@@ -16,13 +16,18 @@ package main
 // The remove subcommand handles the uninstallation of a package.
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/google/googet/client"
 	"github.com/google/googet/goolib"
+	"github.com/google/googet/gooroot"
+	"github.com/google/googet/msg"
 	"github.com/google/googet/remove"
 	"github.com/google/logger"
 	"github.com/google/subcommands"
@@ -30,69 +35,127 @@ import (
 )
 
 type removeCmd struct {
-	dbOnly bool
+	dbOnly    bool
+	filesOnly bool
+	purge     bool
+	force     bool
 }
 
 func (cmd *removeCmd) Name() string     { return "remove" }
-func (cmd *removeCmd) Synopsis() string { return "uninstall a package" }
+func (cmd *removeCmd) Synopsis() string { return "uninstall one or more packages" }
 func (cmd *removeCmd) Usage() string {
-	return fmt.Sprintf("%s remove <name>\n", os.Args[0])
+	return fmt.Sprintf("%s remove <name|pattern>...\n", os.Args[0])
 }
 
 func (cmd *removeCmd) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&cmd.dbOnly, "db_only", false, "only make changes to DB, don't perform uninstall system actions")
+	f.BoolVar(&cmd.filesOnly, "files-only", false, "only delete the files recorded at install time, don't run the uninstall script")
+	f.BoolVar(&cmd.purge, "purge", false, "also delete the package's configuration files")
+	f.BoolVar(&cmd.force, "force-protected", false, "allow removing protected packages")
 }
 
 func (cmd *removeCmd) Execute(_ context.Context, flags *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
 	exitCode := subcommands.ExitSuccess
 
 	sf := filepath.Join(rootDir, stateFile)
-	state, err := readState(sf)
+	state, err := gooroot.ReadState(sf)
 	if err != nil {
 		logger.Error(err)
 	}
 
+	var pis []goolib.PackageInfo
+	seen := make(map[string]bool)
 	for _, arg := range flags.Args() {
-		pi := goolib.PkgNameSplit(arg)
-		var ins []string
-		for _, ps := range *state {
-			if ps.Match(pi) {
-				ins = append(ins, ps.PackageSpec.Name+"."+ps.PackageSpec.Arch)
-			}
-		}
+		ins := matchInstalled(arg, *state)
 		if len(ins) == 0 {
-			logger.Errorf("Package %s.%s not installed, cannot remove.", pi.Name, pi.Arch)
+			logger.Errorf("Package %s not installed, cannot remove.", arg)
 			continue
 		}
-		if len(ins) > 1 {
+		if len(ins) > 1 && !isGlob(arg) {
 			fmt.Fprintf(os.Stderr, "More than one %s installed, chose one of:\n%s\n", arg, ins)
 			return subcommands.ExitFailure
 		}
-		pi = goolib.PkgNameSplit(ins[0])
-		deps, dl := remove.EnumerateDeps(pi, *state)
-		if !noConfirm {
-			var b bytes.Buffer
-			fmt.Fprintln(&b, "The following packages will be removed:")
-			for _, d := range dl {
-				fmt.Fprintln(&b, "  "+d)
+		for _, p := range ins {
+			if !seen[p] {
+				seen[p] = true
+				pis = append(pis, goolib.PkgNameSplit(p))
 			}
-			fmt.Fprintf(&b, "Do you wish to remove %s and all dependencies?", pi.Name)
-			if !confirmation(b.String()) {
-				fmt.Println("canceling removal...")
-				continue
+		}
+	}
+	if len(pis) == 0 {
+		return exitCode
+	}
+
+	var names []string
+	for _, pi := range pis {
+		names = append(names, pi.Name)
+	}
+	deps, dl := remove.EnumerateAllDeps(pis, *state)
+	if err := remove.CheckProtected(deps, cmd.force); err != nil {
+		logger.Errorf("%v, use -force-protected to remove them anyway.", err)
+		return subcommands.ExitFailure
+	}
+	if pp := remove.Protected(deps); len(pp) > 0 {
+		logger.Infof("Removing protected packages %v", pp)
+	}
+	if prompts.mayAsk() || planJSON {
+		p := &plan{}
+		for _, d := range dl {
+			ps, err := state.GetPackageState(goolib.PkgNameSplit(strings.Fields(d)[0]))
+			if err != nil {
+				logger.Error(err)
+				return subcommands.ExitFailure
 			}
+			p.remove(ps)
 		}
-		fmt.Printf("Removing %s and all dependencies...\n", pi.Name)
-		if err = remove.All(pi, deps, state, cmd.dbOnly, proxyServer); err != nil {
-			logger.Errorf("error removing %s, %v", arg, err)
-			exitCode = subcommands.ExitFailure
+		if !p.confirm(msg.RemoveConfirm, strings.Join(names, ", ")) {
+			reporter.Info(msg.RemoveCanceled)
+			return exitCode
+		}
+	}
+	reporter.Info(msg.RemoveStart, strings.Join(names, ", "))
+	err = remove.All(deps, state, cmd.dbOnly, cmd.filesOnly, cmd.purge, proxyServer, reporter)
+	if werr := gooroot.WriteState(state, sf); werr != nil {
+		logger.Fatalf("error writing state file: %v", werr)
+	}
+	if err != nil {
+		logger.Errorf("error removing %s, %v", strings.Join(names, ", "), err)
+		return subcommands.ExitFailure
+	}
+	logger.Infof("Removal of %q and dependant packages completed", names)
+	reporter.Info(msg.RemoveDone, strings.Join(names, ", "))
+	return exitCode
+}
+
+// isGlob reports whether arg is a glob pattern rather than a package name.
+func isGlob(arg string) bool {
+	return strings.ContainsAny(arg, "*?[")
+}
+
+// matchInstalled returns the name.arch of every installed package matching
+// arg, which is either a package name or a glob pattern matched against the
+// name and name.arch of installed packages.
+func matchInstalled(arg string, state client.GooGetState) []string {
+	var ins []string
+	if !isGlob(arg) {
+		pi := goolib.PkgNameSplit(arg)
+		for _, ps := range state {
+			if ps.Match(pi) {
+				ins = append(ins, ps.PackageSpec.Name+"."+ps.PackageSpec.Arch)
+			}
+		}
+		return ins
+	}
+	for _, ps := range state {
+		na := ps.PackageSpec.Name + "." + ps.PackageSpec.Arch
+		if m, _ := path.Match(arg, ps.PackageSpec.Name); m {
+			ins = append(ins, na)
 			continue
 		}
-		logger.Infof("Removal of %q and dependant packages completed", pi.Name)
-		fmt.Printf("Removal of %s completed\n", pi.Name)
-		if err := writeState(state, sf); err != nil {
-			logger.Fatalf("error writing state file: %v", err)
+		if m, _ := path.Match(arg, na); m {
+			ins = append(ins, na)
 		}
 	}
-	return exitCode
+	sort.Strings(ins)
+	return ins
 }
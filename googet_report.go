@@ -0,0 +1,126 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// The report subcommand uploads the package inventory of the machine for
+// fleet reporting.
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/googet/gooroot"
+	"github.com/google/googet/metadata"
+	"github.com/google/googet/report"
+	"github.com/google/logger"
+	"github.com/google/subcommands"
+	"golang.org/x/net/context"
+)
+
+// reportFile holds the inventory sent by the last report.
+const reportFile = "googet.report"
+
+// reportConf sets where reports are uploaded. Interval is how often the
+// agent reports, and MachineID overrides the instance ID or host name
+// reports are keyed by.
+type reportConf struct {
+	Bucket, Prefix, Table string
+	Interval              string
+	MachineID             string
+}
+
+var fleetReport reportConf
+
+func (rc reportConf) enabled() bool {
+	return rc.Bucket != "" || rc.Table != ""
+}
+
+type reportCmd struct{}
+
+func (*reportCmd) Name() string     { return "report" }
+func (*reportCmd) Synopsis() string { return "upload the package inventory for fleet reporting" }
+func (*reportCmd) Usage() string {
+	return fmt.Sprintf("%s report\n", filepath.Base(os.Args[0]))
+}
+
+func (cmd *reportCmd) SetFlags(f *flag.FlagSet) {}
+
+func (cmd *reportCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if !fleetReport.enabled() {
+		fmt.Fprintln(os.Stderr, "No report bucket or table set in the conf file.")
+		return subcommands.ExitFailure
+	}
+	if err := sendReport(fleetReport); err != nil {
+		logger.Error(err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+// sendReport uploads the installed packages, and the changes since the last
+// report, as rc sets.
+func sendReport(rc reportConf) error {
+	state, err := gooroot.ReadState(filepath.Join(rootDir, stateFile))
+	if err != nil {
+		return err
+	}
+	id := rc.MachineID
+	if id == "" {
+		if id, err = metadata.MachineID(); err != nil {
+			return fmt.Errorf("error finding machine ID: %v", err)
+		}
+	}
+	token, err := metadata.Token()
+	if err != nil {
+		return fmt.Errorf("error getting access token: %v", err)
+	}
+	lf := filepath.Join(rootDir, reportFile)
+	last, err := report.ReadLast(lf)
+	if err != nil {
+		logger.Errorf("Error reading last report, reporting no changes: %v", err)
+	}
+	recs := report.Build(id, time.Now().UTC(), *state, last)
+	t := report.Target{Bucket: rc.Bucket, Prefix: rc.Prefix, Table: rc.Table}
+	if err := report.Upload(t, token, id, recs); err != nil {
+		return err
+	}
+	logger.Infof("Reported %d installed packages", len(report.Packages(recs)))
+	return report.WriteLast(lf, recs)
+}
+
+// reportLoop sends a report every interval set in rc, it returns at once if
+// reporting is not enabled.
+func reportLoop(rc reportConf) {
+	if !rc.enabled() {
+		return
+	}
+	interval := 24 * time.Hour
+	if rc.Interval != "" {
+		d, err := time.ParseDuration(rc.Interval)
+		if err != nil || d <= 0 {
+			logger.Errorf("Invalid report interval %q, reporting every %v", rc.Interval, interval)
+		} else {
+			interval = d
+		}
+	}
+	for {
+		if err := sendReport(rc); err != nil {
+			logger.Errorf("Error sending report: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/googet/client"
+	"github.com/google/subcommands"
+	"golang.org/x/net/context"
+)
+
+type repoSetCmd struct{}
+
+func (*repoSetCmd) Name() string     { return "reposet" }
+func (*repoSetCmd) Synopsis() string { return "enable or disable repositories" }
+func (*repoSetCmd) Usage() string {
+	return fmt.Sprintf(`%s reposet enable|disable <name|group>:
+	Enables or disables the named repository, or every repository in the
+	named group, without removing it from its repo file.
+`, filepath.Base(os.Args[0]))
+}
+
+func (cmd *repoSetCmd) SetFlags(f *flag.FlagSet) {}
+
+func (cmd *repoSetCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	switch {
+	case f.NArg() < 2:
+		fmt.Fprintln(os.Stderr, "Not enough arguments")
+		f.Usage()
+		return subcommands.ExitUsageError
+	case f.NArg() > 2:
+		fmt.Fprintln(os.Stderr, "Excessive arguments")
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	var enable bool
+	state := "disabled"
+	switch f.Arg(0) {
+	case "enable":
+		enable = true
+		state = "enabled"
+	case "disable":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown action %q, want enable or disable\n", f.Arg(0))
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	name := f.Arg(1)
+	changed, err := client.EnableRepos(filepath.Join(rootDir, repoDir), name, enable)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return subcommands.ExitFailure
+	}
+	if len(changed) == 0 {
+		fmt.Printf("Nothing to %s, %q is already %s.\n", f.Arg(0), name, state)
+		return subcommands.ExitSuccess
+	}
+	for _, re := range changed {
+		fmt.Printf("Repo %q (%s) %s.\n", re.Name, re.URL, state)
+	}
+	return subcommands.ExitSuccess
+}
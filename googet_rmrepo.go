@@ -20,6 +20,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/google/googet/client"
 	"github.com/google/googet/oswrap"
 	"github.com/google/logger"
 	"github.com/google/subcommands"
@@ -53,14 +54,14 @@ func (cmd *rmRepoCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface
 		return subcommands.ExitUsageError
 	}
 
-	rfs, err := repos(filepath.Join(rootDir, repoDir))
+	rfs, err := client.RepoFiles(filepath.Join(rootDir, repoDir))
 	if err != nil {
 		logger.Fatal(err)
 	}
 
-	var foundRepo repoFile
+	var foundRepo client.RepoFile
 	for _, rf := range rfs {
-		for _, re := range rf.repoEntries {
+		for _, re := range rf.Entries {
 			if strings.ToLower(re.Name) == strings.ToLower(name) {
 				foundRepo = rf
 				break
@@ -68,29 +69,29 @@ func (cmd *rmRepoCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface
 		}
 	}
 
-	if foundRepo.fileName == "" {
+	if foundRepo.Path == "" {
 		fmt.Fprintf(os.Stderr, "Repo %q not found, nothing to remove.\n", name)
 		return subcommands.ExitUsageError
 	}
 
-	var res []repoEntry
-	for _, re := range foundRepo.repoEntries {
+	var res []client.RepoEntry
+	for _, re := range foundRepo.Entries {
 		if strings.ToLower(re.Name) != strings.ToLower(name) {
 			res = append(res, re)
 		}
 	}
 
 	if len(res) > 0 {
-		if err := writeRepoFile(repoFile{foundRepo.fileName, res}); err != nil {
+		if err := client.WriteRepoFile(client.RepoFile{Path: foundRepo.Path, Entries: res}); err != nil {
 			logger.Fatal(err)
 		}
-		fmt.Printf("Removed repo %q from repo file %s.\n", name, foundRepo.fileName)
+		fmt.Printf("Removed repo %q from repo file %s.\n", name, foundRepo.Path)
 		return subcommands.ExitSuccess
 	}
 
-	if err := oswrap.Remove(foundRepo.fileName); err != nil {
+	if err := oswrap.Remove(foundRepo.Path); err != nil {
 		logger.Fatal(err)
 	}
-	fmt.Printf("Removed repo %q and repo file %s.\n", name, foundRepo.fileName)
+	fmt.Printf("Removed repo %q and repo file %s.\n", name, foundRepo.Path)
 	return subcommands.ExitSuccess
 }
@@ -0,0 +1,154 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// Install and update runs end with a summary of what they changed.
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/msg"
+	"github.com/google/logger"
+)
+
+// runSummary is what an install or update run changed, so unattended runs
+// leave a single record to review.
+type runSummary struct {
+	Changed []changedPackage `json:",omitempty"`
+	// RebootRequired are the changed packages whose install is only
+	// finished by a reboot.
+	RebootRequired []string `json:",omitempty"`
+	// Deferred are the changed packages with a post-reboot action pending.
+	Deferred []string `json:",omitempty"`
+	// ServicesRestarted are the services install scripts restarted.
+	ServicesRestarted []string        `json:",omitempty"`
+	Warnings          []scriptWarning `json:",omitempty"`
+	// Log is the GooGet log, install script logs are listed with their
+	// package.
+	Log string
+}
+
+// changedPackage is a package installed or updated by a run.
+type changedPackage struct {
+	Name, Arch, Version string
+	OldVersion          string `json:",omitempty"`
+	// ScriptLog is the output of the install script of the package.
+	ScriptLog string `json:",omitempty"`
+}
+
+// scriptWarning is a warning the install script of a package reported.
+type scriptWarning struct {
+	Package, Warning string
+}
+
+// snapshot returns the installed packages in state by name.arch, to compare
+// the state after a run with.
+func snapshot(state client.GooGetState) map[string]client.PackageState {
+	m := make(map[string]client.PackageState)
+	for _, ps := range state {
+		m[ps.PackageSpec.Name+"."+ps.PackageSpec.Arch] = ps
+	}
+	return m
+}
+
+// summarize returns the summary of a run that changed the installed packages
+// before into state. Packages are listed in the order they were installed.
+func summarize(before map[string]client.PackageState, state client.GooGetState) runSummary {
+	s := runSummary{Log: logPath}
+	for _, ps := range state {
+		spec := ps.PackageSpec
+		old, ok := before[spec.Name+"."+spec.Arch]
+		if ok && old.PackageSpec.Version == spec.Version && old.Checksum == ps.Checksum {
+			continue
+		}
+		c := changedPackage{Name: spec.Name, Arch: spec.Arch, Version: spec.Version}
+		if ok {
+			c.OldVersion = old.PackageSpec.Version
+		}
+		if sr := ps.Script; sr != nil {
+			c.ScriptLog = sr.Log
+			if sr.RebootRequired {
+				s.RebootRequired = append(s.RebootRequired, spec.Name)
+			}
+			for _, svc := range sr.Services {
+				if !goolib.ContainsString(svc, s.ServicesRestarted) {
+					s.ServicesRestarted = append(s.ServicesRestarted, svc)
+				}
+			}
+			for _, w := range sr.Warnings {
+				s.Warnings = append(s.Warnings, scriptWarning{Package: spec.Name, Warning: w})
+			}
+		}
+		if ps.PostReboot != nil {
+			s.Deferred = append(s.Deferred, spec.Name)
+		}
+		s.Changed = append(s.Changed, c)
+	}
+	return s
+}
+
+// report shows the summary s, nothing if the run changed nothing.
+func (s runSummary) report(rp msg.Reporter) {
+	if len(s.Changed) == 0 {
+		return
+	}
+	var changed []string
+	logs := []string{s.Log}
+	for _, c := range s.Changed {
+		changed = append(changed, c.Name+"."+c.Arch+"."+c.Version)
+		if c.ScriptLog != "" {
+			logs = append(logs, c.ScriptLog)
+		}
+	}
+	rp.Info(msg.SummaryChanged, len(s.Changed), strings.Join(changed, ", "))
+	if len(s.RebootRequired) > 0 {
+		rp.Info(msg.SummaryReboot, strings.Join(s.RebootRequired, ", "))
+	}
+	if len(s.Deferred) > 0 {
+		rp.Info(msg.SummaryDeferred, strings.Join(s.Deferred, ", "))
+	}
+	if len(s.ServicesRestarted) > 0 {
+		rp.Info(msg.SummaryServices, strings.Join(s.ServicesRestarted, ", "))
+	}
+	for _, w := range s.Warnings {
+		rp.Info(msg.SummaryWarning, w.Package, w.Warning)
+	}
+	rp.Info(msg.SummaryLogs, strings.Join(logs, ", "))
+}
+
+// writeSummary writes s to p as indented JSON.
+func writeSummary(p string, s runSummary) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, b, 0664)
+}
+
+// finishRun shows the summary of a run that changed the packages before into
+// state and writes it to p, if set.
+func finishRun(before map[string]client.PackageState, state client.GooGetState, p string) {
+	s := summarize(before, state)
+	s.report(reporter)
+	if p == "" {
+		return
+	}
+	if err := writeSummary(p, s); err != nil {
+		logger.Errorf("Error writing run summary: %v", err)
+	}
+}
@@ -14,77 +14,613 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
+	"errors"
+	"flag"
 	"io/ioutil"
+	"net/http"
+	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/googet/client"
+	"github.com/google/googet/download"
 	"github.com/google/googet/goolib"
+	"github.com/google/googet/gooroot"
+	"github.com/google/googet/install"
+	"github.com/google/googet/msg"
 	"github.com/google/googet/oswrap"
+	"github.com/google/googet/remove"
+	"github.com/google/googet/system"
+	"github.com/google/googet/testutil"
+	"github.com/google/googet/update"
+	"github.com/google/subcommands"
 )
 
-func TestRepoList(t *testing.T) {
-	testRepo := "https://foo.com/googet/bar"
+func TestInstalledPackages(t *testing.T) {
+	state := []client.PackageState{
+		{
+			PackageSpec: &goolib.PkgSpec{
+				Name:    "foo",
+				Version: "1.2.3@4",
+				Arch:    "noarch",
+			},
+		},
+		{
+			PackageSpec: &goolib.PkgSpec{
+				Name:    "bar",
+				Version: "0.1.0@1",
+				Arch:    "noarch",
+			},
+		},
+	}
+
+	want := packageMap{"foo.noarch": "1.2.3@4", "bar.noarch": "0.1.0@1"}
+	got := installedPackages(state)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("returned map does not match expected map: got %v, want %v", got, want)
+	}
+}
+
+func TestOwnedPackages(t *testing.T) {
+	foo := &goolib.PkgSpec{Name: "foo", Arch: "noarch", Owners: goolib.Owners{{Name: "someone", Team: "storage"}}}
+	bar := &goolib.PkgSpec{Name: "bar", Arch: "noarch", Owners: goolib.Owners{{Email: "other@example.com"}}}
+	baz := &goolib.PkgSpec{Name: "baz", Arch: "x86_64"}
+	state := client.GooGetState{{PackageSpec: foo}, {PackageSpec: bar}, {PackageSpec: baz}}
+
+	table := []struct {
+		filter string
+		want   []*goolib.PkgSpec
+	}{
+		{"", []*goolib.PkgSpec{bar, baz, foo}},
+		{"ba", []*goolib.PkgSpec{bar, baz}},
+		{"Storage", []*goolib.PkgSpec{foo}},
+		{"other@", []*goolib.PkgSpec{bar}},
+		{"nothing", nil},
+	}
+	for _, tt := range table {
+		if got := ownedPackages(state, tt.filter); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ownedPackages(%q) = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestMatchInstalled(t *testing.T) {
+	state := client.GooGetState{
+		{PackageSpec: &goolib.PkgSpec{Name: "google-tools", Arch: "x86_64"}},
+		{PackageSpec: &goolib.PkgSpec{Name: "google-tools", Arch: "x86_32"}},
+		{PackageSpec: &goolib.PkgSpec{Name: "google-agent", Arch: "noarch"}},
+		{PackageSpec: &goolib.PkgSpec{Name: "other", Arch: "noarch"}},
+	}
+
+	table := []struct {
+		arg  string
+		want []string
+	}{
+		{"other", []string{"other.noarch"}},
+		{"google-tools", []string{"google-tools.x86_64", "google-tools.x86_32"}},
+		{"google-tools.x86_32", []string{"google-tools.x86_32"}},
+		{"google-*", []string{"google-agent.noarch", "google-tools.x86_32", "google-tools.x86_64"}},
+		{"*.x86_64", []string{"google-tools.x86_64"}},
+		{"g?ogle-agent", []string{"google-agent.noarch"}},
+		{"missing*", nil},
+	}
+	for _, tt := range table {
+		if got := matchInstalled(tt.arg, state); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("matchInstalled(%q) = %v, want %v", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestMatchAvailable(t *testing.T) {
+	rm := client.RepoMap{
+		"repo": {
+			{PackageSpec: &goolib.PkgSpec{Name: "chrome-beta", Arch: "x86_64", Version: "1.0.0@1"}},
+			{PackageSpec: &goolib.PkgSpec{Name: "chrome-beta", Arch: "x86_64", Version: "2.0.0@1"}},
+			{PackageSpec: &goolib.PkgSpec{Name: "chrome-stable", Arch: "x86_32", Version: "1.0.0@1"}},
+			{PackageSpec: &goolib.PkgSpec{Name: "chrome-arm", Arch: "arm64", Version: "1.0.0@1"}},
+			{Yanked: true, PackageSpec: &goolib.PkgSpec{Name: "chrome-old", Arch: "noarch", Version: "1.0.0@1"}},
+		},
+	}
+	archs := []string{"noarch", "x86_64", "x86_32"}
+
+	table := []struct {
+		arg  string
+		want []string
+	}{
+		{"chrome-*", []string{"chrome-beta", "chrome-stable"}},
+		{"chrome-*.x86_64", []string{"chrome-beta.x86_64"}},
+		{"*-stable", []string{"chrome-stable"}},
+		{"python*", nil},
+	}
+	for _, tt := range table {
+		if got := matchAvailable(tt.arg, rm, archs); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("matchAvailable(%q) = %v, want %v", tt.arg, got, tt.want)
+		}
+	}
+}
 
+func TestOrderByStage(t *testing.T) {
+	rm := client.RepoMap{
+		"repo": {
+			{PackageSpec: &goolib.PkgSpec{Name: "app", Arch: "noarch", Version: "1.0.0@1"}},
+			{PackageSpec: &goolib.PkgSpec{Name: "certs", Arch: "noarch", Version: "1.0.0@1", InstallStage: goolib.StageEarly}},
+			{PackageSpec: &goolib.PkgSpec{Name: "certs", Arch: "noarch", Version: "2.0.0@1"}},
+			{PackageSpec: &goolib.PkgSpec{Name: "agent", Arch: "x86_64", Version: "1.0.0@1", InstallStage: goolib.StageEarly}},
+			{PackageSpec: &goolib.PkgSpec{Name: "cleanup", Arch: "noarch", Version: "1.0.0@1", InstallStage: goolib.StageLate}},
+		},
+	}
+	archs := []string{"noarch", "x86_64"}
+
+	table := []struct {
+		args, want []string
+	}{
+		{
+			[]string{"cleanup", "app", "agent", "missing", "local.goo"},
+			[]string{"agent", "app", "missing", "local.goo", "cleanup"},
+		},
+		// The latest certs has no stage, certs<2 resolves to the early one.
+		{[]string{"app", "certs"}, []string{"app", "certs"}},
+		{[]string{"app", "certs<2"}, []string{"certs<2", "app"}},
+		{[]string{"app", "certs.noarch.1.0.0@1"}, []string{"certs.noarch.1.0.0@1", "app"}},
+	}
+	for _, tt := range table {
+		got := append([]string(nil), tt.args...)
+		orderByStage(got, rm, archs)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("orderByStage(%v) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestWriteAvailable(t *testing.T) {
+	aps := []availablePackage{
+		{Name: "foo", Arch: "noarch", Version: "1.0.0@1", Repo: "https://example.com/a", Description: "Foo tool\nmore", Owners: goolib.Owners{{Name: "Foo Team"}}},
+		{Name: "bar", Arch: "x86_64", Version: "2.0.0@1", Repo: "https://example.com/b"},
+	}
+	var buf bytes.Buffer
+	writeAvailable(&buf, aps, false)
+	want := "https://example.com/a\n  foo.noarch 1.0.0@1\nhttps://example.com/b\n  bar.x86_64 2.0.0@1\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writeAvailable() = %q, want %q", got, want)
+	}
+	buf.Reset()
+	writeAvailable(&buf, aps[:1], true)
+	want = "https://example.com/a\n  foo.noarch  1.0.0@1  Foo Team  Foo tool\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writeAvailable() with long = %q, want %q", got, want)
+	}
+}
+
+func TestSelectRepos(t *testing.T) {
 	tempDir, err := ioutil.TempDir("", "")
 	if err != nil {
 		t.Fatalf("error creating temp directory: %v", err)
 	}
 	defer oswrap.RemoveAll(tempDir)
+	defer func(r string) { rootDir = r }(rootDir)
+	rootDir = tempDir
+	if err := oswrap.MkdirAll(filepath.Join(tempDir, repoDir), 0774); err != nil {
+		t.Fatal(err)
+	}
+	rf := client.RepoFile{
+		Path:    filepath.Join(tempDir, repoDir, "test.repo"),
+		Entries: []client.RepoEntry{{Name: "stable", URL: "https://example.com/googet/stable-repo"}},
+	}
+	if err := client.WriteRepoFile(rf); err != nil {
+		t.Fatalf("WriteRepoFile: %v", err)
+	}
+
+	repos := []string{"https://example.com/googet/stable-repo", "https://example.com/googet/testing"}
+	for _, names := range [][]string{{"stable"}, {"stable-repo"}, {repos[0]}} {
+		got, err := selectRepos(repos, names)
+		if err != nil {
+			t.Fatalf("selectRepos(%v): %v", names, err)
+		}
+		if !reflect.DeepEqual(got, repos[:1]) {
+			t.Errorf("selectRepos(%v) = %v, want %v", names, got, repos[:1])
+		}
+	}
+	if _, err := selectRepos(repos, []string{"missing"}); err == nil {
+		t.Error("selectRepos of a missing repo did not return an error")
+	}
+}
 
-	testFile := filepath.Join(tempDir, "test.repo")
+func TestBuildSources(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+	defer func(r string) { rootDir = r }(rootDir)
+	rootDir = tempDir
+	if err := oswrap.MkdirAll(filepath.Join(tempDir, repoDir), 0774); err != nil {
+		t.Fatal(err)
+	}
+	rf := client.RepoFile{
+		Path: filepath.Join(tempDir, repoDir, "test.repo"),
+		Entries: []client.RepoEntry{
+			{Name: "stable", URL: "https://example.com/stable"},
+			{Name: "canary", URL: "https://example.com/canary", Priority: 1000},
+		},
+	}
+	if err := client.WriteRepoFile(rf); err != nil {
+		t.Fatalf("WriteRepoFile: %v", err)
+	}
 
-	repoTests := []struct {
-		content []byte
-		result  []string
+	for _, tt := range []struct {
+		desc, sources string
+		merge         bool
+		want          []string
+		priorities    map[string]int
 	}{
-		{[]byte("\n"), nil},
-		{[]byte("# This is just a comment"), nil},
-		{[]byte("url: " + testRepo), []string{testRepo}},
-		{[]byte("\n # Comment\nurl: " + testRepo), []string{testRepo}},
-		{[]byte("- url: " + testRepo), []string{testRepo}},
-		{[]byte("- url: " + testRepo + "\n\n- url: " + testRepo), []string{testRepo, testRepo}},
+		{"repo files", "", false, []string{"https://example.com/stable", "https://example.com/canary"}, map[string]int{"https://example.com/canary": 1000}},
+		{"override", "https://a,https://b", false, []string{"https://a", "https://b"}, map[string]int{"https://a": 500, "https://b": 500}},
+		{"caret", "https://a^1200,https://b", false, []string{"https://a", "https://b"}, map[string]int{"https://a": 1200, "https://b": 500}},
+		{"named", "https://a,priority=canary", false, []string{"https://a"}, map[string]int{"https://a": 1000}},
+		{"merge", "https://a^stable,https://example.com/canary", true, []string{"https://example.com/stable", "https://example.com/canary", "https://a"}, map[string]int{"https://a": 500, "https://example.com/canary": 1000}},
+	} {
+		got, err := buildSources(tt.sources, tt.merge)
+		if err != nil {
+			t.Errorf("%s: buildSources(%q, %t): %v", tt.desc, tt.sources, tt.merge, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: buildSources(%q, %t) = %v, want %v", tt.desc, tt.sources, tt.merge, got, tt.want)
+		}
+		for r, want := range tt.priorities {
+			if p := client.Priority(r); p != want {
+				t.Errorf("%s: priority of %s = %d, want %d", tt.desc, r, p, want)
+			}
+			client.SetPriority(r, 0)
+		}
 	}
 
-	for _, tt := range repoTests {
-		if err := ioutil.WriteFile(testFile, tt.content, 0660); err != nil {
-			t.Fatalf("error writing repo: %v", err)
-		}
-		got, err := repoList(tempDir)
-		if err != nil {
-			t.Fatal(err)
+	for _, s := range []string{"priority=1200", "https://a^", "https://a^0", "https://a^missing", "https://a^1,priority=2"} {
+		if _, err := buildSources(s, false); err == nil {
+			t.Errorf("buildSources(%q) did not return an error", s)
 		}
-		if !reflect.DeepEqual(got, tt.result) {
-			t.Errorf("returned repo does not match expected repo: got %v, want %v", got, testRepo)
+	}
+}
+
+func TestReplacements(t *testing.T) {
+	archs = []string{"noarch", "x86_64", "x86_32"}
+	rm := client.RepoMap{
+		"repo": []goolib.RepoSpec{
+			{PackageSpec: &goolib.PkgSpec{Name: "new_pkg", Version: "2.0.0@1", Arch: "x86_64", Obsoletes: []string{"old_pkg"}}},
+			{PackageSpec: &goolib.PkgSpec{Name: "new_pkg", Version: "2.0.0@1", Arch: "x86_32", Obsoletes: []string{"old_pkg"}}},
+			{PackageSpec: &goolib.PkgSpec{Name: "agent", Version: "1.0.0@1", Arch: "noarch", Obsoletes: []string{"old_agent"}}},
+		},
+	}
+	pm := packageMap{"old_pkg.x86_32": "1.0.0@1", "old_agent.x86_64": "3.0.0@1", "kept_pkg.noarch": "1.0.0@1"}
+
+	got := replacements(pm, rm)
+	want := []replacement{
+		{old: goolib.PackageInfo{Name: "old_agent", Arch: "x86_64", Ver: "3.0.0@1"}, new: goolib.PackageInfo{Name: "agent", Arch: "noarch", Ver: "1.0.0@1"}},
+		{old: goolib.PackageInfo{Name: "old_pkg", Arch: "x86_32", Ver: "1.0.0@1"}, new: goolib.PackageInfo{Name: "new_pkg", Arch: "x86_32", Ver: "2.0.0@1"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("replacements() = %+v, want %+v", got, want)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+	defer func(c string, a []string) { cachePath, archs = c, a }(cachePath, archs)
+	cachePath, archs = filepath.Join(tempDir, "cache"), []string{"noarch"}
+	if err := oswrap.MkdirAll(cachePath, 0774); err != nil {
+		t.Fatal(err)
+	}
+	reporter = msg.Discard
+	defer func() { reporter = msg.NewConsole() }()
+
+	// The renamed package ships the same file as the package it replaces.
+	dst := filepath.Join(tempDir, "app", "tool.txt")
+	r := testutil.NewRepo(t, "repo")
+	defer r.Close()
+	oldRS := r.Add(t, &goolib.PkgSpec{Name: "old", Arch: "noarch", Version: "1.0.0@1", Files: map[string]string{"tool.txt": dst}}, map[string]string{"tool.txt": "old"})
+	newRS := r.Add(t, &goolib.PkgSpec{Name: "new", Arch: "noarch", Version: "2.0.0@1", Obsoletes: []string{"old"}, Files: map[string]string{"tool.txt": dst}}, map[string]string{"tool.txt": "new"})
+	rm := client.RepoMap{r.URL(): {oldRS, newRS}}
+
+	state := &client.GooGetState{}
+	j := &client.Journal{Path: filepath.Join(tempDir, journal)}
+	oldPI := goolib.PackageInfo{Name: "old", Arch: "noarch", Ver: "1.0.0@1"}
+	if err := install.FromRepo(oldPI, r.URL(), cachePath, rm, archs, state, j, false, false, "", msg.Discard); err != nil {
+		t.Fatalf("installing old: %v", err)
+	}
+
+	rp := replacement{old: oldPI, new: goolib.PackageInfo{Name: "new", Arch: "noarch", Ver: "2.0.0@1"}}
+
+	// The old package is kept if the new one can't be downloaded.
+	r.Fail(http.StatusInternalServerError)
+	if err := replace(rp, rm, state, j, false); err == nil {
+		t.Fatal("replace did not fail when the download failed")
+	}
+	if _, err := state.GetPackageState(goolib.PackageInfo{Name: "old", Arch: "noarch"}); err != nil {
+		t.Errorf("obsoleted package old was removed by a failed replace: %v", err)
+	}
+	if b, err := ioutil.ReadFile(dst); err != nil || string(b) != "old" {
+		t.Errorf("%s after a failed replace = %q, %v, want %q", dst, b, err, "old")
+	}
+
+	if err := replace(rp, rm, state, j, false); err != nil {
+		t.Fatalf("replace: %v", err)
+	}
+	if b, err := ioutil.ReadFile(dst); err != nil || string(b) != "new" {
+		t.Errorf("%s after replace = %q, %v, want %q", dst, b, err, "new")
+	}
+	if _, err := state.GetPackageState(goolib.PackageInfo{Name: "old", Arch: "noarch"}); err == nil {
+		t.Error("obsoleted package old is still installed")
+	}
+	if _, err := state.GetPackageState(goolib.PackageInfo{Name: "new", Arch: "noarch"}); err != nil {
+		t.Errorf("replacing package new is not installed: %v", err)
+	}
+
+	// Retrying a replace whose old package is already gone installs the
+	// new package.
+	if err := state.Remove(goolib.PackageInfo{Name: "new", Arch: "noarch"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := replace(rp, rm, state, j, false); err != nil {
+		t.Fatalf("replace without the old package: %v", err)
+	}
+	if _, err := state.GetPackageState(goolib.PackageInfo{Name: "new", Arch: "noarch"}); err != nil {
+		t.Errorf("replacing package new is not installed after a retry: %v", err)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	logPath = "/googet/logs/20261017T020705Z-install.log"
+	ps := func(name, ver, sum string, sr *client.ScriptResult) client.PackageState {
+		return client.PackageState{Checksum: sum, PackageSpec: &goolib.PkgSpec{Name: name, Arch: "noarch", Version: ver}, Script: sr}
+	}
+	before := snapshot(client.GooGetState{
+		ps("same", "1.0.0@1", "a", nil),
+		ps("updated", "1.0.0@1", "b", nil),
+		ps("rebuilt", "1.0.0@1", "c", nil),
+	})
+	state := client.GooGetState{
+		ps("same", "1.0.0@1", "a", &client.ScriptResult{Warnings: []string{"old"}}),
+		ps("updated", "2.0.0@1", "d", &client.ScriptResult{Log: "/updated.log", RebootRequired: true, Services: []string{"spooler"}}),
+		ps("rebuilt", "1.0.0@1", "e", nil),
+		ps("new", "1.0.0@1", "f", &client.ScriptResult{Log: "/new.log", Services: []string{"spooler", "w32time"}, Warnings: []string{"check config"}}),
+	}
+
+	state[3].PostReboot = &client.Deferred{Since: time.Now()}
+
+	got := summarize(before, state)
+	want := runSummary{
+		Changed: []changedPackage{
+			{Name: "updated", Arch: "noarch", Version: "2.0.0@1", OldVersion: "1.0.0@1", ScriptLog: "/updated.log"},
+			{Name: "rebuilt", Arch: "noarch", Version: "1.0.0@1", OldVersion: "1.0.0@1"},
+			{Name: "new", Arch: "noarch", Version: "1.0.0@1", ScriptLog: "/new.log"},
+		},
+		RebootRequired:    []string{"updated"},
+		Deferred:          []string{"new"},
+		ServicesRestarted: []string{"spooler", "w32time"},
+		Warnings:          []scriptWarning{{Package: "new", Warning: "check config"}},
+		Log:               logPath,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("summarize() = %+v, want %+v", got, want)
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	for _, tt := range []struct {
+		res  update.Result
+		want subcommands.ExitStatus
+	}{
+		{update.Result{Updated: 2}, subcommands.ExitSuccess},
+		{update.Result{Updated: 2, Failed: 1}, exitPartial},
+		{update.Result{Failed: 2}, subcommands.ExitFailure},
+	} {
+		if got := exitStatus(tt.res); got != tt.want {
+			t.Errorf("exitStatus(%+v) = %v, want %v", tt.res, got, tt.want)
 		}
 	}
 }
 
-func TestInstalledPackages(t *testing.T) {
-	state := []client.PackageState{
+func TestYankedPackages(t *testing.T) {
+	state := client.GooGetState{
+		{PackageSpec: &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "2.0.0@1"}},
+		{PackageSpec: &goolib.PkgSpec{Name: "bar", Arch: "noarch", Version: "1.0.0@1"}},
+	}
+	rm := client.RepoMap{
+		"repo": []goolib.RepoSpec{
+			{Yanked: true, YankReason: "corrupts data", PackageSpec: &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "2.0.0@1"}},
+			{Yanked: true, YankReason: "broken", PackageSpec: &goolib.PkgSpec{Name: "bar", Arch: "noarch", Version: "2.0.0@1"}},
+			{PackageSpec: &goolib.PkgSpec{Name: "bar", Arch: "noarch", Version: "1.0.0@1"}},
+		},
+	}
+	got := yankedPackages(state, rm)
+	want := []yanked{{Name: "foo", Arch: "noarch", Version: "2.0.0@1", Repo: "repo", Reason: "corrupts data"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("yankedPackages() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dir)
+
+	unpack := filepath.Join(dir, "foo.noarch.1.0.0@1")
+	orphan := filepath.Join(dir, "old.noarch.1.0.0@1")
+	present := filepath.Join(dir, "present")
+	for _, d := range []string{unpack, orphan} {
+		if err := oswrap.Mkdir(d, 0755); err != nil {
+			t.Fatalf("error creating test directory: %v", err)
+		}
+	}
+	for _, f := range []string{present, filepath.Join(dir, "repo.rs")} {
+		if err := ioutil.WriteFile(f, []byte{}, 0666); err != nil {
+			t.Fatalf("error creating test file: %v", err)
+		}
+	}
+	missing := filepath.Join(dir, "missing")
+
+	state := client.GooGetState{
 		{
-			PackageSpec: &goolib.PkgSpec{
-				Name:    "foo",
-				Version: "1.2.3@4",
-				Arch:    "noarch",
-			},
+			PackageSpec:    &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "1.0.0@1", Install: goolib.ExecFile{Path: "install.ps1"}},
+			UnpackDir:      unpack,
+			InstalledFiles: map[string]string{present: "chksum", missing: "chksum"},
 		},
 		{
-			PackageSpec: &goolib.PkgSpec{
-				Name:    "bar",
-				Version: "0.1.0@1",
-				Arch:    "noarch",
-			},
+			PackageSpec: &goolib.PkgSpec{Name: "bar", Arch: "noarch", Version: "1.0.0@1"},
+			UnpackDir:   present,
 		},
 	}
+	rm := client.RepoMap{"repo": []goolib.RepoSpec{{PackageSpec: &goolib.PkgSpec{Name: "bar", Arch: "noarch", Version: "1.0.0@1"}}}}
 
-	want := packageMap{"foo.noarch": "1.2.3@4", "bar.noarch": "0.1.0@1"}
-	got := installedPackages(state)
+	subjects := func(ps []problem) []string {
+		var s []string
+		for _, p := range ps {
+			s = append(s, p.Subject+": "+p.Issue)
+		}
+		return s
+	}
+	cps, err := checkCache(state, dir)
+	if err != nil {
+		t.Fatalf("checkCache: %v", err)
+	}
+	for _, tt := range []struct {
+		name string
+		got  []problem
+		want []string
+	}{
+		{"checkFiles", checkFiles(state), []string{"foo.noarch: " + missing + " is missing"}},
+		{"checkCache", cps, []string{orphan + ": cache entry does not belong to an installed package"}},
+		{"checkUninstallEntries", checkUninstallEntries(state, []string{"bar", "gone"}), []string{
+			"foo.noarch: no uninstall entry in Programs and Features",
+			"GooGet - gone: uninstall entry for a package that is not installed",
+		}},
+		{"checkRepos", checkRepos(state, rm), []string{"foo.noarch: installed version 1.0.0@1 is not in any repo, it cannot be redownloaded"}},
+	} {
+		if got := subjects(tt.got); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
 
+func TestRdepends(t *testing.T) {
+	state := client.GooGetState{
+		{PackageSpec: &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "1.0.0@1"}},
+		{PackageSpec: &goolib.PkgSpec{Name: "bar", Arch: "noarch", Version: "1.0.0@1", PkgDependencies: map[string]string{"foo.noarch": "1.0.0@1"}}},
+		{PackageSpec: &goolib.PkgSpec{Name: "baz", Arch: "x86_64", Version: "2.0.0@1", PkgDependencies: map[string]string{"bar": "1.0.0@1"}}},
+		{PackageSpec: &goolib.PkgSpec{Name: "other", Arch: "noarch", Version: "1.0.0@1", PkgDependencies: map[string]string{"foo.x86_64": "1.0.0@1"}}},
+	}
+	got := installedRdepends(goolib.PackageInfo{Name: "foo", Arch: "noarch"}, state)
+	want := []rdep{
+		{Name: "bar", Arch: "noarch", Version: "1.0.0@1"},
+		{Name: "baz", Arch: "x86_64", Version: "2.0.0@1", Via: "bar.noarch"},
+	}
 	if !reflect.DeepEqual(got, want) {
-		t.Errorf("returned map does not match expected map: got %v, want %v", got, want)
+		t.Errorf("installedRdepends() = %+v, want %+v", got, want)
+	}
+
+	rm := client.RepoMap{
+		"repo": []goolib.RepoSpec{
+			{PackageSpec: &goolib.PkgSpec{Name: "qux", Arch: "noarch", Version: "1.0.0@1", PkgDependencies: map[string]string{"foo": "1.0.0@1"}}},
+			{PackageSpec: &goolib.PkgSpec{Name: "qux", Arch: "noarch", Version: "2.0.0@1"}},
+			{PackageSpec: &goolib.PkgSpec{Name: "quux", Arch: "noarch", Version: "1.0.0@1", PkgDependencies: map[string]string{"foo.noarch": "1.0.0@1"}}},
+		},
+	}
+	got = repoRdepends(goolib.PackageInfo{Name: "foo"}, rm)
+	want = []rdep{{Name: "quux", Arch: "noarch", Version: "1.0.0@1", Repo: "repo"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("repoRdepends() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+	oldFile := filepath.Join(tempDir, "old")
+	if err := ioutil.WriteFile(oldFile, make([]byte, 1024), 0664); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+
+	rm := client.RepoMap{
+		"repo": []goolib.RepoSpec{
+			{Size: 2048, PackageSpec: &goolib.PkgSpec{Name: "new_pkg", Version: "1.0.0@1", Arch: "noarch", InstalledSize: 4096}},
+			{Size: 1024, PackageSpec: &goolib.PkgSpec{Name: "up_pkg", Version: "2.0.0@1", Arch: "noarch", InstalledSize: 3072}},
+		},
+	}
+	state := client.GooGetState{
+		{PackageSpec: &goolib.PkgSpec{Name: "up_pkg", Version: "1.0.0@1", Arch: "noarch"}, InstalledFiles: map[string]string{oldFile: "", tempDir: ""}},
+		{PackageSpec: &goolib.PkgSpec{Name: "rm_pkg", Version: "1.0.0@1", Arch: "noarch"}},
+	}
+
+	p := &plan{}
+	for _, pi := range []goolib.PackageInfo{{Name: "new_pkg", Arch: "noarch", Ver: "1.0.0@1"}, {Name: "up_pkg", Arch: "noarch", Ver: "2.0.0@1"}} {
+		if err := p.install(pi, "repo", rm, state); err != nil {
+			t.Fatalf("plan.install(%v): %v", pi, err)
+		}
+	}
+	p.remove(state[1])
+
+	var b bytes.Buffer
+	p.write(&b, false)
+	want := `Packages to install:
+  + new_pkg.noarch 1.0.0@1 from repo
+Packages to upgrade:
+  ~ up_pkg.noarch 1.0.0@1 -> 2.0.0@1 from repo
+Packages to remove:
+  - rm_pkg.noarch 1.0.0@1
+Total download size: 3.0 KiB
+Disk space change: +6.0 KiB
+`
+	if b.String() != want {
+		t.Errorf("plan.write() =\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestShowDepError(t *testing.T) {
+	rm := client.RepoMap{
+		"repo": []goolib.RepoSpec{
+			{PackageSpec: &goolib.PkgSpec{Name: "app", Version: "1.0.0@1", Arch: "noarch", PkgDependencies: map[string]string{"lib": "2.0.0@1"}}},
+			{PackageSpec: &goolib.PkgSpec{Name: "lib", Version: "1.0.0@1", Arch: "noarch"}},
+		},
+	}
+	_, err := installPlan(goolib.PackageInfo{Name: "app", Arch: "noarch", Ver: "1.0.0@1"}, rm, "repo", []string{"noarch"}, nil)
+	if err == nil {
+		t.Fatal("installPlan did not return an error for an unsatisfiable dependency")
+	}
+
+	defer func() { planJSON, msgJSON = false, false }()
+	var b bytes.Buffer
+	showDepError(&b, err)
+	if b.Len() != 0 {
+		t.Errorf("showDepError without -plan_json or -messages_json wrote %q", b.String())
+	}
+	want := `{"Unsatisfied":[{"Chain":["app.noarch.1.0.0@1"],"Dependency":"lib","MinVersion":"2.0.0@1","Reason":"not installed and only version 1.0.0@1 is available"}]}` + "\n"
+	for _, f := range []*bool{&planJSON, &msgJSON} {
+		planJSON, msgJSON = false, false
+		*f = true
+		b.Reset()
+		showDepError(&b, err)
+		if b.String() != want {
+			t.Errorf("showDepError() = %q, want %q", b.String(), want)
+		}
+	}
+	b.Reset()
+	showDepError(&b, errors.New("some other error"))
+	if b.Len() != 0 {
+		t.Errorf("showDepError of a non-dependency error wrote %q", b.String())
 	}
 }
 
@@ -101,7 +637,7 @@ func TestReadConf(t *testing.T) {
 		t.Fatalf("error creating conf file: %v", err)
 	}
 
-	content := []byte("archs: [noarch, x86_64]\ncachelife: 10m")
+	content := []byte("archs: [noarch, x86_64]\ncachelife: 10m\nprotected: [agent]\ncachedir: /data/cache\nlocations:\n  big:\n    cachedir: /data/big\nscriptcontext: restricted\nscriptcontexts: {trusted: ''}\nreport: {bucket: fleet, prefix: googet, interval: 12h}")
 	if _, err := f.Write(content); err != nil {
 		t.Fatalf("error writing conf file: %v", err)
 	}
@@ -110,6 +646,8 @@ func TestReadConf(t *testing.T) {
 	}
 
 	readConf(confPath)
+	defer system.SetScriptContext("", "")
+	defer func() { fleetReport = reportConf{} }()
 
 	ea := []string{"noarch", "x86_64"}
 	if !reflect.DeepEqual(archs, ea) {
@@ -120,83 +658,268 @@ func TestReadConf(t *testing.T) {
 	if cacheLife != ecl {
 		t.Errorf("readConf did not create expected cacheLife, want: %s, got: %s", ecl, cacheLife)
 	}
+
+	defer remove.SetProtected(nil)
+	if !remove.IsProtected("agent") || !remove.IsProtected("googet") {
+		t.Error("readConf did not protect the packages listed in the conf and googet")
+	}
+
+	if ecp := "/data/cache"; cachePath != ecp {
+		t.Errorf("readConf did not set expected cachePath, want: %s, got: %s", ecp, cachePath)
+	}
+
+	for name, want := range map[string]string{"trusted": "", "other": system.RestrictedContext} {
+		if got := system.ScriptContext(name); got != want {
+			t.Errorf("readConf did not set expected script context for %s, want: %q, got: %q", name, want, got)
+		}
+	}
+
+	if er := (reportConf{Bucket: "fleet", Prefix: "googet", Interval: "12h"}); fleetReport != er {
+		t.Errorf("readConf did not set expected report conf, want: %+v, got: %+v", er, fleetReport)
+	}
 }
 
-func TestRotateLog(t *testing.T) {
+func TestWithDefaults(t *testing.T) {
 	tempDir, err := ioutil.TempDir("", "")
 	if err != nil {
 		t.Fatalf("error creating temp directory: %v", err)
 	}
 	defer oswrap.RemoveAll(tempDir)
 
-	table := []struct {
-		name    string
-		size    int64
-		rotated bool
-	}{
-		{"test1.log", 10 * 1024, true},
-		{"test2.log", 9 * 1024, false},
+	confPath := filepath.Join(tempDir, "test.conf")
+	content := []byte("defaults:\n  update: {db_only: true, tags: [a, b], bogus: 1}\n  install: {reinstall: true}\n  nosuch: {x: y}")
+	if err := ioutil.WriteFile(confPath, content, 0664); err != nil {
+		t.Fatalf("error writing conf file: %v", err)
+	}
+	gc, err := unmarshalConfFile(confPath)
+	if err != nil {
+		t.Fatalf("error reading conf file: %v", err)
 	}
 
-	for _, tt := range table {
-		logPath := filepath.Join(tempDir, tt.name)
-		f, err := oswrap.Create(logPath)
-		if err != nil {
-			t.Fatalf("error creating log file: %v", err)
+	var dbOnly bool
+	var tags []string
+	flags := func(cmd string) *flag.FlagSet {
+		if cmd != "update" && cmd != "install" {
+			return nil
 		}
+		fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+		fs.BoolVar(&dbOnly, "db_only", false, "")
+		fs.Func("tags", "", func(s string) error { tags = append(tags, s); return nil })
+		fs.Bool("reinstall", false, "")
+		return fs
+	}
 
-		if err := f.Truncate(tt.size); err != nil {
-			t.Fatalf("error truncating log file: %v", err)
+	for _, tt := range []struct {
+		args, want []string
+		dbOnly     bool
+		tags       []string
+	}{
+		{[]string{"update"}, []string{"update", "-db_only=true", "-tags=a", "-tags=b"}, true, []string{"a", "b"}},
+		{[]string{"update", "-db_only=false", "pkg"}, []string{"update", "-tags=a", "-tags=b", "-db_only=false", "pkg"}, false, []string{"a", "b"}},
+		// The tags given on the command line replace those of the conf.
+		{[]string{"update", "-tags=c", "-db_only", "pkg"}, []string{"update", "-tags=c", "-db_only", "pkg"}, true, []string{"c"}},
+		// Flags after the first argument are arguments, not flags.
+		{[]string{"update", "pkg", "-tags=c"}, []string{"update", "-db_only=true", "-tags=a", "-tags=b", "pkg", "-tags=c"}, true, []string{"a", "b"}},
+		{[]string{"install", "pkg"}, []string{"install", "-reinstall=true", "pkg"}, false, nil},
+		{[]string{"remove", "pkg"}, []string{"remove", "pkg"}, false, nil},
+		{[]string{"nosuch"}, []string{"nosuch"}, false, nil},
+	} {
+		got := withDefaults(tt.args, gc.Defaults, flags)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("withDefaults(%q) = %q, want %q", tt.args, got, tt.want)
+			continue
 		}
-
-		if err := f.Close(); err != nil {
-			t.Fatalf("error closing log file: %v", err)
+		dbOnly, tags = false, nil
+		if fs := flags(got[0]); fs != nil {
+			if err := fs.Parse(got[1:]); err != nil {
+				t.Errorf("parsing %q: %v", got, err)
+			}
 		}
-
-		if err := rotateLog(logPath, 10*1024); err != nil {
-			t.Errorf("error running rotateLog: %v", err)
+		if dbOnly != tt.dbOnly {
+			t.Errorf("withDefaults(%q): db_only = %t, want %t", tt.args, dbOnly, tt.dbOnly)
+		}
+		if !reflect.DeepEqual(tags, tt.tags) {
+			t.Errorf("withDefaults(%q): tags = %q, want %q", tt.args, tags, tt.tags)
 		}
+	}
 
-		switch tt.rotated {
-		case true:
-			if _, err := oswrap.Stat(logPath); err == nil {
-				t.Error("rotateLog did not rotate log as expected, old log file still exists")
-			}
-			if _, err := oswrap.Stat(logPath + ".old"); err != nil {
-				t.Error("rotateLog did not rotate log as expected, .old file does not exist")
-			}
-		case false:
-			if _, err := oswrap.Stat(logPath); err != nil {
-				t.Error("rotateLog rotated a log we didn't expect")
-			}
+	// Bad flags are left for the subcommand to report.
+	args := []string{"update", "-nosuch"}
+	if got := withDefaults(args, gc.Defaults, flags); !reflect.DeepEqual(got, args) {
+		t.Errorf("withDefaults(%q) = %q, want %q", args, got, args)
+	}
+}
+
+func TestPromptPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		setting string
+		n       int
+		removal bool
+		want    bool
+	}{
+		{"always", 1, false, true},
+		{"never", 10, true, false},
+		{"removals", 10, false, false},
+		{"Removals", 1, true, true},
+		{"above 3", 3, true, false},
+		{"above 3", 4, false, true},
+	} {
+		pp, err := parsePromptPolicy(tt.setting)
+		if err != nil {
+			t.Errorf("parsePromptPolicy(%q): %v", tt.setting, err)
+			continue
+		}
+		if got := pp.ask(tt.n, tt.removal); got != tt.want {
+			t.Errorf("policy %q asks to confirm %d packages (removal %v) = %v, want %v", tt.setting, tt.n, tt.removal, got, tt.want)
+		}
+	}
+	for _, s := range []string{"sometimes", "above", "above -1", "above many"} {
+		if _, err := parsePromptPolicy(s); err == nil {
+			t.Errorf("parsePromptPolicy(%q) did not return an error", s)
 		}
 	}
 }
 
-func TestWriteReadState(t *testing.T) {
-	want := &client.GooGetState{
-		client.PackageState{PackageSpec: &goolib.PkgSpec{Name: "test"}},
+func TestIdentifyHeaders(t *testing.T) {
+	defer func(v string) { version = v }(version)
+	version = "2.17.0@1"
+
+	if h := (identifyConf{}).headers(); len(h) != 0 {
+		t.Errorf("headers() with nothing selected = %v, want none", h)
 	}
+	h := identifyConf{Version: true, Cohorts: []string{"canary", "eu"}}.headers()
+	for k, want := range map[string]string{client.HeaderVersion: "2.17.0@1", client.HeaderCohorts: "canary,eu"} {
+		if got := h.Get(k); got != want {
+			t.Errorf("headers() %s = %q, want %q", k, got, want)
+		}
+	}
+}
 
+func TestMigrateRepo(t *testing.T) {
 	tempDir, err := ioutil.TempDir("", "")
 	if err != nil {
 		t.Fatalf("error creating temp directory: %v", err)
 	}
 	defer oswrap.RemoveAll(tempDir)
 
-	sf := filepath.Join(tempDir, "test.state")
+	old, repl := "https://old.example.com/repo", "https://new.example.com/repo"
+	rf := client.RepoFile{
+		Path:    filepath.Join(tempDir, "test.repo"),
+		Entries: []client.RepoEntry{{Name: "old", URL: old}, {Name: "other", URL: "https://other.example.com/repo"}},
+	}
+	if err := client.WriteRepoFile(rf); err != nil {
+		t.Fatalf("WriteRepoFile: %v", err)
+	}
+	n, err := migrateRepo(tempDir, old, repl)
+	if err != nil {
+		t.Fatalf("migrateRepo: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("migrateRepo() changed %d entries, want 1", n)
+	}
+	got, err := client.UnmarshalRepoFile(rf.Path)
+	if err != nil {
+		t.Fatalf("UnmarshalRepoFile: %v", err)
+	}
+	rf.Entries[0].URL = repl
+	if !reflect.DeepEqual(got, rf) {
+		t.Errorf("repo file after migrateRepo = %+v, want %+v", got, rf)
+	}
+
+	defer func(m []string) { migrateRepos = m }(migrateRepos)
+	migrateRepos = []string{"https://new.example.com/"}
+	if !trustedReplacement(repl) {
+		t.Errorf("trustedReplacement(%q) = false, want true", repl)
+	}
+	if trustedReplacement("https://evil.example.com/repo") {
+		t.Error("trustedReplacement of an untrusted URL = true, want false")
+	}
+}
+
+func TestExtractLimits(t *testing.T) {
+	want := download.DefaultLimits
+	want.MaxBytes = 2 << 30
+	want.MaxFiles = 500
+	got, err := extractLimits{MaxBytes: "2GiB", MaxFiles: 500, MaxFileSize: "0"}.limits()
+	if err != nil {
+		t.Fatalf("limits() returned unexpected error: %v", err)
+	}
+	if got != want {
+		t.Errorf("limits() = %+v, want %+v", got, want)
+	}
 
-	if err := writeState(want, sf); err != nil {
-		t.Errorf("error running writeState: %v", err)
+	if _, err := (extractLimits{MaxFileSize: "lots"}).limits(); err == nil {
+		t.Error("limits() with an invalid size did not return an error")
 	}
+}
 
-	got, err := readState(sf)
+func TestLogRetention(t *testing.T) {
+	got, err := logRetention{Count: 10, MaxAge: "168h"}.policy()
 	if err != nil {
-		t.Errorf("error running readState: %v", err)
+		t.Fatalf("policy: %v", err)
+	}
+	want := retentionPolicy{Count: 10, MaxAge: 168 * time.Hour, MaxSize: defaultRetention.MaxSize}
+	if got != want {
+		t.Errorf("policy() = %+v, want %+v", got, want)
+	}
+	if _, err := (logRetention{MaxSize: "lots"}).policy(); err == nil {
+		t.Error("policy with an invalid size did not return an error")
 	}
+}
 
-	if !reflect.DeepEqual(got, want) {
-		t.Errorf("did not get expected state, got: %+v, want %+v", got, want)
+func TestPruneLogs(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	table := []struct {
+		desc   string
+		policy retentionPolicy
+		want   []string
+	}{
+		{"count", retentionPolicy{Count: 3, MaxAge: time.Hour * 1000, MaxSize: 1 << 20}, []string{"d", "c", "b"}},
+		{"age", retentionPolicy{Count: 10, MaxAge: 36 * time.Hour, MaxSize: 1 << 20}, []string{"d", "c"}},
+		{"size", retentionPolicy{Count: 10, MaxAge: time.Hour * 1000, MaxSize: 250}, []string{"d", "c"}},
+		// The current log is kept even if it is over the policy.
+		{"current", retentionPolicy{Count: 1, MaxAge: time.Hour * 1000, MaxSize: 50}, []string{"d"}},
+	}
+	for _, tt := range table {
+		tempDir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatalf("error creating temp directory: %v", err)
+		}
+		defer oswrap.RemoveAll(tempDir)
+		// Logs a to d, a day apart, d is the current one.
+		var current string
+		for i, c := range []string{"a", "b", "c", "d"} {
+			start := now.Add(time.Duration(i-3) * 24 * time.Hour)
+			p := filepath.Join(tempDir, opLogName(start, c))
+			if err := ioutil.WriteFile(p, make([]byte, 100), 0644); err != nil {
+				t.Fatalf("error writing log: %v", err)
+			}
+			if err := os.Chtimes(p, start, start); err != nil {
+				t.Fatalf("error setting log time: %v", err)
+			}
+			current = p
+		}
+		if err := ioutil.WriteFile(filepath.Join(tempDir, "notes.txt"), nil, 0644); err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+
+		if err := pruneLogs(tempDir, current, tt.policy, now); err != nil {
+			t.Fatalf("%s: pruneLogs: %v", tt.desc, err)
+		}
+		logs, err := listLogs(tempDir)
+		if err != nil {
+			t.Fatalf("%s: listLogs: %v", tt.desc, err)
+		}
+		var got []string
+		for _, fi := range logs {
+			got = append(got, strings.TrimSuffix(fi.Name()[len(logTimeFormat)+1:], ".log"))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: logs kept by pruneLogs = %v, want %v", tt.desc, got, tt.want)
+		}
+		if _, err := oswrap.Stat(filepath.Join(tempDir, "notes.txt")); err != nil {
+			t.Errorf("%s: pruneLogs removed a file that is not a log: %v", tt.desc, err)
+		}
 	}
 }
 
@@ -207,6 +930,7 @@ func TestCleanOld(t *testing.T) {
 		t.Fatalf("error creating temp directory: %v", err)
 	}
 	defer oswrap.RemoveAll(rootDir)
+	cachePath = filepath.Join(rootDir, cacheDir)
 
 	wantDir := filepath.Join(rootDir, cacheDir, "want")
 	notWantDir := filepath.Join(rootDir, cacheDir, "notWant")
@@ -224,7 +948,7 @@ func TestCleanOld(t *testing.T) {
 		},
 	}
 
-	if err := writeState(state, filepath.Join(rootDir, stateFile)); err != nil {
+	if err := gooroot.WriteState(state, filepath.Join(rootDir, stateFile)); err != nil {
 		t.Fatalf("error running writeState: %v", err)
 	}
 
@@ -246,6 +970,7 @@ func TestCleanPackages(t *testing.T) {
 		t.Fatalf("error creating temp directory: %v", err)
 	}
 	defer oswrap.RemoveAll(rootDir)
+	cachePath = filepath.Join(rootDir, cacheDir)
 
 	wantDir := filepath.Join(rootDir, cacheDir, "want")
 	notWantDir := filepath.Join(rootDir, cacheDir, "notWant")
@@ -272,7 +997,7 @@ func TestCleanPackages(t *testing.T) {
 		},
 	}
 
-	if err := writeState(state, filepath.Join(rootDir, stateFile)); err != nil {
+	if err := gooroot.WriteState(state, filepath.Join(rootDir, stateFile)); err != nil {
 		t.Fatalf("error running writeState: %v", err)
 	}
 
@@ -286,3 +1011,42 @@ func TestCleanPackages(t *testing.T) {
 		t.Errorf("cleanPackages did not remove notWantDir")
 	}
 }
+
+func TestResumePostReboot(t *testing.T) {
+	boot := time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC)
+	ps := func(name string, since time.Time, attempts int) client.PackageState {
+		return client.PackageState{
+			PackageSpec: &goolib.PkgSpec{Name: name, Arch: "noarch", Version: "1"},
+			PostReboot:  &client.Deferred{Since: since, Attempts: attempts},
+		}
+	}
+	before, after := boot.Add(-time.Hour), boot.Add(time.Hour)
+	run := func(st client.PackageState) error {
+		if st.PackageSpec.Name == "bad" {
+			return errors.New("failed")
+		}
+		return nil
+	}
+
+	for _, tt := range []struct {
+		desc    string
+		force   bool
+		pending int
+		failed  bool
+		want    []*client.Deferred
+	}{
+		{"after boot", false, 2, true, []*client.Deferred{nil, {Since: after}, {Since: before, Attempts: 1, Error: "failed"}, {Since: before, Attempts: 3}}},
+		{"forced", true, 1, true, []*client.Deferred{nil, nil, {Since: before, Attempts: 1, Error: "failed"}, {Since: before, Attempts: 3}}},
+	} {
+		state := client.GooGetState{ps("done", before, 0), ps("new", after, 0), ps("bad", before, 0), ps("given-up", before, 3)}
+		pending, failed := resumePostReboot(state, boot, tt.force, run, msg.Discard)
+		if pending != tt.pending || failed != tt.failed {
+			t.Errorf("%s: resumePostReboot() = %d, %t, want %d, %t", tt.desc, pending, failed, tt.pending, tt.failed)
+		}
+		for i, ps := range state {
+			if !reflect.DeepEqual(ps.PostReboot, tt.want[i]) {
+				t.Errorf("%s: PostReboot of %s = %+v, want %+v", tt.desc, ps.PackageSpec.Name, ps.PostReboot, tt.want[i])
+			}
+		}
+	}
+}
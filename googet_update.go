@@ -16,50 +16,75 @@ package main
 // The update subcommand handles bulk updating of packages.
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/google/googet/client"
 	"github.com/google/googet/goolib"
+	"github.com/google/googet/gooroot"
 	"github.com/google/googet/install"
+	"github.com/google/googet/msg"
+	"github.com/google/googet/remove"
+	"github.com/google/googet/update"
 	"github.com/google/logger"
 	"github.com/google/subcommands"
 	"golang.org/x/net/context"
 )
 
 type updateCmd struct {
-	dbOnly  bool
-	sources string
+	dbOnly       bool
+	sources      string
+	mergeSources bool
+	useCache     bool
+	reportJSON   string
+	summaryJSON  string
 }
 
+// exitPartial is the exit status of update runs in which some packages were
+// updated and others failed.
+const exitPartial subcommands.ExitStatus = 3
+
 func (*updateCmd) Name() string     { return "update" }
 func (*updateCmd) Synopsis() string { return "update all packages to the latest version available" }
 func (*updateCmd) Usage() string {
-	return fmt.Sprintf("%s update [-sources repo1,repo2...]\n", filepath.Base(os.Args[0]))
+	return fmt.Sprintf(`%s update [-db_only] [-sources repo1,repo2...] [-report_json file] [-summary_json file]:
+	Update all packages to the latest version available. Failures of single
+	packages don't stop the run, packages that failed with a transient error
+	are retried once at the end. Exits with status 1 if every update failed
+	and 3 if only some did.
+`, filepath.Base(os.Args[0]))
 }
 
 func (cmd *updateCmd) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&cmd.dbOnly, "db_only", false, "only make changes to DB, don't perform install system actions")
-	f.StringVar(&cmd.sources, "sources", "", "comma separated list of sources, setting this overrides local .repo files")
+	f.StringVar(&cmd.sources, "sources", "", "comma separated list of sources, each optionally followed by ^priority, setting this overrides local .repo files")
+	f.BoolVar(&cmd.mergeSources, "merge-sources", false, "use -sources along with the local .repo files instead of overriding them")
+	f.BoolVar(&cmd.useCache, "use_cache", false, "use cached repo indexes younger than the cache life instead of checking repos for changes")
+	f.StringVar(&cmd.reportJSON, "report_json", "", "write the outcome of each package update to this file as JSON")
+	f.StringVar(&cmd.summaryJSON, "summary_json", "", "write a summary of the packages changed, reboots needed, services restarted and script warnings to this file as JSON")
 }
 
 func (cmd *updateCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
-	cache := filepath.Join(rootDir, cacheDir)
+	cache := cachePath
 	sf := filepath.Join(rootDir, stateFile)
-	state, err := readState(sf)
+	state, err := gooroot.ReadState(sf)
 	if err != nil {
 		logger.Fatal(err)
 	}
+	before := snapshot(*state)
 
 	pm := installedPackages(*state)
 	if len(pm) == 0 {
-		fmt.Println("No packages installed.")
+		reporter.Info(msg.NoPackages)
 		return subcommands.ExitSuccess
 	}
 
-	repos, err := buildSources(cmd.sources)
+	repos, err := buildSources(cmd.sources, cmd.mergeSources)
 	if err != nil {
 		logger.Fatal(err)
 	}
@@ -67,63 +92,212 @@ func (cmd *updateCmd) Execute(_ context.Context, _ *flag.FlagSet, _ ...interface
 		logger.Fatal("No repos defined, create a .repo file or pass using the -sources flag.")
 	}
 
-	rm := client.AvailableVersions(repos, filepath.Join(rootDir, cacheDir), cacheLife, proxyServer)
-	ud := updates(pm, rm)
-	if ud == nil {
-		fmt.Println("No updates available for any installed packages.")
+	// Updates check every repo for changes, which only downloads the
+	// indexes that changed.
+	if !cmd.useCache && cacheLife > 0 {
+		cacheLife = 0
+	}
+	var names []string
+	for p := range pm {
+		names = append(names, goolib.PkgNameSplit(p).Name)
+	}
+	rm := availableVersions(repos, names)
+	rp := replacements(pm, rm)
+	for _, r := range rp {
+		delete(pm, r.old.Name+"."+r.old.Arch)
+	}
+	ud, dm := update.Select(pm, rm, *state, repos, reporter)
+	if ud == nil && rp == nil {
+		reporter.Info(msg.NoUpdates)
 		return subcommands.ExitSuccess
 	}
 
-	if !noConfirm {
-		if !confirmation("Perform update?") {
-			fmt.Println("Not updating.")
+	if prompts.mayAsk() || planJSON {
+		p, err := updatePlan(ud, dm, rp, rm, *state)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if !p.confirm(msg.UpdateConfirm) {
+			reporter.Info(msg.NotUpdating)
 			return subcommands.ExitSuccess
 		}
 	}
 
-	exitCode := subcommands.ExitFailure
-	for _, pi := range ud {
-		r, err := client.WhatRepo(pi, rm)
+	j := newJournal()
+	tasks := update.Tasks(ud, dm, pm, cache, rm, archs, state, j, cmd.dbOnly, userScope, proxyServer, reporter)
+	for _, r := range rp {
+		r := r
+		repo, err := client.WhatRepo(r.new, rm)
 		if err != nil {
 			logger.Errorf("Error finding repo: %v.", err)
 		}
-		if err := install.FromRepo(pi, r, cache, rm, archs, state, cmd.dbOnly, proxyServer); err != nil {
-			logger.Errorf("Error updating %s %s %s: %v", pi.Arch, pi.Name, pi.Ver, err)
-			exitCode = subcommands.ExitFailure
-			continue
+		tasks = append(tasks, update.Task{
+			Outcome: update.Outcome{Name: r.new.Name, Arch: r.new.Arch, Version: r.new.Ver, OldVersion: r.old.Ver, Repo: repo, Replaces: r.old.Name + "." + r.old.Arch},
+			Run:     func() error { return replace(r, rm, state, j, cmd.dbOnly) },
+		})
+	}
+	res := update.Run(tasks, reporter)
+	for _, o := range res.Packages {
+		if o.Err != nil {
+			showDepError(os.Stdout, o.Err)
 		}
 	}
 
-	if err := writeState(state, sf); err != nil {
+	if err := commitState(state, sf, j); err != nil {
 		logger.Fatalf("Error writing state file: %v", err)
 	}
+	if err := appendHistory(filepath.Join(rootDir, historyFile), res); err != nil {
+		logger.Errorf("Error recording update history: %v", err)
+	}
+	if cmd.reportJSON != "" {
+		if err := writeUpdateReport(cmd.reportJSON, res); err != nil {
+			logger.Errorf("Error writing update report: %v", err)
+		}
+	}
+	reporter.Info(msg.UpdateSummary, res.Updated, res.Failed)
+	finishRun(before, *state, cmd.summaryJSON)
+	return exitStatus(res)
+}
 
-	return exitCode
+// exitStatus is ExitSuccess if every package was updated, ExitFailure if
+// none was and exitPartial otherwise.
+func exitStatus(r update.Result) subcommands.ExitStatus {
+	switch {
+	case r.Failed == 0:
+		return subcommands.ExitSuccess
+	case r.Updated == 0:
+		return subcommands.ExitFailure
+	}
+	return exitPartial
 }
 
-func updates(pm packageMap, rm client.RepoMap) []goolib.PackageInfo {
-	fmt.Println("Searching for available updates...")
-	var ud []goolib.PackageInfo
-	for p, ver := range pm {
-		pi := goolib.PkgNameSplit(p)
-		v, r, _, err := client.FindRepoLatest(pi, rm, archs)
+// appendHistory appends res to the history file p.
+func appendHistory(p string, res update.Result) error {
+	b, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0664)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeUpdateReport writes res to p as indented JSON.
+func writeUpdateReport(p string, res update.Result) error {
+	b, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, b, 0664)
+}
+
+// updatePlan returns the plan for applying the updates ud, made by the
+// decisions dm, and the replacements rp.
+func updatePlan(ud []goolib.PackageInfo, dm map[string]client.Decision, rp []replacement, rm client.RepoMap, state client.GooGetState) (*plan, error) {
+	p := &plan{}
+	for _, pi := range ud {
+		if err := p.install(pi, dm[pi.Name+"."+pi.Arch].Repo, rm, state); err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range rp {
+		repo, err := client.WhatRepo(r.new, rm)
 		if err != nil {
-			// This error is because this installed package is not available in a repo.
-			logger.Info(err)
+			return nil, err
+		}
+		if err := p.install(r.new, repo, rm, state); err != nil {
+			return nil, err
+		}
+		if _, why := obsoletedRemoval(r.old, state); why != "" {
 			continue
 		}
-		c, err := goolib.Compare(v, ver)
+		ps, err := state.GetPackageState(r.old)
 		if err != nil {
-			logger.Error(err)
+			return nil, err
+		}
+		p.remove(ps)
+	}
+	return p, nil
+}
+
+// replacement is an installed package and the package that obsoletes it.
+type replacement struct {
+	old, new goolib.PackageInfo
+}
+
+// replacements returns the installed packages that are obsoleted by a package
+// in rm, along with the latest version of the package replacing them.
+func replacements(pm packageMap, rm client.RepoMap) []replacement {
+	var rp []replacement
+	for p, ver := range pm {
+		pi := goolib.PkgNameSplit(p)
+		n := client.FindObsoleting(pi.Name, rm)
+		if n == "" {
 			continue
 		}
-		if c == 1 {
-			fmt.Printf("  %s, %s --> %s from %s\n", p, ver, v, r)
-			logger.Infof("Update for package %s, %s installed and %s available from %s.", p, ver, v, r)
-			ud = append(ud, goolib.PackageInfo{pi.Name, pi.Arch, v})
+		v, r, a, err := client.FindRepoLatest(goolib.PackageInfo{Name: n, Arch: pi.Arch}, rm, archs)
+		if err != nil {
+			v, r, a, err = client.FindRepoLatest(goolib.PackageInfo{Name: n}, rm, archs)
+		}
+		if err != nil {
+			logger.Error(err)
 			continue
 		}
-		logger.Infof("%s - latest version installed", p)
+		logger.Infof("Package %s, %s installed is obsoleted by %s.%s %s from %s.", p, ver, n, a, v, r)
+		rp = append(rp, replacement{old: goolib.PackageInfo{Name: pi.Name, Arch: pi.Arch, Ver: ver}, new: goolib.PackageInfo{Name: n, Arch: a, Ver: v}})
+	}
+	sort.Slice(rp, func(i, j int) bool { return rp[i].old.Name < rp[j].old.Name })
+	return rp
+}
+
+// replace installs the package replacing an obsoleted package and removes
+// the obsoleted package, unless other packages depend on it or it is
+// protected. The obsoleted package is removed once the new package is
+// downloaded and checked, but before it is installed, because a renamed
+// package usually ships the same files or installer, which the old
+// uninstaller would otherwise remove from under the new package. If the
+// obsoleted package is already gone, as when a failed replace is retried,
+// only the new package is installed.
+func replace(r replacement, rm client.RepoMap, state *client.GooGetState, j *client.Journal, dbOnly bool) error {
+	repo, err := client.WhatRepo(r.new, rm)
+	if err != nil {
+		return err
+	}
+	if _, err := state.GetPackageState(goolib.PackageInfo{Name: r.old.Name, Arch: r.old.Arch}); err != nil {
+		logger.Infof("Obsoleted package %s.%s is no longer installed, installing %s.%s.%s", r.old.Name, r.old.Arch, r.new.Name, r.new.Arch, r.new.Ver)
+		return install.FromRepo(r.new, repo, cachePath, rm, archs, state, j, dbOnly, userScope, proxyServer, reporter)
+	}
+	deps, why := obsoletedRemoval(r.old, *state)
+	if why != "" {
+		logger.Errorf("Keeping obsoleted package %s.%s, %s.", r.old.Name, r.old.Arch, why)
+		return install.FromRepo(r.new, repo, cachePath, rm, archs, state, j, dbOnly, userScope, proxyServer, reporter)
+	}
+	removeOld := func() error {
+		return remove.All(deps, state, dbOnly, false, false, proxyServer, reporter)
+	}
+	if err := install.Replacing(r.new, repo, cachePath, rm, archs, state, j, dbOnly, userScope, proxyServer, reporter, removeOld); err != nil {
+		return err
+	}
+	logger.Infof("Replaced %s.%s.%s with %s.%s.%s", r.old.Name, r.old.Arch, r.old.Ver, r.new.Name, r.new.Arch, r.new.Ver)
+	reporter.Info(msg.Replaced, r.old.Name, r.new.Name)
+	return nil
+}
+
+// obsoletedRemoval returns the packages to remove along with the obsoleted
+// package old, or the reason it has to be kept.
+func obsoletedRemoval(old goolib.PackageInfo, state client.GooGetState) (remove.DepMap, string) {
+	deps, _ := remove.EnumerateDeps(goolib.PackageInfo{Name: old.Name, Arch: old.Arch}, state)
+	if len(deps) > 1 {
+		return nil, fmt.Sprintf("other installed packages depend on it: %v", deps[old.Name+"."+old.Arch])
+	}
+	if remove.IsProtected(old.Name) {
+		return nil, "it is protected"
 	}
-	return ud
+	return deps, ""
 }
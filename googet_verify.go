@@ -0,0 +1,124 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// The verify subcommand checks that the files of installed packages are
+// present and unmodified and runs their verify scripts.
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/gooroot"
+	"github.com/google/googet/msg"
+	"github.com/google/googet/oswrap"
+	"github.com/google/googet/verify"
+	"github.com/google/logger"
+	"github.com/google/subcommands"
+	"golang.org/x/net/context"
+)
+
+type verifyCmd struct {
+	dbOnly  bool
+	workers int
+	report  string
+	format  string
+}
+
+func (*verifyCmd) Name() string     { return "verify" }
+func (*verifyCmd) Synopsis() string { return "verify installed packages" }
+func (*verifyCmd) Usage() string {
+	return fmt.Sprintf(`%s verify [-db_only] [-workers <n>] [-report <file>] [-format json|junit] [<name>...]:
+	Verify the named installed packages, if no names are provided all installed packages will be verified.
+`, filepath.Base(os.Args[0]))
+}
+
+func (cmd *verifyCmd) SetFlags(f *flag.FlagSet) {
+	f.BoolVar(&cmd.dbOnly, "db_only", false, "only check files against the DB, don't run verify scripts")
+	f.IntVar(&cmd.workers, "workers", runtime.NumCPU(), "number of packages to verify in parallel")
+	f.StringVar(&cmd.report, "report", "", "write a report of the results to this file")
+	f.StringVar(&cmd.format, "format", "json", "format of the report file, json or junit")
+}
+
+func (cmd *verifyCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if cmd.format != "json" && cmd.format != "junit" {
+		fmt.Fprintf(os.Stderr, "Unknown report format %q\n", cmd.format)
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	state, err := gooroot.ReadState(filepath.Join(rootDir, stateFile))
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	exitCode := subcommands.ExitSuccess
+	vs := *state
+	if f.NArg() > 0 {
+		vs = nil
+		for _, arg := range f.Args() {
+			ps, err := state.GetPackageState(goolib.PkgNameSplit(arg))
+			if err != nil {
+				logger.Errorf("Package %q not installed, cannot verify.", arg)
+				exitCode = subcommands.ExitFailure
+				continue
+			}
+			vs = append(vs, ps)
+		}
+	}
+	if len(vs) == 0 {
+		reporter.Info(msg.VerifyNone)
+		return exitCode
+	}
+
+	rs := verify.All(client.GooGetState(vs), cmd.workers, cmd.dbOnly)
+	for _, r := range rs {
+		reporter.Info(msg.VerifyPackage, r.Name, r.Arch, r.Version, r.Status)
+		for _, fl := range r.Files {
+			reporter.Info(msg.VerifyFile, fl.Status, fl.Path)
+		}
+		if r.Error != "" {
+			reporter.Info(msg.VerifyError, r.Error)
+		}
+		if r.Status != verify.StatusOK {
+			exitCode = subcommands.ExitFailure
+		}
+	}
+	sum := verify.Summary(rs)
+	reporter.Info(msg.VerifySummary, len(rs), sum[verify.StatusOK], sum[verify.StatusModified], sum[verify.StatusMissing], sum[verify.StatusScriptFailed])
+
+	if cmd.report != "" {
+		rf, err := oswrap.Create(cmd.report)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if cmd.format == "junit" {
+			err = verify.WriteJUnit(rf, rs)
+		} else {
+			err = verify.WriteJSON(rf, rs)
+		}
+		if err != nil {
+			logger.Fatalf("Error writing report: %v", err)
+		}
+		if err := rf.Close(); err != nil {
+			logger.Fatalf("Error writing report: %v", err)
+		}
+	}
+	return exitCode
+}
@@ -0,0 +1,357 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package googetclient lets Go programs drive GooGet in process. A Client
+// installs, removes, updates and queries packages in a GooGet root the way
+// the googet command does, and returns typed results.
+//
+// A Client does not read googet.conf, settings made there are made through
+// the setters of the install, download, remove and system packages instead. Only one
+// operation should run in a process at a time, as GooGet points package
+// scripts at the root through the GooGetRoot environment variable.
+package googetclient
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/gooroot"
+	"github.com/google/googet/install"
+	"github.com/google/googet/msg"
+	"github.com/google/googet/remove"
+	"github.com/google/googet/system"
+	"github.com/google/googet/update"
+)
+
+// These match the layout of a root used by the googet command.
+const (
+	cacheDir = "cache"
+	repoDir  = "repos"
+	envVar   = "GooGetRoot"
+	// healthFile in the cache directory tracks failing repo URLs.
+	healthFile = "repohealth.json"
+)
+
+// Client performs GooGet operations on a root directory. Its fields may be
+// changed between operations.
+type Client struct {
+	Root string
+	// Sources are the repo URLs to use, if empty the repos listed in the
+	// .repo files of the root are used.
+	Sources     []string
+	Archs       []string
+	ProxyServer string
+	// CacheDir holds downloaded packages and repo indexes, the cache
+	// directory of the root is used if it is empty.
+	CacheDir  string
+	CacheLife time.Duration
+	// LockTimeout is how long to wait for the GooGet lock, 0 waits
+	// indefinitely.
+	LockTimeout time.Duration
+	// UserScope installs packages for the current user rather than the
+	// machine.
+	UserScope bool
+	// DBOnly changes the state without running installers or touching
+	// package files.
+	DBOnly bool
+	// ForceProtected allows removing protected packages, see
+	// remove.SetProtected.
+	ForceProtected bool
+	// GooGetExe is the googet executable the uninstall entries of installed
+	// packages run, googet.exe in Root is used if it is empty.
+	GooGetExe string
+	Reporter  msg.Reporter
+}
+
+// New returns a Client for the root with the defaults of the googet
+// command, it reports nothing.
+func New(root string) (*Client, error) {
+	archs, err := system.InstallableArchs()
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		Root:        root,
+		Archs:       archs,
+		CacheLife:   3 * time.Minute,
+		LockTimeout: 70 * time.Second,
+		Reporter:    msg.Discard,
+	}, nil
+}
+
+// Package is a version of a package, Repo is set for available packages.
+type Package struct {
+	Name, Arch, Version string
+	Repo                string `json:",omitempty"`
+}
+
+func (p Package) String() string {
+	return p.Name + "." + p.Arch + "." + p.Version
+}
+
+// Result lists the packages an operation changed. Upgraded packages are
+// listed as installed at their new version.
+type Result struct {
+	Installed, Removed []Package
+}
+
+// Installed returns the installed packages.
+func (c *Client) Installed() ([]Package, error) {
+	state, err := gooroot.ReadState(c.stateFile())
+	if err != nil {
+		return nil, err
+	}
+	var pl []Package
+	for _, ps := range *state {
+		pl = append(pl, Package{Name: ps.PackageSpec.Name, Arch: ps.PackageSpec.Arch, Version: ps.PackageSpec.Version})
+	}
+	sortPackages(pl)
+	return pl, nil
+}
+
+// Available returns every package version available from the repos.
+func (c *Client) Available() ([]Package, error) {
+	rm, _, err := c.repoMap()
+	if err != nil {
+		return nil, err
+	}
+	var pl []Package
+	for r, rss := range rm {
+		for _, rs := range rss {
+			pl = append(pl, Package{Name: rs.PackageSpec.Name, Arch: rs.PackageSpec.Arch, Version: rs.PackageSpec.Version, Repo: r})
+		}
+	}
+	sortPackages(pl)
+	return pl, nil
+}
+
+// Latest returns the latest version of the package name, given as name or
+// name.arch, available from the repos.
+func (c *Client) Latest(name string) (Package, error) {
+	rm, _, err := c.repoMap()
+	if err != nil {
+		return Package{}, err
+	}
+	pi := goolib.PkgNameSplit(name)
+	ver, repo, arch, err := client.FindRepoLatest(pi, rm, c.Archs)
+	if err != nil {
+		return Package{}, err
+	}
+	return Package{Name: pi.Name, Arch: arch, Version: ver, Repo: repo}, nil
+}
+
+// Install installs packages and their dependencies from the repos. Each
+// package is given as name, name.arch or name.arch.version, the latest
+// version is installed if none is given. Installed packages at the
+// requested version are left alone. Install stops at the first package
+// that fails, the packages installed until then are returned along with
+// the error.
+func (c *Client) Install(names ...string) (*Result, error) {
+	rm, _, err := c.repoMap()
+	if err != nil {
+		return nil, err
+	}
+	return c.do(func(state *client.GooGetState, j *client.Journal) error {
+		for _, n := range names {
+			pi := goolib.PkgNameSplit(n)
+			if pi.Ver == "" {
+				if err := install.Latest(pi, c.cache(), rm, c.Archs, state, j, c.DBOnly, c.UserScope, c.ProxyServer, c.Reporter); err != nil {
+					return fmt.Errorf("error installing %s: %v", n, err)
+				}
+				continue
+			}
+			if pi.Arch == "" {
+				return fmt.Errorf("error installing %s: a version requires an arch", n)
+			}
+			repo, err := client.WhatRepo(pi, rm)
+			if err != nil {
+				return fmt.Errorf("error installing %s: %v", n, err)
+			}
+			if err := install.FromRepo(pi, repo, c.cache(), rm, c.Archs, state, j, c.DBOnly, c.UserScope, c.ProxyServer, c.Reporter); err != nil {
+				return fmt.Errorf("error installing %s: %v", n, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Remove removes installed packages, given as name or name.arch, and the
+// packages that depend on them. Nothing is removed if they include protected
+// packages, unless c.ForceProtected is set; the error is then a
+// *remove.ProtectedError.
+func (c *Client) Remove(names ...string) (*Result, error) {
+	return c.do(func(state *client.GooGetState, j *client.Journal) error {
+		var pis []goolib.PackageInfo
+		for _, n := range names {
+			pi := goolib.PkgNameSplit(n)
+			ps, err := state.GetPackageState(goolib.PackageInfo{Name: pi.Name, Arch: pi.Arch})
+			if err != nil {
+				return fmt.Errorf("error removing %s: %v", n, err)
+			}
+			pis = append(pis, goolib.PackageInfo{Name: ps.PackageSpec.Name, Arch: ps.PackageSpec.Arch})
+		}
+		deps, _ := remove.EnumerateAllDeps(pis, *state)
+		if err := remove.CheckProtected(deps, c.ForceProtected); err != nil {
+			return err
+		}
+		return remove.All(deps, state, c.DBOnly, false, false, c.ProxyServer, c.Reporter)
+	})
+}
+
+// Update updates every installed package the way the googet command does:
+// versions are picked by repo priority and the decisions of earlier updates,
+// see client.ShouldUpdate, and a package that fails does not stop the
+// others. Packages replacing obsolete ones are not installed, unlike with the
+// googet command. The error lists the packages that failed.
+func (c *Client) Update() (*Result, error) {
+	rm, srcs, err := c.repoMap()
+	if err != nil {
+		return nil, err
+	}
+	return c.do(func(state *client.GooGetState, j *client.Journal) error {
+		installed := make(map[string]string)
+		for _, ps := range *state {
+			installed[ps.PackageSpec.Name+"."+ps.PackageSpec.Arch] = ps.PackageSpec.Version
+		}
+		ud, dm := update.Select(installed, rm, *state, srcs, c.Reporter)
+		res := update.Run(update.Tasks(ud, dm, installed, c.cache(), rm, c.Archs, state, j, c.DBOnly, c.UserScope, c.ProxyServer, c.Reporter), c.Reporter)
+		var failed []string
+		for _, o := range res.Packages {
+			if o.Err != nil {
+				failed = append(failed, fmt.Sprintf("%s.%s to %s: %v", o.Name, o.Arch, o.Version, o.Err))
+			}
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("error updating %s", strings.Join(failed, "; "))
+		}
+		return nil
+	})
+}
+
+func (c *Client) cache() string {
+	if c.CacheDir != "" {
+		return c.CacheDir
+	}
+	return filepath.Join(c.Root, cacheDir)
+}
+
+// repoMap returns the packages available from the repos, and the repos:
+// c.Sources or, if it is empty, the repos listed in the .repo files of the
+// root.
+func (c *Client) repoMap() (client.RepoMap, []string, error) {
+	srcs := c.Sources
+	if len(srcs) == 0 {
+		var err error
+		if srcs, err = client.RepoList(filepath.Join(c.Root, repoDir)); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(srcs) == 0 {
+		return nil, nil, fmt.Errorf("no repos defined in %s", filepath.Join(c.Root, repoDir))
+	}
+	if err := os.MkdirAll(c.cache(), 0774); err != nil {
+		return nil, nil, err
+	}
+	client.SetHealthFile(filepath.Join(c.cache(), healthFile))
+	return client.AvailableVersions(srcs, c.cache(), c.CacheLife, c.ProxyServer), srcs, nil
+}
+
+func (c *Client) stateFile() string {
+	return filepath.Join(c.Root, gooroot.StateFile)
+}
+
+// do runs f on the state of the root while holding the GooGet lock, after
+// finishing any transitions left in the journal, and writes the state f
+// leaves even if it fails. It returns the packages f changed.
+func (c *Client) do(f func(*client.GooGetState, *client.Journal) error) (*Result, error) {
+	if c.Reporter == nil {
+		c.Reporter = msg.Discard
+	}
+	if err := os.MkdirAll(c.cache(), 0774); err != nil {
+		return nil, err
+	}
+	if err := os.Setenv(envVar, c.Root); err != nil {
+		return nil, err
+	}
+	exe := c.GooGetExe
+	if exe == "" {
+		exe = filepath.Join(c.Root, "googet.exe")
+	}
+	system.SetGooGetExe(exe)
+	// The lock is taken in turn with googet commands waiting for it.
+	lf := filepath.Join(c.Root, gooroot.LockFile)
+	lk, err := gooroot.Lock(lf, gooroot.LockInfo{PID: os.Getpid(), Command: filepath.Base(os.Args[0]), Start: time.Now()}, c.LockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(lf)
+	defer lk.Close()
+
+	j := &client.Journal{Path: filepath.Join(c.Root, gooroot.JournalFile)}
+	state, err := gooroot.ReadState(c.stateFile())
+	if err != nil {
+		return nil, err
+	}
+	if err := install.Recover(j, state); err != nil {
+		return nil, err
+	}
+	if err := gooroot.CommitState(state, c.stateFile(), j); err != nil {
+		return nil, err
+	}
+
+	old := make(map[string]string)
+	for _, ps := range *state {
+		old[ps.PackageSpec.Name+"."+ps.PackageSpec.Arch] = ps.PackageSpec.Version
+	}
+	err = f(state, j)
+	if cErr := gooroot.CommitState(state, c.stateFile(), j); cErr != nil && err == nil {
+		err = cErr
+	}
+
+	res := &Result{}
+	for _, ps := range *state {
+		k := ps.PackageSpec.Name + "." + ps.PackageSpec.Arch
+		if v, ok := old[k]; !ok || v != ps.PackageSpec.Version {
+			res.Installed = append(res.Installed, Package{Name: ps.PackageSpec.Name, Arch: ps.PackageSpec.Arch, Version: ps.PackageSpec.Version})
+		}
+		delete(old, k)
+	}
+	for k, v := range old {
+		pi := goolib.PkgNameSplit(k)
+		res.Removed = append(res.Removed, Package{Name: pi.Name, Arch: pi.Arch, Version: v})
+	}
+	sortPackages(res.Installed)
+	sortPackages(res.Removed)
+	return res, err
+}
+
+func sortPackages(pl []Package) {
+	sort.Slice(pl, func(i, j int) bool {
+		if pl[i].Name != pl[j].Name {
+			return pl[i].Name < pl[j].Name
+		}
+		if pl[i].Arch != pl[j].Arch {
+			return pl[i].Arch < pl[j].Arch
+		}
+		if pl[i].Version != pl[j].Version {
+			return pl[i].Version < pl[j].Version
+		}
+		return pl[i].Repo < pl[j].Repo
+	})
+}
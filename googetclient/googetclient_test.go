@@ -0,0 +1,116 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package googetclient
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+	"github.com/google/googet/remove"
+	"github.com/google/googet/testutil"
+	"github.com/google/logger"
+)
+
+func init() {
+	logger.Init("test", true, false, ioutil.Discard)
+}
+
+func TestClient(t *testing.T) {
+	root, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(root)
+
+	r := testutil.NewRepo(t, "repo")
+	defer r.Close()
+	r.Add(t, &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "1.0.0@1"}, nil)
+	r.Add(t, &goolib.PkgSpec{Name: "bar", Arch: "noarch", Version: "1.0.0@1", PkgDependencies: map[string]string{"foo": "1.0.0@1"}}, nil)
+
+	c, err := New(root)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	c.Sources = []string{r.URL()}
+	c.CacheLife = 0
+
+	foo1 := Package{Name: "foo", Arch: "noarch", Version: "1.0.0@1"}
+	foo2 := Package{Name: "foo", Arch: "noarch", Version: "2.0.0@1"}
+	bar1 := Package{Name: "bar", Arch: "noarch", Version: "1.0.0@1"}
+
+	res, err := c.Install("bar")
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if want := (&Result{Installed: []Package{bar1, foo1}}); !reflect.DeepEqual(res, want) {
+		t.Errorf("Install() = %+v, want %+v", res, want)
+	}
+	if got, err := c.Installed(); err != nil || !reflect.DeepEqual(got, []Package{bar1, foo1}) {
+		t.Errorf("Installed() = %+v, %v, want %+v", got, err, []Package{bar1, foo1})
+	}
+
+	r.Add(t, &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "2.0.0@1"}, nil)
+	if got, err := c.Latest("foo"); err != nil || got != (Package{Name: "foo", Arch: "noarch", Version: "2.0.0@1", Repo: r.URL()}) {
+		t.Errorf("Latest(foo) = %+v, %v, want version 2.0.0@1 from %s", got, err, r.URL())
+	}
+	res, err = c.Update()
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if want := (&Result{Installed: []Package{foo2}}); !reflect.DeepEqual(res, want) {
+		t.Errorf("Update() = %+v, want %+v", res, want)
+	}
+
+	// A package that fails to update does not stop the others.
+	r.Add(t, &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "3.0.0@1", PkgDependencies: map[string]string{"missing": "1.0.0@1"}}, nil)
+	r.Add(t, &goolib.PkgSpec{Name: "bar", Arch: "noarch", Version: "2.0.0@1", PkgDependencies: map[string]string{"foo": "1.0.0@1"}}, nil)
+	bar2 := Package{Name: "bar", Arch: "noarch", Version: "2.0.0@1"}
+	res, err = c.Update()
+	if err == nil || !strings.Contains(err.Error(), "foo.noarch to 3.0.0@1") {
+		t.Errorf("Update() with a failing package returned error %v, want one naming foo.noarch", err)
+	}
+	if want := (&Result{Installed: []Package{bar2}}); !reflect.DeepEqual(res, want) {
+		t.Errorf("Update() = %+v, want %+v", res, want)
+	}
+
+	// bar is protected and removed along with foo, which it depends on.
+	defer remove.SetProtected(nil)
+	remove.SetProtected([]string{"bar"})
+	if _, err := c.Remove("foo"); err == nil {
+		t.Fatal("Remove of a protected package returned no error")
+	} else if _, ok := err.(*remove.ProtectedError); !ok {
+		t.Errorf("Remove of a protected package returned %v, want a ProtectedError", err)
+	}
+	if got, err := c.Installed(); err != nil || !reflect.DeepEqual(got, []Package{bar2, foo2}) {
+		t.Errorf("Installed() after a refused remove = %+v, %v, want %+v", got, err, []Package{bar2, foo2})
+	}
+	c.ForceProtected = true
+	res, err = c.Remove("foo")
+	if err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if want := (&Result{Removed: []Package{bar2, foo2}}); !reflect.DeepEqual(res, want) {
+		t.Errorf("Remove() = %+v, want %+v", res, want)
+	}
+	if _, err := c.Remove("foo"); err == nil {
+		t.Error("Remove of a package that is not installed returned no error")
+	}
+	if got, err := c.Installed(); err != nil || len(got) != 0 {
+		t.Errorf("Installed() = %+v, %v, want none", got, err)
+	}
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// The gooindex binary writes the index of a directory of GooGet packages so
+// the repo can be published by any static web host.
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/google/googet/index"
+	"github.com/google/logger"
+)
+
+var (
+	root      = flag.String("root", "", "root of the site, packages are read from <root>/packages")
+	repoName  = flag.String("repo_name", "repo", "name of the repo, the index is written to <root>/<repo_name>")
+	chunkSize = flag.Int("chunk_packages", 0, "also split the index into chunks of about this many package names, listed in index.manifest, 0 to write a single index")
+	verbose   = flag.Bool("verbose", false, "print info level logs to stdout")
+	systemLog = flag.Bool("system_log", false, "log to Linux Syslog or Windows Event Log")
+)
+
+func main() {
+	flag.Parse()
+
+	logger.Init("GooIndex", *verbose, *systemLog, ioutil.Discard)
+
+	rs, err := index.Scan(filepath.Join(*root, "packages"), "packages")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	dir := filepath.Join(*root, *repoName)
+	if *chunkSize > 0 {
+		err = index.WriteChunked(dir, rs, *chunkSize)
+	} else {
+		err = index.Write(dir, rs)
+	}
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Infof("Wrote index of %d packages to %s", len(rs), dir)
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package goolib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// constraintOps are the operators of version constraints, longest first so
+// they are matched greedily.
+var constraintOps = []string{">=", "<=", "!=", "==", ">", "<", "="}
+
+// Constraint is a condition on a package version, such as ">=1.2",
+// "<2.0.0@3" or "=1.4.*". Versions without a release, the part after the @,
+// are compared on the semantic version alone and missing minor and patch
+// numbers are 0. A version ending in .* matches every version starting with
+// it and can only be used with = and !=.
+type Constraint struct {
+	Op, Ver string
+}
+
+func (c Constraint) String() string {
+	return c.Op + c.Ver
+}
+
+// Constraints are met by versions that meet all of them.
+type Constraints []Constraint
+
+func (cs Constraints) String() string {
+	var s []string
+	for _, c := range cs {
+		s = append(s, c.String())
+	}
+	return strings.Join(s, " ")
+}
+
+// Match reports whether ver meets every constraint.
+func (cs Constraints) Match(ver string) bool {
+	for _, c := range cs {
+		if !c.match(ver) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Constraint) match(ver string) bool {
+	v, err := ParseVersion(ver)
+	if err != nil {
+		return false
+	}
+	if p := strings.TrimSuffix(c.Ver, ".*"); p != c.Ver {
+		m := hasPrefix(v, p)
+		return m == (c.Op == "=")
+	}
+	want, err := ParseVersion(padVer(c.Ver))
+	if err != nil {
+		return false
+	}
+	cmp := v.Semver.Compare(want.Semver)
+	if cmp == 0 && strings.Contains(c.Ver, "@") {
+		switch {
+		case v.GsVer > want.GsVer:
+			cmp = 1
+		case v.GsVer < want.GsVer:
+			cmp = -1
+		}
+	}
+	switch c.Op {
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case "!=":
+		return cmp != 0
+	default:
+		return cmp == 0
+	}
+}
+
+// hasPrefix reports whether the dot separated numbers in p are the leading
+// numbers of v.
+func hasPrefix(v Version, p string) bool {
+	nums := []uint64{v.Semver.Major, v.Semver.Minor, v.Semver.Patch}
+	for i, s := range strings.Split(p, ".") {
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || i >= len(nums) || nums[i] != n {
+			return false
+		}
+	}
+	return true
+}
+
+// padVer adds the minor and patch numbers missing from ver as 0, unlike
+// ParseVersion which treats 1.2 as 0.1.2.
+func padVer(ver string) string {
+	v := strings.SplitN(ver, "@", 2)
+	if n := strings.Count(v[0], "."); n < 2 {
+		v[0] += strings.Repeat(".0", 2-n)
+	}
+	return strings.Join(v, "@")
+}
+
+// ParseConstraints parses whitespace or comma separated constraints, such
+// as ">=1.2 <2.0".
+func ParseConstraints(s string) (Constraints, error) {
+	var cs Constraints
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		var op string
+		for _, o := range constraintOps {
+			if strings.HasPrefix(f, o) {
+				op = o
+				break
+			}
+		}
+		if op == "" {
+			return nil, fmt.Errorf("version constraint %q has no operator", f)
+		}
+		ver := strings.TrimPrefix(f, op)
+		// Allow a space between the operator and the version.
+		if ver == "" && i+1 < len(fields) {
+			i++
+			ver = fields[i]
+		}
+		if ver == "" {
+			return nil, fmt.Errorf("version constraint %q has no version", f)
+		}
+		if op == "==" {
+			op = "="
+		}
+		c := Constraint{Op: op, Ver: ver}
+		if p := strings.TrimSuffix(ver, ".*"); p != ver {
+			if op != "=" && op != "!=" {
+				return nil, fmt.Errorf("version constraint %q: wildcards can only be used with = and !=", c)
+			}
+			if _, err := ParseVersion(padVer(p)); err != nil {
+				return nil, fmt.Errorf("version constraint %q: %v", c, err)
+			}
+		} else if _, err := ParseVersion(padVer(ver)); err != nil {
+			return nil, fmt.Errorf("version constraint %q: %v", c, err)
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+// SplitConstraints splits a package argument such as "foo>=1.2 <2.0" into
+// the package, "foo", and its version constraints. Arguments without
+// constraints return nil constraints.
+func SplitConstraints(arg string) (string, Constraints, error) {
+	i := strings.IndexAny(arg, "<>=!")
+	if i == -1 {
+		return strings.TrimSpace(arg), nil, nil
+	}
+	cs, err := ParseConstraints(arg[i:])
+	if err != nil {
+		return "", nil, err
+	}
+	return strings.TrimSpace(arg[:i]), cs, nil
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package goolib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitConstraints(t *testing.T) {
+	for _, tc := range []struct {
+		arg, name string
+		cs        Constraints
+	}{
+		{"foo", "foo", nil},
+		{"foo.x86_64.1.2.3@4", "foo.x86_64.1.2.3@4", nil},
+		{"foo>=1.2 <2.0", "foo", Constraints{{">=", "1.2"}, {"<", "2.0"}}},
+		{"foo.noarch >= 1.2, != 1.3.0", "foo.noarch", Constraints{{">=", "1.2"}, {"!=", "1.3.0"}}},
+		{"foo==1.4.*", "foo", Constraints{{"=", "1.4.*"}}},
+	} {
+		name, cs, err := SplitConstraints(tc.arg)
+		if err != nil {
+			t.Errorf("SplitConstraints(%q): %v", tc.arg, err)
+			continue
+		}
+		if name != tc.name || !reflect.DeepEqual(cs, tc.cs) {
+			t.Errorf("SplitConstraints(%q) = %q, %v, want %q, %v", tc.arg, name, cs, tc.name, tc.cs)
+		}
+	}
+	for _, arg := range []string{"foo>=", "foo>=1.x", "foo>1.4.*", "foo>=1.2 2.0"} {
+		if _, _, err := SplitConstraints(arg); err == nil {
+			t.Errorf("SplitConstraints(%q) did not return an error", arg)
+		}
+	}
+}
+
+func TestConstraintsMatch(t *testing.T) {
+	for _, tc := range []struct {
+		cs   string
+		ver  string
+		want bool
+	}{
+		{">=1.2 <2.0", "1.2.0@1", true},
+		{">=1.2 <2.0", "1.9.9@3", true},
+		{">=1.2 <2.0", "2.0.0@1", false},
+		{">=1.2 <2.0", "1.1.9@1", false},
+		{"=1.4.*", "1.4.7@2", true},
+		{"=1.4.*", "1.5.0@1", false},
+		{"!=1.4.*", "1.5.0@1", true},
+		{"=1.2.3", "1.2.3@7", true},
+		{"=1.2.3@7", "1.2.3@6", false},
+		{">1.2.3", "1.2.3@7", false},
+		{">1.2.3@6", "1.2.3@7", true},
+		{"<=1.2.3", "1.2.3@7", true},
+	} {
+		cs, err := ParseConstraints(tc.cs)
+		if err != nil {
+			t.Fatalf("ParseConstraints(%q): %v", tc.cs, err)
+		}
+		if got := cs.Match(tc.ver); got != tc.want {
+			t.Errorf("%q.Match(%q) = %v, want %v", tc.cs, tc.ver, got, tc.want)
+		}
+	}
+}
@@ -15,6 +15,7 @@ limitations under the License.
 package goolib
 
 import (
+	"bytes"
 	"compress/gzip"
 	"crypto/sha256"
 	"encoding/hex"
@@ -23,9 +24,21 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
+
+	"github.com/google/logger"
+)
+
+const (
+	// scriptLogLimit is the most output written to a script's log file.
+	scriptLogLimit = 10 * 1024 * 1024
+	// scriptTailSize is how much of the end of a failed script's output is
+	// included in the error.
+	scriptTailSize = 4 * 1024
 )
 
 var interpreter = map[string]string{
@@ -34,6 +47,12 @@ var interpreter = map[string]string{
 	".bat": "cmd",
 }
 
+// SetInterpreter sets the interpreter used to run scripts with extension ext,
+// replacing the default for that extension if there is one.
+func SetInterpreter(ext, ipr string) {
+	interpreter[ext] = ipr
+}
+
 // scriptInterpreter reads a scripts extension and returns the interpreter to use.
 func scriptInterpreter(s string) (string, error) {
 	ext := filepath.Ext(s)
@@ -45,42 +64,65 @@ func scriptInterpreter(s string) (string, error) {
 }
 
 // Exec execs a script or binary on either Windows or Linux using the provided args.
+// The script is run with the interpreter ipr or, if that is empty, the
+// interpreter for its extension. On Linux scripts with no interpreter for
+// their extension are executed directly.
+// env is added to the environment of the process.
 // The process is successful if the exit code matches any of those provided or '0'.
 // stdout and stderr are sent to the writer.
-func Exec(s string, args []string, ec []int, w io.Writer) error {
-	var c *exec.Cmd
-	switch runtime.GOOS {
-	case "windows":
-		cs := filepath.Clean(s)
-		ipr, err := scriptInterpreter(cs)
+func Exec(s, ipr string, args, env []string, ec []int, w io.Writer) error {
+	c, err := ScriptCommand(s, ipr, args)
+	if err != nil {
+		return err
+	}
+	if env != nil {
+		c.Env = append(os.Environ(), env...)
+	}
+	return Run(c, ec, w)
+}
+
+// ScriptCommand returns the command Exec runs for the script s, for callers
+// that need to set up the process further before running it.
+func ScriptCommand(s, ipr string, args []string) (*exec.Cmd, error) {
+	if runtime.GOOS != "windows" && runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("OS %q is not Windows or Linux", runtime.GOOS)
+	}
+	cs := filepath.Clean(s)
+	if ipr == "" {
+		var err error
+		ipr, err = scriptInterpreter(cs)
 		if err != nil {
-			return err
+			if runtime.GOOS == "linux" {
+				return exec.Command(s, args...), nil
+			}
+			return nil, err
 		}
-		switch ipr {
-		case "powershell":
-			// We are using `-Command` here instead of `-File` as this catches syntax errors in the script.
-			args = append([]string{"-ExecutionPolicy", "Bypass", "-NonInteractive", "-NoProfile", "-Command", cs}, args...)
-			c = exec.Command(ipr, args...)
-		case "cmd":
-			c = exec.Command(cs, args...)
-		default:
-			return fmt.Errorf("unknown interpreter: %q", ipr)
-		}
-	case "linux":
-		c = exec.Command(s, args...)
+	}
+	switch ipr {
+	case "powershell", "pwsh":
+		// We are using `-Command` here instead of `-File` as this catches syntax errors in the script.
+		args = append([]string{"-ExecutionPolicy", "Bypass", "-NonInteractive", "-NoProfile", "-Command", cs}, args...)
+		return exec.Command(ipr, args...), nil
+	case "cmd":
+		return exec.Command(cs, args...), nil
 	default:
-		return fmt.Errorf("OS %q is not Windows or Linux", runtime.GOOS)
+		return exec.Command(ipr, append([]string{cs}, args...)...), nil
 	}
-	return Run(c, ec, w)
 }
 
 // Run runs a command.
 // The process is successful if the exit code matches any of those provided or '0'.
-// stdout and stderr are sent to the writer and to this process's stdout and stderr.
+// Each line of stdout and stderr is timestamped and sent to the writer, up to
+// a size limit, and logged at info level so it is only shown on the console
+// when logging verbosely. The end of the output is included in the error if
+// the command fails.
 func Run(c *exec.Cmd, ec []int, w io.Writer) error {
-	c.Stdout = io.MultiWriter(os.Stdout, w)
-	c.Stderr = io.MultiWriter(os.Stderr, w)
-	if err := c.Run(); err != nil {
+	sw := &scriptWriter{w: w, limit: scriptLogLimit}
+	c.Stdout = sw
+	c.Stderr = sw
+	err := c.Run()
+	sw.flush()
+	if err != nil {
 		e, ok := err.(*exec.ExitError)
 		if !ok {
 			return err
@@ -90,12 +132,63 @@ func Run(c *exec.Cmd, ec []int, w io.Writer) error {
 			return err
 		}
 		if !ContainsInt(s.ExitStatus(), ec) {
-			return fmt.Errorf("command exited with error code %v", s.ExitStatus())
+			return fmt.Errorf("command exited with error code %v, last output:\n%s", s.ExitStatus(), sw.tail)
 		}
 	}
 	return nil
 }
 
+// scriptWriter writes script output to w a line at a time.
+type scriptWriter struct {
+	w         io.Writer
+	limit     int
+	written   int
+	truncated bool
+	line      []byte
+	tail      []byte
+}
+
+func (sw *scriptWriter) Write(b []byte) (int, error) {
+	sw.line = append(sw.line, b...)
+	for {
+		i := bytes.IndexByte(sw.line, '\n')
+		if i == -1 {
+			break
+		}
+		sw.writeLine(string(bytes.TrimRight(sw.line[:i], "\r")))
+		sw.line = sw.line[i+1:]
+	}
+	return len(b), nil
+}
+
+// flush writes any output not terminated by a newline.
+func (sw *scriptWriter) flush() {
+	if len(sw.line) > 0 {
+		sw.writeLine(string(sw.line))
+		sw.line = nil
+	}
+}
+
+func (sw *scriptWriter) writeLine(l string) {
+	logger.Info(l)
+
+	sw.tail = append(sw.tail, l+"\n"...)
+	if len(sw.tail) > scriptTailSize {
+		sw.tail = sw.tail[len(sw.tail)-scriptTailSize:]
+	}
+
+	if sw.truncated {
+		return
+	}
+	s := time.Now().Format("2006-01-02T15:04:05.000 ") + l + "\n"
+	if sw.written+len(s) > sw.limit {
+		s = "output truncated, log size limit reached\n"
+		sw.truncated = true
+	}
+	n, _ := io.WriteString(sw.w, s)
+	sw.written += n
+}
+
 // PackageInfo describes the name arch and version of a package.
 type PackageInfo struct {
 	Name, Arch, Ver string
@@ -106,18 +199,29 @@ func (pi PackageInfo) PkgName() string {
 	return fmt.Sprintf("%s.%s.%s.goo", pi.Name, pi.Arch, pi.Ver)
 }
 
-// PkgNameSplit returns the PackageInfo from a package name.
-// If the package name does not contain arch or version an empty string
-// will be returned.
+// PkgNameSplit returns the PackageInfo from a package name of the form
+// name[.arch[.version]]. Package names may contain dots, so the arch is the
+// last dot separated segment that is a valid arch, everything before it is
+// the name and everything after it the version. If the package name does not
+// contain arch or version an empty string will be returned.
 func PkgNameSplit(pn string) PackageInfo {
-	pi := strings.SplitN(strings.TrimSpace(pn), ".", 3)
-	if len(pi) == 2 {
-		return PackageInfo{pi[0], pi[1], ""}
+	pn = strings.TrimSpace(pn)
+	segs := strings.Split(pn, ".")
+	for i := len(segs) - 1; i > 0; i-- {
+		if ContainsString(segs[i], validArch) {
+			return PackageInfo{strings.Join(segs[:i], "."), segs[i], strings.Join(segs[i+1:], ".")}
+		}
 	}
-	if len(pi) == 3 {
-		return PackageInfo{pi[0], pi[1], pi[2]}
+	return PackageInfo{pn, "", ""}
+}
+
+// UserDir returns the directory per-user data is stored in, LOCALAPPDATA on
+// Windows and the home directory elsewhere.
+func UserDir() string {
+	if runtime.GOOS == "windows" {
+		return os.Getenv("LOCALAPPDATA")
 	}
-	return PackageInfo{pi[0], "", ""}
+	return os.Getenv("HOME")
 }
 
 // Checksum retuns the SHA256 checksum of the provided file.
@@ -127,6 +231,24 @@ func Checksum(r io.Reader) string {
 	return hex.EncodeToString(hash.Sum(nil))
 }
 
+// linkPrefix marks the checksum recorded for an installed symlink, which is
+// its target rather than a hash of its contents.
+const linkPrefix = "link:"
+
+// LinkChecksum returns the checksum recorded for a symlink to target.
+func LinkChecksum(target string) string {
+	return linkPrefix + filepath.ToSlash(target)
+}
+
+// LinkTarget returns the target recorded in a checksum made by LinkChecksum,
+// ok is false if chksum is not one.
+func LinkTarget(chksum string) (target string, ok bool) {
+	if !strings.HasPrefix(chksum, linkPrefix) {
+		return "", false
+	}
+	return filepath.FromSlash(strings.TrimPrefix(chksum, linkPrefix)), true
+}
+
 // ExtractPkgSpec pulls and unmarshals the package spec file from a
 // reader.
 func ExtractPkgSpec(r io.Reader) (*PkgSpec, error) {
@@ -156,3 +278,79 @@ func ContainsString(a string, slice []string) bool {
 	}
 	return false
 }
+
+// PathMatch is a simpler filepath.Match but which supports recursive globbing
+// (**) and doesn't get any more special than * or **.
+func PathMatch(pattern, path string) (bool, error) {
+	regex := []rune("^")
+	runePattern := []rune(pattern)
+	for i := 0; i < len(runePattern); i++ {
+		ch := runePattern[i]
+		switch ch {
+		default:
+			regex = append(regex, ch)
+		case '%', '\\', '(', ')', '[', ']', '.', '^', '$', '?', '+', '{', '}', '=':
+			regex = append(regex, '\\', ch)
+		case '*':
+			if i+1 < len(runePattern) && runePattern[i+1] == '*' {
+				if i+2 < len(runePattern) && runePattern[i+2] == '*' {
+					return false, fmt.Errorf("%s: malformed glob", pattern)
+				}
+				regex = append(regex, []rune(".*")...)
+				i++
+			} else {
+				regex = append(regex, []rune("[^/]*")...)
+			}
+		}
+	}
+	regex = append(regex, '$')
+	re, err := regexp.Compile(string(regex))
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(path), nil
+}
+
+// ResolvesWithin reports whether path is root or under it once symlinks and
+// junctions in both are resolved. Parts of path that do not exist yet are
+// taken as they are, so it can check a file before it is created.
+func ResolvesWithin(root, path string) (bool, error) {
+	r, err := resolveExisting(root)
+	if err != nil {
+		return false, err
+	}
+	p, err := resolveExisting(path)
+	if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(r, p)
+	if err != nil {
+		return false, nil
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)), nil
+}
+
+// resolveExisting resolves the symlinks in the longest existing prefix of p
+// and appends the rest of p to it.
+func resolveExisting(p string) (string, error) {
+	p, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	var rest []string
+	for {
+		r, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return filepath.Join(append([]string{r}, rest...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return "", err
+		}
+		rest = append([]string{filepath.Base(p)}, rest...)
+		p = parent
+	}
+}
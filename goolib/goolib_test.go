@@ -14,6 +14,12 @@ limitations under the License.
 package goolib
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -46,6 +52,31 @@ func TestBadScriptInterpreter(t *testing.T) {
 	}
 }
 
+func TestScriptCommand(t *testing.T) {
+	SetInterpreter(".py", "python3")
+	defer delete(interpreter, ".py")
+
+	table := []struct {
+		script, ipr string
+		want        []string
+	}{
+		{"/file/path/script.py", "", []string{"python3", "/file/path/script.py", "arg"}},
+		{"/file/path/script.ps1", "pwsh", []string{"pwsh", "-ExecutionPolicy", "Bypass", "-NonInteractive", "-NoProfile", "-Command", "/file/path/script.ps1", "arg"}},
+		{"/file/path/script.cmd", "", []string{"/file/path/script.cmd", "arg"}},
+		{"/file/path/script.sh", "bash", []string{"bash", "/file/path/script.sh", "arg"}},
+	}
+	for _, tt := range table {
+		c, err := ScriptCommand(tt.script, tt.ipr, []string{"arg"})
+		if err != nil {
+			t.Errorf("error creating command for %q: %v", tt.script, err)
+			continue
+		}
+		if !reflect.DeepEqual(c.Args, tt.want) {
+			t.Errorf("ScriptCommand(%q, %q) returned %q, want %q", tt.script, tt.ipr, c.Args, tt.want)
+		}
+	}
+}
+
 func TestContainsInt(t *testing.T) {
 	table := []struct {
 		a     int
@@ -77,3 +108,124 @@ func TestContainsString(t *testing.T) {
 		}
 	}
 }
+
+func TestPkgNameSplit(t *testing.T) {
+	table := []struct {
+		pn   string
+		want PackageInfo
+	}{
+		{"foo", PackageInfo{"foo", "", ""}},
+		{" foo ", PackageInfo{"foo", "", ""}},
+		{"foo.x86_64", PackageInfo{"foo", "x86_64", ""}},
+		{"foo.noarch.1.2.3@4", PackageInfo{"foo", "noarch", "1.2.3@4"}},
+		{"foo.bar", PackageInfo{"foo.bar", "", ""}},
+		{"foo.bar.arm", PackageInfo{"foo.bar", "arm", ""}},
+		{"foo.bar.x86_32.1.0.0@1", PackageInfo{"foo.bar", "x86_32", "1.0.0@1"}},
+		{"python3.11.x86_64.3.11.4@2", PackageInfo{"python3.11", "x86_64", "3.11.4@2"}},
+		{"foo.1.0.0@1", PackageInfo{"foo.1.0.0@1", "", ""}},
+		{"foo.", PackageInfo{"foo.", "", ""}},
+	}
+	for _, tt := range table {
+		if got := PkgNameSplit(tt.pn); got != tt.want {
+			t.Errorf("PkgNameSplit(%q) = %+v, want %+v", tt.pn, got, tt.want)
+		}
+	}
+}
+
+func TestScriptWriter(t *testing.T) {
+	var buf bytes.Buffer
+	sw := &scriptWriter{w: &buf, limit: 80}
+	for _, s := range []string{"first\r\nsec", "ond\n", strings.Repeat("x", 40) + "\n", "last"} {
+		if _, err := sw.Write([]byte(s)); err != nil {
+			t.Fatalf("error writing: %v", err)
+		}
+	}
+	sw.flush()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	want := []string{"first", "second", "output truncated, log size limit reached"}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines %q, want %d", len(lines), lines, len(want))
+	}
+	for i, l := range lines[:2] {
+		if !strings.HasSuffix(l, " "+want[i]) {
+			t.Errorf("line %d = %q, want timestamp followed by %q", i, l, want[i])
+		}
+	}
+	if lines[2] != want[2] {
+		t.Errorf("line 2 = %q, want %q", lines[2], want[2])
+	}
+
+	wantTail := "first\nsecond\n" + strings.Repeat("x", 40) + "\nlast\n"
+	if string(sw.tail) != wantTail {
+		t.Errorf("tail = %q, want %q", sw.tail, wantTail)
+	}
+}
+
+func TestPathMatch(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		result        bool
+	}{
+		{"/path**.file", "/path/to.file", true},
+		{"/path[a-z]", "/pathb", false},
+		{"/path[a-z]", "/path[a-z]", true},
+		{"path/*/file", "path/to/file", true},
+		{"path/*/file", "path/to/the/file", false},
+		{"path/**/file", "path/to/the/file", true},
+		{"^$[a(-z])%{}}\\{{\\", "^$[a(-z])%{}}\\{{\\", true},
+	}
+
+	for _, test := range tests {
+		res, err := PathMatch(test.pattern, test.path)
+		if err != nil {
+			t.Fatalf("match %q %q: %v", test.pattern, test.path, err)
+		}
+		if res != test.result {
+			t.Fatalf("match %q %q: expected %v got %v", test.pattern, test.path, test.result, res)
+		}
+	}
+}
+
+func TestResolvesWithin(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	root := filepath.Join(tempDir, "root")
+	outside := filepath.Join(tempDir, "outside")
+	for _, d := range []string{filepath.Join(root, "sub"), outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatalf("error creating %q: %v", d, err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "out")); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "sub"), filepath.Join(root, "in")); err != nil {
+		t.Fatalf("error creating symlink: %v", err)
+	}
+
+	tests := []struct {
+		path   string
+		within bool
+	}{
+		{root, true},
+		{filepath.Join(root, "sub", "file"), true},
+		{filepath.Join(root, "new", "dir", "file"), true},
+		{filepath.Join(root, "in", "file"), true},
+		{filepath.Join(root, "out"), false},
+		{filepath.Join(root, "out", "new", "file"), false},
+		{filepath.Join(tempDir, "file"), false},
+	}
+	for _, tt := range tests {
+		got, err := ResolvesWithin(root, tt.path)
+		if err != nil {
+			t.Fatalf("ResolvesWithin(%q, %q): %v", root, tt.path, err)
+		}
+		if got != tt.within {
+			t.Errorf("ResolvesWithin(%q, %q) = %v, want %v", root, tt.path, got, tt.within)
+		}
+	}
+}
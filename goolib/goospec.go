@@ -16,19 +16,26 @@ package goolib
 import (
 	"archive/tar"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/mail"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/blang/semver"
+	humanize "github.com/dustin/go-humanize"
 )
 
 type build struct {
@@ -36,9 +43,12 @@ type build struct {
 }
 
 // PkgSources is a list of includes, excludes and their target in the package.
+// Map renames files or directories, relative to Root, to paths under Target,
+// which then are not packaged under their own names.
 type PkgSources struct {
 	Include, Exclude []string
 	Target, Root     string
+	Map              map[string]string
 }
 
 // GooSpec is the build specification for a package.
@@ -49,11 +59,32 @@ type GooSpec struct {
 }
 
 // RepoSpec is the repository specfication of a package.
+// Size is the size of the package file in bytes, if known. A yanked version
+// was withdrawn from the repo, for YankReason, it is only kept in the index
+// for machines that already have it installed.
 type RepoSpec struct {
 	Checksum, Source string
+	Size             int64  `json:",omitempty"`
+	Yanked           bool   `json:",omitempty"`
+	YankReason       string `json:",omitempty"`
 	PackageSpec      *PkgSpec
 }
 
+// IndexManifest lists the chunks the index of a large repo is split into,
+// so clients fetch and cache each chunk on its own. Repos serve it as
+// index.manifest next to their index.
+type IndexManifest struct {
+	Chunks []IndexChunk
+}
+
+// IndexChunk is a gzipped JSON list of RepoSpecs at Path, relative to the
+// repo. Checksum is the SHA256 checksum of the uncompressed list and names
+// the chunk, so an unchanged chunk keeps its name across index updates.
+type IndexChunk struct {
+	Path, Checksum string
+	Packages       int
+}
+
 // Marshal returns the formatted RepoSpec.
 func (rs *RepoSpec) Marshal() ([]byte, error) {
 	return json.MarshalIndent(rs, "", "  ")
@@ -63,32 +94,385 @@ const (
 	pkgSpecSuffix   = ".pkgspec"
 	maxTagKeyLen    = 127
 	maxTagValueSize = 1024 * 10 // 10k
+
+	maxNameLen          = 128
+	maxDescriptionSize  = 1024 * 10 // 10k
+	maxReleaseNotesSize = 1024 * 64 // 64k
+)
+
+var (
+	validArch = []string{"noarch", "x86_64", "x86_32", "arm"}
+	kbRegex   = regexp.MustCompile(`(?i)kb(\d+)`)
+	nameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_+-]*(\.[a-z0-9][a-z0-9_+-]*)*$`)
 )
 
-var validArch = []string{"noarch", "x86_64", "x86_32", "arm"}
+// Install scopes a package can declare, packages are installed per-machine
+// unless they declare the user scope.
+const (
+	ScopeMachine = "machine"
+	ScopeUser    = "user"
+)
+
+// Install stages a package can declare. When several packages are installed
+// or updated together, early packages, like certificates or agents others
+// rely on, are applied first and late packages last; dependencies are still
+// installed before the packages that need them.
+const (
+	StageEarly = "early"
+	StageLate  = "late"
+)
 
 // PkgSpec is the internal package specification.
 type PkgSpec struct {
-	Name            string
-	Version         string
-	Arch            string
-	ReleaseNotes    []string          `json:",omitempty"`
-	Description     string            `json:",omitempty"`
-	License         string            `json:",omitempty"`
-	Authors         string            `json:",omitempty"`
-	Owners          string            `json:",omitempty"`
+	Name          string
+	Version       string
+	Arch          string
+	ReleaseNotes  []string    `json:",omitempty"`
+	Description   string      `json:",omitempty"`
+	License       string      `json:",omitempty"`
+	Authors       string      `json:",omitempty"`
+	Owners        Owners      `json:",omitempty"`
+	Publisher     string      `json:",omitempty"`
+	HelpURL       string      `json:",omitempty"`
+	AboutURL      string      `json:",omitempty"`
+	Icon          string      `json:",omitempty"`
+	InstallScope  string      `json:",omitempty"`
+	InstallStage  string      `json:",omitempty"`
+	Exclusions    *Exclusions `json:",omitempty"`
+	Coinstallable bool        `json:",omitempty"`
+	// NoModify and NoRepair hide the Modify and Repair buttons of the
+	// package in Apps & Features, both default to true as GooGet packages
+	// can only be removed.
+	NoModify *bool `json:",omitempty"`
+	NoRepair *bool `json:",omitempty"`
+	// Requirements are checked before the package is downloaded.
+	Requirements *Requirements `json:",omitempty"`
+	// WindowsFeatures are enabled before the installer runs.
+	WindowsFeatures *WindowsFeatures `json:",omitempty"`
+	// Certificates are added to machine certificate stores before the
+	// installer runs.
+	Certificates []Certificate `json:",omitempty"`
+	// Restricted packages are only served to machines entitled to them,
+	// the client sends the token of Entitlement, or of the package name if
+	// it is empty, with their downloads.
+	Restricted      bool              `json:",omitempty"`
+	Entitlement     string            `json:",omitempty"`
 	Tags            map[string][]byte `json:",omitempty"`
 	PkgDependencies map[string]string `json:",omitempty"`
+	Obsoletes       []string          `json:",omitempty"`
 	Install         ExecFile
 	Uninstall       ExecFile
-	Files           map[string]string `json:",omitempty"`
+	Verify          *ExecFile `json:",omitempty"`
+	Upgrade         *ExecFile `json:",omitempty"`
+	// PostReboot runs after the first reboot following an install or
+	// upgrade, see googet resume-postreboot.
+	PostReboot  *ExecFile         `json:",omitempty"`
+	Files       map[string]string `json:",omitempty"`
+	ConfigFiles map[string]string `json:",omitempty"`
+	// Permissions are applied to the installed files and directories whose
+	// path in the package matches their key, a path or glob pattern as in
+	// Files. Patterns are applied in order, so later ones win.
+	Permissions map[string]Permission `json:",omitempty"`
+	// InstalledSize is the total size in bytes of the files in the package,
+	// it is set by goopack.
+	InstalledSize int64 `json:",omitempty"`
+	// Provenance is how the package was built, it is set by goopack.
+	Provenance *Provenance `json:",omitempty"`
+}
+
+// Provenance records where, when and from what a package was built.
+type Provenance struct {
+	// Builder is the host the package was built on.
+	Builder string `json:",omitempty"`
+	// Commit is the version control commit of the sources, if known.
+	Commit    string `json:",omitempty"`
+	BuildTime time.Time
+	// Goopack is the version of goopack that built the package.
+	Goopack string `json:",omitempty"`
+	// SpecChecksum is the SHA256 checksum of the goospec file.
+	SpecChecksum string `json:",omitempty"`
+}
+
+// Permission is the mode and Windows access control list given to installed
+// files. Mode is an octal Unix mode like "0750", it is not applied on
+// Windows. ACL is a security descriptor in SDDL whose DACL replaces that of
+// the file on Windows, like "D:P(A;OICI;FA;;;SY)(A;OICI;FA;;;BA)".
+type Permission struct {
+	Mode string `json:",omitempty"`
+	ACL  string `json:",omitempty"`
+}
+
+// FileMode returns the mode in p, 0 if it has none.
+func (p Permission) FileMode() (os.FileMode, error) {
+	if p.Mode == "" {
+		return 0, nil
+	}
+	m, err := strconv.ParseUint(p.Mode, 8, 32)
+	if err != nil || m > 0777 {
+		return 0, fmt.Errorf("invalid mode %q, want an octal mode up to 0777", p.Mode)
+	}
+	return os.FileMode(m), nil
+}
+
+// Requirements are conditions a machine has to meet to install a package,
+// they are checked before anything is downloaded or installed.
+type Requirements struct {
+	// MinOSBuild is the lowest OS build number, like 17763 for Windows
+	// Server 2019.
+	MinOSBuild int `json:",omitempty"`
+	// Features are Windows optional features that have to be enabled.
+	Features []string `json:",omitempty"`
+	// MinFreeSpace is the free space, like "2GiB", needed on the volume
+	// the package is installed to, on top of the size of its files.
+	MinFreeSpace string `json:",omitempty"`
+	// RegistryKeys have to exist, like
+	// `HKLM\SOFTWARE\Microsoft\NET Framework Setup\NDP\v4\Full`.
+	RegistryKeys []string `json:",omitempty"`
+}
+
+// FreeSpace returns MinFreeSpace in bytes, 0 if it is not set.
+func (r *Requirements) FreeSpace() (uint64, error) {
+	if r.MinFreeSpace == "" {
+		return 0, nil
+	}
+	n, err := humanize.ParseBytes(r.MinFreeSpace)
+	if err != nil {
+		return 0, fmt.Errorf("invalid minimum free space %q: %v", r.MinFreeSpace, err)
+	}
+	return n, nil
+}
+
+// WindowsFeatures are Windows optional features and capabilities a package
+// enables. Those it enables are recorded and disabled again when the package
+// is removed, those that were already enabled are left alone.
+type WindowsFeatures struct {
+	// Features are optional features, enabled with DISM, like "NetFx3".
+	Features []string `json:",omitempty"`
+	// Capabilities are added with Add-WindowsCapability, like
+	// "OpenSSH.Server~~~~0.0.1.0".
+	Capabilities []string `json:",omitempty"`
+}
+
+// Empty reports whether wf, which may be nil, lists nothing.
+func (wf *WindowsFeatures) Empty() bool {
+	return wf == nil || len(wf.Features) == 0 && len(wf.Capabilities) == 0
+}
+
+// CertStores are the machine certificate stores packages can add
+// certificates to.
+var CertStores = []string{"Root", "CA", "My", "AuthRoot", "TrustedPublisher", "TrustedPeople", "Disallowed"}
+
+// Certificate is a certificate file in a package and the machine store it
+// is added to.
+type Certificate struct {
+	// Path is the DER or PEM encoded certificate, relative to the package.
+	Path string
+	// Store is one of CertStores, like "Root".
+	Store string
+}
+
+// Exclusions are Windows Defender path and process exclusions a package
+// requests, they are applied when the package is installed and removed when
+// it is uninstalled.
+type Exclusions struct {
+	Paths     []string `json:",omitempty"`
+	Processes []string `json:",omitempty"`
+}
+
+// UserScope reports whether the package is installed for the current user
+// rather than the machine.
+func (spec *PkgSpec) UserScope() bool {
+	return spec.InstallScope == ScopeUser
+}
+
+// EntitlementHeader carries the entitlement token with downloads of
+// restricted packages.
+const EntitlementHeader = "X-GooGet-Entitlement-Token"
+
+// EntitlementName returns the entitlement a restricted package requires,
+// empty if the package is not restricted.
+func (spec *PkgSpec) EntitlementName() string {
+	if !spec.Restricted {
+		return ""
+	}
+	if spec.Entitlement != "" {
+		return spec.Entitlement
+	}
+	return spec.Name
+}
+
+// StageRank orders packages by their install stage: early packages rank
+// before those without a stage, which rank before late packages.
+func (spec *PkgSpec) StageRank() int {
+	switch spec.InstallStage {
+	case StageEarly:
+		return -1
+	case StageLate:
+		return 1
+	}
+	return 0
+}
+
+// pkgSpecJSON is how a PkgSpec is written: clients before structured owners
+// read Owners as a string, so Owners keeps the comma separated form and the
+// owners with all their fields go in OwnerDetails.
+type pkgSpecJSON struct {
+	plainPkgSpec
+	Owners       string `json:",omitempty"`
+	OwnerDetails Owners `json:",omitempty"`
+}
+
+// plainPkgSpec has the fields of PkgSpec without its JSON methods.
+type plainPkgSpec PkgSpec
+
+// MarshalJSON writes Owners as a comma separated string that older clients
+// can read, and the structured owners as OwnerDetails.
+func (spec PkgSpec) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pkgSpecJSON{plainPkgSpec(spec), spec.Owners.String(), spec.Owners})
+}
+
+// UnmarshalJSON reads a PkgSpec written by MarshalJSON or, as in goospec
+// files, with Owners as a string or a list. OwnerDetails, if set, takes
+// precedence over Owners.
+func (spec *PkgSpec) UnmarshalJSON(b []byte) error {
+	var s struct {
+		plainPkgSpec
+		OwnerDetails Owners
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*spec = PkgSpec(s.plainPkgSpec)
+	if len(s.OwnerDetails) > 0 {
+		spec.Owners = s.OwnerDetails
+	}
+	return nil
+}
+
+// Owner describes a person or team responsible for a package.
+type Owner struct {
+	Name          string `json:",omitempty"`
+	Email         string `json:",omitempty"`
+	Team          string `json:",omitempty"`
+	EscalationURL string `json:",omitempty"`
+}
+
+// String returns the owner formatted as "Name <Email> (Team)", omitting
+// any fields that are not set.
+func (o Owner) String() string {
+	var s []string
+	if o.Name != "" {
+		s = append(s, o.Name)
+	}
+	if o.Email != "" {
+		s = append(s, "<"+o.Email+">")
+	}
+	if o.Team != "" {
+		s = append(s, "("+o.Team+")")
+	}
+	return strings.Join(s, " ")
+}
+
+func (o Owner) verify() error {
+	if o.Name == "" && o.Email == "" && o.Team == "" {
+		return errors.New("owner must have a name, email or team")
+	}
+	if o.Email != "" {
+		if _, err := mail.ParseAddress(o.Email); err != nil {
+			return fmt.Errorf("invalid owner email %q: %v", o.Email, err)
+		}
+	}
+	if o.EscalationURL != "" {
+		if err := verifyURL(o.EscalationURL); err != nil {
+			return fmt.Errorf("invalid owner escalation URL %q: %v", o.EscalationURL, err)
+		}
+	}
+	return nil
+}
+
+func verifyURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("scheme must be http or https")
+	}
+	return nil
+}
+
+// Owners is a list of package owners.
+type Owners []Owner
+
+// String returns a comma separated list of owners.
+func (ol Owners) String() string {
+	var s []string
+	for _, o := range ol {
+		s = append(s, o.String())
+	}
+	return strings.Join(s, ", ")
+}
+
+// UnmarshalJSON unmarshals either a list of owners or, for backwards
+// compatibility, a free-form comma separated owners string.
+func (ol *Owners) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*ol = ParseOwners(s)
+		return nil
+	}
+	var l []Owner
+	if err := json.Unmarshal(b, &l); err != nil {
+		return err
+	}
+	*ol = l
+	return nil
+}
+
+// ParseOwners parses a free-form comma separated owners string, entries that
+// are valid email addresses (optionally with a display name) have their
+// email populated, all other entries are treated as names.
+func ParseOwners(s string) Owners {
+	var ol Owners
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if a, err := mail.ParseAddress(e); err == nil {
+			ol = append(ol, Owner{Name: a.Name, Email: a.Address})
+			continue
+		}
+		ol = append(ol, Owner{Name: e})
+	}
+	return ol
 }
 
 // ExecFile contains info involved in running a script or binary file.
+// Interpreter, if set, overrides the interpreter used for the script's
+// extension. Env holds extra KEY=value environment variables for the script.
+// Checksum, if set, is the SHA-256 of the file at Path, it is checked before
+// the file is run.
 type ExecFile struct {
-	Path      string   `json:",omitempty"`
-	Args      []string `json:",omitempty"`
-	ExitCodes []int    `json:",omitempty"`
+	Path        string   `json:",omitempty"`
+	Args        []string `json:",omitempty"`
+	ExitCodes   []int    `json:",omitempty"`
+	Interpreter string   `json:",omitempty"`
+	Env         []string `json:",omitempty"`
+	Checksum    string   `json:",omitempty"`
+}
+
+// KB returns the knowledge base article, such as KB4524570, of a Windows
+// update (.msu) from its file name, or "" if ef is not a Windows update.
+func (ef ExecFile) KB() string {
+	if !strings.EqualFold(filepath.Ext(ef.Path), ".msu") {
+		return ""
+	}
+	m := kbRegex.FindStringSubmatch(filepath.Base(ef.Path))
+	if m == nil {
+		return ""
+	}
+	return "KB" + m[1]
 }
 
 // Version contains the semver version as well as the GsVer.
@@ -220,8 +604,21 @@ func unmarshalGooSpec(c []byte) (GooSpec, error) {
 }
 
 // ReadGooSpec unmarshalls and verifies a goospec file into the GooSpec struct.
+// A goospec can extend a base goospec, see readSpecJSON.
 func ReadGooSpec(cf string) (GooSpec, error) {
-	c, err := ioutil.ReadFile(cf)
+	return ReadGooSpecVars(cf, nil)
+}
+
+// ReadGooSpecVars is like ReadGooSpec, but if vars is not nil the goospec
+// and the bases it extends are first executed as text/template templates
+// with vars as data, so {{.version}} is the value of vars["version"]. Using
+// a variable not in vars is an error.
+func ReadGooSpecVars(cf string, vars map[string]string) (GooSpec, error) {
+	m, err := readSpecJSON(cf, vars, nil)
+	if err != nil {
+		return GooSpec{}, err
+	}
+	c, err := json.Marshal(m)
 	if err != nil {
 		return GooSpec{}, err
 	}
@@ -235,6 +632,128 @@ func ReadGooSpec(cf string) (GooSpec, error) {
 	return gs, err
 }
 
+// extendsKey names the base goospec a goospec extends, relative to the
+// goospec's directory.
+const extendsKey = "extends"
+
+// readSpecJSON reads the goospec cf as JSON, merged over the base goospec it
+// extends, if any. Objects are merged key by key, top level keys ignoring
+// case as JSON fields do, other values including lists replace those of the
+// base and null removes them. chain are the goospecs extending cf, a goospec
+// extending one of them is a cycle. vars, if not nil, are the template
+// variables of ReadGooSpecVars.
+func readSpecJSON(cf string, vars map[string]string, chain []string) (map[string]interface{}, error) {
+	abs, err := filepath.Abs(cf)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range chain {
+		if c == abs {
+			return nil, fmt.Errorf("goospec extends itself: %s", strings.Join(append(chain[i:], abs), " -> "))
+		}
+	}
+	b, err := ioutil.ReadFile(cf)
+	if err != nil {
+		return nil, err
+	}
+	if vars != nil {
+		if b, err = executeSpec(cf, b, vars); err != nil {
+			return nil, err
+		}
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var m map[string]interface{}
+	if err := d.Decode(&m); err != nil {
+		return nil, jsonError(cf, b, err)
+	}
+	var base string
+	for k, v := range m {
+		if !strings.EqualFold(k, extendsKey) {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok || s == "" {
+			return nil, fmt.Errorf("%s: %s must be the path of a goospec", cf, k)
+		}
+		base = s
+		delete(m, k)
+	}
+	if base == "" {
+		return m, nil
+	}
+	if !filepath.IsAbs(base) {
+		base = filepath.Join(filepath.Dir(cf), base)
+	}
+	bm, err := readSpecJSON(base, vars, append(chain, abs))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", cf, err)
+	}
+	return mergeSpecJSON(bm, m, true), nil
+}
+
+// executeSpec executes the contents b of the goospec cf as a template with
+// vars as data.
+func executeSpec(cf string, b []byte, vars map[string]string) ([]byte, error) {
+	t, err := template.New(filepath.Base(cf)).Option("missingkey=error").Parse(string(b))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, vars); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mergeSpecJSON merges over into base and returns base. fold matches keys
+// ignoring case.
+func mergeSpecJSON(base, over map[string]interface{}, fold bool) map[string]interface{} {
+	for k, v := range over {
+		bk := k
+		if fold {
+			for b := range base {
+				if strings.EqualFold(b, k) {
+					bk = b
+				}
+			}
+		}
+		if bo, ok := base[bk].(map[string]interface{}); ok {
+			if vo, ok := v.(map[string]interface{}); ok {
+				base[bk] = mergeSpecJSON(bo, vo, false)
+				continue
+			}
+		}
+		delete(base, bk)
+		base[k] = v
+	}
+	return base
+}
+
+// jsonError adds the file, line and column of the JSON error err in the
+// contents b of file f to it.
+func jsonError(f string, b []byte, err error) error {
+	if ve := jsonValidationError(b, err); ve.Line > 0 {
+		return fmt.Errorf("%s:%d:%d: %v", f, ve.Line, ve.Column, err)
+	}
+	return fmt.Errorf("%s: %v", f, err)
+}
+
+// position returns the line and column, counted from 1, of the byte of b
+// before off. JSON error offsets count the bytes read, up to and including
+// the bad one.
+func position(b []byte, off int64) (line, col int) {
+	if off > int64(len(b)) {
+		off = int64(len(b))
+	}
+	if off > 0 {
+		off--
+	}
+	line = 1 + bytes.Count(b[:off], []byte("\n"))
+	col = int(off) - bytes.LastIndexByte(b[:off], '\n')
+	return line, col
+}
+
 // WritePackageSpec takes a PkgSpec and writes it as a JSON file using
 // the provided tar writer.
 func WritePackageSpec(tw *tar.Writer, spec *PkgSpec) error {
@@ -262,6 +781,10 @@ func WritePackageSpec(tw *tar.Writer, spec *PkgSpec) error {
 	return nil
 }
 
+// maxSpecSize is the largest package spec ReadPackageSpec accepts, specs
+// are small and a larger one is almost certainly not a spec at all.
+const maxSpecSize = 1 << 20
+
 // ReadPackageSpec reads a PkgSpec from the given reader, which is
 // expected to contain an uncompressed tar archive.
 func ReadPackageSpec(r io.Reader) (*PkgSpec, error) {
@@ -278,47 +801,258 @@ func ReadPackageSpec(r io.Reader) (*PkgSpec, error) {
 			continue
 		}
 
-		data, err := ioutil.ReadAll(tr)
+		data, err := ioutil.ReadAll(io.LimitReader(tr, maxSpecSize+1))
 		if err != nil {
 			return nil, err
 		}
+		if len(data) > maxSpecSize {
+			return nil, fmt.Errorf("package spec %q is larger than %d bytes", header.Name, maxSpecSize)
+		}
 		return UnmarshalPackageSpec(data)
 	}
 }
 
+// SpecError lists every problem found while verifying a package spec.
+type SpecError []error
+
+func (e SpecError) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	s := []string{fmt.Sprintf("%d errors in package spec:", len(e))}
+	for _, err := range e {
+		s = append(s, "  "+err.Error())
+	}
+	return strings.Join(s, "\n")
+}
+
+// verifyName checks that a package name is lowercase and only uses
+// characters that PkgNameSplit and the file names in the cache can handle.
+// Dots are allowed between segments as long as no segment is an arch.
+func verifyName(name string) error {
+	if len(name) > maxNameLen {
+		return fmt.Errorf("package name %q is longer than %d characters", name, maxNameLen)
+	}
+	if !nameRegex.MatchString(name) {
+		return fmt.Errorf("invalid package name %q: must start with a lowercase letter or digit and contain only lowercase letters, digits, '.', '-', '_' and '+'", name)
+	}
+	for _, s := range strings.Split(name, ".") {
+		if ContainsString(s, validArch) {
+			return fmt.Errorf("invalid package name %q: %q is an arch", name, s)
+		}
+	}
+	return nil
+}
+
+// verify checks spec as goopack and goospec authoring do, with the rules on
+// names and on the size of descriptions and release notes.
 func (spec *PkgSpec) verify() error {
+	return spec.check(true)
+}
+
+// verifyPublished checks a spec read from a package. The rules on names and
+// on the size of descriptions and release notes only apply to new specs,
+// packages published before them can still be read and installed.
+func (spec *PkgSpec) verifyPublished() error {
+	return spec.check(false)
+}
+
+// check verifies spec, with the authoring rules if strict is set.
+func (spec *PkgSpec) check(strict bool) error {
+	var errs SpecError
+	add := func(format string, a ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, a...))
+	}
+
 	if spec.Name == "" {
-		return errors.New("no name defined in package spec")
+		add("no name defined in package spec")
+	} else if err := verifyName(spec.Name); strict && err != nil {
+		errs = append(errs, err)
 	}
 	if !ContainsString(spec.Arch, validArch) {
-		return fmt.Errorf("invalid architecture: %q", spec.Arch)
+		add("invalid architecture: %q", spec.Arch)
 	}
 	if spec.Version == "" {
-		return errors.New("Version string empty")
+		add("Version string empty")
+	} else if _, err := ParseVersion(spec.Version); err != nil {
+		add("can't parse %q: %v", spec.Version, err)
+	}
+	if spec.InstallScope != "" && spec.InstallScope != ScopeMachine && spec.InstallScope != ScopeUser {
+		add("invalid install scope: %q", spec.InstallScope)
+	}
+	if spec.InstallStage != "" && spec.InstallStage != StageEarly && spec.InstallStage != StageLate {
+		add("invalid install stage: %q", spec.InstallStage)
 	}
-	if _, err := ParseVersion(spec.Version); err != nil {
-		return fmt.Errorf("can't parse %q: %v", spec.Version, err)
+	if r := spec.Requirements; r != nil {
+		if r.MinOSBuild < 0 {
+			add("invalid minimum OS build: %d", r.MinOSBuild)
+		}
+		if _, err := r.FreeSpace(); err != nil {
+			add("%v", err)
+		}
+		for _, k := range r.RegistryKeys {
+			if !strings.Contains(k, `\`) {
+				add("invalid registry key %q, want a hive and a path like HKLM\\SOFTWARE\\Vendor", k)
+			}
+		}
+	}
+	if spec.Entitlement != "" && !spec.Restricted {
+		add("entitlement %q set on a package that is not restricted", spec.Entitlement)
+	}
+	if wf := spec.WindowsFeatures; wf != nil {
+		if spec.UserScope() && !wf.Empty() {
+			add("user scoped packages cannot enable Windows features")
+		}
+		for _, f := range append(append([]string(nil), wf.Features...), wf.Capabilities...) {
+			if strings.TrimSpace(f) == "" {
+				add("empty Windows feature name")
+			}
+		}
+	}
+	if len(spec.Certificates) > 0 && spec.UserScope() {
+		add("user scoped packages cannot add certificates")
+	}
+	for _, c := range spec.Certificates {
+		if c.Path == "" || filepath.IsAbs(c.Path) || strings.HasPrefix(filepath.ToSlash(filepath.Clean(c.Path)), "../") {
+			add("invalid certificate path %q, want a path in the package", c.Path)
+		}
+		known := false
+		for _, st := range CertStores {
+			known = known || strings.EqualFold(st, c.Store)
+		}
+		if !known {
+			add("invalid certificate store %q for %q, want one of %s", c.Store, c.Path, strings.Join(CertStores, ", "))
+		}
+	}
+	if ex := spec.Exclusions; ex != nil {
+		if spec.UserScope() {
+			add("user scoped packages cannot request Defender exclusions")
+		}
+		for _, e := range append(ex.Paths, ex.Processes...) {
+			if strings.TrimSpace(e) == "" {
+				add("empty Defender exclusion")
+				break
+			}
+		}
+	}
+	if strict {
+		if len(spec.Description) > maxDescriptionSize {
+			add("description is %d bytes, the maximum is %d", len(spec.Description), maxDescriptionSize)
+		}
+		var rn int
+		for _, n := range spec.ReleaseNotes {
+			rn += len(n)
+		}
+		if rn > maxReleaseNotesSize {
+			add("release notes are %d bytes, the maximum is %d", rn, maxReleaseNotesSize)
+		}
 	}
 	if len(spec.Tags) > 10 {
-		return errors.New("too many tags")
+		add("too many tags")
+	}
+	var tags []string
+	for k := range spec.Tags {
+		tags = append(tags, k)
 	}
-	for k, v := range spec.Tags {
+	sort.Strings(tags)
+	for _, k := range tags {
 		if len(k) > maxTagKeyLen {
-			return errors.New("tag key too large")
+			add("tag key too large")
 		}
-		if len(v) > maxTagValueSize {
-			return fmt.Errorf("tag %q too large", k)
+		if len(spec.Tags[k]) > maxTagValueSize {
+			add("tag %q too large", k)
 		}
 	}
-	for k, v := range spec.PkgDependencies {
+	for _, o := range spec.Owners {
+		if err := o.verify(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, u := range []string{spec.HelpURL, spec.AboutURL} {
+		if u == "" {
+			continue
+		}
+		if err := verifyURL(u); err != nil {
+			add("invalid URL %q: %v", u, err)
+		}
+	}
+	var deps []string
+	for k := range spec.PkgDependencies {
+		deps = append(deps, k)
+	}
+	sort.Strings(deps)
+	for _, k := range deps {
+		v := spec.PkgDependencies[k]
+		pi := PkgNameSplit(k)
+		if err := verifyName(pi.Name); strict && err != nil {
+			add("invalid dependancy %q: %v", k, err)
+		}
 		if _, err := ParseVersion(v); err != nil {
-			return fmt.Errorf("can't parse version %q for dependancy %q: %v", v, k, err)
+			add("can't parse version %q for dependancy %q: %v", v, k, err)
+		}
+		if pi.Ver != "" {
+			add("dependancy %q must not include a version", k)
 		}
 	}
+	for _, o := range spec.Obsoletes {
+		if err := verifyName(o); strict && err != nil {
+			add("invalid obsoleted package %q: %v", o, err)
+		}
+		if o == spec.Name {
+			add("package %q cannot obsolete itself", o)
+		}
+	}
+	for _, ef := range []*ExecFile{&spec.Install, &spec.Uninstall, spec.Verify, spec.Upgrade, spec.PostReboot} {
+		if ef == nil || ef.Checksum == "" {
+			continue
+		}
+		if b, err := hex.DecodeString(ef.Checksum); err != nil || len(b) != sha256.Size {
+			add("checksum %q of %q is not a SHA-256 hex string", ef.Checksum, ef.Path)
+		}
+	}
+	var srcs []string
 	for src := range spec.Files {
-		if filepath.IsAbs(src) {
-			return fmt.Errorf("%q is an absolute path, expected relative", src)
+		srcs = append(srcs, src)
+	}
+	for src := range spec.ConfigFiles {
+		srcs = append(srcs, src)
+	}
+	sort.Strings(srcs)
+	for _, src := range srcs {
+		if filepath.IsAbs(strings.TrimPrefix(src, "!")) {
+			add("%q is an absolute path, expected relative", src)
 		}
+		if strings.Contains(src, "*") {
+			if _, err := PathMatch(strings.TrimPrefix(src, "!"), ""); err != nil {
+				add("invalid file source: %v", err)
+			}
+		}
+	}
+	var perms []string
+	for k := range spec.Permissions {
+		perms = append(perms, k)
+	}
+	sort.Strings(perms)
+	for _, k := range perms {
+		p := spec.Permissions[k]
+		if filepath.IsAbs(k) {
+			add("permissions for %q: absolute path, expected relative", k)
+		}
+		if _, err := PathMatch(k, ""); err != nil {
+			add("invalid permissions pattern: %v", err)
+		}
+		if p.Mode == "" && p.ACL == "" {
+			add("permissions for %q set neither a mode nor an ACL", k)
+		}
+		if _, err := p.FileMode(); err != nil {
+			add("permissions for %q: %v", k, err)
+		}
+		if p.ACL != "" && !strings.HasPrefix(p.ACL, "D:") {
+			add("permissions for %q: ACL %q is not an SDDL DACL starting with D:", k, p.ACL)
+		}
+	}
+	if errs != nil {
+		return errs
 	}
 	return nil
 }
@@ -333,13 +1067,14 @@ func MarshalPackageSpec(spec *PkgSpec) ([]byte, error) {
 }
 
 // UnmarshalPackageSpec parses data and returns a PkgSpec, if it finds
-// one.
+// one. Specs of published packages are not held to the authoring rules on
+// names and sizes that goopack applies.
 func UnmarshalPackageSpec(data []byte) (*PkgSpec, error) {
 	var p PkgSpec
 	if err := json.Unmarshal(data, &p); err != nil {
 		return nil, err
 	}
-	if err := p.verify(); err != nil {
+	if err := p.verifyPublished(); err != nil {
 		return nil, err
 	}
 	return &p, nil
@@ -16,6 +16,10 @@ package goolib
 import (
 	"archive/tar"
 	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -159,6 +163,205 @@ func TestBadVerify(t *testing.T) {
 				},
 			},
 		}, `tag "text" too large`},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:    "noarch",
+				Name:    "name",
+				Version: "1.2.3@4",
+				Owners:  Owners{{Team: "team"}, {}},
+			},
+		}, "owner must have a name, email or team"},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:    "noarch",
+				Name:    "name",
+				Version: "1.2.3@4",
+				Owners:  Owners{{Name: "someone", Email: "someone"}},
+			},
+		}, `invalid owner email "someone"`},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:    "noarch",
+				Name:    "name",
+				Version: "1.2.3@4",
+				Owners:  Owners{{Name: "someone", EscalationURL: "ftp://oncall"}},
+			},
+		}, "scheme must be http or https"},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:    "noarch",
+				Name:    "name",
+				Version: "1.2.3@4",
+				HelpURL: "help",
+			},
+		}, `invalid URL "help": scheme must be http or https`},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:    "noarch",
+				Name:    "name",
+				Version: "1.2.3@4",
+				Install: ExecFile{Path: "setup.exe", Checksum: "abc"},
+			},
+		}, `checksum "abc" of "setup.exe" is not a SHA-256 hex string`},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:         "noarch",
+				Name:         "name",
+				Version:      "1.2.3@4",
+				InstallScope: "everyone",
+			},
+		}, `invalid install scope: "everyone"`},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:         "noarch",
+				Name:         "name",
+				Version:      "1.2.3@4",
+				InstallStage: "first",
+			},
+		}, `invalid install stage: "first"`},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:        "noarch",
+				Name:        "name",
+				Version:     "1.2.3@4",
+				Entitlement: "pro",
+			},
+		}, `entitlement "pro" set on a package that is not restricted`},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:         "noarch",
+				Name:         "name",
+				Version:      "1.2.3@4",
+				Requirements: &Requirements{MinFreeSpace: "lots"},
+			},
+		}, `invalid minimum free space "lots": strconv.ParseFloat: parsing "": invalid syntax`},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:         "noarch",
+				Name:         "name",
+				Version:      "1.2.3@4",
+				Requirements: &Requirements{RegistryKeys: []string{"SOFTWARE"}},
+			},
+		}, `invalid registry key "SOFTWARE", want a hive and a path like HKLM\SOFTWARE\Vendor`},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:            "noarch",
+				Name:            "name",
+				Version:         "1.2.3@4",
+				InstallScope:    ScopeUser,
+				WindowsFeatures: &WindowsFeatures{Features: []string{"NetFx3", " "}},
+			},
+		}, "user scoped packages cannot enable Windows features\n  empty Windows feature name"},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:         "noarch",
+				Name:         "name",
+				Version:      "1.2.3@4",
+				Certificates: []Certificate{{Path: "../ca.cer", Store: "Root"}, {Path: "ca.cer", Store: "Personal"}},
+			},
+		}, "invalid certificate path \"../ca.cer\", want a path in the package\n  invalid certificate store \"Personal\" for \"ca.cer\", want one of Root, CA, My, AuthRoot, TrustedPublisher, TrustedPeople, Disallowed"},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:         "noarch",
+				Name:         "name",
+				Version:      "1.2.3@4",
+				InstallScope: ScopeUser,
+				Exclusions:   &Exclusions{Paths: []string{"C:\\foo"}},
+			},
+		}, "user scoped packages cannot request Defender exclusions"},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:       "noarch",
+				Name:       "name",
+				Version:    "1.2.3@4",
+				Exclusions: &Exclusions{Processes: []string{" "}},
+			},
+		}, "empty Defender exclusion"},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:            "noarch",
+				Name:            "name",
+				Version:         "1.2.3@4",
+				PkgDependencies: map[string]string{"dep.x86_64.1.0.0@1": "1.0.0@1"},
+			},
+		}, `dependancy "dep.x86_64.1.0.0@1" must not include a version`},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:    "noarch",
+				Name:    "My Package",
+				Version: "1.2.3@4",
+			},
+		}, `invalid package name "My Package"`},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:    "noarch",
+				Name:    "name..dots",
+				Version: "1.2.3@4",
+			},
+		}, `invalid package name "name..dots"`},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:    "noarch",
+				Name:    "name.x86_64.tools",
+				Version: "1.2.3@4",
+			},
+		}, `invalid package name "name.x86_64.tools": "x86_64" is an arch`},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:            "noarch",
+				Name:            "name",
+				Version:         "1.2.3@4",
+				PkgDependencies: map[string]string{"Dep": "1.0.0@1"},
+			},
+		}, `invalid dependancy "Dep"`},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:        "noarch",
+				Name:        "name",
+				Version:     "1.2.3@4",
+				Description: strings.Repeat("a", maxDescriptionSize+1),
+			},
+		}, "description is 10241 bytes, the maximum is 10240"},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:         "noarch",
+				Name:         "name",
+				Version:      "1.2.3@4",
+				ReleaseNotes: []string{strings.Repeat("a", maxReleaseNotesSize), "1.2.3@4 - fixes"},
+			},
+		}, "release notes are 65551 bytes, the maximum is 65536"},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:      "noarch",
+				Name:      "name",
+				Version:   "1.2.3@4",
+				Obsoletes: []string{"old-name", "name"},
+			},
+		}, `package "name" cannot obsolete itself`},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:        "noarch",
+				Name:        "name",
+				Version:     "1.2.3@4",
+				Permissions: map[string]Permission{"bin/*": {Mode: "0755"}, "etc/*": {Mode: "rw-r--r--"}},
+			},
+		}, `permissions for "etc/*": invalid mode "rw-r--r--"`},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:        "noarch",
+				Name:        "name",
+				Version:     "1.2.3@4",
+				Permissions: map[string]Permission{"conf": {ACL: "(A;;FA;;;SY)"}},
+			},
+		}, `permissions for "conf": ACL "(A;;FA;;;SY)" is not an SDDL DACL`},
+		{GooSpec{
+			PackageSpec: &PkgSpec{
+				Arch:        "noarch",
+				Name:        "name",
+				Version:     "1.2.3@4",
+				Permissions: map[string]Permission{"conf": {}},
+			},
+		}, `permissions for "conf" set neither a mode nor an ACL`},
 	}
 	for _, tt := range table {
 		err := tt.gs.verify()
@@ -172,6 +375,28 @@ func TestBadVerify(t *testing.T) {
 	}
 }
 
+func TestVerifyReportsAllErrors(t *testing.T) {
+	ps := &PkgSpec{
+		Name:    "Bad Name",
+		Arch:    "something",
+		Version: "1.2.3@4",
+		HelpURL: "help",
+	}
+	err := ps.verify()
+	se, ok := err.(SpecError)
+	if !ok {
+		t.Fatalf("verify returned %T (%v), want SpecError", err, err)
+	}
+	if len(se) != 3 {
+		t.Fatalf("verify returned %d errors, want 3: %v", len(se), err)
+	}
+	for _, want := range []string{"3 errors in package spec", `invalid package name "Bad Name"`, `invalid architecture: "something"`, `invalid URL "help"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+}
+
 func TestCompare(t *testing.T) {
 	table := []struct {
 		v1     string
@@ -266,7 +491,7 @@ func TestUnmarshalGooSpec(t *testing.T) {
 			Arch:         "noarch",
 			ReleaseNotes: []string{"1.2.3@4 - something new", "1.2.3@4 - something"},
 			Description:  "blah blah",
-			Owners:       "someone",
+			Owners:       Owners{{Name: "someone"}},
 			Install: ExecFile{
 				Path: "install.ps1",
 			},
@@ -282,6 +507,158 @@ func TestUnmarshalGooSpec(t *testing.T) {
 	}
 }
 
+func TestReadGooSpecExtends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, c string) string {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, []byte(c), 0644); err != nil {
+			t.Fatalf("error writing %s: %v", name, err)
+		}
+		return p
+	}
+
+	write("base.goospec", `{
+  "name": "base",
+  "version": "0.0.0@1",
+  "arch": "noarch",
+  "owners": "team",
+  "install": {"path": "install.ps1"},
+  "tags": {"family": "dGVzdA=="},
+  "files": {"bin/tool.exe": "<ProgramFiles>/tool/tool.exe"},
+  "releaseNotes": ["0.0.0@1 - base"]
+}`)
+	write("family.goospec", `{"extends": "base.goospec", "description": "family"}`)
+	p := write("pkg.goospec", `{
+  "extends": "family.goospec",
+  "Name": "pkg",
+  "version": "1.2.3@4",
+  "files": {"bin/lib.dll": "<ProgramFiles>/tool/lib.dll"},
+  "releaseNotes": ["1.2.3@4 - pkg"],
+  "tags": null
+}`)
+	gs, err := ReadGooSpec(p)
+	if err != nil {
+		t.Fatalf("ReadGooSpec: %v", err)
+	}
+	want := &PkgSpec{
+		Name:         "pkg",
+		Version:      "1.2.3@4",
+		Arch:         "noarch",
+		Description:  "family",
+		Owners:       Owners{{Name: "team"}},
+		ReleaseNotes: []string{"1.2.3@4 - pkg"},
+		Install:      ExecFile{Path: "install.ps1"},
+		Files: map[string]string{
+			"bin/tool.exe": "<ProgramFiles>/tool/tool.exe",
+			"bin/lib.dll":  "<ProgramFiles>/tool/lib.dll",
+		},
+	}
+	if !reflect.DeepEqual(gs.PackageSpec, want) {
+		t.Errorf("ReadGooSpec() = %+v, want %+v", gs.PackageSpec, want)
+	}
+
+	write("a.goospec", `{"extends": "b.goospec"}`)
+	write("b.goospec", `{"extends": "a.goospec"}`)
+	if _, err := ReadGooSpec(filepath.Join(dir, "a.goospec")); err == nil || !strings.Contains(err.Error(), "goospec extends itself") {
+		t.Errorf("ReadGooSpec of a cycle returned %v, want a cycle error", err)
+	}
+
+	write("broken.goospec", "{\n  \"name\": \"x\",\n  \"arch\" \"noarch\"\n}")
+	write("child.goospec", `{"extends": "broken.goospec"}`)
+	werr := "broken.goospec:3:10: invalid character"
+	if _, err := ReadGooSpec(filepath.Join(dir, "child.goospec")); err == nil || !strings.Contains(err.Error(), werr) {
+		t.Errorf("ReadGooSpec of a broken base returned %v, want an error containing %q", err, werr)
+	}
+}
+
+func TestReadGooSpecVars(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	base := `{"arch": "noarch", "description": "{{.team}} tools"}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "base.goospec"), []byte(base), 0644); err != nil {
+		t.Fatalf("error writing base.goospec: %v", err)
+	}
+	p := filepath.Join(dir, "pkg.goospec")
+	spec := `{"extends": "base.goospec", "name": "pkg", "version": "{{.version}}"}`
+	if err := ioutil.WriteFile(p, []byte(spec), 0644); err != nil {
+		t.Fatalf("error writing pkg.goospec: %v", err)
+	}
+
+	gs, err := ReadGooSpecVars(p, map[string]string{"version": "1.2.3@4", "team": "build"})
+	if err != nil {
+		t.Fatalf("ReadGooSpecVars: %v", err)
+	}
+	if gs.PackageSpec.Version != "1.2.3@4" || gs.PackageSpec.Description != "build tools" {
+		t.Errorf("ReadGooSpecVars() = %+v, want version 1.2.3@4 and description \"build tools\"", gs.PackageSpec)
+	}
+	if _, err := ReadGooSpecVars(p, map[string]string{"version": "1.2.3@4"}); err == nil || !strings.Contains(err.Error(), "team") {
+		t.Errorf("ReadGooSpecVars with a missing variable returned %v, want an error naming it", err)
+	}
+}
+
+func TestUnmarshalOwners(t *testing.T) {
+	table := []struct {
+		in   string
+		want Owners
+	}{
+		{`"someone"`, Owners{{Name: "someone"}}},
+		{`"someone, someone@example.com"`, Owners{{Name: "someone"}, {Email: "someone@example.com"}}},
+		{`"Some One <someone@example.com>,"`, Owners{{Name: "Some One", Email: "someone@example.com"}}},
+		{`""`, nil},
+		{`[{"Name": "someone", "Team": "team", "EscalationURL": "https://oncall"}]`, Owners{{Name: "someone", Team: "team", EscalationURL: "https://oncall"}}},
+	}
+	for _, tt := range table {
+		var got Owners
+		if err := json.Unmarshal([]byte(tt.in), &got); err != nil {
+			t.Errorf("error unmarshalling %s: %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("unmarshalled owners for %s unexpected: got %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMarshalOwners(t *testing.T) {
+	ps := &PkgSpec{Name: "foo", Owners: Owners{{Name: "Some One", Email: "someone@example.com", Team: "team"}, {Team: "other", EscalationURL: "https://oncall"}}}
+	b, err := json.Marshal(ps)
+	if err != nil {
+		t.Fatalf("error marshalling spec: %v", err)
+	}
+
+	// Clients from before structured owners read Owners as a string.
+	var old struct{ Owners string }
+	if err := json.Unmarshal(b, &old); err != nil {
+		t.Fatalf("error unmarshalling %s with string owners: %v", b, err)
+	}
+	if want := "Some One <someone@example.com> (team), (other)"; old.Owners != want {
+		t.Errorf("legacy Owners = %q, want %q", old.Owners, want)
+	}
+
+	var got PkgSpec
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("error unmarshalling %s: %v", b, err)
+	}
+	if !reflect.DeepEqual(got.Owners, ps.Owners) {
+		t.Errorf("Owners = %+v, want %+v", got.Owners, ps.Owners)
+	}
+}
+
+func TestOwnersString(t *testing.T) {
+	ol := Owners{{Name: "Some One", Email: "someone@example.com", Team: "team"}, {Email: "other@example.com"}}
+	want := "Some One <someone@example.com> (team), <other@example.com>"
+	if got := ol.String(); got != want {
+		t.Errorf("Owners.String() = %q, want %q", got, want)
+	}
+}
+
 func TestMarshal(t *testing.T) {
 	rs := &RepoSpec{
 		Checksum: "asdkgaksd545as4d6",
@@ -292,7 +669,7 @@ func TestMarshal(t *testing.T) {
 			Arch:         "noarch",
 			ReleaseNotes: []string{"1.2.3@4 - something new", "1.2.3@4 - something"},
 			Description:  "blah blah",
-			Owners:       "someone",
+			Owners:       Owners{{Name: "someone"}},
 			Install: ExecFile{
 				Path: "install.ps1",
 			},
@@ -310,11 +687,16 @@ func TestMarshal(t *testing.T) {
       "1.2.3@4 - something"
     ],
     "Description": "blah blah",
-    "Owners": "someone",
     "Install": {
       "Path": "install.ps1"
     },
-    "Uninstall": {}
+    "Uninstall": {},
+    "Owners": "someone",
+    "OwnerDetails": [
+      {
+        "Name": "someone"
+      }
+    ]
   }
 }`)
 	got, err := rs.Marshal()
@@ -373,3 +755,111 @@ In the same village where my father and my mother dwelt, dwelt also a thin, upri
 These last words, you must know, were not according to the old form in which such licences, faculties, and powers usually ran, which in like cases had heretofore been granted to the sisterhood. But it was according to a neat Formula of Didius his own devising, who having a particular turn for taking to pieces, and new framing over again all kind of instruments in that way, not only hit upon this dainty amendment, but coaxed many of the old licensed matrons in the neighbourhood, to open their faculties afresh, in order to have this wham-wham of his inserted.
 
 I own I never could envy Didius in these kinds of fancies of his:—But every man to his own taste.—Did not Dr. Kunastrokius, that great man, at his leisure hours, take the greatest delight imaginable in combing of asses tails, and plucking the dead hairs out with his teeth, though he had tweezers always in his pocket? Nay, if you come to that, Sir, have not the wisest of men in all ages, not excepting Solomon himself,—have they not had their Hobby-Horses;—their running horses,—their coins and their cockle-shells, their drums and their trumpets, their fiddles, their pallets,—their maggots and their butterflies?—and so long as a man rides his Hobby-Horse peaceably and quietly along the King's highway, and neither compels you or me to get up behind him,—pray, Sir, what have either you or I to do with it?`)
+
+func TestExecFileKB(t *testing.T) {
+	table := []struct {
+		path, want string
+	}{
+		{"windows10.0-kb4524570-x64.msu", "KB4524570"},
+		{"updates/Windows8.1-KB2919355-x64.MSU", "KB2919355"},
+		{"update.msu", ""},
+		{"kb4524570.msi", ""},
+		{"", ""},
+	}
+	for _, tt := range table {
+		if got := (ExecFile{Path: tt.path}).KB(); got != tt.want {
+			t.Errorf("KB() for %q returned %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func FuzzParseVersion(f *testing.F) {
+	for _, s := range []string{"1.2.3@4", "1.0.0", "1.2.3.4@5", "1.02.3", "1.2.3-beta@1", "", "@", "1.2.3@-1"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if _, err := ParseVersion(s); err != nil {
+			return
+		}
+		c, err := Compare(s, s)
+		if err != nil {
+			t.Fatalf("Compare(%q, %q) returned error for a version that parses: %v", s, s, err)
+		}
+		if c != 0 {
+			t.Errorf("Compare(%q, %q) = %d, want 0", s, s, c)
+		}
+	})
+}
+
+func TestVerifyPublished(t *testing.T) {
+	// Published before names were restricted and descriptions capped.
+	spec := &PkgSpec{
+		Name:            "Old_Tool",
+		Version:         "1.0.0@1",
+		Arch:            "noarch",
+		Description:     strings.Repeat("a", maxDescriptionSize+1),
+		ReleaseNotes:    []string{strings.Repeat("a", maxReleaseNotesSize+1)},
+		PkgDependencies: map[string]string{"Other_Tool": "1.0.0@1"},
+	}
+	b, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UnmarshalPackageSpec(b); err != nil {
+		t.Errorf("UnmarshalPackageSpec of a published spec: %v", err)
+	}
+	if _, err := MarshalPackageSpec(spec); err == nil {
+		t.Error("MarshalPackageSpec of a spec breaking the authoring rules did not return an error")
+	}
+	spec.Arch = "sparc"
+	if b, err = json.Marshal(spec); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UnmarshalPackageSpec(b); err == nil {
+		t.Error("UnmarshalPackageSpec of a spec with an invalid arch did not return an error")
+	}
+}
+
+func FuzzUnmarshalPackageSpec(f *testing.F) {
+	f.Add([]byte(`{"name": "test", "version": "1.2.3@4", "arch": "noarch", "pkgdependencies": {"foo": "1.0.0@1"}}`))
+	f.Add([]byte(`{"name": "test", "files": {"a": "<ProgramFiles>/a"}, "install": {"path": "install.ps1"}}`))
+	f.Add([]byte(`{`))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		// Specs come from repos we do not control, only a panic is a failure.
+		UnmarshalPackageSpec(b)
+	})
+}
+
+func FuzzReadPackageSpec(f *testing.F) {
+	buf := new(bytes.Buffer)
+	w := tar.NewWriter(buf)
+	if err := WritePackageSpec(w, &PkgSpec{Name: "test", Version: "1.2.3@4", Arch: "noarch"}); err != nil {
+		f.Fatalf("error writing GooSpec: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		f.Fatalf("error closing tar writer: %v", err)
+	}
+	f.Add(buf.Bytes())
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		ReadPackageSpec(bytes.NewReader(b))
+	})
+}
+
+func TestReadPackageSpecTooLarge(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := tar.NewWriter(buf)
+	data := make([]byte, maxSpecSize+1)
+	if err := w.WriteHeader(&tar.Header{Name: "test.pkgspec", Mode: 0644, Size: int64(len(data))}); err != nil {
+		t.Fatalf("error writing header: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("error writing spec: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("error closing tar writer: %v", err)
+	}
+	if _, err := ReadPackageSpec(buf); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("ReadPackageSpec with an oversized spec returned %v, want size error", err)
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package goolib
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Release notes are lists of entries, newest first, each starting with the
+// version it is for followed by " - ". Further lines of an entry are
+// indented to line up with its dash:
+//
+//	2.9.1 - Add ability to specify proxy server.
+//	2.9.0 - Add addrepo, rmrepo, and listrepos commands.
+//	      - Use args instead of flags for available and installed commands.
+
+var (
+	noteEntry = regexp.MustCompile(`^(\S+) - \S`)
+	noteCont  = regexp.MustCompile(`^\s+- \S`)
+)
+
+// LintReleaseNotes checks that the release notes of spec follow the format
+// above, that the first entry is for the version of spec and that versions
+// do not increase down the list. A version without @release in the notes
+// matches any release of it.
+func LintReleaseNotes(spec *PkgSpec) []error {
+	var errs []error
+	var prev *Version
+	for i, n := range spec.ReleaseNotes {
+		m := noteEntry.FindStringSubmatch(n)
+		if m == nil {
+			if i == 0 || !noteCont.MatchString(n) {
+				errs = append(errs, fmt.Errorf("release note %d %q does not start with \"<version> - \" or continue an entry with \"- \"", i+1, n))
+			}
+			continue
+		}
+		v, err := ParseVersion(m[1])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("release note %d: invalid version %q: %v", i+1, m[1], err))
+			continue
+		}
+		if i == 0 && !noteVersionMatches(m[1], spec.Version) {
+			errs = append(errs, fmt.Errorf("first release note is for version %s, the package is version %s", m[1], spec.Version))
+		}
+		if prev != nil && compareNoteVersions(v, *prev) > 0 {
+			errs = append(errs, fmt.Errorf("release note %d for version %s is newer than the one before it", i+1, m[1]))
+		}
+		prev = &v
+	}
+	return errs
+}
+
+// noteVersionMatches reports whether the version nv of a release note is
+// version, or a release of it if nv has none.
+func noteVersionMatches(nv, version string) bool {
+	a, err := ParseVersion(nv)
+	if err != nil {
+		return false
+	}
+	b, err := ParseVersion(version)
+	if err != nil {
+		return false
+	}
+	if !strings.Contains(nv, "@") {
+		return a.Semver.Equals(b.Semver)
+	}
+	return a.Semver.Equals(b.Semver) && a.GsVer == b.GsVer
+}
+
+// compareNoteVersions compares release note versions like Compare, ignoring
+// the release if either has none.
+func compareNoteVersions(a, b Version) int {
+	if c := a.Semver.Compare(b.Semver); c != 0 {
+		return c
+	}
+	if a.GsVer == 0 || b.GsVer == 0 {
+		return 0
+	}
+	switch {
+	case a.GsVer > b.GsVer:
+		return 1
+	case a.GsVer < b.GsVer:
+		return -1
+	}
+	return 0
+}
+
+// conventional matches a conventional commit subject: type(scope)!: text.
+var conventional = regexp.MustCompile(`^([a-zA-Z]+)(\([^)]*\))?(!)?: (.+)$`)
+
+// changelogOrder are the conventional commit types kept in a changelog, in
+// the order they are listed. Other types, like chore or docs, are left out.
+var changelogOrder = []string{"feat", "fix", "perf"}
+
+// ChangelogEntry returns a release notes entry for version from commit
+// subjects, newest first. Conventional commit subjects are listed breaking
+// changes first, then features, fixes and performance changes, without
+// their type; other conventional types are left out and subjects that are
+// not conventional commits are listed last as they are. It returns nil if
+// nothing is left to list.
+func ChangelogEntry(version string, subjects []string) []string {
+	groups := make(map[string][]string)
+	var breaking, other []string
+	for _, s := range subjects {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		m := conventional.FindStringSubmatch(s)
+		if m == nil {
+			other = append(other, s)
+			continue
+		}
+		text := upperFirst(m[4])
+		if m[3] != "" {
+			breaking = append(breaking, "BREAKING: "+text)
+			continue
+		}
+		t := strings.ToLower(m[1])
+		groups[t] = append(groups[t], text)
+	}
+	lines := breaking
+	for _, t := range changelogOrder {
+		lines = append(lines, groups[t]...)
+	}
+	lines = append(lines, other...)
+	if len(lines) == 0 {
+		return nil
+	}
+
+	entry := []string{version + " - " + lines[0]}
+	indent := strings.Repeat(" ", utf8.RuneCountInString(version)+1)
+	for _, l := range lines[1:] {
+		entry = append(entry, indent+"- "+l)
+	}
+	return entry
+}
+
+func upperFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[n:]
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package goolib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLintReleaseNotes(t *testing.T) {
+	for _, tt := range []struct {
+		desc    string
+		version string
+		notes   []string
+		errs    int
+	}{
+		{"none", "1.0.0@1", nil, 0},
+		{"valid", "2.9.1@1", []string{"2.9.1 - Add proxy.", "2.9.0 - Add addrepo.", "      - Use args."}, 0},
+		{"with release", "1.2.3@4", []string{"1.2.3@4 - Fix.", "1.2.3@3 - Fix."}, 0},
+		{"wrong version", "2.0.0@1", []string{"1.9.0 - Fix."}, 1},
+		{"wrong release", "1.2.3@4", []string{"1.2.3@3 - Fix."}, 1},
+		{"increasing", "2.0.0@1", []string{"2.0.0 - Fix.", "1.0.0 - Fix.", "1.5.0 - Fix."}, 1},
+		{"no dash", "1.0.0@1", []string{"1.0.0: Fix."}, 1},
+		{"continuation first", "1.0.0@1", []string{"  - Fix."}, 1},
+	} {
+		errs := LintReleaseNotes(&PkgSpec{Version: tt.version, ReleaseNotes: tt.notes})
+		if len(errs) != tt.errs {
+			t.Errorf("%s: LintReleaseNotes() = %v, want %d errors", tt.desc, errs, tt.errs)
+		}
+	}
+}
+
+func TestChangelogEntry(t *testing.T) {
+	subjects := []string{
+		"fix(install): keep config files on upgrade",
+		"chore: bump deps",
+		"feat!: drop the old state format",
+		"feat: add reposet command",
+		"Update README",
+		"",
+	}
+	want := []string{
+		"2.10.0@1 - BREAKING: Drop the old state format",
+		"         - Add reposet command",
+		"         - Keep config files on upgrade",
+		"         - Update README",
+	}
+	if got := ChangelogEntry("2.10.0@1", subjects); !reflect.DeepEqual(got, want) {
+		t.Errorf("ChangelogEntry() = %q, want %q", got, want)
+	}
+	if got := ChangelogEntry("1.0.0@1", []string{"chore: tidy", "docs: typo"}); got != nil {
+		t.Errorf("ChangelogEntry of only left out types = %q, want nil", got)
+	}
+	if errs := LintReleaseNotes(&PkgSpec{Version: "2.10.0@1", ReleaseNotes: want}); len(errs) > 0 {
+		t.Errorf("generated entry does not pass LintReleaseNotes: %v", errs)
+	}
+}
@@ -0,0 +1,271 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package goolib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SpecSchema returns a JSON Schema of goospec files, generated from GooSpec
+// and PkgSpec. Field names are spelled in lower camel case as in goospec
+// files, although GooGet itself ignores their case.
+func SpecSchema() ([]byte, error) {
+	props := specProperties()
+	s := map[string]interface{}{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"title":                "GooGet goospec",
+		"type":                 "object",
+		"properties":           props,
+		"required":             []string{"name", "version", "arch"},
+		"additionalProperties": false,
+	}
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// specProperties returns the schemas of the top level fields of a goospec:
+// those of GooSpec, those of PkgSpec, which goospec files hold inline, and
+// extends.
+func specProperties() map[string]interface{} {
+	props := make(map[string]interface{})
+	for _, t := range []reflect.Type{reflect.TypeOf(GooSpec{}), reflect.TypeOf(PkgSpec{})} {
+		for name, s := range fieldSchemas(t) {
+			if name == "packageSpec" {
+				continue
+			}
+			props[name] = s
+		}
+	}
+	// OwnerDetails is written by PkgSpec.MarshalJSON, specs holding it are
+	// read like any other.
+	props["ownerDetails"] = typeSchema(reflect.TypeOf([]Owner{}))
+	props[extendsKey] = map[string]interface{}{"type": "string"}
+	return props
+}
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	ownerType = reflect.TypeOf(Owners{})
+)
+
+// typeSchema returns the JSON Schema of values of type t.
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case ownerType:
+		// Owners also accepts a comma separated string, see UnmarshalJSON.
+		return map[string]interface{}{"anyOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())},
+		}}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           fieldSchemas(t),
+			"additionalProperties": false,
+		}
+	}
+	return map[string]interface{}{}
+}
+
+// fieldSchemas returns the schemas of the exported fields of the struct t by
+// their goospec name.
+func fieldSchemas(t reflect.Type) map[string]interface{} {
+	props := make(map[string]interface{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag := strings.Split(f.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		props[lowerCamel(name)] = typeSchema(f.Type)
+	}
+	return props
+}
+
+// lowerCamel lowers the leading capitals of s, all but the last of them if
+// it starts the next word: HelpURL is helpURL, ACL is acl, KBList is kbList.
+func lowerCamel(s string) string {
+	r := []rune(s)
+	n := 0
+	for n < len(r) && unicode.IsUpper(r[n]) {
+		n++
+	}
+	if n > 1 && n < len(r) {
+		n--
+	}
+	for i := 0; i < n; i++ {
+		r[i] = unicode.ToLower(r[i])
+	}
+	return string(r)
+}
+
+// ValidationError is a problem found in a goospec by ValidateSpecBytes. Line
+// and Column, counted from 1, are 0 for problems that are not tied to a
+// place in the file.
+type ValidationError struct {
+	Line, Column int    `json:",omitempty"`
+	Field        string `json:",omitempty"`
+	Message      string
+}
+
+func (e ValidationError) Error() string {
+	var s []string
+	if e.Line > 0 {
+		s = append(s, fmt.Sprintf("%d:%d", e.Line, e.Column))
+	}
+	if e.Field != "" {
+		s = append(s, e.Field)
+	}
+	return strings.Join(append(s, e.Message), ": ")
+}
+
+// ValidateSpecBytes checks the goospec b and returns the problems found in
+// it, none if it is valid: JSON syntax, unknown fields, values of the wrong
+// type and the checks goopack makes of the package spec and its release
+// notes. A goospec that extends another cannot be checked as a whole without
+// the base, so only its syntax, fields and types are.
+func ValidateSpecBytes(b []byte) []ValidationError {
+	keys, err := topLevelKeys(b)
+	if err != nil {
+		return []ValidationError{jsonValidationError(b, err)}
+	}
+
+	var errs []ValidationError
+	props := specProperties()
+	known := make(map[string]bool)
+	for name := range props {
+		known[strings.ToLower(name)] = true
+	}
+	var names []string
+	for k := range keys {
+		names = append(names, k)
+	}
+	sort.Slice(names, func(i, j int) bool { return keys[names[i]] < keys[names[j]] })
+	for _, k := range names {
+		if !known[strings.ToLower(k)] {
+			line, col := position(b, keys[k])
+			errs = append(errs, ValidationError{Line: line, Column: col, Field: k, Message: "unknown field"})
+		}
+	}
+
+	gs, err := unmarshalGooSpec(b)
+	if err != nil {
+		ve := jsonValidationError(b, err)
+		// Place type errors at their top level field, the offsets of those
+		// found by custom decoders like that of Owners are not of b.
+		if ve.Field != "" {
+			top := strings.Split(ve.Field, ".")[0]
+			for k, off := range keys {
+				if strings.EqualFold(k, top) {
+					ve.Line, ve.Column = position(b, off)
+				}
+			}
+		}
+		return append(errs, ve)
+	}
+	for k := range keys {
+		if strings.EqualFold(k, extendsKey) {
+			return errs
+		}
+	}
+	if err := gs.verify(); err != nil {
+		se, ok := err.(SpecError)
+		if !ok {
+			se = SpecError{err}
+		}
+		for _, e := range se {
+			errs = append(errs, ValidationError{Message: e.Error()})
+		}
+	}
+	for _, e := range LintReleaseNotes(gs.PackageSpec) {
+		errs = append(errs, ValidationError{Field: "releaseNotes", Message: e.Error()})
+	}
+	return errs
+}
+
+// topLevelKeys returns the keys of the JSON object b with their offsets,
+// counted like those of JSON errors up to and including their opening quote.
+func topLevelKeys(b []byte) (map[string]int64, error) {
+	var v map[string]json.RawMessage
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	if _, err := d.Token(); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]int64)
+	for d.More() {
+		off := d.InputOffset()
+		for off < int64(len(b)) && strings.IndexByte(" \t\r\n,", b[off]) >= 0 {
+			off++
+		}
+		t, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		k, _ := t.(string)
+		keys[k] = off + 1
+		var raw json.RawMessage
+		if err := d.Decode(&raw); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// jsonValidationError returns err, an error decoding the goospec b, as a
+// ValidationError placed where it happened if that is known.
+func jsonValidationError(b []byte, err error) ValidationError {
+	ve := ValidationError{Message: err.Error()}
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		ve.Line, ve.Column = position(b, e.Offset)
+	case *json.UnmarshalTypeError:
+		ve.Line, ve.Column = position(b, e.Offset)
+		ve.Field = e.Field
+	}
+	return ve
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package goolib
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestLowerCamel(t *testing.T) {
+	for in, want := range map[string]string{
+		"Name":            "name",
+		"PkgDependencies": "pkgDependencies",
+		"HelpURL":         "helpURL",
+		"ACL":             "acl",
+		"KBList":          "kbList",
+	} {
+		if got := lowerCamel(in); got != want {
+			t.Errorf("lowerCamel(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// TestSpecSchemaPublished checks that the published schema is up to date,
+// regenerate it with goopack -print_schema > goospec.schema.json.
+func TestSpecSchemaPublished(t *testing.T) {
+	want, err := SpecSchema()
+	if err != nil {
+		t.Fatalf("SpecSchema: %v", err)
+	}
+	got, err := ioutil.ReadFile("../goospec.schema.json")
+	if err != nil {
+		t.Fatalf("error reading published schema: %v", err)
+	}
+	if !bytes.Equal(bytes.TrimSpace(got), want) {
+		t.Error("goospec.schema.json is out of date, regenerate it with goopack -print_schema")
+	}
+}
+
+func TestValidateSpecBytes(t *testing.T) {
+	for _, tt := range []struct {
+		desc string
+		spec string
+		want []ValidationError
+	}{
+		{"valid", `{"name": "pkg", "version": "1.0.0@1", "arch": "noarch"}`, nil},
+		{"syntax", "{\n  \"name\": \"pkg\"\n  \"arch\": \"noarch\"\n}", []ValidationError{
+			{Line: 3, Column: 3, Message: "invalid character"},
+		}},
+		{"unknown field", "{\n  \"name\": \"pkg\",\n  \"version\": \"1.0.0@1\",\n  \"arch\": \"noarch\",\n  \"nmae\": \"x\"\n}", []ValidationError{
+			{Line: 5, Column: 3, Field: "nmae", Message: "unknown field"},
+		}},
+		{"wrong type", "{\n  \"name\": \"pkg\",\n  \"version\": \"1.0.0@1\",\n  \"arch\": \"noarch\",\n  \"coinstallable\": \"yes\"\n}", []ValidationError{
+			{Line: 5, Column: 3, Field: "coinstallable", Message: "cannot unmarshal string"},
+		}},
+		{"spec check", `{"name": "pkg", "version": "1.0.0@1", "arch": "sparc"}`, []ValidationError{
+			{Message: `invalid architecture: "sparc"`},
+		}},
+		{"extends", `{"extends": "base.goospec", "version": "1.0.0@1"}`, nil},
+	} {
+		// Messages come from encoding/json, only check how they start.
+		got := ValidateSpecBytes([]byte(tt.spec))
+		ok := len(got) == len(tt.want)
+		for i := 0; ok && i < len(got); i++ {
+			g, w := got[i], tt.want[i]
+			ok = g.Line == w.Line && g.Column == w.Column && g.Field == w.Field && strings.Contains(g.Message, w.Message)
+		}
+		if !ok {
+			t.Errorf("%s: ValidateSpecBytes() = %+v, want %+v", tt.desc, got, tt.want)
+		}
+	}
+}
@@ -17,47 +17,128 @@ package main
 import (
 	"archive/tar"
 	"compress/gzip"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
-	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/googet/goolib"
 	"github.com/google/googet/oswrap"
 )
 
-var outputDir = flag.String("output_dir", "", "where to put the built package")
+var (
+	outputDir = flag.String("output_dir", "", "where to put the built package")
+	links     = flag.String("links", linksFollow, `how to package symlinks: "follow" packages what they point to, "record" packages the links themselves`)
+	commit    = flag.String("commit", "", "version control commit the package is built from, by default the HEAD of the git checkout holding the goospec, if any")
+	shaFile   = flag.Bool("sha256_file", false, "also write <package>.sha256 with the SHA256 checksum of the package")
+	repoSpec  = flag.Bool("repo_spec", false, "also write <package>.repospec with the repo index entry of the package")
+	srcPrefix = flag.String("source_prefix", "packages", "directory of the package in the repo, the index entry's source is <source_prefix>/<package>")
+	schema    = flag.Bool("print_schema", false, "print the JSON Schema of goospec files and exit")
+	changelog = flag.Bool("changelog_from_git", false, "generate the release notes entry of the package version from the git log since the last tag")
+	jobs      = flag.Int("jobs", runtime.NumCPU(), "number of packages build-all builds at once")
+	report    = flag.String("build_report", "", "with build-all, also write a JSON report of the builds to this file")
+	specVars  = make(vars)
+)
+
+func init() {
+	flag.Var(specVars, "var", "template variable of the goospec as name=value, can be repeated")
+}
+
+// vars are the template variables of goospecs, see goolib.ReadGooSpecVars.
+type vars map[string]string
+
+func (v vars) String() string {
+	var s []string
+	for k, val := range v {
+		s = append(s, k+"="+val)
+	}
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
+
+func (v vars) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("%q is not name=value", s)
+	}
+	v[kv[0]] = kv[1]
+	return nil
+}
+
+// version is the goopack version recorded in the provenance of packages, it
+// is set with -ldflags "-X main.version=...".
+var version = "dev"
 
-type fileMap map[string][]string
+const (
+	linksFollow = "follow"
+	linksRecord = "record"
+)
+
+// fileMap maps the paths of files in the package to the files they are
+// packaged from.
+type fileMap map[string]string
 
 // walkDir returns a list of all files in directory and subdirectories, it is similar
 // to filepath.Walk but works even if dir is a symlink, which is the case with blaze Filesets.
+// Links below dir are followed, or with -links=record listed like files. A
+// link back to a directory it is in is an error, as following it would never
+// end.
 func walkDir(dir string) ([]string, error) {
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+	return walkTree(dir, real, map[string]bool{})
+}
+
+// walkTree walks dir, whose path with links resolved is real. ancestors are
+// the resolved paths of the directories dir is in.
+func walkTree(dir, real string, ancestors map[string]bool) ([]string, error) {
 	rl, err := ioutil.ReadDir(dir)
 	if err != nil {
 		return nil, err
 	}
+	ancestors[real] = true
+	defer delete(ancestors, real)
+
 	var wl []string
 	for _, fi := range rl {
 		path := filepath.Join(dir, fi.Name())
+		rp := filepath.Join(real, fi.Name())
 
-		// follow symlinks
 		if (fi.Mode() & os.ModeSymlink) != 0 {
-			if fi, err = oswrap.Stat(path); err != nil {
-				return nil, err
+			if *links == linksRecord {
+				wl = append(wl, path)
+				continue
+			}
+			// follow symlinks
+			if rp, err = filepath.EvalSymlinks(path); err != nil {
+				return nil, fmt.Errorf("following link %s: %v", path, err)
+			}
+			if fi, err = oswrap.Stat(rp); err != nil {
+				return nil, fmt.Errorf("following link %s: %v", path, err)
+			}
+			if fi.IsDir() && ancestors[rp] {
+				return nil, fmt.Errorf("link %s leads back to %s, which contains it", path, rp)
 			}
 		}
 		if !fi.IsDir() {
 			wl = append(wl, path)
 			continue
 		}
-		l, err := walkDir(path)
+		l, err := walkTree(path, rp, ancestors)
 		if err != nil {
 			return nil, err
 		}
@@ -66,41 +147,9 @@ func walkDir(dir string) ([]string, error) {
 	return wl, nil
 }
 
-// pathMatch is a simpler filepath.Match but which supports recursive globbing
-// (**) and doesn't get any more special than * or **.
-func pathMatch(pattern, path string) (bool, error) {
-	regex := []rune("^")
-	runePattern := []rune(pattern)
-	for i := 0; i < len(runePattern); i++ {
-		ch := runePattern[i]
-		switch ch {
-		default:
-			regex = append(regex, ch)
-		case '%', '\\', '(', ')', '[', ']', '.', '^', '$', '?', '+', '{', '}', '=':
-			regex = append(regex, '\\', ch)
-		case '*':
-			if i+1 < len(runePattern) && runePattern[i+1] == '*' {
-				if i+2 < len(runePattern) && runePattern[i+2] == '*' {
-					return false, fmt.Errorf("%s: malformed glob", pattern)
-				}
-				regex = append(regex, []rune(".*")...)
-				i++
-			} else {
-				regex = append(regex, []rune("[^/]*")...)
-			}
-		}
-	}
-	regex = append(regex, '$')
-	re, err := regexp.Compile(string(regex))
-	if err != nil {
-		return false, err
-	}
-	return re.MatchString(path), nil
-}
-
 func anyMatch(patterns []string, name string) (bool, error) {
 	for _, ex := range patterns {
-		m, err := pathMatch(ex, name)
+		m, err := goolib.PathMatch(ex, name)
 		if err != nil {
 			return false, err
 		}
@@ -216,34 +265,73 @@ func globFiles(s goolib.PkgSources) ([]string, error) {
 	return glob(cr, s.Include, s.Exclude)
 }
 
-func writeFiles(tw *tar.Writer, fm fileMap) error {
-	for folder, fl := range fm {
-		for _, file := range fl {
-			fi, err := oswrap.Stat(file)
-			if err != nil {
-				return err
-			}
-			fpath := filepath.Join(folder, filepath.Base(file))
-			fih, err := tar.FileInfoHeader(fi, "")
-			if err != nil {
-				return err
-			}
-			fih.Name = filepath.ToSlash(fpath)
-			if err := tw.WriteHeader(fih); err != nil {
-				return err
-			}
-			f, err := oswrap.Open(file)
-			if err != nil {
-				return err
-			}
-			if _, err := io.Copy(tw, f); err != nil {
-				f.Close()
-				return err
+// writeFiles writes the files in fm to tw and returns their total size.
+// Files are written in order so the same files give the same package.
+func writeFiles(tw *tar.Writer, fm fileMap) (int64, error) {
+	var paths []string
+	for p := range fm {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var size int64
+	for _, fpath := range paths {
+		file := fm[fpath]
+		stat := oswrap.Stat
+		if *links == linksRecord {
+			stat = oswrap.Lstat
+		}
+		fi, err := stat(file)
+		if err != nil {
+			return 0, err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if err := writeLink(tw, fi, file, fpath); err != nil {
+				return 0, err
 			}
+			continue
+		}
+		fih, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return 0, err
+		}
+		fih.Name = filepath.ToSlash(fpath)
+		if err := tw.WriteHeader(fih); err != nil {
+			return 0, err
+		}
+		f, err := oswrap.Open(file)
+		if err != nil {
+			return 0, err
+		}
+		n, err := io.Copy(tw, f)
+		if err != nil {
 			f.Close()
+			return 0, err
 		}
+		f.Close()
+		size += n
 	}
-	return nil
+	return size, nil
+}
+
+// writeLink writes the link file to tw as fpath. The link has to point to
+// somewhere inside the package, GooGet refuses to install it otherwise.
+func writeLink(tw *tar.Writer, fi os.FileInfo, file, fpath string) error {
+	target, err := os.Readlink(file)
+	if err != nil {
+		return err
+	}
+	target = filepath.Clean(target)
+	rel := filepath.Join(filepath.Dir(fpath), target)
+	if filepath.IsAbs(target) || filepath.VolumeName(target) != "" || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("link %s points to %s, outside the package, use -links=%s to package what it points to", file, target, linksFollow)
+	}
+	fih, err := tar.FileInfoHeader(fi, filepath.ToSlash(target))
+	if err != nil {
+		return err
+	}
+	fih.Name = filepath.ToSlash(fpath)
+	return tw.WriteHeader(fih)
 }
 
 func packageFiles(fm fileMap, gs goolib.GooSpec, dir string) (err error) {
@@ -273,9 +361,11 @@ func packageFiles(fm fileMap, gs goolib.GooSpec, dir string) (err error) {
 		}
 	}()
 
-	if err := writeFiles(tw, fm); err != nil {
+	size, err := writeFiles(tw, fm)
+	if err != nil {
 		return err
 	}
+	gs.PackageSpec.InstalledSize = size
 
 	return goolib.WritePackageSpec(tw, gs.PackageSpec)
 }
@@ -283,21 +373,70 @@ func packageFiles(fm fileMap, gs goolib.GooSpec, dir string) (err error) {
 func mapFiles(sources []goolib.PkgSources) (fileMap, error) {
 	fm := make(fileMap)
 	for _, s := range sources {
+		mapped, err := mapRenames(fm, s)
+		if err != nil {
+			return nil, err
+		}
 		fl, err := globFiles(s)
 		if err != nil {
 			return nil, err
 		}
 		for _, f := range fl {
+			// Files renamed by Map are only packaged under their new path.
+			if mapped[filepath.Clean(f)] {
+				continue
+			}
 			dir := strings.TrimPrefix(filepath.Dir(f), s.Root)
 			// Ensure leading '/' is trimmed for directories.
 			dir = strings.TrimPrefix(dir, string(filepath.Separator))
-			tgt := filepath.Join(s.Target, dir)
-			fm[tgt] = append(fm[tgt], f)
+			fm[filepath.Join(s.Target, dir, filepath.Base(f))] = f
 		}
 	}
 	return fm, nil
 }
 
+// mapRenames adds the files in s.Map to fm under their new paths and returns
+// the files it added. A directory is added with all the files under it.
+func mapRenames(fm fileMap, s goolib.PkgSources) (map[string]bool, error) {
+	var srcs []string
+	for src := range s.Map {
+		srcs = append(srcs, src)
+	}
+	sort.Strings(srcs)
+
+	mapped := make(map[string]bool)
+	for _, src := range srcs {
+		dst := filepath.Clean(filepath.FromSlash(s.Map[src]))
+		if filepath.IsAbs(dst) || filepath.VolumeName(dst) != "" || dst == "." || dst == ".." || strings.HasPrefix(dst, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("map of %s: %q is not a path inside the package", src, s.Map[src])
+		}
+		path := filepath.Join(filepath.Clean(s.Root), filepath.FromSlash(src))
+		fi, err := oswrap.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("map of %s: %v", src, err)
+		}
+		files := []string{path}
+		if fi.IsDir() {
+			if files, err = walkDir(path); err != nil {
+				return nil, fmt.Errorf("walking %s: %v", path, err)
+			}
+		}
+		for _, f := range files {
+			rel, err := filepath.Rel(path, f)
+			if err != nil {
+				return nil, err
+			}
+			fpath := filepath.Join(s.Target, dst, rel)
+			if prev, ok := fm[fpath]; ok && prev != f {
+				return nil, fmt.Errorf("map of %s: both %s and %s would be packaged as %s", src, prev, f, fpath)
+			}
+			fm[fpath] = f
+			mapped[filepath.Clean(f)] = true
+		}
+	}
+	return mapped, nil
+}
+
 func splitPath(path string) []string {
 	parts := strings.Split(filepath.Clean(path), string(os.PathSeparator))
 	out := []string{}
@@ -314,21 +453,35 @@ func splitPath(path string) []string {
 
 func verifyFiles(gs goolib.GooSpec, fm fileMap) error {
 	fs := make(map[string]bool)
-	for folder, fl := range fm {
-		parts := splitPath(folder)
+	for fpath := range fm {
+		parts := splitPath(fpath)
 		for i := range parts {
 			fs[filepath.Join(parts[:i+1]...)] = true
 		}
-		folder = filepath.Join(parts...)
-		for _, file := range fl {
-			fpath := filepath.Join(folder, filepath.Base(file))
-			fs[fpath] = true
-		}
+	}
+	perms := make(map[string]string)
+	for k := range gs.PackageSpec.Permissions {
+		perms[k] = ""
 	}
 	var missing []string
-	for src := range gs.PackageSpec.Files {
-		if !fs[src] {
-			missing = append(missing, src)
+	for _, files := range []map[string]string{gs.PackageSpec.Files, gs.PackageSpec.ConfigFiles, perms} {
+		for src := range files {
+			if strings.HasPrefix(src, "!") {
+				continue
+			}
+			if strings.Contains(src, "*") {
+				m, err := globMatches(src, fs)
+				if err != nil {
+					return err
+				}
+				if !m {
+					missing = append(missing, src)
+				}
+				continue
+			}
+			if !fs[src] {
+				missing = append(missing, src)
+			}
 		}
 	}
 	if len(missing) > 0 {
@@ -337,14 +490,28 @@ func verifyFiles(gs goolib.GooSpec, fm fileMap) error {
 	return nil
 }
 
+// globMatches reports whether the glob source pattern matches any path in fs.
+func globMatches(pattern string, fs map[string]bool) (bool, error) {
+	for p := range fs {
+		m, err := goolib.PathMatch(pattern, filepath.ToSlash(p))
+		if err != nil {
+			return false, err
+		}
+		if m {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func createPackage(gs goolib.GooSpec, dir string) error {
 	switch {
 	case gs.Build.Linux != "" && runtime.GOOS == "linux":
-		if err := goolib.Exec(gs.Build.Linux, nil, nil, ioutil.Discard); err != nil {
+		if err := goolib.Exec(gs.Build.Linux, "", nil, nil, nil, ioutil.Discard); err != nil {
 			return err
 		}
 	case gs.Build.Windows != "" && runtime.GOOS == "windows":
-		if err := goolib.Exec(gs.Build.Windows, nil, nil, ioutil.Discard); err != nil {
+		if err := goolib.Exec(gs.Build.Windows, "", nil, nil, nil, ioutil.Discard); err != nil {
 			return err
 		}
 	}
@@ -355,27 +522,395 @@ func createPackage(gs goolib.GooSpec, dir string) error {
 	if err := verifyFiles(gs, fm); err != nil {
 		return err
 	}
-	return packageFiles(fm, gs, dir)
+	if err := packageFiles(fm, gs, dir); err != nil {
+		return err
+	}
+	return writePublishFiles(gs, dir)
+}
+
+// writePublishFiles writes the checksum file and repo index entry of the
+// package built from gs in dir, as requested by -sha256_file and -repo_spec,
+// so they can be published without reading the package again.
+func writePublishFiles(gs goolib.GooSpec, dir string) error {
+	if !*shaFile && !*repoSpec {
+		return nil
+	}
+	pn := goolib.PackageInfo{Name: gs.PackageSpec.Name, Arch: gs.PackageSpec.Arch, Ver: gs.PackageSpec.Version}.PkgName()
+	pkg := filepath.Join(dir, pn)
+	f, err := oswrap.Open(pkg)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	chksum := goolib.Checksum(f)
+
+	if *shaFile {
+		if err := ioutil.WriteFile(pkg+".sha256", []byte(fmt.Sprintf("%s  %s\n", chksum, pn)), 0644); err != nil {
+			return err
+		}
+	}
+	if *repoSpec {
+		rs := goolib.RepoSpec{
+			Source:      path.Join(*srcPrefix, pn),
+			Checksum:    chksum,
+			Size:        fi.Size(),
+			PackageSpec: gs.PackageSpec,
+		}
+		b, err := rs.Marshal()
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(pkg+".repospec", b, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// provenance returns the provenance of a package built from the goospec
+// file spec. SOURCE_DATE_EPOCH, in seconds since the Unix epoch, sets the
+// build time so that builds can be reproduced.
+func provenance(spec string) (*goolib.Provenance, error) {
+	f, err := oswrap.Open(spec)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	bt := time.Now().UTC()
+	if e := os.Getenv("SOURCE_DATE_EPOCH"); e != "" {
+		sec, err := strconv.ParseInt(e, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %v", e, err)
+		}
+		bt = time.Unix(sec, 0).UTC()
+	}
+	c := *commit
+	if c == "" {
+		c = gitCommit(filepath.Dir(spec))
+	}
+	return &goolib.Provenance{
+		Builder:      host,
+		Commit:       c,
+		BuildTime:    bt,
+		Goopack:      version,
+		SpecChecksum: goolib.Checksum(f),
+	}, nil
+}
+
+// releaseNotes returns notes with the entry of version generated from the
+// subjects of the commits in dir since the last tag, replacing any entry of
+// version at the top of notes.
+func releaseNotes(dir, version string, notes []string) ([]string, error) {
+	r := "HEAD"
+	if tag, err := exec.Command("git", "-C", dir, "describe", "--tags", "--abbrev=0").Output(); err == nil {
+		r = strings.TrimSpace(string(tag)) + "..HEAD"
+	}
+	out, err := exec.Command("git", "-C", dir, "log", "--format=%s", r).Output()
+	if err != nil {
+		return nil, fmt.Errorf("reading git log of %s: %v", dir, err)
+	}
+	entry := goolib.ChangelogEntry(version, strings.Split(string(out), "\n"))
+	if entry == nil {
+		return notes, nil
+	}
+	// Drop an existing entry of version, its first line and those
+	// continuing it.
+	if len(notes) > 0 && strings.HasPrefix(notes[0], version+" - ") {
+		i := 1
+		for i < len(notes) && strings.HasPrefix(strings.TrimSpace(notes[i]), "- ") {
+			i++
+		}
+		notes = notes[i:]
+	}
+	return append(entry, notes...), nil
+}
+
+// gitCommit returns the HEAD commit of the git checkout dir is in, or ""
+// if there is none.
+func gitCommit(dir string) string {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// readSpec reads the goospec spec with the template variables vars, nil
+// for none, and completes its package spec for building: provenance, the
+// release notes generated with -changelog_from_git, and a check of the
+// release notes.
+func readSpec(spec string, vars map[string]string) (goolib.GooSpec, error) {
+	gs, err := goolib.ReadGooSpecVars(spec, vars)
+	if err != nil {
+		return gs, err
+	}
+	if gs.PackageSpec.Provenance, err = provenance(spec); err != nil {
+		return gs, err
+	}
+	if *changelog {
+		if gs.PackageSpec.ReleaseNotes, err = releaseNotes(filepath.Dir(spec), gs.PackageSpec.Version, gs.PackageSpec.ReleaseNotes); err != nil {
+			return gs, err
+		}
+	}
+	if errs := goolib.LintReleaseNotes(gs.PackageSpec); len(errs) > 0 {
+		var s []string
+		for _, err := range errs {
+			s = append(s, err.Error())
+		}
+		return gs, fmt.Errorf("release notes are not valid: %s", strings.Join(s, "; "))
+	}
+	return gs, nil
+}
+
+// workspace is a build-all manifest: the goospecs to build, as paths or glob
+// patterns relative to the manifest, and the template variables they share.
+type workspace struct {
+	Specs []string
+	Vars  map[string]string
+}
+
+// workspaceSpecs returns the goospecs of path, a directory holding them or a
+// workspace manifest, and the template variables of the manifest. All files
+// named *.goospec below a directory are built, bases meant only to be
+// extended need another name.
+func workspaceSpecs(path string) ([]string, map[string]string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fi.IsDir() {
+		var specs []string
+		err := filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.IsDir() && filepath.Ext(p) == ".goospec" {
+				specs = append(specs, p)
+			}
+			return nil
+		})
+		return specs, nil, err
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var ws workspace
+	if err := json.Unmarshal(b, &ws); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	var specs []string
+	seen := make(map[string]bool)
+	for _, p := range ws.Specs {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(filepath.Dir(path), p)
+		}
+		m, err := filepath.Glob(p)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if len(m) == 0 {
+			return nil, nil, fmt.Errorf("%s: %s matches no goospec", path, p)
+		}
+		for _, s := range m {
+			if !seen[s] {
+				seen[s] = true
+				specs = append(specs, s)
+			}
+		}
+	}
+	return specs, ws.Vars, nil
+}
+
+// buildResult is the outcome of building one goospec with build-all, as
+// listed in the build report.
+type buildResult struct {
+	Spec     string
+	Package  string  `json:",omitempty"`
+	Checksum string  `json:",omitempty"`
+	Size     int64   `json:",omitempty"`
+	Seconds  float64 `json:",omitempty"`
+	Error    string  `json:",omitempty"`
+}
+
+// buildReport is the combined report of a build-all.
+type buildReport struct {
+	Built, Failed int
+	Packages      []buildResult
+}
+
+// buildAll builds the packages of specs in dir, at most jobs at a time, with
+// the template variables vars, nil for none. The results are in the order of
+// specs. Goospecs building the same package fail without being built, as
+// their packages would overwrite each other.
+func buildAll(specs []string, dir string, vars map[string]string, jobs int) buildReport {
+	results := make([]buildResult, len(specs))
+	gss := make([]goolib.GooSpec, len(specs))
+	built := make(map[string]int)
+	for i, spec := range specs {
+		results[i].Spec = spec
+		gs, err := readSpec(spec, vars)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		gss[i] = gs
+		pn := goolib.PackageInfo{Name: gs.PackageSpec.Name, Arch: gs.PackageSpec.Arch, Ver: gs.PackageSpec.Version}.PkgName()
+		results[i].Package = pn
+		if j, ok := built[pn]; ok {
+			results[i].Error = fmt.Sprintf("package %s is also built from %s", pn, specs[j])
+			if results[j].Error == "" {
+				results[j].Error = fmt.Sprintf("package %s is also built from %s", pn, spec)
+			}
+			continue
+		}
+		built[pn] = i
+	}
+
+	if jobs < 1 {
+		jobs = 1
+	}
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i := range specs {
+		if results[i].Error != "" {
+			continue
+		}
+		wg.Add(1)
+		go func(r *buildResult, gs goolib.GooSpec) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			start := time.Now()
+			err := createPackage(gs, dir)
+			r.Seconds = time.Since(start).Seconds()
+			if err == nil {
+				r.Checksum, r.Size, err = packageChecksum(filepath.Join(dir, r.Package))
+			}
+			if err != nil {
+				r.Error = err.Error()
+			}
+		}(&results[i], gss[i])
+	}
+	wg.Wait()
+
+	rep := buildReport{Packages: results}
+	for _, r := range results {
+		if r.Error != "" {
+			rep.Failed++
+		} else {
+			rep.Built++
+		}
+	}
+	return rep
+}
+
+// packageChecksum returns the SHA256 checksum and size of the package pkg.
+func packageChecksum(pkg string) (string, int64, error) {
+	f, err := oswrap.Open(pkg)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	return goolib.Checksum(f), fi.Size(), nil
+}
+
+// runBuildAll builds the workspace path, prints a summary of the builds and
+// writes the report requested with -build_report. It fails if any build
+// failed.
+func runBuildAll(path, dir string) error {
+	specs, wv, err := workspaceSpecs(path)
+	if err != nil {
+		return err
+	}
+	if len(specs) == 0 {
+		return fmt.Errorf("no goospecs found in %s", path)
+	}
+	// Variables given with -var override those of the manifest.
+	var v map[string]string
+	if len(wv) > 0 || len(specVars) > 0 {
+		v = make(map[string]string)
+		for k, val := range wv {
+			v[k] = val
+		}
+		for k, val := range specVars {
+			v[k] = val
+		}
+	}
+
+	rep := buildAll(specs, dir, v, *jobs)
+	for _, r := range rep.Packages {
+		if r.Error != "" {
+			fmt.Printf("FAIL %s: %s\n", r.Spec, r.Error)
+			continue
+		}
+		fmt.Printf("ok   %s %s (%.1fs)\n", r.Spec, r.Package, r.Seconds)
+	}
+	fmt.Printf("%d built, %d failed\n", rep.Built, rep.Failed)
+
+	if *report != "" {
+		b, err := json.MarshalIndent(rep, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(*report, b, 0644); err != nil {
+			return err
+		}
+	}
+	if rep.Failed > 0 {
+		return fmt.Errorf("%d of %d packages failed to build", rep.Failed, len(rep.Packages))
+	}
+	return nil
 }
 
 func usage() {
-	fmt.Printf("Usage: %s <path/to/goospec>\n", filepath.Base(os.Args[0]))
+	fmt.Printf("Usage: %s [flags] <path/to/goospec>\n", filepath.Base(os.Args[0]))
+	fmt.Printf("       %s [flags] build-all <directory or workspace manifest>\n", filepath.Base(os.Args[0]))
 }
 
 func main() {
 	flag.Parse()
-	switch len(flag.Args()) {
-	case 0:
+	if *schema {
+		b, err := goolib.SpecSchema()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(b))
+		os.Exit(0)
+	}
+	if *links != linksFollow && *links != linksRecord {
+		fmt.Printf("Invalid -links %q, want %s or %s.\n", *links, linksFollow, linksRecord)
+		usage()
+		os.Exit(1)
+	}
+	want := 1
+	if flag.Arg(0) == "build-all" {
+		want = 2
+	}
+	switch {
+	case len(flag.Args()) < want:
 		fmt.Println("Not enough args.")
 		usage()
 		os.Exit(1)
-	case 1:
-	default:
+	case len(flag.Args()) > want:
 		fmt.Println("Too many args.")
 		usage()
 		os.Exit(1)
 	}
-	if flag.Arg(1) == "help" {
+	if flag.Arg(0) == "help" {
 		usage()
 		os.Exit(0)
 	}
@@ -387,11 +922,21 @@ func main() {
 			log.Fatal(err)
 		}
 	}
-	gs, err := goolib.ReadGooSpec(flag.Arg(0))
+	if flag.Arg(0) == "build-all" {
+		if err := runBuildAll(flag.Arg(1), dir); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var v map[string]string
+	if len(specVars) > 0 {
+		v = specVars
+	}
+	gs, err := readSpec(flag.Arg(0), v)
 	if err != nil {
 		log.Fatal(err)
 	}
-
 	if err := createPackage(gs, dir); err != nil {
 		log.Fatal(err)
 	}
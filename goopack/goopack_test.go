@@ -16,40 +16,21 @@ package main
 import (
 	"archive/tar"
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"os"
 	"path"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/googet/goolib"
 	"github.com/google/googet/oswrap"
 )
 
-func TestPathMatch(t *testing.T) {
-	tests := []struct {
-		pattern, path string
-		result        bool
-	}{
-		{"/path**.file", "/path/to.file", true},
-		{"/path[a-z]", "/pathb", false},
-		{"/path[a-z]", "/path[a-z]", true},
-		{"path/*/file", "path/to/file", true},
-		{"path/*/file", "path/to/the/file", false},
-		{"path/**/file", "path/to/the/file", true},
-		{"^$[a(-z])%{}}\\{{\\", "^$[a(-z])%{}}\\{{\\", true},
-	}
-
-	for _, test := range tests {
-		res, err := pathMatch(test.pattern, test.path)
-		if err != nil {
-			t.Fatalf("match %q %q: %v", test.pattern, test.path, err)
-		}
-		if res != test.result {
-			t.Fatalf("match %q %q: expected %v got %v", test.pattern, test.path, test.result, res)
-		}
-	}
-}
-
 func TestMergeWalks(t *testing.T) {
 	before := []pathWalk{
 		{[][]string{{"path", "to", "file"}}, -1},
@@ -124,7 +105,7 @@ func TestMapFiles(t *testing.T) {
 	if err != nil {
 		t.Fatalf("error getting file map: %v", err)
 	}
-	em := fileMap{"foo": []string{wf1}, "foo/globdir": []string{wf2}}
+	em := fileMap{filepath.Join("foo", "globme.file"): wf1, filepath.Join("foo", "globdir", "globmetoo.file"): wf2}
 	if !reflect.DeepEqual(fm, em) {
 		t.Errorf("did not get expected package map: got %v, want %v", fm, em)
 	}
@@ -142,12 +123,12 @@ func TestWriteFiles(t *testing.T) {
 		t.Errorf("error creating test package: %v", err)
 	}
 	f.Close()
-	fm := fileMap{"foo": []string{wf}}
 	ef := path.Join("foo", path.Base(wf))
+	fm := fileMap{ef: wf}
 
 	buf := new(bytes.Buffer)
 	tw := tar.NewWriter(buf)
-	if err := writeFiles(tw, fm); err != nil {
+	if _, err := writeFiles(tw, fm); err != nil {
 		t.Errorf("error writing files to zip: %v", err)
 	}
 	if err := tw.Close(); err != nil {
@@ -162,3 +143,326 @@ func TestWriteFiles(t *testing.T) {
 		t.Errorf("zip contains unexpected file: expect %q got %q", ef, f.Name())
 	}
 }
+
+func TestWalkDirLinks(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+	if err := oswrap.MkdirAll(filepath.Join(tempDir, "a", "b"), 0755); err != nil {
+		t.Fatalf("error creating test directory: %v", err)
+	}
+	f, err := oswrap.Create(filepath.Join(tempDir, "a", "b", "file"))
+	if err != nil {
+		t.Fatalf("error creating test file: %v", err)
+	}
+	f.Close()
+	if err := os.Symlink("a", filepath.Join(tempDir, "link")); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+
+	defer func() { *links = linksFollow }()
+	for _, tt := range []struct {
+		mode string
+		want []string
+	}{
+		{linksFollow, []string{"a/b/file", "link/b/file"}},
+		{linksRecord, []string{"a/b/file", "link"}},
+	} {
+		*links = tt.mode
+		wl, err := walkDir(tempDir)
+		if err != nil {
+			t.Errorf("-links=%s: walkDir: %v", tt.mode, err)
+			continue
+		}
+		var got []string
+		for _, p := range wl {
+			rel, err := filepath.Rel(tempDir, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, filepath.ToSlash(rel))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("-links=%s: walkDir() = %v, want %v", tt.mode, got, tt.want)
+		}
+	}
+
+	// A link back up the tree is a cycle when followed, but just a link
+	// when recorded.
+	if err := os.Symlink(filepath.Join("..", ".."), filepath.Join(tempDir, "a", "b", "up")); err != nil {
+		t.Fatalf("error creating test link: %v", err)
+	}
+	*links = linksFollow
+	if _, err := walkDir(tempDir); err == nil || !strings.Contains(err.Error(), "leads back to") {
+		t.Errorf("walkDir with a cycle returned %v, want a cycle error", err)
+	}
+	*links = linksRecord
+	if _, err := walkDir(tempDir); err != nil {
+		t.Errorf("-links=record: walkDir with a cycle: %v", err)
+	}
+}
+
+func TestWriteFilesLinks(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+	in := filepath.Join(tempDir, "in")
+	if err := os.Symlink("file", in); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+	out := filepath.Join(tempDir, "out")
+	if err := os.Symlink(filepath.Join("..", "..", "file"), out); err != nil {
+		t.Fatalf("error creating test link: %v", err)
+	}
+
+	defer func() { *links = linksFollow }()
+	*links = linksRecord
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	if _, err := writeFiles(tw, fileMap{"foo/in": in}); err != nil {
+		t.Fatalf("error writing files to zip: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("error closing zip writer: %v", err)
+	}
+	hdr, err := tar.NewReader(buf).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Name != "foo/in" || hdr.Typeflag != tar.TypeSymlink || hdr.Linkname != "file" {
+		t.Errorf("got entry %q of type %c to %q, want link foo/in to \"file\"", hdr.Name, hdr.Typeflag, hdr.Linkname)
+	}
+
+	if _, err := writeFiles(tar.NewWriter(new(bytes.Buffer)), fileMap{"foo/out": out}); err == nil {
+		t.Error("writeFiles of a link out of the package did not return an error")
+	}
+}
+
+func TestMapFilesRenames(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+	for _, n := range []string{"out/tool-linux", "out/readme.txt", "docs/a.md", "docs/sub/b.md"} {
+		p := filepath.Join(tempDir, filepath.FromSlash(n))
+		if err := oswrap.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("error creating test directory: %v", err)
+		}
+		if err := ioutil.WriteFile(p, nil, 0644); err != nil {
+			t.Fatalf("error creating test file: %v", err)
+		}
+	}
+	src := func(n string) string { return filepath.Join(tempDir, filepath.FromSlash(n)) }
+
+	ps := []goolib.PkgSources{
+		{
+			Include: []string{"out/*"},
+			Target:  "foo",
+			Root:    tempDir,
+			Map:     map[string]string{"out/tool-linux": "bin/tool", "docs": "share/doc"},
+		},
+	}
+	fm, err := mapFiles(ps)
+	if err != nil {
+		t.Fatalf("error getting file map: %v", err)
+	}
+	em := fileMap{
+		filepath.Join("foo", "bin", "tool"):                 src("out/tool-linux"),
+		filepath.Join("foo", "out", "readme.txt"):           src("out/readme.txt"),
+		filepath.Join("foo", "share", "doc", "a.md"):        src("docs/a.md"),
+		filepath.Join("foo", "share", "doc", "sub", "b.md"): src("docs/sub/b.md"),
+	}
+	if !reflect.DeepEqual(fm, em) {
+		t.Errorf("did not get expected package map: got %v, want %v", fm, em)
+	}
+
+	for _, m := range []map[string]string{
+		{"out/tool-linux": "../tool"},
+		{"out/tool-linux": "/bin/tool"},
+		{"missing": "tool"},
+		{"out/tool-linux": "out/readme.txt", "out/readme.txt": "out/readme.txt"},
+	} {
+		ps[0].Map = m
+		if _, err := mapFiles(ps); err == nil {
+			t.Errorf("mapFiles with map %v did not return an error", m)
+		}
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+	spec := filepath.Join(tempDir, "test.goospec")
+	if err := ioutil.WriteFile(spec, []byte("{}"), 0644); err != nil {
+		t.Fatalf("error writing goospec: %v", err)
+	}
+
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+	os.Setenv("SOURCE_DATE_EPOCH", "1500000000")
+	defer func() { *commit = "" }()
+	*commit = "abc123"
+
+	pv, err := provenance(spec)
+	if err != nil {
+		t.Fatalf("provenance: %v", err)
+	}
+	host, _ := os.Hostname()
+	want := goolib.Provenance{
+		Builder:      host,
+		Commit:       "abc123",
+		BuildTime:    time.Unix(1500000000, 0).UTC(),
+		Goopack:      version,
+		SpecChecksum: "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a",
+	}
+	if !reflect.DeepEqual(*pv, want) {
+		t.Errorf("provenance() = %+v, want %+v", *pv, want)
+	}
+
+	os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if _, err := provenance(spec); err == nil {
+		t.Error("provenance with an invalid SOURCE_DATE_EPOCH did not return an error")
+	}
+}
+
+func TestWritePublishFiles(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+	gs := goolib.GooSpec{PackageSpec: &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "1.2.3@4"}}
+	pkg := filepath.Join(tempDir, "foo.noarch.1.2.3@4.goo")
+	if err := ioutil.WriteFile(pkg, []byte("package"), 0644); err != nil {
+		t.Fatalf("error writing package: %v", err)
+	}
+
+	defer func() { *shaFile, *repoSpec = false, false }()
+	*shaFile, *repoSpec = true, true
+	if err := writePublishFiles(gs, tempDir); err != nil {
+		t.Fatalf("writePublishFiles: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(pkg + ".sha256")
+	if err != nil {
+		t.Fatalf("error reading checksum file: %v", err)
+	}
+	f, err := oswrap.Open(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want := goolib.Checksum(f)
+	if got := string(b); got != want+"  foo.noarch.1.2.3@4.goo\n" {
+		t.Errorf("checksum file = %q, want checksum %s", got, want)
+	}
+
+	b, err = ioutil.ReadFile(pkg + ".repospec")
+	if err != nil {
+		t.Fatalf("error reading repo spec: %v", err)
+	}
+	var rs goolib.RepoSpec
+	if err := json.Unmarshal(b, &rs); err != nil {
+		t.Fatalf("error decoding repo spec: %v", err)
+	}
+	if rs.Source != "packages/foo.noarch.1.2.3@4.goo" || rs.Checksum != want || rs.Size != 7 || rs.PackageSpec.Name != "foo" {
+		t.Errorf("repo spec = %+v, want source packages/foo.noarch.1.2.3@4.goo, checksum %s and size 7", rs, want)
+	}
+}
+
+func TestWorkspaceSpecs(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+	for _, f := range []string{"a/a.goospec", "b/b.goospec", "b/base.json", "c/c.goospec"} {
+		p := filepath.Join(tempDir, f)
+		if err := oswrap.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+		if err := ioutil.WriteFile(p, []byte("{}"), 0644); err != nil {
+			t.Fatalf("error writing %s: %v", f, err)
+		}
+	}
+	manifest := filepath.Join(tempDir, "workspace.json")
+	if err := ioutil.WriteFile(manifest, []byte(`{"specs": ["c/c.goospec", "*/*.goospec"], "vars": {"version": "1.0.0"}}`), 0644); err != nil {
+		t.Fatalf("error writing manifest: %v", err)
+	}
+
+	specs, vars, err := workspaceSpecs(tempDir)
+	if err != nil {
+		t.Fatalf("workspaceSpecs(dir): %v", err)
+	}
+	want := []string{filepath.Join(tempDir, "a/a.goospec"), filepath.Join(tempDir, "b/b.goospec"), filepath.Join(tempDir, "c/c.goospec")}
+	if !reflect.DeepEqual(specs, want) || vars != nil {
+		t.Errorf("workspaceSpecs(dir) = %v, %v, want %v, nil", specs, vars, want)
+	}
+
+	specs, vars, err = workspaceSpecs(manifest)
+	if err != nil {
+		t.Fatalf("workspaceSpecs(manifest): %v", err)
+	}
+	want = []string{want[2], want[0], want[1]}
+	if !reflect.DeepEqual(specs, want) || vars["version"] != "1.0.0" {
+		t.Errorf("workspaceSpecs(manifest) = %v, %v, want %v, version 1.0.0", specs, vars, want)
+	}
+
+	if err := ioutil.WriteFile(manifest, []byte(`{"specs": ["d/*.goospec"]}`), 0644); err != nil {
+		t.Fatalf("error writing manifest: %v", err)
+	}
+	if _, _, err := workspaceSpecs(manifest); err == nil {
+		t.Error("workspaceSpecs of a pattern matching nothing did not return an error")
+	}
+}
+
+func TestBuildAll(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+	src := filepath.Join(tempDir, "src")
+	out := filepath.Join(tempDir, "out")
+	for _, d := range []string{src, out} {
+		if err := oswrap.Mkdir(d, 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "file"), []byte("file"), 0644); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+	write := func(name, pkg string) string {
+		spec := fmt.Sprintf(`{"name": %q, "version": "{{.version}}", "arch": "noarch", "sources": [{"include": ["*"], "root": %q}]}`, pkg, src)
+		p := filepath.Join(tempDir, name)
+		if err := ioutil.WriteFile(p, []byte(spec), 0644); err != nil {
+			t.Fatalf("error writing %s: %v", name, err)
+		}
+		return p
+	}
+	specs := []string{write("a.goospec", "a"), write("b.goospec", "b"), write("c.goospec", "b")}
+
+	rep := buildAll(specs, out, map[string]string{"version": "1.0.0@1"}, 2)
+	if rep.Built != 1 || rep.Failed != 2 || len(rep.Packages) != 3 {
+		t.Fatalf("buildAll() = %+v, want 1 built and 2 failed", rep)
+	}
+	a := rep.Packages[0]
+	if a.Spec != specs[0] || a.Package != "a.noarch.1.0.0@1.goo" || a.Error != "" || a.Checksum == "" || a.Size == 0 {
+		t.Errorf("buildAll() result of a = %+v, want a.noarch.1.0.0@1.goo built", a)
+	}
+	if _, err := os.Stat(filepath.Join(out, a.Package)); err != nil {
+		t.Errorf("package of a was not written: %v", err)
+	}
+	for _, r := range rep.Packages[1:] {
+		if !strings.Contains(r.Error, "is also built from") {
+			t.Errorf("buildAll() result of %s = %+v, want a duplicate package error", r.Spec, r)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gooroot handles the state file, journal and lock GooGet keeps in
+// its root directory, for the googet command and programs embedding GooGet
+// alike.
+package gooroot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/googet/client"
+	"github.com/google/logger"
+)
+
+// The files in a GooGet root.
+const (
+	StateFile   = "googet.state"
+	JournalFile = "googet.journal"
+	LockFile    = "googet.lock"
+)
+
+const lockPoll = 1 * time.Second
+
+// ReadState reads the state file sf, a missing state file means no
+// packages are installed.
+func ReadState(sf string) (*client.GooGetState, error) {
+	b, err := ioutil.ReadFile(sf)
+	if os.IsNotExist(err) {
+		logger.Info("No state file found, assuming no packages installed.")
+		return &client.GooGetState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return client.UnmarshalState(b)
+}
+
+// WriteState writes s to the state file sf.
+func WriteState(s *client.GooGetState, sf string) error {
+	b, err := s.Marshal()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(sf, b, 0664)
+}
+
+// CommitState writes the state file sf and clears the journal j of the
+// transitions it now contains.
+func CommitState(s *client.GooGetState, sf string, j *client.Journal) error {
+	if err := WriteState(s, sf); err != nil {
+		return err
+	}
+	return j.Clear()
+}
+
+// LockInfo describes the owner of the GooGet lock or a process waiting for
+// it.
+type LockInfo struct {
+	PID     int
+	Command string
+	Start   time.Time
+}
+
+func (li *LockInfo) String() string {
+	return fmt.Sprintf("PID %d running %q since %s", li.PID, li.Command, li.Start.Format(time.RFC3339))
+}
+
+func writeLockInfo(f *os.File, li LockInfo) error {
+	b, err := json.Marshal(li)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	return err
+}
+
+// ReadLockInfo reads the LockInfo stored in a lock or queue file, lock files
+// written by older versions of GooGet are empty and return a nil LockInfo.
+func ReadLockInfo(p string) (*LockInfo, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil || len(b) == 0 {
+		return nil, err
+	}
+	var li LockInfo
+	return &li, json.Unmarshal(b, &li)
+}
+
+// LockQueue returns the queue entries waiting for the lock lf, oldest
+// first.
+func LockQueue(lf string) ([]string, error) {
+	return filepath.Glob(filepath.Join(lf+".queue", "*"))
+}
+
+// firstInQueue reports whether qf is the oldest live entry in the lock queue.
+func firstInQueue(lf, qf string) (bool, error) {
+	ql, err := LockQueue(lf)
+	if err != nil {
+		return false, err
+	}
+	for _, q := range ql {
+		if q == qf {
+			return true, nil
+		}
+		// Entries of live waiters are held open and can't be removed, any
+		// entry we can remove belonged to a process that is no longer waiting.
+		if err := os.Remove(q); err != nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Lock obtains the GooGet lock lf, waiting in turn behind any other process
+// already queued for it. A timeout of 0 waits indefinitely. The caller
+// releases the lock by closing and removing lf.
+func Lock(lf string, li LockInfo, timeout time.Duration) (*os.File, error) {
+	// This locking process only works on Windows, on linux os.Remove will remove an open file.
+	// This is not currently an issue as running googet on linux is only done for testing.
+	// In the future using a semaphore for locking would be nice.
+	qd := lf + ".queue"
+	if err := os.MkdirAll(qd, 0774); err != nil {
+		return nil, err
+	}
+	qf := filepath.Join(qd, fmt.Sprintf("%020d.%d", li.Start.UnixNano(), li.PID))
+	q, err := os.OpenFile(qf, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0664)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		q.Close()
+		os.Remove(qf)
+	}()
+	if err := writeLockInfo(q, li); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	for i := 0; ; i++ {
+		first, err := firstInQueue(lf, qf)
+		if err != nil {
+			return nil, err
+		}
+		if first {
+			// Try to remove any old lock file that may exist, ignore errors as we don't care if
+			// we can't remove it or it does not exist.
+			os.Remove(lf)
+			if lk, err := os.OpenFile(lf, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0664); err == nil {
+				if err := writeLockInfo(lk, li); err != nil {
+					logger.Errorf("Error writing lock info: %v", err)
+				}
+				return lk, nil
+			}
+		}
+		if timeout > 0 && time.Since(start) > timeout {
+			return nil, fmt.Errorf("timed out after %v waiting for lock", timeout)
+		}
+		if i == 0 {
+			msg := "GooGet lock already held, waiting..."
+			if owner, err := ReadLockInfo(lf); err == nil && owner != nil {
+				msg = fmt.Sprintf("GooGet lock held by %s, waiting...", owner)
+			}
+			fmt.Fprintln(os.Stderr, msg)
+		}
+		time.Sleep(lockPoll)
+	}
+}
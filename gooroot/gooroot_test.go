@@ -0,0 +1,121 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gooroot
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+	"github.com/google/logger"
+)
+
+func init() {
+	logger.Init("test", true, false, ioutil.Discard)
+}
+
+func TestLock(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+
+	lf := filepath.Join(tempDir, LockFile)
+	want := LockInfo{PID: 1234, Command: "install foo", Start: time.Unix(1, 0).UTC()}
+	lk, err := Lock(lf, want, time.Second)
+	if err != nil {
+		t.Fatalf("error running Lock: %v", err)
+	}
+	defer lk.Close()
+
+	got, err := ReadLockInfo(lf)
+	if err != nil {
+		t.Fatalf("error running ReadLockInfo: %v", err)
+	}
+	if got == nil || *got != want {
+		t.Errorf("did not get expected lock info, got: %+v, want: %+v", got, want)
+	}
+
+	ql, err := LockQueue(lf)
+	if err != nil {
+		t.Fatalf("error running LockQueue: %v", err)
+	}
+	if len(ql) != 0 {
+		t.Errorf("Lock did not remove its queue entry, queue: %v", ql)
+	}
+}
+
+func TestFirstInQueue(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+
+	lf := filepath.Join(tempDir, LockFile)
+	if err := oswrap.MkdirAll(lf+".queue", 0774); err != nil {
+		t.Fatal(err)
+	}
+	first := filepath.Join(lf+".queue", "01.1")
+	second := filepath.Join(lf+".queue", "02.2")
+	for _, q := range []string{first, second} {
+		if err := ioutil.WriteFile(q, nil, 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ok, err := firstInQueue(lf, first)
+	if err != nil {
+		t.Fatalf("error running firstInQueue: %v", err)
+	}
+	if !ok {
+		t.Error("firstInQueue returned false for the oldest entry")
+	}
+	if _, err := oswrap.Stat(second); err != nil {
+		t.Errorf("firstInQueue removed a newer entry: %v", err)
+	}
+}
+
+func TestWriteReadState(t *testing.T) {
+	want := &client.GooGetState{
+		client.PackageState{PackageSpec: &goolib.PkgSpec{Name: "test"}},
+	}
+
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+
+	sf := filepath.Join(tempDir, "test.state")
+
+	if err := WriteState(want, sf); err != nil {
+		t.Errorf("error running WriteState: %v", err)
+	}
+
+	got, err := ReadState(sf)
+	if err != nil {
+		t.Errorf("error running ReadState: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("did not get expected state, got: %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package identity handles the machine identity GooGet signs requests to
+// repos that require registration with. The identity is an Ed25519 key
+// pair, repos know machines by the ID of their public key.
+package identity
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/googet/oswrap"
+)
+
+// Headers of signed requests.
+const (
+	HeaderKeyID     = "X-GooGet-Key-ID"
+	HeaderPublicKey = "X-GooGet-Public-Key"
+	HeaderDate      = "X-GooGet-Date"
+	HeaderSignature = "X-GooGet-Signature"
+)
+
+// MaxSkew is how far the date of a signed request may be from the time it
+// is verified at.
+const MaxSkew = 5 * time.Minute
+
+const pemType = "PRIVATE KEY"
+
+// Identity is the key pair of a machine.
+type Identity struct {
+	key ed25519.PrivateKey
+}
+
+// New generates a new identity.
+func New() (*Identity, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{key: key}, nil
+}
+
+// Read reads the identity stored in p by Write.
+func Read(p string) (*Identity, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	blk, _ := pem.Decode(b)
+	if blk == nil || blk.Type != pemType {
+		return nil, fmt.Errorf("%s: no %s PEM block", p, pemType)
+	}
+	k, err := x509.ParsePKCS8PrivateKey(blk.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	key, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", p)
+	}
+	return &Identity{key: key}, nil
+}
+
+// Write stores id in p, readable by its owner only.
+func (id *Identity) Write(p string) error {
+	der, err := x509.MarshalPKCS8PrivateKey(id.key)
+	if err != nil {
+		return err
+	}
+	b := pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der})
+	if err := oswrap.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return ioutil.WriteFile(p, b, 0600)
+}
+
+// ReadOrCreate reads the identity stored in p, generating and storing a new
+// one if there is none.
+func ReadOrCreate(p string) (*Identity, error) {
+	id, err := Read(p)
+	if err == nil || !os.IsNotExist(err) {
+		return id, err
+	}
+	if id, err = New(); err != nil {
+		return nil, err
+	}
+	return id, id.Write(p)
+}
+
+// PublicKey returns the public key of id, base64 encoded.
+func (id *Identity) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(id.key.Public().(ed25519.PublicKey))
+}
+
+// ID returns the ID of id, the hex SHA256 checksum of its public key.
+func (id *Identity) ID() string {
+	return KeyID(id.key.Public().(ed25519.PublicKey))
+}
+
+// KeyID returns the ID of the public key pub.
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:])
+}
+
+// message returns what the signature of req dated date signs: its method,
+// host, path with query and date.
+func message(req *http.Request, date string) []byte {
+	// Requests received by servers only have Host set.
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	return []byte(strings.Join([]string{req.Method, host, req.URL.RequestURI(), date}, "\n"))
+}
+
+// Sign adds the headers identifying id and signing req at time t to req.
+func (id *Identity) Sign(req *http.Request, t time.Time) {
+	date := t.UTC().Format(time.RFC3339)
+	req.Header.Set(HeaderKeyID, id.ID())
+	req.Header.Set(HeaderPublicKey, id.PublicKey())
+	req.Header.Set(HeaderDate, date)
+	req.Header.Set(HeaderSignature, base64.StdEncoding.EncodeToString(ed25519.Sign(id.key, message(req, date))))
+}
+
+// Verify checks the signature of req, received at time t, and returns the
+// public key it was signed with. Repos look the key up by its ID to decide
+// whether the machine is registered.
+func Verify(req *http.Request, t time.Time) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(req.Header.Get(HeaderPublicKey))
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid public key")
+	}
+	pub := ed25519.PublicKey(b)
+	if req.Header.Get(HeaderKeyID) != KeyID(pub) {
+		return nil, errors.New("key ID does not match the public key")
+	}
+	date := req.Header.Get(HeaderDate)
+	d, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date: %v", err)
+	}
+	if skew := t.Sub(d); skew > MaxSkew || skew < -MaxSkew {
+		return nil, fmt.Errorf("request date %s is %v off", date, skew.Round(time.Second))
+	}
+	sig, err := base64.StdEncoding.DecodeString(req.Header.Get(HeaderSignature))
+	if err != nil || !ed25519.Verify(pub, message(req, date), sig) {
+		return nil, errors.New("invalid signature")
+	}
+	return pub, nil
+}
+
+// File is the identity stored in Path, read, or created, the first time a
+// request is signed with it. Machines that never talk to a repo requiring
+// registration never get an identity.
+type File struct {
+	Path string
+
+	once sync.Once
+	id   *Identity
+	err  error
+}
+
+// Sign signs req with the identity in f.
+func (f *File) Sign(req *http.Request) error {
+	f.once.Do(func() { f.id, f.err = ReadOrCreate(f.Path) })
+	if f.err != nil {
+		return fmt.Errorf("machine identity: %v", f.err)
+	}
+	f.id.Sign(req, time.Now())
+	return nil
+}
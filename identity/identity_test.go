@@ -0,0 +1,93 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/googet/oswrap"
+)
+
+func TestReadOrCreate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dir)
+
+	p := filepath.Join(dir, "googet.identity")
+	id, err := ReadOrCreate(p)
+	if err != nil {
+		t.Fatalf("ReadOrCreate: %v", err)
+	}
+	again, err := ReadOrCreate(p)
+	if err != nil {
+		t.Fatalf("ReadOrCreate: %v", err)
+	}
+	if again.ID() != id.ID() || again.PublicKey() != id.PublicKey() {
+		t.Errorf("ReadOrCreate of a stored identity returned %s, want %s", again.ID(), id.ID())
+	}
+	if err := ioutil.WriteFile(p, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadOrCreate(p); err == nil {
+		t.Error("ReadOrCreate of a corrupt identity returned no error")
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	id, err := New()
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	sign := func() *http.Request {
+		req, err := http.NewRequest(http.MethodGet, "https://repo.example.com/stable/index.gz?x=1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id.Sign(req, t0)
+		return req
+	}
+
+	pub, err := Verify(sign(), t0.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Verify of a signed request: %v", err)
+	}
+	if KeyID(pub) != id.ID() {
+		t.Errorf("Verify returned key %s, want %s", KeyID(pub), id.ID())
+	}
+
+	for _, tc := range []struct {
+		desc   string
+		change func(*http.Request)
+		at     time.Time
+	}{
+		{"other path", func(r *http.Request) { r.URL.Path = "/other/index.gz" }, t0},
+		{"other host", func(r *http.Request) { r.Host = "evil.example.com" }, t0},
+		{"stale", func(*http.Request) {}, t0.Add(time.Hour)},
+		{"other key ID", func(r *http.Request) { r.Header.Set(HeaderKeyID, "0") }, t0},
+		{"unsigned", func(r *http.Request) { r.Header.Del(HeaderSignature) }, t0},
+	} {
+		req := sign()
+		tc.change(req)
+		if _, err := Verify(req, tc.at); err == nil {
+			t.Errorf("%s: Verify returned no error", tc.desc)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+)
+
+const (
+	// manifestFile lists the chunks of a chunked index.
+	manifestFile = "index.manifest"
+	// chunkDir holds the chunks, below the index directory.
+	chunkDir = "chunks"
+)
+
+// Chunk splits rs, sorted by name as Scan returns it, into chunks holding
+// the versions of about n package names each. A chunk ends after a name
+// whose hash is a multiple of n, so adding, removing or changing a package
+// only changes the chunk it is in and the other chunks keep their checksums.
+func Chunk(rs []goolib.RepoSpec, n int) [][]goolib.RepoSpec {
+	if n < 1 {
+		n = 1
+	}
+	var chunks [][]goolib.RepoSpec
+	var cur []goolib.RepoSpec
+	for i, s := range rs {
+		cur = append(cur, s)
+		name := s.PackageSpec.Name
+		if i+1 < len(rs) && rs[i+1].PackageSpec.Name == name {
+			continue
+		}
+		h := fnv.New32a()
+		h.Write([]byte(name))
+		if h.Sum32()%uint32(n) == 0 {
+			chunks = append(chunks, cur)
+			cur = nil
+		}
+	}
+	if cur != nil {
+		chunks = append(chunks, cur)
+	}
+	return chunks
+}
+
+// WriteChunked writes rs to dir like Write and also as chunks of about n
+// package names each, listed in index.manifest. Chunks are named after
+// their checksum and written before the manifest, and chunks the manifest no
+// longer lists are removed after it, so a web server never serves a manifest
+// listing missing chunks.
+func WriteChunked(dir string, rs []goolib.RepoSpec, n int) error {
+	if err := Write(dir, rs); err != nil {
+		return err
+	}
+	cd := filepath.Join(dir, chunkDir)
+	if err := oswrap.MkdirAll(cd, 0755); err != nil {
+		return err
+	}
+	var m goolib.IndexManifest
+	keep := make(map[string]bool)
+	for _, c := range Chunk(rs, n) {
+		b, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		sum := goolib.Checksum(bytes.NewReader(b))
+		name := sum + ".gz"
+		keep[name] = true
+		m.Chunks = append(m.Chunks, goolib.IndexChunk{Path: path.Join(chunkDir, name), Checksum: sum, Packages: len(c)})
+		if _, err := oswrap.Stat(filepath.Join(cd, name)); err == nil {
+			continue
+		}
+		if err := writeFile(cd, name, b, true); err != nil {
+			return err
+		}
+	}
+	if m.Chunks == nil {
+		m.Chunks = []goolib.IndexChunk{}
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(dir, manifestFile, b, false); err != nil {
+		return err
+	}
+	fis, err := ioutil.ReadDir(cd)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		if keep[fi.Name()] {
+			continue
+		}
+		if err := oswrap.Remove(filepath.Join(cd, fi.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
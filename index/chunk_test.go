@@ -0,0 +1,144 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package index
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+)
+
+func specs(names ...string) []goolib.RepoSpec {
+	var rs []goolib.RepoSpec
+	for _, n := range names {
+		for _, v := range []string{"1.0.0@1", "2.0.0@1"} {
+			rs = append(rs, goolib.RepoSpec{Source: n + "." + v, PackageSpec: &goolib.PkgSpec{Name: n, Arch: "noarch", Version: v}})
+		}
+	}
+	return rs
+}
+
+func TestChunk(t *testing.T) {
+	var names []string
+	for i := 0; i < 200; i++ {
+		names = append(names, fmt.Sprintf("pkg%03d", i))
+	}
+	rs := specs(names...)
+	chunks := Chunk(rs, 10)
+	if len(chunks) < 5 || len(chunks) > 60 {
+		t.Errorf("Chunk split 200 names into %d chunks, want about 20", len(chunks))
+	}
+	var all []goolib.RepoSpec
+	for _, c := range chunks {
+		if len(c) == 0 {
+			t.Error("Chunk returned an empty chunk")
+		}
+		// Versions of a package are never split between chunks.
+		if c[0].PackageSpec.Version != "1.0.0@1" || c[len(c)-1].PackageSpec.Version != "2.0.0@1" {
+			t.Errorf("chunk %v splits the versions of a package", c)
+		}
+		all = append(all, c...)
+	}
+	if !reflect.DeepEqual(all, rs) {
+		t.Error("chunks do not add up to the index")
+	}
+
+	// Changing a package only changes its chunk.
+	changed := specs(names...)
+	changed[101].Checksum = "new"
+	var differ int
+	for i, c := range Chunk(changed, 10) {
+		if !reflect.DeepEqual(c, chunks[i]) {
+			differ++
+		}
+	}
+	if differ != 1 {
+		t.Errorf("changing one package changed %d chunks, want 1", differ)
+	}
+}
+
+func TestWriteChunked(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dir)
+
+	readManifest := func() goolib.IndexManifest {
+		b, err := ioutil.ReadFile(filepath.Join(dir, manifestFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m goolib.IndexManifest
+		if err := json.Unmarshal(b, &m); err != nil {
+			t.Fatalf("error unmarshalling manifest: %v", err)
+		}
+		return m
+	}
+
+	rs := specs("a", "b", "c", "d", "e", "f", "g", "h")
+	if err := WriteChunked(dir, rs, 2); err != nil {
+		t.Fatalf("error running WriteChunked: %v", err)
+	}
+	if _, err := oswrap.Stat(filepath.Join(dir, "index.gz")); err != nil {
+		t.Errorf("WriteChunked did not write the whole index: %v", err)
+	}
+	m := readManifest()
+	var all []goolib.RepoSpec
+	for _, c := range m.Chunks {
+		f, err := oswrap.Open(filepath.Join(dir, filepath.FromSlash(c.Path)))
+		if err != nil {
+			t.Fatalf("chunk listed in manifest: %v", err)
+		}
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(gr)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var cs []goolib.RepoSpec
+		if err := json.Unmarshal(b, &cs); err != nil {
+			t.Fatal(err)
+		}
+		if len(cs) != c.Packages || goolib.Checksum(bytes.NewReader(b)) != c.Checksum {
+			t.Errorf("chunk %s does not match its manifest entry %+v", c.Path, c)
+		}
+		all = append(all, cs...)
+	}
+	if !reflect.DeepEqual(all, rs) {
+		t.Error("chunks do not add up to the index")
+	}
+
+	if err := WriteChunked(dir, specs("a"), 2); err != nil {
+		t.Fatalf("error running WriteChunked: %v", err)
+	}
+	fis, err := ioutil.ReadDir(filepath.Join(dir, chunkDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(fis), len(readManifest().Chunks); got != want {
+		t.Errorf("chunk directory holds %d chunks after an update, want the %d listed", got, want)
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package index generates GooGet repository indexes from a directory of
+// packages.
+package index
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+	"github.com/google/logger"
+)
+
+// Scan reads every .goo package in dir and returns their RepoSpecs sorted by
+// name, arch and version. The Source of each spec is the package file name
+// joined to prefix. Packages that can't be read, or whose spec does not
+// match their file name, are logged and left out.
+func Scan(dir, prefix string) ([]goolib.RepoSpec, error) {
+	pkgs, err := filepath.Glob(filepath.Join(dir, "*.goo"))
+	if err != nil {
+		return nil, err
+	}
+
+	var rs []goolib.RepoSpec
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, pkg := range pkgs {
+		wg.Add(1)
+		go func(pkg string) {
+			defer wg.Done()
+			s, err := repoSpec(pkg, prefix)
+			if err != nil {
+				logger.Error(err)
+				return
+			}
+			mu.Lock()
+			rs = append(rs, s)
+			mu.Unlock()
+		}(pkg)
+	}
+	wg.Wait()
+
+	sort.Slice(rs, func(i, j int) bool {
+		a, b := rs[i].PackageSpec, rs[j].PackageSpec
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Arch != b.Arch {
+			return a.Arch < b.Arch
+		}
+		return a.Version < b.Version
+	})
+	return rs, nil
+}
+
+func repoSpec(pkgPath, prefix string) (goolib.RepoSpec, error) {
+	pkg := filepath.Base(pkgPath)
+	pi := goolib.PkgNameSplit(strings.TrimSuffix(pkg, ".goo"))
+
+	f, err := oswrap.Open(pkgPath)
+	if err != nil {
+		return goolib.RepoSpec{}, err
+	}
+	defer f.Close()
+
+	spec, err := goolib.ExtractPkgSpec(f)
+	if err != nil {
+		return goolib.RepoSpec{}, fmt.Errorf("%s: %v", pkgPath, err)
+	}
+	if spec.Name != pi.Name {
+		return goolib.RepoSpec{}, fmt.Errorf("%s: name in spec does not match package file name", pkgPath)
+	}
+	if spec.Arch != pi.Arch {
+		return goolib.RepoSpec{}, fmt.Errorf("%s: arch in spec does not match package file name", pkgPath)
+	}
+	if spec.Version != pi.Ver {
+		return goolib.RepoSpec{}, fmt.Errorf("%s: version in spec does not match package version", pkgPath)
+	}
+
+	if _, err := f.Seek(0, 0); err != nil {
+		return goolib.RepoSpec{}, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return goolib.RepoSpec{}, err
+	}
+	rs := goolib.RepoSpec{
+		Source:      path.Join(prefix, pkg),
+		Checksum:    goolib.Checksum(f),
+		Size:        fi.Size(),
+		PackageSpec: spec,
+	}
+	b, err := ioutil.ReadFile(pkgPath + yankSuffix)
+	if err == nil {
+		rs.Yanked = true
+		rs.YankReason = strings.TrimSpace(string(b))
+	} else if !os.IsNotExist(err) {
+		return goolib.RepoSpec{}, err
+	}
+	return rs, nil
+}
+
+// yankSuffix is appended to the file name of a package to name the file
+// marking it as yanked, the file contains the reason.
+const yankSuffix = ".yanked"
+
+// Yank marks the package pkg, given as name.arch.version, in dir as yanked
+// for reason. Yanked packages stay in the index, flagged as such.
+func Yank(dir, pkg, reason string) error {
+	p := filepath.Join(dir, strings.TrimSuffix(pkg, ".goo")+".goo")
+	if _, err := oswrap.Stat(p); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p+yankSuffix, []byte(reason), 0644)
+}
+
+// Unyank removes the yanked mark of the package pkg in dir.
+func Unyank(dir, pkg string) error {
+	err := oswrap.Remove(filepath.Join(dir, strings.TrimSuffix(pkg, ".goo")+".goo"+yankSuffix))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Write writes rs to dir as a plain JSON index file and a gzipped index.gz.
+// Each file is written under a temporary name and renamed into place, so a
+// web server never serves a partial index.
+func Write(dir string, rs []goolib.RepoSpec) error {
+	if rs == nil {
+		rs = []goolib.RepoSpec{}
+	}
+	b, err := json.MarshalIndent(rs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := oswrap.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := writeFile(dir, "index", b, false); err != nil {
+		return err
+	}
+	return writeFile(dir, "index.gz", b, true)
+}
+
+func writeFile(dir, name string, b []byte, gz bool) (err error) {
+	f, err := ioutil.TempFile(dir, "."+name+"-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			oswrap.Remove(f.Name())
+		}
+	}()
+	if gz {
+		gw := gzip.NewWriter(f)
+		if _, err := gw.Write(b); err != nil {
+			return err
+		}
+		if err := gw.Close(); err != nil {
+			return err
+		}
+	} else if _, err := f.Write(b); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return oswrap.Rename(f.Name(), filepath.Join(dir, name))
+}
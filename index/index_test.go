@@ -0,0 +1,142 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package index
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+	"github.com/google/googet/testutil"
+	"github.com/google/logger"
+)
+
+func init() {
+	logger.Init("test", true, false, ioutil.Discard)
+}
+
+func writePkg(t *testing.T, dir, file string, spec *goolib.PkgSpec) string {
+	p := filepath.Join(dir, file)
+	testutil.WriteGoo(t, p, spec, nil)
+	return p
+}
+
+func TestScanWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dir)
+
+	foo := &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "1.0.0@1"}
+	bar := &goolib.PkgSpec{Name: "bar", Arch: "x86_64", Version: "2.0.0@1"}
+	fooPath := writePkg(t, dir, "foo.noarch.1.0.0@1.goo", foo)
+	writePkg(t, dir, "bar.x86_64.2.0.0@1.goo", bar)
+	// The spec does not match the file name, so this package is skipped.
+	writePkg(t, dir, "baz.noarch.1.0.0@1.goo", foo)
+
+	rs, err := Scan(dir, "packages")
+	if err != nil {
+		t.Fatalf("error running Scan: %v", err)
+	}
+	if len(rs) != 2 {
+		t.Fatalf("Scan returned %d packages, want 2: %v", len(rs), rs)
+	}
+	if !reflect.DeepEqual(rs[0].PackageSpec, bar) || !reflect.DeepEqual(rs[1].PackageSpec, foo) {
+		t.Errorf("Scan returned unexpected specs: %v, %v", rs[0].PackageSpec, rs[1].PackageSpec)
+	}
+	if rs[1].Source != "packages/foo.noarch.1.0.0@1.goo" {
+		t.Errorf("unexpected Source %q", rs[1].Source)
+	}
+	f, err := oswrap.Open(fooPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if want := goolib.Checksum(f); rs[1].Checksum != want {
+		t.Errorf("unexpected Checksum %q, want %q", rs[1].Checksum, want)
+	}
+
+	out := filepath.Join(dir, "repo")
+	if err := Write(out, rs); err != nil {
+		t.Fatalf("error running Write: %v", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(out, "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []goolib.RepoSpec
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("error unmarshalling index: %v", err)
+	}
+	if !reflect.DeepEqual(got, rs) {
+		t.Errorf("index does not match scanned packages: %v", got)
+	}
+
+	gf, err := oswrap.Open(filepath.Join(out, "index.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gf.Close()
+	gr, err := gzip.NewReader(gf)
+	if err != nil {
+		t.Fatalf("error reading index.gz: %v", err)
+	}
+	gb, err := ioutil.ReadAll(gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(gb) != string(b) {
+		t.Error("index.gz does not match index")
+	}
+}
+
+func TestYank(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dir)
+
+	writePkg(t, dir, "foo.noarch.1.0.0@1.goo", &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "1.0.0@1"})
+	if err := Yank(dir, "foo.noarch.1.0.0@1", "broken"); err != nil {
+		t.Fatalf("error running Yank: %v", err)
+	}
+	if err := Yank(dir, "foo.noarch.2.0.0@1", "broken"); err == nil {
+		t.Error("Yank of a package not in the repo returned no error")
+	}
+	rs, err := Scan(dir, "packages")
+	if err != nil {
+		t.Fatalf("error running Scan: %v", err)
+	}
+	if len(rs) != 1 || !rs[0].Yanked || rs[0].YankReason != "broken" {
+		t.Fatalf("Scan did not return the package as yanked: %+v", rs)
+	}
+
+	if err := Unyank(dir, "foo.noarch.1.0.0@1.goo"); err != nil {
+		t.Fatalf("error running Unyank: %v", err)
+	}
+	rs, err = Scan(dir, "packages")
+	if err != nil {
+		t.Fatalf("error running Scan: %v", err)
+	}
+	if len(rs) != 1 || rs[0].Yanked {
+		t.Errorf("Scan returned the package as yanked after Unyank: %+v", rs)
+	}
+}
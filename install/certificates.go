@@ -0,0 +1,70 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"strings"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/system"
+	"github.com/google/logger"
+)
+
+// sameCertificate reports whether a and b are the same certificate in the
+// same store.
+func sameCertificate(a, b client.Certificate) bool {
+	return strings.EqualFold(a.Store, b.Store) && strings.EqualFold(a.Thumbprint, b.Thumbprint)
+}
+
+// keepCertificates returns the certificates to record for the new version of
+// a package, those its install added. Certificates the old version added are
+// found in their store by the new install, they stay recorded as added
+// rather than kept so they are still removed with the package.
+func keepCertificates(old *client.PackageState, certs []client.Certificate) []client.Certificate {
+	if old == nil {
+		return certs
+	}
+	for i, c := range certs {
+		if !c.Kept {
+			continue
+		}
+		for _, oc := range old.Certificates {
+			if !oc.Kept && sameCertificate(c, oc) {
+				certs[i].Kept = false
+			}
+		}
+	}
+	return certs
+}
+
+// removeStaleCertificates removes the certificates the old version of a
+// package added that the new version ns no longer records.
+func removeStaleCertificates(old, ns client.PackageState) {
+	var stale []client.Certificate
+	for _, oc := range old.Certificates {
+		if oc.Kept {
+			continue
+		}
+		found := false
+		for _, c := range ns.Certificates {
+			found = found || sameCertificate(c, oc)
+		}
+		if !found {
+			stale = append(stale, oc)
+		}
+	}
+	if err := system.RemoveCertificates(stale); err != nil {
+		logger.Error(err)
+	}
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/googet/client"
+)
+
+func TestKeepCertificates(t *testing.T) {
+	old := &client.PackageState{Certificates: []client.Certificate{
+		{Store: "Root", Thumbprint: "AA"},
+		{Store: "CA", Thumbprint: "BB", Kept: true},
+	}}
+	certs := []client.Certificate{
+		{Store: "root", Thumbprint: "aa", Kept: true},
+		{Store: "CA", Thumbprint: "BB", Kept: true},
+		{Store: "My", Thumbprint: "CC"},
+	}
+	want := []client.Certificate{
+		{Store: "root", Thumbprint: "aa"},
+		{Store: "CA", Thumbprint: "BB", Kept: true},
+		{Store: "My", Thumbprint: "CC"},
+	}
+	if got := keepCertificates(old, certs); !reflect.DeepEqual(got, want) {
+		t.Errorf("keepCertificates = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+)
+
+// UnsatisfiedDep is a dependency that cannot be satisfied. Chain lists the
+// packages, as name.arch.version, from the package being installed to the
+// one that requires the dependency.
+type UnsatisfiedDep struct {
+	Chain      []string
+	Dependency string
+	MinVersion string
+	Reason     string
+}
+
+func (u UnsatisfiedDep) String() string {
+	return fmt.Sprintf("%s requires %s %s or greater: %s", strings.Join(u.Chain, " -> "), u.Dependency, u.MinVersion, u.Reason)
+}
+
+// DepError is returned when the dependencies of a package cannot be
+// resolved, it lists every unsatisfiable dependency found.
+type DepError struct {
+	Unsatisfied []UnsatisfiedDep
+}
+
+func (e *DepError) Error() string {
+	s := []string{"cannot resolve dependencies:"}
+	for _, u := range e.Unsatisfied {
+		s = append(s, "  "+u.String())
+	}
+	return strings.Join(s, "\n")
+}
+
+// checkDeps walks the dependency tree of ps and returns the dependencies
+// that are neither installed in state, which may be nil, nor available at a
+// sufficient version in idx. chain is the path to ps.
+func checkDeps(ps *goolib.PkgSpec, idx client.Index, archs []string, state client.GooGetState, chain []*goolib.PkgSpec) []UnsatisfiedDep {
+	chain = append(chain[:len(chain):len(chain)], ps)
+	var names []string
+	for _, c := range chain {
+		names = append(names, fmt.Sprintf("%s.%s.%s", c.Name, c.Arch, c.Version))
+	}
+
+	var deps []string
+	for d := range ps.PkgDependencies {
+		deps = append(deps, d)
+	}
+	sort.Strings(deps)
+
+	var us []UnsatisfiedDep
+	for _, d := range deps {
+		ver := ps.PkgDependencies[d]
+		pi := goolib.PkgNameSplit(d)
+		unsat := func(reason string, a ...interface{}) {
+			us = append(us, UnsatisfiedDep{Chain: names, Dependency: d, MinVersion: ver, Reason: fmt.Sprintf(reason, a...)})
+		}
+		if state != nil {
+			mi, err := minInstalled(goolib.PackageInfo{Name: pi.Name, Arch: pi.Arch, Ver: ver}, state)
+			if err != nil {
+				unsat("%v", err)
+				continue
+			}
+			if mi {
+				continue
+			}
+		}
+		if inChain(chain, pi.Name) {
+			continue
+		}
+		if pi.Arch != "" && !goolib.ContainsString(pi.Arch, archs) {
+			unsat("arch %s is not installable on this machine", pi.Arch)
+			continue
+		}
+		e, err := idx.Latest(goolib.PackageInfo{Name: pi.Name, Arch: pi.Arch}, archs)
+		if err != nil {
+			unsat("not installed and %v", err)
+			continue
+		}
+		v := e.Spec.PackageSpec.Version
+		c, err := goolib.Compare(v, ver)
+		if err != nil {
+			unsat("%v", err)
+			continue
+		}
+		if c == -1 {
+			unsat("not installed and only version %s is available", v)
+			continue
+		}
+		us = append(us, checkDeps(e.Spec.PackageSpec, idx, archs, state, chain)...)
+	}
+	return us
+}
+
+// inChain reports whether name is already being resolved further up the
+// chain, which means the dependency graph has a cycle.
+func inChain(chain []*goolib.PkgSpec, name string) bool {
+	for _, c := range chain {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
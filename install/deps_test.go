@@ -0,0 +1,84 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+)
+
+func TestCheckDeps(t *testing.T) {
+	rm := client.RepoMap{
+		"repo": []goolib.RepoSpec{
+			{PackageSpec: &goolib.PkgSpec{Name: "b_pkg", Arch: "noarch", Version: "1.0.0@1", PkgDependencies: map[string]string{"c_pkg": "2.0.0@1", "d_pkg": "1.0.0@1"}}},
+			{PackageSpec: &goolib.PkgSpec{Name: "c_pkg", Arch: "noarch", Version: "1.0.0@1"}},
+			{PackageSpec: &goolib.PkgSpec{Name: "e_pkg", Arch: "noarch", Version: "1.0.0@1", PkgDependencies: map[string]string{"a_pkg": "1.0.0@1"}}},
+		},
+	}
+	a := &goolib.PkgSpec{Name: "a_pkg", Arch: "noarch", Version: "1.0.0@1", PkgDependencies: map[string]string{
+		"b_pkg":        "1.0.0@1",
+		"e_pkg":        "1.0.0@1",
+		"f_pkg":        "1.0.0@1",
+		"g_pkg.x86_32": "1.0.0@1",
+	}}
+	state := client.GooGetState{
+		{PackageSpec: &goolib.PkgSpec{Name: "f_pkg", Arch: "noarch", Version: "1.5.0@1"}},
+	}
+
+	got := checkDeps(a, client.NewIndex(rm), []string{"noarch", "x86_64"}, state, nil)
+	want := []UnsatisfiedDep{
+		{
+			Chain:      []string{"a_pkg.noarch.1.0.0@1", "b_pkg.noarch.1.0.0@1"},
+			Dependency: "c_pkg",
+			MinVersion: "2.0.0@1",
+			Reason:     "not installed and only version 1.0.0@1 is available",
+		},
+		{
+			Chain:      []string{"a_pkg.noarch.1.0.0@1", "b_pkg.noarch.1.0.0@1"},
+			Dependency: "d_pkg",
+			MinVersion: "1.0.0@1",
+			Reason:     "not installed and no versions of package d_pkg found in any repo",
+		},
+		{
+			Chain:      []string{"a_pkg.noarch.1.0.0@1"},
+			Dependency: "g_pkg.x86_32",
+			MinVersion: "1.0.0@1",
+			Reason:     "arch x86_32 is not installable on this machine",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("checkDeps returned unexpected result:\ngot:  %+v\nwant: %+v", got, want)
+	}
+
+	err := &DepError{Unsatisfied: got}
+	if !strings.Contains(err.Error(), "a_pkg.noarch.1.0.0@1 -> b_pkg.noarch.1.0.0@1 requires c_pkg 2.0.0@1 or greater") {
+		t.Errorf("DepError text does not include dependency chain: %s", err)
+	}
+	b, jerr := json.Marshal(err)
+	if jerr != nil {
+		t.Fatalf("error marshalling DepError: %v", jerr)
+	}
+	var rt DepError
+	if jerr := json.Unmarshal(b, &rt); jerr != nil {
+		t.Fatalf("error unmarshalling DepError: %v", jerr)
+	}
+	if !reflect.DeepEqual(rt.Unsatisfied, got) {
+		t.Errorf("DepError did not round trip through JSON, got %+v", rt.Unsatisfied)
+	}
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/system"
+	"github.com/google/logger"
+)
+
+// notIn returns the entries of a that are not in b.
+func notIn(a, b []string) []string {
+	var r []string
+	for _, s := range a {
+		if !goolib.ContainsString(s, b) {
+			r = append(r, s)
+		}
+	}
+	return r
+}
+
+// staleExclusions returns the Defender exclusions the old version of a
+// package applied that the new version ns no longer has, nil if there are
+// none.
+func staleExclusions(old, ns client.PackageState) *goolib.Exclusions {
+	if old.Exclusions == nil {
+		return nil
+	}
+	cur := goolib.Exclusions{}
+	if ns.Exclusions != nil {
+		cur = *ns.Exclusions
+	}
+	stale := &goolib.Exclusions{Paths: notIn(old.Exclusions.Paths, cur.Paths), Processes: notIn(old.Exclusions.Processes, cur.Processes)}
+	if len(stale.Paths) == 0 && len(stale.Processes) == 0 {
+		return nil
+	}
+	return stale
+}
+
+// removeStaleExclusions removes the Defender exclusions the old version of a
+// package applied that the new version ns no longer has.
+func removeStaleExclusions(old, ns client.PackageState) {
+	if err := system.RemoveExclusions(staleExclusions(old, ns)); err != nil {
+		logger.Error(err)
+	}
+}
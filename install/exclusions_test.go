@@ -0,0 +1,42 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+)
+
+func TestStaleExclusions(t *testing.T) {
+	old := client.PackageState{Exclusions: &goolib.Exclusions{Paths: []string{`C:\a`, `C:\b`}, Processes: []string{"a.exe"}}}
+	for _, tt := range []struct {
+		desc string
+		ns   *goolib.Exclusions
+		want *goolib.Exclusions
+	}{
+		{"dropped", &goolib.Exclusions{Paths: []string{`C:\a`}}, &goolib.Exclusions{Paths: []string{`C:\b`}, Processes: []string{"a.exe"}}},
+		{"none left", nil, old.Exclusions},
+		{"unchanged", old.Exclusions, nil},
+	} {
+		if got := staleExclusions(old, client.PackageState{Exclusions: tt.ns}); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: staleExclusions = %+v, want %+v", tt.desc, got, tt.want)
+		}
+	}
+	if got := staleExclusions(client.PackageState{}, old); got != nil {
+		t.Errorf("staleExclusions without old exclusions = %+v, want nil", got)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/system"
+	"github.com/google/logger"
+)
+
+// keepFeatures returns the Windows features to record as enabled by the new
+// version ps of a package: those its install enabled, added, and those the
+// old version, if any, enabled that ps still requests.
+func keepFeatures(old *client.PackageState, ps *goolib.PkgSpec, added *goolib.WindowsFeatures) *goolib.WindowsFeatures {
+	var kept goolib.WindowsFeatures
+	if added != nil {
+		kept = *added
+	}
+	if old != nil && old.Enabled != nil && ps.WindowsFeatures != nil {
+		for _, f := range old.Enabled.Features {
+			if goolib.ContainsString(f, ps.WindowsFeatures.Features) && !goolib.ContainsString(f, kept.Features) {
+				kept.Features = append(kept.Features, f)
+			}
+		}
+		for _, c := range old.Enabled.Capabilities {
+			if goolib.ContainsString(c, ps.WindowsFeatures.Capabilities) && !goolib.ContainsString(c, kept.Capabilities) {
+				kept.Capabilities = append(kept.Capabilities, c)
+			}
+		}
+	}
+	if kept.Empty() {
+		return nil
+	}
+	return &kept
+}
+
+// disableStale disables the Windows features the old version of a package
+// enabled that the new version ns no longer records.
+func disableStale(old, ns client.PackageState) {
+	if old.Enabled.Empty() {
+		return
+	}
+	var stale goolib.WindowsFeatures
+	var kept goolib.WindowsFeatures
+	if ns.Enabled != nil {
+		kept = *ns.Enabled
+	}
+	for _, f := range old.Enabled.Features {
+		if !goolib.ContainsString(f, kept.Features) {
+			stale.Features = append(stale.Features, f)
+		}
+	}
+	for _, c := range old.Enabled.Capabilities {
+		if !goolib.ContainsString(c, kept.Capabilities) {
+			stale.Capabilities = append(stale.Capabilities, c)
+		}
+	}
+	if _, err := system.DisableFeatures(&stale); err != nil {
+		logger.Error(err)
+	}
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+)
+
+func TestKeepFeatures(t *testing.T) {
+	old := &client.PackageState{Enabled: &goolib.WindowsFeatures{
+		Features:     []string{"NetFx3", "IIS-WebServer"},
+		Capabilities: []string{"OpenSSH.Server~~~~0.0.1.0"},
+	}}
+	ps := &goolib.PkgSpec{WindowsFeatures: &goolib.WindowsFeatures{
+		Features:     []string{"NetFx3", "TelnetClient"},
+		Capabilities: []string{"OpenSSH.Server~~~~0.0.1.0"},
+	}}
+	for _, tt := range []struct {
+		desc  string
+		old   *client.PackageState
+		ps    *goolib.PkgSpec
+		added *goolib.WindowsFeatures
+		want  *goolib.WindowsFeatures
+	}{
+		{"fresh install", nil, ps, &goolib.WindowsFeatures{Features: []string{"TelnetClient"}}, &goolib.WindowsFeatures{Features: []string{"TelnetClient"}}},
+		{"nothing enabled", nil, ps, nil, nil},
+		{"upgrade", old, ps, &goolib.WindowsFeatures{Features: []string{"TelnetClient"}}, &goolib.WindowsFeatures{
+			Features:     []string{"TelnetClient", "NetFx3"},
+			Capabilities: []string{"OpenSSH.Server~~~~0.0.1.0"},
+		}},
+		{"upgrade dropping features", old, &goolib.PkgSpec{}, nil, nil},
+	} {
+		if got := keepFeatures(tt.old, tt.ps, tt.added); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: keepFeatures = %+v, want %+v", tt.desc, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+	"github.com/google/googet/system"
+	"github.com/google/logger"
+)
+
+// fileCopy is a source in an unpacked package and where it is installed.
+type fileCopy struct {
+	src, dst string
+	// base is set for files matched by a glob source to the destination of
+	// the source, the directories from base down to dst are created.
+	base string
+}
+
+// fileCopies resolves a Files or ConfigFiles map against the package
+// unpacked in dir. Plain sources are copied as a whole. Sources containing
+// '*' are glob patterns, as in goopack, matched against the files in the
+// package; each match is installed at the destination joined with its path
+// below the pattern's first glob. Sources starting with '!' are patterns
+// that exclude files from the glob sources.
+func fileCopies(dir string, files map[string]string, root string, userScope bool) ([]fileCopy, error) {
+	var srcs, excludes []string
+	for src := range files {
+		if strings.HasPrefix(src, "!") {
+			excludes = append(excludes, src[1:])
+			continue
+		}
+		srcs = append(srcs, src)
+	}
+	sort.Strings(srcs)
+
+	var cs []fileCopy
+	for _, src := range srcs {
+		dst, err := resolveDst(files[src], root, userScope)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.Contains(src, "*") {
+			cs = append(cs, fileCopy{src: filepath.Join(dir, src), dst: dst})
+			continue
+		}
+		ms, err := globPackage(dir, src, excludes)
+		if err != nil {
+			return nil, err
+		}
+		if len(ms) == 0 {
+			return nil, fmt.Errorf("file source %q matches no files in the package", src)
+		}
+		prefix := globPrefix(src)
+		for _, m := range ms {
+			cs = append(cs, fileCopy{
+				src:  filepath.Join(dir, filepath.FromSlash(m)),
+				dst:  filepath.Join(dst, filepath.FromSlash(strings.TrimPrefix(m, prefix))),
+				base: dst,
+			})
+		}
+	}
+	return cs, nil
+}
+
+// globPrefix returns the directories of pattern before its first glob, with
+// a trailing slash if there are any.
+func globPrefix(pattern string) string {
+	i := strings.Index(pattern, "*")
+	return pattern[:strings.LastIndex(pattern[:i], "/")+1]
+}
+
+// globPackage returns the slash separated paths of the files in the package
+// unpacked in dir that match pattern and none of excludes, sorted.
+func globPackage(dir, pattern string, excludes []string) ([]string, error) {
+	start := filepath.Join(dir, filepath.FromSlash(globPrefix(pattern)))
+	var ms []string
+	err := oswrap.Walk(start, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == start {
+				return nil
+			}
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		m, err := goolib.PathMatch(pattern, rel)
+		if err != nil || !m {
+			return err
+		}
+		for _, ex := range excludes {
+			m, err := goolib.PathMatch(ex, rel)
+			if err != nil || m {
+				return err
+			}
+		}
+		ms = append(ms, rel)
+		return nil
+	})
+	sort.Strings(ms)
+	return ms, err
+}
+
+var hardLink bool
+
+// SetHardLink sets whether package files are hardlinked to their unpacked
+// copy instead of copied. Files are copied when linking fails, for example
+// because the destination is on another volume. Configuration files are
+// always copied.
+func SetHardLink(link bool) {
+	hardLink = link
+}
+
+// installFiles installs the files of a Files or ConfigFiles map from the
+// package unpacked in dir, recording them in insFiles and the directories
+// they are in in dirs, and applies perms to them. old are the files of the
+// version being upgraded from.
+func installFiles(dir string, files map[string]string, perms map[string]goolib.Permission, root string, userScope bool, old, insFiles map[string]string, dirs map[string]bool, dbOnly, keep bool) error {
+	cs, err := fileCopies(dir, files, root, userScope)
+	if err != nil {
+		return err
+	}
+	for _, c := range cs {
+		if c.base != "" {
+			if err := makeDirs(c.base, filepath.Dir(c.dst), dirs, dbOnly); err != nil {
+				return err
+			}
+		}
+		if err := oswrap.Walk(c.src, makeInstallFunction(c.src, c.dst, old, insFiles, dirs, dbOnly, keep)); err != nil {
+			return err
+		}
+		if dbOnly || len(perms) == 0 {
+			continue
+		}
+		if err := applyPermissions(dir, c, perms); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyPermissions applies the perms whose pattern matches the path in the
+// package unpacked in dir of each file and directory installed by c.
+func applyPermissions(dir string, c fileCopy, perms map[string]goolib.Permission) error {
+	var patterns []string
+	for p := range perms {
+		patterns = append(patterns, p)
+	}
+	sort.Strings(patterns)
+	return oswrap.Walk(c.src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		outPath := filepath.Join(c.dst, strings.TrimPrefix(path, c.src))
+		for _, p := range patterns {
+			m, err := goolib.PathMatch(p, filepath.ToSlash(rel))
+			if err != nil {
+				return err
+			}
+			if !m {
+				continue
+			}
+			logger.Infof("Setting permissions of %q", outPath)
+			if err := system.SetPermission(outPath, perms[p]); err != nil {
+				return fmt.Errorf("setting permissions of %q: %v", outPath, err)
+			}
+		}
+		return nil
+	})
+}
+
+// makeDirs creates dir, which is base or below it, recording base and the
+// directories below it down to dir in dirs.
+func makeDirs(base, dir string, dirs map[string]bool, dbOnly bool) error {
+	if !dbOnly {
+		if err := mkdirAll(dir, 0755, dirs); err != nil {
+			return err
+		}
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		useDir(dirs, d)
+		if d == base || filepath.Dir(d) == d {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+)
+
+func makePackageDir(t *testing.T, files []string) string {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	for _, f := range files {
+		p := filepath.Join(dir, filepath.FromSlash(f))
+		if err := oswrap.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+		if err := ioutil.WriteFile(p, []byte(f), 0644); err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+	}
+	return dir
+}
+
+func TestFileCopies(t *testing.T) {
+	dir := makePackageDir(t, []string{"bin/tool.exe", "bin/tool.pdb", "bin/sub/lib.dll", "bin/sub/lib.pdb", "doc/readme.txt", "top.txt"})
+	defer oswrap.RemoveAll(dir)
+
+	files := map[string]string{
+		"bin/**":   "/opt/tool",
+		"!**.pdb":  "",
+		"doc":      "/usr/share/doc/tool",
+		"*.txt":    "/etc/tool",
+		"none/*.x": "/nowhere",
+	}
+	if _, err := fileCopies(dir, files, "", false); err == nil {
+		t.Error("fileCopies with a glob that matches nothing returned no error")
+	}
+	delete(files, "none/*.x")
+
+	got, err := fileCopies(dir, files, "", false)
+	if err != nil {
+		t.Fatalf("fileCopies: %v", err)
+	}
+	want := []fileCopy{
+		{src: filepath.Join(dir, "top.txt"), dst: filepath.Join("/etc/tool", "top.txt"), base: "/etc/tool"},
+		{src: filepath.Join(dir, "bin", "sub", "lib.dll"), dst: filepath.Join("/opt/tool", "sub", "lib.dll"), base: "/opt/tool"},
+		{src: filepath.Join(dir, "bin", "tool.exe"), dst: filepath.Join("/opt/tool", "tool.exe"), base: "/opt/tool"},
+		{src: filepath.Join(dir, "doc"), dst: "/usr/share/doc/tool"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fileCopies() = %+v, want %+v", got, want)
+	}
+}
+
+func TestInstallFilesGlob(t *testing.T) {
+	dir := makePackageDir(t, []string{"bin/tool.exe", "bin/tool.pdb", "bin/sub/lib.dll"})
+	defer oswrap.RemoveAll(dir)
+	dst, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dst)
+	base := filepath.Join(dst, "tool")
+
+	insFiles := make(map[string]string)
+	dirs := make(map[string]bool)
+	if err := installFiles(dir, map[string]string{"bin/**": base, "!**.pdb": ""}, nil, "", false, nil, insFiles, dirs, false, false); err != nil {
+		t.Fatalf("installFiles: %v", err)
+	}
+	for _, d := range []string{base, filepath.Join(base, "sub")} {
+		if !dirs[d] {
+			t.Errorf("directory %s not recorded as created in %v", d, dirs)
+		}
+	}
+	if _, ok := dirs[dst]; ok {
+		t.Errorf("existing directory %s recorded in %v", dst, dirs)
+	}
+	for _, f := range []string{"tool.exe", filepath.Join("sub", "lib.dll")} {
+		p := filepath.Join(base, f)
+		if _, err := oswrap.Stat(p); err != nil {
+			t.Errorf("expected file %s does not exist", p)
+		}
+		if insFiles[p] == "" {
+			t.Errorf("file %s not recorded in installed files %v", p, insFiles)
+		}
+	}
+	if _, err := oswrap.Stat(filepath.Join(base, "tool.pdb")); err == nil {
+		t.Error("excluded file tool.pdb was installed")
+	}
+}
+
+func TestInstallFilesPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("modes are not applied on Windows")
+	}
+	dir := makePackageDir(t, []string{"bin/tool", "bin/tool.conf", "doc/readme"})
+	defer oswrap.RemoveAll(dir)
+	dst, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dst)
+
+	perms := map[string]goolib.Permission{
+		"bin/*":         {Mode: "0755"},
+		"bin/tool.conf": {Mode: "0600"},
+		"bin":           {Mode: "0750"},
+	}
+	files := map[string]string{"bin": filepath.Join(dst, "bin"), "doc/readme": filepath.Join(dst, "readme")}
+	if err := installFiles(dir, files, perms, "", false, nil, make(map[string]string), make(map[string]bool), false, false); err != nil {
+		t.Fatalf("installFiles: %v", err)
+	}
+	for p, want := range map[string]os.FileMode{
+		filepath.Join(dst, "bin"):              0750,
+		filepath.Join(dst, "bin", "tool"):      0755,
+		filepath.Join(dst, "bin", "tool.conf"): 0600,
+	} {
+		fi, err := oswrap.Stat(p)
+		if err != nil {
+			t.Errorf("Stat(%s): %v", p, err)
+			continue
+		}
+		if got := fi.Mode().Perm(); got != want {
+			t.Errorf("mode of %s = %v, want %v", p, got, want)
+		}
+	}
+}
@@ -19,14 +19,18 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
-	"sort"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/google/googet/client"
 	"github.com/google/googet/download"
 	"github.com/google/googet/goolib"
+	"github.com/google/googet/msg"
 	"github.com/google/googet/oswrap"
 	"github.com/google/googet/system"
 	"github.com/google/logger"
@@ -46,8 +50,11 @@ func minInstalled(pi goolib.PackageInfo, state client.GooGetState) (bool, error)
 	return false, nil
 }
 
-func installDeps(ps *goolib.PkgSpec, cache string, rm client.RepoMap, archs []string, state *client.GooGetState, dbOnly bool, proxyServer string) error {
+func installDeps(ps *goolib.PkgSpec, cache string, rm client.RepoMap, archs []string, state *client.GooGetState, j *client.Journal, dbOnly, userScope bool, proxyServer string, rp msg.Reporter) error {
 	logger.Infof("Resolving dependencies for %s %s version %s", ps.Arch, ps.Name, ps.Version)
+	if us := checkDeps(ps, client.NewIndex(rm), archs, *state, nil); len(us) > 0 {
+		return &DepError{Unsatisfied: us}
+	}
 	for p, ver := range ps.PkgDependencies {
 		pi := goolib.PkgNameSplit(p)
 		mi, err := minInstalled(goolib.PackageInfo{pi.Name, pi.Arch, ver}, *state)
@@ -58,6 +65,9 @@ func installDeps(ps *goolib.PkgSpec, cache string, rm client.RepoMap, archs []st
 			logger.Infof("Dependency met: %s.%s with version greater than %s installed", pi.Name, pi.Arch, ver)
 			continue
 		}
+		if pi.Arch != "" && !goolib.ContainsString(pi.Arch, archs) {
+			return fmt.Errorf("cannot resolve dependancy, %s.%s requires arch %s which is not installable on this machine", pi.Name, pi.Arch, pi.Arch)
+		}
 		var ins bool
 		v, repo, arch, err := client.FindRepoLatest(goolib.PackageInfo{pi.Name, pi.Arch, ""}, rm, archs)
 		if err != nil {
@@ -69,8 +79,11 @@ func installDeps(ps *goolib.PkgSpec, cache string, rm client.RepoMap, archs []st
 		}
 		if c > -1 {
 			logger.Infof("Dependency found: %s.%s %s is available", pi.Name, arch, v)
-			if err := FromRepo(goolib.PackageInfo{pi.Name, arch, v}, repo, cache, rm, archs, state, dbOnly, proxyServer); err != nil {
-				return err
+			if err := FromRepo(goolib.PackageInfo{pi.Name, arch, v}, repo, cache, rm, archs, state, j, dbOnly, userScope, proxyServer, rp); err != nil {
+				if _, ok := err.(*DepError); ok {
+					return err
+				}
+				return fmt.Errorf("error installing %s.%s.%s, a dependency of %s.%s.%s: %v", pi.Name, arch, v, ps.Name, ps.Arch, ps.Version, err)
 			}
 			ins = true
 		}
@@ -82,16 +95,18 @@ func installDeps(ps *goolib.PkgSpec, cache string, rm client.RepoMap, archs []st
 }
 
 // Latest installs the latest version of a package.
-func Latest(pi goolib.PackageInfo, cache string, rm client.RepoMap, archs []string, state *client.GooGetState, dbOnly bool, proxyServer string) error {
+func Latest(pi goolib.PackageInfo, cache string, rm client.RepoMap, archs []string, state *client.GooGetState, j *client.Journal, dbOnly, userScope bool, proxyServer string, rp msg.Reporter) error {
 	ver, repo, arch, err := client.FindRepoLatest(pi, rm, archs)
 	if err != nil {
 		return err
 	}
-	return FromRepo(goolib.PackageInfo{pi.Name, arch, ver}, repo, cache, rm, archs, state, dbOnly, proxyServer)
+	return FromRepo(goolib.PackageInfo{pi.Name, arch, ver}, repo, cache, rm, archs, state, j, dbOnly, userScope, proxyServer, rp)
 }
 
-// FromRepo installs a package and all dependencies from a repository.
-func FromRepo(pi goolib.PackageInfo, repo, cache string, rm client.RepoMap, archs []string, state *client.GooGetState, dbOnly bool, proxyServer string) error {
+// FromRepo installs a package and all dependencies from a repository,
+// reporting progress to rp. Each state transition is recorded in the journal j before it is made.
+// userScope must match the install scope of the package and its dependencies.
+func FromRepo(pi goolib.PackageInfo, repo, cache string, rm client.RepoMap, archs []string, state *client.GooGetState, j *client.Journal, dbOnly, userScope bool, proxyServer string, rp msg.Reporter) error {
 	ni, err := NeedsInstallation(pi, *state)
 	if err != nil {
 		return err
@@ -99,18 +114,75 @@ func FromRepo(pi goolib.PackageInfo, repo, cache string, rm client.RepoMap, arch
 	if !ni {
 		return nil
 	}
+	return fromRepo(pi, repo, cache, rm, archs, state, j, dbOnly, userScope, proxyServer, rp, nil)
+}
+
+// Replacing installs a package from a repository like FromRepo, calling
+// before once the package is downloaded, unpacked and its installer
+// checked, right before it is installed. Packages it replaces are removed by
+// before, so they are kept if the package can't be fetched. Nothing is
+// installed if before fails.
+func Replacing(pi goolib.PackageInfo, repo, cache string, rm client.RepoMap, archs []string, state *client.GooGetState, j *client.Journal, dbOnly, userScope bool, proxyServer string, rp msg.Reporter, before func() error) error {
+	ni, err := NeedsInstallation(pi, *state)
+	if err != nil {
+		return err
+	}
+	if !ni {
+		return before()
+	}
+	return fromRepo(pi, repo, cache, rm, archs, state, j, dbOnly, userScope, proxyServer, rp, before)
+}
 
+// ToVersion installs version pi.Ver of a package from repo like FromRepo,
+// but replaces the installed version even if it is newer, so updates can roll
+// packages back to the version a repo of higher priority pins.
+func ToVersion(pi goolib.PackageInfo, repo, cache string, rm client.RepoMap, archs []string, state *client.GooGetState, j *client.Journal, dbOnly, userScope bool, proxyServer string, rp msg.Reporter) error {
+	if ps, err := state.GetPackageState(goolib.PackageInfo{Name: pi.Name, Arch: pi.Arch}); err == nil {
+		c, err := goolib.Compare(ps.PackageSpec.Version, pi.Ver)
+		if err != nil {
+			return err
+		}
+		if c == 0 {
+			logger.Infof("%s.%s %s is already installed.\n", pi.Name, pi.Arch, pi.Ver)
+			return nil
+		}
+	}
+	return fromRepo(pi, repo, cache, rm, archs, state, j, dbOnly, userScope, proxyServer, rp, nil)
+}
+
+// fromRepo installs pi from repo, calling before, if it is not nil, just
+// before the package is installed.
+func fromRepo(pi goolib.PackageInfo, repo, cache string, rm client.RepoMap, archs []string, state *client.GooGetState, j *client.Journal, dbOnly, userScope bool, proxyServer string, rp msg.Reporter, before func() error) error {
 	logger.Infof("Starting install of %s.%s.%s", pi.Name, pi.Arch, pi.Ver)
-	fmt.Printf("Installing %s.%s.%s and dependencies...\n", pi.Name, pi.Arch, pi.Ver)
+	rp.Info(msg.InstallStart, pi.Name, pi.Arch, pi.Ver)
 	rs, err := client.FindRepoSpec(pi, rm[repo])
 	if err != nil {
 		return err
 	}
-	if err := installDeps(rs.PackageSpec, cache, rm, archs, state, dbOnly, proxyServer); err != nil {
+	if rs.Yanked {
+		return fmt.Errorf("%s.%s.%s has been yanked from %s: %s", pi.Name, pi.Arch, pi.Ver, repo, rs.YankReason)
+	}
+	if err := checkScope(rs.PackageSpec, userScope); err != nil {
+		return err
+	}
+	if err := checkCoinstall(rs.PackageSpec, *state); err != nil {
+		return err
+	}
+	if err := checkRequirements(rs.PackageSpec, dbOnly); err != nil {
+		return err
+	}
+	if err := installDeps(rs.PackageSpec, cache, rm, archs, state, j, dbOnly, userScope, proxyServer, rp); err != nil {
+		return err
+	}
+	pc, err := packageCache(pi.Name, cache)
+	if err != nil {
+		return err
+	}
+	if err := checkSpace(cacheSpace(pc, rs.Size, rs.PackageSpec)); err != nil {
 		return err
 	}
 
-	dst, err := download.FromRepo(rs, repo, cache, proxyServer)
+	dst, err := download.FromRepo(rs, repo, pc, proxyServer, rp)
 	if err != nil {
 		return err
 	}
@@ -119,40 +191,229 @@ func FromRepo(pi goolib.PackageInfo, repo, cache string, rm client.RepoMap, arch
 	if err != nil {
 		return err
 	}
+	if before != nil {
+		if !dbOnly {
+			if _, err := system.CheckInstaller(dir, rs.PackageSpec, ""); err != nil {
+				return err
+			}
+		}
+		if err := before(); err != nil {
+			return err
+		}
+	}
 
-	insFiles, err := installPkg(dir, rs.PackageSpec, dbOnly)
-	if err != nil {
+	ns := client.PackageState{
+		SourceRepo:  repo,
+		DownloadURL: strings.TrimSuffix(repo, filepath.Base(repo)) + rs.Source,
+		Checksum:    rs.Checksum,
+		UnpackDir:   dir,
+		InstallRoot: installRoot(pi.Name),
+		PackageSpec: rs.PackageSpec,
+	}
+	if err := commitInstall(ns, state, j, dbOnly, rp); err != nil {
 		return err
 	}
 
 	logger.Infof("Installation of %s.%s.%s completed", pi.Name, pi.Arch, pi.Ver)
-	fmt.Printf("Installation of %s.%s.%s and all dependencies completed\n", pi.Name, pi.Arch, pi.Ver)
-	// Clean up old version, if applicable.
-	pi = goolib.PackageInfo{pi.Name, pi.Arch, ""}
-	if st, err := state.GetPackageState(pi); err == nil {
-		if !dbOnly {
-			cleanOldFiles(dir, st, insFiles)
+	rp.Info(msg.InstallDone, pi.Name, pi.Arch, pi.Ver)
+	return nil
+}
+
+// checkRequirements returns an error if the machine does not meet the
+// requirements of ps. Changes to the database only install nothing, so they
+// are not checked.
+func checkRequirements(ps *goolib.PkgSpec, dbOnly bool) error {
+	if dbOnly {
+		return nil
+	}
+	return system.CheckRequirements(ps, installRoot(ps.Name))
+}
+
+// checkScope returns an error if the install scope of ps does not match the
+// scope googet is running in.
+func checkScope(ps *goolib.PkgSpec, userScope bool) error {
+	switch {
+	case ps.UserScope() && !userScope:
+		return fmt.Errorf("%s.%s.%s can only be installed for the current user, use the '-user' flag", ps.Name, ps.Arch, ps.Version)
+	case !ps.UserScope() && userScope:
+		return fmt.Errorf("%s.%s.%s does not support installing for the current user", ps.Name, ps.Arch, ps.Version)
+	}
+	return nil
+}
+
+// checkCoinstall returns an error if a different arch of ps is installed and
+// either it or ps is not coinstallable.
+func checkCoinstall(ps *goolib.PkgSpec, state client.GooGetState) error {
+	for _, p := range state {
+		is := p.PackageSpec
+		if is.Name != ps.Name || is.Arch == ps.Arch {
+			continue
 		}
-		if err := oswrap.RemoveAll(st.UnpackDir); err != nil {
-			logger.Error(err)
+		if !is.Coinstallable || !ps.Coinstallable {
+			return fmt.Errorf("%s.%s is installed and %s cannot be installed for more than one arch, remove it before installing %s.%s", is.Name, is.Arch, ps.Name, ps.Name, ps.Arch)
 		}
+	}
+	return nil
+}
+
+// commitInstall installs the package unpacked in ns.UnpackDir and replaces
+// any installed version of it in state with ns, cleaning up the files of the
+// old version. Each step is recorded in the journal beforehand so that an
+// interrupted install can be finished by Recover.
+func commitInstall(ns client.PackageState, state *client.GooGetState, j *client.Journal, dbOnly bool, rp msg.Reporter) error {
+	if !dbOnly {
+		ns.ScriptContext = system.ScriptContext(ns.PackageSpec.Name)
+		if pr := ns.PackageSpec.PostReboot; pr != nil && pr.Path != "" {
+			ns.PostReboot = &client.Deferred{Since: time.Now()}
+		}
+	}
+	e := client.JournalEntry{Stage: client.StagePrepared, DBOnly: dbOnly, New: ns}
+	if st, err := state.GetPackageState(goolib.PackageInfo{ns.PackageSpec.Name, ns.PackageSpec.Arch, ""}); err == nil {
+		e.Old = &st
+	}
+	if err := j.Record(e); err != nil {
+		return fmt.Errorf("error writing journal: %v", err)
+	}
+
+	var prev string
+	var old map[string]string
+	if e.Old != nil {
+		prev = e.Old.PackageSpec.Version
+		old = e.Old.InstalledFiles
+	}
+	ins, err := installPkg(ns.UnpackDir, ns.PackageSpec, ns.InstallRoot, prev, old, dbOnly, rp)
+	if err != nil {
+		return err
+	}
+	e.New.InstalledFiles = ins.files
+	e.New.ConfigFiles = ins.config
+	e.New.Dirs = ins.dirs
+	e.New.Signature = ins.signature
+	e.New.Script = ins.script
+	if ins.script != nil {
+		// Only updates that are present are verified.
+		e.New.KB = ins.script.KB
+	}
+	e.New.Enabled = keepFeatures(e.Old, ns.PackageSpec, ins.enabled)
+	e.New.Certificates = keepCertificates(e.Old, ins.certs)
+	e.New.Exclusions = ins.exclusions
+	e.Stage = client.StageFilesCommitted
+	if err := j.Record(e); err != nil {
+		return fmt.Errorf("error writing journal: %v", err)
+	}
+	return finishInstall(e, state, j)
+}
+
+// finishInstall removes the old version recorded in e and replaces it in
+// state with the new version. The files of the old version of a db_only
+// install are left in place, only its cache directory is removed.
+func finishInstall(e client.JournalEntry, state *client.GooGetState, j *client.Journal) error {
+	if e.Old != nil && e.Stage == client.StageFilesCommitted {
+		if e.DBOnly {
+			handOverDirs(*e.Old, &e.New)
+		} else {
+			cleanOldFiles(*e.Old, &e.New, *state)
+			disableStale(*e.Old, e.New)
+			removeStaleCertificates(*e.Old, e.New)
+			removeStaleExclusions(*e.Old, e.New)
+		}
+		if e.Old.UnpackDir != e.New.UnpackDir {
+			if err := oswrap.RemoveAll(e.Old.UnpackDir); err != nil {
+				logger.Error(err)
+			}
+		}
+		e.Stage = client.StageOldRemoved
+		if err := j.Record(e); err != nil {
+			return fmt.Errorf("error writing journal: %v", err)
+		}
+	}
+	pi := goolib.PackageInfo{e.New.PackageSpec.Name, e.New.PackageSpec.Arch, ""}
+	if _, err := state.GetPackageState(pi); err == nil {
 		if err := state.Remove(pi); err != nil {
 			return err
 		}
 	}
-	state.Add(client.PackageState{
-		SourceRepo:     repo,
-		DownloadURL:    strings.TrimSuffix(repo, filepath.Base(repo)) + rs.Source,
-		Checksum:       rs.Checksum,
-		UnpackDir:      dir,
-		PackageSpec:    rs.PackageSpec,
-		InstalledFiles: insFiles,
-	})
+	state.Add(e.New)
+	return nil
+}
+
+// Recover finishes the state transitions recorded in the journal by installs
+// that were interrupted after their files were installed. Installs that were
+// interrupted before that are left at their old version in state and logged.
+// The caller should write state and then clear the journal.
+func Recover(j *client.Journal, state *client.GooGetState) error {
+	el, err := j.Entries()
+	if err != nil {
+		return err
+	}
+	for _, e := range el {
+		ps := e.New.PackageSpec
+		if e.Stage == client.StagePrepared {
+			logger.Errorf("Install of %s.%s.%s was interrupted before completing, it may need to be reinstalled", ps.Name, ps.Arch, ps.Version)
+			continue
+		}
+		logger.Infof("Finishing interrupted install of %s.%s.%s", ps.Name, ps.Arch, ps.Version)
+		if err := finishInstall(e, state, nil); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// FromURL downloads the .goo file at pkgURL, checks it against the SHA256
+// checksum chksum and installs it. The URL is recorded in the state so the
+// package can be redownloaded for a reinstall.
+// The state transition is recorded in the journal j before it is made.
+func FromURL(pkgURL, chksum, cache string, state *client.GooGetState, j *client.Journal, dbOnly, userScope, ri bool, proxyServer string, rp msg.Reporter) error {
+	if chksum == "" {
+		return fmt.Errorf("a checksum is required to install %s", pkgURL)
+	}
+	u, err := url.Parse(pkgURL)
+	if err != nil {
+		return err
+	}
+	if err := oswrap.MkdirAll(cache, 0774); err != nil {
+		return err
+	}
+	// The package is copied into the cache under its own name once its
+	// spec is read.
+	dst := filepath.Join(cache, path.Base(u.Path)+".download")
+	if err := download.Package(pkgURL, dst, chksum, 0, proxyServer, rp); err != nil {
+		return fmt.Errorf("error downloading %s: %v", pkgURL, err)
+	}
+	defer oswrap.Remove(dst)
+	return fromFile(dst, cache, state, j, dbOnly, userScope, ri, true, client.PackageState{DownloadURL: pkgURL, Checksum: chksum}, rp)
+}
+
+// FromReader installs a .goo package streamed from r, such as stdin, which
+// must have the SHA256 checksum chksum. The stream is written to the cache
+// once and moved into place.
+// The state transition is recorded in the journal j before it is made.
+func FromReader(r io.Reader, chksum, cache string, state *client.GooGetState, j *client.Journal, dbOnly, userScope, ri bool, rp msg.Reporter) error {
+	if chksum == "" {
+		return fmt.Errorf("a checksum is required to install a package from a stream")
+	}
+	if err := oswrap.MkdirAll(cache, 0774); err != nil {
+		return err
+	}
+	dst := filepath.Join(cache, "stream.goo.download")
+	defer oswrap.Remove(dst)
+	if err := download.Stream(r, dst, chksum); err != nil {
+		return fmt.Errorf("error reading package stream: %v", err)
+	}
+	return fromFile(dst, cache, state, j, dbOnly, userScope, ri, true, client.PackageState{Checksum: chksum}, rp)
+}
+
 // FromDisk installs a local .goo file.
-func FromDisk(arg, cache string, state *client.GooGetState, dbOnly, ri bool) error {
+// The state transition is recorded in the journal j before it is made.
+func FromDisk(arg, cache string, state *client.GooGetState, j *client.Journal, dbOnly, userScope, ri bool, rp msg.Reporter) error {
+	return fromFile(arg, cache, state, j, dbOnly, userScope, ri, false, client.PackageState{}, rp)
+}
+
+// fromFile installs the .goo file arg, recording where it came from as in
+// src. If tmp is set arg is a temporary file that is moved into the package
+// cache rather than copied.
+func fromFile(arg, cache string, state *client.GooGetState, j *client.Journal, dbOnly, userScope, ri, tmp bool, src client.PackageState, rp msg.Reporter) error {
 	if _, err := oswrap.Stat(arg); err != nil {
 		return err
 	}
@@ -161,6 +422,15 @@ func FromDisk(arg, cache string, state *client.GooGetState, dbOnly, ri bool) err
 	if err != nil {
 		return fmt.Errorf("error extracting spec file: %v", err)
 	}
+	if err := checkScope(zs, userScope); err != nil {
+		return err
+	}
+	if err := checkCoinstall(zs, *state); err != nil {
+		return err
+	}
+	if err := checkRequirements(zs, dbOnly); err != nil {
+		return err
+	}
 
 	if !ri {
 		ni, err := NeedsInstallation(goolib.PackageInfo{zs.Name, zs.Arch, zs.Version}, *state)
@@ -168,13 +438,13 @@ func FromDisk(arg, cache string, state *client.GooGetState, dbOnly, ri bool) err
 			return err
 		}
 		if !ni {
-			fmt.Printf("%s.%s.%s or a newer version is already installed on the system\n", zs.Name, zs.Arch, zs.Version)
+			rp.Info(msg.AlreadyInstalled, zs.Name, zs.Arch, zs.Version)
 			return nil
 		}
 	}
 
 	logger.Infof("Starting install of %q, version %q from %q", zs.Name, zs.Version, arg)
-	fmt.Printf("Installing %s %s...\n", zs.Name, zs.Version)
+	rp.Info(msg.InstallFileStart, zs.Name, zs.Version)
 
 	for p, ver := range zs.PkgDependencies {
 		pi := goolib.PkgNameSplit(p)
@@ -189,56 +459,51 @@ func FromDisk(arg, cache string, state *client.GooGetState, dbOnly, ri bool) err
 		return fmt.Errorf("Package dependency %s %s (min version %s) not installed.\n", pi.Name, pi.Arch, ver)
 	}
 
-	dst := filepath.Join(cache, goolib.PackageInfo{zs.Name, zs.Arch, zs.Version}.PkgName())
-	if err := copyPkg(arg, dst); err != nil {
+	fi, err := oswrap.Stat(arg)
+	if err != nil {
 		return err
 	}
-
-	dir, err := extractPkg(dst)
+	pc, err := packageCache(zs.Name, cache)
 	if err != nil {
 		return err
 	}
+	if err := checkSpace(cacheSpace(pc, fi.Size(), zs)); err != nil {
+		return err
+	}
+	dst := filepath.Join(pc, goolib.PackageInfo{zs.Name, zs.Arch, zs.Version}.PkgName())
+	if err := movePkg(arg, dst, tmp); err != nil {
+		return err
+	}
 
-	insFiles, err := installPkg(dir, zs, dbOnly)
+	dir, err := extractPkg(dst)
 	if err != nil {
 		return err
 	}
 
 	if ri {
+		if _, err := installPkg(dir, zs, installRoot(zs.Name), "", nil, dbOnly, rp); err != nil {
+			return err
+		}
 		logger.Infof("Reinstallation of %q, version %q completed", zs.Name, zs.Version)
-		fmt.Printf("Reinstallation of %s completed\n", zs.Name)
+		rp.Info(msg.ReinstallFileDone, zs.Name)
 		return nil
 	}
 
-	logger.Infof("Installation of %q, version %q completed", zs.Name, zs.Version)
-	fmt.Printf("Installation of %s completed\n", zs.Name)
-
-	// Clean up old version, if applicable.
-	pi := goolib.PackageInfo{zs.Name, zs.Arch, ""}
-	if st, err := state.GetPackageState(pi); err == nil {
-		if !dbOnly {
-			cleanOldFiles(dir, st, insFiles)
-		}
-		if err := oswrap.RemoveAll(st.UnpackDir); err != nil {
-			logger.Error(err)
-		}
-		if err := state.Remove(pi); err != nil {
-			return err
-		}
+	src.UnpackDir, src.InstallRoot, src.PackageSpec = dir, installRoot(zs.Name), zs
+	if err := commitInstall(src, state, j, dbOnly, rp); err != nil {
+		return err
 	}
-	state.Add(client.PackageState{
-		UnpackDir:      dir,
-		PackageSpec:    zs,
-		InstalledFiles: insFiles,
-	})
+
+	logger.Infof("Installation of %q, version %q completed", zs.Name, zs.Version)
+	rp.Info(msg.InstallFileDone, zs.Name)
 	return nil
 }
 
 // Reinstall reinstalls and optionally redownloads, a package.
-func Reinstall(ps client.PackageState, state client.GooGetState, rd bool, proxyServer string) error {
+func Reinstall(ps client.PackageState, state client.GooGetState, rd bool, proxyServer string, rp msg.Reporter) error {
 	pi := goolib.PackageInfo{ps.PackageSpec.Name, ps.PackageSpec.Arch, ps.PackageSpec.Version}
 	logger.Infof("Starting reinstall of %s.%s, version %s", pi.Name, pi.Arch, pi.Ver)
-	fmt.Printf("Reinstalling %s.%s %s and dependencies...\n", pi.Name, pi.Arch, pi.Ver)
+	rp.Info(msg.ReinstallStart, pi.Name, pi.Arch, pi.Ver)
 	_, err := oswrap.Stat(ps.UnpackDir)
 	if err != nil && !os.IsNotExist(err) {
 		return err
@@ -253,7 +518,7 @@ func Reinstall(ps client.PackageState, state client.GooGetState, rd bool, proxyS
 			return fmt.Errorf("can not redownload %s.%s.%s, DownloadURL not saved", pi.Name, pi.Arch, pi.Ver)
 		}
 		dst := ps.UnpackDir + ".goo"
-		if err := download.Package(ps.DownloadURL, dst, ps.Checksum, proxyServer); err != nil {
+		if err := download.PackageOf(ps.PackageSpec, ps.DownloadURL, dst, ps.Checksum, 0, proxyServer, rp); err != nil {
 			return fmt.Errorf("error redownloading package: %v", err)
 		}
 		dir, err = extractPkg(dst)
@@ -261,15 +526,26 @@ func Reinstall(ps client.PackageState, state client.GooGetState, rd bool, proxyS
 			return err
 		}
 	}
-	if _, err := installPkg(dir, ps.PackageSpec, false); err != nil {
+	if _, err := installPkg(dir, ps.PackageSpec, ps.InstallRoot, "", nil, false, rp); err != nil {
 		return fmt.Errorf("error reinstalling package: %v", err)
 	}
 
 	logger.Infof("Reinstallation of %s.%s, version %s completed", pi.Name, pi.Arch, pi.Ver)
-	fmt.Printf("Reinstallation of %s.%s %s completed\n", pi.Name, pi.Arch, pi.Ver)
+	rp.Info(msg.ReinstallDone, pi.Name, pi.Arch, pi.Ver)
 	return nil
 }
 
+// movePkg moves src to dst if move is set, falling back to copying it when
+// they are on different volumes, and copies it otherwise.
+func movePkg(src, dst string, move bool) error {
+	if move {
+		if err := oswrap.Rename(src, dst); err == nil {
+			return nil
+		}
+	}
+	return copyPkg(src, dst)
+}
+
 func copyPkg(src, dst string) (retErr error) {
 	r, err := oswrap.Open(src)
 	if err != nil {
@@ -338,40 +614,82 @@ func extractSpec(pkgPath string) (*goolib.PkgSpec, error) {
 	return goolib.ExtractPkgSpec(f)
 }
 
-func makeInstallFunction(src, dst string, insFiles map[string]string, dbOnly bool) func(string, os.FileInfo, error) error {
+// makeInstallFunction returns a walk function that copies files from src to
+// dst, recording them in insFiles and the directories they are in in dirs.
+// If keep is set, files that already exist at the destination are recorded
+// but not overwritten. Files whose checksum in old, the files of the version
+// being upgraded from, matches both the new file and the file on disk are
+// left in place.
+func makeInstallFunction(src, dst string, old, insFiles map[string]string, dirs map[string]bool, dbOnly, keep bool) func(string, os.FileInfo, error) error {
 	return func(path string, fi os.FileInfo, err error) (outerr error) {
 		if err != nil {
 			return err
 		}
 		outPath := filepath.Join(dst, strings.TrimPrefix(path, src))
-		if dbOnly {
-			if !fi.IsDir() {
-				f, err := oswrap.Open(path)
-				if err != nil {
-					return err
-				}
+		if fi.IsDir() {
+			useDir(dirs, outPath)
+		} else {
+			useDir(dirs, filepath.Dir(outPath))
+		}
+		if keep && !fi.IsDir() {
+			if f, err := oswrap.Open(outPath); err == nil {
 				defer f.Close()
+				logger.Infof("Keeping existing configuration file %q", outPath)
 				insFiles[outPath] = goolib.Checksum(f)
+				return nil
 			}
-			insFiles[outPath] = ""
-			return nil
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return installLink(path, outPath, dst, insFiles, dirs, dbOnly)
+		}
+		if dbOnly {
+			// Nothing is written, the file is recorded with the
+			// checksum of the packaged file.
+			if fi.IsDir() {
+				return nil
+			}
+			return recordFile(path, outPath, insFiles)
+		}
+		// A directory under dst may be a link or junction to somewhere
+		// else, check where outPath really leads before writing to it.
+		if ok, err := goolib.ResolvesWithin(dst, outPath); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("refusing to install %q, it resolves to outside %q", outPath, dst)
 		}
 		if fi.IsDir() {
 			logger.Infof("Creating folder %q", outPath)
-			// We designate directories by an empty hash.
-			insFiles[outPath] = ""
-			return oswrap.MkdirAll(outPath, fi.Mode())
+			return mkdirAll(outPath, fi.Mode(), dirs)
+		}
+		if chksum := old[outPath]; chksum != "" && unchanged(path, outPath, chksum) {
+			logger.Infof("Skipping unchanged file %q", outPath)
+			insFiles[outPath] = chksum
+			return nil
 		}
 		if err = client.RemoveOrRename(outPath); err != nil {
 			return err
 		}
+		if hardLink && !keep {
+			err := oswrap.Link(path, outPath)
+			if os.IsNotExist(err) {
+				if err := mkdirAll(filepath.Dir(outPath), fi.Mode(), dirs); err != nil {
+					return err
+				}
+				err = oswrap.Link(path, outPath)
+			}
+			if err == nil {
+				logger.Infof("Linked file %q", outPath)
+				return recordFile(path, outPath, insFiles)
+			}
+			logger.Infof("Cannot link %q, copying it: %v", outPath, err)
+		}
 		logger.Infof("Copying file %q", outPath)
 		oFile, err := oswrap.Create(outPath)
 		if err != nil {
 			if !os.IsNotExist(err) {
 				return err
 			}
-			if err := oswrap.MkdirAll(filepath.Dir(outPath), fi.Mode()); err != nil {
+			if err := mkdirAll(filepath.Dir(outPath), fi.Mode(), dirs); err != nil {
 				return err
 			}
 			if oFile, err = oswrap.Create(outPath); err != nil {
@@ -394,66 +712,348 @@ func makeInstallFunction(src, dst string, insFiles map[string]string, dbOnly boo
 		if _, err := io.Copy(mw, iFile); err != nil {
 			return err
 		}
-		// TODO(ajackura): actually use file hash for verification and upgrade.
 		insFiles[outPath] = hex.EncodeToString(hash.Sum(nil))
 		return nil
 	}
 }
 
-func resolveDst(dst string) string {
-	if !filepath.IsAbs(dst) {
-		if strings.HasPrefix(dst, "<") {
-			if i := strings.LastIndex(dst, ">"); i != -1 {
-				return os.Getenv(dst[1:i]) + dst[i+1:]
-			}
+// recordFile records outPath in insFiles with the checksum of the packaged
+// file path.
+func recordFile(path, outPath string, insFiles map[string]string) error {
+	f, err := oswrap.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	insFiles[outPath] = goolib.Checksum(f)
+	return nil
+}
+
+// installLink recreates the symlink path, recorded by goopack -links=record,
+// at outPath with the same relative target and records it in insFiles. The
+// link has to lead to somewhere under dst.
+func installLink(path, outPath, dst string, insFiles map[string]string, dirs map[string]bool, dbOnly bool) error {
+	target, err := oswrap.Readlink(path)
+	if err != nil {
+		return err
+	}
+	if filepath.IsAbs(target) {
+		return fmt.Errorf("refusing to install link %q to %q, its target is not relative", outPath, target)
+	}
+	if dbOnly {
+		insFiles[outPath] = goolib.LinkChecksum(target)
+		return nil
+	}
+	dir := filepath.Dir(outPath)
+	if ok, err := goolib.ResolvesWithin(dst, dir); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("refusing to install %q, it resolves to outside %q", outPath, dst)
+	}
+	if err := mkdirAll(dir, 0755, dirs); err != nil {
+		return err
+	}
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if ok, err := goolib.ResolvesWithin(dst, filepath.Join(real, target)); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("refusing to install link %q to %q, it leads outside %q", outPath, target, dst)
+	}
+	if err := client.RemoveOrRename(outPath); err != nil {
+		return err
+	}
+	logger.Infof("Creating link %q to %q", outPath, target)
+	if err := oswrap.Symlink(target, outPath); err != nil {
+		return err
+	}
+	insFiles[outPath] = goolib.LinkChecksum(target)
+	return nil
+}
+
+// unchanged reports whether both the staged file src and the installed file
+// dst have the checksum chksum.
+func unchanged(src, dst, chksum string) bool {
+	for _, p := range []string{src, dst} {
+		f, err := oswrap.Open(p)
+		if err != nil {
+			return false
+		}
+		c := goolib.Checksum(f)
+		f.Close()
+		if c != chksum {
+			return false
 		}
-		return "/" + dst
 	}
-	return dst
+	return true
 }
 
-func cleanOldFiles(dir string, oldState client.PackageState, insFiles map[string]string) {
-	if len(oldState.InstalledFiles) == 0 {
-		return
+var varName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_()]*$`)
+
+// useDir records that files are installed into dir, without marking it as
+// created.
+func useDir(dirs map[string]bool, dir string) {
+	if _, ok := dirs[dir]; !ok {
+		dirs[dir] = false
 	}
-	var dirs []string
-	for file := range oldState.InstalledFiles {
-		if chksum, ok := insFiles[file]; !ok {
-			if chksum == "" {
-				dirs = append(dirs, file)
-				continue
-			}
-			logger.Infof("Cleaning up old file %q", file)
-			if err := client.RemoveOrRename(file); err != nil {
-				logger.Error(err)
+}
+
+// mkdirAll creates dir and any missing parents, recording the directories it
+// creates in dirs.
+func mkdirAll(dir string, mode os.FileMode, dirs map[string]bool) error {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := oswrap.Stat(d); err == nil {
+			break
+		}
+		missing = append(missing, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	if err := oswrap.MkdirAll(dir, mode); err != nil {
+		return err
+	}
+	for _, d := range missing {
+		dirs[d] = true
+	}
+	return nil
+}
+
+// resolveDst resolves a package file destination. Destinations containing
+// <VAR> or <VAR|default> tokens are expanded from the environment and must
+// then be absolute. Other relative destinations are rooted at the user
+// directory for user scoped packages and at root, or the root of the
+// filesystem if it is empty, otherwise.
+func resolveDst(dst, root string, userScope bool) (string, error) {
+	if filepath.IsAbs(dst) {
+		return dst, nil
+	}
+	exp, err := expandVars(dst)
+	if err != nil {
+		return "", fmt.Errorf("destination %q: %v", dst, err)
+	}
+	if exp != dst {
+		if !filepath.IsAbs(exp) {
+			return "", fmt.Errorf("destination %q expands to %q, which is not an absolute path", dst, exp)
+		}
+		return exp, nil
+	}
+	if userScope {
+		return filepath.Join(goolib.UserDir(), dst), nil
+	}
+	if root != "" {
+		return filepath.Join(root, dst), nil
+	}
+	return "/" + dst, nil
+}
+
+// expandVars replaces each <VAR> token in s with the value of the environment
+// variable VAR. A token written as <VAR|default> expands to default, which may
+// itself contain tokens, when VAR is unset or empty. A '<' without a matching
+// '>' is kept as is.
+func expandVars(s string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '<')
+		if i == -1 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		j := closingBracket(s, i)
+		if j == -1 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		b.WriteString(s[:i])
+		v, err := expandToken(s[i+1 : j])
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(v)
+		s = s[j+1:]
+	}
+}
+
+// closingBracket returns the index of the '>' matching the '<' at s[i], or -1.
+func closingBracket(s string, i int) int {
+	depth := 0
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case '<':
+			depth++
+		case '>':
+			depth--
+			if depth == 0 {
+				return j
 			}
 		}
 	}
-	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
-	for _, dir := range dirs {
-		if err := client.RemoveOrRename(dir); err != nil {
-			logger.Info(err)
+	return -1
+}
+
+// expandToken expands the contents of a single <VAR|default> token.
+func expandToken(t string) (string, error) {
+	name, def, hasDef := t, "", false
+	if i := strings.IndexByte(t, '|'); i != -1 {
+		name, def, hasDef = t[:i], t[i+1:], true
+	}
+	if !varName.MatchString(name) {
+		return "", fmt.Errorf("invalid environment variable name %q", name)
+	}
+	if v := os.Getenv(name); v != "" {
+		return v, nil
+	}
+	if !hasDef {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return expandVars(def)
+}
+
+// cleanOldFiles removes the files of the old version of a package that the
+// new version ns does not install, and the directories the old version
+// created that ns does not use once they are empty. Created directories ns
+// still uses become owned by ns.
+func cleanOldFiles(old client.PackageState, ns *client.PackageState, state client.GooGetState) {
+	for file, chksum := range old.InstalledFiles {
+		if chksum == "" {
+			continue
+		}
+		if _, ok := ns.InstalledFiles[file]; ok {
+			continue
+		}
+		logger.Infof("Cleaning up old file %q", file)
+		if err := client.RemoveOrRename(file); err != nil {
+			logger.Error(err)
+		}
+	}
+	state.RemoveDirs(handOverDirs(old, ns), goolib.PackageInfo{Name: ns.PackageSpec.Name, Arch: ns.PackageSpec.Arch})
+}
+
+// handOverDirs marks the directories created by old that ns still uses as
+// created by ns, so they are removed along with it, and returns the others.
+func handOverDirs(old client.PackageState, ns *client.PackageState) []string {
+	var dirs []string
+	for _, d := range old.CreatedDirs() {
+		if _, ok := ns.Dirs[d]; ok {
+			ns.Dirs[d] = true
+			continue
 		}
+		dirs = append(dirs, d)
 	}
+	return dirs
+}
+
+// installed are the files and directories installPkg installed.
+type installed struct {
+	files, config map[string]string
+	// dirs are the directories files were installed into, true for those
+	// that were created.
+	dirs map[string]bool
+	// signature is the result of checking the signature of the installer.
+	signature *client.Signature
+	// script is what the installer reported.
+	script *client.ScriptResult
+	// enabled are the Windows features the install enabled.
+	enabled *goolib.WindowsFeatures
+	// certs are the certificates the install added to certificate stores.
+	certs []client.Certificate
+	// exclusions are the Defender exclusions the install applied.
+	exclusions *goolib.Exclusions
 }
 
-func installPkg(dir string, ps *goolib.PkgSpec, dbOnly bool) (map[string]string, error) {
+// installPkg installs the files of the package unpacked in dir and runs its
+// installer, relative destinations are installed under root, if set, and
+// prev is the version being upgraded from, if any, with old its installed
+// files. Files unchanged from old are not copied again. It returns the
+// installed files, configuration files and directories. Existing
+// configuration files are never overwritten. The certificates and Windows
+// features of ps are added before the installer runs, and removed again if it
+// fails. Its Defender exclusions are applied after the installer, or the
+// files if it has none.
+//
+// If dbOnly is set nothing outside dir is changed: the installer is neither
+// checked nor run, no certificates, features or exclusions are added, no
+// files, directories or permissions are written and the files are recorded
+// as installed with the checksums of the packaged files, existing
+// configuration files with their own. No directory is recorded as created.
+func installPkg(dir string, ps *goolib.PkgSpec, root, prev string, old map[string]string, dbOnly bool, rp msg.Reporter) (installed, error) {
 	logger.Infof("Executing install of package %q", filepath.Base(dir))
-	insFiles := make(map[string]string)
-	for src, dst := range ps.Files {
-		dst = resolveDst(dst)
-		src = filepath.Join(dir, src)
-		if err := oswrap.Walk(src, makeInstallFunction(src, dst, insFiles, dbOnly)); err != nil {
-			return nil, err
+	var sig *client.Signature
+	if !dbOnly {
+		// Check the installer before anything is changed, it would fail
+		// the install anyway.
+		var err error
+		if sig, err = system.CheckInstaller(dir, ps, prev); err != nil {
+			return installed{}, err
 		}
+		need, err := filesSpace(dir, ps, root)
+		if err != nil {
+			return installed{}, err
+		}
+		if err := checkSpace(need); err != nil {
+			return installed{}, err
+		}
+	}
+	ins := installed{files: make(map[string]string), dirs: make(map[string]bool), signature: sig}
+	if err := installFiles(dir, ps.Files, ps.Permissions, root, ps.UserScope(), old, ins.files, ins.dirs, dbOnly, false); err != nil {
+		return installed{}, err
+	}
+	if len(ps.ConfigFiles) > 0 {
+		ins.config = make(map[string]string)
+		if err := installFiles(dir, ps.ConfigFiles, ps.Permissions, root, ps.UserScope(), nil, ins.config, ins.dirs, dbOnly, true); err != nil {
+			return installed{}, err
+		}
+	}
+	if len(ins.dirs) == 0 {
+		ins.dirs = nil
 	}
 	if dbOnly {
-		return insFiles, nil
+		return ins, nil
+	}
+	certs, err := system.InstallCertificates(dir, ps)
+	var enabled *goolib.WindowsFeatures
+	var reboot bool
+	if err == nil {
+		enabled, reboot, err = system.EnableFeatures(ps)
 	}
-	return insFiles, system.Install(dir, ps)
+	if err == nil {
+		ins.script, err = system.Install(dir, ps, ins.files, prev, rp)
+	}
+	if err != nil {
+		// Leave the features and certificate stores as they were, the
+		// install failed.
+		if _, err := system.DisableFeatures(enabled); err != nil {
+			logger.Error(err)
+		}
+		if err := system.RemoveCertificates(certs); err != nil {
+			logger.Error(err)
+		}
+		return ins, err
+	}
+	ins.enabled = enabled
+	ins.certs = certs
+	if ins.exclusions, err = system.ApplyExclusions(ps); err != nil {
+		logger.Error(err)
+	}
+	if reboot {
+		if ins.script == nil {
+			ins.script = &client.ScriptResult{}
+		}
+		ins.script.RebootRequired = true
+	}
+	return ins, nil
 }
 
 func listDeps(pi goolib.PackageInfo, rm client.RepoMap, repo string, dl []goolib.PackageInfo, archs []string) ([]goolib.PackageInfo, error) {
+	for _, p := range dl {
+		// Already listed, the dependencies have a cycle.
+		if p == pi {
+			return dl, nil
+		}
+	}
 	rs, err := client.FindRepoSpec(pi, rm[repo])
 	if err != nil {
 		return nil, err
@@ -485,5 +1085,12 @@ func listDeps(pi goolib.PackageInfo, rm client.RepoMap, repo string, dl []goolib
 // ListDeps returns a list of dependencies and subdependancies for a package.
 func ListDeps(pi goolib.PackageInfo, rm client.RepoMap, repo string, archs []string) ([]goolib.PackageInfo, error) {
 	logger.Infof("Building dependency list for %s.%s.%s", pi.Name, pi.Arch, pi.Ver)
+	rs, err := client.FindRepoSpec(pi, rm[repo])
+	if err != nil {
+		return nil, err
+	}
+	if us := checkDeps(rs.PackageSpec, client.NewIndex(rm), archs, nil, nil); len(us) > 0 {
+		return nil, &DepError{Unsatisfied: us}
+	}
 	return listDeps(pi, rm, repo, nil, archs)
 }
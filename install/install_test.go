@@ -14,15 +14,20 @@ limitations under the License.
 package install
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/googet/client"
 	"github.com/google/googet/goolib"
+	"github.com/google/googet/msg"
 	"github.com/google/googet/oswrap"
+	"github.com/google/googet/testutil"
 	"github.com/google/logger"
 )
 
@@ -126,6 +131,7 @@ func TestInstallPkg(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to create temp directory: %v", err)
 	}
+	tmp := dst
 	dst += ("/this/is/an/extremely/long/filename/you/wouldnt/expect/to/see/it/" +
 		"in/the/wild/but/you/would/actually/be/surprised/at/some/of/the/" +
 		"stuff/that/pops/up/and/seriously/two/hundred/and/fify/five/chars" +
@@ -133,10 +139,10 @@ func TestInstallPkg(t *testing.T) {
 		"which/exceeded/this/limit/hence/this/absurdly/long/string/in/" +
 		"this/unit/test")
 
-	defer oswrap.RemoveAll(dst)
+	defer oswrap.RemoveAll(tmp)
 
 	files := []string{"test1", "test2", "test3"}
-	want := map[string]string{dst: ""}
+	want := make(map[string]string)
 	for _, n := range files {
 		f, err := oswrap.Create(filepath.Join(src, n))
 		if err != nil {
@@ -150,13 +156,21 @@ func TestInstallPkg(t *testing.T) {
 
 	ps := goolib.PkgSpec{Files: map[string]string{filepath.Base(src): dst}}
 
-	got, err := installPkg(filepath.Dir(src), &ps, false)
+	got, err := installPkg(filepath.Dir(src), &ps, "", "", nil, false, msg.Discard)
 	if err != nil {
 		t.Fatalf("Error running installPkg: %v", err)
 	}
 
-	if !reflect.DeepEqual(got, want) {
-		t.Fatalf("installPkg did not return expected file list, got: %+v, want: %+v", got, want)
+	if !reflect.DeepEqual(got.files, want) {
+		t.Fatalf("installPkg did not return expected file list, got: %+v, want: %+v", got.files, want)
+	}
+	for d := dst; d != tmp; d = filepath.Dir(d) {
+		if !got.dirs[d] {
+			t.Errorf("created directory %s not recorded as created, dirs: %v", d, got.dirs)
+		}
+	}
+	if _, ok := got.dirs[tmp]; ok {
+		t.Errorf("existing directory %s recorded as a package directory", tmp)
 	}
 
 	for _, n := range files {
@@ -167,74 +181,706 @@ func TestInstallPkg(t *testing.T) {
 	}
 }
 
-func TestCleanOldFiles(t *testing.T) {
+func TestInstallPkgUnchanged(t *testing.T) {
 	src, err := ioutil.TempDir("", "")
 	if err != nil {
 		t.Fatalf("Failed to create temp directory: %v", err)
 	}
 	defer oswrap.RemoveAll(src)
+	dst, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dst)
 
+	sum := func(s string) string { return goolib.Checksum(bytes.NewReader([]byte(s))) }
+	old := make(map[string]string)
+	for _, f := range []struct{ name, staged, installed, recorded string }{
+		{"same", "v1", "v1", "v1"},
+		{"changed", "v2", "v1", "v1"},
+		{"edited", "v1", "edited", "v1"},
+	} {
+		if err := ioutil.WriteFile(filepath.Join(src, f.name), []byte(f.staged), 0666); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		p := filepath.Join(dst, f.name)
+		if err := ioutil.WriteFile(p, []byte(f.installed), 0666); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		old[p] = sum(f.recorded)
+	}
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	same := filepath.Join(dst, "same")
+	if err := os.Chtimes(same, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	ps := goolib.PkgSpec{Files: map[string]string{"*": dst}}
+	got, err := installPkg(src, &ps, "", "", old, false, msg.Discard)
+	if err != nil {
+		t.Fatalf("Error running installPkg: %v", err)
+	}
+
+	fi, err := oswrap.Stat(same)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ModTime().Equal(mtime) {
+		t.Errorf("unchanged file %s was rewritten", same)
+	}
+	for name, want := range map[string]string{"same": "v1", "changed": "v2", "edited": "v1"} {
+		p := filepath.Join(dst, name)
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("%s contains %q, want %q", name, b, want)
+		}
+		if got.files[p] != sum(want) {
+			t.Errorf("%s recorded with checksum %q, want %q", name, got.files[p], sum(want))
+		}
+	}
+}
+
+func TestInstallPkgHardLink(t *testing.T) {
+	SetHardLink(true)
+	defer SetHardLink(false)
+
+	src, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(src)
+	dst := filepath.Join(src, "dst")
+
+	for _, n := range []string{"tool", "tool.conf"} {
+		if err := ioutil.WriteFile(filepath.Join(src, n), []byte(n), 0666); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	ps := goolib.PkgSpec{
+		Files:       map[string]string{"tool": filepath.Join(dst, "tool")},
+		ConfigFiles: map[string]string{"tool.conf": filepath.Join(dst, "tool.conf")},
+	}
+	if _, err := installPkg(src, &ps, "", "", nil, false, msg.Discard); err != nil {
+		t.Fatalf("Error running installPkg: %v", err)
+	}
+
+	for n, want := range map[string]bool{"tool": true, "tool.conf": false} {
+		sfi, err := oswrap.Stat(filepath.Join(src, n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dfi, err := oswrap.Stat(filepath.Join(dst, n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := os.SameFile(sfi, dfi); got != want {
+			t.Errorf("%s linked: %v, want %v", n, got, want)
+		}
+	}
+}
+
+func TestInstallPkgLinkEscape(t *testing.T) {
+	src, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(src)
 	dst, err := ioutil.TempDir("", "")
 	if err != nil {
 		t.Fatalf("Failed to create temp directory: %v", err)
 	}
 	defer oswrap.RemoveAll(dst)
+	outside, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(outside)
 
-	for _, n := range []string{filepath.Join(src, "test1"), filepath.Join(src, "test2")} {
-		if err := ioutil.WriteFile(n, []byte{}, 0666); err != nil {
+	if err := oswrap.MkdirAll(filepath.Join(src, "data", "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create test directory: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "data", "sub", "file"), []byte("data"), 0666); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := oswrap.MkdirAll(filepath.Join(dst, "data"), 0755); err != nil {
+		t.Fatalf("Failed to create test directory: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dst, "data", "sub")); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+
+	ps := goolib.PkgSpec{Files: map[string]string{"data": filepath.Join(dst, "data")}}
+	if _, err := installPkg(src, &ps, "", "", nil, false, msg.Discard); err == nil {
+		t.Error("installPkg through a link out of the destination did not return an error")
+	}
+	if _, err := oswrap.Stat(filepath.Join(outside, "file")); err == nil {
+		t.Error("installPkg wrote a file through a link out of the destination")
+	}
+}
+
+func TestInstallPkgConfigFiles(t *testing.T) {
+	src, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(src)
+	dst, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dst)
+
+	for _, n := range []string{"new.conf", "existing.conf"} {
+		if err := ioutil.WriteFile(filepath.Join(src, n), []byte("packaged"), 0666); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	existing := filepath.Join(dst, "existing.conf")
+	if err := ioutil.WriteFile(existing, []byte("edited"), 0666); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	ps := goolib.PkgSpec{ConfigFiles: map[string]string{
+		"new.conf":      filepath.Join(dst, "new.conf"),
+		"existing.conf": existing,
+	}}
+	got, err := installPkg(src, &ps, "", "", nil, false, msg.Discard)
+	if err != nil {
+		t.Fatalf("Error running installPkg: %v", err)
+	}
+	if len(got.files) != 0 {
+		t.Errorf("configuration files were recorded as installed files: %v", got.files)
+	}
+	if created, ok := got.dirs[dst]; !ok || created {
+		t.Errorf("existing directory %s not recorded as used, dirs: %v", dst, got.dirs)
+	}
+	cfgFiles := got.config
+	want := map[string]string{
+		filepath.Join(dst, "new.conf"): goolib.Checksum(bytes.NewReader([]byte("packaged"))),
+		existing:                       goolib.Checksum(bytes.NewReader([]byte("edited"))),
+	}
+	if !reflect.DeepEqual(cfgFiles, want) {
+		t.Errorf("installPkg did not return expected config files, got: %+v, want: %+v", cfgFiles, want)
+	}
+	b, err := ioutil.ReadFile(existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "edited" {
+		t.Errorf("existing configuration file was overwritten, contents: %q", b)
+	}
+}
+
+func TestInstallPkgDBOnly(t *testing.T) {
+	src, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(src)
+	dst, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dst)
+
+	sum := func(s string) string { return goolib.Checksum(bytes.NewReader([]byte(s))) }
+	if err := oswrap.MkdirAll(filepath.Join(src, "files", "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create test directory: %v", err)
+	}
+	for n, c := range map[string]string{
+		"files/a":       "a",
+		"files/sub/b":   "b",
+		"new.conf":      "packaged",
+		"existing.conf": "packaged",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(src, n), []byte(c), 0666); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	existing := filepath.Join(dst, "existing.conf")
+	if err := ioutil.WriteFile(existing, []byte("edited"), 0666); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	out := filepath.Join(dst, "app")
+	ps := goolib.PkgSpec{
+		Files: map[string]string{"files": out},
+		ConfigFiles: map[string]string{
+			"new.conf":      filepath.Join(dst, "new.conf"),
+			"existing.conf": existing,
+		},
+		Permissions: map[string]goolib.Permission{"**": {Mode: "0600"}},
+	}
+	before := testutil.Tree(t, dst)
+
+	got, err := installPkg(src, &ps, "", "", nil, true, msg.Discard)
+	if err != nil {
+		t.Fatalf("Error running installPkg: %v", err)
+	}
+
+	if after := testutil.Tree(t, dst); !reflect.DeepEqual(after, before) {
+		t.Errorf("db_only install changed the filesystem, before: %v, after: %v", before, after)
+	}
+	wantFiles := map[string]string{
+		filepath.Join(out, "a"):        sum("a"),
+		filepath.Join(out, "sub", "b"): sum("b"),
+	}
+	if !reflect.DeepEqual(got.files, wantFiles) {
+		t.Errorf("installPkg recorded files %v, want %v", got.files, wantFiles)
+	}
+	wantConfig := map[string]string{
+		filepath.Join(dst, "new.conf"): sum("packaged"),
+		existing:                       sum("edited"),
+	}
+	if !reflect.DeepEqual(got.config, wantConfig) {
+		t.Errorf("installPkg recorded configuration files %v, want %v", got.config, wantConfig)
+	}
+	for d, created := range got.dirs {
+		if created {
+			t.Errorf("db_only install recorded directory %s as created", d)
+		}
+	}
+	if _, ok := got.dirs[filepath.Join(out, "sub")]; !ok {
+		t.Errorf("directory %s not recorded as used, dirs: %v", filepath.Join(out, "sub"), got.dirs)
+	}
+}
+
+func TestCommitInstallDBOnly(t *testing.T) {
+	cache, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(cache)
+	dst, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dst)
+
+	oldDir := filepath.Join(cache, "old")
+	newDir := filepath.Join(cache, "new")
+	for _, d := range []string{oldDir, newDir} {
+		if err := oswrap.Mkdir(d, 0755); err != nil {
+			t.Fatalf("Failed to create test directory: %v", err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(newDir, "kept"), []byte("v2"), 0666); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	sub := filepath.Join(dst, "sub")
+	if err := oswrap.Mkdir(sub, 0755); err != nil {
+		t.Fatalf("Failed to create test directory: %v", err)
+	}
+	kept := filepath.Join(sub, "kept")
+	gone := filepath.Join(sub, "gone")
+	for _, f := range []string{kept, gone} {
+		if err := ioutil.WriteFile(f, []byte("v1"), 0666); err != nil {
 			t.Fatalf("Failed to create test file: %v", err)
 		}
 	}
+	state := client.GooGetState{{
+		UnpackDir:      oldDir,
+		PackageSpec:    &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "1.0.0@1"},
+		InstalledFiles: map[string]string{kept: "chksum", gone: "chksum"},
+		Dirs:           map[string]bool{dst: false, sub: true},
+	}}
+	ns := client.PackageState{
+		UnpackDir:   newDir,
+		PackageSpec: &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "2.0.0@1", Files: map[string]string{"kept": kept}},
+	}
+	j := &client.Journal{Path: filepath.Join(cache, "googet.journal")}
+	before := testutil.Tree(t, dst)
 
-	want := filepath.Join(dst, "test1")
-	notWant := filepath.Join(dst, "test2")
+	if err := commitInstall(ns, &state, j, true, msg.Discard); err != nil {
+		t.Fatalf("Error running commitInstall: %v", err)
+	}
+
+	if after := testutil.Tree(t, dst); !reflect.DeepEqual(after, before) {
+		t.Errorf("db_only install changed the filesystem, before: %v, after: %v", before, after)
+	}
+	if len(state) != 1 || state[0].PackageSpec.Version != "2.0.0@1" {
+		t.Fatalf("state not updated to the new version: %+v", state)
+	}
+	want := map[string]string{kept: goolib.Checksum(bytes.NewReader([]byte("v2")))}
+	if !reflect.DeepEqual(state[0].InstalledFiles, want) {
+		t.Errorf("recorded files %v, want %v", state[0].InstalledFiles, want)
+	}
+	if !state[0].Dirs[sub] {
+		t.Errorf("directory %s created by the old version is no longer owned, dirs: %v", sub, state[0].Dirs)
+	}
+	if _, err := oswrap.Stat(oldDir); err == nil {
+		t.Errorf("cache directory %s of the old version not removed", oldDir)
+	}
+}
+
+func TestCleanOldFiles(t *testing.T) {
+	dst, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dst)
+
+	kept := filepath.Join(dst, "kept")
+	gone := filepath.Join(dst, "gone")
+	shared := filepath.Join(dst, "shared")
+	for _, d := range []string{kept, gone, shared} {
+		if err := oswrap.Mkdir(d, 0755); err != nil {
+			t.Fatalf("Failed to create test directory: %v", err)
+		}
+	}
+	want := filepath.Join(kept, "test1")
+	notWant := filepath.Join(gone, "test2")
 	dontCare := filepath.Join(dst, "test3")
-	for _, n := range []string{want, notWant, dontCare} {
+	other := filepath.Join(shared, "other")
+	for _, n := range []string{want, notWant, dontCare, other} {
 		if err := ioutil.WriteFile(n, []byte{}, 0666); err != nil {
 			t.Fatalf("Failed to create test file: %v", err)
 		}
 	}
 
-	st := client.PackageState{
-		PackageSpec: &goolib.PkgSpec{
-			Files: map[string]string{filepath.Base(src): dst},
-		},
+	old := client.PackageState{
+		PackageSpec: &goolib.PkgSpec{Name: "foo", Arch: "noarch"},
 		InstalledFiles: map[string]string{
 			want:    "chksum",
 			notWant: "chksum",
-			dst:     "",
+		},
+		Dirs: map[string]bool{dst: false, kept: true, gone: true, shared: true},
+	}
+	ns := client.PackageState{
+		PackageSpec:    &goolib.PkgSpec{Name: "foo", Arch: "noarch"},
+		InstalledFiles: map[string]string{want: "chksum"},
+		Dirs:           map[string]bool{dst: false, kept: false},
+	}
+	state := client.GooGetState{
+		old,
+		{
+			PackageSpec:    &goolib.PkgSpec{Name: "bar", Arch: "noarch"},
+			InstalledFiles: map[string]string{other: "chksum"},
+			Dirs:           map[string]bool{shared: false},
 		},
 	}
 
-	cleanOldFiles(dst, st, map[string]string{want: "", dst: ""})
+	cleanOldFiles(old, &ns, state)
 
-	for _, n := range []string{want, dontCare} {
+	for _, n := range []string{want, dontCare, kept, shared} {
 		if _, err := oswrap.Stat(n); err != nil {
-			t.Errorf("Expected test file %s does not exist", want)
+			t.Errorf("Expected %s does not exist", n)
 		}
 	}
-
-	if _, err := oswrap.Stat(notWant); err == nil {
-		t.Errorf("Deprecated file %s not removed", notWant)
+	for _, n := range []string{notWant, gone} {
+		if _, err := oswrap.Stat(n); err == nil {
+			t.Errorf("Deprecated %s not removed", n)
+		}
+	}
+	if !ns.Dirs[kept] {
+		t.Errorf("directory %s created by the old version is no longer owned, dirs: %v", kept, ns.Dirs)
+	}
+	if ns.Dirs[dst] {
+		t.Errorf("existing directory %s marked as created, dirs: %v", dst, ns.Dirs)
+	}
+	if !state[1].Dirs[shared] {
+		t.Errorf("shared directory %s not handed over to bar, dirs: %v", shared, state[1].Dirs)
 	}
 }
 
 func TestResolveDst(t *testing.T) {
-	if err := os.Setenv("foo", "bar"); err != nil {
-		t.Errorf("error setting environment variable: %v", err)
+	for k, v := range map[string]string{"foo": "/bar", "baz": "/qux", "rel": "relative", "empty": ""} {
+		if err := os.Setenv(k, v); err != nil {
+			t.Errorf("error setting environment variable: %v", err)
+		}
 	}
+	os.Unsetenv("unset")
 
 	table := []struct {
-		dst, want string
+		dst, root, want string
+		user            bool
 	}{
-		{"<foo>/some/place", "bar/some/place"},
-		{"<foo/some/place", "/<foo/some/place"},
-		{"something/<foo>/some/place", "/something/<foo>/some/place"},
+		{"<foo>/some/place", "", "/bar/some/place", false},
+		{"<foo/some/place", "", "/<foo/some/place", false},
+		{"<foo>/some/place", "", "/bar/some/place", true},
+		{"some/place", "", filepath.Join(goolib.UserDir(), "some/place"), true},
+		{"some/place", "/data", filepath.Join("/data", "some/place"), false},
+		{"/abs/place", "/data", "/abs/place", false},
+		{"some/place", "/data", filepath.Join(goolib.UserDir(), "some/place"), true},
+		{"<foo><baz>/place", "", "/bar/qux/place", false},
+		{"<foo>/<rel>/<rel>", "", "/bar/relative/relative", false},
+		{"<unset|/fallback>/place", "", "/fallback/place", false},
+		{"<empty|/fallback>/place", "", "/fallback/place", false},
+		{"<foo|/fallback>/place", "", "/bar/place", false},
+		{"<unset|<baz>/sub>/place", "", "/qux/sub/place", false},
+		{"<unset|<empty|/last>>/place", "", "/last/place", false},
+		{"<foo|<unset>>/place", "", "/bar/place", false},
+		{"<unset|/x:y|z>/place", "", "/x:y|z/place", false},
 	}
 	for _, tt := range table {
-		got := resolveDst(tt.dst)
+		got, err := resolveDst(tt.dst, tt.root, tt.user)
+		if err != nil {
+			t.Errorf("resolveDst(%q) returned error: %v", tt.dst, err)
+			continue
+		}
 		if got != tt.want {
-			t.Errorf("resolveDst returned %s, want %s", got, tt.want)
+			t.Errorf("resolveDst(%q) returned %s, want %s", tt.dst, got, tt.want)
+		}
+	}
+
+	for _, dst := range []string{
+		"<unset>/some/place",
+		"<rel>/some/place",
+		"something/<foo>/some/place",
+		"<unset|relative>/place",
+		"<not a var>/place",
+		"<>/place",
+		"<unset|<unset2>>/place",
+	} {
+		if got, err := resolveDst(dst, "", false); err == nil {
+			t.Errorf("resolveDst(%q) = %q, want error", dst, got)
 		}
 	}
 }
+
+func TestInstallPkgVars(t *testing.T) {
+	src, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(src)
+	dst, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dst)
+
+	for _, d := range []string{"bin", "lib", "etc"} {
+		if err := oswrap.MkdirAll(filepath.Join(src, d), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(src, d, "file"), []byte(d), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	if err := os.Setenv("GOOGET_TEST_DST", dst); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("GOOGET_TEST_DST")
+	os.Unsetenv("GOOGET_TEST_UNSET")
+
+	ps := goolib.PkgSpec{
+		Files: map[string]string{
+			"bin": "<GOOGET_TEST_DST>/bin",
+			"lib": "<GOOGET_TEST_UNSET|<GOOGET_TEST_DST>/fallback>/lib",
+		},
+		ConfigFiles: map[string]string{"etc": "<GOOGET_TEST_DST>/<GOOGET_TEST_UNSET|conf>"},
+	}
+	if _, err := installPkg(src, &ps, "", "", nil, false, msg.Discard); err != nil {
+		t.Fatalf("Error running installPkg: %v", err)
+	}
+	for _, want := range []string{"bin/file", "fallback/lib/file", "conf/file"} {
+		if _, err := oswrap.Stat(filepath.Join(dst, want)); err != nil {
+			t.Errorf("Expected file %s does not exist", want)
+		}
+	}
+
+	ps.Files["bin"] = "<GOOGET_TEST_UNSET>/bin"
+	if _, err := installPkg(src, &ps, "", "", nil, false, msg.Discard); err == nil {
+		t.Error("installPkg with an unset variable in a destination returned no error")
+	}
+}
+
+func TestCheckScope(t *testing.T) {
+	table := []struct {
+		scope     string
+		userScope bool
+		ok        bool
+	}{
+		{"", false, true},
+		{goolib.ScopeMachine, false, true},
+		{goolib.ScopeUser, true, true},
+		{goolib.ScopeUser, false, false},
+		{"", true, false},
+	}
+	for _, tt := range table {
+		ps := &goolib.PkgSpec{Name: "foo_pkg", Arch: "noarch", Version: "1.0.0@1", InstallScope: tt.scope}
+		if err := checkScope(ps, tt.userScope); (err == nil) != tt.ok {
+			t.Errorf("checkScope(%q, %v) returned %v, want ok: %v", tt.scope, tt.userScope, err, tt.ok)
+		}
+	}
+}
+
+func TestCheckCoinstall(t *testing.T) {
+	state := client.GooGetState{
+		{PackageSpec: &goolib.PkgSpec{Name: "foo_pkg", Arch: "x86_64", Version: "1.0.0@1", Coinstallable: true}},
+		{PackageSpec: &goolib.PkgSpec{Name: "bar_pkg", Arch: "x86_64", Version: "1.0.0@1"}},
+	}
+	table := []struct {
+		name, arch    string
+		coinstallable bool
+		ok            bool
+	}{
+		{"foo_pkg", "x86_32", true, true},
+		{"foo_pkg", "x86_32", false, false},
+		{"foo_pkg", "x86_64", false, true},
+		{"bar_pkg", "x86_32", true, false},
+		{"bar_pkg", "x86_64", false, true},
+		{"baz_pkg", "x86_32", false, true},
+	}
+	for _, tt := range table {
+		ps := &goolib.PkgSpec{Name: tt.name, Arch: tt.arch, Version: "2.0.0@1", Coinstallable: tt.coinstallable}
+		if err := checkCoinstall(ps, state); (err == nil) != tt.ok {
+			t.Errorf("checkCoinstall(%s.%s, %v) returned %v, want ok: %v", tt.name, tt.arch, tt.coinstallable, err, tt.ok)
+		}
+	}
+}
+
+func TestFromURL(t *testing.T) {
+	cache, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(cache)
+
+	r := testutil.NewRepo(t, "repo")
+	defer r.Close()
+	rs := r.Add(t, &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "1.0.0@1"}, nil)
+	pkgURL := strings.TrimSuffix(r.URL(), "repo") + rs.Source
+
+	state := &client.GooGetState{}
+	j := &client.Journal{Path: filepath.Join(cache, "googet.journal")}
+	if err := FromURL(pkgURL, "", cache, state, j, true, false, false, "", msg.Discard); err == nil {
+		t.Error("FromURL without a checksum did not return an error")
+	}
+	if err := FromURL(pkgURL, strings.Repeat("0", 64), cache, state, j, true, false, false, "", msg.Discard); err == nil {
+		t.Error("FromURL with the wrong checksum did not return an error")
+	}
+	if err := FromURL(pkgURL, rs.Checksum, cache, state, j, true, false, false, "", msg.Discard); err != nil {
+		t.Fatalf("FromURL: %v", err)
+	}
+	ps, err := state.GetPackageState(goolib.PackageInfo{Name: "foo", Arch: "noarch"})
+	if err != nil {
+		t.Fatalf("foo is not installed: %v", err)
+	}
+	if ps.DownloadURL != pkgURL || ps.Checksum != rs.Checksum {
+		t.Errorf("installed from %q with checksum %q, want %q and %q", ps.DownloadURL, ps.Checksum, pkgURL, rs.Checksum)
+	}
+	if _, err := oswrap.Stat(filepath.Join(cache, filepath.Base(rs.Source)+".download")); err == nil {
+		t.Error("FromURL left the download in the cache")
+	}
+}
+
+func TestFromReader(t *testing.T) {
+	cache, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(cache)
+	src, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(src)
+
+	goo := testutil.GenGoo(t, src, &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "1.0.0@1"}, nil)
+	b, err := ioutil.ReadFile(goo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chksum := goolib.Checksum(bytes.NewReader(b))
+
+	state := &client.GooGetState{}
+	j := &client.Journal{Path: filepath.Join(cache, "googet.journal")}
+	if err := FromReader(bytes.NewReader(b), "", cache, state, j, true, false, false, msg.Discard); err == nil {
+		t.Error("FromReader without a checksum did not return an error")
+	}
+	if err := FromReader(bytes.NewReader(b), strings.Repeat("0", 64), cache, state, j, true, false, false, msg.Discard); err == nil {
+		t.Error("FromReader with the wrong checksum did not return an error")
+	}
+	if err := FromReader(bytes.NewReader(b), chksum, cache, state, j, true, false, false, msg.Discard); err != nil {
+		t.Fatalf("FromReader: %v", err)
+	}
+	ps, err := state.GetPackageState(goolib.PackageInfo{Name: "foo", Arch: "noarch"})
+	if err != nil {
+		t.Fatalf("foo is not installed: %v", err)
+	}
+	if ps.Checksum != chksum {
+		t.Errorf("installed with checksum %q, want %q", ps.Checksum, chksum)
+	}
+	if _, err := oswrap.Stat(filepath.Join(cache, "stream.goo.download")); err == nil {
+		t.Error("FromReader left the stream in the cache")
+	}
+}
+
+func TestRecover(t *testing.T) {
+	src, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(src)
+
+	oldDir := filepath.Join(src, "old")
+	if err := oswrap.Mkdir(oldDir, 0755); err != nil {
+		t.Fatalf("error creating old unpack directory: %v", err)
+	}
+	oldFile := filepath.Join(src, "old.txt")
+	if err := ioutil.WriteFile(oldFile, []byte{}, 0644); err != nil {
+		t.Fatalf("error creating old file: %v", err)
+	}
+
+	old := client.PackageState{
+		UnpackDir:      oldDir,
+		PackageSpec:    &goolib.PkgSpec{Name: "foo_pkg", Version: "1.0.0@1", Arch: "noarch"},
+		InstalledFiles: map[string]string{oldFile: ""},
+	}
+	bar := client.PackageState{PackageSpec: &goolib.PkgSpec{Name: "bar_pkg", Version: "2.0.0@1", Arch: "noarch"}}
+	state := client.GooGetState{old}
+
+	j := &client.Journal{Path: filepath.Join(src, "googet.journal")}
+	entries := []client.JournalEntry{
+		{
+			Stage: client.StageFilesCommitted,
+			Old:   &old,
+			New: client.PackageState{
+				UnpackDir:   filepath.Join(src, "new"),
+				PackageSpec: &goolib.PkgSpec{Name: "foo_pkg", Version: "2.0.0@1", Arch: "noarch"},
+			},
+		},
+		{Stage: client.StagePrepared, New: bar},
+	}
+	for _, e := range entries {
+		if err := j.Record(e); err != nil {
+			t.Fatalf("error recording journal entry: %v", err)
+		}
+	}
+
+	if err := Recover(j, &state); err != nil {
+		t.Fatalf("error running Recover: %v", err)
+	}
+
+	if _, err := oswrap.Stat(oldFile); err == nil {
+		t.Errorf("Recover did not remove old file %q", oldFile)
+	}
+	if _, err := oswrap.Stat(oldDir); err == nil {
+		t.Errorf("Recover did not remove old unpack directory %q", oldDir)
+	}
+	want := client.GooGetState{entries[0].New}
+	if !reflect.DeepEqual(state, want) {
+		t.Errorf("Recover produced unexpected state, want: %+v, got: %+v", want, state)
+	}
+}
+
+func TestListDepsCycle(t *testing.T) {
+	rm := client.RepoMap{
+		"repo": []goolib.RepoSpec{
+			{PackageSpec: &goolib.PkgSpec{Name: "a", Arch: "noarch", Version: "1.0.0@1", PkgDependencies: map[string]string{"b": "1.0.0@1"}}},
+			{PackageSpec: &goolib.PkgSpec{Name: "b", Arch: "noarch", Version: "1.0.0@1", PkgDependencies: map[string]string{"a": "1.0.0@1"}}},
+		},
+	}
+	got, err := ListDeps(goolib.PackageInfo{Name: "a", Arch: "noarch", Ver: "1.0.0@1"}, rm, "repo", []string{"noarch"})
+	if err != nil {
+		t.Fatalf("ListDeps: %v", err)
+	}
+	want := []goolib.PackageInfo{{Name: "a", Arch: "noarch", Ver: "1.0.0@1"}, {Name: "b", Arch: "noarch", Ver: "1.0.0@1"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListDeps() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"path/filepath"
+
+	"github.com/google/googet/oswrap"
+)
+
+// Location overrides where a package is cached and where its relative file
+// destinations are installed, empty fields keep the default.
+type Location struct {
+	CacheDir, InstallRoot string
+}
+
+var (
+	defaultRoot string
+	locations   = make(map[string]Location)
+)
+
+// SetInstallRoot sets the directory relative file destinations are installed
+// under, the root of the filesystem by default.
+func SetInstallRoot(dir string) {
+	defaultRoot = dir
+}
+
+// SetLocation sets the location of the package named name.
+func SetLocation(name string, l Location) {
+	locations[name] = l
+}
+
+// packageCache returns the cache directory for the package named name,
+// cache unless it is overridden.
+func packageCache(name, cache string) (string, error) {
+	dir := locations[name].CacheDir
+	if dir == "" {
+		return cache, nil
+	}
+	if err := oswrap.MkdirAll(dir, 0774); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// installRoot returns the install root for the package named name, empty
+// for the root of the filesystem.
+func installRoot(name string) string {
+	if r := locations[name].InstallRoot; r != "" {
+		return filepath.Clean(r)
+	}
+	if defaultRoot != "" {
+		return filepath.Clean(defaultRoot)
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/googet/oswrap"
+)
+
+func TestLocations(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+	defer func() {
+		defaultRoot = ""
+		locations = make(map[string]Location)
+	}()
+
+	bigCache := filepath.Join(tempDir, "big")
+	SetInstallRoot(filepath.Join(tempDir, "root"))
+	SetLocation("big", Location{CacheDir: bigCache, InstallRoot: filepath.Join(tempDir, "data")})
+
+	for _, tt := range []struct {
+		name, cache, root string
+	}{
+		{"big", bigCache, filepath.Join(tempDir, "data")},
+		{"small", "cache", filepath.Join(tempDir, "root")},
+	} {
+		got, err := packageCache(tt.name, "cache")
+		if err != nil {
+			t.Fatalf("packageCache(%q): %v", tt.name, err)
+		}
+		if got != tt.cache {
+			t.Errorf("packageCache(%q) = %q, want %q", tt.name, got, tt.cache)
+		}
+		if got := installRoot(tt.name); got != tt.root {
+			t.Errorf("installRoot(%q) = %q, want %q", tt.name, got, tt.root)
+		}
+	}
+	if _, err := oswrap.Stat(bigCache); err != nil {
+		t.Errorf("packageCache did not create %s: %v", bigCache, err)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+	"github.com/google/googet/system"
+	"github.com/google/logger"
+)
+
+// diskSpace returns the volume of a path and its free space, it is replaced
+// in tests.
+var diskSpace = system.DiskSpace
+
+// SpaceError is returned when a volume does not have enough free space for
+// an install, it is checked before anything is written to the volume.
+type SpaceError struct {
+	Path       string
+	Need, Free uint64
+}
+
+func (e *SpaceError) Error() string {
+	return fmt.Sprintf("not enough free space for %s: %s needed but only %s available on its volume", e.Path, humanize.IBytes(e.Need), humanize.IBytes(e.Free))
+}
+
+// checkSpace returns a SpaceError if a volume does not have the space needed
+// for the bytes that need maps to paths on it. Volumes whose free space
+// cannot be determined are not checked.
+func checkSpace(need map[string]uint64) error {
+	var paths []string
+	for p, n := range need {
+		if n > 0 {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	type volume struct {
+		path       string
+		need, free uint64
+	}
+	vols := make(map[string]*volume)
+	var ids []string
+	for _, p := range paths {
+		id, free, err := diskSpace(p)
+		if err != nil {
+			logger.Infof("Not checking free space for %q: %v", p, err)
+			continue
+		}
+		v, ok := vols[id]
+		if !ok {
+			v = &volume{path: p, free: free}
+			vols[id] = v
+			ids = append(ids, id)
+		}
+		v.need += need[p]
+	}
+	for _, id := range ids {
+		if v := vols[id]; v.need > v.free {
+			return &SpaceError{Path: v.path, Need: v.need, Free: v.free}
+		}
+	}
+	return nil
+}
+
+// cacheSpace returns the space needed in the cache to download a package of
+// the given size and extract the files listed in its spec.
+func cacheSpace(cache string, size int64, ps *goolib.PkgSpec) map[string]uint64 {
+	return map[string]uint64{cache: uint64(size + ps.InstalledSize)}
+}
+
+// filesSpace returns the space needed at each destination of the files of
+// the package unpacked in dir, installed under root.
+func filesSpace(dir string, ps *goolib.PkgSpec, root string) (map[string]uint64, error) {
+	need := make(map[string]uint64)
+	for _, files := range []map[string]string{ps.Files, ps.ConfigFiles} {
+		cs, err := fileCopies(dir, files, root, ps.UserScope())
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range cs {
+			dst := c.dst
+			if c.base != "" {
+				dst = c.base
+			}
+			err := oswrap.Walk(c.src, func(_ string, fi os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if fi.Mode().IsRegular() {
+					need[dst] += uint64(fi.Size())
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return need, nil
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+)
+
+func TestCheckSpace(t *testing.T) {
+	defer func(f func(string) (string, uint64, error)) { diskSpace = f }(diskSpace)
+	diskSpace = func(p string) (string, uint64, error) {
+		switch {
+		case strings.HasPrefix(p, "/a"):
+			return "a", 100, nil
+		case strings.HasPrefix(p, "/b"):
+			return "b", 50, nil
+		}
+		return "", 0, errors.New("unknown volume")
+	}
+
+	for _, tt := range []struct {
+		need map[string]uint64
+		want error
+	}{
+		{map[string]uint64{"/a/1": 60, "/b/1": 50}, nil},
+		{map[string]uint64{"/a/1": 60, "/a/2": 60}, &SpaceError{Path: "/a/1", Need: 120, Free: 100}},
+		{map[string]uint64{"/b/1": 51}, &SpaceError{Path: "/b/1", Need: 51, Free: 50}},
+		{map[string]uint64{"/c/1": 1000}, nil},
+	} {
+		if got := checkSpace(tt.need); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("checkSpace(%v) = %v, want %v", tt.need, got, tt.want)
+		}
+	}
+}
+
+func TestFilesSpace(t *testing.T) {
+	src, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(src)
+	for name, size := range map[string]int{"bin/tool": 10, "bin/lib/dep": 20, "conf/tool.conf": 5} {
+		p := filepath.Join(src, name)
+		if err := oswrap.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+		if err := ioutil.WriteFile(p, make([]byte, size), 0644); err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+	}
+
+	ps := &goolib.PkgSpec{
+		Files:       map[string]string{"bin": "/opt/tool"},
+		ConfigFiles: map[string]string{"conf": "/etc/tool"},
+	}
+	got, err := filesSpace(src, ps, "")
+	if err != nil {
+		t.Fatalf("filesSpace: %v", err)
+	}
+	want := map[string]uint64{"/opt/tool": 30, "/etc/tool": 5}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filesSpace() = %v, want %v", got, want)
+	}
+}
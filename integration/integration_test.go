@@ -0,0 +1,244 @@
+//go:build integration
+// +build integration
+
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package integration runs the googet binary against a gooserve repo of
+// generated packages. The tests build both binaries and only run with the
+// integration build tag:
+//
+//	go test -tags integration ./integration
+package integration
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/system"
+	"github.com/google/googet/testutil"
+	"github.com/google/logger"
+)
+
+func init() {
+	logger.Init("test", true, false, ioutil.Discard)
+}
+
+// build builds the main package pkg into dir and returns the binary path.
+func build(t *testing.T, dir, pkg string) string {
+	t.Helper()
+	bin := filepath.Join(dir, filepath.Base(pkg))
+	if runtime.GOOS == "windows" {
+		bin += ".exe"
+	}
+	if out, err := exec.Command("go", "build", "-o", bin, pkg).CombinedOutput(); err != nil {
+		t.Fatalf("error building %s: %v\n%s", pkg, err, out)
+	}
+	return bin
+}
+
+// freePort returns a TCP port that is free at the time of the call.
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// harness is a googet root and a gooserve repo to run googet against.
+type harness struct {
+	t        *testing.T
+	googet   string
+	root     string
+	packages string
+	repo     string
+}
+
+func newHarness(t *testing.T, dir string) (*harness, func()) {
+	bins := filepath.Join(dir, "bin")
+	h := &harness{
+		t:        t,
+		googet:   build(t, bins, "github.com/google/googet"),
+		root:     filepath.Join(dir, "root"),
+		packages: filepath.Join(dir, "repo", "packages"),
+	}
+	gooserve := build(t, bins, "github.com/google/googet/server")
+	for _, d := range []string{h.root, h.packages} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Always fetch the index, packages are added while the tests run.
+	if err := ioutil.WriteFile(filepath.Join(h.root, "googet.conf"), []byte("cachelife: 0s\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	port := freePort(t)
+	cmd := exec.Command(gooserve, "-root", filepath.Dir(h.packages), "-port", fmt.Sprint(port), "-interval", "200ms")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("error starting gooserve: %v", err)
+	}
+	h.repo = fmt.Sprintf("http://127.0.0.1:%d/repo", port)
+	for i := 0; ; i++ {
+		res, err := http.Get(h.repo + "/index")
+		if err == nil {
+			res.Body.Close()
+			break
+		}
+		if i == 50 {
+			cmd.Process.Kill()
+			t.Fatalf("gooserve did not start: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return h, func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+}
+
+// publish adds a package to the repo and waits for gooserve to index it.
+func (h *harness) publish(spec *goolib.PkgSpec, files map[string]string) {
+	h.t.Helper()
+	testutil.GenGoo(h.t, h.packages, spec, files)
+	for i := 0; i < 50; i++ {
+		res, err := http.Get(h.repo + "/index")
+		if err == nil {
+			b, _ := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			if strings.Contains(string(b), `"Version": "`+spec.Version+`"`) {
+				return
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	h.t.Fatalf("gooserve did not index %s.%s.%s", spec.Name, spec.Arch, spec.Version)
+}
+
+// run runs googet with args and fails the test if it does not succeed.
+func (h *harness) run(args ...string) string {
+	h.t.Helper()
+	args = append([]string{"-root", h.root, "-noconfirm", "-system_log=false"}, args...)
+	out, err := exec.Command(h.googet, args...).CombinedOutput()
+	if err != nil {
+		h.t.Fatalf("googet %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+func (h *harness) state() client.GooGetState {
+	h.t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join(h.root, "googet.state"))
+	if err != nil {
+		h.t.Fatalf("error reading state: %v", err)
+	}
+	s, err := client.UnmarshalState(b)
+	if err != nil {
+		h.t.Fatalf("error reading state: %v", err)
+	}
+	return *s
+}
+
+// pkgSpec returns the spec of version ver of the test package, which
+// installs its files into dst. On Windows it has an installer, so it gets an
+// uninstall entry.
+func pkgSpec(ver, dst string) (*goolib.PkgSpec, map[string]string) {
+	spec := &goolib.PkgSpec{
+		Name:    "integration-test",
+		Arch:    "noarch",
+		Version: ver,
+		Files:   map[string]string{"files": dst},
+	}
+	files := map[string]string{"files/version.txt": ver}
+	if runtime.GOOS == "windows" {
+		spec.Install = goolib.ExecFile{Path: "install.ps1"}
+		files["install.ps1"] = "exit 0"
+	}
+	return spec, files
+}
+
+func hasUninstallEntry(t *testing.T, name string) bool {
+	t.Helper()
+	entries, err := system.UninstallEntries(false)
+	if err != nil {
+		t.Fatalf("error reading uninstall entries: %v", err)
+	}
+	return goolib.ContainsString(name, entries)
+}
+
+func TestInstallUpdateVerifyRemove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "googet-integration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	h, stop := newHarness(t, dir)
+	defer stop()
+
+	dst := filepath.Join(dir, "installed")
+	file := filepath.Join(dst, "version.txt")
+	spec, files := pkgSpec("1.0.0@1", dst)
+	h.publish(spec, files)
+
+	h.run("install", "-sources", h.repo, spec.Name)
+	s := h.state()
+	if len(s) != 1 || s[0].PackageSpec.Version != "1.0.0@1" {
+		t.Fatalf("state after install = %+v, want %s 1.0.0@1", s, spec.Name)
+	}
+	if b, err := ioutil.ReadFile(file); err != nil || string(b) != "1.0.0@1" {
+		t.Fatalf("installed file = %q, %v, want %q", b, err, "1.0.0@1")
+	}
+	if runtime.GOOS == "windows" && !hasUninstallEntry(t, spec.Name) {
+		t.Error("install did not add an uninstall entry")
+	}
+
+	spec, files = pkgSpec("2.0.0@1", dst)
+	h.publish(spec, files)
+	h.run("update", "-sources", h.repo)
+	s = h.state()
+	if len(s) != 1 || s[0].PackageSpec.Version != "2.0.0@1" {
+		t.Fatalf("state after update = %+v, want %s 2.0.0@1", s, spec.Name)
+	}
+	if b, err := ioutil.ReadFile(file); err != nil || string(b) != "2.0.0@1" {
+		t.Fatalf("updated file = %q, %v, want %q", b, err, "2.0.0@1")
+	}
+
+	h.run("verify")
+
+	h.run("remove", spec.Name)
+	if s := h.state(); len(s) != 0 {
+		t.Errorf("state after remove = %+v, want no packages", s)
+	}
+	for _, p := range []string{file, dst} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s still exists after remove", p)
+		}
+	}
+	if runtime.GOOS == "windows" && hasUninstallEntry(t, spec.Name) {
+		t.Error("remove did not delete the uninstall entry")
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ipc serves read-only GooGet state over a local socket so that GUIs
+// and monitoring agents can query a running GooGet without parsing its output.
+//
+// The following endpoints are served as JSON over HTTP:
+//
+//	/installed  the installed package state
+//	/operation  the operation the serving GooGet process is performing
+package ipc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/oswrap"
+	"github.com/google/logger"
+)
+
+// Operation describes the operation being performed by a GooGet process.
+type Operation struct {
+	PID     int
+	Command string
+	Args    []string
+	Start   time.Time
+}
+
+// Server serves GooGet state on a local socket.
+type Server struct {
+	sock, stateFile string
+	op              Operation
+	l               net.Listener
+	srv             *http.Server
+}
+
+// Listen starts serving state read from stateFile and the provided operation
+// on a unix domain socket at sock. Any stale socket at sock is removed.
+func Listen(sock, stateFile string, op Operation) (*Server, error) {
+	if err := oswrap.Remove(sock); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{sock: sock, stateFile: stateFile, op: op, l: l}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/installed", s.installed)
+	mux.HandleFunc("/operation", s.operation)
+	s.srv = &http.Server{Handler: mux}
+	go func() {
+		if err := s.srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			logger.Errorf("Error serving state on %q: %v", sock, err)
+		}
+	}()
+	return s, nil
+}
+
+// Close stops the server and removes its socket.
+func (s *Server) Close() error {
+	err := s.srv.Close()
+	if rmErr := oswrap.Remove(s.sock); rmErr != nil && !os.IsNotExist(rmErr) && err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+func (s *Server) installed(w http.ResponseWriter, r *http.Request) {
+	state := &client.GooGetState{}
+	b, err := ioutil.ReadFile(s.stateFile)
+	if err != nil && !os.IsNotExist(err) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		if state, err = client.UnmarshalState(b); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	writeJSON(w, state)
+}
+
+func (s *Server) operation(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.op)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
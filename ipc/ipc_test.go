@@ -0,0 +1,85 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+)
+
+func TestServer(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(tempDir)
+
+	state := &client.GooGetState{{PackageSpec: &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "1.2.3@4"}}}
+	b, err := state.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf := filepath.Join(tempDir, "googet.state")
+	if err := ioutil.WriteFile(sf, b, 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	sock := filepath.Join(tempDir, "googet.sock")
+	op := Operation{PID: 1, Command: "install", Args: []string{"foo"}, Start: time.Unix(0, 0).UTC()}
+	s, err := Listen(sock, sf, op)
+	if err != nil {
+		t.Fatalf("error running Listen: %v", err)
+	}
+	defer s.Close()
+
+	c := &http.Client{Transport: &http.Transport{
+		Dial: func(_, _ string) (net.Conn, error) { return net.Dial("unix", sock) },
+	}}
+
+	var gotState client.GooGetState
+	get(t, c, "/installed", &gotState)
+	if !reflect.DeepEqual(&gotState, state) {
+		t.Errorf("did not get expected state, got: %+v, want: %+v", gotState, state)
+	}
+
+	var gotOp Operation
+	get(t, c, "/operation", &gotOp)
+	if !reflect.DeepEqual(gotOp, op) {
+		t.Errorf("did not get expected operation, got: %+v, want: %+v", gotOp, op)
+	}
+}
+
+func get(t *testing.T, c *http.Client, path string, v interface{}) {
+	res, err := c.Get("http://googet" + path)
+	if err != nil {
+		t.Fatalf("error getting %s: %v", path, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("%s returned status %q", path, res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		t.Fatalf("error decoding %s: %v", path, err)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metadata reads from the metadata server of Google Compute Engine
+// instances.
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// hostEnv overrides the metadata server address, as for other Google tools.
+const hostEnv = "GCE_METADATA_HOST"
+
+var httpClient = &http.Client{Timeout: 5 * time.Second}
+
+func baseURL() string {
+	host := os.Getenv(hostEnv)
+	if host == "" {
+		host = "metadata.google.internal"
+	}
+	return "http://" + host + "/computeMetadata/v1/"
+}
+
+// Get returns the metadata value at path, such as "instance/id".
+func Get(path string) (string, error) {
+	req, err := http.NewRequest("GET", baseURL()+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata %s returned status: %q", path, res.Status)
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Token returns an OAuth2 access token of the default service account of the
+// instance.
+func Token() (string, error) {
+	s, err := Get("instance/service-accounts/default/token")
+	if err != nil {
+		return "", err
+	}
+	var t struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal([]byte(s), &t); err != nil {
+		return "", fmt.Errorf("error decoding token: %v", err)
+	}
+	if t.AccessToken == "" {
+		return "", fmt.Errorf("metadata server returned no access token")
+	}
+	return t.AccessToken, nil
+}
+
+// MachineID returns the instance ID, or the host name on machines that are
+// not Compute Engine instances.
+func MachineID() (string, error) {
+	if id, err := Get("instance/id"); err == nil && id != "" {
+		return id, nil
+	}
+	return os.Hostname()
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "missing Metadata-Flavor", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/computeMetadata/v1/instance/id":
+			w.Write([]byte("1234"))
+		case "/computeMetadata/v1/instance/service-accounts/default/token":
+			w.Write([]byte(`{"access_token":"tok","expires_in":3599,"token_type":"Bearer"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	defer os.Setenv(hostEnv, os.Getenv(hostEnv))
+	os.Setenv(hostEnv, strings.TrimPrefix(ts.URL, "http://"))
+
+	if id, err := MachineID(); err != nil || id != "1234" {
+		t.Errorf("MachineID() = %q, %v, want %q", id, err, "1234")
+	}
+	if tok, err := Token(); err != nil || tok != "tok" {
+		t.Errorf("Token() = %q, %v, want %q", tok, err, "tok")
+	}
+	if _, err := Get("instance/missing"); err == nil {
+		t.Error("Get of a missing value returned no error")
+	}
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package msg holds the catalog of user-facing GooGet messages. Each message
+// has an ID that stays the same across languages and releases, so tools can
+// key off the ID instead of the English text.
+package msg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ID identifies a message in the catalog.
+type ID string
+
+// Messages printed by install, remove, update and verify.
+const (
+	Confirm             ID = "confirm"
+	InstallConfirm      ID = "install.confirm"
+	InstallFileConfirm  ID = "install.file.confirm"
+	InstallMatchConfirm ID = "install.match.confirm"
+	InstallCanceled     ID = "install.canceled"
+	InstallStart        ID = "install.start"
+	InstallDone         ID = "install.done"
+	InstallFileStart    ID = "install.file.start"
+	InstallFileDone     ID = "install.file.done"
+	AlreadyInstalled    ID = "install.already_installed"
+	NotInstalling       ID = "install.skipped"
+	ReinstallConfirm    ID = "reinstall.confirm"
+	NotReinstalling     ID = "reinstall.skipped"
+	ReinstallStart      ID = "reinstall.start"
+	ReinstallDone       ID = "reinstall.done"
+	ReinstallFileDone   ID = "reinstall.file.done"
+	UpdateInstalled     ID = "install.update_installed"
+	UpdateNotApplicable ID = "install.update_not_applicable"
+	RemoveConfirm       ID = "remove.confirm"
+	RemoveCanceled      ID = "remove.canceled"
+	RemoveStart         ID = "remove.start"
+	RemoveDone          ID = "remove.done"
+	NoPackages          ID = "update.no_packages"
+	UpdateSearching     ID = "update.searching"
+	NoUpdates           ID = "update.none"
+	UpdateConfirm       ID = "update.confirm"
+	NotUpdating         ID = "update.canceled"
+	Replaced            ID = "update.replaced"
+	UpdateRetry         ID = "update.retry"
+	UpdateSummary       ID = "update.summary"
+	VerifyNone          ID = "verify.none"
+	VerifyPackage       ID = "verify.package"
+	VerifyFile          ID = "verify.file"
+	VerifyError         ID = "verify.error"
+	VerifySummary       ID = "verify.summary"
+	DownloadProgress    ID = "download.progress"
+)
+
+// Messages summarizing what an install or update run changed.
+const (
+	SummaryChanged  ID = "summary.changed"
+	SummaryReboot   ID = "summary.reboot"
+	SummaryServices ID = "summary.services"
+	SummaryWarning  ID = "summary.warning"
+	SummaryLogs     ID = "summary.logs"
+	SummaryDeferred ID = "summary.deferred"
+)
+
+// Messages printed by resume-postreboot.
+const (
+	PostRebootNone    ID = "postreboot.none"
+	PostRebootWaiting ID = "postreboot.waiting"
+	PostRebootDone    ID = "postreboot.done"
+	PostRebootFailed  ID = "postreboot.failed"
+)
+
+// catalog maps languages, as ISO 639-1 codes, to their messages. Messages
+// use explicit argument indexes so translations can reorder them. English
+// is the fallback for languages and messages that are not translated.
+var catalog = map[string]map[ID]string{
+	"en": {
+		Confirm:             "%[1]s (y/N): ",
+		InstallConfirm:      "Do you wish to install %[1]s.%[2]s.%[3]s and all dependencies?",
+		InstallFileConfirm:  "Install %[1]s?",
+		InstallMatchConfirm: "Install the packages matching %[1]s: %[2]s?",
+		InstallCanceled:     "canceling install...",
+		InstallStart:        "Installing %[1]s.%[2]s.%[3]s and dependencies...",
+		InstallDone:         "Installation of %[1]s.%[2]s.%[3]s and all dependencies completed",
+		InstallFileStart:    "Installing %[1]s %[2]s...",
+		InstallFileDone:     "Installation of %[1]s completed",
+		AlreadyInstalled:    "%[1]s.%[2]s.%[3]s or a newer version is already installed on the system",
+		NotInstalling:       "Not installing %[1]s...",
+		ReinstallConfirm:    "Reinstall %[1]s?",
+		NotReinstalling:     "Not reinstalling %[1]s...",
+		ReinstallStart:      "Reinstalling %[1]s.%[2]s %[3]s and dependencies...",
+		ReinstallDone:       "Reinstallation of %[1]s.%[2]s %[3]s completed",
+		ReinstallFileDone:   "Reinstallation of %[1]s completed",
+		UpdateInstalled:     "%[1]s is already installed.",
+		UpdateNotApplicable: "%[1]s is not applicable to this system, nothing to install.",
+		RemoveConfirm:       "Do you wish to remove %[1]s and all dependencies?",
+		RemoveCanceled:      "canceling removal...",
+		RemoveStart:         "Removing %[1]s and all dependencies...",
+		RemoveDone:          "Removal of %[1]s completed",
+		NoPackages:          "No packages installed.",
+		UpdateSearching:     "Searching for available updates...",
+		NoUpdates:           "No updates available for any installed packages.",
+		UpdateConfirm:       "Perform update?",
+		NotUpdating:         "Not updating.",
+		Replaced:            "Replaced %[1]s with %[2]s",
+		UpdateRetry:         "Retrying %[1]s.%[2]s.%[3]s after a transient failure...",
+		UpdateSummary:       "%[1]d packages updated, %[2]d failed",
+		VerifyNone:          "No packages to verify.",
+		VerifyPackage:       "%[1]s.%[2]s.%[3]s: %[4]s",
+		VerifyFile:          "  %[1]s: %[2]s",
+		VerifyError:         "  %[1]s",
+		VerifySummary:       "%[1]d packages verified: %[2]d ok, %[3]d modified, %[4]d missing, %[5]d script-failed",
+		DownloadProgress:    "Downloading %[1]s: %[2]s of %[3]s",
+		SummaryChanged:      "%[1]d packages changed: %[2]s",
+		SummaryReboot:       "A reboot is needed to finish installing: %[1]s",
+		SummaryServices:     "Services restarted: %[1]s",
+		SummaryWarning:      "Warning from %[1]s: %[2]s",
+		SummaryLogs:         "Logs: %[1]s",
+		SummaryDeferred:     "Actions run after the next reboot: %[1]s",
+		PostRebootNone:      "No post-reboot actions pending.",
+		PostRebootWaiting:   "%[1]s.%[2]s.%[3]s was installed after the last reboot, its action runs after the next one",
+		PostRebootDone:      "Post-reboot action of %[1]s.%[2]s.%[3]s completed",
+		PostRebootFailed:    "Post-reboot action of %[1]s.%[2]s.%[3]s failed (attempt %[4]d): %[5]s",
+	},
+	"de": {
+		Confirm:             "%[1]s (y/N): ",
+		InstallConfirm:      "Möchten Sie %[1]s.%[2]s.%[3]s und alle Abhängigkeiten installieren?",
+		InstallFileConfirm:  "%[1]s installieren?",
+		InstallMatchConfirm: "Die zu %[1]s passenden Pakete installieren: %[2]s?",
+		InstallCanceled:     "Installation wird abgebrochen...",
+		InstallStart:        "%[1]s.%[2]s.%[3]s und Abhängigkeiten werden installiert...",
+		InstallDone:         "Installation von %[1]s.%[2]s.%[3]s und allen Abhängigkeiten abgeschlossen",
+		InstallFileStart:    "%[1]s %[2]s wird installiert...",
+		InstallFileDone:     "Installation von %[1]s abgeschlossen",
+		AlreadyInstalled:    "%[1]s.%[2]s.%[3]s oder eine neuere Version ist bereits installiert",
+		NotInstalling:       "%[1]s wird nicht installiert...",
+		ReinstallConfirm:    "%[1]s neu installieren?",
+		NotReinstalling:     "%[1]s wird nicht neu installiert...",
+		ReinstallStart:      "%[1]s.%[2]s %[3]s und Abhängigkeiten werden neu installiert...",
+		ReinstallDone:       "Neuinstallation von %[1]s.%[2]s %[3]s abgeschlossen",
+		ReinstallFileDone:   "Neuinstallation von %[1]s abgeschlossen",
+		UpdateInstalled:     "%[1]s ist bereits installiert.",
+		UpdateNotApplicable: "%[1]s ist für dieses System nicht anwendbar, nichts zu installieren.",
+		RemoveConfirm:       "Möchten Sie %[1]s und alle Abhängigkeiten entfernen?",
+		RemoveCanceled:      "Entfernen wird abgebrochen...",
+		RemoveStart:         "%[1]s und alle Abhängigkeiten werden entfernt...",
+		RemoveDone:          "Entfernen von %[1]s abgeschlossen",
+		NoPackages:          "Keine Pakete installiert.",
+		UpdateSearching:     "Suche nach verfügbaren Updates...",
+		NoUpdates:           "Für keines der installierten Pakete sind Updates verfügbar.",
+		UpdateConfirm:       "Update durchführen?",
+		NotUpdating:         "Kein Update.",
+		Replaced:            "%[1]s durch %[2]s ersetzt",
+		UpdateRetry:         "%[1]s.%[2]s.%[3]s wird nach einem vorübergehenden Fehler erneut versucht...",
+		UpdateSummary:       "%[1]d Pakete aktualisiert, %[2]d fehlgeschlagen",
+		VerifyNone:          "Keine Pakete zu überprüfen.",
+		VerifySummary:       "%[1]d Pakete überprüft: %[2]d ok, %[3]d geändert, %[4]d fehlend, %[5]d Skript fehlgeschlagen",
+		DownloadProgress:    "%[1]s wird heruntergeladen: %[2]s von %[3]s",
+		SummaryChanged:      "%[1]d Pakete geändert: %[2]s",
+		SummaryReboot:       "Ein Neustart ist nötig, um die Installation abzuschließen: %[1]s",
+		SummaryServices:     "Neu gestartete Dienste: %[1]s",
+		SummaryWarning:      "Warnung von %[1]s: %[2]s",
+		SummaryLogs:         "Protokolle: %[1]s",
+		SummaryDeferred:     "Aktionen nach dem nächsten Neustart: %[1]s",
+		PostRebootNone:      "Keine Aktionen nach dem Neustart ausstehend.",
+		PostRebootWaiting:   "%[1]s.%[2]s.%[3]s wurde nach dem letzten Neustart installiert, die Aktion läuft nach dem nächsten",
+		PostRebootDone:      "Aktion nach dem Neustart von %[1]s.%[2]s.%[3]s abgeschlossen",
+		PostRebootFailed:    "Aktion nach dem Neustart von %[1]s.%[2]s.%[3]s fehlgeschlagen (Versuch %[4]d): %[5]s",
+	},
+	"fr": {
+		Confirm:             "%[1]s (y/N) : ",
+		InstallConfirm:      "Voulez-vous installer %[1]s.%[2]s.%[3]s et toutes ses dépendances ?",
+		InstallFileConfirm:  "Installer %[1]s ?",
+		InstallMatchConfirm: "Installer les paquets correspondant à %[1]s : %[2]s ?",
+		InstallCanceled:     "annulation de l'installation...",
+		InstallStart:        "Installation de %[1]s.%[2]s.%[3]s et de ses dépendances...",
+		InstallDone:         "Installation de %[1]s.%[2]s.%[3]s et de toutes ses dépendances terminée",
+		InstallFileStart:    "Installation de %[1]s %[2]s...",
+		InstallFileDone:     "Installation de %[1]s terminée",
+		AlreadyInstalled:    "%[1]s.%[2]s.%[3]s ou une version plus récente est déjà installé sur le système",
+		NotInstalling:       "%[1]s n'est pas installé...",
+		ReinstallConfirm:    "Réinstaller %[1]s ?",
+		NotReinstalling:     "%[1]s n'est pas réinstallé...",
+		ReinstallStart:      "Réinstallation de %[1]s.%[2]s %[3]s et de ses dépendances...",
+		ReinstallDone:       "Réinstallation de %[1]s.%[2]s %[3]s terminée",
+		ReinstallFileDone:   "Réinstallation de %[1]s terminée",
+		UpdateInstalled:     "%[1]s est déjà installé.",
+		UpdateNotApplicable: "%[1]s ne s'applique pas à ce système, rien à installer.",
+		RemoveConfirm:       "Voulez-vous supprimer %[1]s et toutes ses dépendances ?",
+		RemoveCanceled:      "annulation de la suppression...",
+		RemoveStart:         "Suppression de %[1]s et de toutes ses dépendances...",
+		RemoveDone:          "Suppression de %[1]s terminée",
+		NoPackages:          "Aucun paquet installé.",
+		UpdateSearching:     "Recherche des mises à jour disponibles...",
+		NoUpdates:           "Aucune mise à jour disponible pour les paquets installés.",
+		UpdateConfirm:       "Effectuer la mise à jour ?",
+		NotUpdating:         "Pas de mise à jour.",
+		Replaced:            "%[1]s remplacé par %[2]s",
+		UpdateRetry:         "Nouvel essai de %[1]s.%[2]s.%[3]s après un échec temporaire...",
+		UpdateSummary:       "%[1]d paquets mis à jour, %[2]d échecs",
+		VerifyNone:          "Aucun paquet à vérifier.",
+		VerifySummary:       "%[1]d paquets vérifiés : %[2]d ok, %[3]d modifiés, %[4]d manquants, %[5]d échecs de script",
+		DownloadProgress:    "Téléchargement de %[1]s : %[2]s sur %[3]s",
+		SummaryChanged:      "%[1]d paquets modifiés : %[2]s",
+		SummaryReboot:       "Un redémarrage est nécessaire pour terminer l'installation : %[1]s",
+		SummaryServices:     "Services redémarrés : %[1]s",
+		SummaryWarning:      "Avertissement de %[1]s : %[2]s",
+		SummaryLogs:         "Journaux : %[1]s",
+		SummaryDeferred:     "Actions exécutées après le prochain redémarrage : %[1]s",
+		PostRebootNone:      "Aucune action après redémarrage en attente.",
+		PostRebootWaiting:   "%[1]s.%[2]s.%[3]s a été installé après le dernier redémarrage, son action s'exécute après le prochain",
+		PostRebootDone:      "Action après redémarrage de %[1]s.%[2]s.%[3]s terminée",
+		PostRebootFailed:    "Échec de l'action après redémarrage de %[1]s.%[2]s.%[3]s (tentative %[4]d) : %[5]s",
+	},
+}
+
+var lang = "en"
+
+// SetLocale selects the language of messages from a locale such as
+// "de_DE.UTF-8" or "fr-FR". Locales without a translation use English.
+func SetLocale(locale string) {
+	lang = "en"
+	l := strings.ToLower(locale)
+	if i := strings.IndexAny(l, "_-.@"); i != -1 {
+		l = l[:i]
+	}
+	if _, ok := catalog[l]; ok {
+		lang = l
+	}
+}
+
+// Sprintf returns the message id, formatted with a, in the selected
+// language.
+func Sprintf(id ID, a ...interface{}) string {
+	f, ok := catalog[lang][id]
+	if !ok {
+		f, ok = catalog["en"][id]
+	}
+	if !ok {
+		return fmt.Sprintf("%s %v", id, a)
+	}
+	return fmt.Sprintf(f, a...)
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package msg
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+func TestSetLocale(t *testing.T) {
+	defer SetLocale("en")
+	for _, tt := range []struct{ locale, lang string }{
+		{"de_DE.UTF-8", "de"},
+		{"fr-FR", "fr"},
+		{"FR", "fr"},
+		{"C", "en"},
+		{"", "en"},
+		{"xx_YY", "en"},
+	} {
+		SetLocale(tt.locale)
+		if lang != tt.lang {
+			t.Errorf("SetLocale(%q) selected %q, want %q", tt.locale, lang, tt.lang)
+		}
+	}
+}
+
+func TestSprintf(t *testing.T) {
+	defer SetLocale("en")
+	SetLocale("de")
+	if got, want := Sprintf(RemoveDone, "foo"), "Entfernen von foo abgeschlossen"; got != want {
+		t.Errorf("Sprintf(RemoveDone) = %q, want %q", got, want)
+	}
+	// Untranslated messages fall back to English.
+	if got, want := Sprintf(VerifyFile, "missing", "/foo"), "  missing: /foo"; got != want {
+		t.Errorf("Sprintf(VerifyFile) = %q, want %q", got, want)
+	}
+	if got, want := Sprintf(ID("unknown"), 1), "unknown [1]"; got != want {
+		t.Errorf("Sprintf(unknown) = %q, want %q", got, want)
+	}
+}
+
+var argRe = regexp.MustCompile(`%\[\d+\]`)
+
+// TestCatalog checks that translations only have messages English has, and
+// use the same arguments.
+func TestCatalog(t *testing.T) {
+	args := func(s string) []string {
+		a := argRe.FindAllString(s, -1)
+		sort.Strings(a)
+		return a
+	}
+	for l, msgs := range catalog {
+		for id, s := range msgs {
+			en, ok := catalog["en"][id]
+			if !ok {
+				t.Errorf("%s message %q has no English version", l, id)
+				continue
+			}
+			if !reflect.DeepEqual(args(s), args(en)) {
+				t.Errorf("%s message %q uses arguments %v, English uses %v", l, id, args(s), args(en))
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package msg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+// Reporter receives the user-facing output of GooGet library calls, so
+// programs embedding them decide what is shown to whom.
+type Reporter interface {
+	// Info reports the message id formatted with a.
+	Info(id ID, a ...interface{})
+	// Progress reports that done bytes of name have been processed, out of
+	// total or an unknown amount if total is 0.
+	Progress(name string, done, total int64)
+	// Confirm asks the question id formatted with a and reports whether
+	// the answer is yes.
+	Confirm(id ID, a ...interface{}) bool
+}
+
+// Discard is a Reporter that shows nothing and answers no to every
+// question.
+var Discard Reporter = discard{}
+
+type discard struct{}
+
+func (discard) Info(ID, ...interface{})         {}
+func (discard) Progress(string, int64, int64)   {}
+func (discard) Confirm(ID, ...interface{}) bool { return false }
+
+// progressInterval is the least time between two progress updates.
+const progressInterval = time.Second
+
+// Console is the Reporter of the googet command line. It writes messages to
+// Out, one per line, and reads answers to questions from In.
+type Console struct {
+	Out io.Writer
+	In  io.Reader
+	// JSON writes messages as JSON lines holding the message ID and
+	// arguments along with the text.
+	JSON bool
+	// Terminal shows progress, overwriting the same line, when messages
+	// are not written as JSON.
+	Terminal bool
+
+	lastProgress time.Time
+}
+
+// NewConsole returns a Console on stdin and stdout.
+func NewConsole() *Console {
+	c := &Console{Out: os.Stdout, In: os.Stdin}
+	if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		c.Terminal = true
+	}
+	return c
+}
+
+// message is the JSON form of a message.
+type message struct {
+	ID      ID
+	Message string
+	Args    []string `json:",omitempty"`
+}
+
+// Info writes the message to Out on its own line.
+func (c *Console) Info(id ID, a ...interface{}) {
+	s := Sprintf(id, a...)
+	if !c.JSON {
+		fmt.Fprintln(c.Out, s)
+		return
+	}
+	m := message{ID: id, Message: strings.TrimSpace(s)}
+	for _, v := range a {
+		m.Args = append(m.Args, fmt.Sprint(v))
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		fmt.Fprintln(c.Out, s)
+		return
+	}
+	fmt.Fprintln(c.Out, string(b))
+}
+
+// Progress writes a progress message at most once every progressInterval,
+// and once done reaches total. Without JSON it is only written to a
+// terminal.
+func (c *Console) Progress(name string, done, total int64) {
+	if !c.JSON && !c.Terminal {
+		return
+	}
+	finished := total > 0 && done >= total
+	if !finished && time.Since(c.lastProgress) < progressInterval {
+		return
+	}
+	c.lastProgress = time.Now()
+	of := "?"
+	if total > 0 {
+		of = humanize.IBytes(uint64(total))
+	}
+	if c.JSON {
+		c.Info(DownloadProgress, name, humanize.IBytes(uint64(done)), of)
+		return
+	}
+	fmt.Fprintf(c.Out, "\r%s\x1b[K", Sprintf(DownloadProgress, name, humanize.IBytes(uint64(done)), of))
+	if finished {
+		fmt.Fprintln(c.Out)
+	}
+}
+
+// Confirm writes the question followed by a y/N prompt and reads the answer
+// from In.
+func (c *Console) Confirm(id ID, a ...interface{}) bool {
+	fmt.Fprint(c.Out, Sprintf(Confirm, Sprintf(id, a...)))
+	var l string
+	fmt.Fscanln(c.In, &l)
+	l = strings.ToLower(l)
+	return l == "y" || l == "yes"
+}
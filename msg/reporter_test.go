@@ -0,0 +1,86 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package msg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConsoleInfo(t *testing.T) {
+	b := new(bytes.Buffer)
+	c := &Console{Out: b}
+
+	c.Info(Replaced, "foo", "bar")
+	c.JSON = true
+	c.Info(Replaced, "foo", "bar")
+	c.Info(NoUpdates)
+	want := `Replaced foo with bar
+{"ID":"update.replaced","Message":"Replaced foo with bar","Args":["foo","bar"]}
+{"ID":"update.none","Message":"No updates available for any installed packages."}
+`
+	if b.String() != want {
+		t.Errorf("Info wrote:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestConsoleProgress(t *testing.T) {
+	b := new(bytes.Buffer)
+	c := &Console{Out: b}
+	c.Progress("foo.goo", 1024, 2048)
+	if b.Len() != 0 {
+		t.Errorf("Progress wrote %q when not writing to a terminal", b.String())
+	}
+
+	c.JSON = true
+	c.Progress("foo.goo", 1024, 2048)
+	// Updates within progressInterval are dropped, unless done.
+	c.Progress("foo.goo", 1536, 2048)
+	c.Progress("foo.goo", 2048, 2048)
+	want := `{"ID":"download.progress","Message":"Downloading foo.goo: 1.0 KiB of 2.0 KiB","Args":["foo.goo","1.0 KiB","2.0 KiB"]}
+{"ID":"download.progress","Message":"Downloading foo.goo: 2.0 KiB of 2.0 KiB","Args":["foo.goo","2.0 KiB","2.0 KiB"]}
+`
+	if b.String() != want {
+		t.Errorf("Progress wrote:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestConsoleConfirm(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want bool
+	}{
+		{"y\n", true},
+		{"YES\n", true},
+		{"n\n", false},
+		{"\n", false},
+		{"", false},
+	} {
+		b := new(bytes.Buffer)
+		c := &Console{Out: b, In: strings.NewReader(tt.in)}
+		if got := c.Confirm(RemoveConfirm, "foo"); got != tt.want {
+			t.Errorf("Confirm with answer %q = %v, want %v", tt.in, got, tt.want)
+		}
+		if want := Sprintf(Confirm, Sprintf(RemoveConfirm, "foo")); b.String() != want {
+			t.Errorf("Confirm wrote %q, want %q", b.String(), want)
+		}
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	if Discard.Confirm(RemoveConfirm, "foo") {
+		t.Error("Discard.Confirm() = true, want false")
+	}
+}
@@ -55,6 +55,21 @@ func MkdirAll(name string, mode os.FileMode) error {
 	return os.MkdirAll(name, mode)
 }
 
+// Link calls os.Link
+func Link(oldname, newname string) error {
+	return os.Link(oldname, newname)
+}
+
+// Symlink calls os.Symlink
+func Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+// Readlink calls os.Readlink
+func Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
 // Rename calls os.Rename
 func Rename(oldpath, newpath string) error {
 	return os.Rename(oldpath, newpath)
@@ -106,6 +106,38 @@ func MkdirAll(name string, mode os.FileMode) error {
 	return os.MkdirAll(name, mode)
 }
 
+// Link calls os.Link with names normalized
+func Link(oldname, newname string) error {
+	oldname, err := normPath(oldname)
+	if err != nil {
+		return err
+	}
+	newname, err = normPath(newname)
+	if err != nil {
+		return err
+	}
+	return os.Link(oldname, newname)
+}
+
+// Symlink calls os.Symlink with newname normalized, oldname is kept as it
+// is so relative link targets stay relative
+func Symlink(oldname, newname string) error {
+	newname, err := normPath(newname)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(oldname, newname)
+}
+
+// Readlink calls os.Readlink with name normalized
+func Readlink(name string) (string, error) {
+	name, err := normPath(name)
+	if err != nil {
+		return "", err
+	}
+	return os.Readlink(name)
+}
+
 // Rename calls os.Rename with name normalized
 func Rename(oldpath, newpath string) error {
 	oldpath, err := normPath(oldpath)
@@ -0,0 +1,192 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package output writes the listings of GooGet commands in the formats
+// every listing command shares: simple lines, aligned tables or JSON, with
+// the fields to show selected by name.
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Formats are the output formats. Simple is each item on a line with its
+// fields separated by spaces, commands keep their own layout for it unless
+// fields are selected.
+const (
+	Simple = "simple"
+	Table  = "table"
+	JSON   = "json"
+)
+
+// Options are the -format and -fields flags of a listing command.
+type Options struct {
+	Format string
+	Fields string
+}
+
+// SetFlags registers the -format and -fields flags on f.
+func (o *Options) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&o.Format, "format", Simple, "output format, simple, table or json")
+	f.StringVar(&o.Fields, "fields", "", "comma separated list of the fields to output, all by default")
+}
+
+// Custom reports whether the options ask for anything but the command's
+// own simple layout.
+func (o Options) Custom() bool {
+	return o.Format != Simple || o.Fields != ""
+}
+
+// Writer collects items and writes them in the selected format on Flush.
+type Writer struct {
+	w      io.Writer
+	format string
+	fields []string
+	// cols are the indexes of the selected fields in an item.
+	cols  []int
+	items [][]interface{}
+}
+
+// NewWriter returns a Writer of items with the given fields to w, using
+// the format and fields selected by o. Field names are matched without
+// regard to case.
+func (o Options) NewWriter(w io.Writer, fields ...string) (*Writer, error) {
+	switch o.Format {
+	case Simple, Table, JSON:
+	default:
+		return nil, fmt.Errorf("unknown format %q, use simple, table or json", o.Format)
+	}
+	ow := &Writer{w: w, format: o.Format}
+	if o.Fields == "" {
+		for i, f := range fields {
+			ow.fields = append(ow.fields, f)
+			ow.cols = append(ow.cols, i)
+		}
+		return ow, nil
+	}
+	for _, sel := range strings.Split(o.Fields, ",") {
+		sel = strings.TrimSpace(sel)
+		i := index(fields, sel)
+		if i == -1 {
+			return nil, fmt.Errorf("unknown field %q, the fields are %s", sel, strings.Join(fields, ", "))
+		}
+		ow.fields = append(ow.fields, fields[i])
+		ow.cols = append(ow.cols, i)
+	}
+	return ow, nil
+}
+
+func index(fields []string, name string) int {
+	for i, f := range fields {
+		if strings.EqualFold(f, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Add adds an item, its values in the order of the fields given to
+// NewWriter.
+func (w *Writer) Add(values ...interface{}) {
+	item := make([]interface{}, len(w.cols))
+	for i, c := range w.cols {
+		if c < len(values) {
+			item[i] = values[c]
+		}
+	}
+	w.items = append(w.items, item)
+}
+
+// Flush writes the items added.
+func (w *Writer) Flush() error {
+	switch w.format {
+	case JSON:
+		return w.writeJSON()
+	case Table:
+		tw := tabwriter.NewWriter(w.w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(w.fields, "\t")))
+		for _, it := range w.items {
+			fmt.Fprintln(tw, strings.Join(text(it), "\t"))
+		}
+		return tw.Flush()
+	default:
+		for _, it := range w.items {
+			if _, err := fmt.Fprintln(w.w, strings.Join(text(it), " ")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// writeJSON writes the items as a list of objects, keeping the order of the
+// fields.
+func (w *Writer) writeJSON() error {
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i, it := range w.items {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n  {")
+		for j, v := range it {
+			if j > 0 {
+				buf.WriteString(", ")
+			}
+			k, _ := json.Marshal(w.fields[j])
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			buf.Write(k)
+			buf.WriteString(": ")
+			buf.Write(b)
+		}
+		buf.WriteString("}")
+	}
+	if len(w.items) > 0 {
+		buf.WriteString("\n")
+	}
+	buf.WriteString("]\n")
+	_, err := w.w.Write(buf.Bytes())
+	return err
+}
+
+// text formats the values of an item for the simple and table formats.
+// Only the first line of multiline values is kept and empty values are
+// shown as "-" so columns stay aligned.
+func text(item []interface{}) []string {
+	var s []string
+	for _, v := range item {
+		var t string
+		switch v := v.(type) {
+		case nil:
+		case []string:
+			t = strings.Join(v, ",")
+		default:
+			t = fmt.Sprint(v)
+		}
+		t = strings.SplitN(t, "\n", 2)[0]
+		if t == "" {
+			t = "-"
+		}
+		s = append(s, t)
+	}
+	return s
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package output
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	fields := []string{"Name", "Version", "Mirrors", "Description"}
+	add := func(w *Writer) {
+		w.Add("foo", "1.0.0@1", []string{"a", "b"}, "Foo tool\nmore")
+		w.Add("barbaz", "2.0.0@1", nil, "")
+	}
+	for _, tc := range []struct {
+		o    Options
+		want string
+	}{
+		{Options{Format: Simple}, "foo 1.0.0@1 a,b Foo tool\nbarbaz 2.0.0@1 - -\n"},
+		{Options{Format: Simple, Fields: "name,VERSION"}, "foo 1.0.0@1\nbarbaz 2.0.0@1\n"},
+		{Options{Format: Table, Fields: "Version,Name"}, "VERSION  NAME\n1.0.0@1  foo\n2.0.0@1  barbaz\n"},
+		{Options{Format: JSON, Fields: "Name,Mirrors"}, "[\n  {\"Name\": \"foo\", \"Mirrors\": [\"a\",\"b\"]},\n  {\"Name\": \"barbaz\", \"Mirrors\": null}\n]\n"},
+	} {
+		var buf bytes.Buffer
+		w, err := tc.o.NewWriter(&buf, fields...)
+		if err != nil {
+			t.Fatalf("NewWriter(%+v): %v", tc.o, err)
+		}
+		add(w)
+		if err := w.Flush(); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("%+v: got %q, want %q", tc.o, got, tc.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	w, err := Options{Format: JSON}.NewWriter(&buf, fields...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "[]\n"; got != want {
+		t.Errorf("JSON of no items = %q, want %q", got, want)
+	}
+
+	for _, o := range []Options{{Format: "xml"}, {Format: Table, Fields: "Name,Size"}} {
+		if _, err := o.NewWriter(&buf, fields...); err == nil {
+			t.Errorf("NewWriter(%+v) did not return an error", o)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remove
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/googet/goolib"
+)
+
+// protected are the names of the packages that are only removed when the
+// removal is forced.
+var protected = []string{"googet"}
+
+// SetProtected sets the names of the packages that are only removed when the
+// removal is forced, GooGet itself is always protected.
+func SetProtected(names []string) {
+	protected = append([]string{"googet"}, names...)
+}
+
+// IsProtected reports whether the package name is protected.
+func IsProtected(name string) bool {
+	return goolib.ContainsString(name, protected)
+}
+
+// ProtectedError is returned when a removal includes protected packages and
+// is not forced.
+type ProtectedError struct {
+	Packages []string
+}
+
+func (e *ProtectedError) Error() string {
+	return fmt.Sprintf("refusing to remove protected packages %v", e.Packages)
+}
+
+// Protected returns the packages in deps that are protected.
+func Protected(deps DepMap) []string {
+	var pp []string
+	for k := range deps {
+		if IsProtected(goolib.PkgNameSplit(k).Name) {
+			pp = append(pp, k)
+		}
+	}
+	sort.Strings(pp)
+	return pp
+}
+
+// CheckProtected returns a *ProtectedError if deps includes protected
+// packages, unless force is set.
+func CheckProtected(deps DepMap, force bool) error {
+	pp := Protected(deps)
+	if len(pp) == 0 || force {
+		return nil
+	}
+	return &ProtectedError{Packages: pp}
+}
@@ -17,63 +17,101 @@ package remove
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 
 	"github.com/google/googet/client"
 	"github.com/google/googet/download"
 	"github.com/google/googet/goolib"
+	"github.com/google/googet/msg"
 	"github.com/google/googet/oswrap"
 	"github.com/google/googet/system"
 	"github.com/google/logger"
 )
 
-func uninstallPkg(pi goolib.PackageInfo, state *client.GooGetState, dbOnly bool, proxyServer string) error {
+// fetchUninstaller makes sure the uninstall script of ps is in its unpack
+// directory. If it is missing the package is redownloaded and only the script
+// is extracted, packages without an uninstall script need nothing.
+func fetchUninstaller(ps *client.PackageState, proxyServer string, rp msg.Reporter) error {
+	un := ps.PackageSpec.Uninstall.Path
+	if un == "" {
+		return nil
+	}
+	_, err := oswrap.Stat(filepath.Join(ps.UnpackDir, un))
+	if err == nil || !os.IsNotExist(err) {
+		return err
+	}
+	dst := ps.UnpackDir + ".goo"
+	logger.Infof("Uninstall script does not exist for %s.%s.%s, redownloading...", ps.PackageSpec.Name, ps.PackageSpec.Arch, ps.PackageSpec.Version)
+	if err := download.PackageOf(ps.PackageSpec, ps.DownloadURL, dst, ps.Checksum, 0, proxyServer, rp); err != nil {
+		return fmt.Errorf("error redownloading %s.%s.%s, package may no longer exist in the repo, you can use the '-db_only' flag to remove it form the database: %v", ps.PackageSpec.Name, ps.PackageSpec.Arch, ps.PackageSpec.Version, err)
+	}
+	if err := download.ExtractFile(dst, ps.UnpackDir, un); err != nil {
+		return err
+	}
+	if err := oswrap.Remove(dst); err != nil {
+		logger.Errorf("error cleaning up package file: %v", err)
+	}
+	return nil
+}
+
+// uninstallPkg removes a package. If filesOnly is set the uninstall script is
+// not run and only the files recorded at install time are deleted.
+// Configuration files are only deleted if purge is set. If dbOnly is set
+// only the state and the cache are changed: no script is run and no file or
+// directory of the package is removed.
+func uninstallPkg(pi goolib.PackageInfo, state *client.GooGetState, dbOnly, filesOnly, purge bool, proxyServer string, rp msg.Reporter) error {
 	logger.Infof("Executing removal of package %q", pi.Name)
 	ps, err := state.GetPackageState(pi)
 	if err != nil {
 		return fmt.Errorf("package not found in state file: %v", err)
 	}
 	if !dbOnly {
-		_, err := oswrap.Stat(ps.UnpackDir)
-		if err != nil && !os.IsNotExist(err) {
-			return err
-		}
-		if os.IsNotExist(err) {
-			dst := ps.UnpackDir + ".goo"
-			logger.Infof("Package directory does not exist for %s.%s.%s, redownloading...", ps.PackageSpec.Name, ps.PackageSpec.Arch, ps.PackageSpec.Version)
-			if err := download.Package(ps.DownloadURL, dst, ps.Checksum, proxyServer); err != nil {
-				return fmt.Errorf("error redownloading %s.%s.%s, package may no longer exist in the repo, you can use the '-db_only' flag to remove it form the database: %v", pi.Name, pi.Arch, pi.Ver, err)
+		if !filesOnly {
+			if err := fetchUninstaller(&ps, proxyServer, rp); err != nil {
+				return err
 			}
-			if _, err := download.ExtractPkg(dst); err != nil {
+			if err := system.Uninstall(ps); err != nil {
 				return err
 			}
-			if err := oswrap.Remove(dst); err != nil {
-				logger.Errorf("error cleaning up package file: %v", err)
+		}
+		files := ps.InstalledFiles
+		if len(ps.ConfigFiles) > 0 {
+			if purge {
+				files = make(map[string]string)
+				for _, fm := range []map[string]string{ps.InstalledFiles, ps.ConfigFiles} {
+					for f, c := range fm {
+						files[f] = c
+					}
+				}
+			} else {
+				logger.Infof("Keeping configuration files of %s.%s, use -purge to remove them", ps.PackageSpec.Name, ps.PackageSpec.Arch)
 			}
 		}
-		if err := system.Uninstall(ps); err != nil {
-			return err
+		for file, chksum := range files {
+			if chksum == "" {
+				// Directories are removed below.
+				continue
+			}
+			logger.Infof("Removing %q", file)
+			if err := client.RemoveOrRename(file); err != nil {
+				logger.Error(err)
+			}
 		}
-		if len(ps.InstalledFiles) > 0 {
-			var dirs []string
-			for file, chksum := range ps.InstalledFiles {
-				if chksum == "" {
-					dirs = append(dirs, file)
-					continue
-				}
-				logger.Infof("Removing %q", file)
-				if err := client.RemoveOrRename(file); err != nil {
-					logger.Error(err)
-				}
+		state.RemoveDirs(ps.CreatedDirs(), pi)
+		if !filesOnly {
+			if _, err := system.DisableFeatures(ps.Enabled); err != nil {
+				logger.Error(err)
 			}
-			sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
-			for _, dir := range dirs {
-				logger.Infof("Removing %q", dir)
-				if err := client.RemoveOrRename(dir); err != nil {
-					logger.Info(err)
-				}
+			if err := system.RemoveCertificates(ps.Certificates); err != nil {
+				logger.Error(err)
+			}
+			if err := system.RemoveExclusions(ps.Exclusions); err != nil {
+				logger.Error(err)
 			}
 		}
+	} else {
+		state.HandOverDirs(ps.CreatedDirs(), pi)
 	}
 
 	if err := oswrap.RemoveAll(ps.UnpackDir); err != nil {
@@ -119,8 +157,16 @@ func (deps DepMap) build(name, arch string, state client.GooGetState) {
 
 // EnumerateDeps returns a DepMap and list of dependencies for a package.
 func EnumerateDeps(pi goolib.PackageInfo, state client.GooGetState) (DepMap, []string) {
+	return EnumerateAllDeps([]goolib.PackageInfo{pi}, state)
+}
+
+// EnumerateAllDeps returns the combined DepMap and list of dependencies for
+// several packages.
+func EnumerateAllDeps(pis []goolib.PackageInfo, state client.GooGetState) (DepMap, []string) {
 	dm := make(DepMap)
-	dm.build(pi.Name, pi.Arch, state)
+	for _, pi := range pis {
+		dm.build(pi.Name, pi.Arch, state)
+	}
 	var dl []string
 	for k := range dm {
 		di := goolib.PkgNameSplit(k)
@@ -130,22 +176,31 @@ func EnumerateDeps(pi goolib.PackageInfo, state client.GooGetState) (DepMap, []s
 		}
 		dl = append(dl, k+" "+ps.PackageSpec.Version)
 	}
+	sort.Strings(dl)
 	return dm, dl
 }
 
-// All removes a package and all dependant packages. Packages with no dependant packages
+// All removes every package in deps, reporting to rp. Packages with no dependant packages
 // will be removed first.
-func All(pi goolib.PackageInfo, deps DepMap, state *client.GooGetState, dbOnly bool, proxyServer string) error {
-	for len(deps) > 1 {
+func All(deps DepMap, state *client.GooGetState, dbOnly, filesOnly, purge bool, proxyServer string, rp msg.Reporter) error {
+	for len(deps) > 0 {
+		var leaves []string
 		for dep := range deps {
 			if len(deps[dep]) == 0 {
-				di := goolib.PkgNameSplit(dep)
-				if err := uninstallPkg(di, state, dbOnly, proxyServer); err != nil {
-					return err
-				}
-				deps.remove(dep)
+				leaves = append(leaves, dep)
+			}
+		}
+		if len(leaves) == 0 {
+			return fmt.Errorf("dependency cycle between %v, cannot determine removal order", deps)
+		}
+		sort.Strings(leaves)
+		for _, dep := range leaves {
+			di := goolib.PkgNameSplit(dep)
+			if err := uninstallPkg(di, state, dbOnly, filesOnly, purge, proxyServer, rp); err != nil {
+				return err
 			}
+			deps.remove(dep)
 		}
 	}
-	return uninstallPkg(pi, state, dbOnly, proxyServer)
+	return nil
 }
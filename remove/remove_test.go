@@ -21,7 +21,9 @@ import (
 
 	"github.com/google/googet/client"
 	"github.com/google/googet/goolib"
+	"github.com/google/googet/msg"
 	"github.com/google/googet/oswrap"
+	"github.com/google/googet/testutil"
 	"github.com/google/logger"
 )
 
@@ -70,7 +72,7 @@ func TestUninstallPkg(t *testing.T) {
 		},
 	}
 
-	if err := uninstallPkg(goolib.PackageInfo{Name: "foo"}, st, false, ""); err != nil {
+	if err := uninstallPkg(goolib.PackageInfo{Name: "foo"}, st, false, false, false, "", msg.Discard); err != nil {
 		t.Fatalf("Error running uninstallPkg: %v", err)
 	}
 
@@ -81,6 +83,205 @@ func TestUninstallPkg(t *testing.T) {
 	}
 }
 
+func TestUninstallPkgDBOnly(t *testing.T) {
+	cache, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(cache)
+	dst, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dst)
+
+	shared := filepath.Join(dst, "shared")
+	if err := oswrap.Mkdir(shared, 0755); err != nil {
+		t.Fatalf("Failed to create test folder: %v", err)
+	}
+	testFile := filepath.Join(shared, "foo")
+	otherFile := filepath.Join(shared, "bar")
+	for _, f := range []string{testFile, otherFile} {
+		if err := ioutil.WriteFile(f, []byte{}, 0666); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	st := &client.GooGetState{
+		{
+			PackageSpec:    &goolib.PkgSpec{Name: "foo", Arch: "noarch", Uninstall: goolib.ExecFile{Path: "uninstall.ps1"}},
+			InstalledFiles: map[string]string{testFile: "chksum"},
+			Dirs:           map[string]bool{dst: false, shared: true},
+			UnpackDir:      cache,
+		},
+		{
+			PackageSpec:    &goolib.PkgSpec{Name: "bar", Arch: "noarch"},
+			InstalledFiles: map[string]string{otherFile: "chksum"},
+			Dirs:           map[string]bool{shared: false},
+		},
+	}
+	before := testutil.Tree(t, dst)
+
+	if err := uninstallPkg(goolib.PackageInfo{Name: "foo", Arch: "noarch"}, st, true, false, false, "", msg.Discard); err != nil {
+		t.Fatalf("Error running uninstallPkg: %v", err)
+	}
+
+	if after := testutil.Tree(t, dst); !reflect.DeepEqual(after, before) {
+		t.Errorf("db_only removal changed the filesystem, before: %v, after: %v", before, after)
+	}
+	if len(*st) != 1 || (*st)[0].PackageSpec.Name != "bar" {
+		t.Fatalf("foo not removed from state: %+v", *st)
+	}
+	if !(*st)[0].Dirs[shared] {
+		t.Errorf("shared directory %s not handed over to bar, dirs: %v", shared, (*st)[0].Dirs)
+	}
+	if _, err := oswrap.Stat(cache); err == nil {
+		t.Errorf("cache directory %s not removed", cache)
+	}
+}
+
+func TestUninstallPkgSharedDirs(t *testing.T) {
+	dst, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dst)
+
+	own := filepath.Join(dst, "foo")
+	shared := filepath.Join(dst, "shared")
+	for _, d := range []string{own, shared} {
+		if err := oswrap.Mkdir(d, 0755); err != nil {
+			t.Fatalf("Failed to create test folder: %v", err)
+		}
+	}
+	fooFile := filepath.Join(own, "foo")
+	sharedFoo := filepath.Join(shared, "foo")
+	sharedBar := filepath.Join(shared, "bar")
+	for _, f := range []string{fooFile, sharedFoo, sharedBar} {
+		if err := ioutil.WriteFile(f, []byte{}, 0666); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	st := &client.GooGetState{
+		client.PackageState{
+			PackageSpec:    &goolib.PkgSpec{Name: "foo"},
+			InstalledFiles: map[string]string{fooFile: "chksum", sharedFoo: "chksum"},
+			Dirs:           map[string]bool{dst: false, own: true, shared: true},
+			UnpackDir:      filepath.Join(dst, "unpack"),
+		},
+		client.PackageState{
+			PackageSpec:    &goolib.PkgSpec{Name: "bar"},
+			InstalledFiles: map[string]string{sharedBar: "chksum"},
+			Dirs:           map[string]bool{dst: false, shared: false},
+		},
+	}
+
+	if err := uninstallPkg(goolib.PackageInfo{Name: "foo"}, st, false, true, false, "", msg.Discard); err != nil {
+		t.Fatalf("Error running uninstallPkg: %v", err)
+	}
+	for _, n := range []string{own, sharedFoo} {
+		if _, err := oswrap.Stat(n); err == nil {
+			t.Errorf("%s was not removed", n)
+		}
+	}
+	for _, n := range []string{dst, sharedBar} {
+		if _, err := oswrap.Stat(n); err != nil {
+			t.Errorf("%s was removed", n)
+		}
+	}
+	ps, err := st.GetPackageState(goolib.PackageInfo{Name: "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ps.Dirs[shared] {
+		t.Errorf("shared directory %s was not handed over to bar", shared)
+	}
+
+	if err := uninstallPkg(goolib.PackageInfo{Name: "bar"}, st, false, true, false, "", msg.Discard); err != nil {
+		t.Fatalf("Error running uninstallPkg: %v", err)
+	}
+	if _, err := oswrap.Stat(shared); err == nil {
+		t.Errorf("%s was not removed with its last user", shared)
+	}
+}
+
+func TestUninstallPkgNoRedownload(t *testing.T) {
+	dst, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dst)
+
+	testFile := filepath.Join(dst, "foo")
+	if err := ioutil.WriteFile(testFile, []byte{}, 0666); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	for _, tt := range []struct {
+		un        string
+		filesOnly bool
+	}{
+		{"", false},
+		{"uninstall.ps1", true},
+	} {
+		st := &client.GooGetState{
+			client.PackageState{
+				PackageSpec:    &goolib.PkgSpec{Name: "foo", Uninstall: goolib.ExecFile{Path: tt.un}},
+				InstalledFiles: map[string]string{testFile: "chksum"},
+				// Neither the unpack directory nor the download URL exist, a
+				// redownload would fail.
+				UnpackDir:   filepath.Join(dst, "unpack"),
+				DownloadURL: "http://localhost:1/foo.goo",
+			},
+		}
+		if err := uninstallPkg(goolib.PackageInfo{Name: "foo"}, st, false, tt.filesOnly, false, "", msg.Discard); err != nil {
+			t.Errorf("Error running uninstallPkg with uninstall script %q: %v", tt.un, err)
+		}
+		if len(*st) != 0 {
+			t.Errorf("package with uninstall script %q was not removed from state", tt.un)
+		}
+	}
+}
+
+func TestUninstallPkgConfigFiles(t *testing.T) {
+	for _, purge := range []bool{false, true} {
+		dst, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatalf("Failed to create temp directory: %v", err)
+		}
+		defer oswrap.RemoveAll(dst)
+
+		bin := filepath.Join(dst, "foo.exe")
+		conf := filepath.Join(dst, "foo.conf")
+		for _, f := range []string{bin, conf} {
+			if err := ioutil.WriteFile(f, []byte{}, 0666); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+		}
+		st := &client.GooGetState{
+			client.PackageState{
+				PackageSpec:    &goolib.PkgSpec{Name: "foo"},
+				InstalledFiles: map[string]string{bin: "chksum"},
+				ConfigFiles:    map[string]string{conf: "chksum"},
+				UnpackDir:      filepath.Join(dst, "unpack"),
+			},
+		}
+		if err := uninstallPkg(goolib.PackageInfo{Name: "foo"}, st, false, false, purge, "", msg.Discard); err != nil {
+			t.Fatalf("Error running uninstallPkg: %v", err)
+		}
+		if _, err := oswrap.Stat(bin); err == nil {
+			t.Errorf("%s was not removed", bin)
+		}
+		_, err = oswrap.Stat(conf)
+		if purge && err == nil {
+			t.Errorf("%s was not removed with purge", conf)
+		}
+		if !purge && err != nil {
+			t.Errorf("%s was removed without purge", conf)
+		}
+	}
+}
+
 func TestBuild(t *testing.T) {
 	pkg1 := "foo_pkg"
 	pkg2 := "bar_pkg"
@@ -146,3 +347,71 @@ func TestRemoveDep(t *testing.T) {
 		t.Errorf("returned dependancy map does not match expected one: got %v, want %v", deps, want)
 	}
 }
+
+func TestAll(t *testing.T) {
+	var st client.GooGetState
+	for _, n := range []string{"foo_pkg", "bar_pkg", "baz_pkg", "qux_pkg"} {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatalf("Failed to create temp directory: %v", err)
+		}
+		defer oswrap.RemoveAll(dir)
+		st = append(st, client.PackageState{
+			PackageSpec: &goolib.PkgSpec{Name: n, Arch: "noarch", Version: "1.0.0@1"},
+			UnpackDir:   dir,
+		})
+	}
+	// bar_pkg depends on foo_pkg, baz_pkg depends on bar_pkg.
+	st[1].PackageSpec.PkgDependencies = map[string]string{"foo_pkg": "1.0.0@1"}
+	st[2].PackageSpec.PkgDependencies = map[string]string{"bar_pkg.noarch": "1.0.0@1"}
+
+	pis := []goolib.PackageInfo{{Name: "foo_pkg", Arch: "noarch"}, {Name: "bar_pkg", Arch: "noarch"}}
+	deps, dl := EnumerateAllDeps(pis, st)
+	want := []string{"bar_pkg.noarch 1.0.0@1", "baz_pkg.noarch 1.0.0@1", "foo_pkg.noarch 1.0.0@1"}
+	if !reflect.DeepEqual(dl, want) {
+		t.Errorf("EnumerateAllDeps returned unexpected list: got %v, want %v", dl, want)
+	}
+
+	if err := All(deps, &st, true, false, false, "", msg.Discard); err != nil {
+		t.Fatalf("Error running All: %v", err)
+	}
+	if len(st) != 1 || st[0].PackageSpec.Name != "qux_pkg" {
+		t.Errorf("unexpected state after removal: %v", st)
+	}
+}
+
+func TestAllCycle(t *testing.T) {
+	deps := DepMap{"foo_pkg.noarch": []string{"bar_pkg.noarch"}, "bar_pkg.noarch": []string{"foo_pkg.noarch"}}
+	if err := All(deps, &client.GooGetState{}, true, false, false, "", msg.Discard); err == nil {
+		t.Error("All did not return an error for a dependency cycle")
+	}
+}
+
+func TestProtected(t *testing.T) {
+	defer SetProtected(nil)
+	SetProtected([]string{"agent", "agent.tools"})
+	deps := DepMap{
+		"googet.x86_64":       nil,
+		"agent.noarch":        []string{"googet.x86_64"},
+		"agent-tools.noarch":  nil,
+		"other.noarch":        nil,
+		"agent.tools.x86_32":  nil,
+		"agent.tools.x86_64":  nil,
+		"unrelated.x86_64":    nil,
+		"googet-extra.noarch": nil,
+	}
+	want := []string{"agent.noarch", "agent.tools.x86_32", "agent.tools.x86_64", "googet.x86_64"}
+	if got := Protected(deps); !reflect.DeepEqual(got, want) {
+		t.Errorf("Protected() = %v, want %v", got, want)
+	}
+	err := CheckProtected(deps, false)
+	if pe, ok := err.(*ProtectedError); !ok || !reflect.DeepEqual(pe.Packages, want) {
+		t.Errorf("CheckProtected() = %v, want a ProtectedError for %v", err, want)
+	}
+	if err := CheckProtected(deps, true); err != nil {
+		t.Errorf("CheckProtected(force) = %v", err)
+	}
+	if err := CheckProtected(DepMap{"other.noarch": nil}, false); err != nil {
+		t.Errorf("CheckProtected() of unprotected packages = %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package report uploads the package inventory of a machine, and the
+// changes to it since the last report, to Cloud Storage or BigQuery as
+// newline delimited JSON.
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/googet/client"
+)
+
+// Record types.
+const (
+	// TypePackage records an installed package.
+	TypePackage = "package"
+	// TypeChange records a package installed, upgraded or removed since the
+	// last report.
+	TypeChange = "change"
+)
+
+// Record is a line of a report.
+type Record struct {
+	MachineID string
+	Time      time.Time
+	Type      string
+	Name      string
+	Arch      string
+	// Version is the installed version, empty for removed packages.
+	Version string `json:",omitempty"`
+	// OldVersion is the version of an upgraded or removed package at the
+	// last report.
+	OldVersion string `json:",omitempty"`
+	Repo       string `json:",omitempty"`
+}
+
+// Target is where reports are uploaded, either or both of Bucket and Table
+// may be set.
+type Target struct {
+	// Bucket is the Cloud Storage bucket the report of a machine is written
+	// to, as the object <Prefix>/<machine ID>.json.
+	Bucket, Prefix string
+	// Table is the BigQuery table, as project.dataset.table, the records
+	// are inserted into.
+	Table string
+}
+
+// These are variables so tests can point them at fake servers.
+var (
+	storageURL  = "https://storage.googleapis.com/upload/storage/v1/b/"
+	bigQueryURL = "https://bigquery.googleapis.com/bigquery/v2/projects/"
+	httpClient  = &http.Client{Timeout: time.Minute}
+)
+
+// Build returns the records reporting state at now, with the changes from
+// last, the installed packages of the previous report.
+func Build(machineID string, now time.Time, state client.GooGetState, last []Record) []Record {
+	var recs []Record
+	old := make(map[string]Record)
+	for _, r := range last {
+		old[r.Name+"."+r.Arch] = r
+	}
+	for _, ps := range state {
+		s := ps.PackageSpec
+		r := Record{MachineID: machineID, Time: now, Type: TypePackage, Name: s.Name, Arch: s.Arch, Version: s.Version, Repo: ps.SourceRepo}
+		recs = append(recs, r)
+		k := s.Name + "." + s.Arch
+		if o, ok := old[k]; !ok || o.Version != s.Version {
+			r.Type = TypeChange
+			r.OldVersion = o.Version
+			recs = append(recs, r)
+		}
+		delete(old, k)
+	}
+	for _, o := range old {
+		recs = append(recs, Record{MachineID: machineID, Time: now, Type: TypeChange, Name: o.Name, Arch: o.Arch, OldVersion: o.Version, Repo: o.Repo})
+	}
+	sort.SliceStable(recs, func(i, j int) bool {
+		if recs[i].Type != recs[j].Type {
+			return recs[i].Type > recs[j].Type
+		}
+		return recs[i].Name+"."+recs[i].Arch < recs[j].Name+"."+recs[j].Arch
+	})
+	return recs
+}
+
+// Packages returns the package records of recs.
+func Packages(recs []Record) []Record {
+	var pkgs []Record
+	for _, r := range recs {
+		if r.Type == TypePackage {
+			pkgs = append(pkgs, r)
+		}
+	}
+	return pkgs
+}
+
+// ReadLast reads the package records of the previous report from p, a
+// missing file is no previous report.
+func ReadLast(p string) ([]Record, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var recs []Record
+	return recs, json.Unmarshal(b, &recs)
+}
+
+// WriteLast writes the package records of recs to p, for the next report to
+// find the changes from.
+func WriteLast(p string, recs []Record) error {
+	b, err := json.Marshal(Packages(recs))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, b, 0664)
+}
+
+// Upload uploads recs to t using the OAuth2 access token.
+func Upload(t Target, token, machineID string, recs []Record) error {
+	if t.Bucket != "" {
+		if err := uploadStorage(t, token, machineID, recs); err != nil {
+			return fmt.Errorf("error uploading report to bucket %s: %v", t.Bucket, err)
+		}
+	}
+	if t.Table != "" {
+		if err := insertBigQuery(t.Table, token, recs); err != nil {
+			return fmt.Errorf("error inserting report into table %s: %v", t.Table, err)
+		}
+	}
+	return nil
+}
+
+func uploadStorage(t Target, token, machineID string, recs []Record) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range recs {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	name := path.Join(t.Prefix, machineID+".json")
+	u := storageURL + url.PathEscape(t.Bucket) + "/o?uploadType=media&name=" + url.QueryEscape(name)
+	_, err := post(u, token, "application/x-ndjson", buf.Bytes())
+	return err
+}
+
+func insertBigQuery(table, token string, recs []Record) error {
+	parts := strings.Split(table, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("table must be project.dataset.table")
+	}
+	type row struct {
+		JSON Record `json:"json"`
+	}
+	req := struct {
+		Rows []row `json:"rows"`
+	}{}
+	for _, r := range recs {
+		req.Rows = append(req.Rows, row{r})
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	u := bigQueryURL + fmt.Sprintf("%s/datasets/%s/tables/%s/insertAll", url.PathEscape(parts[0]), url.PathEscape(parts[1]), url.PathEscape(parts[2]))
+	res, err := post(u, token, "application/json", b)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		InsertErrors []struct {
+			Index  int
+			Errors []struct{ Reason, Message string }
+		}
+	}
+	if err := json.Unmarshal(res, &resp); err != nil {
+		return fmt.Errorf("error decoding response: %v", err)
+	}
+	if len(resp.InsertErrors) > 0 {
+		e := resp.InsertErrors[0]
+		return fmt.Errorf("%d rows not inserted, row %d: %v", len(resp.InsertErrors), e.Index, e.Errors)
+	}
+	return nil
+}
+
+func post(u, token, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest("POST", u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", contentType)
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("POST returned status: %q: %s", res.Status, bytes.TrimSpace(b))
+	}
+	return b, nil
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package report
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+)
+
+func state(pkgs ...string) client.GooGetState {
+	var s client.GooGetState
+	for _, p := range pkgs {
+		pi := goolib.PkgNameSplit(p)
+		s = append(s, client.PackageState{SourceRepo: "repo", PackageSpec: &goolib.PkgSpec{Name: pi.Name, Arch: pi.Arch, Version: pi.Ver}})
+	}
+	return s
+}
+
+func TestBuild(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	last := Packages(Build("m", now, state("foo.noarch.1.0.0@1", "bar.noarch.1.0.0@1", "baz.noarch.1.0.0@1"), nil))
+
+	got := Build("m", now, state("foo.noarch.2.0.0@1", "bar.noarch.1.0.0@1", "qux.noarch.1.0.0@1"), last)
+	rec := func(typ, name, ver, old string) Record {
+		return Record{MachineID: "m", Time: now, Type: typ, Name: name, Arch: "noarch", Version: ver, OldVersion: old, Repo: "repo"}
+	}
+	want := []Record{
+		rec(TypePackage, "bar", "1.0.0@1", ""),
+		rec(TypePackage, "foo", "2.0.0@1", ""),
+		rec(TypePackage, "qux", "1.0.0@1", ""),
+		rec(TypeChange, "baz", "", "1.0.0@1"),
+		rec(TypeChange, "foo", "2.0.0@1", "1.0.0@1"),
+		rec(TypeChange, "qux", "1.0.0@1", ""),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Build() = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestLast(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dir)
+	p := filepath.Join(dir, "googet.report")
+
+	if got, err := ReadLast(p); err != nil || got != nil {
+		t.Errorf("ReadLast of a missing file = %+v, %v, want nothing", got, err)
+	}
+	recs := Build("m", time.Now().UTC().Round(0), state("foo.noarch.1.0.0@1"), nil)
+	if err := WriteLast(p, recs); err != nil {
+		t.Fatalf("WriteLast: %v", err)
+	}
+	got, err := ReadLast(p)
+	if err != nil {
+		t.Fatalf("ReadLast: %v", err)
+	}
+	if want := Packages(recs); !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadLast() = %+v, want %+v", got, want)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	var objects, rows int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/storage/bucket/o":
+			if got, want := r.URL.Query().Get("name"), "googet/m.json"; got != want {
+				t.Errorf("uploaded object %q, want %q", got, want)
+			}
+			s := bufio.NewScanner(r.Body)
+			for s.Scan() {
+				var rec Record
+				if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+					t.Errorf("error decoding uploaded line %q: %v", s.Text(), err)
+				}
+				objects++
+			}
+		case "/bigquery/proj/datasets/ds/tables/tbl/insertAll":
+			var req struct {
+				Rows []struct{ JSON Record }
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("error decoding insert request: %v", err)
+			}
+			rows += len(req.Rows)
+			w.Write([]byte("{}"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	defer func(s, b string) { storageURL, bigQueryURL = s, b }(storageURL, bigQueryURL)
+	storageURL = ts.URL + "/storage/"
+	bigQueryURL = ts.URL + "/bigquery/"
+
+	recs := Build("m", time.Now(), state("foo.noarch.1.0.0@1", "bar.noarch.1.0.0@1"), nil)
+	if err := Upload(Target{Bucket: "bucket", Prefix: "googet", Table: "proj.ds.tbl"}, "tok", "m", recs); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if objects != len(recs) || rows != len(recs) {
+		t.Errorf("uploaded %d lines and inserted %d rows, want %d of each", objects, rows, len(recs))
+	}
+	if err := Upload(Target{Table: "proj.ds.tbl"}, "wrong", "m", recs); err == nil {
+		t.Error("Upload with a rejected token returned no error")
+	}
+	if err := Upload(Target{Table: "tbl"}, "tok", "m", recs); err == nil {
+		t.Error("Upload to a table without project and dataset returned no error")
+	}
+}
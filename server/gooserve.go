@@ -20,13 +20,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"path"
 	"path/filepath"
-	"strings"
-	"sync"
 	"time"
 
 	"github.com/google/googet/goolib"
+	"github.com/google/googet/index"
 	"github.com/google/googet/oswrap"
 	"github.com/google/logger"
 )
@@ -39,52 +37,38 @@ var (
 	port      = flag.Int("port", 8000, "listen port")
 	repoName  = flag.String("repo_name", "repo", "name of the repo to setup")
 
+	promotePkg  = flag.String("promote", "", "promote the package name.arch.version from this repo to the repo rooted at -promote_to, then exit")
+	promoteTo   = flag.String("promote_to", "", "root location of the repo to promote to")
+	promoteMove = flag.Bool("promote_move", false, "remove the promoted package from this repo")
+
+	yankPkg    = flag.String("yank", "", "mark the package name.arch.version in this repo as yanked, then exit")
+	yankReason = flag.String("yank_reason", "", "why the package given to -yank is yanked")
+	unyankPkg  = flag.String("unyank", "", "remove the yanked mark of the package name.arch.version in this repo, then exit")
+
+	entitlementFile = flag.String("entitlements", "", "JSON file mapping entitlement names to the tokens allowed to download restricted packages requiring them")
+
 	repoContents *repoPackages
 )
 
 // repoPackages describes a repository of packages.
 type repoPackages struct {
 	rs []goolib.RepoSpec
-	mu sync.Mutex
+	// tokens holds the allowed tokens by entitlement name.
+	tokens map[string][]string
 }
 
-// add provides a thread safe way to add a package to repoPackages.
-func (r *repoPackages) add(src, chksum string, spec *goolib.PkgSpec) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	r.rs = append(r.rs, goolib.RepoSpec{
-		Source:      src,
-		Checksum:    chksum,
-		PackageSpec: spec,
-	})
-}
-
-func packageInfo(pkgPath, packageDir string) error {
-	pkg := filepath.Base(pkgPath)
-	pi := goolib.PkgNameSplit(strings.TrimSuffix(pkg, ".goo"))
-
-	spec, err := extractSpec(pkgPath)
+// readEntitlements reads the entitlement file, entitlement names mapped to
+// lists of tokens.
+func readEntitlements(p string) (map[string][]string, error) {
+	b, err := ioutil.ReadFile(p)
 	if err != nil {
-		return err
-	}
-	if spec.Name != pi.Name {
-		return fmt.Errorf("%s: name in spec does not match package file name", pkgPath)
-	}
-	if spec.Arch != pi.Arch {
-		return fmt.Errorf("%s: arch in spec does not match package file name", pkgPath)
+		return nil, err
 	}
-	if spec.Version != pi.Ver {
-		return fmt.Errorf("%s: version in spec does not match package version", pkgPath)
+	var m map[string][]string
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
 	}
-
-	f, err := oswrap.Open(pkgPath)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	repoContents.add(path.Join(packageDir, pkg), goolib.Checksum(f), spec)
-	return nil
+	return m, nil
 }
 
 func runSync(packageDir string) error {
@@ -93,23 +77,18 @@ func runSync(packageDir string) error {
 		return err
 	}
 
-	pkgs, err := filepath.Glob(filepath.Join(packageDir, "*.goo"))
+	// Packages are served under /packages/ whatever the root is.
+	rs, err := index.Scan(packageDir, "packages")
 	if err != nil {
 		return err
 	}
-
-	repoContents = &repoPackages{}
-	var wg sync.WaitGroup
-	for _, pkg := range pkgs {
-		wg.Add(1)
-		go func(pkg string) {
-			defer wg.Done()
-			if err := packageInfo(pkg, packageDir); err != nil {
-				logger.Error(err)
-			}
-		}(pkg)
+	rc := &repoPackages{rs: rs}
+	if *entitlementFile != "" {
+		if rc.tokens, err = readEntitlements(*entitlementFile); err != nil {
+			return err
+		}
 	}
-	wg.Wait()
+	repoContents = rc
 	logger.Info("Sync run completed successfully")
 	return nil
 }
@@ -133,18 +112,100 @@ func serve(w http.ResponseWriter, r *http.Request) {
 	w.Write(out)
 }
 
+// query serves the specs of every version of the packages named by the name
+// query parameters, letting constrained clients skip the full index.
+func query(w http.ResponseWriter, r *http.Request) {
+	names := r.URL.Query()["name"]
+	rs := []goolib.RepoSpec{}
+	for _, s := range repoContents.rs {
+		if goolib.ContainsString(s.PackageSpec.Name, names) {
+			rs = append(rs, s)
+		}
+	}
+	out, err := json.MarshalIndent(rs, "", "  ")
+	if err != nil {
+		logger.Fatal(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// packages serves the package files, restricted packages only to requests
+// with a token of their entitlement.
+func packages(packageDir string) http.Handler {
+	fs := http.StripPrefix("/packages/", http.FileServer(http.Dir(packageDir)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := repoContents
+		for _, s := range rc.rs {
+			if "/"+s.Source != r.URL.Path {
+				continue
+			}
+			ent := s.PackageSpec.EntitlementName()
+			if ent == "" {
+				break
+			}
+			tok := r.Header.Get(goolib.EntitlementHeader)
+			if tok == "" {
+				http.Error(w, "entitlement token required", http.StatusUnauthorized)
+				return
+			}
+			if !goolib.ContainsString(tok, rc.tokens[ent]) {
+				logger.Infof("Refused token for entitlement %q to %s", ent, r.RemoteAddr)
+				http.Error(w, "not entitled", http.StatusForbidden)
+				return
+			}
+			break
+		}
+		fs.ServeHTTP(w, r)
+	})
+}
+
+// deprecation serves the deprecation notice of the repo, deprecation.json
+// in the root location, or 404 if the repo is not deprecated.
+func deprecation(w http.ResponseWriter, r *http.Request) {
+	http.ServeFile(w, r, filepath.Join(*root, "deprecation.json"))
+}
+
 func main() {
 	flag.Parse()
 
 	logger.Init("GooServe", *verbose, *systemLog, ioutil.Discard)
 
+	if *promotePkg != "" {
+		if *promoteTo == "" {
+			logger.Fatal("-promote_to must be set to promote a package")
+		}
+		if err := promote(*promotePkg, *root, *promoteTo, *promoteMove); err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
+
 	packageDir := filepath.Join(*root, "packages")
+	if *yankPkg != "" {
+		if *yankReason == "" {
+			logger.Fatal("-yank_reason must be set to yank a package")
+		}
+		if err := index.Yank(packageDir, *yankPkg, *yankReason); err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
+	if *unyankPkg != "" {
+		if err := index.Unyank(packageDir, *unyankPkg); err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
+
 	if err := runSync(packageDir); err != nil {
 		logger.Error(err)
 	}
 
 	http.HandleFunc(fmt.Sprintf("/%s/index", *repoName), serve)
-	http.Handle("/packages/", http.StripPrefix("/packages/", http.FileServer(http.Dir(packageDir))))
+	http.HandleFunc(fmt.Sprintf("/%s/query", *repoName), query)
+	http.HandleFunc(fmt.Sprintf("/%s/deprecation", *repoName), deprecation)
+	http.Handle("/packages/", packages(packageDir))
 	go func() {
 		err := http.ListenAndServe(fmt.Sprintf(":%d", *port), nil)
 		if err != nil {
@@ -0,0 +1,124 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+	"github.com/google/logger"
+)
+
+// promote copies the package pkg, given as name.arch.version, from the
+// packages directory of the repo rooted at from to the one rooted at to. If
+// move is set the package is then removed from the source repo.
+// The package is written to a temporary file and renamed into place so a sync
+// run in either repo never sees a partial or missing package.
+func promote(pkg, from, to string, move bool) error {
+	pkg = strings.TrimSuffix(pkg, ".goo")
+	pi := goolib.PkgNameSplit(pkg)
+	if pi.Arch == "" || pi.Ver == "" {
+		return fmt.Errorf("%q is not a full package name, expected name.arch.version", pkg)
+	}
+	src := filepath.Join(from, "packages", pi.PkgName())
+	dstDir := filepath.Join(to, "packages")
+	dst := filepath.Join(dstDir, pi.PkgName())
+
+	spec, err := extractSpec(src)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", src, err)
+	}
+	if spec.Name != pi.Name || spec.Arch != pi.Arch || spec.Version != pi.Ver {
+		return fmt.Errorf("%s: spec %s.%s.%s does not match package file name", src, spec.Name, spec.Arch, spec.Version)
+	}
+	sum, err := checksum(src)
+	if err != nil {
+		return err
+	}
+
+	if dsum, err := checksum(dst); err == nil {
+		if dsum != sum {
+			return fmt.Errorf("%s already exists in %s with different contents", pi.PkgName(), to)
+		}
+		logger.Infof("%s is already in %s", pi.PkgName(), to)
+	} else if os.IsNotExist(err) {
+		if err := copyAtomic(src, dstDir, dst, sum); err != nil {
+			return err
+		}
+		logger.Infof("Promoted %s from %s to %s", pi.PkgName(), from, to)
+	} else {
+		return err
+	}
+
+	if move {
+		if err := oswrap.Remove(src); err != nil {
+			return fmt.Errorf("promoted %s but could not remove it from %s: %v", pi.PkgName(), from, err)
+		}
+		logger.Infof("Removed %s from %s", pi.PkgName(), from)
+	}
+	return nil
+}
+
+// copyAtomic copies src to dst through a temporary file in dir, checking
+// that the copy matches the checksum sum before renaming it into place.
+func copyAtomic(src, dir, dst, sum string) (err error) {
+	if err := oswrap.MkdirAll(dir, 0774); err != nil {
+		return err
+	}
+	in, err := oswrap.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := ioutil.TempFile(dir, ".promote-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			oswrap.Remove(tmp.Name())
+		}
+	}()
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	tsum, err := checksum(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if tsum != sum {
+		return fmt.Errorf("checksum of copied package %s does not match the original", tmp.Name())
+	}
+	return oswrap.Rename(tmp.Name(), dst)
+}
+
+func checksum(p string) (string, error) {
+	f, err := oswrap.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return goolib.Checksum(f), nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+	"github.com/google/logger"
+)
+
+// The certificate store operations, replaced in tests.
+var (
+	certInStore = certificateInStore
+	addCert     = addCertificate
+	deleteCert  = deleteCertificate
+)
+
+// readCertificate reads the DER or PEM encoded certificate in p and returns
+// its DER encoding and thumbprint.
+func readCertificate(p string) ([]byte, string, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, "", err
+	}
+	if blk, _ := pem.Decode(b); blk != nil {
+		b = blk.Bytes
+	}
+	if _, err := x509.ParseCertificate(b); err != nil {
+		return nil, "", fmt.Errorf("%s: %v", filepath.Base(p), err)
+	}
+	sum := sha1.Sum(b)
+	return b, strings.ToUpper(hex.EncodeToString(sum[:])), nil
+}
+
+// InstallCertificates adds the certificates of ps, unpacked in dir, to their
+// machine stores and returns them. Certificates already in their store are
+// returned as kept. On error the certificates added so far are returned
+// with it.
+func InstallCertificates(dir string, ps *goolib.PkgSpec) ([]client.Certificate, error) {
+	var certs []client.Certificate
+	for _, c := range ps.Certificates {
+		der, thumb, err := readCertificate(filepath.Join(dir, c.Path))
+		if err != nil {
+			return certs, fmt.Errorf("error reading certificate: %v", err)
+		}
+		in, err := certInStore(c.Store, thumb)
+		if err != nil {
+			return certs, fmt.Errorf("error checking certificate store %s: %v", c.Store, err)
+		}
+		if !in {
+			logger.Infof("Adding certificate %s (%s) to store %s for %s", c.Path, thumb, c.Store, ps.Name)
+			if err := addCert(c.Store, der); err != nil {
+				return certs, fmt.Errorf("error adding certificate %s to store %s: %v", c.Path, c.Store, err)
+			}
+		}
+		certs = append(certs, client.Certificate{Store: c.Store, Thumbprint: thumb, Kept: in})
+	}
+	return certs, nil
+}
+
+// RemoveCertificates deletes the certificates in certs that are not kept
+// from their stores. It carries on past failures and returns the first
+// error.
+func RemoveCertificates(certs []client.Certificate) error {
+	var first error
+	for _, c := range certs {
+		if c.Kept {
+			continue
+		}
+		logger.Infof("Removing certificate %s from store %s", c.Thumbprint, c.Store)
+		if err := deleteCert(c.Store, c.Thumbprint); err != nil {
+			logger.Errorf("Error removing certificate %s from store %s: %v", c.Thumbprint, c.Store, err)
+			if first == nil {
+				first = fmt.Errorf("error removing certificate %s from store %s: %v", c.Thumbprint, c.Store, err)
+			}
+		}
+	}
+	return first
+}
+
+// checkCertificates returns an error if one of certs is no longer in its
+// store.
+func checkCertificates(certs []client.Certificate) error {
+	for _, c := range certs {
+		in, err := certInStore(c.Store, c.Thumbprint)
+		if err != nil {
+			return err
+		}
+		if !in {
+			return fmt.Errorf("certificate %s is not in store %s", c.Thumbprint, c.Store)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+)
+
+// writeCert writes a self-signed certificate named cn to dir, PEM encoded if
+// asked to, and returns its thumbprint.
+func writeCert(t *testing.T, dir, cn string, asPEM bool) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := der
+	if asPEM {
+		b = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, cn+".cer"), b, 0664); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha1.Sum(der)
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func TestInstallRemoveCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	root := writeCert(t, dir, "root", true)
+	ca := writeCert(t, dir, "ca", false)
+	if err := ioutil.WriteFile(filepath.Join(dir, "bad.cer"), []byte("not a certificate"), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(in func(string, string) (bool, error), add func(string, []byte) error, del func(string, string) error) {
+		certInStore, addCert, deleteCert = in, add, del
+	}(certInStore, addCert, deleteCert)
+	stores := map[string]bool{"CA/" + ca: true}
+	certInStore = func(store, thumb string) (bool, error) { return stores[store+"/"+thumb], nil }
+	addCert = func(store string, der []byte) error {
+		sum := sha1.Sum(der)
+		stores[store+"/"+strings.ToUpper(hex.EncodeToString(sum[:]))] = true
+		return nil
+	}
+	deleteCert = func(store, thumb string) error {
+		delete(stores, store+"/"+thumb)
+		return nil
+	}
+
+	ps := &goolib.PkgSpec{Name: "foo", Certificates: []goolib.Certificate{
+		{Path: "root.cer", Store: "Root"},
+		{Path: "ca.cer", Store: "CA"},
+	}}
+	certs, err := InstallCertificates(dir, ps)
+	if err != nil {
+		t.Fatalf("InstallCertificates: %v", err)
+	}
+	want := []client.Certificate{{Store: "Root", Thumbprint: root}, {Store: "CA", Thumbprint: ca, Kept: true}}
+	if !reflect.DeepEqual(certs, want) {
+		t.Errorf("InstallCertificates = %+v, want %+v", certs, want)
+	}
+	if err := checkCertificates(certs); err != nil {
+		t.Errorf("checkCertificates after install: %v", err)
+	}
+
+	if err := RemoveCertificates(certs); err != nil {
+		t.Fatalf("RemoveCertificates: %v", err)
+	}
+	if ws := map[string]bool{"CA/" + ca: true}; !reflect.DeepEqual(stores, ws) {
+		t.Errorf("after RemoveCertificates stores hold %v, want %v", stores, ws)
+	}
+	if err := checkCertificates(certs); err == nil {
+		t.Error("checkCertificates of a removed certificate returned nil")
+	}
+
+	ps.Certificates = append(ps.Certificates, goolib.Certificate{Path: "bad.cer", Store: "Root"})
+	certs, err = InstallCertificates(dir, ps)
+	if err == nil || len(certs) != 2 {
+		t.Errorf("InstallCertificates with an invalid certificate = %+v, %v, want the 2 added and an error", certs, err)
+	}
+}
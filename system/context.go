@@ -0,0 +1,62 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+
+	"github.com/google/googet/goolib"
+	"github.com/google/logger"
+)
+
+// RestrictedContext runs scripts with the privileges of GooGet removed: a
+// restricted token without administrator rights on Windows and the nobody
+// user on Linux.
+const RestrictedContext = "restricted"
+
+var scriptContexts = make(map[string]string)
+
+// SetScriptContext sets the context the install, uninstall and verify
+// scripts of the package name run in, or of all packages without their own
+// context if name is empty. ctx is RestrictedContext or the account to run
+// as, "" runs scripts as GooGet itself.
+func SetScriptContext(name, ctx string) {
+	scriptContexts[name] = ctx
+}
+
+// ScriptContext returns the context the scripts of the package name run in.
+func ScriptContext(name string) string {
+	if ctx, ok := scriptContexts[name]; ok {
+		return ctx
+	}
+	return scriptContexts[""]
+}
+
+// runScript runs c, a script or installer of the package name, in the script
+// context set for the package.
+func runScript(name string, c *exec.Cmd, ec []int, out io.Writer) error {
+	ctx := ScriptContext(name)
+	if ctx == "" {
+		return goolib.Run(c, ec, out)
+	}
+	logger.Infof("Running %q as %s", c.Path, ctx)
+	done, err := setContext(c, ctx)
+	if err != nil {
+		return fmt.Errorf("cannot run as %s: %v", ctx, err)
+	}
+	defer done()
+	return goolib.Run(c, ec, out)
+}
@@ -0,0 +1,36 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import "testing"
+
+func TestScriptContext(t *testing.T) {
+	defer func() { scriptContexts = make(map[string]string) }()
+
+	if got := ScriptContext("foo"); got != "" {
+		t.Errorf("ScriptContext(foo) with nothing set = %q, want \"\"", got)
+	}
+	SetScriptContext("", RestrictedContext)
+	SetScriptContext("foo", `NT AUTHORITY\LocalService`)
+	SetScriptContext("bar", "")
+	for name, want := range map[string]string{
+		"foo": `NT AUTHORITY\LocalService`,
+		"bar": "",
+		"baz": RestrictedContext,
+	} {
+		if got := ScriptContext(name); got != want {
+			t.Errorf("ScriptContext(%s) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"regexp"
+	"strings"
+)
+
+// oemINF matches the names drivers are published under in the driver store.
+var oemINF = regexp.MustCompile(`(?i)\boem\d+\.inf\b`)
+
+// publishedDrivers returns the published driver names, like oem12.inf, in
+// the output of pnputil. The output is localized, so the names are matched
+// rather than the labels in front of them.
+func publishedDrivers(out string) []string {
+	var drvs []string
+	for _, m := range oemINF.FindAllString(out, -1) {
+		drvs = append(drvs, strings.ToLower(m))
+	}
+	return drvs
+}
+
+// publishedDriver returns the name pnputil /add-driver reported publishing a
+// single driver under, "" if there is none.
+func publishedDriver(out string) string {
+	drvs := publishedDrivers(out)
+	if len(drvs) == 0 {
+		return ""
+	}
+	return drvs[0]
+}
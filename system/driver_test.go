@@ -0,0 +1,51 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPublishedDrivers(t *testing.T) {
+	for _, tt := range []struct {
+		desc, out string
+		want      []string
+	}{
+		{"add-driver", `Microsoft PnP Utility
+
+Adding driver package:  foo.inf
+Driver package added successfully.
+Published Name:         oem12.inf
+Driver package installed on matching devices.
+`, []string{"oem12.inf"}},
+		{"localized", `Treiberpaket wird hinzugefügt:  foo.inf
+Veröffentlichter Name:  OEM7.INF
+`, []string{"oem7.inf"}},
+		{"enum-drivers", `Published Name:     oem0.inf
+Original Name:      prnms001.inf
+
+Published Name:     oem3.inf
+Original Name:      foo.inf
+`, []string{"oem0.inf", "oem3.inf"}},
+		{"failed", "Adding driver package:  foo.inf\nFailed to add driver package: The hash for the file is not present.\n", nil},
+	} {
+		if got := publishedDrivers(tt.out); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: publishedDrivers = %q, want %q", tt.desc, got, tt.want)
+		}
+	}
+	if got := publishedDriver("Published Name: oem12.inf"); got != "oem12.inf" {
+		t.Errorf("publishedDriver = %q, want oem12.inf", got)
+	}
+}
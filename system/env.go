@@ -0,0 +1,89 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+)
+
+// scriptEnv returns the environment variables passed to the scripts of a
+// package unpacked in dir, prev is the version being upgraded from, if any.
+// Variables set on the script itself come last so they take precedence.
+func scriptEnv(dir string, ps *goolib.PkgSpec, prev string, ef goolib.ExecFile) []string {
+	env := []string{
+		"GOOGET_ROOT=" + os.Getenv("GooGetRoot"),
+		"GOOGET_CACHE=" + filepath.Dir(dir),
+		"GOOGET_PACKAGE_DIR=" + dir,
+		"GOOGET_PACKAGE_NAME=" + ps.Name,
+		"GOOGET_PACKAGE_VERSION=" + ps.Version,
+		"GOOGET_PACKAGE_ARCH=" + ps.Arch,
+	}
+	if prev != "" {
+		env = append(env, "GOOGET_PREVIOUS_VERSION="+prev)
+	}
+	return append(env, ef.Env...)
+}
+
+// installer returns the script to run to install ps and a name for it, the
+// Upgrade script is used in place of Install when upgrading from prev if the
+// package has one.
+func installer(ps *goolib.PkgSpec, prev string) (goolib.ExecFile, string) {
+	if prev != "" && ps.Upgrade != nil && ps.Upgrade.Path != "" {
+		return *ps.Upgrade, "upgrade"
+	}
+	return ps.Install, "install"
+}
+
+// checkPayload returns an error if the file of ef, in the package unpacked
+// in dir, does not have the checksum pinned in the package spec.
+func checkPayload(dir string, ef goolib.ExecFile) error {
+	if ef.Checksum == "" {
+		return nil
+	}
+	f, err := oswrap.Open(filepath.Join(dir, ef.Path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if got := goolib.Checksum(f); !strings.EqualFold(got, ef.Checksum) {
+		return fmt.Errorf("checksum of %q is %s but the package spec pins %s, the package may have been tampered with", ef.Path, got, ef.Checksum)
+	}
+	return nil
+}
+
+// command returns an exec.Cmd for name that runs with env added to the
+// environment of this process.
+func command(env []string, name string, args ...string) *exec.Cmd {
+	c := exec.Command(name, args...)
+	c.Env = append(os.Environ(), env...)
+	return c
+}
+
+// script returns an exec.Cmd running the script s with the interpreter ipr,
+// as goolib.Exec would, with env added to the environment of this process.
+func script(env []string, s, ipr string, args []string) (*exec.Cmd, error) {
+	c, err := goolib.ScriptCommand(s, ipr, args)
+	if err != nil {
+		return nil, err
+	}
+	c.Env = append(os.Environ(), env...)
+	return c, nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/googet/goolib"
+)
+
+func TestScriptEnv(t *testing.T) {
+	if err := os.Setenv("GooGetRoot", "/googet"); err != nil {
+		t.Fatalf("error setting environment variable: %v", err)
+	}
+	dir := filepath.Join("/googet", "cache", "foo.noarch.2.0.0@1")
+	ps := &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "2.0.0@1"}
+	got := scriptEnv(dir, ps, "1.0.0@1", goolib.ExecFile{Env: []string{"FOO=bar"}})
+	want := []string{
+		"GOOGET_ROOT=/googet",
+		"GOOGET_CACHE=" + filepath.Join("/googet", "cache"),
+		"GOOGET_PACKAGE_DIR=" + dir,
+		"GOOGET_PACKAGE_NAME=foo",
+		"GOOGET_PACKAGE_VERSION=2.0.0@1",
+		"GOOGET_PACKAGE_ARCH=noarch",
+		"GOOGET_PREVIOUS_VERSION=1.0.0@1",
+		"FOO=bar",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("scriptEnv returned %q, want %q", got, want)
+	}
+}
+
+func TestInstaller(t *testing.T) {
+	up := &goolib.ExecFile{Path: "upgrade.ps1"}
+	table := []struct {
+		upgrade  *goolib.ExecFile
+		prev     string
+		wantPath string
+		wantName string
+	}{
+		{nil, "", "install.ps1", "install"},
+		{nil, "1.0.0@1", "install.ps1", "install"},
+		{up, "", "install.ps1", "install"},
+		{up, "1.0.0@1", "upgrade.ps1", "upgrade"},
+		{&goolib.ExecFile{}, "1.0.0@1", "install.ps1", "install"},
+	}
+	for _, tt := range table {
+		ps := &goolib.PkgSpec{Install: goolib.ExecFile{Path: "install.ps1"}, Upgrade: tt.upgrade}
+		ef, name := installer(ps, tt.prev)
+		if ef.Path != tt.wantPath || name != tt.wantName {
+			t.Errorf("installer(%+v, %q) returned %q, %q, want %q, %q", tt.upgrade, tt.prev, ef.Path, name, tt.wantPath, tt.wantName)
+		}
+	}
+}
+
+func TestCheckPayload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "setup.exe"), []byte("installer"), 0644); err != nil {
+		t.Fatalf("error writing installer: %v", err)
+	}
+	sum := goolib.Checksum(strings.NewReader("installer"))
+
+	table := []struct {
+		ef  goolib.ExecFile
+		err bool
+	}{
+		{goolib.ExecFile{Path: "setup.exe"}, false},
+		{goolib.ExecFile{Path: "setup.exe", Checksum: sum}, false},
+		{goolib.ExecFile{Path: "setup.exe", Checksum: strings.ToUpper(sum)}, false},
+		{goolib.ExecFile{Path: "setup.exe", Checksum: goolib.Checksum(strings.NewReader("tampered"))}, true},
+		{goolib.ExecFile{Path: "missing.exe", Checksum: sum}, true},
+	}
+	for _, tt := range table {
+		if err := checkPayload(dir, tt.ef); (err != nil) != tt.err {
+			t.Errorf("checkPayload(%+v) returned %v, want error: %v", tt.ef, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"fmt"
+
+	"github.com/google/googet/goolib"
+	"github.com/google/logger"
+)
+
+// The Defender operations, replaced in tests.
+var (
+	mpPreference = setExclusions
+	refused      = exclusionsRefused
+)
+
+// ApplyExclusions applies the Defender exclusions requested by ps and
+// returns them, or nil if there are none or policy refuses them. They are
+// applied whether or not the package has an installer.
+func ApplyExclusions(ps *goolib.PkgSpec) (*goolib.Exclusions, error) {
+	ex := ps.Exclusions
+	if ex == nil || (len(ex.Paths) == 0 && len(ex.Processes) == 0) {
+		return nil, nil
+	}
+	if refused() {
+		logger.Warningf("Not applying Defender exclusions requested by %s, refused by policy.", ps.Name)
+		return nil, nil
+	}
+	logger.Infof("Applying Defender exclusions for %s: paths %q, processes %q", ps.Name, ex.Paths, ex.Processes)
+	if err := mpPreference("Add-MpPreference", *ex); err != nil {
+		return nil, fmt.Errorf("error applying Defender exclusions: %v", err)
+	}
+	applied := *ex
+	return &applied, nil
+}
+
+// RemoveExclusions removes the Defender exclusions ex applied for a package,
+// whether or not the package has an uninstaller.
+func RemoveExclusions(ex *goolib.Exclusions) error {
+	if ex == nil || (len(ex.Paths) == 0 && len(ex.Processes) == 0) {
+		return nil
+	}
+	logger.Infof("Removing Defender exclusions: paths %q, processes %q", ex.Paths, ex.Processes)
+	if err := mpPreference("Remove-MpPreference", *ex); err != nil {
+		return fmt.Errorf("error removing Defender exclusions: %v", err)
+	}
+	return nil
+}
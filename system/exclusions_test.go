@@ -0,0 +1,64 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/googet/goolib"
+)
+
+func TestExclusions(t *testing.T) {
+	defer func(mp func(string, goolib.Exclusions) error, rf func() bool) { mpPreference, refused = mp, rf }(mpPreference, refused)
+	var calls []string
+	mpPreference = func(cmd string, ex goolib.Exclusions) error {
+		calls = append(calls, cmd)
+		return nil
+	}
+	refused = func() bool { return false }
+
+	// A package with only files and no installer or uninstaller.
+	ex := &goolib.Exclusions{Paths: []string{`C:\foo`}, Processes: []string{"foo.exe"}}
+	ps := &goolib.PkgSpec{Name: "foo", Files: map[string]string{"foo.exe": `C:\foo`}, Exclusions: ex}
+	got, err := ApplyExclusions(ps)
+	if err != nil {
+		t.Fatalf("ApplyExclusions: %v", err)
+	}
+	if !reflect.DeepEqual(got, ex) {
+		t.Errorf("ApplyExclusions = %+v, want %+v", got, ex)
+	}
+	if err := RemoveExclusions(got); err != nil {
+		t.Fatalf("RemoveExclusions: %v", err)
+	}
+	if want := []string{"Add-MpPreference", "Remove-MpPreference"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("Defender cmdlets run = %q, want %q", calls, want)
+	}
+
+	// Nothing is run for packages without exclusions or refused by policy.
+	calls = nil
+	if got, err := ApplyExclusions(&goolib.PkgSpec{Name: "bar"}); got != nil || err != nil {
+		t.Errorf("ApplyExclusions without exclusions = %+v, %v, want nil", got, err)
+	}
+	refused = func() bool { return true }
+	if got, err := ApplyExclusions(ps); got != nil || err != nil {
+		t.Errorf("ApplyExclusions refused by policy = %+v, %v, want nil", got, err)
+	}
+	if err := RemoveExclusions(nil); err != nil {
+		t.Errorf("RemoveExclusions(nil): %v", err)
+	}
+	if calls != nil {
+		t.Errorf("Defender cmdlets run = %q, want none", calls)
+	}
+}
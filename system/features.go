@@ -0,0 +1,118 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"fmt"
+
+	"github.com/google/googet/goolib"
+	"github.com/google/logger"
+)
+
+// The feature and capability operations of EnableFeatures and
+// DisableFeatures, replaced in tests. The set functions report whether a
+// reboot is needed to finish.
+var (
+	setFeature      = setWindowsFeature
+	capabilityAdded = windowsCapabilityAdded
+	setCapability   = setWindowsCapability
+)
+
+// EnableFeatures enables the Windows features and capabilities ps requests
+// that are not enabled yet. It returns those it enabled, nil if none, and
+// whether a reboot is needed to finish. On error the features enabled so far
+// are returned with it.
+func EnableFeatures(ps *goolib.PkgSpec) (*goolib.WindowsFeatures, bool, error) {
+	wf := ps.WindowsFeatures
+	if wf.Empty() {
+		return nil, false, nil
+	}
+	var enabled goolib.WindowsFeatures
+	var reboot bool
+	done := func() *goolib.WindowsFeatures {
+		if enabled.Empty() {
+			return nil
+		}
+		return &enabled
+	}
+	for _, f := range wf.Features {
+		on, err := featureEnabled(f)
+		if err != nil {
+			return done(), reboot, fmt.Errorf("error checking Windows feature %q: %v", f, err)
+		}
+		if on {
+			continue
+		}
+		logger.Infof("Enabling Windows feature %q for %s", f, ps.Name)
+		rb, err := setFeature(f, true)
+		if err != nil {
+			return done(), reboot, fmt.Errorf("error enabling Windows feature %q: %v", f, err)
+		}
+		reboot = reboot || rb
+		enabled.Features = append(enabled.Features, f)
+	}
+	for _, c := range wf.Capabilities {
+		on, err := capabilityAdded(c)
+		if err != nil {
+			return done(), reboot, fmt.Errorf("error checking Windows capability %q: %v", c, err)
+		}
+		if on {
+			continue
+		}
+		logger.Infof("Adding Windows capability %q for %s", c, ps.Name)
+		rb, err := setCapability(c, true)
+		if err != nil {
+			return done(), reboot, fmt.Errorf("error adding Windows capability %q: %v", c, err)
+		}
+		reboot = reboot || rb
+		enabled.Capabilities = append(enabled.Capabilities, c)
+	}
+	return done(), reboot, nil
+}
+
+// DisableFeatures disables the Windows features and removes the capabilities
+// in wf, in reverse order of enabling them. It carries on past failures and
+// returns the first error and whether a reboot is needed to finish.
+func DisableFeatures(wf *goolib.WindowsFeatures) (bool, error) {
+	if wf.Empty() {
+		return false, nil
+	}
+	var reboot bool
+	var first error
+	for i := len(wf.Capabilities) - 1; i >= 0; i-- {
+		c := wf.Capabilities[i]
+		logger.Infof("Removing Windows capability %q", c)
+		rb, err := setCapability(c, false)
+		if err != nil {
+			logger.Errorf("Error removing Windows capability %q: %v", c, err)
+			if first == nil {
+				first = fmt.Errorf("error removing Windows capability %q: %v", c, err)
+			}
+		}
+		reboot = reboot || rb
+	}
+	for i := len(wf.Features) - 1; i >= 0; i-- {
+		f := wf.Features[i]
+		logger.Infof("Disabling Windows feature %q", f)
+		rb, err := setFeature(f, false)
+		if err != nil {
+			logger.Errorf("Error disabling Windows feature %q: %v", f, err)
+			if first == nil {
+				first = fmt.Errorf("error disabling Windows feature %q: %v", f, err)
+			}
+		}
+		reboot = reboot || rb
+	}
+	return reboot, first
+}
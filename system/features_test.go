@@ -0,0 +1,72 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/googet/goolib"
+)
+
+func TestEnableDisableFeatures(t *testing.T) {
+	defer func(fe, ca func(string) (bool, error), sf, sc func(string, bool) (bool, error)) {
+		featureEnabled, capabilityAdded, setFeature, setCapability = fe, ca, sf, sc
+	}(featureEnabled, capabilityAdded, setFeature, setCapability)
+	on := map[string]bool{"NetFx3": true}
+	var calls []string
+	set := func(name string, enable bool) (bool, error) {
+		if name == "Broken" {
+			return false, errors.New("failed")
+		}
+		calls = append(calls, name)
+		on[name] = enable
+		return name == "IIS-WebServer", nil
+	}
+	featureEnabled = func(name string) (bool, error) { return on[name], nil }
+	capabilityAdded = featureEnabled
+	setFeature, setCapability = set, set
+
+	ps := &goolib.PkgSpec{Name: "foo", WindowsFeatures: &goolib.WindowsFeatures{
+		Features:     []string{"NetFx3", "IIS-WebServer"},
+		Capabilities: []string{"OpenSSH.Server~~~~0.0.1.0"},
+	}}
+	got, reboot, err := EnableFeatures(ps)
+	if err != nil {
+		t.Fatalf("EnableFeatures: %v", err)
+	}
+	want := &goolib.WindowsFeatures{Features: []string{"IIS-WebServer"}, Capabilities: []string{"OpenSSH.Server~~~~0.0.1.0"}}
+	if !reflect.DeepEqual(got, want) || !reboot {
+		t.Errorf("EnableFeatures = %+v, %v, want %+v, true", got, reboot, want)
+	}
+
+	// Nothing to enable the second time.
+	if got, _, err := EnableFeatures(ps); err != nil || got != nil {
+		t.Errorf("EnableFeatures of enabled features = %+v, %v, want nil", got, err)
+	}
+
+	// Features are disabled in reverse order, past failures.
+	calls = nil
+	reboot, err = DisableFeatures(&goolib.WindowsFeatures{Features: []string{"IIS-WebServer", "Broken"}, Capabilities: []string{"OpenSSH.Server~~~~0.0.1.0"}})
+	if err == nil || !reboot {
+		t.Errorf("DisableFeatures = %v, %v, want true and an error", reboot, err)
+	}
+	if wc := []string{"OpenSSH.Server~~~~0.0.1.0", "IIS-WebServer"}; !reflect.DeepEqual(calls, wc) {
+		t.Errorf("DisableFeatures changed %q, want %q", calls, wc)
+	}
+	if on["IIS-WebServer"] || !on["NetFx3"] {
+		t.Errorf("after DisableFeatures features are %v, want only NetFx3 enabled", on)
+	}
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/oswrap"
+	"github.com/google/logger"
+)
+
+// RunPostReboot runs the post-reboot action of an installed package, if it
+// has one.
+func RunPostReboot(st client.PackageState) error {
+	pr := st.PackageSpec.PostReboot
+	if pr == nil || pr.Path == "" {
+		return nil
+	}
+
+	logger.Infof("Running post-reboot action: %q", pr.Path)
+	out, err := oswrap.Create(filepath.Join(st.UnpackDir, "googet_postreboot.log"))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := out.Close(); err != nil {
+			logger.Error(err)
+		}
+	}()
+	if err := checkPayload(st.UnpackDir, *pr); err != nil {
+		return err
+	}
+	env := scriptEnv(st.UnpackDir, st.PackageSpec, "", *pr)
+	s := filepath.Join(st.UnpackDir, pr.Path)
+	var c *exec.Cmd
+	if strings.EqualFold(filepath.Ext(s), ".exe") {
+		c = command(env, s, pr.Args...)
+	} else if c, err = script(env, s, pr.Interpreter, pr.Args); err != nil {
+		return err
+	}
+	return runScript(st.PackageSpec.Name, c, pr.ExitCodes, out)
+}
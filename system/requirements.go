@@ -0,0 +1,104 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"fmt"
+	"strings"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/google/googet/goolib"
+)
+
+// The checks of CheckRequirements, replaced in tests.
+var (
+	osBuild          = currentBuild
+	featureEnabled   = windowsFeatureEnabled
+	registryKeyFound = registryKeyExists
+	freeSpace        = DiskSpace
+)
+
+// RequirementError is returned when a machine does not meet the requirements
+// of a package, it lists every unmet requirement and how to meet it.
+type RequirementError struct {
+	Package string
+	Unmet   []string
+}
+
+func (e *RequirementError) Error() string {
+	return fmt.Sprintf("%s can not be installed on this machine:\n  %s", e.Package, strings.Join(e.Unmet, "\n  "))
+}
+
+// CheckRequirements checks the requirements of ps, installed under root or
+// the system drive if root is empty, and returns a RequirementError if the
+// machine does not meet them.
+func CheckRequirements(ps *goolib.PkgSpec, root string) error {
+	r := ps.Requirements
+	if r == nil {
+		return nil
+	}
+	var unmet []string
+	add := func(format string, a ...interface{}) {
+		unmet = append(unmet, fmt.Sprintf(format, a...))
+	}
+
+	if r.MinOSBuild > 0 {
+		b, err := osBuild()
+		switch {
+		case err != nil:
+			add("requires OS build %d or later, the build of this machine can not be determined: %v", r.MinOSBuild, err)
+		case b < r.MinOSBuild:
+			add("requires OS build %d or later, this machine runs build %d; upgrade the OS first", r.MinOSBuild, b)
+		}
+	}
+	for _, f := range r.Features {
+		on, err := featureEnabled(f)
+		switch {
+		case err != nil:
+			add("requires the Windows feature %q, which can not be checked: %v", f, err)
+		case !on:
+			add("requires the Windows feature %q; enable it with: Enable-WindowsOptionalFeature -Online -FeatureName %s", f, f)
+		}
+	}
+	for _, k := range r.RegistryKeys {
+		ok, err := registryKeyFound(k)
+		switch {
+		case err != nil:
+			add("requires the registry key %s, which can not be checked: %v", k, err)
+		case !ok:
+			add("requires the registry key %s, which does not exist; install the software that creates it first", k)
+		}
+	}
+	need, err := r.FreeSpace()
+	if err != nil {
+		add("%v", err)
+	}
+	if need > 0 {
+		if root == "" {
+			root = systemRoot()
+		}
+		_, free, err := freeSpace(root)
+		switch {
+		case err != nil:
+			add("requires %s free at %s, which can not be checked: %v", humanize.IBytes(need), root, err)
+		case free < need:
+			add("requires %s free at %s but only %s is available; free up %s", humanize.IBytes(need), root, humanize.IBytes(free), humanize.IBytes(need-free))
+		}
+	}
+
+	if unmet == nil {
+		return nil
+	}
+	return &RequirementError{Package: fmt.Sprintf("%s.%s.%s", ps.Name, ps.Arch, ps.Version), Unmet: unmet}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/googet/goolib"
+)
+
+func TestCheckRequirements(t *testing.T) {
+	defer func(b func() (int, error), f, k func(string) (bool, error), s func(string) (string, uint64, error)) {
+		osBuild, featureEnabled, registryKeyFound, freeSpace = b, f, k, s
+	}(osBuild, featureEnabled, registryKeyFound, freeSpace)
+	osBuild = func() (int, error) { return 17763, nil }
+	featureEnabled = func(name string) (bool, error) { return name == "NetFx3", nil }
+	registryKeyFound = func(key string) (bool, error) { return key == `HKLM\SOFTWARE\Present`, nil }
+	var spacePath string
+	freeSpace = func(p string) (string, uint64, error) {
+		spacePath = p
+		return "c:", 1 << 30, nil
+	}
+
+	for _, tt := range []struct {
+		desc  string
+		req   *goolib.Requirements
+		root  string
+		unmet []string
+	}{
+		{"no requirements", nil, "", nil},
+		{"all met", &goolib.Requirements{
+			MinOSBuild:   14393,
+			Features:     []string{"NetFx3"},
+			RegistryKeys: []string{`HKLM\SOFTWARE\Present`},
+			MinFreeSpace: "512MiB",
+		}, `D:\`, nil},
+		{"none met", &goolib.Requirements{
+			MinOSBuild:   20348,
+			Features:     []string{"IIS-WebServer"},
+			RegistryKeys: []string{`HKLM\SOFTWARE\Missing`},
+			MinFreeSpace: "2GiB",
+		}, `D:\`, []string{
+			"requires OS build 20348 or later, this machine runs build 17763; upgrade the OS first",
+			`requires the Windows feature "IIS-WebServer"; enable it with: Enable-WindowsOptionalFeature -Online -FeatureName IIS-WebServer`,
+			`requires the registry key HKLM\SOFTWARE\Missing, which does not exist; install the software that creates it first`,
+			`requires 2.0 GiB free at D:\ but only 1.0 GiB is available; free up 1.0 GiB`,
+		}},
+	} {
+		ps := &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "1.0.0@1", Requirements: tt.req}
+		err := CheckRequirements(ps, tt.root)
+		if tt.unmet == nil {
+			if err != nil {
+				t.Errorf("%s: CheckRequirements = %v, want nil", tt.desc, err)
+			}
+			continue
+		}
+		re, ok := err.(*RequirementError)
+		if !ok {
+			t.Errorf("%s: CheckRequirements = %v, want a RequirementError", tt.desc, err)
+			continue
+		}
+		if re.Package != "foo.noarch.1.0.0@1" || !reflect.DeepEqual(re.Unmet, tt.unmet) {
+			t.Errorf("%s: CheckRequirements = %+v, want unmet %q", tt.desc, re, tt.unmet)
+		}
+	}
+
+	// Free space is checked on the system drive if there is no install root.
+	ps := &goolib.PkgSpec{Name: "foo", Requirements: &goolib.Requirements{MinFreeSpace: "1MiB"}}
+	if err := CheckRequirements(ps, ""); err != nil || spacePath != systemRoot() {
+		t.Errorf("CheckRequirements without root = %v, checked %q, want nil checking %q", err, spacePath, systemRoot())
+	}
+}
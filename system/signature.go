@@ -0,0 +1,81 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+	"github.com/google/logger"
+)
+
+// SignaturePolicy controls the Authenticode checks of package installers.
+type SignaturePolicy struct {
+	// Check checks installer signatures and records the result, a failed
+	// check only logs a warning.
+	Check bool
+	// Require fails the install of packages whose installer fails the check.
+	Require bool
+	// Publishers, if set, are the only signers an installer may have.
+	Publishers []string
+}
+
+var signaturePolicy SignaturePolicy
+
+// SetSignaturePolicy sets the policy CheckInstaller applies.
+func SetSignaturePolicy(p SignaturePolicy) {
+	signaturePolicy = p
+}
+
+// signedExts are the installer types whose signatures are checked.
+var signedExts = []string{".exe", ".msi", ".msp", ".msu"}
+
+// CheckInstaller checks the signature of the installer of ps, unpacked in
+// dir, that Install runs when upgrading from prev. It returns the result of
+// the check, or nil if the policy or installer type needs none, and an error
+// if the policy requires a valid signature and the installer does not have
+// one.
+func CheckInstaller(dir string, ps *goolib.PkgSpec, prev string) (*client.Signature, error) {
+	p := signaturePolicy
+	if !p.Check && !p.Require && len(p.Publishers) == 0 {
+		return nil, nil
+	}
+	in, _ := installer(ps, prev)
+	if in.Path == "" || !goolib.ContainsString(strings.ToLower(filepath.Ext(in.Path)), signedExts) {
+		return nil, nil
+	}
+
+	sig := &client.Signature{Path: in.Path}
+	publisher, err := authenticode(filepath.Join(dir, in.Path))
+	switch {
+	case err != nil:
+		sig.Error = err.Error()
+	case len(p.Publishers) > 0 && !goolib.ContainsString(publisher, p.Publishers):
+		sig.Publisher = publisher
+		sig.Error = fmt.Sprintf("publisher %q is not allowed", publisher)
+	default:
+		sig.Publisher = publisher
+		sig.Valid = true
+		logger.Infof("Installer %q is signed by %q", in.Path, publisher)
+		return sig, nil
+	}
+	if p.Require {
+		return sig, fmt.Errorf("signature check of installer %q failed: %s", in.Path, sig.Error)
+	}
+	logger.Warningf("Signature check of installer %q failed: %s", in.Path, sig.Error)
+	return sig, nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/googet/goolib"
+)
+
+func TestCheckInstaller(t *testing.T) {
+	defer SetSignaturePolicy(SignaturePolicy{})
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "setup.exe"), []byte("not signed"), 0644); err != nil {
+		t.Fatalf("error writing installer: %v", err)
+	}
+	exe := &goolib.PkgSpec{Name: "foo", Install: goolib.ExecFile{Path: "setup.exe"}}
+	script := &goolib.PkgSpec{Name: "foo", Install: goolib.ExecFile{Path: "install.ps1"}}
+
+	table := []struct {
+		name    string
+		policy  SignaturePolicy
+		ps      *goolib.PkgSpec
+		checked bool
+		err     bool
+	}{
+		{"no policy", SignaturePolicy{}, exe, false, false},
+		{"check", SignaturePolicy{Check: true}, exe, true, false},
+		{"publishers", SignaturePolicy{Publishers: []string{"Google LLC"}}, exe, true, false},
+		{"require", SignaturePolicy{Require: true}, exe, true, true},
+		{"require script", SignaturePolicy{Require: true}, script, false, false},
+	}
+	for _, tt := range table {
+		SetSignaturePolicy(tt.policy)
+		sig, err := CheckInstaller(dir, tt.ps, "")
+		if (err != nil) != tt.err {
+			t.Errorf("%s: CheckInstaller returned error %v, want error: %v", tt.name, err, tt.err)
+		}
+		if (sig != nil) != tt.checked {
+			t.Errorf("%s: CheckInstaller returned %+v, want a result: %v", tt.name, sig, tt.checked)
+			continue
+		}
+		if sig != nil && (sig.Valid || sig.Error == "" || sig.Path != "setup.exe") {
+			t.Errorf("%s: CheckInstaller returned %+v, want an invalid signature for setup.exe", tt.name, sig)
+		}
+	}
+}
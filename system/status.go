@@ -0,0 +1,72 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/oswrap"
+)
+
+// statusFile returns the file the install script name of the package
+// unpacked in dir reports its status in, passed to it as GOOGET_STATUS_FILE.
+func statusFile(dir, name string) string {
+	return filepath.Join(dir, "googet_"+name+".status")
+}
+
+// readStatus adds the status an install script wrote to the file p to res.
+// Each line of the file is one of:
+//
+//	reboot               the install is only finished by a reboot
+//	restarted <service>  the script restarted service
+//	warning <message>    something the user should look at
+//
+// Other lines are kept as warnings. A script that wrote nothing reported
+// nothing.
+func readStatus(p string, res *client.ScriptResult) error {
+	f, err := oswrap.Open(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if l == "" {
+			continue
+		}
+		kw, arg := l, ""
+		if i := strings.IndexAny(l, " \t"); i != -1 {
+			kw, arg = l[:i], strings.TrimSpace(l[i+1:])
+		}
+		switch {
+		case strings.EqualFold(kw, "reboot") && arg == "":
+			res.RebootRequired = true
+		case strings.EqualFold(kw, "restarted") && arg != "":
+			res.Services = append(res.Services, arg)
+		case strings.EqualFold(kw, "warning") && arg != "":
+			res.Warnings = append(res.Warnings, arg)
+		default:
+			res.Warnings = append(res.Warnings, l)
+		}
+	}
+	return s.Err()
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/googet/client"
+)
+
+func TestReadStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	p := statusFile(dir, "install")
+
+	var res client.ScriptResult
+	if err := readStatus(p, &res); err != nil {
+		t.Fatalf("readStatus of a missing file: %v", err)
+	}
+	if !reflect.DeepEqual(res, client.ScriptResult{}) {
+		t.Errorf("readStatus of a missing file = %+v, want nothing reported", res)
+	}
+
+	status := "restarted spooler\r\n\nREBOOT\nwarning  config kept at C:\\old.conf \nrestarted\nsomething else\n"
+	if err := ioutil.WriteFile(p, []byte(status), 0644); err != nil {
+		t.Fatalf("error writing status file: %v", err)
+	}
+	res = client.ScriptResult{Log: filepath.Join(dir, "install.log")}
+	if err := readStatus(p, &res); err != nil {
+		t.Fatalf("readStatus: %v", err)
+	}
+	want := client.ScriptResult{
+		Log:            filepath.Join(dir, "install.log"),
+		RebootRequired: true,
+		Services:       []string{"spooler"},
+		Warnings:       []string{`config kept at C:\old.conf`, "restarted", "something else"},
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("readStatus() = %+v, want %+v", res, want)
+	}
+}
@@ -17,37 +17,63 @@ limitations under the License.
 package system
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/google/googet/client"
 	"github.com/google/googet/goolib"
+	"github.com/google/googet/msg"
 	"github.com/google/googet/oswrap"
 	"github.com/google/logger"
 )
 
-// Install performs a system specfic install given a package extraction directory and an PkgSpec struct.
-func Install(dir string, ps *goolib.PkgSpec) error {
-	in := ps.Install
+// Install performs a system specfic install given a package extraction directory, a PkgSpec struct,
+// the files installed from the package and the version being upgraded from, if any.
+// Messages for the user are reported to rp. It returns what the install script
+// reported, nil if the package has none.
+func Install(dir string, ps *goolib.PkgSpec, insFiles map[string]string, prev string, rp msg.Reporter) (*client.ScriptResult, error) {
+	in, name := installer(ps, prev)
 	if in.Path == "" {
 		logger.Info("No installer specified")
-		return nil
+		return nil, nil
 	}
 
-	logger.Infof("Running install: %q", in.Path)
-	out, err := oswrap.Create(filepath.Join(dir, "googet_install.log"))
+	logger.Infof("Running %s: %q", name, in.Path)
+	res := &client.ScriptResult{Log: filepath.Join(dir, "googet_"+name+".log")}
+	out, err := oswrap.Create(res.Log)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer func() {
 		if err := out.Close(); err != nil {
 			logger.Error(err)
 		}
 	}()
-	if err := goolib.Exec(filepath.Join(dir, in.Path), in.Args, in.ExitCodes, out); err != nil {
-		return fmt.Errorf("error running install: %v", err)
+	if err := checkPayload(dir, in); err != nil {
+		return nil, fmt.Errorf("error running %s: %v", name, err)
 	}
-	return nil
+	status := statusFile(dir, name)
+	env := append(scriptEnv(dir, ps, prev, in), "GOOGET_STATUS_FILE="+status)
+	c, err := script(env, filepath.Join(dir, in.Path), in.Interpreter, in.Args)
+	if err == nil {
+		err = runScript(ps.Name, c, in.ExitCodes, out)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error running %s: %v", name, err)
+	}
+	if err := readStatus(status, res); err != nil {
+		logger.Errorf("Error reading the status %s reported: %v", name, err)
+	}
+	return res, nil
 }
 
 // Uninstall performs a system specfic uninstall given a packages PackageState.
@@ -69,7 +95,70 @@ func Uninstall(st client.PackageState) error {
 			logger.Error(err)
 		}
 	}()
-	return goolib.Exec(filepath.Join(st.UnpackDir, un.Path), un.Args, un.ExitCodes, out)
+	if err := checkPayload(st.UnpackDir, un); err != nil {
+		return err
+	}
+	env := scriptEnv(st.UnpackDir, st.PackageSpec, "", un)
+	c, err := script(env, filepath.Join(st.UnpackDir, un.Path), un.Interpreter, un.Args)
+	if err != nil {
+		return err
+	}
+	return runScript(st.PackageSpec.Name, c, un.ExitCodes, out)
+}
+
+// Verify runs the verify script of an installed package, if it has one.
+func Verify(st client.PackageState) error {
+	v := st.PackageSpec.Verify
+	if v == nil || v.Path == "" {
+		return nil
+	}
+
+	logger.Infof("Running verify: %q", v.Path)
+	out, err := oswrap.Create(filepath.Join(st.UnpackDir, "googet_verify.log"))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := out.Close(); err != nil {
+			logger.Error(err)
+		}
+	}()
+	if err := checkPayload(st.UnpackDir, *v); err != nil {
+		return err
+	}
+	env := scriptEnv(st.UnpackDir, st.PackageSpec, "", *v)
+	c, err := script(env, filepath.Join(st.UnpackDir, v.Path), v.Interpreter, v.Args)
+	if err != nil {
+		return err
+	}
+	return runScript(st.PackageSpec.Name, c, v.ExitCodes, out)
+}
+
+// setContext makes c run as the user ctx, or nobody for RestrictedContext.
+func setContext(c *exec.Cmd, ctx string) (func(), error) {
+	name := ctx
+	if ctx == RestrictedContext {
+		name = "nobody"
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	c.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}}
+	return func() {}, nil
+}
+
+// authenticode always fails, Authenticode signatures only exist on Windows.
+func authenticode(p string) (string, error) {
+	return "", errors.New("Authenticode signatures can only be checked on Windows")
 }
 
 // InstallableArchs returns a slice of archs supported by this machine.
@@ -77,3 +166,129 @@ func InstallableArchs() ([]string, error) {
 	// Just return all archs as Linux builds are currently just used for testing.
 	return []string{"noarch", "x86_64", "x86_32", "arm"}, nil
 }
+
+// UninstallEntries returns no packages, Linux has no uninstall entries.
+func UninstallEntries(userScope bool) ([]string, error) {
+	return nil, nil
+}
+
+// DiskSpace returns an identifier of the volume that path, or its closest
+// existing ancestor, is on and the bytes free on it for unprivileged users.
+func DiskSpace(path string) (string, uint64, error) {
+	p := existingAncestor(path)
+	var st syscall.Stat_t
+	if err := syscall.Stat(p, &st); err != nil {
+		return "", 0, err
+	}
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(p, &fs); err != nil {
+		return "", 0, err
+	}
+	return fmt.Sprint(st.Dev), fs.Bavail * uint64(fs.Bsize), nil
+}
+
+// errWindowsOnly is returned by checks of package requirements that only
+// exist on Windows.
+var errWindowsOnly = errors.New("only available on Windows")
+
+// currentBuild returns the OS build, Linux has none packages can require.
+func currentBuild() (int, error) {
+	return 0, errWindowsOnly
+}
+
+// windowsFeatureEnabled always fails, Linux has no Windows features.
+func windowsFeatureEnabled(name string) (bool, error) {
+	return false, errWindowsOnly
+}
+
+// setWindowsFeature always fails, Linux has no Windows features.
+func setWindowsFeature(name string, on bool) (bool, error) {
+	return false, errWindowsOnly
+}
+
+// windowsCapabilityAdded always fails, Linux has no Windows capabilities.
+func windowsCapabilityAdded(name string) (bool, error) {
+	return false, errWindowsOnly
+}
+
+// setWindowsCapability always fails, Linux has no Windows capabilities.
+func setWindowsCapability(name string, on bool) (bool, error) {
+	return false, errWindowsOnly
+}
+
+// certificateInStore always fails, Linux has no certificate stores.
+func certificateInStore(store, thumbprint string) (bool, error) {
+	return false, errWindowsOnly
+}
+
+// addCertificate always fails, Linux has no certificate stores.
+func addCertificate(store string, der []byte) error {
+	return errWindowsOnly
+}
+
+// deleteCertificate always fails, Linux has no certificate stores.
+func deleteCertificate(store, thumbprint string) error {
+	return errWindowsOnly
+}
+
+// registryKeyExists always fails, Linux has no registry.
+func registryKeyExists(key string) (bool, error) {
+	return false, errWindowsOnly
+}
+
+// exclusionsRefused is false, Linux has no Defender policy.
+func exclusionsRefused() bool {
+	return false
+}
+
+// setExclusions fails for any exclusions, Linux has no Defender.
+func setExclusions(cmd string, ex goolib.Exclusions) error {
+	if len(ex.Paths) == 0 && len(ex.Processes) == 0 {
+		return nil
+	}
+	return errWindowsOnly
+}
+
+// SchedulePostReboot only logs on Linux, which has no scheduler GooGet
+// manages; args have to be run after the next boot by other means.
+func SchedulePostReboot(args []string) error {
+	logger.Infof("Post-reboot actions are pending, run googet %s after the next boot.", strings.Join(args, " "))
+	return nil
+}
+
+// UnschedulePostReboot does nothing on Linux.
+func UnschedulePostReboot() error {
+	return nil
+}
+
+// BootTime returns when the system booted.
+func BootTime() (time.Time, error) {
+	b, err := ioutil.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, l := range strings.Split(string(b), "\n") {
+		if f := strings.Fields(l); len(f) == 2 && f[0] == "btime" {
+			sec, err := strconv.ParseInt(f[1], 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(sec, 0), nil
+		}
+	}
+	return time.Time{}, errors.New("no boot time in /proc/stat")
+}
+
+// systemRoot returns the root of the system volume.
+func systemRoot() string {
+	return "/"
+}
+
+// SetPermission applies the mode in p to path, Linux has no ACLs to apply.
+func SetPermission(path string, p goolib.Permission) error {
+	m, err := p.FileMode()
+	if err != nil || p.Mode == "" {
+		return err
+	}
+	return os.Chmod(path, m)
+}
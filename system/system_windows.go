@@ -17,113 +17,338 @@ limitations under the License.
 package system
 
 import (
+	"bytes"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
 
 	"github.com/StackExchange/wmi"
 	"github.com/google/googet/client"
 	"github.com/google/googet/goolib"
+	"github.com/google/googet/msg"
 	"github.com/google/googet/oswrap"
 	"github.com/google/logger"
+	"golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/registry"
 )
 
-const uninstallBase = `SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall\`
+const (
+	uninstallBase = `SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall\`
+	// Setting the RefuseDefenderExclusions DWORD under policyKey to 1 stops
+	// GooGet from applying Defender exclusions requested by packages.
+	policyKey = `SOFTWARE\Policies\Google\GooGet`
+)
 
 var msiSuccessCodes = []int{1641, 3010}
 
-func addUninstallEntry(dir string, ps *goolib.PkgSpec) error {
+// wusaNotApplicable is the exit code of wusa when an update does not apply
+// to the system (WU_E_NOT_APPLICABLE).
+const wusaNotApplicable = 0x80240017
+
+type win32_QuickFixEngineering struct {
+	HotFixID string
+}
+
+// hotfixInstalled reports whether the Windows update kb is installed.
+func hotfixInstalled(kb string) (bool, error) {
+	var qfe []win32_QuickFixEngineering
+	if err := wmi.Query(wmi.CreateQuery(&qfe, fmt.Sprintf("WHERE HotFixID = '%s'", kb)), &qfe); err != nil {
+		return false, err
+	}
+	return len(qfe) > 0, nil
+}
+
+// installMSU installs a Windows update, updates that are already installed or
+// do not apply to the system are skipped rather than treated as errors. It
+// returns the KB of the update if it is present afterwards, installed now or
+// before, and whether it needs a reboot.
+func installMSU(s string, in goolib.ExecFile, env []string, out io.Writer, rp msg.Reporter) (string, bool, error) {
+	kb := in.KB()
+	if kb != "" {
+		ins, err := hotfixInstalled(kb)
+		if err != nil {
+			logger.Errorf("Error checking if %s is installed: %v", kb, err)
+		}
+		if ins {
+			logger.Infof("%s is already installed, skipping wusa.", kb)
+			rp.Info(msg.UpdateInstalled, kb)
+			return kb, false, nil
+		}
+	}
+	args := append([]string{s, "/quiet", "/norestart"}, in.Args...)
+	c := command(env, "wusa", args...)
+	err := goolib.Run(c, in.ExitCodes, out)
+	if err != nil && c.ProcessState != nil && uint32(c.ProcessState.ExitCode()) == wusaNotApplicable {
+		logger.Infof("Update %q is not applicable to this system.", filepath.Base(s))
+		rp.Info(msg.UpdateNotApplicable, filepath.Base(s))
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return kb, needsReboot(c), nil
+}
+
+// Exit codes of pnputil meaning success: a reboot is needed to finish, or
+// the driver was added but no device uses it.
+const (
+	pnputilReboot    = 3010
+	pnputilNoDevices = 259
+)
+
+// installINF adds the driver s to the driver store and installs it on the
+// devices it matches. It returns the published name of the driver, like
+// oem12.inf, and whether a reboot is needed.
+func installINF(s string, in goolib.ExecFile, env []string, out io.Writer) (string, bool, error) {
+	var buf bytes.Buffer
+	args := append([]string{"/add-driver", s, "/install"}, in.Args...)
+	ec := append([]int{pnputilReboot, pnputilNoDevices}, in.ExitCodes...)
+	c := command(env, "pnputil", args...)
+	if err := goolib.Run(c, ec, io.MultiWriter(out, &buf)); err != nil {
+		return "", false, err
+	}
+	drv := publishedDriver(buf.String())
+	if drv == "" {
+		return "", false, fmt.Errorf("pnputil did not report the published name of %q", filepath.Base(s))
+	}
+	logger.Infof("Driver %q is published as %s", filepath.Base(s), drv)
+	return drv, c.ProcessState.ExitCode() == pnputilReboot, nil
+}
+
+// installedDriver returns the published name of the driver the installer
+// of st added, if any.
+func installedDriver(st client.PackageState) string {
+	if st.Script == nil {
+		return ""
+	}
+	return st.Script.Driver
+}
+
+// deleteDriver uninstalls the published driver drv from the devices using
+// it and deletes it from the driver store.
+func deleteDriver(drv string) error {
+	logger.Infof("Deleting driver %s", drv)
+	return goolib.Run(exec.Command("pnputil", "/delete-driver", drv, "/uninstall"), []int{pnputilReboot}, ioutil.Discard)
+}
+
+// driverPresent reports whether the published driver drv is in the driver
+// store.
+func driverPresent(drv string) (bool, error) {
+	var buf bytes.Buffer
+	if err := goolib.Run(exec.Command("pnputil", "/enum-drivers"), nil, &buf); err != nil {
+		return false, err
+	}
+	for _, d := range publishedDrivers(buf.String()) {
+		if strings.EqualFold(d, drv) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// needsReboot reports whether the msiexec or wusa command c exited with a
+// code meaning success with a reboot needed.
+func needsReboot(c *exec.Cmd) bool {
+	return c.ProcessState != nil && goolib.ContainsInt(c.ProcessState.ExitCode(), msiSuccessCodes)
+}
+
+func addUninstallEntry(dir string, ps *goolib.PkgSpec, insFiles map[string]string) error {
 	reg := uninstallBase + "GooGet - " + ps.Name
 	logger.Infof("Adding uninstall entry %q to registry.", reg)
-	k, _, err := registry.CreateKey(registry.LOCAL_MACHINE, reg, registry.WRITE)
+	k, _, err := registry.CreateKey(uninstallRoot(ps), reg, registry.WRITE)
 	if err != nil {
 		return err
 	}
 	defer k.Close()
 
-	exe := filepath.Join(os.Getenv("GooGetRoot"), "googet.exe")
-
-	table := []struct {
-		name, value string
-	}{
-		{"UninstallString", fmt.Sprintf("%s -noconfirm remove %s", exe, ps.Name)},
-		{"InstallLocation", dir},
-		{"DisplayVersion", ps.Version},
-		{"DisplayName", "GooGet - " + ps.Name},
+	exe := GooGetExe()
+	flags := "-noconfirm"
+	if ps.UserScope() {
+		flags = "-user " + flags
 	}
-	for _, re := range table {
+
+	cmd := fmt.Sprintf("%s %s remove %s", syscall.EscapeArg(exe), flags, ps.Name)
+	for _, re := range uninstallStrings(dir, cmd, ps) {
+		// Values the package no longer sets are left from an earlier
+		// version, remove them.
+		if re.value == "" {
+			if err := k.DeleteValue(re.name); err != nil && err != registry.ErrNotExist {
+				return err
+			}
+			continue
+		}
 		if err := k.SetStringValue(re.name, re.value); err != nil {
 			return err
 		}
 	}
+	for _, re := range uninstallDWords(ps, insFiles) {
+		if err := k.SetDWordValue(re.name, re.value); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func removeUninstallEntry(name string) error {
-	reg := uninstallBase + "GooGet - " + name
+func removeUninstallEntry(ps *goolib.PkgSpec) error {
+	reg := uninstallBase + "GooGet - " + ps.Name
 	logger.Infof("Removing uninstall entry %q from registry.", reg)
-	return registry.DeleteKey(registry.LOCAL_MACHINE, reg)
+	return registry.DeleteKey(uninstallRoot(ps), reg)
+}
+
+func exclusionsRefused() bool {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, policyKey, registry.QUERY_VALUE)
+	if err != nil {
+		return false
+	}
+	defer k.Close()
+	v, _, err := k.GetIntegerValue("RefuseDefenderExclusions")
+	return err == nil && v != 0
+}
+
+// setExclusions runs the Defender preference cmdlet cmd, Add-MpPreference or
+// Remove-MpPreference, for the given exclusions.
+func setExclusions(cmd string, ex goolib.Exclusions) error {
+	if len(ex.Paths) == 0 && len(ex.Processes) == 0 {
+		return nil
+	}
+	quote := func(l []string) string {
+		var q []string
+		for _, s := range l {
+			q = append(q, "'"+strings.Replace(s, "'", "''", -1)+"'")
+		}
+		return strings.Join(q, ",")
+	}
+	args := []string{cmd}
+	if len(ex.Paths) > 0 {
+		args = append(args, "-ExclusionPath", quote(ex.Paths))
+	}
+	if len(ex.Processes) > 0 {
+		args = append(args, "-ExclusionProcess", quote(ex.Processes))
+	}
+	c := exec.Command("powershell", "-ExecutionPolicy", "Bypass", "-NonInteractive", "-NoProfile", "-Command", strings.Join(args, " "))
+	return goolib.Run(c, nil, ioutil.Discard)
+}
+
+// uninstallRoot returns the registry key uninstall entries for ps are kept
+// under, user scoped packages use HKCU so they can be installed without admin
+// rights.
+func uninstallRoot(ps *goolib.PkgSpec) registry.Key {
+	if ps.UserScope() {
+		return registry.CURRENT_USER
+	}
+	return registry.LOCAL_MACHINE
 }
 
-// Install performs a system specfic install given a package extraction directory and a PkgSpec struct.
-func Install(dir string, ps *goolib.PkgSpec) error {
-	in := ps.Install
+// Install performs a system specfic install given a package extraction directory, a PkgSpec struct,
+// the files installed from the package and the version being upgraded from, if any.
+// Messages for the user are reported to rp. It returns what the install script
+// reported, nil if the package has none.
+func Install(dir string, ps *goolib.PkgSpec, insFiles map[string]string, prev string, rp msg.Reporter) (*client.ScriptResult, error) {
+	in, name := installer(ps, prev)
 	if in.Path == "" {
 		logger.Info("No installer specified")
-		return nil
+		return nil, nil
 	}
 
-	logger.Infof("Running install: %q", in.Path)
-	out, err := oswrap.Create(filepath.Join(dir, in.Path+".log"))
+	logger.Infof("Running %s: %q", name, in.Path)
+	res := &client.ScriptResult{Log: filepath.Join(dir, in.Path+".log")}
+	out, err := oswrap.Create(res.Log)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer func() {
 		if err := out.Close(); err != nil {
 			logger.Error(err)
 		}
 	}()
+	if err := checkPayload(dir, in); err != nil {
+		return nil, err
+	}
+	status := statusFile(dir, name)
+	env := append(scriptEnv(dir, ps, prev, in), "GOOGET_STATUS_FILE="+status)
 	s := filepath.Join(dir, in.Path)
-	msiLog := filepath.Join(dir, "msi_install.log")
+	msiLog := filepath.Join(dir, "msi_"+name+".log")
 	switch filepath.Ext(s) {
 	case ".msi":
 		args := append([]string{"/i", s, "/qn", "/norestart", "/log", msiLog}, in.Args...)
 		ec := append(msiSuccessCodes, in.ExitCodes...)
-		err = goolib.Run(exec.Command("msiexec", args...), ec, out)
+		c := command(env, "msiexec", args...)
+		if err = goolib.Run(c, ec, out); err == nil {
+			res.RebootRequired = needsReboot(c)
+		}
 	case ".msp":
 		args := append([]string{"/update", s, "/qn", "/norestart", "/log", msiLog}, in.Args...)
 		ec := append(msiSuccessCodes, in.ExitCodes...)
-		err = goolib.Run(exec.Command("msiexec", args...), ec, out)
+		c := command(env, "msiexec", args...)
+		if err = goolib.Run(c, ec, out); err == nil {
+			res.RebootRequired = needsReboot(c)
+		}
 	case ".msu":
-		args := append([]string{s, "/quiet", "/norestart"}, in.Args...)
-		err = goolib.Run(exec.Command("wusa", args...), in.ExitCodes, out)
+		res.KB, res.RebootRequired, err = installMSU(s, in, env, out, rp)
+	case ".inf":
+		res.Driver, res.RebootRequired, err = installINF(s, in, env, out)
 	case ".exe":
-		err = goolib.Run(exec.Command(s, in.Args...), in.ExitCodes, out)
+		err = runScript(ps.Name, command(env, s, in.Args...), in.ExitCodes, out)
 	default:
-		err = goolib.Exec(s, in.Args, in.ExitCodes, out)
+		var c *exec.Cmd
+		if c, err = script(env, s, in.Interpreter, in.Args); err == nil {
+			err = runScript(ps.Name, c, in.ExitCodes, out)
+		}
 	}
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := readStatus(status, res); err != nil {
+		logger.Errorf("Error reading the status %s reported: %v", name, err)
 	}
 
-	if err := addUninstallEntry(dir, ps); err != nil {
+	if err := addUninstallEntry(dir, ps, insFiles); err != nil {
 		logger.Error(err)
 	}
 
-	return nil
+	return res, nil
 }
 
 // Uninstall performs a system specfic uninstall given a packages PackageState.
+// A driver added to the driver store by the installer of the package is
+// deleted after the uninstaller, if any, ran.
 func Uninstall(st client.PackageState) error {
 	un := st.PackageSpec.Uninstall
-	if un.Path == "" {
+	drv := installedDriver(st)
+	if un.Path == "" && drv == "" {
 		logger.Info("No uninstaller specified")
 		return nil
 	}
+	if un.Path != "" {
+		if err := runUninstaller(st); err != nil {
+			return err
+		}
+	}
+	if drv != "" {
+		if err := deleteDriver(drv); err != nil {
+			return err
+		}
+	}
 
+	if err := removeUninstallEntry(st.PackageSpec); err != nil {
+		logger.Error(err)
+	}
+
+	return nil
+}
+
+// runUninstaller runs the uninstaller of st.
+func runUninstaller(st client.PackageState) error {
+	un := st.PackageSpec.Uninstall
 	logger.Infof("Running uninstall: %q", un.Path)
 	// logging is only useful for failed uninstall
 	out, err := oswrap.Create(filepath.Join(st.UnpackDir, un.Path+".log"))
@@ -135,34 +360,235 @@ func Uninstall(st client.PackageState) error {
 			logger.Error(err)
 		}
 	}()
+	if err := checkPayload(st.UnpackDir, un); err != nil {
+		return err
+	}
+	env := scriptEnv(st.UnpackDir, st.PackageSpec, "", un)
 	s := filepath.Join(st.UnpackDir, un.Path)
 	switch filepath.Ext(s) {
 	case ".msi":
 		msiLog := filepath.Join(st.UnpackDir, "msi_uninstall.log")
 		args := append([]string{"/x", s, "/qn", "/norestart", "/log", msiLog}, un.Args...)
 		ec := append(msiSuccessCodes, un.ExitCodes...)
-		err = goolib.Run(exec.Command("msiexec", args...), ec, out)
+		err = goolib.Run(command(env, "msiexec", args...), ec, out)
 	case ".msu":
 		args := append([]string{s, "/uninstall", "/quiet", "/norestart"}, un.Args...)
-		err = goolib.Run(exec.Command("wusa", args...), un.ExitCodes, out)
+		err = goolib.Run(command(env, "wusa", args...), un.ExitCodes, out)
 	case ".exe":
-		err = goolib.Run(exec.Command(s, un.Args...), un.ExitCodes, out)
+		err = runScript(st.PackageSpec.Name, command(env, s, un.Args...), un.ExitCodes, out)
 	default:
-		err = goolib.Exec(filepath.Join(st.UnpackDir, un.Path), un.Args, un.ExitCodes, out)
+		var c *exec.Cmd
+		if c, err = script(env, s, un.Interpreter, un.Args); err == nil {
+			err = runScript(st.PackageSpec.Name, c, un.ExitCodes, out)
+		}
+	}
+	return err
+}
+
+// Verify checks that the Windows update, certificates or driver installed by
+// a package are still present and runs the verify script of the package, if
+// it has one.
+func Verify(st client.PackageState) error {
+	if st.KB != "" {
+		ins, err := hotfixInstalled(st.KB)
+		if err != nil {
+			return err
+		}
+		if !ins {
+			return fmt.Errorf("%s is not installed", st.KB)
+		}
+	}
+	if err := checkCertificates(st.Certificates); err != nil {
+		return err
+	}
+	if drv := installedDriver(st); drv != "" {
+		ok, err := driverPresent(drv)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("driver %s is not in the driver store", drv)
+		}
+	}
+	v := st.PackageSpec.Verify
+	if v == nil || v.Path == "" {
+		return nil
 	}
+
+	logger.Infof("Running verify: %q", v.Path)
+	out, err := oswrap.Create(filepath.Join(st.UnpackDir, v.Path+".log"))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := out.Close(); err != nil {
+			logger.Error(err)
+		}
+	}()
+	if err := checkPayload(st.UnpackDir, *v); err != nil {
+		return err
+	}
+	env := scriptEnv(st.UnpackDir, st.PackageSpec, "", *v)
+	s := filepath.Join(st.UnpackDir, v.Path)
+	if filepath.Ext(s) == ".exe" {
+		return runScript(st.PackageSpec.Name, command(env, s, v.Args...), v.ExitCodes, out)
+	}
+	c, err := script(env, s, v.Interpreter, v.Args)
 	if err != nil {
 		return err
 	}
+	return runScript(st.PackageSpec.Name, c, v.ExitCodes, out)
+}
 
-	if err := removeUninstallEntry(st.PackageSpec.Name); err != nil {
-		logger.Error(err)
+var (
+	advapi32                  = windows.NewLazySystemDLL("advapi32.dll")
+	procCreateRestrictedToken = advapi32.NewProc("CreateRestrictedToken")
+	procLogonUserW            = advapi32.NewProc("LogonUserW")
+	crypt32                   = windows.NewLazySystemDLL("crypt32.dll")
+	procCryptMsgGetParam      = crypt32.NewProc("CryptMsgGetParam")
+	procCryptMsgClose         = crypt32.NewProc("CryptMsgClose")
+)
+
+const (
+	disableMaxPrivilege     = 0x1
+	logon32LogonService     = 5
+	logon32ProviderDefault  = 0
+	cmsgSignerCertInfoParam = 7
+)
+
+// authenticode verifies the Authenticode signature embedded in the file p
+// and returns the name of its signer. Revocation is not checked as many
+// machines cannot reach the revocation servers.
+func authenticode(p string) (string, error) {
+	path, err := windows.UTF16PtrFromString(p)
+	if err != nil {
+		return "", err
+	}
+	data := &windows.WinTrustData{
+		Size:             uint32(unsafe.Sizeof(windows.WinTrustData{})),
+		UIChoice:         windows.WTD_UI_NONE,
+		RevocationChecks: windows.WTD_REVOKE_NONE,
+		UnionChoice:      windows.WTD_CHOICE_FILE,
+		StateAction:      windows.WTD_STATEACTION_VERIFY,
+		FileOrCatalogOrBlobOrSgnrOrCert: unsafe.Pointer(&windows.WinTrustFileInfo{
+			Size:     uint32(unsafe.Sizeof(windows.WinTrustFileInfo{})),
+			FilePath: path,
+		}),
 	}
+	err = windows.WinVerifyTrustEx(windows.InvalidHWND, &windows.WINTRUST_ACTION_GENERIC_VERIFY_V2, data)
+	data.StateAction = windows.WTD_STATEACTION_CLOSE
+	windows.WinVerifyTrustEx(windows.InvalidHWND, &windows.WINTRUST_ACTION_GENERIC_VERIFY_V2, data)
+	if err != nil {
+		return "", fmt.Errorf("signature is not valid: %v", err)
+	}
+	return signer(path)
+}
 
-	return nil
+// signer returns the display name of the certificate that signed the file
+// path.
+func signer(path *uint16) (string, error) {
+	var enc uint32
+	var store, hmsg windows.Handle
+	if err := windows.CryptQueryObject(windows.CERT_QUERY_OBJECT_FILE, unsafe.Pointer(path), windows.CERT_QUERY_CONTENT_FLAG_PKCS7_SIGNED_EMBED, windows.CERT_QUERY_FORMAT_FLAG_BINARY, 0, &enc, nil, nil, &store, &hmsg, nil); err != nil {
+		return "", err
+	}
+	defer windows.CertCloseStore(store, 0)
+	defer procCryptMsgClose.Call(uintptr(hmsg))
+
+	var size uint32
+	if r, _, err := procCryptMsgGetParam.Call(uintptr(hmsg), cmsgSignerCertInfoParam, 0, 0, uintptr(unsafe.Pointer(&size))); r == 0 {
+		return "", fmt.Errorf("CryptMsgGetParam: %v", err)
+	}
+	info := make([]byte, size)
+	if r, _, err := procCryptMsgGetParam.Call(uintptr(hmsg), cmsgSignerCertInfoParam, 0, uintptr(unsafe.Pointer(&info[0])), uintptr(unsafe.Pointer(&size))); r == 0 {
+		return "", fmt.Errorf("CryptMsgGetParam: %v", err)
+	}
+	cert, err := windows.CertFindCertificateInStore(store, enc, 0, windows.CERT_FIND_SUBJECT_CERT, unsafe.Pointer(&info[0]), nil)
+	if err != nil {
+		return "", err
+	}
+	defer windows.CertFreeCertificateContext(cert)
+
+	n := windows.CertGetNameString(cert, windows.CERT_NAME_SIMPLE_DISPLAY_TYPE, 0, nil, nil, 0)
+	name := make([]uint16, n)
+	windows.CertGetNameString(cert, windows.CERT_NAME_SIMPLE_DISPLAY_TYPE, 0, nil, &name[0], n)
+	return windows.UTF16ToString(name), nil
+}
+
+// setContext makes c run with a restricted token for RestrictedContext or
+// logged on as the account ctx, which must be able to log on as a service
+// without a password, such as NT AUTHORITY\LocalService. The returned
+// function releases the token once c has run.
+func setContext(c *exec.Cmd, ctx string) (func(), error) {
+	var t windows.Token
+	var err error
+	if ctx == RestrictedContext {
+		t, err = restrictedToken()
+	} else {
+		t, err = serviceToken(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.SysProcAttr = &syscall.SysProcAttr{Token: syscall.Token(t)}
+	return func() { t.Close() }, nil
+}
+
+// restrictedToken returns a copy of the token of this process with every
+// privilege removed and the Administrators and SYSTEM groups only usable to
+// deny access.
+func restrictedToken() (windows.Token, error) {
+	var cur windows.Token
+	if err := windows.OpenProcessToken(windows.CurrentProcess(), windows.TOKEN_DUPLICATE|windows.TOKEN_QUERY|windows.TOKEN_ASSIGN_PRIMARY, &cur); err != nil {
+		return 0, err
+	}
+	defer cur.Close()
+	var deny []windows.SIDAndAttributes
+	for _, st := range []windows.WELL_KNOWN_SID_TYPE{windows.WinBuiltinAdministratorsSid, windows.WinLocalSystemSid} {
+		sid, err := windows.CreateWellKnownSid(st)
+		if err != nil {
+			return 0, err
+		}
+		deny = append(deny, windows.SIDAndAttributes{Sid: sid})
+	}
+	var t windows.Token
+	r, _, err := procCreateRestrictedToken.Call(uintptr(cur), disableMaxPrivilege, uintptr(len(deny)), uintptr(unsafe.Pointer(&deny[0])), 0, 0, 0, 0, uintptr(unsafe.Pointer(&t)))
+	if r == 0 {
+		return 0, fmt.Errorf("CreateRestrictedToken: %v", err)
+	}
+	return t, nil
+}
+
+// serviceToken logs on the account name, as DOMAIN\user or a local user,
+// as a service and returns its token.
+func serviceToken(name string) (windows.Token, error) {
+	domain, user := ".", name
+	if i := strings.Index(name, `\`); i != -1 {
+		domain, user = name[:i], name[i+1:]
+	}
+	u, err := windows.UTF16PtrFromString(user)
+	if err != nil {
+		return 0, err
+	}
+	d, err := windows.UTF16PtrFromString(domain)
+	if err != nil {
+		return 0, err
+	}
+	p, err := windows.UTF16PtrFromString("")
+	if err != nil {
+		return 0, err
+	}
+	var t windows.Token
+	r, _, err := procLogonUserW.Call(uintptr(unsafe.Pointer(u)), uintptr(unsafe.Pointer(d)), uintptr(unsafe.Pointer(p)), logon32LogonService, logon32ProviderDefault, uintptr(unsafe.Pointer(&t)))
+	if r == 0 {
+		return 0, fmt.Errorf("LogonUser %s: %v", name, err)
+	}
+	return t, nil
 }
 
 type win32_OperatingSystem struct {
-	AddressWidth uint16
+	AddressWidth   uint16
+	LastBootUpTime time.Time
 }
 
 func width() (int, error) {
@@ -197,3 +623,298 @@ func InstallableArchs() ([]string, error) {
 		return nil, fmt.Errorf("runtime %s not supported", runtime.GOARCH)
 	}
 }
+
+// UninstallEntries returns the names of the packages that have a GooGet
+// uninstall entry in the registry, under HKCU if userScope is set.
+func UninstallEntries(userScope bool) ([]string, error) {
+	root := registry.LOCAL_MACHINE
+	if userScope {
+		root = registry.CURRENT_USER
+	}
+	k, err := registry.OpenKey(root, strings.TrimSuffix(uninstallBase, `\`), registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+	keys, err := k.ReadSubKeyNames(-1)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, key := range keys {
+		if strings.HasPrefix(key, "GooGet - ") {
+			names = append(names, strings.TrimPrefix(key, "GooGet - "))
+		}
+	}
+	return names, nil
+}
+
+// DiskSpace returns the volume that path, or its closest existing ancestor,
+// is on and the bytes free on it for the current user.
+func DiskSpace(path string) (string, uint64, error) {
+	p, err := filepath.Abs(existingAncestor(path))
+	if err != nil {
+		return "", 0, err
+	}
+	pp, err := windows.UTF16PtrFromString(p)
+	if err != nil {
+		return "", 0, err
+	}
+	var free, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(pp, &free, &total, &totalFree); err != nil {
+		return "", 0, err
+	}
+	return strings.ToLower(filepath.VolumeName(p)), free, nil
+}
+
+// currentBuild returns the build number of Windows.
+func currentBuild() (int, error) {
+	return int(windows.RtlGetVersion().BuildNumber), nil
+}
+
+type win32_OptionalFeature struct {
+	Name         string
+	InstallState uint32
+}
+
+// windowsFeatureEnabled reports whether the optional feature name is
+// enabled.
+func windowsFeatureEnabled(name string) (bool, error) {
+	var of []win32_OptionalFeature
+	q := fmt.Sprintf("WHERE Name = '%s'", strings.Replace(name, "'", "''", -1))
+	if err := wmi.Query(wmi.CreateQuery(&of, q), &of); err != nil {
+		return false, err
+	}
+	// InstallState 1 is enabled.
+	return len(of) > 0 && of[0].InstallState == 1, nil
+}
+
+// dismReboot is the exit code of DISM when a reboot is needed to finish.
+const dismReboot = 3010
+
+// setWindowsFeature enables or disables the optional feature name with DISM,
+// enabling its parent features too, and reports whether a reboot is needed.
+func setWindowsFeature(name string, on bool) (bool, error) {
+	args := []string{"/online", "/disable-feature", "/featurename:" + name, "/quiet", "/norestart"}
+	if on {
+		args = []string{"/online", "/enable-feature", "/featurename:" + name, "/all", "/quiet", "/norestart"}
+	}
+	c := exec.Command("dism", args...)
+	err := goolib.Run(c, []int{dismReboot}, ioutil.Discard)
+	return err == nil && c.ProcessState.ExitCode() == dismReboot, err
+}
+
+// capabilityCmd runs a Windows capability cmdlet for the capability name and
+// returns the given property of its result.
+func capabilityCmd(cmdlet, name, property string) (string, error) {
+	q := "'" + strings.Replace(name, "'", "''", -1) + "'"
+	var out bytes.Buffer
+	c := exec.Command("powershell", "-ExecutionPolicy", "Bypass", "-NonInteractive", "-NoProfile", "-Command",
+		fmt.Sprintf("(%s -Online -Name %s).%s", cmdlet, q, property))
+	c.Stdout = &out
+	if err := c.Run(); err != nil {
+		return "", fmt.Errorf("%s: %v", cmdlet, err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// windowsCapabilityAdded reports whether the capability name is installed.
+func windowsCapabilityAdded(name string) (bool, error) {
+	st, err := capabilityCmd("Get-WindowsCapability", name, "State")
+	if err != nil {
+		return false, err
+	}
+	if st == "" {
+		return false, fmt.Errorf("unknown capability %q", name)
+	}
+	return st == "Installed", nil
+}
+
+// setWindowsCapability adds or removes the capability name and reports
+// whether a reboot is needed.
+func setWindowsCapability(name string, on bool) (bool, error) {
+	cmdlet := "Remove-WindowsCapability"
+	if on {
+		cmdlet = "Add-WindowsCapability"
+	}
+	rb, err := capabilityCmd(cmdlet, name, "RestartNeeded")
+	return rb == "True", err
+}
+
+// openCertStore opens the machine certificate store name.
+func openCertStore(name string) (windows.Handle, error) {
+	p, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return 0, err
+	}
+	return windows.CertOpenStore(windows.CERT_STORE_PROV_SYSTEM, 0, 0, windows.CERT_SYSTEM_STORE_LOCAL_MACHINE, uintptr(unsafe.Pointer(p)))
+}
+
+// findCertificate returns the certificate with the hex SHA-1 thumbprint in
+// the open store, nil if there is none.
+func findCertificate(store windows.Handle, thumbprint string) (*windows.CertContext, error) {
+	h, err := hex.DecodeString(thumbprint)
+	if err != nil || len(h) == 0 {
+		return nil, fmt.Errorf("invalid thumbprint %q", thumbprint)
+	}
+	blob := windows.CryptHashBlob{Size: uint32(len(h)), Data: &h[0]}
+	ctx, err := windows.CertFindCertificateInStore(store, windows.X509_ASN_ENCODING|windows.PKCS_7_ASN_ENCODING, 0, windows.CERT_FIND_SHA1_HASH, unsafe.Pointer(&blob), nil)
+	if err == windows.Errno(windows.CRYPT_E_NOT_FOUND) {
+		return nil, nil
+	}
+	return ctx, err
+}
+
+// certificateInStore reports whether the certificate with the thumbprint is
+// in the machine store.
+func certificateInStore(store, thumbprint string) (bool, error) {
+	h, err := openCertStore(store)
+	if err != nil {
+		return false, err
+	}
+	defer windows.CertCloseStore(h, 0)
+	ctx, err := findCertificate(h, thumbprint)
+	if ctx != nil {
+		windows.CertFreeCertificateContext(ctx)
+	}
+	return ctx != nil, err
+}
+
+// addCertificate adds the DER encoded certificate to the machine store.
+func addCertificate(store string, der []byte) error {
+	h, err := openCertStore(store)
+	if err != nil {
+		return err
+	}
+	defer windows.CertCloseStore(h, 0)
+	ctx, err := windows.CertCreateCertificateContext(windows.X509_ASN_ENCODING|windows.PKCS_7_ASN_ENCODING, &der[0], uint32(len(der)))
+	if err != nil {
+		return err
+	}
+	defer windows.CertFreeCertificateContext(ctx)
+	return windows.CertAddCertificateContextToStore(h, ctx, windows.CERT_STORE_ADD_REPLACE_EXISTING, nil)
+}
+
+// deleteCertificate deletes the certificate with the thumbprint from the
+// machine store, if it is there.
+func deleteCertificate(store, thumbprint string) error {
+	h, err := openCertStore(store)
+	if err != nil {
+		return err
+	}
+	defer windows.CertCloseStore(h, 0)
+	ctx, err := findCertificate(h, thumbprint)
+	if err != nil || ctx == nil {
+		return err
+	}
+	// CertDeleteCertificateFromStore frees ctx.
+	return windows.CertDeleteCertificateFromStore(ctx)
+}
+
+// postRebootTask is the scheduled task that runs pending post-reboot
+// actions at startup.
+const postRebootTask = `GooGet\PostReboot`
+
+// SchedulePostReboot creates, or replaces, the scheduled task running this
+// executable with args as SYSTEM at the next startup.
+func SchedulePostReboot(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	tr := []string{syscall.EscapeArg(exe)}
+	for _, a := range args {
+		tr = append(tr, syscall.EscapeArg(a))
+	}
+	c := exec.Command("schtasks", "/create", "/tn", postRebootTask, "/tr", strings.Join(tr, " "), "/sc", "onstart", "/ru", "SYSTEM", "/rl", "HIGHEST", "/f")
+	return goolib.Run(c, nil, ioutil.Discard)
+}
+
+// UnschedulePostReboot deletes the scheduled task created by
+// SchedulePostReboot.
+func UnschedulePostReboot() error {
+	return goolib.Run(exec.Command("schtasks", "/delete", "/tn", postRebootTask, "/f"), nil, ioutil.Discard)
+}
+
+// BootTime returns when Windows booted.
+func BootTime() (time.Time, error) {
+	var osi []win32_OperatingSystem
+	if err := wmi.Query(wmi.CreateQuery(&osi, ""), &osi); err != nil {
+		return time.Time{}, err
+	}
+	if len(osi) == 0 {
+		return time.Time{}, fmt.Errorf("no Win32_OperatingSystem instance")
+	}
+	return osi[0].LastBootUpTime, nil
+}
+
+// hives are the registry roots keys can be required under.
+var hives = map[string]registry.Key{
+	"HKLM":                registry.LOCAL_MACHINE,
+	"HKEY_LOCAL_MACHINE":  registry.LOCAL_MACHINE,
+	"HKCU":                registry.CURRENT_USER,
+	"HKEY_CURRENT_USER":   registry.CURRENT_USER,
+	"HKCR":                registry.CLASSES_ROOT,
+	"HKEY_CLASSES_ROOT":   registry.CLASSES_ROOT,
+	"HKU":                 registry.USERS,
+	"HKEY_USERS":          registry.USERS,
+	"HKCC":                registry.CURRENT_CONFIG,
+	"HKEY_CURRENT_CONFIG": registry.CURRENT_CONFIG,
+}
+
+// registryKeyExists reports whether key, a hive and a path like
+// HKLM\SOFTWARE\Vendor, exists in the 64-bit registry view.
+func registryKeyExists(key string) (bool, error) {
+	i := strings.Index(key, `\`)
+	if i < 0 {
+		return false, fmt.Errorf("no hive in %q", key)
+	}
+	root, ok := hives[strings.ToUpper(key[:i])]
+	if !ok {
+		return false, fmt.Errorf("unknown hive %q", key[:i])
+	}
+	k, err := registry.OpenKey(root, key[i+1:], registry.QUERY_VALUE|registry.WOW64_64KEY)
+	if err == registry.ErrNotExist {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	k.Close()
+	return true, nil
+}
+
+// systemRoot returns the root of the system drive.
+func systemRoot() string {
+	if d := os.Getenv("SystemDrive"); d != "" {
+		return d + `\`
+	}
+	return `C:\`
+}
+
+// SetPermission replaces the DACL of path with the one in the ACL of p.
+// Windows has no modes to apply.
+func SetPermission(path string, p goolib.Permission) error {
+	if p.ACL == "" {
+		return nil
+	}
+	sd, err := windows.SecurityDescriptorFromString(p.ACL)
+	if err != nil {
+		return fmt.Errorf("parsing ACL %q: %v", p.ACL, err)
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return fmt.Errorf("parsing ACL %q: %v", p.ACL, err)
+	}
+	control, _, err := sd.Control()
+	if err != nil {
+		return err
+	}
+	info := windows.SECURITY_INFORMATION(windows.DACL_SECURITY_INFORMATION)
+	if control&windows.SE_DACL_PROTECTED != 0 {
+		info |= windows.PROTECTED_DACL_SECURITY_INFORMATION
+	} else {
+		info |= windows.UNPROTECTED_DACL_SECURITY_INFORMATION
+	}
+	return windows.SetNamedSecurityInfo(path, windows.SE_FILE_OBJECT, info, nil, nil, dacl, nil)
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+// The values of the uninstall entry that shows a package in Apps & Features.
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+)
+
+var gooGetExe string
+
+// SetGooGetExe sets the googet executable the uninstall entries of packages
+// run. The googet command sets itself, programs embedding GooGet set the
+// googet.exe that manages their root.
+func SetGooGetExe(path string) {
+	gooGetExe = path
+}
+
+// GooGetExe returns the googet executable set by SetGooGetExe, or
+// googet.exe in the GooGet root if none is set.
+func GooGetExe() string {
+	if gooGetExe != "" {
+		return gooGetExe
+	}
+	return filepath.Join(os.Getenv("GooGetRoot"), "googet.exe")
+}
+
+type regString struct {
+	name, value string
+}
+
+type regDWord struct {
+	name  string
+	value uint32
+}
+
+// uninstallStrings returns the string values of the uninstall entry of ps,
+// installed in dir and removed by running cmd. Values ps does not set are
+// empty.
+func uninstallStrings(dir, cmd string, ps *goolib.PkgSpec) []regString {
+	publisher := ps.Publisher
+	if publisher == "" {
+		publisher = ps.Authors
+	}
+	var icon string
+	if ps.Icon != "" {
+		icon = filepath.Join(dir, ps.Icon)
+	}
+	return []regString{
+		{"UninstallString", cmd},
+		{"InstallLocation", dir},
+		{"DisplayVersion", ps.Version},
+		{"DisplayName", "GooGet - " + ps.Name},
+		{"Publisher", publisher},
+		{"HelpLink", ps.HelpURL},
+		{"URLInfoAbout", ps.AboutURL},
+		{"DisplayIcon", icon},
+	}
+}
+
+// uninstallDWords returns the DWORD values of the uninstall entry of ps.
+func uninstallDWords(ps *goolib.PkgSpec, insFiles map[string]string) []regDWord {
+	return []regDWord{
+		{"EstimatedSize", estimatedSize(insFiles)},
+		{"NoModify", flagDWord(ps.NoModify)},
+		{"NoRepair", flagDWord(ps.NoRepair)},
+	}
+}
+
+// flagDWord returns the registry value of an optional flag, which is set
+// unless the package clears it.
+func flagDWord(b *bool) uint32 {
+	if b != nil && !*b {
+		return 0
+	}
+	return 1
+}
+
+// estimatedSize returns the total size in KB of the installed files,
+// directories are recorded with an empty checksum and are skipped.
+func estimatedSize(insFiles map[string]string) uint32 {
+	var size int64
+	for file, chksum := range insFiles {
+		if chksum == "" {
+			continue
+		}
+		fi, err := oswrap.Stat(file)
+		if err != nil {
+			continue
+		}
+		size += fi.Size()
+	}
+	return uint32(size / 1024)
+}
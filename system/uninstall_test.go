@@ -0,0 +1,75 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/googet/goolib"
+)
+
+func TestUninstallValues(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	f := filepath.Join(tempDir, "foo.exe")
+	if err := ioutil.WriteFile(f, make([]byte, 4096), 0664); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+	insFiles := map[string]string{f: "sum", tempDir: ""}
+
+	ps := &goolib.PkgSpec{Name: "foo", Version: "1.0.0@1", Authors: "someone", HelpURL: "https://example.com/help"}
+	want := []regString{
+		{"UninstallString", "googet remove foo"},
+		{"InstallLocation", tempDir},
+		{"DisplayVersion", "1.0.0@1"},
+		{"DisplayName", "GooGet - foo"},
+		{"Publisher", "someone"},
+		{"HelpLink", "https://example.com/help"},
+		// Unset values are empty so they are deleted from the entry.
+		{"URLInfoAbout", ""},
+		{"DisplayIcon", ""},
+	}
+	if got := uninstallStrings(tempDir, "googet remove foo", ps); !reflect.DeepEqual(got, want) {
+		t.Errorf("uninstallStrings = %v, want %v", got, want)
+	}
+
+	no := false
+	ps.NoModify = &no
+	wantDWords := []regDWord{{"EstimatedSize", 4}, {"NoModify", 0}, {"NoRepair", 1}}
+	if got := uninstallDWords(ps, insFiles); !reflect.DeepEqual(got, wantDWords) {
+		t.Errorf("uninstallDWords = %v, want %v", got, wantDWords)
+	}
+}
+
+func TestGooGetExe(t *testing.T) {
+	defer SetGooGetExe("")
+	root := os.Getenv("GooGetRoot")
+	defer os.Setenv("GooGetRoot", root)
+
+	os.Setenv("GooGetRoot", "root")
+	if got, want := GooGetExe(), filepath.Join("root", "googet.exe"); got != want {
+		t.Errorf("GooGetExe() = %q, want %q", got, want)
+	}
+	SetGooGetExe("other.exe")
+	if got := GooGetExe(); got != "other.exe" {
+		t.Errorf("GooGetExe() = %q, want %q", got, "other.exe")
+	}
+}
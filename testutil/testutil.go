@@ -0,0 +1,266 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package testutil provides helpers for testing GooGet and tools built on
+// it: generated .goo packages, a fake repo server with latency and error
+// injection, and seeded state files.
+package testutil
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+)
+
+// WriteGoo writes a .goo package to p containing spec, if it is not nil,
+// and files, which maps paths in the package to their contents. Scripts
+// referenced by spec, such as its Install and Uninstall paths, are ordinary
+// entries in files.
+func WriteGoo(t testing.TB, p string, spec *goolib.PkgSpec, files map[string]string) {
+	t.Helper()
+	f, err := oswrap.Create(p)
+	if err != nil {
+		t.Fatalf("error creating package: %v", err)
+	}
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	if spec != nil {
+		if err := goolib.WritePackageSpec(tw, spec); err != nil {
+			t.Fatalf("error writing spec: %v", err)
+		}
+	}
+	var names []string
+	for n := range files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		body := files[n]
+		if err := tw.WriteHeader(&tar.Header{Name: n, Mode: 0600, Size: int64(len(body))}); err != nil {
+			t.Fatalf("error writing header of %s: %v", n, err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatalf("error writing %s: %v", n, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("error closing tar: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("error closing gzip: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("error closing package: %v", err)
+	}
+}
+
+// GenGoo writes a package of spec and files to dir, named after spec as
+// name.arch.version.goo, and returns its path.
+func GenGoo(t testing.TB, dir string, spec *goolib.PkgSpec, files map[string]string) string {
+	t.Helper()
+	pi := goolib.PackageInfo{Name: spec.Name, Arch: spec.Arch, Ver: spec.Version}
+	p := filepath.Join(dir, pi.PkgName())
+	WriteGoo(t, p, spec, files)
+	return p
+}
+
+// Repo is a fake GooGet repo served over HTTP. It serves its index at
+// URL()+"/index", package queries at URL()+"/query" and its packages under
+// /packages/, like gooserve.
+type Repo struct {
+	// Latency delays every response.
+	Latency time.Duration
+
+	name string
+	dir  string
+	srv  *httptest.Server
+
+	mu       sync.Mutex
+	specs    []goolib.RepoSpec
+	fail     []int
+	requests []string
+}
+
+// NewRepo starts a fake repo called name. Close it when done.
+func NewRepo(t testing.TB, name string) *Repo {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "testrepo")
+	if err != nil {
+		t.Fatalf("error creating repo directory: %v", err)
+	}
+	r := &Repo{name: name, dir: dir}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+name+"/index", r.serveIndex)
+	mux.HandleFunc("/"+name+"/query", r.serveQuery)
+	mux.Handle("/packages/", http.StripPrefix("/packages/", http.FileServer(http.Dir(dir))))
+	r.srv = httptest.NewServer(r.inject(mux))
+	return r
+}
+
+// URL returns the URL clients use for the repo.
+func (r *Repo) URL() string {
+	return r.srv.URL + "/" + r.name
+}
+
+// Close stops the server and removes its packages.
+func (r *Repo) Close() {
+	r.srv.Close()
+	os.RemoveAll(r.dir)
+}
+
+// Add generates a package of spec and files, adds it to the repo and
+// returns its RepoSpec.
+func (r *Repo) Add(t testing.TB, spec *goolib.PkgSpec, files map[string]string) goolib.RepoSpec {
+	t.Helper()
+	p := GenGoo(t, r.dir, spec, files)
+	f, err := oswrap.Open(p)
+	if err != nil {
+		t.Fatalf("error opening package: %v", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatalf("error reading package: %v", err)
+	}
+	rs := goolib.RepoSpec{
+		Checksum:    goolib.Checksum(f),
+		Source:      path.Join("packages", filepath.Base(p)),
+		Size:        fi.Size(),
+		PackageSpec: spec,
+	}
+	r.mu.Lock()
+	r.specs = append(r.specs, rs)
+	r.mu.Unlock()
+	return rs
+}
+
+// Fail makes the next requests to the repo fail, one per status code given.
+func (r *Repo) Fail(codes ...int) {
+	r.mu.Lock()
+	r.fail = append(r.fail, codes...)
+	r.mu.Unlock()
+}
+
+// Requests returns the paths requested so far, in order, including failed
+// requests.
+func (r *Repo) Requests() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.requests...)
+}
+
+func (r *Repo) inject(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(r.Latency)
+		r.mu.Lock()
+		r.requests = append(r.requests, req.URL.Path)
+		code := 0
+		if len(r.fail) > 0 {
+			code, r.fail = r.fail[0], r.fail[1:]
+		}
+		r.mu.Unlock()
+		if code != 0 {
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+func (r *Repo) serveIndex(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	rs := append([]goolib.RepoSpec{}, r.specs...)
+	r.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rs)
+}
+
+func (r *Repo) serveQuery(w http.ResponseWriter, req *http.Request) {
+	names := req.URL.Query()["name"]
+	rs := []goolib.RepoSpec{}
+	r.mu.Lock()
+	for _, s := range r.specs {
+		if goolib.ContainsString(s.PackageSpec.Name, names) {
+			rs = append(rs, s)
+		}
+	}
+	r.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rs)
+}
+
+// SeedState writes a state file to p recording pss as installed and returns
+// the state.
+func SeedState(t testing.TB, p string, pss ...client.PackageState) *client.GooGetState {
+	t.Helper()
+	s := client.GooGetState(pss)
+	b, err := s.Marshal()
+	if err != nil {
+		t.Fatalf("error marshalling state: %v", err)
+	}
+	if err := ioutil.WriteFile(p, b, 0664); err != nil {
+		t.Fatalf("error writing state: %v", err)
+	}
+	return &s
+}
+
+// Tree returns every path under dir, dir included, with its mode,
+// modification time and the checksum of its contents or, for links, their
+// target. Comparing the trees taken before and after an operation shows
+// whether it changed anything under dir.
+func Tree(t testing.TB, dir string) map[string]string {
+	t.Helper()
+	m := make(map[string]string)
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		d := fmt.Sprintf("%v %v", fi.Mode(), fi.ModTime().UnixNano())
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			d += " " + target
+		case fi.Mode().IsRegular():
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			d += " " + goolib.Checksum(f)
+			f.Close()
+		}
+		m[p] = d
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error walking %s: %v", dir, err)
+	}
+	return m
+}
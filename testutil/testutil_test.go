@@ -0,0 +1,119 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/download"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/msg"
+	"github.com/google/googet/oswrap"
+	"github.com/google/logger"
+)
+
+func init() {
+	logger.Init("test", true, false, ioutil.Discard)
+}
+
+func TestRepo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dir)
+
+	r := NewRepo(t, "repo")
+	defer r.Close()
+	spec := &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "1.0.0@1"}
+	rs := r.Add(t, spec, map[string]string{"bin/foo": "foo"})
+
+	rm := client.AvailableVersions([]string{r.URL()}, dir, 0, "")
+	if got := rm[r.URL()]; !reflect.DeepEqual(got, []goolib.RepoSpec{rs}) {
+		t.Fatalf("repo index = %+v, want %+v", got, []goolib.RepoSpec{rs})
+	}
+
+	r.Fail(http.StatusServiceUnavailable)
+	if _, err := download.FromRepo(rs, r.URL(), dir, "", msg.Discard); err == nil {
+		t.Error("download from a failing repo returned no error")
+	}
+	p, err := download.FromRepo(rs, r.URL(), dir, "", msg.Discard)
+	if err != nil {
+		t.Fatalf("error downloading package: %v", err)
+	}
+	out, err := download.ExtractPkg(p)
+	if err != nil {
+		t.Fatalf("error extracting package: %v", err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(out, "bin", "foo")); err != nil || string(b) != "foo" {
+		t.Errorf("extracted bin/foo = %q, %v, want %q", b, err, "foo")
+	}
+	// index.manifest, index.gz, index, deprecation and the two downloads.
+	if got := len(r.Requests()); got != 6 {
+		t.Errorf("repo served %d requests, want 6: %v", got, r.Requests())
+	}
+}
+
+func TestSeedState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dir)
+
+	p := filepath.Join(dir, "googet.state")
+	want := SeedState(t, p, client.PackageState{PackageSpec: &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "1.0.0@1"}})
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := client.UnmarshalState(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("state file contains %+v, want %+v", got, want)
+	}
+}
+
+func TestTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dir)
+
+	p := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(p, []byte("one"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	before := Tree(t, dir)
+	if len(before) != 2 {
+		t.Errorf("Tree(%s) = %v, want dir and file", dir, before)
+	}
+	if !reflect.DeepEqual(Tree(t, dir), before) {
+		t.Error("Tree changed without changes to the directory")
+	}
+	if err := ioutil.WriteFile(p, []byte("two"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(Tree(t, dir), before) {
+		t.Error("Tree did not change after a file was rewritten")
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package update selects the updates of installed packages and applies
+// them, carrying on past the packages that fail.
+package update
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/download"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/install"
+	"github.com/google/googet/msg"
+	"github.com/google/logger"
+)
+
+// Select returns the packages of installed, name.arch mapped to the
+// installed version, to update, or roll back, and the decisions they are
+// updated by, see client.ShouldUpdate. Updates are ordered by the install
+// stage of the package, then name.
+func Select(installed map[string]string, rm client.RepoMap, state client.GooGetState, repos []string, rp msg.Reporter) ([]goolib.PackageInfo, map[string]client.Decision) {
+	rp.Info(msg.UpdateSearching)
+	var ud []goolib.PackageInfo
+	dm := make(map[string]client.Decision)
+	for p, ver := range installed {
+		pi := goolib.PkgNameSplit(p)
+		pi.Ver = ver
+		d, err := client.Resolve(pi, rm)
+		if err != nil {
+			// This error is because this installed package is not available in a repo.
+			logger.Info(err)
+			continue
+		}
+		var prev *client.Decision
+		if ps, err := state.GetPackageState(goolib.PackageInfo{Name: pi.Name, Arch: pi.Arch}); err == nil {
+			prev = ps.Decision
+		}
+		up, err := client.ShouldUpdate(pi, d, prev, repos, rm)
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+		if up {
+			logger.Infof("Update for package %s, %s installed and %s available from %s with priority %d.", p, ver, d.Version, d.Repo, d.Priority)
+			ud = append(ud, goolib.PackageInfo{pi.Name, pi.Arch, d.Version})
+			dm[p] = d
+			continue
+		}
+		logger.Infof("%s - no update, %s installed and %s resolved from %s with priority %d", p, ver, d.Version, d.Repo, d.Priority)
+	}
+	rank := make(map[goolib.PackageInfo]int)
+	for _, pi := range ud {
+		rank[pi] = client.StageRank(pi, rm)
+	}
+	sort.Slice(ud, func(i, j int) bool {
+		if rank[ud[i]] != rank[ud[j]] {
+			return rank[ud[i]] < rank[ud[j]]
+		}
+		return ud[i].Name < ud[j].Name
+	})
+	return ud, dm
+}
+
+// RecordDecision records in state that pi was installed by the decision d.
+func RecordDecision(state client.GooGetState, pi goolib.PackageInfo, d client.Decision) {
+	for i, ps := range state {
+		if ps.Match(pi) {
+			state[i].Decision = &d
+			return
+		}
+	}
+}
+
+// Outcome is the result of updating, or replacing, one package.
+type Outcome struct {
+	Name, Arch, Version, Repo string
+	OldVersion                string `json:",omitempty"`
+	// Replaces is the name.arch of the obsoleted package this one replaces.
+	Replaces string `json:",omitempty"`
+	// Retried is set if the first attempt failed with a transient error.
+	Retried bool   `json:",omitempty"`
+	Error   string `json:",omitempty"`
+	// Err is the error Error is the text of.
+	Err error `json:"-"`
+}
+
+// Result is the result of an update run.
+type Result struct {
+	Start           time.Time
+	Updated, Failed int
+	Packages        []Outcome
+}
+
+// Task updates one package.
+type Task struct {
+	Outcome Outcome
+	Run     func() error
+}
+
+// Tasks returns the tasks installing the updates ud, made by the decisions
+// dm, of the packages of installed. Each records its decision in state once
+// the package is installed.
+func Tasks(ud []goolib.PackageInfo, dm map[string]client.Decision, installed map[string]string, cache string, rm client.RepoMap, archs []string, state *client.GooGetState, j *client.Journal, dbOnly, userScope bool, proxyServer string, rp msg.Reporter) []Task {
+	var tasks []Task
+	for _, pi := range ud {
+		pi, d := pi, dm[pi.Name+"."+pi.Arch]
+		tasks = append(tasks, Task{
+			Outcome: Outcome{Name: pi.Name, Arch: pi.Arch, Version: pi.Ver, OldVersion: installed[pi.Name+"."+pi.Arch], Repo: d.Repo},
+			Run: func() error {
+				if err := install.ToVersion(pi, d.Repo, cache, rm, archs, state, j, dbOnly, userScope, proxyServer, rp); err != nil {
+					return err
+				}
+				RecordDecision(*state, pi, d)
+				return nil
+			},
+		})
+	}
+	return tasks
+}
+
+// Run runs every task, carrying on past failures, then retries once the
+// tasks that failed with a transient download error.
+func Run(tasks []Task, rp msg.Reporter) Result {
+	res := Result{Start: time.Now()}
+	errs := make([]error, len(tasks))
+	var retry []int
+	for i, t := range tasks {
+		errs[i] = t.Run()
+		if errs[i] != nil && download.Transient(errs[i]) {
+			logger.Infof("Transient error updating %s.%s.%s, retrying later: %v", t.Outcome.Name, t.Outcome.Arch, t.Outcome.Version, errs[i])
+			retry = append(retry, i)
+		}
+	}
+	for _, i := range retry {
+		o := &tasks[i].Outcome
+		rp.Info(msg.UpdateRetry, o.Name, o.Arch, o.Version)
+		o.Retried = true
+		errs[i] = tasks[i].Run()
+	}
+	for i, t := range tasks {
+		o := t.Outcome
+		if errs[i] != nil {
+			logger.Errorf("Error updating %s %s %s: %v", o.Arch, o.Name, o.Version, errs[i])
+			o.Error = errs[i].Error()
+			o.Err = errs[i]
+			res.Failed++
+		} else {
+			res.Updated++
+		}
+		res.Packages = append(res.Packages, o)
+	}
+	return res
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package update
+
+import (
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/download"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/msg"
+	"github.com/google/logger"
+)
+
+func init() {
+	logger.Init("test", true, false, ioutil.Discard)
+}
+
+func TestSelect(t *testing.T) {
+	rm := client.RepoMap{
+		"repo": []goolib.RepoSpec{
+			{PackageSpec: &goolib.PkgSpec{Name: "foo", Arch: "noarch", Version: "2.0.0@1"}},
+			{PackageSpec: &goolib.PkgSpec{Name: "agent", Arch: "noarch", Version: "2.0.0@1", InstallStage: goolib.StageEarly}},
+			{PackageSpec: &goolib.PkgSpec{Name: "bar", Arch: "noarch", Version: "1.0.0@1"}},
+		},
+	}
+	installed := map[string]string{"foo.noarch": "1.0.0@1", "agent.noarch": "1.0.0@1", "bar.noarch": "1.0.0@1", "gone.noarch": "1.0.0@1"}
+	var state client.GooGetState
+	for p, v := range installed {
+		pi := goolib.PkgNameSplit(p)
+		state = append(state, client.PackageState{PackageSpec: &goolib.PkgSpec{Name: pi.Name, Arch: pi.Arch, Version: v}})
+	}
+
+	ud, dm := Select(installed, rm, state, []string{"repo"}, msg.Discard)
+	want := []goolib.PackageInfo{{Name: "agent", Arch: "noarch", Ver: "2.0.0@1"}, {Name: "foo", Arch: "noarch", Ver: "2.0.0@1"}}
+	if !reflect.DeepEqual(ud, want) {
+		t.Errorf("Select() = %v, want %v", ud, want)
+	}
+	if d := dm["foo.noarch"]; d.Repo != "repo" || d.Version != "2.0.0@1" {
+		t.Errorf("decision for foo = %+v, want version 2.0.0@1 from repo", d)
+	}
+
+	// The decision is recorded once the package is installed.
+	RecordDecision(state, goolib.PackageInfo{Name: "foo", Arch: "noarch"}, dm["foo.noarch"])
+	ps, err := state.GetPackageState(goolib.PackageInfo{Name: "foo", Arch: "noarch"})
+	if err != nil || ps.Decision == nil || *ps.Decision != dm["foo.noarch"] {
+		t.Errorf("RecordDecision did not record the decision for foo: %+v, %v", ps.Decision, err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	var flakyRuns int
+	broken := &download.ChecksumError{Want: "a", Got: "b"}
+	tasks := []Task{
+		{Outcome: Outcome{Name: "ok"}, Run: func() error { return nil }},
+		{Outcome: Outcome{Name: "flaky"}, Run: func() error {
+			flakyRuns++
+			if flakyRuns == 1 {
+				return &download.StatusError{Status: "503 Service Unavailable", Code: http.StatusServiceUnavailable}
+			}
+			return nil
+		}},
+		{Outcome: Outcome{Name: "broken"}, Run: func() error { return broken }},
+	}
+	res := Run(tasks, msg.Discard)
+	if res.Updated != 2 || res.Failed != 1 {
+		t.Errorf("Run() updated %d and failed %d, want 2 and 1", res.Updated, res.Failed)
+	}
+	if flakyRuns != 2 {
+		t.Errorf("transient failure ran %d times, want 2", flakyRuns)
+	}
+	want := []Outcome{
+		{Name: "ok"},
+		{Name: "flaky", Retried: true},
+		{Name: "broken", Error: "checksum of downloaded file b does not match expected checksum a", Err: broken},
+	}
+	if !reflect.DeepEqual(res.Packages, want) {
+		t.Errorf("Run() outcomes = %+v, want %+v", res.Packages, want)
+	}
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package verify handles the verification of installed packages.
+package verify
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+	"github.com/google/googet/system"
+	"github.com/google/logger"
+)
+
+// Status is the result of verifying a package or file.
+type Status string
+
+// Verification statuses, a package takes the first status in this list
+// that applies to it.
+const (
+	StatusMissing      Status = "missing"
+	StatusModified     Status = "modified"
+	StatusScriptFailed Status = "script-failed"
+	StatusOK           Status = "ok"
+)
+
+// File is a file that failed verification.
+type File struct {
+	Path   string
+	Status Status
+}
+
+// Result is the result of verifying a single package.
+type Result struct {
+	Name    string
+	Arch    string
+	Version string
+	Status  Status
+	Files   []File `json:",omitempty"`
+	Error   string `json:",omitempty"`
+}
+
+// Package verifies that the files of an installed package are present and
+// unmodified and runs its verify script, if it has one and dbOnly is not set.
+func Package(ps client.PackageState, dbOnly bool) Result {
+	spec := ps.PackageSpec
+	logger.Infof("Verifying package %s.%s.%s", spec.Name, spec.Arch, spec.Version)
+	r := Result{Name: spec.Name, Arch: spec.Arch, Version: spec.Version, Status: StatusOK}
+	for path, chksum := range ps.InstalledFiles {
+		if s := verifyFile(path, chksum); s != StatusOK {
+			r.Files = append(r.Files, File{Path: path, Status: s})
+		}
+	}
+	for dir := range ps.Dirs {
+		if s := verifyFile(dir, ""); s != StatusOK {
+			r.Files = append(r.Files, File{Path: dir, Status: s})
+		}
+	}
+	sort.Slice(r.Files, func(i, j int) bool { return r.Files[i].Path < r.Files[j].Path })
+
+	if !dbOnly {
+		if err := system.Verify(ps); err != nil {
+			r.Status = StatusScriptFailed
+			r.Error = err.Error()
+		}
+	}
+	for _, f := range r.Files {
+		if f.Status == StatusMissing {
+			r.Status = StatusMissing
+			break
+		}
+		r.Status = StatusModified
+	}
+	return r
+}
+
+// verifyFile checks a single installed file against its checksum,
+// directories are recorded with an empty checksum and only checked for
+// existence, links are checked by where they point.
+func verifyFile(path, chksum string) Status {
+	if target, ok := goolib.LinkTarget(chksum); ok {
+		got, err := oswrap.Readlink(path)
+		if os.IsNotExist(err) {
+			return StatusMissing
+		}
+		if err != nil || got != target {
+			return StatusModified
+		}
+		return StatusOK
+	}
+	f, err := oswrap.Open(path)
+	if os.IsNotExist(err) {
+		return StatusMissing
+	}
+	if err != nil {
+		logger.Error(err)
+		return StatusModified
+	}
+	defer f.Close()
+	if chksum == "" {
+		return StatusOK
+	}
+	if goolib.Checksum(f) != chksum {
+		return StatusModified
+	}
+	return StatusOK
+}
+
+// All verifies every package in state using the given number of workers
+// and returns the results sorted by package name and arch. If dbOnly is set
+// verify scripts are not run.
+func All(state client.GooGetState, workers int, dbOnly bool) []Result {
+	if workers < 1 {
+		workers = 1
+	}
+	ch := make(chan client.PackageState)
+	var mu sync.Mutex
+	var rs []Result
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ps := range ch {
+				r := Package(ps, dbOnly)
+				mu.Lock()
+				rs = append(rs, r)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, ps := range state {
+		ch <- ps
+	}
+	close(ch)
+	wg.Wait()
+
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].Name+"."+rs[i].Arch < rs[j].Name+"."+rs[j].Arch
+	})
+	return rs
+}
+
+// Summary counts the results with each status.
+func Summary(rs []Result) map[Status]int {
+	m := make(map[Status]int)
+	for _, r := range rs {
+		m[r.Status]++
+	}
+	return m
+}
+
+// WriteJSON writes the results as a JSON report.
+func WriteJSON(w io.Writer, rs []Result) error {
+	b, err := json.MarshalIndent(struct {
+		Summary map[Status]int
+		Results []Result
+	}{Summary(rs), rs}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+// WriteJUnit writes the results as a JUnit XML report with a test case for
+// each package.
+func WriteJUnit(w io.Writer, rs []Result) error {
+	ts := junitTestSuite{Name: "googet verify", Tests: len(rs)}
+	for _, r := range rs {
+		tc := junitTestCase{Name: fmt.Sprintf("%s.%s.%s", r.Name, r.Arch, r.Version), ClassName: r.Name}
+		if r.Status != StatusOK {
+			ts.Failures++
+			var text string
+			if r.Error != "" {
+				text = r.Error + "\n"
+			}
+			for _, f := range r.Files {
+				text += fmt.Sprintf("%s: %s\n", f.Status, f.Path)
+			}
+			tc.Failure = &junitFailure{Message: string(r.Status), Type: string(r.Status), Text: text}
+		}
+		ts.TestCases = append(ts.TestCases, tc)
+	}
+	b, err := xml.MarshalIndent(ts, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package verify
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/googet/client"
+	"github.com/google/googet/goolib"
+	"github.com/google/googet/oswrap"
+	"github.com/google/logger"
+)
+
+func init() {
+	logger.Init("test", true, false, ioutil.Discard)
+}
+
+func TestAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("error creating temp directory: %v", err)
+	}
+	defer oswrap.RemoveAll(dir)
+
+	good := filepath.Join(dir, "good.txt")
+	changed := filepath.Join(dir, "changed.txt")
+	for _, f := range []string{good, changed} {
+		if err := ioutil.WriteFile(f, []byte("content"), 0644); err != nil {
+			t.Fatalf("error creating test file: %v", err)
+		}
+	}
+	chksum := goolib.Checksum(bytes.NewReader([]byte("content")))
+	if err := ioutil.WriteFile(changed, []byte("changed"), 0644); err != nil {
+		t.Fatalf("error modifying test file: %v", err)
+	}
+	missing := filepath.Join(dir, "missing.txt")
+
+	state := client.GooGetState{
+		{
+			PackageSpec:    &goolib.PkgSpec{Name: "ok_pkg", Arch: "noarch", Version: "1.0.0@1"},
+			InstalledFiles: map[string]string{dir: "", good: chksum},
+		},
+		{
+			PackageSpec:    &goolib.PkgSpec{Name: "mod_pkg", Arch: "noarch", Version: "1.0.0@1"},
+			InstalledFiles: map[string]string{good: chksum, changed: chksum},
+		},
+		{
+			PackageSpec:    &goolib.PkgSpec{Name: "gone_pkg", Arch: "noarch", Version: "1.0.0@1"},
+			InstalledFiles: map[string]string{changed: chksum, missing: chksum},
+		},
+	}
+
+	want := []Result{
+		{
+			Name: "gone_pkg", Arch: "noarch", Version: "1.0.0@1", Status: StatusMissing,
+			Files: []File{{changed, StatusModified}, {missing, StatusMissing}},
+		},
+		{
+			Name: "mod_pkg", Arch: "noarch", Version: "1.0.0@1", Status: StatusModified,
+			Files: []File{{changed, StatusModified}},
+		},
+		{Name: "ok_pkg", Arch: "noarch", Version: "1.0.0@1", Status: StatusOK},
+	}
+	got := All(state, 2, false)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("All returned unexpected results, want: %+v, got: %+v", want, got)
+	}
+
+	sum := Summary(got)
+	if sum[StatusOK] != 1 || sum[StatusModified] != 1 || sum[StatusMissing] != 1 {
+		t.Errorf("unexpected summary: %v", sum)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJUnit(&buf, got); err != nil {
+		t.Fatalf("error writing JUnit report: %v", err)
+	}
+	var ts junitTestSuite
+	if err := xml.Unmarshal(buf.Bytes(), &ts); err != nil {
+		t.Fatalf("error parsing JUnit report: %v", err)
+	}
+	if ts.Tests != 3 || ts.Failures != 2 {
+		t.Errorf("JUnit report has %d tests and %d failures, want 3 and 2", ts.Tests, ts.Failures)
+	}
+}